@@ -0,0 +1,160 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// WatchdogRegistration represents watchdog registration information
+type WatchdogRegistration struct {
+	Hostname        string `json:"hostname"`
+	AgentService    string `json:"agent_service"`
+	WatchdogVersion string `json:"watchdog_version"`
+}
+
+// WatchdogHeartbeat represents the watchdog's own heartbeat. It is sent
+// independently of the agent so the server can tell "agent down, watchdog
+// restarting it" apart from "host offline".
+type WatchdogHeartbeat struct {
+	WatchdogID      string     `json:"watchdog_id"`
+	Hostname        string     `json:"hostname"`
+	WatchdogVersion string     `json:"watchdog_version"`
+	AgentStatus     string     `json:"agent_status"` // "running", "stopped", "unknown"
+	RestartCount    int        `json:"restart_count"`
+	LastRestartAt   *time.Time `json:"last_restart_at,omitempty"`
+	Timestamp       time.Time  `json:"timestamp"`
+}
+
+// WatchdogAlert reports an agent restart, or a failure to restart it
+type WatchdogAlert struct {
+	WatchdogID   string    `json:"watchdog_id,omitempty"` // empty before registration
+	Hostname     string    `json:"hostname"`
+	AlertType    string    `json:"alert_type"` // "agent_restarted", "agent_start_failed" or "agent_restart_failed"
+	Message      string    `json:"message"`
+	RestartCount int       `json:"restart_count"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// loadConfig loads the agent configuration that lives next to the watchdog
+// executable (the service working directory is System32, not the install dir)
+func loadConfig() (*config.Config, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return config.Load(filepath.Join(filepath.Dir(exe), "config.yaml"))
+}
+
+// register registers the watchdog with SIEM server
+func (w *Watchdog) register() error {
+	registration := &WatchdogRegistration{
+		Hostname:        w.hostname,
+		AgentService:    agentServiceName,
+		WatchdogVersion: version,
+	}
+
+	body, err := w.post("/api/v1/agents/watchdog/register", registration)
+	if err != nil {
+		return fmt.Errorf("registration failed: %w", err)
+	}
+
+	var resp struct {
+		WatchdogID string `json:"watchdog_id"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.WatchdogID == "" {
+		return fmt.Errorf("server did not assign a watchdog ID")
+	}
+
+	w.watchdogID = resp.WatchdogID
+	return nil
+}
+
+// sendHeartbeat sends the watchdog heartbeat, registering first if needed
+func (w *Watchdog) sendHeartbeat() {
+	if w.cfg == nil {
+		return
+	}
+
+	if w.watchdogID == "" {
+		if err := w.register(); err != nil {
+			w.logger.Warningf("Watchdog registration failed: %v", err)
+			return
+		}
+		w.logger.Infof("Watchdog registered (ID: %s)", w.watchdogID)
+	}
+
+	agentStatus := "unknown"
+	if running, err := isServiceRunning(agentServiceName); err == nil {
+		agentStatus = "stopped"
+		if running {
+			agentStatus = "running"
+		}
+	}
+
+	heartbeat := &WatchdogHeartbeat{
+		WatchdogID:      w.watchdogID,
+		Hostname:        w.hostname,
+		WatchdogVersion: version,
+		AgentStatus:     agentStatus,
+		RestartCount:    w.restartCount,
+		Timestamp:       time.Now(),
+	}
+	if !w.lastRestartTime.IsZero() {
+		lastRestart := w.lastRestartTime
+		heartbeat.LastRestartAt = &lastRestart
+	}
+
+	if _, err := w.post("/api/v1/agents/watchdog/heartbeat", heartbeat); err != nil {
+		w.logger.Warningf("Error sending watchdog heartbeat: %v", err)
+	}
+}
+
+// post sends a JSON request to the SIEM server and returns the response body
+func (w *Watchdog) post(path string, data interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Authenticate as the agent, with the credential it currently holds
+	if err := w.apiClient.LoadCredential(); err != nil {
+		w.logger.Warningf("Watchdog falls back to the API key: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", w.cfg.SIEM.APIURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SIEM-Watchdog/"+version)
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
+}
@@ -1,12 +1,13 @@
+//go:build windows
+
 package main
 
 import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"os/exec"
-	"syscall"
 	"time"
 	"unsafe"
 
@@ -14,6 +15,9 @@ import (
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/siem/agent/internal/config"
+	"github.com/siem/agent/internal/sender"
 )
 
 const (
@@ -22,8 +26,6 @@ const (
 	watchdogDescription    = "Monitors and protects SIEM Security Agent"
 	agentServiceName       = "SIEMAgent"
 	checkInterval          = 5 * time.Second
-	maxRestartAttempts     = 3
-	restartCooldown        = 30 * time.Second
 )
 
 var (
@@ -36,11 +38,43 @@ type Watchdog struct {
 	stopChan       chan struct{}
 	restartCount   int
 	lastRestartTime time.Time
+
+	// Restart backoff state
+	policy          config.WatchdogConfig
+	failureTimes    []time.Time
+	nextRestartTime time.Time
+	healthySince    time.Time
+	gaveUp          bool
+
+	// SIEM server connection for the watchdog's own heartbeat, with the
+	// agent's credential
+	cfg        *config.Config
+	apiClient  *sender.APIClient
+	httpClient *http.Client
+	hostname   string
+	watchdogID string
 }
 
 func (w *Watchdog) Start(s service.Service) error {
 	w.logger.Info("Starting SIEM Watchdog v" + version)
 	w.stopChan = make(chan struct{})
+
+	// Load agent configuration for SIEM heartbeat
+	cfg, err := loadConfig()
+	if err != nil {
+		w.logger.Warningf("Could not load config, watchdog heartbeat disabled: %v", err)
+	} else {
+		w.cfg = cfg
+		w.apiClient = sender.NewAPIClient(cfg)
+		w.httpClient = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: w.apiClient.Transport(nil),
+		}
+		w.hostname, _ = os.Hostname()
+		w.policy = cfg.Watchdog
+	}
+	w.policy.SetDefaults()
+
 	go w.run()
 	return nil
 }
@@ -55,12 +89,24 @@ func (w *Watchdog) run() {
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
 
+	heartbeatInterval := time.Minute
+	if w.cfg != nil {
+		heartbeatInterval = time.Duration(w.cfg.SIEM.HeartbeatInterval) * time.Second
+	}
+	heartbeatTicker := time.NewTicker(heartbeatInterval)
+	defer heartbeatTicker.Stop()
+
+	// Announce ourselves immediately
+	w.sendHeartbeat()
+
 	for {
 		select {
 		case <-w.stopChan:
 			return
 		case <-ticker.C:
 			w.checkAndProtect()
+		case <-heartbeatTicker.C:
+			w.sendHeartbeat()
 		}
 	}
 }
@@ -73,36 +119,97 @@ func (w *Watchdog) checkAndProtect() {
 		return
 	}
 
-	if !running {
-		w.logger.Warning("SIEM Agent is not running! Attempting to restart...")
-
-		// Check restart cooldown
-		if time.Since(w.lastRestartTime) < restartCooldown {
-			w.restartCount++
-			if w.restartCount > maxRestartAttempts {
-				w.logger.Errorf("Max restart attempts (%d) reached within cooldown period", maxRestartAttempts)
-				// Send alert to SIEM server
-				w.sendAlert("agent_restart_failed", "Max restart attempts reached")
-				return
-			}
-		} else {
-			w.restartCount = 0
-		}
+	if running {
+		w.recordHealthy()
+	} else {
+		w.healthySince = time.Time{}
+		w.restartAgent()
+	}
+
+	// Check if agent process exists
+	w.checkAgentProcess()
+}
+
+// recordHealthy resets the restart backoff once the agent has stayed up
+// for the configured healthy period
+func (w *Watchdog) recordHealthy() {
+	now := time.Now()
+	if w.healthySince.IsZero() {
+		w.healthySince = now
+		return
+	}
+
+	if w.restartCount == 0 && !w.gaveUp {
+		return
+	}
+
+	if now.Sub(w.healthySince) >= time.Duration(w.policy.HealthyResetPeriod)*time.Second {
+		w.logger.Infof("SIEM Agent healthy for %v, resetting restart backoff", now.Sub(w.healthySince).Round(time.Second))
+		w.restartCount = 0
+		w.failureTimes = nil
+		w.nextRestartTime = time.Time{}
+		w.gaveUp = false
+	}
+}
+
+// restartAgent attempts to start the agent service, applying exponential
+// backoff and giving up after MaxFailures within FailureWindow
+func (w *Watchdog) restartAgent() {
+	if w.gaveUp {
+		return
+	}
+
+	now := time.Now()
+	if now.Before(w.nextRestartTime) {
+		return
+	}
 
-		// Attempt to start the service
-		if err := startService(agentServiceName); err != nil {
-			w.logger.Errorf("Failed to start agent service: %v", err)
-			w.sendAlert("agent_start_failed", err.Error())
-		} else {
-			w.logger.Info("Successfully restarted SIEM Agent")
-			w.sendAlert("agent_restarted", "Agent was stopped and has been restarted")
+	// Drop failures that fell out of the window
+	window := time.Duration(w.policy.FailureWindow) * time.Minute
+	recent := w.failureTimes[:0]
+	for _, t := range w.failureTimes {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
 		}
+	}
+	w.failureTimes = append(recent, now)
+
+	if len(w.failureTimes) > w.policy.MaxFailures {
+		w.gaveUp = true
+		msg := fmt.Sprintf("Agent failed %d times within %d minutes, giving up restarts",
+			len(w.failureTimes)-1, w.policy.FailureWindow)
+		w.logger.Error(msg)
+		w.sendAlert("agent_restart_failed", msg)
+		return
+	}
+
+	w.logger.Warning("SIEM Agent is not running! Attempting to restart...")
 
-		w.lastRestartTime = time.Now()
+	if err := startService(agentServiceName); err != nil {
+		w.logger.Errorf("Failed to start agent service: %v", err)
+		w.sendAlert("agent_start_failed", err.Error())
+	} else {
+		w.logger.Info("Successfully restarted SIEM Agent")
+		w.sendAlert("agent_restarted", "Agent was stopped and has been restarted")
 	}
 
-	// Check if agent process exists
-	w.checkAgentProcess()
+	w.restartCount++
+	w.lastRestartTime = now
+	w.nextRestartTime = now.Add(w.restartDelay())
+}
+
+// restartDelay returns the backoff delay before the next restart attempt
+func (w *Watchdog) restartDelay() time.Duration {
+	delay := time.Duration(w.policy.RestartInitialDelay) * time.Second
+	maxDelay := time.Duration(w.policy.RestartMaxDelay) * time.Second
+
+	for i := 1; i < w.restartCount; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
 }
 
 func (w *Watchdog) checkAgentProcess() {
@@ -127,8 +234,22 @@ func (w *Watchdog) checkAgentProcess() {
 }
 
 func (w *Watchdog) sendAlert(alertType, message string) {
-	// TODO: Send alert to SIEM server
 	w.logger.Infof("ALERT [%s]: %s", alertType, message)
+	if w.cfg == nil {
+		return
+	}
+
+	alert := &WatchdogAlert{
+		WatchdogID:   w.watchdogID,
+		Hostname:     w.hostname,
+		AlertType:    alertType,
+		Message:      message,
+		RestartCount: w.restartCount,
+		Timestamp:    time.Now(),
+	}
+	if _, err := w.post("/api/v1/agents/watchdog/alert", alert); err != nil {
+		w.logger.Warningf("Error sending watchdog alert: %v", err)
+	}
 }
 
 // isServiceRunning checks if a Windows service is running
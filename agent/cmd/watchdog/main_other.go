@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// The watchdog protects and restarts the Windows service. On Linux and
+// macOS systemd and launchd restart the agent (Restart=always, KeepAlive).
+func main() {
+	fmt.Fprintln(os.Stderr, "SIEM Watchdog is only needed on Windows; systemd and launchd restart the agent on Linux and macOS")
+	os.Exit(1)
+}
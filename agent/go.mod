@@ -12,3 +12,8 @@ require (
 	github.com/google/uuid v1.5.0
 	github.com/shirou/gopsutil/v3 v3.23.12
 )
+
+require (
+	github.com/go-ole/go-ole v1.2.6 // indirect
+	github.com/yusufpapurcu/wmi v1.2.3 // indirect
+)
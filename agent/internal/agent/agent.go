@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/siem/agent/internal/cache"
 	"github.com/siem/agent/internal/collector"
 	"github.com/siem/agent/internal/config"
 	"github.com/siem/agent/internal/sender"
@@ -20,17 +22,65 @@ type Agent struct {
 	version     string
 	agentID     string
 	hostname    string
+	deviceClass string // tagged on every event
 	ctx         context.Context
 	cancel      context.CancelFunc
 	wg          sync.WaitGroup
 
 	// Components
 	eventCollector *collector.EventLogCollector
+	journaldCollector *collector.JournaldCollector
+	auditdCollector   *collector.AuditdCollector
+	unifiedLogCollector *collector.UnifiedLogCollector
+	endpointSecurityCollector *collector.EndpointSecurityCollector
+	connectionCollector *collector.ConnectionCollector
+	identityCollector   *collector.IdentityCollector
+	snmpTrapListener    *collector.SNMPTrapListener
+	syslogListener      *collector.SyslogListener
 	inventoryCollector *collector.InventoryCollector
+	vulnerabilities    *collector.VulnerabilityMatcher // nil unless vulnerability matching is enabled
+	containerResolver  *collector.ContainerResolver
 	apiClient      *sender.APIClient
+	syslogOutput   *sender.SyslogForwarder // nil unless syslog_output is enabled
+
+	// Software control
+	softwareControl      *collector.SoftwareControlCollector
+	installerInterceptor *collector.InstallerInterceptor
+	appLockerManager     *collector.AppLockerManager
+	softwareLearner      *collector.SoftwareLearner
+	removalMonitor       *collector.RemovalMonitor
+
+	// Remote support sessions
+	remoteSessions *collector.RemoteSessionManager
+
+	// App store installer sharing
+	peerCache *collector.PeerCache
+
+	// Unclean shutdown, low disk space, dropped event and time sync detection
+	bootTracker *collector.BootTracker
+	diskMonitor *collector.DiskSpaceMonitor
+	dropMonitor *collector.DropMonitor
+	timeSync    *collector.TimeSyncMonitor
+
+	// High-severity-only collection while the server is unreachable
+	breaker *collector.CollectionBreaker
+
+	// On-agent Sigma rule evaluation, IOC matching and correlation
+	detection   *collector.SigmaEngine
+	threatIntel *collector.IOCMatcher
+	taxiiSync   *collector.TAXIISync
+	correlation *collector.CorrelationEngine
+
+	// Decoy files and credentials
+	deception *collector.DeceptionMonitor
+
+	// System info refresh; registeredInfo is what registration sent
+	sysInfoMonitor *collector.SystemInfoMonitor
+	registeredInfo *sysinfo.SystemInfo
 
 	// Event queue
-	eventQueue     chan *collector.Event
+	eventQueue     *collector.EventQueue
+	watermarks     *collector.RecordWatermarks // already sent Event Log records
 	mutex          sync.RWMutex
 
 	// Statistics
@@ -42,6 +92,15 @@ type Stats struct {
 	EventsCollected  uint64
 	EventsSent       uint64
 	EventsFailed     uint64
+	EventsDropped    uint64 // queue full, all channels
+	EventsDuplicate  uint64 // already sent, suppressed by the watermarks
+	DroppedByChannel map[string]uint64
+	QueueDepth       int
+	QueueCapacity    int
+	SpoolBytes       int64   // events spilled to disk
+	BytesRaw         uint64  // request bodies before compression
+	BytesSent        uint64  // request bodies as sent
+	CompressionRatio float64 // BytesRaw / BytesSent
 	LastHeartbeat    time.Time
 	LastInventory    time.Time
 	Uptime           time.Time
@@ -49,29 +108,27 @@ type Stats struct {
 
 // New creates a new agent instance
 func New(cfg *config.Config, version string) (*Agent, error) {
+	// In container mode the agent registers as the node it runs on
+	if cfg.Container.Enabled && cfg.Container.NodeName != "" {
+		sysinfo.SetHostname(cfg.Container.NodeName)
+	}
+
 	hostname, err := sysinfo.GetHostname()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get hostname: %w", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Create API client
-	apiClient, err := sender.NewAPIClient(cfg.SIEM.APIURL, cfg.Advanced.RetryAttempts)
-	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to create API client: %w", err)
+	// In container mode host files are read below the host mount
+	var containerResolver *collector.ContainerResolver
+	if cfg.Container.Enabled {
+		collector.SetHostRoot(cfg.Container.HostRoot)
+		containerResolver = collector.NewContainerResolver(hostname)
 	}
 
-	// Create event collector
-	eventCollector, err := collector.NewEventLogCollector(&cfg.EventLog, &cfg.Sysmon)
-	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to create event collector: %w", err)
-	}
+	ctx, cancel := context.WithCancel(context.Background())
 
-	// Create inventory collector
-	inventoryCollector := collector.NewInventoryCollector(&cfg.Inventory)
+	// Create API client
+	apiClient := sender.NewAPIClient(cfg)
 
 	agent := &Agent{
 		config:             cfg,
@@ -79,10 +136,10 @@ func New(cfg *config.Config, version string) (*Agent, error) {
 		hostname:           hostname,
 		ctx:                ctx,
 		cancel:             cancel,
-		eventCollector:     eventCollector,
-		inventoryCollector: inventoryCollector,
+		containerResolver:  containerResolver,
 		apiClient:          apiClient,
-		eventQueue:         make(chan *collector.Event, cfg.SIEM.MaxQueueSize),
+		eventQueue:         collector.NewEventQueue(cfg.SIEM.MaxQueueSize, &cfg.Queue),
+		watermarks:         collector.NewRecordWatermarks(&cfg.EventLog),
 		stats: Stats{
 			Uptime: time.Now(),
 		},
@@ -97,6 +154,24 @@ func (a *Agent) Start() error {
 	log.Printf("Hostname: %s", a.hostname)
 	log.Printf("SIEM API: %s", a.config.SIEM.APIURL)
 
+	a.deviceClass = sysinfo.GetDeviceClass()
+	if a.config.Container.Enabled {
+		a.deviceClass = "server" // a cluster node, whatever the hardware looks like
+	}
+	log.Printf("Device class: %s", a.deviceClass)
+
+	// Tell deployment teams early when the agent cannot read what it collects
+	if access := collector.CheckPlatformAccess(); access != nil {
+		for _, missing := range access.Missing {
+			log.Printf("Warning: %s", missing)
+		}
+	}
+
+	// Authenticate with the per-agent credential issued at enrollment
+	if err := a.apiClient.EnsureCredential(a.hostname); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	// Register agent with SIEM server
 	if a.config.SIEM.RegisterOnStartup {
 		if err := a.register(); err != nil {
@@ -107,10 +182,114 @@ func (a *Agent) Start() error {
 		}
 	}
 
-	// Start event collector
+	// Report an unexpected reboot or termination since the last run
+	a.bootTracker = collector.NewBootTracker(a.agentID, a.hostname)
+	for _, event := range a.bootTracker.Start(sysinfo.GetBootTime()) {
+		a.queueEvent(event)
+	}
+
+	a.diskMonitor = collector.NewDiskSpaceMonitor(a.agentID, a.hostname, a.config.Inventory.LowDiskPercent)
+	a.dropMonitor = collector.NewDropMonitor(a.agentID, a.hostname, a.config.SIEM.DropWarningThreshold)
+	if a.config.TimeSync.Enabled {
+		a.timeSync = collector.NewTimeSyncMonitor(&a.config.TimeSync, a.agentID, a.hostname)
+	}
+	a.breaker = collector.NewCollectionBreaker(a.agentID, a.hostname, a.eventQueue)
+
+	// Evaluate Sigma rules, IOCs and correlation rules on events before any
+	// collector queues them
+	if a.config.Detection.Enabled {
+		a.startDetection()
+	}
+	if a.config.ThreatIntel.Enabled {
+		a.startThreatIntel()
+	}
+	if a.config.Correlation.Enabled {
+		a.correlation = collector.NewCorrelationEngine(&a.config.Correlation, a.agentID, a.hostname)
+		a.eventQueue.AddInspector(a.correlation)
+		log.Println("✓ Local correlation started")
+	}
+
+	// Plant decoys before the file collectors start, so their filters cover them
+	if a.config.Deception.Enabled {
+		a.startDeception()
+	}
+
+	// Start the LAN installer cache before anything installs
+	if a.config.AppStore.PeerCache {
+		a.peerCache = collector.NewPeerCache(&a.config.AppStore)
+		if err := a.peerCache.Start(); err != nil {
+			log.Printf("Warning: Failed to start peer installer cache: %v", err)
+			a.peerCache = nil
+		}
+	}
+
+	// Start system info refresh
+	a.startSystemInfoMonitor()
+
+	// Start software control
+	if a.config.SoftwareControl.Enabled {
+		a.startSoftwareControl()
+	}
+
+	// Start managed app store updates
+	if a.config.AppStore.AutoUpdate {
+		go a.newAppStoreClient().RunUpdates(a.ctx)
+	}
+
+	// Start remote support sessions
+	if a.config.RemoteSession.Enabled {
+		a.startRemoteSessions()
+	}
+
+	// Start Windows Event Log collector
 	if a.config.EventLog.Enabled {
-		a.wg.Add(1)
-		go a.collectEvents()
+		a.startEventLog()
+	}
+
+	// Start systemd journal collector (Linux)
+	if a.config.Journald.Enabled {
+		a.startJournald()
+	}
+
+	// Start Linux audit collector
+	if a.config.Auditd.Enabled {
+		a.startAuditd()
+	}
+
+	// Start macOS unified log collector
+	if a.config.UnifiedLog.Enabled {
+		a.startUnifiedLog()
+	}
+
+	// Start macOS Endpoint Security client
+	if a.config.EndpointSecurity.Enabled {
+		a.startEndpointSecurity()
+	}
+
+	// Start Linux network connection collector
+	if a.config.Connections.Enabled {
+		a.startConnections()
+	}
+
+	// Start Linux user, group, sudoers and SSH key change monitoring
+	if a.config.Identity.Enabled {
+		a.startIdentity()
+	}
+
+	// Receive SNMP traps from network devices
+	if a.config.SNMPTrap.Enabled {
+		a.startSNMPTraps()
+	}
+
+	// Accept syslog from devices on the local network
+	if a.config.SyslogInput.Enabled {
+		a.startSyslogListener()
+	}
+
+	// Forward events as CEF or LEEF to a syslog receiver too
+	if a.config.SyslogOutput.Enabled {
+		a.syslogOutput = sender.NewSyslogForwarder(&a.config.SyslogOutput, a.hostname, a.version)
+		log.Printf("✓ Forwarding events to syslog %s (%s)", a.config.SyslogOutput.Address, a.config.SyslogOutput.Format)
 	}
 
 	// Start event sender
@@ -121,8 +300,14 @@ func (a *Agent) Start() error {
 	a.wg.Add(1)
 	go a.heartbeat()
 
+	// Match the inventory against the server's advisory feed
+	if a.config.Inventory.Enabled && a.config.Vulnerabilities.Enabled {
+		a.startVulnerabilityMatching()
+	}
+
 	// Start inventory scanner
 	if a.config.Inventory.Enabled {
+		a.inventoryCollector = collector.NewInventoryCollector(a.agentID, a.hostname)
 		a.wg.Add(1)
 		go a.scanInventory()
 	}
@@ -141,6 +326,59 @@ func (a *Agent) Stop() error {
 	// Cancel context
 	a.cancel()
 
+	// Release any held installers before shutting down
+	if a.installerInterceptor != nil {
+		a.installerInterceptor.Stop()
+	}
+	if a.softwareControl != nil {
+		a.softwareControl.Stop()
+	}
+	if a.appLockerManager != nil {
+		a.appLockerManager.Stop()
+	}
+	if a.softwareLearner != nil {
+		a.softwareLearner.Stop()
+	}
+	if a.removalMonitor != nil {
+		a.removalMonitor.Stop()
+	}
+	if a.remoteSessions != nil {
+		a.remoteSessions.Stop()
+	}
+	if a.peerCache != nil {
+		a.peerCache.Stop()
+	}
+	if a.sysInfoMonitor != nil {
+		a.sysInfoMonitor.Stop()
+	}
+	if a.eventCollector != nil {
+		a.eventCollector.Stop()
+	}
+	if a.journaldCollector != nil {
+		a.journaldCollector.Stop()
+	}
+	if a.auditdCollector != nil {
+		a.auditdCollector.Stop()
+	}
+	if a.unifiedLogCollector != nil {
+		a.unifiedLogCollector.Stop()
+	}
+	if a.endpointSecurityCollector != nil {
+		a.endpointSecurityCollector.Stop()
+	}
+	if a.connectionCollector != nil {
+		a.connectionCollector.Stop()
+	}
+	if a.identityCollector != nil {
+		a.identityCollector.Stop()
+	}
+	if a.snmpTrapListener != nil {
+		a.snmpTrapListener.Stop()
+	}
+	if a.syslogListener != nil {
+		a.syslogListener.Stop()
+	}
+
 	// Wait for goroutines to finish (with timeout)
 	done := make(chan struct{})
 	go func() {
@@ -155,12 +393,172 @@ func (a *Agent) Stop() error {
 		log.Println("⚠ Agent stop timeout, forcing shutdown")
 	}
 
-	// Close event queue
-	close(a.eventQueue)
+	if a.bootTracker != nil {
+		a.bootTracker.Stop()
+	}
+
+	// Close the event queue; unsent events are kept in the spool
+	a.eventQueue.Close()
+	if a.eventCollector != nil {
+		a.eventCollector.SaveBookmarks()
+	}
+
+	if a.syslogOutput != nil {
+		a.syslogOutput.Close()
+	}
 
 	return nil
 }
 
+// startEventLog starts subscribing to the Windows Event Log channels
+func (a *Agent) startEventLog() {
+	eventCollector, err := collector.NewEventLogCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create event collector: %v", err)
+		return
+	}
+	if err := eventCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start event collector: %v", err)
+		return
+	}
+	a.eventCollector = eventCollector
+	log.Println("✓ Event Log collector started")
+}
+
+// startJournald starts tailing the systemd journal into the event queue
+func (a *Agent) startJournald() {
+	journaldCollector, err := collector.NewJournaldCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create journald collector: %v", err)
+		return
+	}
+	if err := journaldCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start journald collector: %v", err)
+		return
+	}
+	a.journaldCollector = journaldCollector
+	log.Println("✓ Journald collector started")
+}
+
+// startAuditd starts collecting Linux audit events into the event queue
+func (a *Agent) startAuditd() {
+	auditdCollector, err := collector.NewAuditdCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create auditd collector: %v", err)
+		return
+	}
+	if err := auditdCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start auditd collector: %v", err)
+		return
+	}
+	a.auditdCollector = auditdCollector
+	log.Println("✓ Auditd collector started")
+}
+
+// startUnifiedLog starts streaming the macOS unified log into the event queue
+func (a *Agent) startUnifiedLog() {
+	unifiedLogCollector, err := collector.NewUnifiedLogCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create unified log collector: %v", err)
+		return
+	}
+	if err := unifiedLogCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start unified log collector: %v", err)
+		return
+	}
+	a.unifiedLogCollector = unifiedLogCollector
+	log.Println("✓ Unified log collector started")
+}
+
+// startEndpointSecurity starts receiving Endpoint Security events into
+// the event queue. Without the entitlement, Full Disk Access or root the
+// client cannot be created and the unified log remains the only source.
+func (a *Agent) startEndpointSecurity() {
+	endpointSecurityCollector, err := collector.NewEndpointSecurityCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create Endpoint Security collector: %v", err)
+		return
+	}
+	if err := endpointSecurityCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start Endpoint Security collector: %v", err)
+		return
+	}
+	a.endpointSecurityCollector = endpointSecurityCollector
+	log.Println("✓ Endpoint Security collector started")
+}
+
+// startConnections starts reporting new network connections into the event queue
+func (a *Agent) startConnections() {
+	connectionCollector, err := collector.NewConnectionCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create connection collector: %v", err)
+		return
+	}
+	if err := connectionCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start connection collector: %v", err)
+		return
+	}
+	a.connectionCollector = connectionCollector
+	log.Println("✓ Connection collector started")
+}
+
+// startIdentity starts reporting account, group, sudoers and SSH key
+// changes into the event queue
+func (a *Agent) startIdentity() {
+	identityCollector, err := collector.NewIdentityCollector(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create identity collector: %v", err)
+		return
+	}
+	if err := identityCollector.Start(); err != nil {
+		log.Printf("Warning: Failed to start identity collector: %v", err)
+		return
+	}
+	a.identityCollector = identityCollector
+	log.Println("✓ Identity collector started")
+}
+
+// startSNMPTraps starts receiving SNMP traps from network devices into
+// the event queue
+func (a *Agent) startSNMPTraps() {
+	snmpTrapListener, err := collector.NewSNMPTrapListener(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create SNMP trap listener: %v", err)
+		return
+	}
+	if err := snmpTrapListener.Start(); err != nil {
+		log.Printf("Warning: Failed to start SNMP trap listener: %v", err)
+		return
+	}
+	a.snmpTrapListener = snmpTrapListener
+	log.Println("✓ SNMP trap listener started")
+}
+
+// startSyslogListener starts accepting syslog from network devices into
+// the event queue
+func (a *Agent) startSyslogListener() {
+	syslogListener, err := collector.NewSyslogListener(a.config, a.agentID, a.eventQueue)
+	if err != nil {
+		log.Printf("Warning: Failed to create syslog listener: %v", err)
+		return
+	}
+	if err := syslogListener.Start(); err != nil {
+		log.Printf("Warning: Failed to start syslog listener: %v", err)
+		return
+	}
+	a.syslogListener = syslogListener
+	log.Println("✓ Syslog listener started")
+}
+
+// newAppStoreClient creates an app store client sharing the peer cache
+func (a *Agent) newAppStoreClient() *collector.AppStoreClient {
+	client := collector.NewAppStoreClient(a.config, a.agentID, a.apiClient.Transport)
+	if a.peerCache != nil {
+		client.SetPeerCache(a.peerCache)
+	}
+	return client
+}
+
 // register registers the agent with SIEM server
 func (a *Agent) register() error {
 	sysInfo, err := sysinfo.Gather()
@@ -168,73 +566,248 @@ func (a *Agent) register() error {
 		return fmt.Errorf("failed to gather system info: %w", err)
 	}
 
-	registration := &sender.AgentRegistration{
-		Hostname:         a.hostname,
-		FQDN:             sysInfo.FQDN,
-		IPAddress:        sysInfo.IPAddress,
-		MACAddress:       sysInfo.MACAddress,
-		OSVersion:        sysInfo.OSVersion,
-		OSBuild:          sysInfo.OSBuild,
-		OSArchitecture:   sysInfo.Architecture,
-		Domain:           sysInfo.Domain,
-		CPUModel:         sysInfo.CPUModel,
-		CPUCores:         sysInfo.CPUCores,
-		TotalRAM_MB:      sysInfo.TotalRAM_MB,
-		TotalDisk_GB:     sysInfo.TotalDisk_GB,
-		AgentVersion:     a.version,
-		CriticalityLevel: a.config.Agent.Criticality,
-		Location:         a.config.Agent.Location,
-		Owner:            a.config.Agent.Owner,
-		Tags:             a.config.Agent.Tags,
-	}
-
-	resp, err := a.apiClient.RegisterAgent(a.ctx, registration)
+	a.registeredInfo = sysInfo
+
+	// Enrolled agents keep the ID issued with their credential
+	agentID := a.apiClient.AgentID()
+	if agentID == "" {
+		agentID = uuid.New().String()
+	}
+
+	registration := &collector.RegistrationData{
+		AgentID:         agentID,
+		Hostname:        a.hostname,
+		FQDN:            sysInfo.FQDN,
+		IPAddress:       sysInfo.IPAddress,
+		MACAddress:      sysInfo.MACAddress,
+		NetworkAdapters: sysInfo.NetworkAdapters,
+		OSVersion:       sysInfo.OSVersion,
+		OSBuild:         sysInfo.OSBuild,
+		Architecture:    sysInfo.Architecture,
+		Domain:          sysInfo.Domain,
+		CPUModel:        sysInfo.CPUModel,
+		CPUCores:        sysInfo.CPUCores,
+		TotalRAM_MB:     sysInfo.TotalRAM_MB,
+		TotalDisk_GB:    sysInfo.TotalDisk_GB,
+		Volumes:         sysInfo.Volumes,
+		DeviceClass:     sysInfo.DeviceClass,
+		Manufacturer:    sysInfo.Manufacturer,
+		Model:           sysInfo.Model,
+		SerialNumber:    sysInfo.SerialNumber,
+		BIOSVersion:     sysInfo.BIOSVersion,
+		ChassisType:     sysInfo.ChassisType,
+		Cloud:           sysInfo.Cloud,
+		Virtualization:  sysInfo.Virtualization,
+		SecurityPosture: sysInfo.SecurityPosture,
+		Access:          collector.CheckPlatformAccess(),
+		AgentVersion:    a.version,
+		Config: map[string]string{
+			"criticality": a.config.Agent.Criticality,
+			"location":    a.config.Agent.Location,
+			"owner":       a.config.Agent.Owner,
+			"tags":        strings.Join(a.config.Agent.Tags, ","),
+		},
+	}
+
+	assignedID, err := a.apiClient.RegisterAgent(registration)
 	if err != nil {
 		return err
 	}
 
-	a.agentID = resp.AgentID
+	a.agentID = assignedID
 	return nil
 }
 
-// collectEvents collects events from Windows Event Log
-func (a *Agent) collectEvents() {
-	defer a.wg.Done()
+// startDetection loads the stored Sigma rules and keeps them in sync
+func (a *Agent) startDetection() {
+	a.detection = collector.NewSigmaEngine(&a.config.Detection, a.agentID, a.hostname)
+	a.detection.SetRuleSource(func() ([]string, error) {
+		return a.apiClient.GetSigmaRules(a.agentID)
+	})
+	a.eventQueue.AddInspector(a.detection)
+	go a.detection.StartRuleSync(a.ctx)
+	log.Println("✓ Sigma detection started")
+}
 
-	log.Println("Starting event collection...")
+// startThreatIntel loads the stored IOC sets and keeps them in sync
+func (a *Agent) startThreatIntel() {
+	a.threatIntel = collector.NewIOCMatcher(&a.config.ThreatIntel, a.agentID, a.hostname)
+	a.threatIntel.SetIOCSource(func() (*collector.IOCSet, error) {
+		return a.apiClient.GetIOCSets(a.agentID)
+	})
+	a.eventQueue.AddInspector(a.threatIntel)
+	go a.threatIntel.StartIOCSync(a.ctx)
+
+	if len(a.config.ThreatIntel.TAXIIFeeds) > 0 {
+		a.taxiiSync = collector.NewTAXIISync(&a.config.ThreatIntel, a.threatIntel)
+		a.taxiiSync.SetServerProxy(a.config.SIEM.APIURL+"/api/v1/detection/taxii/", a.apiClient.Transport)
+		go a.taxiiSync.Start(a.ctx)
+		log.Printf("✓ TAXII sync started for %d feeds", len(a.config.ThreatIntel.TAXIIFeeds))
+	}
+	log.Println("✓ Threat-intel IOC matching started")
+}
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+// startVulnerabilityMatching loads the stored advisory feed and keeps it
+// in sync; inventory scans are matched against it
+func (a *Agent) startVulnerabilityMatching() {
+	a.vulnerabilities = collector.NewVulnerabilityMatcher(&a.config.Vulnerabilities)
+	a.vulnerabilities.SetFeedSource(func() (*collector.VulnerabilityFeed, error) {
+		return a.apiClient.GetVulnerabilityFeed(a.agentID)
+	})
+	go a.vulnerabilities.StartFeedSync(a.ctx)
+	log.Println("✓ Vulnerability matching started")
+}
 
-	for {
-		select {
-		case <-a.ctx.Done():
-			return
-		case <-ticker.C:
-			events, err := a.eventCollector.Collect()
-			if err != nil {
-				log.Printf("Error collecting events: %v", err)
-				continue
-			}
+// startDeception plants the decoys and alerts on events that touch them
+func (a *Agent) startDeception() {
+	a.deception = collector.NewDeceptionMonitor(&a.config.Deception, a.agentID, a.hostname)
+	a.deception.SetReportCallback(a.apiClient.SendDecoyInventory)
+	a.eventQueue.AddInspector(a.deception)
 
-			for _, event := range events {
-				// Add agent ID to event
-				event.AgentID = a.agentID
-
-				// Send to queue
-				select {
-				case a.eventQueue <- event:
-					a.mutex.Lock()
-					a.stats.EventsCollected++
-					a.mutex.Unlock()
-				default:
-					log.Println("Warning: Event queue full, dropping event")
-				}
-			}
+	// Decoy access must pass the collectors' own filters
+	a.config.EndpointSecurity.FilePaths = append(a.config.EndpointSecurity.FilePaths, a.deception.FilePaths()...)
+	if len(a.config.Auditd.Keys) > 0 {
+		a.config.Auditd.Keys = append(a.config.Auditd.Keys, collector.DecoyAuditKey)
+	}
+
+	go a.deception.Start(a.ctx)
+	log.Printf("✓ Deception started (%d files, %d credentials)",
+		len(a.config.Deception.Files), len(a.config.Deception.Credentials))
+}
+
+// startSoftwareControl starts software installation control
+func (a *Agent) startSoftwareControl() {
+	a.softwareControl = collector.NewSoftwareControlCollector(&a.config.SoftwareControl, a.agentID, a.hostname)
+	a.softwareControl.SetCallbacks(
+		func(request *collector.SoftwareInstallRequest) error {
+			_, err := a.apiClient.SendSoftwareInstallRequest(request)
+			return err
+		},
+		a.apiClient.CheckSoftwareRequestStatus,
+	)
+	a.softwareControl.SetCommentCallback(a.apiClient.UpdateSoftwareRequestComment)
+	a.softwareControl.SetReputationCallback(a.apiClient.CheckSoftwareReputation)
+	a.softwareControl.SetPolicyCallbacks(func() ([]config.SoftwareGroupPolicy, error) {
+		return a.apiClient.GetSoftwarePolicies(a.agentID)
+	})
+	go a.softwareControl.StartPolicySync()
+
+	if a.config.SoftwareControl.LearningMode {
+		a.softwareLearner = collector.NewSoftwareLearner(&a.config.SoftwareControl, a.agentID, a.hostname)
+		a.softwareLearner.SetCallbacks(a.apiClient.SendSoftwareLearningReport)
+		a.softwareControl.SetLearner(a.softwareLearner)
+		go a.softwareLearner.Start()
+	}
+
+	if a.config.SoftwareControl.EnforcePolicy {
+		a.appLockerManager = collector.NewAppLockerManager(&a.config.SoftwareControl, a.agentID)
+		a.appLockerManager.SetCallbacks(func() ([]collector.AllowlistEntry, error) {
+			return a.apiClient.GetSoftwareAllowlist(a.agentID)
+		})
+		go a.appLockerManager.Start()
+	}
+
+	if a.config.SoftwareControl.MonitorRemovals {
+		a.startRemovalMonitor()
+	}
+
+	if a.config.SoftwareControl.ProcessUninstalls {
+		appStore := a.newAppStoreClient()
+		go appStore.PollUninstalls(a.ctx, time.Duration(a.config.SoftwareControl.PollInterval)*time.Second)
+	}
+
+	if a.config.SoftwareControl.InterceptInstallers {
+		a.installerInterceptor = collector.NewInstallerInterceptor(a.softwareControl)
+		if err := a.installerInterceptor.Start(); err != nil {
+			log.Printf("Warning: Failed to start installer interception: %v", err)
+			a.installerInterceptor = nil
+		} else {
+			// Package-manager installs are seen in process creation events
+			a.eventQueue.AddInspector(a.installerInterceptor)
+		}
+	}
+
+	// Re-attach to requests that were pending when the agent last stopped
+	for _, request := range a.softwareControl.LoadPendingRequests() {
+		if a.installerInterceptor != nil {
+			a.installerInterceptor.Reattach(request)
+		} else {
+			go a.softwareControl.ResumeRequest(request)
 		}
 	}
 }
 
+// startRemovalMonitor starts alerting on removal of required software
+func (a *Agent) startRemovalMonitor() {
+	a.removalMonitor = collector.NewRemovalMonitor(&a.config.SoftwareControl, a.agentID, a.hostname)
+
+	var reinstall func(collector.RequiredSoftware) error
+	if a.config.SoftwareControl.ReinstallRequired {
+		appStore := a.newAppStoreClient()
+		reinstall = func(item collector.RequiredSoftware) error {
+			return appStore.InstallRequired(a.ctx, item.AppID, "Automatic reinstall of required software: "+item.Name)
+		}
+	}
+
+	a.removalMonitor.SetCallbacks(
+		func() ([]collector.RequiredSoftware, error) {
+			return a.apiClient.GetRequiredSoftware(a.agentID)
+		},
+		a.apiClient.SendSoftwareRemovalAlert,
+		reinstall,
+	)
+	a.removalMonitor.Start()
+
+	// MSI removals are seen in the Application log as events are queued
+	a.eventQueue.AddInspector(a.removalMonitor)
+}
+
+// startSystemInfoMonitor starts re-gathering system info and reporting changes
+func (a *Agent) startSystemInfoMonitor() {
+	interval := time.Duration(a.config.Inventory.SysInfoInterval) * time.Second
+	a.sysInfoMonitor = collector.NewSystemInfoMonitor(a.agentID, a.hostname, interval, a.registeredInfo)
+	a.sysInfoMonitor.SetCallbacks(
+		func(data *collector.RegistrationData) error {
+			data.AgentVersion = a.version
+			return a.apiClient.SendSystemInfo(data)
+		},
+		a.queueEvent,
+	)
+	a.sysInfoMonitor.Start()
+}
+
+// startRemoteSessions starts polling for admin-initiated remote sessions
+func (a *Agent) startRemoteSessions() {
+	a.remoteSessions = collector.NewRemoteSessionManager(&a.config.RemoteSession, a.agentID, a.hostname)
+	a.remoteSessions.SetCallbacks(
+		func() (*collector.RemoteSessionRequest, error) {
+			return a.apiClient.GetPendingRemoteSession(a.agentID)
+		},
+		a.apiClient.SendRemoteSessionResponse,
+	)
+	a.remoteSessions.SetSessionEndCallback(a.apiClient.SendRemoteSessionEnded)
+	a.remoteSessions.SetControlCallback(a.apiClient.SendControlResult)
+	a.remoteSessions.SetTerminalCallbacks(a.apiClient.SendTerminalOutput, a.apiClient.GetTerminalInput)
+	a.remoteSessions.SetTransferCallbacks(
+		a.apiClient.GetFileTransfers,
+		a.apiClient.DownloadTransferFile,
+		a.apiClient.UploadTransferFile,
+		a.apiClient.SendFileTransferResult,
+	)
+	a.remoteSessions.SetEventCallback(func(event *collector.Event) {
+		event.AgentID = a.agentID
+		a.queueEvent(event)
+	})
+	go a.remoteSessions.Start()
+}
+
+// queueEvent adds an event the agent raises itself to the send queue,
+// like the collectors do. The queue spills to disk when memory is full and
+// drops only when the spool is full or closed.
+func (a *Agent) queueEvent(event *collector.Event) {
+	a.eventQueue.Push(event)
+}
+
 // sendEvents sends collected events to SIEM server
 func (a *Agent) sendEvents() {
 	defer a.wg.Done()
@@ -242,76 +815,155 @@ func (a *Agent) sendEvents() {
 	log.Println("Starting event sender...")
 
 	batch := make([]*collector.Event, 0, a.config.SIEM.BatchSize)
-	ticker := time.NewTicker(time.Duration(a.config.SIEM.SendInterval) * time.Second)
-	defer ticker.Stop()
+
+	// The send interval adapts to the event rate
+	interval := newSendInterval(&a.config.SIEM)
+	timer := time.NewTimer(interval.current)
+	defer timer.Stop()
+	deadline := time.Now().Add(interval.current)
+	fastLane := false // the timer was moved up for a high-priority event
+	paused := false   // a send failed; the queue is not read until the timer fires
+	var lastSend time.Time
+
+	// schedule sets the next timed send
+	schedule := func(wait time.Duration) {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		deadline = time.Now().Add(wait)
+	}
 
 	sendBatch := func() {
 		if len(batch) == 0 {
 			return
 		}
+		lastSend = time.Now()
+
+		// Skip records already sent before a restart or resubscription
+		if batch = a.watermarks.Filter(batch); len(batch) == 0 {
+			return
+		}
 
-		// Convert to API format
-		apiEvents := make([]sender.EventData, len(batch))
-		for i, event := range batch {
-			apiEvents[i] = sender.EventData{
-				AgentID:           event.AgentID,
-				EventTime:         event.Timestamp,
-				SourceType:        event.SourceType,
-				EventCode:         event.EventID,
-				Severity:          event.Severity,
-				Computer:          event.Computer,
-				Message:           event.Message,
-				SubjectUser:       event.SubjectUser,
-				SubjectDomain:     event.SubjectDomain,
-				TargetUser:        event.TargetUser,
-				ProcessName:       event.ProcessName,
-				ProcessCommandLine: event.CommandLine,
-				SourceIP:          event.SourceIP,
-				DestinationIP:     event.DestinationIP,
-				FilePath:          event.FilePath,
-				RegistryPath:      event.RegistryPath,
-				RawEvent:          event.RawData,
+		// Tag events with the tenant and device class, including alerts
+		// raised by inspectors
+		tenant := a.apiClient.TenantID()
+		for _, event := range batch {
+			event.TenantID = tenant
+			event.DeviceClass = a.deviceClass
+		}
+
+		if a.syslogOutput != nil {
+			if err := a.syslogOutput.Forward(batch); err != nil {
+				log.Printf("Error forwarding events: %v", err)
 			}
 		}
 
 		// Send to SIEM
-		if err := a.apiClient.SendEvents(a.ctx, apiEvents); err != nil {
+		result, err := a.apiClient.SendEvents(batch)
+		a.mutex.Lock()
+		a.stats.EventsSent += uint64(len(result.Sent))
+		a.stats.EventsFailed += uint64(len(result.Unsent) + len(result.Skipped))
+		a.mutex.Unlock()
+		if len(result.Sent) > 0 {
+			// Only delivered events move the watermarks and bookmarks
+			a.watermarks.Advance(result.Sent)
+			if a.eventCollector != nil {
+				a.eventCollector.Delivered(result.Sent)
+			}
+			log.Printf("✓ Sent %d events to SIEM", len(result.Sent))
+		}
+
+		if err != nil {
+			// Events of the failed requests go back to the head of the
+			// queue, which spills to the spool while the server is down
 			log.Printf("Error sending events: %v", err)
-			a.mutex.Lock()
-			a.stats.EventsFailed += uint64(len(batch))
-			a.mutex.Unlock()
+			a.eventQueue.Requeue(result.Unsent)
+			a.breaker.SendFailed()
+			paused = true
 		} else {
-			a.mutex.Lock()
-			a.stats.EventsSent += uint64(len(batch))
-			a.mutex.Unlock()
-			log.Printf("✓ Sent %d events to SIEM", len(batch))
+			for _, event := range a.breaker.SendSucceeded() {
+				a.queueEvent(event)
+			}
 		}
 
-		// Clear batch
+		// Clear batch; sent and skipped events are reused by the collectors
+		for _, event := range result.Sent {
+			collector.ReleaseEvent(event)
+		}
+		for _, event := range result.Skipped {
+			collector.ReleaseEvent(event)
+		}
+		clear(batch)
 		batch = batch[:0]
 	}
 
 	for {
+		// After a failed send the queue is left alone until the timer
+		// fires, so the requeued events are not retried right away
+		ready := a.eventQueue.Ready()
+		if paused {
+			ready = nil
+		}
+
 		select {
 		case <-a.ctx.Done():
-			// Send remaining events
+			// Send remaining events; unsent ones are spooled on Close
 			sendBatch()
 			return
 
-		case event, ok := <-a.eventQueue:
-			if !ok {
-				return
+		case <-ready:
+			event := a.eventQueue.Pop()
+			if event == nil {
+				continue
+			}
+
+			// Collectors name the container's view of the host; events
+			// are reported under the node name with pod metadata
+			if a.containerResolver != nil {
+				event.Computer = a.hostname
+				a.containerResolver.Tag(event)
 			}
 			batch = append(batch, event)
 
-			// Send if batch is full
-			if len(batch) >= a.config.SIEM.BatchSize {
+			switch {
+			case len(batch) >= a.config.SIEM.BatchSize:
+				// Send if batch is full; events arrive faster than the interval
 				sendBatch()
+				fastLane = false
+				if paused {
+					schedule(interval.failed())
+				} else {
+					schedule(interval.full())
+				}
+
+			case event.Severity >= fastLaneSeverity:
+				// High-priority events go out as soon as the minimum
+				// interval since the last send allows
+				wait := max(interval.minimum-time.Since(lastSend), 0)
+				if time.Now().Add(wait).Before(deadline) {
+					fastLane = true
+					schedule(wait)
+				}
 			}
 
-		case <-ticker.C:
-			// Send batch periodically
+		case <-timer.C:
+			// Send batch periodically, adapting the interval to how full
+			// it was; a fast-lane send keeps the interval
+			next := interval.current
+			if !fastLane {
+				next = interval.elapsed(len(batch), a.config.SIEM.BatchSize)
+			}
+			fastLane = false
+			paused = false
 			sendBatch()
+			if paused {
+				next = interval.failed()
+			}
+			schedule(next)
 		}
 	}
 }
@@ -330,20 +982,87 @@ func (a *Agent) heartbeat() {
 		case <-a.ctx.Done():
 			return
 		case <-ticker.C:
+			a.bootTracker.Touch()
+
+			// Retry a failed enrollment and renew the credential when due
+			if err := a.apiClient.EnsureCredential(a.hostname); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+
 			if a.agentID == "" {
 				continue // Not registered yet
 			}
 
 			sysInfo, _ := sysinfo.Gather()
 
-			heartbeat := &sender.Heartbeat{
-				AgentID:      a.agentID,
-				Status:       "online",
-				IPAddress:    sysInfo.IPAddress,
-				AgentVersion: a.version,
+			// Low disk space alerts
+			for _, event := range a.diskMonitor.Check(sysInfo.Volumes) {
+				a.queueEvent(event)
+			}
+
+			// Events lost to a full queue since the last heartbeat
+			for _, event := range a.dropMonitor.Check() {
+				a.queueEvent(event)
+			}
+
+			// Stopped time service or clock drift, checked at its own interval
+			if a.timeSync != nil {
+				for _, event := range a.timeSync.Check() {
+					a.queueEvent(event)
+				}
+			}
+
+			stats := a.GetStats()
+
+			heartbeat := &collector.HeartbeatData{
+				AgentID:         a.agentID,
+				Hostname:        a.hostname,
+				Status:          "online",
+				Version:         a.version,
+				IPAddress:       sysInfo.IPAddress,
+				Virtualization:  sysInfo.Virtualization,
+				EventsCollected: int64(stats.EventsCollected),
+				EventsSent:      int64(stats.EventsSent),
+				Uptime:          int64(time.Since(stats.Uptime).Seconds()),
+				BootTime:        sysInfo.BootTime,
+				LoggedOnUsers:   collector.LoggedOnUsers(),
+				Access:          collector.CheckPlatformAccess(),
+				Queue: &collector.QueueStats{
+					Depth:            stats.QueueDepth,
+					Capacity:         stats.QueueCapacity,
+					SpoolBytes:       stats.SpoolBytes,
+					Dropped:          stats.EventsDropped,
+					DroppedByChannel: stats.DroppedByChannel,
+					SendFailures:     stats.EventsFailed,
+					Duplicates:       stats.EventsDuplicate,
+				},
+				Compression: a.apiClient.CompressionStats(),
+				Caches:      cache.All(),
+				Timestamp:   time.Now(),
+			}
+			if a.detection != nil {
+				heartbeat.Detection = a.detection.Stats()
+			}
+			if a.threatIntel != nil {
+				heartbeat.ThreatIntel = a.threatIntel.Stats()
+				if a.taxiiSync != nil {
+					heartbeat.ThreatIntel.Feeds = a.taxiiSync.Stats()
+				}
+			}
+			if a.vulnerabilities != nil {
+				heartbeat.Vulnerabilities = a.vulnerabilities.Stats()
+			}
+			if a.correlation != nil {
+				heartbeat.Correlation = a.correlation.Stats()
+			}
+			if a.timeSync != nil {
+				heartbeat.TimeSync = a.timeSync.Status()
+			}
+			if !sysInfo.BootTime.IsZero() {
+				heartbeat.SystemUptime = int64(time.Since(sysInfo.BootTime).Seconds())
 			}
 
-			if err := a.apiClient.SendHeartbeat(a.ctx, heartbeat); err != nil {
+			if err := a.apiClient.SendHeartbeat(heartbeat); err != nil {
 				log.Printf("Error sending heartbeat: %v", err)
 			} else {
 				a.mutex.Lock()
@@ -399,8 +1118,19 @@ func (a *Agent) performFullInventoryScan() error {
 		software, err := a.inventoryCollector.CollectSoftware()
 		if err != nil {
 			log.Printf("Error collecting software inventory: %v", err)
-		} else if len(software) > 0 {
-			if err := a.apiClient.SendSoftwareInventory(a.ctx, a.agentID, software); err != nil {
+		}
+
+		// OS version and platform items (profiles, extensions) are sent
+		// with the software list
+		software = append(software, a.inventoryCollector.CollectPlatform()...)
+
+		// Vulnerable items are marked in place; missing patches are
+		// reported as items of their own
+		if a.vulnerabilities != nil {
+			software = append(software, a.vulnerabilities.Match(software)...)
+		}
+		if len(software) > 0 {
+			if err := a.apiClient.SendInventory(software); err != nil {
 				log.Printf("Error sending software inventory: %v", err)
 			} else {
 				log.Printf("✓ Sent software inventory (%d items)", len(software))
@@ -409,19 +1139,46 @@ func (a *Agent) performFullInventoryScan() error {
 	}
 
 	// Collect services inventory
+	var services []*collector.InventoryItem
 	if a.config.Inventory.CollectServices {
-		services, err := a.inventoryCollector.CollectServices()
+		var err error
+		services, err = a.inventoryCollector.CollectServices()
 		if err != nil {
 			log.Printf("Error collecting services inventory: %v", err)
-		} else if len(services) > 0 {
-			if err := a.apiClient.SendServicesInventory(a.ctx, a.agentID, services); err != nil {
-				log.Printf("Error sending services inventory: %v", err)
-			} else {
-				log.Printf("✓ Sent services inventory (%d items)", len(services))
-			}
 		}
 	}
 
+	// Listening sockets and connections are sent with the services list
+	if a.config.Inventory.CollectNetwork {
+		connections, err := a.inventoryCollector.CollectConnections()
+		if err != nil {
+			log.Printf("Error collecting network inventory: %v", err)
+		} else {
+			services = append(services, connections...)
+		}
+	}
+
+	if len(services) > 0 {
+		if err := a.apiClient.SendInventory(services); err != nil {
+			log.Printf("Error sending services inventory: %v", err)
+		} else {
+			log.Printf("✓ Sent services inventory (%d items)", len(services))
+		}
+	}
+
+	// Refresh security posture
+	posture := &collector.SecurityPostureData{
+		AgentID:     a.agentID,
+		Hostname:    a.hostname,
+		Posture:     sysinfo.GetSecurityPosture(),
+		CollectedAt: time.Now(),
+	}
+	if err := a.apiClient.SendSecurityPosture(posture); err != nil {
+		log.Printf("Error sending security posture: %v", err)
+	} else {
+		log.Println("✓ Sent security posture")
+	}
+
 	a.mutex.Lock()
 	a.stats.LastInventory = time.Now()
 	a.mutex.Unlock()
@@ -433,5 +1190,16 @@ func (a *Agent) performFullInventoryScan() error {
 func (a *Agent) GetStats() Stats {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
-	return a.stats
+
+	stats := a.stats
+	stats.EventsCollected = a.eventQueue.Collected()
+	stats.QueueDepth = a.eventQueue.Len()
+	stats.QueueCapacity = a.config.SIEM.MaxQueueSize
+	stats.SpoolBytes = a.eventQueue.SpoolBytes()
+
+	compression := a.apiClient.CompressionStats()
+	stats.BytesRaw, stats.BytesSent, stats.CompressionRatio = compression.BytesRaw, compression.BytesSent, compression.Ratio
+	stats.EventsDropped, stats.DroppedByChannel = collector.DroppedEvents()
+	stats.EventsDuplicate = a.watermarks.Suppressed()
+	return stats
 }
@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// diagLogTail is how much of the end of each log file is packaged
+	diagLogTail = 10 * 1024 * 1024
+	// diagRecentErrors is how many error and warning lines errors.txt keeps
+	diagRecentErrors = 200
+)
+
+// DiagnosticsOptions describes what -diag packages
+type DiagnosticsOptions struct {
+	ConfigPath    string
+	Version       string
+	ServiceStatus string   // as reported by the service manager
+	LogFiles      []string // log files written outside the configuration, e.g. by the service unit
+}
+
+// diagStatus is status.json in the diagnostics bundle
+type diagStatus struct {
+	Version       string          `json:"version"`
+	Hostname      string          `json:"hostname"`
+	OS            string          `json:"os"`
+	Arch          string          `json:"arch"`
+	GoVersion     string          `json:"go_version"`
+	ServiceStatus string          `json:"service_status,omitempty"`
+	ConfigError   string          `json:"config_error,omitempty"`
+	SpoolBytes    int64           `json:"spool_bytes"`
+	SelfTest      *SelfTestReport `json:"self_test"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// WriteDiagnostics writes a zip for a support ticket to path: the
+// configuration with secrets redacted, status.json with the self-test
+// report, the end of each log file and the recent errors from them. An
+// invalid configuration is still packaged; that is often the problem.
+func WriteDiagnostics(path string, opts DiagnosticsOptions) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	hostname, _ := os.Hostname()
+	status := &diagStatus{
+		Version:       opts.Version,
+		Hostname:      hostname,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		GoVersion:     runtime.Version(),
+		ServiceStatus: opts.ServiceStatus,
+		SelfTest:      SelfTest(opts.ConfigPath),
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	logFiles := opts.LogFiles
+	cfg, err := config.Load(opts.ConfigPath)
+	if err != nil {
+		status.ConfigError = err.Error()
+	} else {
+		status.SpoolBytes = directorySize(cfg.Queue.SpoolDir)
+		if cfg.Logging.File != "" {
+			logFiles = append(logFiles, cfg.Logging.File)
+		}
+	}
+
+	if raw, err := os.ReadFile(opts.ConfigPath); err == nil {
+		redacted, err := redactConfig(raw)
+		if err != nil {
+			// Unparseable YAML may still hold secrets; leave it out
+			redacted = []byte(fmt.Sprintf("# config.yaml could not be parsed and was not included: %v\n", err))
+		}
+		if err := writeZipFile(archive, "config.yaml", redacted); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	if err := writeZipFile(archive, "status.json", data); err != nil {
+		return err
+	}
+
+	var recentErrors []string
+	for _, logFile := range expandLogFiles(logFiles) {
+		tail, err := readTail(logFile, diagLogTail)
+		if err != nil {
+			continue
+		}
+		if err := writeZipFile(archive, "logs/"+filepath.Base(logFile), tail); err != nil {
+			return err
+		}
+		recentErrors = append(recentErrors, errorLines(tail)...)
+	}
+	if len(recentErrors) > diagRecentErrors {
+		recentErrors = recentErrors[len(recentErrors)-diagRecentErrors:]
+	}
+	if err := writeZipFile(archive, "errors.txt", []byte(strings.Join(recentErrors, "\n")+"\n")); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// writeZipFile adds one file to the bundle
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	return nil
+}
+
+// redactConfig replaces the values of secret keys (passwords, tokens, API
+// and private keys) in a YAML document, keeping the layout and comments
+func redactConfig(raw []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	redactNode(&doc)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	encoder.Close()
+	return out.Bytes(), nil
+}
+
+// redactNode walks a YAML node and redacts the scalar values of secret keys
+func redactNode(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Value != "" && isSecretKey(key.Value) {
+				value.Value = "REDACTED"
+				value.Tag = "!!str"
+				value.Style = 0
+				continue
+			}
+			redactNode(value)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		redactNode(child)
+	}
+}
+
+// isSecretKey reports whether a configuration key holds a secret
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	if key == "api_key" || key == "private_key" {
+		return true
+	}
+	for _, word := range []string{"password", "passphrase", "token", "secret"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandLogFiles adds the rotated copies next to each log file
+// (siem-agent.log.1, siem-agent-2024-01-02.log, ...) and drops duplicates
+func expandLogFiles(files []string) []string {
+	seen := make(map[string]bool)
+	var expanded []string
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			expanded = append(expanded, file)
+		}
+	}
+	for _, file := range files {
+		add(file)
+		ext := filepath.Ext(file)
+		for _, pattern := range []string{file + ".*", strings.TrimSuffix(file, ext) + "-*" + ext} {
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				if !strings.HasSuffix(match, ".gz") {
+					add(match)
+				}
+			}
+		}
+	}
+	return expanded
+}
+
+// readTail reads at most limit bytes from the end of a file, starting at a
+// line boundary
+func readTail(path string, limit int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - limit
+	if offset <= 0 {
+		return io.ReadAll(file)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data, nil
+}
+
+// errorLines returns the log lines reporting errors or warnings
+func errorLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "error") || strings.Contains(lower, "failed") || strings.Contains(lower, "warning") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// directorySize returns the total size of the files under dir
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/siem/agent/internal/collector"
+	"github.com/siem/agent/internal/config"
+	"github.com/siem/agent/internal/sender"
+)
+
+// sysmonChannel is the channel Sysmon logs to
+const sysmonChannel = "Microsoft-Windows-Sysmon/Operational"
+
+// SelfTestCheck is the outcome of one self-test check
+type SelfTestCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"` // not applicable with this configuration or platform
+	Detail  string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is the outcome of a -selftest run
+type SelfTestReport struct {
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// SelfTest checks that the agent can run with the configuration at
+// configPath: the configuration is valid, the server is reachable, the
+// configured channels can be subscribed to, Sysmon is installed where it is
+// expected and the state and log directories are writable. It changes
+// nothing; an enrollment token is not used.
+func SelfTest(configPath string) *SelfTestReport {
+	report := &SelfTestReport{}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		report.fail("Configuration", err.Error())
+		return report
+	}
+	report.pass("Configuration", configPath)
+
+	if err := sender.NewAPIClient(cfg).Ping(); err != nil {
+		report.fail("API reachability", err.Error())
+	} else {
+		report.pass("API reachability", cfg.SIEM.APIURL)
+	}
+
+	report.checkCollection(cfg)
+	report.checkSysmon(cfg)
+
+	for _, dir := range stateDirectories(cfg) {
+		if err := checkWritable(dir); err != nil {
+			report.fail("Write access", err.Error())
+		} else {
+			report.pass("Write access", dir)
+		}
+	}
+
+	return report
+}
+
+// checkCollection tests the sources the configuration collects from
+func (r *SelfTestReport) checkCollection(cfg *config.Config) {
+	if cfg.EventLog.Enabled {
+		if runtime.GOOS != "windows" {
+			r.skip("Event Log", "Windows only")
+		}
+		for _, channel := range cfg.EventLog.Channels {
+			if !channel.Enabled || runtime.GOOS != "windows" {
+				continue
+			}
+			name := "Event Log channel " + channel.Name
+			if err := collector.CheckEventLogChannel(channel.Name); err != nil {
+				r.fail(name, err.Error())
+			} else {
+				r.pass(name, "subscribed")
+			}
+		}
+	}
+
+	if cfg.Journald.Enabled {
+		if path, err := exec.LookPath("journalctl"); err != nil {
+			r.fail("journald", "journalctl not found")
+		} else {
+			r.pass("journald", path)
+		}
+	}
+
+	if cfg.Auditd.Enabled && cfg.Auditd.Source == "socket" {
+		if _, err := os.Stat(cfg.Auditd.SocketPath); err != nil {
+			r.fail("auditd", err.Error())
+		} else {
+			r.pass("auditd", cfg.Auditd.SocketPath)
+		}
+	}
+}
+
+// checkSysmon checks that Sysmon is installed and its channel readable
+// when the configuration collects it
+func (r *SelfTestReport) checkSysmon(cfg *config.Config) {
+	if !cfg.Sysmon.Enabled {
+		r.skip("Sysmon", "not enabled")
+		return
+	}
+	if runtime.GOOS != "windows" {
+		r.skip("Sysmon", "Windows only")
+		return
+	}
+
+	service := collector.SysmonService()
+	if service == "" {
+		r.fail("Sysmon", "Sysmon service not installed")
+		return
+	}
+	if err := collector.CheckEventLogChannel(sysmonChannel); err != nil {
+		r.fail("Sysmon", fmt.Sprintf("%s installed, but %s: %v", service, sysmonChannel, err))
+		return
+	}
+	r.pass("Sysmon", service+" installed")
+}
+
+// stateDirectories returns the directories the agent writes to with this
+// configuration
+func stateDirectories(cfg *config.Config) []string {
+	files := []string{cfg.SIEM.CredentialFile}
+	if cfg.Logging.File != "" {
+		files = append(files, cfg.Logging.File)
+	}
+	if cfg.Journald.Enabled {
+		files = append(files, cfg.Journald.CursorFile)
+	}
+	if cfg.Detection.Enabled {
+		files = append(files, cfg.Detection.RulesFile)
+	}
+	if cfg.ThreatIntel.Enabled {
+		files = append(files, cfg.ThreatIntel.IOCFile)
+	}
+	if cfg.Vulnerabilities.Enabled {
+		files = append(files, cfg.Vulnerabilities.FeedFile)
+	}
+
+	seen := map[string]bool{cfg.Queue.SpoolDir: true}
+	for _, file := range files {
+		seen[filepath.Dir(file)] = true
+	}
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// checkWritable creates the directory if needed and a file in it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+	file, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
+
+// pass, fail and skip record a check
+func (r *SelfTestReport) pass(name, detail string) {
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Passed: true, Detail: detail})
+}
+
+func (r *SelfTestReport) fail(name, detail string) {
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Detail: detail})
+}
+
+func (r *SelfTestReport) skip(name, detail string) {
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Passed: true, Skipped: true, Detail: detail})
+}
+
+// Passed reports whether every check passed
+func (r *SelfTestReport) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes the report for the console
+func (r *SelfTestReport) Print(w io.Writer) {
+	failed := 0
+	for _, check := range r.Checks {
+		result := "PASS"
+		switch {
+		case check.Skipped:
+			result = "SKIP"
+		case !check.Passed:
+			result = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "  [%s] %-32s %s\n", result, check.Name, check.Detail)
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "Self-test failed: %d of %d checks\n", failed, len(r.Checks))
+	} else {
+		fmt.Fprintf(w, "Self-test passed: %d checks\n", len(r.Checks))
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Events at or above this severity (4 = error/high) skip the wait for the
+// send timer: the batch goes out as soon as SendIntervalMin allows
+const fastLaneSeverity = 4
+
+// sendInterval adapts the time between sends to the event rate. It halves
+// while batches fill up before the timer fires and doubles while they are
+// nearly empty, staying between SendIntervalMin and SendIntervalMax: idle
+// hosts wake up rarely and busy ones send with little latency.
+type sendInterval struct {
+	current time.Duration
+	minimum time.Duration
+	maximum time.Duration
+}
+
+// newSendInterval starts at SendInterval
+func newSendInterval(cfg *config.SIEMConfig) *sendInterval {
+	return &sendInterval{
+		current: time.Duration(cfg.SendInterval) * time.Second,
+		minimum: time.Duration(cfg.SendIntervalMin) * time.Second,
+		maximum: time.Duration(cfg.SendIntervalMax) * time.Second,
+	}
+}
+
+// full shortens the interval after a batch filled up before the timer
+func (s *sendInterval) full() time.Duration {
+	s.current = max(s.current/2, s.minimum)
+	return s.current
+}
+
+// elapsed adjusts the interval when the timer fires with sent events out
+// of a batch of batchSize
+func (s *sendInterval) elapsed(sent, batchSize int) time.Duration {
+	switch {
+	case sent*2 >= batchSize:
+		s.current = max(s.current/2, s.minimum)
+	case sent*10 < batchSize:
+		s.current = min(s.current*2, s.maximum)
+	}
+	return s.current
+}
+
+// failed lengthens the interval after a failed send, so an unreachable
+// server is retried less and less often
+func (s *sendInterval) failed() time.Duration {
+	s.current = min(s.current*2, s.maximum)
+	return s.current
+}
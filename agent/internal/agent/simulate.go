@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/collector"
+	"github.com/siem/agent/internal/config"
+)
+
+// Latency samples kept by the simulation sink; later events replace the
+// oldest samples
+const maxLatencySamples = 1 << 20
+
+// SimulationOptions configures a -simulate run
+type SimulationOptions struct {
+	EPS      int           // events generated per second
+	Duration time.Duration // how long events are generated
+	Mix      string        // event mix, see collector.ParseSimulationMix
+	Server   bool          // send to the configured server instead of a local sink
+}
+
+// SimulationReport is the outcome of a simulation run
+type SimulationReport struct {
+	Duration    time.Duration
+	Generated   uint64
+	Sent        uint64
+	Failed      uint64
+	Dropped     uint64
+	Requests    uint64 // received by the local sink
+	BytesRaw    uint64
+	BytesSent   uint64
+	AllocBytes  uint64 // allocated per generated event
+	Allocs      uint64 // allocations per generated event
+	PeakHeap    uint64
+	GCCycles    uint32
+	Latency     []time.Duration // p50, p95, p99 and max; empty when sending to the server
+	TargetEPS   int
+	AchievedEPS float64
+}
+
+// Simulate runs the send pipeline (queue, spool, batching, serialization,
+// compression and sending) on synthetic events for opts.Duration and
+// reports throughput, allocation and latency. Events go to an in-process
+// sink unless opts.Server is set; the spool is a temporary directory so
+// the installed agent's unsent events are not touched.
+func Simulate(cfg *config.Config, version string, opts SimulationOptions) (*SimulationReport, error) {
+	mix, err := collector.ParseSimulationMix(opts.Mix)
+	if err != nil {
+		return nil, err
+	}
+
+	spoolDir, err := os.MkdirTemp("", "siem-simulate-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create simulation spool: %w", err)
+	}
+	defer os.RemoveAll(spoolDir)
+	cfg.Queue.SpoolDir = spoolDir
+
+	var sink *simulationSink
+	if !opts.Server {
+		sink = &simulationSink{}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("failed to start simulation sink: %w", err)
+		}
+		server := &http.Server{Handler: sink}
+		go server.Serve(listener)
+		defer server.Close()
+		cfg.SIEM.APIURL = "http://" + listener.Addr().String()
+	}
+
+	a, err := New(cfg, version)
+	if err != nil {
+		return nil, err
+	}
+	a.agentID = "simulation"
+	a.breaker = collector.NewCollectionBreaker(a.agentID, a.hostname, a.eventQueue)
+
+	simulator, err := collector.NewEventSimulator(a.agentID, a.hostname, opts.EPS, mix, a.eventQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Simulating %d events/s for %s (sending to %s)", opts.EPS, opts.Duration, cfg.SIEM.APIURL)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	heap := newHeapSampler()
+	start := time.Now()
+	a.wg.Add(1)
+	go a.sendEvents()
+	simulator.Start()
+
+	time.Sleep(opts.Duration)
+	simulator.Stop()
+
+	// Let the sender drain the queue; the adaptive interval bounds the wait
+	drainDeadline := time.Now().Add(2*time.Duration(cfg.SIEM.SendIntervalMax)*time.Second + 10*time.Second)
+	for time.Now().Before(drainDeadline) {
+		stats := a.GetStats()
+		if stats.QueueDepth == 0 && stats.SpoolBytes == 0 && stats.EventsSent+stats.EventsFailed+stats.EventsDropped >= simulator.Generated() {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+
+	a.cancel()
+	a.wg.Wait()
+	a.eventQueue.Close()
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	stats := a.GetStats()
+	report := &SimulationReport{
+		Duration:    elapsed,
+		Generated:   simulator.Generated(),
+		Sent:        stats.EventsSent,
+		Failed:      stats.EventsFailed,
+		Dropped:     stats.EventsDropped,
+		BytesRaw:    stats.BytesRaw,
+		BytesSent:   stats.BytesSent,
+		PeakHeap:    heap.stop(),
+		GCCycles:    after.NumGC - before.NumGC,
+		TargetEPS:   opts.EPS,
+		AchievedEPS: float64(stats.EventsSent) / elapsed.Seconds(),
+	}
+	if report.Generated > 0 {
+		report.AllocBytes = (after.TotalAlloc - before.TotalAlloc) / report.Generated
+		report.Allocs = (after.Mallocs - before.Mallocs) / report.Generated
+	}
+	if sink != nil {
+		report.Requests, report.Latency = sink.results()
+	}
+	return report, nil
+}
+
+// Print writes the report for the console
+func (r *SimulationReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Simulation: %s, target %d events/s\n", r.Duration.Round(time.Millisecond), r.TargetEPS)
+	fmt.Fprintf(w, "  Events:      %d generated, %d sent, %d failed, %d dropped\n", r.Generated, r.Sent, r.Failed, r.Dropped)
+	fmt.Fprintf(w, "  Throughput:  %.0f events/s sent\n", r.AchievedEPS)
+	if r.Requests > 0 {
+		fmt.Fprintf(w, "  Requests:    %d (%.1f events per request)\n", r.Requests, float64(r.Sent)/float64(r.Requests))
+	}
+	if r.BytesSent > 0 {
+		fmt.Fprintf(w, "  Payload:     %d KB raw, %d KB sent (ratio %.2f)\n",
+			r.BytesRaw/1024, r.BytesSent/1024, float64(r.BytesRaw)/float64(r.BytesSent))
+	}
+	fmt.Fprintf(w, "  Allocation:  %d bytes and %d allocations per event, peak heap %d MB, %d GC cycles\n",
+		r.AllocBytes, r.Allocs, r.PeakHeap/(1024*1024), r.GCCycles)
+	if len(r.Latency) == 4 {
+		fmt.Fprintf(w, "  Latency:     p50 %s, p95 %s, p99 %s, max %s (collection to delivery)\n",
+			r.Latency[0].Round(time.Millisecond), r.Latency[1].Round(time.Millisecond),
+			r.Latency[2].Round(time.Millisecond), r.Latency[3].Round(time.Millisecond))
+	}
+}
+
+// simulationSink accepts event batches in place of the SIEM server and
+// measures the time from collection to delivery
+type simulationSink struct {
+	mutex     sync.Mutex
+	requests  uint64
+	latencies []time.Duration
+	seen      uint64
+}
+
+func (s *simulationSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	var events []struct {
+		CollectedAt time.Time `json:"collected_at"`
+	}
+	if err := json.NewDecoder(body).Decode(&events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.requests++
+	for _, event := range events {
+		if event.CollectedAt.IsZero() {
+			continue
+		}
+		s.seen++
+		latency := received.Sub(event.CollectedAt)
+		if len(s.latencies) < maxLatencySamples {
+			s.latencies = append(s.latencies, latency)
+		} else {
+			s.latencies[s.seen%maxLatencySamples] = latency
+		}
+	}
+	s.mutex.Unlock()
+
+	w.Header().Set("Accept-Encoding", "gzip")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"success":true}`))
+}
+
+// results returns the number of requests and the p50, p95, p99 and max
+// latency
+func (s *simulationSink) results() (uint64, []time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.latencies) == 0 {
+		return s.requests, nil
+	}
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	at := func(q float64) time.Duration {
+		return s.latencies[int(q*float64(len(s.latencies)-1))]
+	}
+	return s.requests, []time.Duration{at(0.50), at(0.95), at(0.99), s.latencies[len(s.latencies)-1]}
+}
+
+// heapSampler records the peak heap size while a simulation runs
+type heapSampler struct {
+	stopChan chan struct{}
+	done     chan uint64
+}
+
+func newHeapSampler() *heapSampler {
+	h := &heapSampler{stopChan: make(chan struct{}), done: make(chan uint64)}
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		var peak uint64
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapInuse)
+			select {
+			case <-h.stopChan:
+				h.done <- peak
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return h
+}
+
+// stop ends sampling and returns the peak heap in use
+func (h *heapSampler) stop() uint64 {
+	close(h.stopChan)
+	return <-h.done
+}
@@ -0,0 +1,173 @@
+// Package cache provides the bounded LRU caches shared by collectors and
+// enrichment: name and group resolution, file hashes and signatures. Every
+// cache counts hits, misses and evictions, reported in heartbeats, so an
+// undersized cache shows up as a low hit rate instead of CPU load.
+package cache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats describes a cache for heartbeats
+type Stats struct {
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// entry is a cached value with its expiry (zero = never)
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// LRU is a bounded cache that evicts the least recently used entry. With a
+// TTL entries also expire, for lookups whose answer changes over time.
+type LRU[K comparable, V any] struct {
+	name     string
+	capacity int
+	ttl      time.Duration
+
+	mutex     sync.Mutex
+	items     map[K]*list.Element
+	order     *list.List // front = most recently used
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// New creates a cache of up to capacity entries and registers it for
+// All. ttl 0 keeps entries until they are evicted.
+func New[K comparable, V any](name string, capacity int, ttl time.Duration) *LRU[K, V] {
+	c := &LRU[K, V]{
+		name:     name,
+		capacity: max(capacity, 1),
+		ttl:      ttl,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+	register(name, c)
+	return c
+}
+
+// Get returns the cached value for key
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*entry[K, V])
+		if item.expires.IsZero() || time.Now().Before(item.expires) {
+			c.order.MoveToFront(element)
+			c.hits++
+			return item.value, true
+		}
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+
+	c.misses++
+	var zero V
+	return zero, false
+}
+
+// Put caches a value, evicting the least recently used entry when full
+func (c *LRU[K, V]) Put(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*entry[K, V])
+		item.value, item.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+		c.evictions++
+	}
+}
+
+// GetOrLoad returns the cached value for key, or loads and caches it.
+// load runs without the lock held, so concurrent misses may load the same
+// key twice; errors are not cached.
+func (c *LRU[K, V]) GetOrLoad(key K, load func(K) (V, error)) (V, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	value, err := load(key)
+	if err != nil {
+		return value, err
+	}
+	c.Put(key, value)
+	return value, nil
+}
+
+// Remove drops key from the cache
+func (c *LRU[K, V]) Remove(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+// Stats returns the size and hit counts of the cache
+func (c *LRU[K, V]) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return Stats{
+		Name:      c.name,
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// Registered caches by name; a cache created again under the same name
+// replaces the earlier one
+var registry = struct {
+	sync.Mutex
+	caches map[string]interface{ Stats() Stats }
+}{caches: make(map[string]interface{ Stats() Stats })}
+
+func register(name string, c interface{ Stats() Stats }) {
+	registry.Lock()
+	registry.caches[name] = c
+	registry.Unlock()
+}
+
+// All returns the stats of every cache, by name
+func All() []Stats {
+	registry.Lock()
+	defer registry.Unlock()
+
+	stats := make([]Stats, 0, len(registry.caches))
+	for _, c := range registry.caches {
+		stats = append(stats, c.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
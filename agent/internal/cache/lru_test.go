@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		ops      []string // "+key" puts, "?key" gets
+		want     []string // keys still cached
+		gone     []string // keys evicted
+	}{
+		{
+			name:     "under capacity",
+			capacity: 3,
+			ops:      []string{"+a", "+b"},
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "oldest evicted",
+			capacity: 2,
+			ops:      []string{"+a", "+b", "+c"},
+			want:     []string{"b", "c"},
+			gone:     []string{"a"},
+		},
+		{
+			name:     "read keeps entry",
+			capacity: 2,
+			ops:      []string{"+a", "+b", "?a", "+c"},
+			want:     []string{"a", "c"},
+			gone:     []string{"b"},
+		},
+		{
+			name:     "put again keeps entry",
+			capacity: 2,
+			ops:      []string{"+a", "+b", "+a", "+c"},
+			want:     []string{"a", "c"},
+			gone:     []string{"b"},
+		},
+		{
+			name:     "capacity at least one",
+			capacity: 0,
+			ops:      []string{"+a", "+b"},
+			want:     []string{"b"},
+			gone:     []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int]("test_"+tt.name, tt.capacity, 0)
+			for i, op := range tt.ops {
+				if op[0] == '+' {
+					c.Put(op[1:], i)
+				} else {
+					c.Get(op[1:])
+				}
+			}
+
+			for _, key := range tt.gone {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("Get(%q) still cached", key)
+				}
+			}
+			for _, key := range tt.want {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%q) missing", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	c := New[string, int]("test_ttl", 4, 20*time.Millisecond)
+	c.Put("a", 1)
+	if value, ok := c.Get("a"); !ok || value != 1 {
+		t.Fatalf("Get before expiry = %d, %v", value, ok)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get after expiry still cached")
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("Size after expiry = %d, want 0", size)
+	}
+}
+
+func TestLRUGetOrLoad(t *testing.T) {
+	c := New[string, int]("test_load", 4, 0)
+	loads := 0
+	load := func(key string) (int, error) {
+		loads++
+		if key == "bad" {
+			return 0, errors.New("failed")
+		}
+		return len(key), nil
+	}
+
+	tests := []struct {
+		key       string
+		want      int
+		wantErr   bool
+		wantLoads int
+	}{
+		{key: "abc", want: 3, wantLoads: 1},
+		{key: "abc", want: 3, wantLoads: 1}, // cached
+		{key: "bad", wantErr: true, wantLoads: 2},
+		{key: "bad", wantErr: true, wantLoads: 3}, // errors are not cached
+	}
+	for i, tt := range tests {
+		value, err := c.GetOrLoad(tt.key, load)
+		if (err != nil) != tt.wantErr || value != tt.want || loads != tt.wantLoads {
+			t.Errorf("%d: GetOrLoad(%q) = %d, %v with %d loads; want %d, error %v with %d loads",
+				i, tt.key, value, err, loads, tt.want, tt.wantErr, tt.wantLoads)
+		}
+	}
+}
+
+func TestLRUStats(t *testing.T) {
+	c := New[string, int]("test_stats", 1, 0)
+	c.Put("a", 1)
+	c.Get("a")
+	c.Get("b")
+	c.Put("b", 2)
+
+	want := Stats{Name: "test_stats", Size: 1, Capacity: 1, Hits: 1, Misses: 1, Evictions: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	found := false
+	for _, stats := range All() {
+		found = found || stats.Name == "test_stats"
+	}
+	if !found {
+		t.Error("All() does not list the cache")
+	}
+}
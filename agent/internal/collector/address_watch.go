@@ -0,0 +1,56 @@
+//go:build windows
+
+package collector
+
+import (
+	"log"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	iphlpapi                 = windows.NewLazySystemDLL("iphlpapi.dll")
+	procNotifyAddrChange     = iphlpapi.NewProc("NotifyAddrChange")
+	procCancelIPChangeNotify = iphlpapi.NewProc("CancelIPChangeNotify")
+)
+
+// watchAddresses signals changes whenever an IPv4 address is added or
+// removed. NotifyAddrChange is used in overlapped mode so it can be
+// cancelled on stop.
+func (m *SystemInfoMonitor) watchAddresses(changes chan<- struct{}) {
+	defer m.wg.Done()
+
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		log.Printf("Warning: network change notifications unavailable: %v", err)
+		return
+	}
+	defer windows.CloseHandle(event)
+
+	for {
+		overlapped := windows.Overlapped{HEvent: event}
+		var handle windows.Handle
+		ret, _, _ := procNotifyAddrChange.Call(uintptr(unsafe.Pointer(&handle)), uintptr(unsafe.Pointer(&overlapped)))
+		if windows.Errno(ret) != windows.ERROR_IO_PENDING {
+			log.Printf("Warning: network change notifications unavailable: %v", windows.Errno(ret))
+			return
+		}
+
+		for {
+			if m.ctx.Err() != nil {
+				procCancelIPChangeNotify.Call(uintptr(unsafe.Pointer(&overlapped)))
+				return
+			}
+			status, _ := windows.WaitForSingleObject(event, 1000)
+			if status == windows.WAIT_OBJECT_0 {
+				break
+			}
+		}
+
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
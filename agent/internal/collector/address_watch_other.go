@@ -0,0 +1,10 @@
+//go:build !windows
+
+package collector
+
+// watchAddresses has no change notification outside Windows; address
+// changes are picked up by the interval refresh
+func (m *SystemInfoMonitor) watchAddresses(changes chan<- struct{}) {
+	defer m.wg.Done()
+	<-m.ctx.Done()
+}
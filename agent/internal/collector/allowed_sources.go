@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// parseAllowedSources parses a list of IP addresses and CIDRs that network
+// listeners accept messages from
+func parseAllowedSources(sources []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, source := range sources {
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+				source += "/32"
+			} else {
+				source += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed source %q: %w", source, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// sourceAllowed reports whether an address is in the allowed networks; an
+// empty list allows any address
+func sourceAllowed(networks []*net.IPNet, ip net.IP) bool {
+	if len(networks) == 0 {
+		return true
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,19 +7,27 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"siem-agent/internal/config"
+	"github.com/siem/agent/internal/config"
 )
 
 // AppStoreClient handles client-side app store operations
 type AppStoreClient struct {
-	config     *config.Config
-	httpClient *http.Client
+	config         *config.Config
+	agentID        string
+	httpClient     *http.Client
+	downloadClient *http.Client // no overall timeout, for multi-GB installers
+	peers          *PeerCache   // nil unless app_store.peer_cache is enabled
+	offline        atomic.Bool  // catalog served from the cache
 }
 
 // StoreApp represents an app from the store
@@ -39,6 +47,8 @@ type StoreApp struct {
 	CanInstall     bool   `json:"can_install"`
 	RequestStatus  string `json:"request_status"`
 	RequestID      int    `json:"request_id"`
+	IconPath       string `json:"icon_path,omitempty"` // cached copy of the icon
+	Cached         bool   `json:"cached,omitempty"`    // from the offline catalog; requests are disabled
 }
 
 // InstallRequest represents a request to install an app
@@ -64,35 +74,59 @@ type InstallRequestResponse struct {
 
 // InstallInfo contains information needed to install an app
 type InstallInfo struct {
-	InstallerType     string `json:"installer_type"`
-	InstallerURL      string `json:"installer_url"`
-	InstallerPath     string `json:"installer_path"`
-	SilentInstallArgs string `json:"silent_install_args"`
+	InstallerType     string          `json:"installer_type"`
+	InstallerURL      string          `json:"installer_url"`
+	InstallerPath     string          `json:"installer_path"`
+	SilentInstallArgs string          `json:"silent_install_args"`
+	SHA256            string          `json:"sha256"`                  // required; checked before the installer runs
+	Size              int64           `json:"size,omitempty"`          // installer bytes; LAN peers sending more are cut off
+	Publisher         string          `json:"publisher,omitempty"`     // expected Authenticode signer
+	Detection         []DetectionRule `json:"detection,omitempty"`     // all must pass after a successful install
+	Prerequisites     []Prerequisite  `json:"prerequisites,omitempty"` // installed in order before the app
 }
 
-// NewAppStoreClient creates a new app store client
-func NewAppStoreClient(cfg *config.Config) *AppStoreClient {
+// NewAppStoreClient creates a new app store client; requests for the SIEM
+// server are authenticated through transport
+func NewAppStoreClient(cfg *config.Config, agentID string, transport ServerTransport) *AppStoreClient {
 	return &AppStoreClient{
-		config: cfg,
+		config:  cfg,
+		agentID: agentID,
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
+			Timeout:   60 * time.Second,
+			Transport: transport(nil),
+		},
+		downloadClient: &http.Client{
+			Transport: transport(&http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 60 * time.Second,
+			}),
 		},
 	}
 }
 
-// GetApps retrieves available apps from the store
-func (c *AppStoreClient) GetApps(category string) ([]StoreApp, error) {
-	url := fmt.Sprintf("%s/ad/appstore/apps/client?agent_id=%s", c.config.ServerURL, c.config.AgentID)
+// SetPeerCache lets installs use and populate the LAN peer cache
+func (c *AppStoreClient) SetPeerCache(peers *PeerCache) {
+	c.peers = peers
+}
+
+// fetchApps retrieves available apps from the store
+func (c *AppStoreClient) fetchApps(category string) ([]StoreApp, error) {
+	query := url.Values{"agent_id": {c.agentID}}
 	if category != "" {
-		url += "&category=" + category
+		query.Set("category", category)
 	}
+	endpoint := fmt.Sprintf("%s/ad/appstore/apps/client?%s", c.config.SIEM.APIURL, query.Encode())
 
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.httpClient.Get(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch apps: %v", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch apps: status %d", resp.StatusCode)
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %v", err)
@@ -108,13 +142,13 @@ func (c *AppStoreClient) GetApps(category string) ([]StoreApp, error) {
 
 // RequestInstall creates a request to install an app
 func (c *AppStoreClient) RequestInstall(appID int, userName, displayName, department, reason string) (*InstallRequestResponse, error) {
-	url := fmt.Sprintf("%s/ad/appstore/requests", c.config.ServerURL)
+	url := fmt.Sprintf("%s/ad/appstore/requests", c.config.SIEM.APIURL)
 
 	hostname, _ := os.Hostname()
 
 	request := InstallRequest{
 		AppID:           appID,
-		AgentID:         c.config.AgentID,
+		AgentID:         c.agentID,
 		ComputerName:    hostname,
 		UserName:        userName,
 		UserDisplayName: displayName,
@@ -148,7 +182,7 @@ func (c *AppStoreClient) RequestInstall(appID int, userName, displayName, depart
 
 // CheckRequestStatus checks the status of an install request
 func (c *AppStoreClient) CheckRequestStatus(requestID int) (*InstallRequestResponse, error) {
-	url := fmt.Sprintf("%s/ad/appstore/requests/%d/status", c.config.ServerURL, requestID)
+	url := fmt.Sprintf("%s/ad/appstore/requests/%d/status", c.config.SIEM.APIURL, requestID)
 
 	resp, err := c.httpClient.Get(url)
 	if err != nil {
@@ -169,40 +203,101 @@ func (c *AppStoreClient) CheckRequestStatus(requestID int) (*InstallRequestRespo
 	return &response, nil
 }
 
-// InstallApp downloads and installs an app
+// installOutcome is the result of running one installer
+type installOutcome struct {
+	exitCode   int
+	output     string
+	installLog string // tail of the MSI log for failed installations
+}
+
+// InstallApp installs an app's prerequisites, then downloads and installs
+// the app itself and reports the result
 func (c *AppStoreClient) InstallApp(requestID int, installInfo *InstallInfo) error {
+	if err := c.installPrerequisites(requestID, installInfo.Prerequisites); err != nil {
+		return err
+	}
+
+	outcome, err := c.runInstaller(requestID, "", installInfo)
+	if err != nil {
+		return err
+	}
+
+	// Report installation result
+	c.reportInstallation(requestID, outcome.exitCode, outcome.output, outcome.installLog)
+
+	if outcome.exitCode != 0 {
+		return fmt.Errorf("installation failed with exit code %d: %s", outcome.exitCode, outcome.output)
+	}
+
+	return nil
+}
+
+// runInstaller downloads, verifies and runs one installer. step tells the
+// temporary files of prerequisites apart. An error means the installer
+// could not be run at all.
+func (c *AppStoreClient) runInstaller(requestID int, step string, installInfo *InstallInfo) (*installOutcome, error) {
 	// Determine installer source
 	var installerPath string
 	var cleanup bool
 
 	if installInfo.InstallerPath != "" {
-		// Use UNC path directly
-		installerPath = installInfo.InstallerPath
-		cleanup = false
+		// Copy from the UNC path so the verified file is the one executed
+		installerPath = filepath.Join(os.TempDir(), fmt.Sprintf("siem_app_%d%s%s", requestID, step, filepath.Ext(installInfo.InstallerPath)))
+		cleanup = true
+
+		if err := copyFile(installInfo.InstallerPath, installerPath); err != nil {
+			return nil, fmt.Errorf("failed to copy installer: %v", err)
+		}
 	} else if installInfo.InstallerURL != "" {
 		// Download from URL
 		tempDir := os.TempDir()
-		installerPath = filepath.Join(tempDir, fmt.Sprintf("siem_app_%d.%s", requestID, installInfo.InstallerType))
+		installerPath = filepath.Join(tempDir, fmt.Sprintf("siem_app_%d%s.%s", requestID, step, installInfo.InstallerType))
 		cleanup = true
 
-		if err := c.downloadFile(installInfo.InstallerURL, installerPath); err != nil {
-			return fmt.Errorf("failed to download installer: %v", err)
+		// Prefer a copy cached on this machine or a LAN peer over the WAN
+		if err := c.fetchFromPeers(installInfo.SHA256, installerPath, installInfo.Size); err != nil {
+			if err := c.downloadFile(requestID, installInfo.InstallerURL, installerPath); err != nil {
+				return nil, fmt.Errorf("failed to download installer: %v", err)
+			}
 		}
 	} else {
-		return fmt.Errorf("no installer source specified")
+		return nil, fmt.Errorf("no installer source specified")
 	}
 
 	if cleanup {
 		defer os.Remove(installerPath)
 	}
 
+	// Refuse installers that do not match what the server approved
+	if err := verifyInstaller(installerPath, installInfo); err != nil {
+		return &installOutcome{
+			exitCode: installerVerifyExitCode,
+			output:   fmt.Sprintf("Installer verification failed: %v", err),
+		}, nil
+	}
+
+	// Share the verified installer with peers
+	if c.peers != nil {
+		if err := c.peers.Add(strings.ToLower(installInfo.SHA256), installerPath); err != nil {
+			log.Printf("Warning: Failed to add installer to peer cache: %v", err)
+		}
+	}
+
+	// Installers extract into a private temp directory removed afterwards
+	workDir, err := installWorkDir(fmt.Sprintf("%d%s", requestID, step))
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+	logPath := filepath.Join(workDir, "install.log")
+
 	// Execute installer
 	var cmd *exec.Cmd
 	args := installInfo.SilentInstallArgs
 
 	switch installInfo.InstallerType {
 	case "msi":
-		cmdArgs := []string{"/i", installerPath, "/qn", "/norestart"}
+		cmdArgs := []string{"/i", installerPath, "/qn", "/norestart", "/l*v", logPath}
 		if args != "" {
 			cmdArgs = append(cmdArgs, args)
 		}
@@ -222,20 +317,21 @@ func (c *AppStoreClient) InstallApp(requestID int, installInfo *InstallInfo) err
 		cmd = exec.Command("powershell", "-ExecutionPolicy", "Bypass", "-File", installerPath)
 
 	default:
-		return fmt.Errorf("unsupported installer type: %s", installInfo.InstallerType)
+		return nil, fmt.Errorf("unsupported installer type: %s", installInfo.InstallerType)
 	}
 
 	// Set up output capture
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "TEMP="+workDir, "TMP="+workDir)
 
 	// Execute with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start installer: %v", err)
+		return nil, fmt.Errorf("failed to start installer: %v", err)
 	}
 
 	done := make(chan error)
@@ -265,52 +361,87 @@ func (c *AppStoreClient) InstallApp(requestID int, installInfo *InstallInfo) err
 		}
 	}
 
-	// Report installation result
-	c.reportInstallation(requestID, exitCode, output)
+	// Many installers return 0 without installing; confirm with the
+	// catalog's detection rules before the request is marked installed
+	if (exitCode == 0 || exitCode == msiSuccessRebootRequired) && len(installInfo.Detection) > 0 {
+		if err := waitForDetection(installInfo.Detection, detectionTimeout); err != nil {
+			output += fmt.Sprintf("\nInstaller exited with code %d but the app was not detected: %v", exitCode, err)
+			exitCode = installDetectionExitCode
+		}
+	}
 
-	if exitCode != 0 {
-		return fmt.Errorf("installation failed with exit code %d: %s", exitCode, output)
+	// Clean up after a failure and attach the installer log so it can be
+	// diagnosed without logging on to the machine
+	var installLog string
+	if exitCode != 0 && exitCode != msiSuccessRebootRequired && installInfo.InstallerType == "msi" {
+		if exitCode == -2 {
+			output += "\n" + rollbackMSI(installerPath, workDir)
+		}
+		installLog = readLogTail(logPath, installLogTail)
 	}
 
-	return nil
+	return &installOutcome{exitCode: exitCode, output: output, installLog: installLog}, nil
 }
 
-// downloadFile downloads a file from URL to local path
-func (c *AppStoreClient) downloadFile(url, destPath string) error {
-	resp, err := c.httpClient.Get(url)
+// InstallRequired requests an app on behalf of the agent and installs it as
+// soon as the request is approved
+func (c *AppStoreClient) InstallRequired(ctx context.Context, appID int, reason string) error {
+	response, err := c.RequestInstall(appID, "SYSTEM", "SIEM Agent", "", reason)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	if response.CanInstall && response.InstallInfo != nil {
+		return c.InstallApp(response.RequestID, response.InstallInfo)
 	}
 
+	return c.PollForApproval(ctx, response.RequestID, func(info *InstallInfo) error {
+		return c.InstallApp(response.RequestID, info)
+	})
+}
+
+// copyFile copies a file to a new local path
+func copyFile(src, destPath string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
 	out, err := os.Create(destPath)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	_, err = io.Copy(out, in)
 	return err
 }
 
-// reportInstallation reports the installation result to the server
-func (c *AppStoreClient) reportInstallation(requestID int, exitCode int, output string) {
-	url := fmt.Sprintf("%s/ad/appstore/requests/%d/installed?exit_code=%d",
-		c.config.ServerURL, requestID, exitCode)
+// reportInstallation reports the installation result to the server,
+// with the tail of the installer log for failed installations
+func (c *AppStoreClient) reportInstallation(requestID int, exitCode int, output, installLog string) {
+	url := fmt.Sprintf("%s/ad/appstore/requests/%d/installed", c.config.SIEM.APIURL, requestID)
 
-	if output != "" {
-		// Truncate output if too long
-		if len(output) > 5000 {
-			output = output[:5000] + "... (truncated)"
-		}
-		url += "&output=" + encodeURIComponent(output)
+	// Truncate output if too long
+	if len(output) > 5000 {
+		output = output[:5000] + "... (truncated)"
+	}
+
+	result := map[string]interface{}{
+		"exit_code": exitCode,
+		"output":    output,
+	}
+	if installLog != "" {
+		result["install_log"] = installLog
 	}
 
-	resp, err := c.httpClient.Post(url, "application/json", nil)
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return
 	}
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Largest icon kept in the offline catalog
+const maxCachedIconSize = 1024 * 1024
+
+// cachedCatalog is the last catalog fetched for a category
+type cachedCatalog struct {
+	FetchedAt time.Time  `json:"fetched_at"`
+	Apps      []StoreApp `json:"apps"`
+}
+
+// GetApps retrieves available apps from the store. Each fetched catalog is
+// saved with its icons; while the server is unreachable the saved catalog
+// is returned for up to app_store.catalog_cache_ttl, with every entry
+// marked Cached and CanInstall cleared so no new requests are made.
+func (c *AppStoreClient) GetApps(category string) ([]StoreApp, error) {
+	apps, err := c.fetchApps(category)
+	if err == nil {
+		c.offline.Store(false)
+		c.saveCatalog(category, apps)
+		c.attachIcons(apps)
+		return apps, nil
+	}
+
+	cached, cacheErr := c.loadCatalog(category)
+	if cacheErr != nil {
+		return nil, err
+	}
+
+	log.Printf("App store unreachable (%v), using catalog cached at %s", err, cached.FetchedAt.Format(time.RFC3339))
+	c.offline.Store(true)
+	for i := range cached.Apps {
+		cached.Apps[i].Cached = true
+		cached.Apps[i].CanInstall = false
+	}
+	c.attachIcons(cached.Apps)
+	return cached.Apps, nil
+}
+
+// Offline reports whether the last GetApps call was served from the cache
+func (c *AppStoreClient) Offline() bool {
+	return c.offline.Load()
+}
+
+// catalogPath returns the cache file for a category
+func (c *AppStoreClient) catalogPath(category string) string {
+	name := "all"
+	if category != "" {
+		sum := sha256.Sum256([]byte(category))
+		name = hex.EncodeToString(sum[:8])
+	}
+	return filepath.Join(c.config.AppStore.CatalogCacheDir, "catalog_"+name+".json")
+}
+
+// saveCatalog writes a fetched catalog and caches its icons in the background
+func (c *AppStoreClient) saveCatalog(category string, apps []StoreApp) {
+	if err := os.MkdirAll(c.config.AppStore.CatalogCacheDir, 0700); err != nil {
+		log.Printf("Warning: Failed to create catalog cache: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(cachedCatalog{FetchedAt: time.Now(), Apps: apps})
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.catalogPath(category), data, 0600); err != nil {
+		log.Printf("Warning: Failed to save catalog cache: %v", err)
+		return
+	}
+
+	go c.cacheIcons(apps)
+}
+
+// loadCatalog reads a cached catalog that is still within its TTL
+func (c *AppStoreClient) loadCatalog(category string) (*cachedCatalog, error) {
+	data, err := os.ReadFile(c.catalogPath(category))
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedCatalog
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(c.config.AppStore.CatalogCacheTTL) * time.Second
+	if time.Since(cached.FetchedAt) > ttl {
+		return nil, fmt.Errorf("cached catalog expired")
+	}
+	return &cached, nil
+}
+
+// iconPath returns the cache file for an icon URL
+func (c *AppStoreClient) iconPath(iconURL string) string {
+	sum := sha256.Sum256([]byte(iconURL))
+	ext := strings.ToLower(path.Ext(strings.SplitN(iconURL, "?", 2)[0]))
+	switch ext {
+	case ".png", ".ico", ".jpg", ".jpeg", ".svg", ".gif":
+	default:
+		ext = ""
+	}
+	return filepath.Join(c.config.AppStore.CatalogCacheDir, "icons", hex.EncodeToString(sum[:16])+ext)
+}
+
+// attachIcons sets IconPath for apps whose icon is cached
+func (c *AppStoreClient) attachIcons(apps []StoreApp) {
+	for i := range apps {
+		if apps[i].IconURL == "" {
+			continue
+		}
+		iconPath := c.iconPath(apps[i].IconURL)
+		if _, err := os.Stat(iconPath); err == nil {
+			apps[i].IconPath = iconPath
+		}
+	}
+}
+
+// cacheIcons downloads icons that are not cached yet
+func (c *AppStoreClient) cacheIcons(apps []StoreApp) {
+	dir := filepath.Join(c.config.AppStore.CatalogCacheDir, "icons")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	for _, app := range apps {
+		if app.IconURL == "" {
+			continue
+		}
+		iconPath := c.iconPath(app.IconURL)
+		if _, err := os.Stat(iconPath); err == nil {
+			continue
+		}
+		if err := c.downloadIcon(app.IconURL, iconPath); err != nil {
+			log.Printf("Warning: Failed to cache icon of %s: %v", app.Name, err)
+		}
+	}
+}
+
+// downloadIcon saves one icon, refusing oversized responses
+func (c *AppStoreClient) downloadIcon(iconURL, destPath string) error {
+	if !strings.HasPrefix(iconURL, "http://") && !strings.HasPrefix(iconURL, "https://") {
+		iconURL = c.config.SIEM.APIURL + "/" + strings.TrimPrefix(iconURL, "/")
+	}
+
+	resp, err := c.httpClient.Get(iconURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedIconSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxCachedIconSize {
+		return fmt.Errorf("icon larger than %d bytes", maxCachedIconSize)
+	}
+
+	tmp := destPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, destPath)
+}
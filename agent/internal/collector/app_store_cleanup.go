@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Size of the installer log tail attached to failure reports
+const installLogTail = 64 * 1024
+
+// Windows Installer exit codes
+const (
+	msiSuccessRebootRequired = 3010 // completes after a reboot
+	msiUnknownProduct        = 1605 // not installed
+)
+
+// installWorkDir creates a private temp directory for one installation.
+// Installers get it as TEMP/TMP, so whatever they extract is removed with
+// it instead of accumulating in the system temp directory.
+func installWorkDir(name string) (string, error) {
+	dir := filepath.Join(os.TempDir(), "siem_install_"+name)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create install directory: %v", err)
+	}
+	return dir, nil
+}
+
+// readLogTail returns the end of an installer log. Windows Installer may
+// write UTF-16 logs, which are converted.
+func readLogTail(path string, max int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	bom := make([]byte, 2)
+	isUTF16 := false
+	if n, _ := f.Read(bom); n == 2 && bom[0] == 0xFF && bom[1] == 0xFE {
+		isUTF16 = true
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() > max {
+		offset := info.Size() - max
+		if isUTF16 {
+			offset &^= 1 // stay on a code unit boundary
+		}
+		f.Seek(offset, io.SeekStart)
+	} else {
+		f.Seek(0, io.SeekStart)
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return ""
+	}
+	if !isUTF16 {
+		return string(data)
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+	}
+	return strings.TrimPrefix(string(utf16.Decode(units)), "\ufeff")
+}
+
+// rollbackMSI removes whatever an interrupted MSI installation left behind.
+// Windows Installer rolls back failed installations itself, but not ones
+// whose msiexec was killed on timeout. Returns a line for the report.
+func rollbackMSI(installerPath, workDir string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	logPath := filepath.Join(workDir, "rollback.log")
+	cmd := exec.CommandContext(ctx, "msiexec", "/x", installerPath, "/qn", "/norestart", "/l*v", logPath)
+	err := cmd.Run()
+
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else {
+			return fmt.Sprintf("Rollback failed: %v", err)
+		}
+	}
+
+	switch exitCode {
+	case 0, msiSuccessRebootRequired:
+		return "Partial installation removed"
+	case msiUnknownProduct:
+		return "Nothing to roll back: product is not installed"
+	default:
+		return fmt.Sprintf("Rollback exited with code %d", exitCode)
+	}
+}
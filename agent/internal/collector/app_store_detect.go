@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exit code reported when an installer succeeded but the app is not detected
+const installDetectionExitCode = -4
+
+// How long detection rules are retried after the installer exits, for
+// installers that finish in a child process
+const detectionTimeout = 2 * time.Minute
+
+// Detection rule types
+const (
+	DetectRegistry = "registry" // Uninstall key DisplayName, exact or followed by a space
+	DetectFile     = "file"     // path of a file the app installs
+	DetectService  = "service"  // Windows service name
+)
+
+// DetectionRule is a catalog-defined check that an app is installed
+type DetectionRule struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	MinVersion string `json:"min_version,omitempty"` // registry rules: DisplayVersion must be at least this
+}
+
+// waitForDetection retries the detection rules until all pass or the
+// timeout expires, returning the first failing rule's error
+func waitForDetection(rules []DetectionRule, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := detectInstalled(rules)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// detectInstalled checks that every rule passes
+func detectInstalled(rules []DetectionRule) error {
+	for _, rule := range rules {
+		if err := detectRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detectRule checks one detection rule
+func detectRule(rule DetectionRule) error {
+	switch rule.Type {
+	case DetectFile:
+		path := os.ExpandEnv(rule.Value)
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("file %s not found", path)
+		}
+		return nil
+
+	case DetectRegistry:
+		version, found := installedVersion(rule.Value)
+		if !found {
+			return fmt.Errorf("%s not found in installed programs", rule.Value)
+		}
+		if rule.MinVersion != "" && compareVersions(version, rule.MinVersion) < 0 {
+			return fmt.Errorf("%s version %s is older than %s", rule.Value, version, rule.MinVersion)
+		}
+		return nil
+
+	case DetectService:
+		if !serviceExists(rule.Value) {
+			return fmt.Errorf("service %s not found", rule.Value)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown detection rule type %q", strings.TrimSpace(rule.Type))
+	}
+}
@@ -0,0 +1,297 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Download retry budget and progress reporting interval
+const (
+	downloadMaxAttempts      = 8
+	downloadRetryDelay       = 5 * time.Second
+	downloadMaxRetryDelay    = 2 * time.Minute
+	downloadProgressInterval = 10 * time.Second
+	downloadIdleTimeout      = 2 * time.Minute // abort an attempt that stops receiving data
+)
+
+// DownloadProgress is posted to the request status endpoint while an
+// installer downloads
+type DownloadProgress struct {
+	Status          string `json:"status"` // always "downloading"
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	TotalBytes      int64  `json:"total_bytes"` // 0 if the server sent no length
+	Percent         int    `json:"percent"`
+	Attempt         int    `json:"attempt"`
+}
+
+// downloadFile downloads a file from URL to local path. Data goes to a
+// .part file that survives failed attempts, and each retry resumes it with
+// an HTTP range request; servers without range support restart from zero.
+// Progress is reported to the install request every few seconds. The
+// download is throttled to app_store.download_rate_limit and only runs
+// inside app_store.download_window; when the window closes it pauses and
+// resumes in the next one without using up the retry budget.
+func (c *AppStoreClient) downloadFile(requestID int, url, destPath string) error {
+	partPath := destPath + ".part"
+	var validator string // ETag or Last-Modified, so a changed file is not resumed
+	var lastErr error
+
+	delay := downloadRetryDelay
+	for attempt := 1; attempt <= downloadMaxAttempts; {
+		if err := c.waitForDownloadWindow(); err != nil {
+			return err
+		}
+
+		var final bool
+		final, validator, lastErr = c.downloadAttempt(requestID, attempt, url, partPath, validator)
+		if lastErr == nil {
+			return os.Rename(partPath, destPath)
+		}
+		if errors.Is(lastErr, errDownloadWindowClosed) {
+			log.Printf("Download of %s paused until the next download window", url)
+			continue
+		}
+		if final {
+			// Not worth retrying (e.g. 404)
+			break
+		}
+
+		if attempt++; attempt <= downloadMaxAttempts {
+			log.Printf("Download of %s failed (attempt %d/%d): %v; retrying in %s",
+				url, attempt-1, downloadMaxAttempts, lastErr, delay)
+			time.Sleep(delay)
+			delay *= 2
+			if delay > downloadMaxRetryDelay {
+				delay = downloadMaxRetryDelay
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// waitForDownloadWindow blocks until the configured download window opens
+func (c *AppStoreClient) waitForDownloadWindow() error {
+	logged := false
+	for {
+		inWindow, err := inTimeWindow(c.config.AppStore.DownloadWindow, time.Now())
+		if err != nil {
+			return err
+		}
+		if inWindow {
+			return nil
+		}
+		if !logged {
+			log.Printf("Waiting for download window %s", c.config.AppStore.DownloadWindow)
+			logged = true
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// downloadAttempt continues the download into partPath. final reports
+// errors a retry cannot fix.
+func (c *AppStoreClient) downloadAttempt(requestID, attempt int, url, partPath, validator string) (final bool, newValidator string, err error) {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := time.AfterFunc(downloadIdleTimeout, cancel)
+	defer idle.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return true, validator, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := c.downloadClient.Do(req)
+	if err != nil {
+		return false, validator, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Full content: the server ignored the range or the file changed
+		flags |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file is complete or longer than the file; start over
+		os.Remove(partPath)
+		return false, "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	default:
+		final = resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests
+		return final, validator, fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+
+	newValidator = resp.Header.Get("ETag")
+	if newValidator == "" || strings.HasPrefix(newValidator, "W/") {
+		newValidator = resp.Header.Get("Last-Modified")
+	}
+
+	total := int64(0)
+	if resp.StatusCode == http.StatusPartialContent {
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	} else if resp.ContentLength > 0 {
+		total = resp.ContentLength
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0600)
+	if err != nil {
+		return true, newValidator, err
+	}
+	defer out.Close()
+
+	progress := &progressWriter{
+		downloaded: offset,
+		total:      total,
+		idle:       idle,
+		report: func(downloaded, total int64) {
+			c.reportDownloadProgress(requestID, attempt, downloaded, total)
+		},
+	}
+
+	body := &throttledReader{
+		reader:   resp.Body,
+		rate:     int64(c.config.AppStore.DownloadRateLimit) * 1024,
+		window:   c.config.AppStore.DownloadWindow,
+		started:  time.Now(),
+		lastTest: time.Now(),
+	}
+
+	if _, err := io.Copy(out, io.TeeReader(body, progress)); err != nil {
+		return false, newValidator, err
+	}
+	if total > 0 && progress.downloaded != total {
+		return false, newValidator, fmt.Errorf("download incomplete: %d of %d bytes", progress.downloaded, total)
+	}
+
+	progress.flush()
+	return true, newValidator, nil
+}
+
+// errDownloadWindowClosed stops a download attempt when the download
+// window ends; the download resumes in the next window
+var errDownloadWindowClosed = errors.New("download window closed")
+
+// throttledReader limits a download to rate bytes per second (0 = no limit)
+// and fails once the download window has closed
+type throttledReader struct {
+	reader   io.Reader
+	rate     int64
+	window   string
+	started  time.Time
+	read     int64
+	lastTest time.Time
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if t.window != "" && time.Since(t.lastTest) >= time.Minute {
+		t.lastTest = time.Now()
+		if inWindow, _ := inTimeWindow(t.window, t.lastTest); !inWindow {
+			return 0, errDownloadWindowClosed
+		}
+	}
+
+	if t.rate > 0 && int64(len(b)) > t.rate {
+		// At most one second's worth per read, so the pace stays even
+		b = b[:t.rate]
+	}
+
+	n, err := t.reader.Read(b)
+	t.read += int64(n)
+
+	if t.rate > 0 {
+		expected := time.Duration(t.read * int64(time.Second) / t.rate)
+		if wait := expected - time.Since(t.started); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+
+	return n, err
+}
+
+// contentRangeTotal returns the complete length from a "bytes a-b/total" header
+func contentRangeTotal(header string) int64 {
+	slash := strings.LastIndex(header, "/")
+	if slash < 0 {
+		return 0
+	}
+	total, err := strconv.ParseInt(header[slash+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return total
+}
+
+// progressWriter counts downloaded bytes and reports them at most once per
+// downloadProgressInterval
+type progressWriter struct {
+	downloaded int64
+	total      int64
+	last       time.Time
+	idle       *time.Timer
+	report     func(downloaded, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.downloaded += int64(len(b))
+	p.idle.Reset(downloadIdleTimeout)
+	if time.Since(p.last) >= downloadProgressInterval {
+		p.flush()
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) flush() {
+	p.last = time.Now()
+	p.report(p.downloaded, p.total)
+}
+
+// reportDownloadProgress posts download progress to the install request
+func (c *AppStoreClient) reportDownloadProgress(requestID, attempt int, downloaded, total int64) {
+	url := fmt.Sprintf("%s/ad/appstore/requests/%d/status", c.config.SIEM.APIURL, requestID)
+
+	progress := DownloadProgress{
+		Status:          "downloading",
+		BytesDownloaded: downloaded,
+		TotalBytes:      total,
+		Attempt:         attempt,
+	}
+	if total > 0 {
+		progress.Percent = int(downloaded * 100 / total)
+	}
+
+	jsonData, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
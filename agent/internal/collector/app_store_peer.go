@@ -0,0 +1,355 @@
+package collector
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Peer cache protocol. An agent looking for an installer broadcasts a UDP
+// query with its SHA-256; agents holding that blob answer with the TCP port
+// of their blob server, and the installer is fetched over HTTP from
+// /blobs/<sha256>. Blobs are only ever addressed by hash and every fetched
+// blob is hashed again before use, so a peer cannot substitute content.
+const (
+	peerQueryTimeout = 2 * time.Second
+	peerFetchTimeout = 30 * time.Minute
+	peerMaxUploads   = 4
+)
+
+// peerMessage is a UDP discovery datagram
+type peerMessage struct {
+	Type   string `json:"type"` // "query" or "have"
+	SHA256 string `json:"sha256"`
+	Port   int    `json:"port,omitempty"`
+}
+
+// PeerCache shares verified installers with agents on the local subnet
+type PeerCache struct {
+	config *config.AppStoreConfig
+
+	mutex    sync.Mutex
+	conn     *net.UDPConn
+	server   *http.Server
+	uploads  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPeerCache creates a peer cache
+func NewPeerCache(cfg *config.AppStoreConfig) *PeerCache {
+	return &PeerCache{
+		config:  cfg,
+		uploads: make(chan struct{}, peerMaxUploads),
+	}
+}
+
+// Start begins answering discovery queries and serving cached blobs
+func (p *PeerCache) Start() error {
+	if err := os.MkdirAll(p.config.PeerCacheDir, 0700); err != nil {
+		return fmt.Errorf("failed to create peer cache directory: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: p.config.PeerCachePort})
+	if err != nil {
+		return fmt.Errorf("failed to listen for peer queries: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", p.config.PeerCachePort))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to listen for peer downloads: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blobs/", p.serveBlob)
+
+	p.mutex.Lock()
+	p.conn = conn
+	p.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	p.mutex.Unlock()
+
+	go p.answerQueries(conn)
+	go p.server.Serve(listener)
+
+	log.Printf("✓ Peer installer cache listening on port %d", p.config.PeerCachePort)
+	return nil
+}
+
+// Stop stops the discovery responder and blob server
+func (p *PeerCache) Stop() {
+	p.stopOnce.Do(func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.conn != nil {
+			p.conn.Close()
+		}
+		if p.server != nil {
+			p.server.Close()
+		}
+	})
+}
+
+// answerQueries replies to queries for blobs this agent holds
+func (p *PeerCache) answerQueries(conn *net.UDPConn) {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return // closed
+		}
+
+		var msg peerMessage
+		if json.Unmarshal(buf[:n], &msg) != nil || msg.Type != "query" || !p.Has(msg.SHA256) {
+			continue
+		}
+
+		reply, _ := json.Marshal(peerMessage{Type: "have", SHA256: msg.SHA256, Port: p.config.PeerCachePort})
+		conn.WriteToUDP(reply, addr)
+	}
+}
+
+// serveBlob serves a cached blob by hash
+func (p *PeerCache) serveBlob(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, "/blobs/")
+	path, ok := p.blobPath(hash)
+	if !ok || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+
+	select {
+	case p.uploads <- struct{}{}:
+		defer func() { <-p.uploads }()
+	default:
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, hash, info.ModTime(), f)
+}
+
+// blobPath maps a hash to its file in the cache directory, rejecting
+// anything but a lowercase hex SHA-256 so requests cannot leave the directory
+func (p *PeerCache) blobPath(hash string) (string, bool) {
+	hash = strings.ToLower(hash)
+	if len(hash) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return filepath.Join(p.config.PeerCacheDir, hash), true
+}
+
+// Has reports whether a blob is cached
+func (p *PeerCache) Has(hash string) bool {
+	path, ok := p.blobPath(hash)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Add copies a verified installer into the cache and evicts the least
+// recently added blobs above the size limit
+func (p *PeerCache) Add(hash, srcPath string) error {
+	path, ok := p.blobPath(hash)
+	if !ok {
+		return fmt.Errorf("invalid hash %q", hash)
+	}
+	if p.Has(hash) {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := copyFile(srcPath, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	p.evict()
+	return nil
+}
+
+// evict removes the oldest blobs until the cache fits its size limit
+func (p *PeerCache) evict() {
+	entries, err := os.ReadDir(p.config.PeerCacheDir)
+	if err != nil {
+		return
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+
+	limit := int64(p.config.PeerCacheMaxSizeMB) * 1024 * 1024
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, info := range files {
+		if total <= limit {
+			break
+		}
+		if os.Remove(filepath.Join(p.config.PeerCacheDir, info.Name())) == nil {
+			total -= info.Size()
+		}
+	}
+}
+
+// Fetch finds a peer holding the blob and downloads it to destPath. A peer
+// sending more than size bytes, or more than the cache holds when the size
+// is unknown, is cut off. The blob's hash is checked before it is accepted.
+func (p *PeerCache) Fetch(hash, destPath string, size int64) error {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if _, ok := p.blobPath(hash); !ok {
+		return fmt.Errorf("invalid hash %q", hash)
+	}
+
+	peer, err := p.findPeer(hash)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: peerFetchTimeout}
+	resp, err := client.Get(fmt.Sprintf("http://%s/blobs/%s", peer, hash))
+	if err != nil {
+		return fmt.Errorf("peer %s: %w", peer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer %s returned status %d", peer, resp.StatusCode)
+	}
+
+	limit := int64(p.config.PeerCacheMaxSizeMB) * 1024 * 1024
+	if size > 0 {
+		limit = size
+	}
+	if resp.ContentLength > limit {
+		return fmt.Errorf("peer %s offers %d bytes, more than %d", peer, resp.ContentLength, limit)
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(resp.Body, limit+1))
+	if err == nil && n > limit {
+		err = fmt.Errorf("sent more than %d bytes", limit)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(destPath)
+		return fmt.Errorf("peer %s: %w", peer, err)
+	}
+	out.Close()
+
+	if err := verifyInstaller(destPath, &InstallInfo{SHA256: hash, InstallerURL: "peer " + peer}); err != nil {
+		os.Remove(destPath)
+		return err
+	}
+
+	log.Printf("✓ Installer %s fetched from peer %s", hash[:12], peer)
+	return nil
+}
+
+// findPeer broadcasts a query for the blob and returns the address of the
+// first peer that answers
+func (p *PeerCache) findPeer(hash string) (string, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	query, _ := json.Marshal(peerMessage{Type: "query", SHA256: hash})
+	broadcast := &net.UDPAddr{IP: net.IPv4bcast, Port: p.config.PeerCachePort}
+	if _, err := conn.WriteToUDP(query, broadcast); err != nil {
+		return "", fmt.Errorf("failed to query peers: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(peerQueryTimeout))
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return "", fmt.Errorf("no peer has installer %s", hash[:12])
+		}
+
+		var msg peerMessage
+		if json.Unmarshal(buf[:n], &msg) != nil || msg.Type != "have" || msg.SHA256 != hash || msg.Port <= 0 {
+			continue
+		}
+		return net.JoinHostPort(addr.IP.String(), fmt.Sprint(msg.Port)), nil
+	}
+}
+
+// fetchFromPeers copies an installer from the local peer cache or a LAN
+// peer. It fails if the peer cache is off or no peer has the installer.
+func (c *AppStoreClient) fetchFromPeers(hash, destPath string, size int64) error {
+	if c.peers == nil || hash == "" {
+		return fmt.Errorf("peer cache not available")
+	}
+
+	if c.peers.Has(hash) {
+		err := c.peers.copyBlob(hash, destPath)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Warning: %v", err)
+	}
+	return c.peers.Fetch(hash, destPath, size)
+}
+
+// copyBlob copies a cached blob to destPath after checking its hash. A blob
+// that no longer matches, corrupted on disk or replaced, is removed from the
+// cache so it is fetched again and not served to peers.
+func (p *PeerCache) copyBlob(hash, destPath string) error {
+	path, ok := p.blobPath(hash)
+	if !ok {
+		return fmt.Errorf("invalid hash %q", hash)
+	}
+	if err := copyFile(path, destPath); err != nil {
+		os.Remove(destPath)
+		return fmt.Errorf("failed to copy cached installer: %w", err)
+	}
+	if err := verifyInstaller(destPath, &InstallInfo{SHA256: hash, InstallerURL: "peer cache " + path}); err != nil {
+		os.Remove(destPath)
+		os.Remove(path)
+		return fmt.Errorf("removed cached installer %s: %w", hash[:12], err)
+	}
+	return nil
+}
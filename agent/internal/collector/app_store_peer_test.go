@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// TestPeerCacheCopyBlob checks that a cached blob is only handed out while
+// it still matches its hash, and is removed from the cache once it does not
+func TestPeerCacheCopyBlob(t *testing.T) {
+	installer := []byte("installer")
+	sum := sha256.Sum256(installer)
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		blob      []byte
+		wantErr   bool
+		wantCache bool // blob still cached afterwards
+	}{
+		{name: "matching blob", blob: installer, wantCache: true},
+		{name: "corrupted blob", blob: []byte("installe"), wantErr: true},
+		{name: "replaced blob", blob: []byte("malware!!"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			peers := NewPeerCache(&config.AppStoreConfig{PeerCacheDir: dir})
+			if err := os.WriteFile(filepath.Join(dir, hash), tt.blob, 0600); err != nil {
+				t.Fatal(err)
+			}
+			dest := filepath.Join(t.TempDir(), "installer.msi")
+
+			err := peers.copyBlob(hash, dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("copyBlob() error = %v, want error %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(dest); (statErr == nil) != !tt.wantErr {
+				t.Errorf("destination exists = %v, want %v", statErr == nil, !tt.wantErr)
+			}
+			if got := peers.Has(hash); got != tt.wantCache {
+				t.Errorf("Has() = %v, want %v", got, tt.wantCache)
+			}
+		})
+	}
+}
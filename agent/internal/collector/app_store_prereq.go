@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Exit code reported when a prerequisite could not be installed
+const installPrerequisiteExitCode = -5
+
+// Prerequisite install step states
+const (
+	StepPresent    = "present" // detected, nothing installed
+	StepInstalling = "installing"
+	StepInstalled  = "installed"
+	StepFailed     = "failed"
+)
+
+// Prerequisite is a package (VC++ runtime, .NET) an app needs. It is
+// installed only if its detection rules fail.
+type Prerequisite struct {
+	Name      string          `json:"name"`
+	Detection []DetectionRule `json:"detection"`
+	Install   InstallInfo     `json:"install"`
+}
+
+// InstallStep reports the progress of one prerequisite
+type InstallStep struct {
+	Step     int    `json:"step"` // 1-based, in install order
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Output   string `json:"output,omitempty"`
+}
+
+// installPrerequisites installs missing prerequisites in order, reporting
+// each step. The first failure stops the installation and is reported as
+// the request result.
+func (c *AppStoreClient) installPrerequisites(requestID int, prerequisites []Prerequisite) error {
+	for i, pre := range prerequisites {
+		step := InstallStep{Step: i + 1, Name: pre.Name}
+
+		if len(pre.Detection) > 0 && detectInstalled(pre.Detection) == nil {
+			step.Status = StepPresent
+			c.reportStep(requestID, &step)
+			continue
+		}
+
+		log.Printf("Installing prerequisite %s for request %d", pre.Name, requestID)
+		step.Status = StepInstalling
+		c.reportStep(requestID, &step)
+
+		install := pre.Install
+		if len(install.Detection) == 0 {
+			install.Detection = pre.Detection
+		}
+		install.Prerequisites = nil
+
+		outcome, err := c.runInstaller(requestID, fmt.Sprintf("_pre%d", i+1), &install)
+		if err == nil && (outcome.exitCode == 0 || outcome.exitCode == msiSuccessRebootRequired) {
+			step.Status = StepInstalled
+			c.reportStep(requestID, &step)
+			continue
+		}
+
+		step.Status = StepFailed
+		installLog := ""
+		if err != nil {
+			step.ExitCode = -1
+			step.Output = err.Error()
+		} else {
+			step.ExitCode = outcome.exitCode
+			step.Output = outcome.output
+			installLog = outcome.installLog
+		}
+		c.reportStep(requestID, &step)
+
+		message := fmt.Sprintf("Prerequisite %s failed (exit code %d): %s", pre.Name, step.ExitCode, step.Output)
+		c.reportInstallation(requestID, installPrerequisiteExitCode, message, installLog)
+		return fmt.Errorf("prerequisite %s failed with exit code %d", pre.Name, step.ExitCode)
+	}
+
+	return nil
+}
+
+// reportStep reports one prerequisite step to the server
+func (c *AppStoreClient) reportStep(requestID int, step *InstallStep) {
+	url := fmt.Sprintf("%s/ad/appstore/requests/%d/steps", c.config.SIEM.APIURL, requestID)
+
+	if len(step.Output) > 5000 {
+		step.Output = step.Output[:5000] + "... (truncated)"
+	}
+
+	jsonData, err := json.Marshal(step)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+}
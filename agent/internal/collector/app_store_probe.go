@@ -0,0 +1,30 @@
+//go:build windows
+
+package collector
+
+import "golang.org/x/sys/windows/svc/mgr"
+
+// installedVersion returns the DisplayVersion of an installed product
+func installedVersion(name string) (string, bool) {
+	product := findInstalledApp(&StoreApp{Name: name})
+	if product == nil {
+		return "", false
+	}
+	return product.DisplayVersion, true
+}
+
+// serviceExists reports whether a Windows service is registered
+func serviceExists(name string) bool {
+	m, err := mgr.Connect()
+	if err != nil {
+		return false
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return false
+	}
+	s.Close()
+	return true
+}
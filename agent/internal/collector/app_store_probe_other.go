@@ -0,0 +1,13 @@
+//go:build !windows
+
+package collector
+
+// installedVersion always fails: the Uninstall keys only exist on Windows
+func installedVersion(name string) (string, bool) {
+	return "", false
+}
+
+// serviceExists always fails: service rules only apply to Windows
+func serviceExists(name string) bool {
+	return false
+}
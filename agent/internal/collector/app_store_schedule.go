@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// inTimeWindow reports whether now falls in a "HH:MM-HH:MM" local time
+// window. Windows whose end is before their start span midnight. An empty
+// window allows any time.
+func inTimeWindow(window string, now time.Time) (bool, error) {
+	window = strings.TrimSpace(window)
+	if window == "" {
+		return true, nil
+	}
+
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return false, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", window)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return false, fmt.Errorf("invalid time window %q: %v", window, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return false, fmt.Errorf("invalid time window %q: %v", window, err)
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return minute >= from && minute < to, nil
+	}
+	return minute >= from || minute < to, nil
+}
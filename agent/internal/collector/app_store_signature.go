@@ -0,0 +1,14 @@
+//go:build windows
+
+package collector
+
+import "fmt"
+
+// installerSigner returns the signer of an installer with a valid
+// Authenticode signature
+func installerSigner(path string) (string, error) {
+	if status := verifySignature(path); status != SignatureValid {
+		return "", fmt.Errorf("signature is %s", status)
+	}
+	return signerName(path), nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package collector
+
+import "fmt"
+
+// installerSigner cannot check Authenticode outside Windows, so installers
+// with an expected publisher are refused
+func installerSigner(path string) (string, error) {
+	return "", fmt.Errorf("Authenticode signatures can only be verified on Windows")
+}
@@ -0,0 +1,290 @@
+//go:build windows
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// UninstallRequest is a server request to remove a previously installed app
+type UninstallRequest struct {
+	RequestID           int    `json:"request_id"`
+	AppID               int    `json:"app_id"`
+	DisplayName         string `json:"display_name"`                    // matched against the Uninstall key DisplayName
+	ProductCode         string `json:"product_code,omitempty"`          // MSI product code, preferred when known
+	SilentUninstallArgs string `json:"silent_uninstall_args,omitempty"` // appended to the registry UninstallString
+}
+
+// UninstallResult is reported to the server after an uninstall attempt
+type UninstallResult struct {
+	ExitCode       int    `json:"exit_code"`
+	Output         string `json:"output"`
+	Removed        bool   `json:"removed"` // no longer in the Uninstall keys
+	RebootRequired bool   `json:"reboot_required"`
+}
+
+// installedProduct is the Uninstall subkey of an installed product
+type installedProduct struct {
+	KeyName              string
+	DisplayName          string
+	DisplayVersion       string
+	UninstallString      string
+	QuietUninstallString string
+	WindowsInstaller     bool
+}
+
+// GetPendingUninstalls retrieves uninstall requests for this agent
+func (c *AppStoreClient) GetPendingUninstalls() ([]UninstallRequest, error) {
+	query := url.Values{"agent_id": {c.agentID}}
+	endpoint := fmt.Sprintf("%s/ad/appstore/uninstalls/pending?%s", c.config.SIEM.APIURL, query.Encode())
+
+	resp, err := c.httpClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch uninstall requests: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var requests []UninstallRequest
+	if err := json.Unmarshal(body, &requests); err != nil {
+		return nil, fmt.Errorf("failed to parse uninstall requests: %v", err)
+	}
+
+	return requests, nil
+}
+
+// PollUninstalls processes server uninstall requests until ctx is cancelled
+func (c *AppStoreClient) PollUninstalls(ctx context.Context, interval time.Duration) {
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			requests, err := c.GetPendingUninstalls()
+			if err != nil {
+				continue
+			}
+			for i := range requests {
+				if err := c.UninstallApp(&requests[i]); err != nil {
+					log.Printf("Uninstall of %s failed: %v", requests[i].DisplayName, err)
+				}
+			}
+		}
+	}
+}
+
+// UninstallApp silently removes an installed app, checks the Uninstall keys
+// to confirm the removal and reports the outcome
+func (c *AppStoreClient) UninstallApp(request *UninstallRequest) error {
+	product := findInstalledProduct(request.DisplayName, request.ProductCode)
+	if product == nil {
+		// Nothing to do; report it so the request is closed
+		c.reportUninstall(request.RequestID, &UninstallResult{
+			Output:  "Product is not installed",
+			Removed: true,
+		})
+		return nil
+	}
+
+	cmd, err := uninstallCommand(product, request)
+	if err != nil {
+		c.reportUninstall(request.RequestID, &UninstallResult{ExitCode: -1, Output: err.Error()})
+		return err
+	}
+
+	log.Printf("Uninstalling %s (request %d)", product.DisplayName, request.RequestID)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if err := cmd.Start(); err != nil {
+		c.reportUninstall(request.RequestID, &UninstallResult{ExitCode: -1, Output: fmt.Sprintf("Failed to start uninstaller: %v", err)})
+		return fmt.Errorf("failed to start uninstaller: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	result := &UninstallResult{}
+	select {
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		result.ExitCode = -2
+		result.Output = "Uninstallation timed out"
+	case err := <-done:
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				result.ExitCode = exitErr.ExitCode()
+			} else {
+				result.ExitCode = -1
+			}
+		}
+		result.Output = stdout.String()
+		if stderr.Len() > 0 {
+			result.Output += "\nErrors:\n" + stderr.String()
+		}
+	}
+
+	// Trust the inventory, not the exit code: some uninstallers return
+	// before their child process has finished removing the product
+	result.Removed = waitForRemoval(request.DisplayName, request.ProductCode, time.Minute)
+	result.RebootRequired = result.ExitCode == msiSuccessRebootRequired
+
+	c.reportUninstall(request.RequestID, result)
+
+	if !result.Removed {
+		return fmt.Errorf("product still installed after uninstall (exit code %d)", result.ExitCode)
+	}
+
+	log.Printf("✓ Uninstalled %s", product.DisplayName)
+	return nil
+}
+
+// uninstallCommand builds a silent uninstall command for a product.
+// Windows Installer products are removed by product code; for others the
+// QuietUninstallString is preferred over the UninstallString.
+func uninstallCommand(product *installedProduct, request *UninstallRequest) (*exec.Cmd, error) {
+	productCode := request.ProductCode
+	if productCode == "" && product.WindowsInstaller && isProductCode(product.KeyName) {
+		productCode = product.KeyName
+	}
+	if productCode != "" {
+		return exec.Command("msiexec", "/x", productCode, "/qn", "/norestart"), nil
+	}
+
+	commandLine := product.QuietUninstallString
+	if commandLine == "" {
+		if product.UninstallString == "" {
+			return nil, fmt.Errorf("no uninstall command registered for %s", product.DisplayName)
+		}
+		commandLine = product.UninstallString
+		if request.SilentUninstallArgs != "" {
+			commandLine += " " + request.SilentUninstallArgs
+		}
+	}
+
+	args, err := windows.DecomposeCommandLine(commandLine)
+	if err != nil || len(args) == 0 {
+		return nil, fmt.Errorf("invalid uninstall command %q", commandLine)
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// waitForRemoval polls the Uninstall keys until the product disappears or
+// the timeout passes
+func waitForRemoval(displayName, productCode string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if findInstalledProduct(displayName, productCode) == nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// findInstalledProduct looks up a product in the machine-wide Uninstall
+// keys by product code, or else by exact DisplayName
+func findInstalledProduct(displayName, productCode string) *installedProduct {
+	return lookupInstalledProduct(func(keyName, name string) bool {
+		if productCode != "" {
+			return strings.EqualFold(keyName, productCode)
+		}
+		return strings.EqualFold(name, displayName)
+	})
+}
+
+// lookupInstalledProduct returns the first product in the machine-wide
+// Uninstall keys accepted by match
+func lookupInstalledProduct(match func(keyName, displayName string) bool) *installedProduct {
+	for _, path := range uninstallKeyPaths {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+
+		subkeys, err := key.ReadSubKeyNames(-1)
+		key.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, subkey := range subkeys {
+			sub, err := registry.OpenKey(registry.LOCAL_MACHINE, path+`\`+subkey, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+
+			product := &installedProduct{KeyName: subkey}
+			product.DisplayName, _, _ = sub.GetStringValue("DisplayName")
+			product.DisplayVersion, _, _ = sub.GetStringValue("DisplayVersion")
+			product.UninstallString, _, _ = sub.GetStringValue("UninstallString")
+			product.QuietUninstallString, _, _ = sub.GetStringValue("QuietUninstallString")
+			windowsInstaller, _, _ := sub.GetIntegerValue("WindowsInstaller")
+			product.WindowsInstaller = windowsInstaller == 1
+			sub.Close()
+
+			if product.DisplayName != "" && match(subkey, product.DisplayName) {
+				return product
+			}
+		}
+	}
+
+	return nil
+}
+
+// isProductCode reports whether s looks like an MSI product code GUID
+func isProductCode(s string) bool {
+	return len(s) == 38 && s[0] == '{' && s[37] == '}'
+}
+
+// reportUninstall reports the uninstall result to the server
+func (c *AppStoreClient) reportUninstall(requestID int, result *UninstallResult) {
+	url := fmt.Sprintf("%s/ad/appstore/uninstalls/%d/result", c.config.SIEM.APIURL, requestID)
+
+	if len(result.Output) > 5000 {
+		result.Output = result.Output[:5000] + "... (truncated)"
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+}
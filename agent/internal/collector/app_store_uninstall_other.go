@@ -0,0 +1,15 @@
+//go:build !windows
+
+package collector
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PollUninstalls does nothing outside Windows: uninstallers are found in
+// the Uninstall keys
+func (c *AppStoreClient) PollUninstalls(ctx context.Context, interval time.Duration) {
+	log.Println("App store uninstalls are only supported on Windows")
+}
@@ -0,0 +1,202 @@
+//go:build windows
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// AppUpdate is an installed store app with a newer catalog version
+type AppUpdate struct {
+	AppID            int    `json:"app_id"`
+	Name             string `json:"name"`
+	InstalledVersion string `json:"installed_version"`
+	AvailableVersion string `json:"available_version"`
+
+	app StoreApp
+}
+
+// AppUpdateReport is sent to the server after an update attempt
+type AppUpdateReport struct {
+	AgentID       string `json:"agent_id"`
+	AppID         int    `json:"app_id"`
+	Name          string `json:"name"`
+	VersionBefore string `json:"version_before"`
+	VersionAfter  string `json:"version_after"`
+	Success       bool   `json:"success"`
+	Error         string `json:"error,omitempty"`
+}
+
+// CheckUpdates compares the installed versions of store apps with the catalog
+func (c *AppStoreClient) CheckUpdates() ([]AppUpdate, error) {
+	apps, err := c.GetApps("")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []AppUpdate
+	for _, app := range apps {
+		if app.Version == "" || app.Cached {
+			continue
+		}
+		product := findInstalledApp(&app)
+		if product == nil || product.DisplayVersion == "" {
+			continue
+		}
+		if compareVersions(app.Version, product.DisplayVersion) > 0 {
+			updates = append(updates, AppUpdate{
+				AppID:            app.AppID,
+				Name:             app.DisplayName,
+				InstalledVersion: product.DisplayVersion,
+				AvailableVersion: app.Version,
+				app:              app,
+			})
+		}
+	}
+
+	return updates, nil
+}
+
+// RunUpdates periodically requests updates for installed store apps and
+// installs approved ones inside the maintenance window. Updates awaiting
+// approval are tracked by request so they are not requested twice.
+func (c *AppStoreClient) RunUpdates(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.config.AppStore.UpdateCheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	pending := make(map[int]int) // app ID -> install request ID
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			inWindow, err := inTimeWindow(c.config.AppStore.MaintenanceWindow, time.Now())
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			if !inWindow {
+				continue
+			}
+
+			updates, err := c.CheckUpdates()
+			if err != nil {
+				log.Printf("Update check failed: %v", err)
+				continue
+			}
+
+			for _, update := range updates {
+				if ctx.Err() != nil {
+					return
+				}
+				c.applyUpdate(update, pending)
+			}
+		}
+	}
+}
+
+// applyUpdate installs an update once the server approves it and reports
+// the versions before and after
+func (c *AppStoreClient) applyUpdate(update AppUpdate, pending map[int]int) {
+	var info *InstallInfo
+	var requestID int
+
+	if id, ok := pending[update.AppID]; ok {
+		status, err := c.CheckRequestStatus(id)
+		if err != nil {
+			return
+		}
+		switch status.Status {
+		case "approved":
+			info = status.InstallInfo
+		case "denied", "failed", "installed":
+			// Closed; request again on the next check if still outdated
+			delete(pending, update.AppID)
+		}
+		requestID = id
+	} else {
+		reason := fmt.Sprintf("Automatic update from %s to %s", update.InstalledVersion, update.AvailableVersion)
+		response, err := c.RequestInstall(update.AppID, "SYSTEM", "SIEM Agent", "", reason)
+		if err != nil {
+			log.Printf("Failed to request update of %s: %v", update.Name, err)
+			return
+		}
+		requestID = response.RequestID
+		if response.CanInstall {
+			info = response.InstallInfo
+		} else {
+			pending[update.AppID] = requestID
+			log.Printf("Update of %s to %s awaiting approval (request %d)", update.Name, update.AvailableVersion, requestID)
+		}
+	}
+
+	if info == nil {
+		return
+	}
+	delete(pending, update.AppID)
+
+	log.Printf("Updating %s from %s to %s", update.Name, update.InstalledVersion, update.AvailableVersion)
+	report := AppUpdateReport{
+		AgentID:       c.agentID,
+		AppID:         update.AppID,
+		Name:          update.Name,
+		VersionBefore: update.InstalledVersion,
+	}
+
+	if err := c.InstallApp(requestID, info); err != nil {
+		report.Error = err.Error()
+	}
+
+	if product := findInstalledApp(&update.app); product != nil {
+		report.VersionAfter = product.DisplayVersion
+	}
+	report.Success = report.Error == "" && compareVersions(report.VersionAfter, update.InstalledVersion) > 0
+	if report.Success {
+		log.Printf("✓ Updated %s to %s", update.Name, report.VersionAfter)
+	} else if report.Error == "" {
+		report.Error = "installed version did not change"
+	}
+
+	c.reportUpdate(&report)
+}
+
+// reportUpdate reports an update attempt to the server
+func (c *AppStoreClient) reportUpdate(report *AppUpdateReport) {
+	url := fmt.Sprintf("%s/ad/appstore/updates/report", c.config.SIEM.APIURL)
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+}
+
+// findInstalledApp finds the installed product for a store app. Products
+// often append the version or architecture to their name ("7-Zip 23.01
+// (x64)"), so a DisplayName starting with the app name also matches.
+func findInstalledApp(app *StoreApp) *installedProduct {
+	return lookupInstalledProduct(func(keyName, displayName string) bool {
+		for _, name := range []string{app.DisplayName, app.Name} {
+			if name == "" {
+				continue
+			}
+			if strings.EqualFold(displayName, name) ||
+				strings.HasPrefix(strings.ToLower(displayName), strings.ToLower(name)+" ") {
+				return true
+			}
+		}
+		return false
+	})
+}
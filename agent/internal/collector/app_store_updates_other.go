@@ -0,0 +1,14 @@
+//go:build !windows
+
+package collector
+
+import (
+	"context"
+	"log"
+)
+
+// RunUpdates does nothing outside Windows: installed versions are read from
+// the Uninstall keys
+func (c *AppStoreClient) RunUpdates(ctx context.Context) {
+	log.Println("App store updates are only supported on Windows")
+}
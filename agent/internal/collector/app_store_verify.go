@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit code reported when a downloaded installer fails verification
+const installerVerifyExitCode = -3
+
+// verifyInstaller checks an installer against the hash and, if given, the
+// Authenticode publisher the server expects. It runs after the download
+// and before anything is executed; the error describes the mismatch in
+// enough detail for the failure report.
+func verifyInstaller(path string, info *InstallInfo) error {
+	expected := strings.ToLower(strings.TrimSpace(info.SHA256))
+	if expected == "" {
+		return fmt.Errorf("server did not provide a SHA-256 for the installer")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open installer: %v", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("failed to hash installer: %v", err)
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+
+	if actual != expected {
+		return fmt.Errorf("installer hash mismatch: expected SHA-256 %s, got %s (%d bytes, source %s)",
+			expected, actual, size, installerSource(info))
+	}
+
+	if info.Publisher == "" {
+		return nil
+	}
+
+	signer, err := installerSigner(path)
+	if err != nil {
+		return fmt.Errorf("installer %v, expected a valid signature by %q", err, info.Publisher)
+	}
+	if !strings.EqualFold(strings.TrimSpace(signer), strings.TrimSpace(info.Publisher)) {
+		return fmt.Errorf("installer is signed by %q, expected %q", signer, info.Publisher)
+	}
+
+	return nil
+}
+
+// installerSource describes where an installer came from for failure reports
+func installerSource(info *InstallInfo) string {
+	if info.InstallerPath != "" {
+		return info.InstallerPath
+	}
+	return info.InstallerURL
+}
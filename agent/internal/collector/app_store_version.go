@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// compareVersions compares dotted version strings numerically, returning
+// -1, 0 or 1. Non-numeric suffixes of a component are ignored.
+func compareVersions(a, b string) int {
+	pa := versionParts(a)
+	pb := versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts splits a version into its leading numeric components
+func versionParts(v string) []int {
+	var parts []int
+	for _, field := range strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '_' }) {
+		end := strings.IndexFunc(field, func(r rune) bool { return !unicode.IsDigit(r) })
+		if end == 0 {
+			break
+		}
+		if end > 0 {
+			field = field[:end]
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
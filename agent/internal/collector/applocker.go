@@ -0,0 +1,324 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Well-known SIDs used in generated rules
+const (
+	sidEveryone       = "S-1-1-0"
+	sidAdministrators = "S-1-5-32-544"
+)
+
+// AppLocker XML policy schema
+type appLockerPolicy struct {
+	XMLName         xml.Name                  `xml:"AppLockerPolicy"`
+	Version         string                    `xml:"Version,attr"`
+	RuleCollections []appLockerRuleCollection `xml:"RuleCollection"`
+}
+
+type appLockerRuleCollection struct {
+	Type            string                   `xml:"Type,attr"`
+	EnforcementMode string                   `xml:"EnforcementMode,attr"`
+	PathRules       []appLockerPathRule      `xml:"FilePathRule"`
+	PublisherRules  []appLockerPublisherRule `xml:"FilePublisherRule"`
+	HashRules       []appLockerHashRule      `xml:"FileHashRule"`
+}
+
+type appLockerRuleHeader struct {
+	ID             string `xml:"Id,attr"`
+	Name           string `xml:"Name,attr"`
+	Description    string `xml:"Description,attr"`
+	UserOrGroupSid string `xml:"UserOrGroupSid,attr"`
+	Action         string `xml:"Action,attr"`
+}
+
+type appLockerPathRule struct {
+	appLockerRuleHeader
+	Condition struct {
+		Path string `xml:"Path,attr"`
+	} `xml:"Conditions>FilePathCondition"`
+}
+
+type appLockerPublisherRule struct {
+	appLockerRuleHeader
+	Condition struct {
+		PublisherName string `xml:"PublisherName,attr"`
+		ProductName   string `xml:"ProductName,attr"`
+		BinaryName    string `xml:"BinaryName,attr"`
+		VersionRange  struct {
+			LowSection  string `xml:"LowSection,attr"`
+			HighSection string `xml:"HighSection,attr"`
+		} `xml:"BinaryVersionRange"`
+	} `xml:"Conditions>FilePublisherCondition"`
+}
+
+type appLockerHashRule struct {
+	appLockerRuleHeader
+	Hash struct {
+		Type             string `xml:"Type,attr"`
+		Data             string `xml:"Data,attr"`
+		SourceFileName   string `xml:"SourceFileName,attr"`
+		SourceFileLength int64  `xml:"SourceFileLength,attr"`
+	} `xml:"Conditions>FileHashCondition>FileHash"`
+}
+
+// AppLockerManager converts the server allowlist into a local AppLocker
+// policy so enforcement continues even while the agent is not running
+type AppLockerManager struct {
+	config     *config.SoftwareControlConfig
+	agentID    string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mutex      sync.Mutex
+	policyPath string
+	policyHash string
+
+	// Callback for fetching the allowlist from SIEM
+	onFetchAllowlist func() ([]AllowlistEntry, error)
+}
+
+// NewAppLockerManager creates a new AppLocker policy manager
+func NewAppLockerManager(cfg *config.SoftwareControlConfig, agentID string) *AppLockerManager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &AppLockerManager{
+		config:     cfg,
+		agentID:    agentID,
+		ctx:        ctx,
+		cancel:     cancel,
+		policyPath: filepath.Join(os.Getenv("ProgramData"), "SIEM", "applocker.xml"),
+	}
+}
+
+// SetCallbacks sets the callback for SIEM communication
+func (m *AppLockerManager) SetCallbacks(onFetch func() ([]AllowlistEntry, error)) {
+	m.onFetchAllowlist = onFetch
+}
+
+// Start syncs the policy immediately and then periodically
+func (m *AppLockerManager) Start() {
+	log.Println("Starting AppLocker policy sync...")
+
+	interval := time.Duration(m.config.PolicySyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = 15 * time.Minute
+	}
+
+	if err := m.Sync(); err != nil {
+		log.Printf("Error syncing AppLocker policy: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Sync(); err != nil {
+				log.Printf("Error syncing AppLocker policy: %v", err)
+			}
+		}
+	}
+}
+
+// Stop stops the policy sync. The deployed policy stays in effect.
+func (m *AppLockerManager) Stop() {
+	m.cancel()
+}
+
+// Sync fetches the allowlist and deploys the policy if it changed
+func (m *AppLockerManager) Sync() error {
+	if m.onFetchAllowlist == nil {
+		return fmt.Errorf("allowlist callback not configured")
+	}
+
+	entries, err := m.onFetchAllowlist()
+	if err != nil {
+		return fmt.Errorf("failed to fetch allowlist: %w", err)
+	}
+
+	policyXML, err := BuildAppLockerPolicy(entries, m.enforcementMode())
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(policyXML)
+	hash := hex.EncodeToString(sum[:])
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if hash == m.policyHash {
+		return nil
+	}
+
+	if err := m.deploy(policyXML); err != nil {
+		return err
+	}
+
+	m.policyHash = hash
+	log.Printf("✓ AppLocker policy deployed (%d allowlist entries, mode: %s)", len(entries), m.enforcementMode())
+	return nil
+}
+
+// enforcementMode maps the configured policy mode to AppLocker's value
+func (m *AppLockerManager) enforcementMode() string {
+	if strings.EqualFold(m.config.PolicyMode, "enforce") {
+		return "Enabled"
+	}
+	return "AuditOnly"
+}
+
+// deploy writes the policy and applies it as the local AppLocker policy
+func (m *AppLockerManager) deploy(policyXML []byte) error {
+	if err := os.MkdirAll(filepath.Dir(m.policyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create policy directory: %w", err)
+	}
+
+	if err := os.WriteFile(m.policyPath, policyXML, 0600); err != nil {
+		return fmt.Errorf("failed to write policy: %w", err)
+	}
+
+	// AppLocker requires the Application Identity service
+	psScript := fmt.Sprintf(`
+$ErrorActionPreference = "Stop"
+Set-Service -Name AppIDSvc -StartupType Automatic
+Start-Service -Name AppIDSvc
+Set-AppLockerPolicy -XmlPolicy '%s'
+`, m.policyPath)
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", psScript)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to apply AppLocker policy: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// BuildAppLockerPolicy generates an AppLocker policy XML from allowlist
+// entries. Default rules keep Windows, Program Files and administrators
+// working; everything else must match a publisher or hash rule.
+func BuildAppLockerPolicy(entries []AllowlistEntry, enforcementMode string) ([]byte, error) {
+	exe := appLockerRuleCollection{Type: "Exe", EnforcementMode: enforcementMode}
+	msi := appLockerRuleCollection{Type: "Msi", EnforcementMode: enforcementMode}
+
+	exe.PathRules = []appLockerPathRule{
+		newPathRule("Exe", "All files located in the Program Files folder", sidEveryone, "%PROGRAMFILES%\\*"),
+		newPathRule("Exe", "All files located in the Windows folder", sidEveryone, "%WINDIR%\\*"),
+		newPathRule("Exe", "All files for administrators", sidAdministrators, "*"),
+	}
+	msi.PathRules = []appLockerPathRule{
+		newPathRule("Msi", "All Windows Installer files in %systemdrive%\\Windows\\Installer", sidEveryone, "%WINDIR%\\Installer\\*"),
+		newPathRule("Msi", "All Windows Installer files for administrators", sidAdministrators, "*.*"),
+	}
+
+	for _, entry := range entries {
+		switch {
+		case entry.Publisher != "":
+			exe.PublisherRules = append(exe.PublisherRules, newPublisherRule("Exe", entry))
+			msi.PublisherRules = append(msi.PublisherRules, newPublisherRule("Msi", entry))
+		case entry.FileHash != "":
+			rule := newHashRule(entry)
+			if strings.EqualFold(filepath.Ext(entry.SourceFileName), ".msi") {
+				msi.HashRules = append(msi.HashRules, rule)
+			} else {
+				exe.HashRules = append(exe.HashRules, rule)
+			}
+		default:
+			log.Printf("Warning: Allowlist entry %q has neither publisher nor hash, skipping", entry.Name)
+		}
+	}
+
+	policy := appLockerPolicy{
+		Version:         "1",
+		RuleCollections: []appLockerRuleCollection{exe, msi},
+	}
+
+	data, err := xml.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal AppLocker policy: %w", err)
+	}
+	return data, nil
+}
+
+// ruleID derives a stable rule GUID so unchanged allowlists produce
+// identical policies and are not redeployed
+func ruleID(parts ...string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(strings.Join(parts, "|"))).String()
+}
+
+func newPathRule(collection, name, sid, path string) appLockerPathRule {
+	rule := appLockerPathRule{
+		appLockerRuleHeader: appLockerRuleHeader{
+			ID:             ruleID(collection, "path", sid, path),
+			Name:           name,
+			UserOrGroupSid: sid,
+			Action:         "Allow",
+		},
+	}
+	rule.Condition.Path = path
+	return rule
+}
+
+func newPublisherRule(collection string, entry AllowlistEntry) appLockerPublisherRule {
+	product := entry.ProductName
+	if product == "" {
+		product = "*"
+	}
+
+	rule := appLockerPublisherRule{
+		appLockerRuleHeader: appLockerRuleHeader{
+			ID:             ruleID(collection, "publisher", entry.Publisher, product),
+			Name:           "SIEM: " + entry.Name,
+			Description:    "Approved via SIEM software allowlist",
+			UserOrGroupSid: sidEveryone,
+			Action:         "Allow",
+		},
+	}
+	rule.Condition.PublisherName = entry.Publisher
+	rule.Condition.ProductName = product
+	rule.Condition.BinaryName = "*"
+	rule.Condition.VersionRange.LowSection = "*"
+	rule.Condition.VersionRange.HighSection = "*"
+	return rule
+}
+
+func newHashRule(entry AllowlistEntry) appLockerHashRule {
+	data := strings.ToUpper(strings.TrimPrefix(strings.ToLower(entry.FileHash), "0x"))
+
+	rule := appLockerHashRule{
+		appLockerRuleHeader: appLockerRuleHeader{
+			ID:             ruleID("hash", data),
+			Name:           "SIEM: " + entry.Name,
+			Description:    "Approved via SIEM software allowlist",
+			UserOrGroupSid: sidEveryone,
+			Action:         "Allow",
+		},
+	}
+	rule.Hash.Type = "SHA256"
+	rule.Hash.Data = "0x" + data
+	rule.Hash.SourceFileName = entry.SourceFileName
+	rule.Hash.SourceFileLength = entry.SourceFileSize
+	return rule
+}
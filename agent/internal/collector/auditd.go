@@ -0,0 +1,574 @@
+//go:build linux
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const (
+	AuditdSourceType = "auditd"
+	AuditdChannel    = "audit"
+	AuditdProvider   = "auditd"
+
+	// Windows-equivalent event codes for normalized audit events, so the
+	// same server rules apply to Linux hosts
+	AuditEventProcessCreate = 4688 // execve
+	AuditEventFileAccess    = 4663 // open, unlink, rename, chmod, chown, ...
+	AuditEventPrivilegeUse  = 4672 // set*id syscalls, sudo
+)
+
+const (
+	// Kernel multicast group for read-only audit listeners (AUDIT_NLGRP_READLOG)
+	auditNetlinkGroup = 1
+
+	// Events without an EOE record are complete once nothing has arrived
+	// for them for this long
+	auditEventTimeout = 2 * time.Second
+
+	// The audisp socket is reconnected after this delay if it closes
+	auditReconnectDelay = 10 * time.Second
+)
+
+// auditRawRecord is a record as read from the source, before parsing
+type auditRawRecord struct {
+	Type string
+	Text string
+}
+
+// AuditdCollector collects Linux audit events
+type AuditdCollector struct {
+	config     *config.AuditdConfig
+	agentID    string
+	hostname   string
+	keys       map[string]bool
+	eventQueue *EventQueue
+	wg         sync.WaitGroup
+	stopChan   chan struct{}
+	records    chan auditRawRecord
+	userNames  uidNames
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewAuditdCollector creates a new audit collector
+func NewAuditdCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*AuditdCollector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	c := &AuditdCollector{
+		config:     &cfg.Auditd,
+		agentID:    agentID,
+		hostname:   hostname,
+		keys:       make(map[string]bool),
+		eventQueue: eventQueue,
+		stopChan:   make(chan struct{}),
+		records:    make(chan auditRawRecord, 1024),
+	}
+	for _, key := range cfg.Auditd.Keys {
+		c.keys[key] = true
+	}
+
+	return c, nil
+}
+
+// Start begins reading audit records
+func (c *AuditdCollector) Start() error {
+	switch c.config.Source {
+	case "socket":
+		log.Printf("Starting auditd collector on %s", hostPath(c.config.SocketPath))
+		c.wg.Add(1)
+		go c.readSocket()
+	default:
+		fd, err := openAuditNetlink()
+		if err != nil {
+			return err
+		}
+		log.Println("Starting auditd collector on the audit netlink multicast group")
+		c.wg.Add(1)
+		go c.readNetlink(fd)
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop stops the collector
+func (c *AuditdCollector) Stop() {
+	close(c.stopChan)
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	log.Println("Auditd collector stopped")
+}
+
+// run reassembles records into events and queues them
+func (c *AuditdCollector) run() {
+	defer c.wg.Done()
+
+	assembler := newAuditAssembler(c.processEvent)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			assembler.flush(auditEventTimeout)
+		case record := <-c.records:
+			eventTime, serial, fields, err := parseAuditMessage(record.Type, record.Text)
+			if err != nil {
+				continue
+			}
+			assembler.add(record.Type, eventTime, serial, fields)
+		}
+	}
+}
+
+// deliver passes a raw record to the assembler. It returns false when the
+// collector is stopping.
+func (c *AuditdCollector) deliver(record auditRawRecord) bool {
+	select {
+	case c.records <- record:
+		return true
+	case <-c.stopChan:
+		return false
+	}
+}
+
+// openAuditNetlink joins the audit multicast group. Unlike the unicast
+// audit socket this does not compete with auditd.
+func openAuditNetlink() (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_AUDIT)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open audit netlink socket: %w", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: auditNetlinkGroup}); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to join audit multicast group (requires CAP_AUDIT_READ and kernel 3.16+): %w", err)
+	}
+
+	// Wake up periodically so Stop is noticed
+	timeout := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to set audit socket timeout: %w", err)
+	}
+
+	return fd, nil
+}
+
+// readNetlink reads records from the audit multicast group
+func (c *AuditdCollector) readNetlink(fd int) {
+	defer c.wg.Done()
+	defer syscall.Close(fd)
+
+	buffer := make([]byte, 64*1024)
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		default:
+		}
+
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			if err == syscall.ENOBUFS {
+				log.Println("Warning: audit netlink socket overrun, records were lost")
+				continue
+			}
+			log.Printf("Error reading audit netlink socket: %v", err)
+			return
+		}
+
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			continue
+		}
+		for _, message := range messages {
+			record := auditRawRecord{
+				Type: auditTypeName(int(message.Header.Type)),
+				Text: string(message.Data),
+			}
+			if !c.deliver(record) {
+				return
+			}
+		}
+	}
+}
+
+// readSocket reads records from the auditd af_unix plugin, reconnecting
+// when auditd restarts
+func (c *AuditdCollector) readSocket() {
+	defer c.wg.Done()
+
+	for {
+		if err := c.readSocketOnce(); err != nil {
+			log.Printf("Error reading audit socket: %v", err)
+		}
+
+		select {
+		case <-c.stopChan:
+			return
+		case <-time.After(auditReconnectDelay):
+		}
+	}
+}
+
+// readSocketOnce reads "type=NAME msg=audit(...): ..." lines until the
+// socket closes
+func (c *AuditdCollector) readSocketOnce() error {
+	conn, err := net.Dial("unix", hostPath(c.config.SocketPath))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	select {
+	case <-c.stopChan:
+		c.mu.Unlock()
+		conn.Close()
+		return nil
+	default:
+	}
+	c.conn = conn
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		typeAt := strings.Index(line, "type=")
+		msgAt := strings.Index(line, " msg=")
+		if typeAt < 0 || msgAt < typeAt {
+			continue
+		}
+		record := auditRawRecord{
+			Type: line[typeAt+len("type=") : msgAt],
+			Text: line[msgAt+len(" msg="):],
+		}
+		if !c.deliver(record) {
+			return nil
+		}
+	}
+
+	select {
+	case <-c.stopChan:
+		return nil
+	default:
+		return scanner.Err()
+	}
+}
+
+// processEvent normalizes a complete audit event and queues it
+func (c *AuditdCollector) processEvent(auditEvent *auditEvent) {
+	event := c.newEvent(auditEvent)
+	if event == nil {
+		return
+	}
+
+	c.eventQueue.Push(event)
+}
+
+// newEvent converts an audit event to a normalized event, or returns nil
+// when it is filtered out
+func (c *AuditdCollector) newEvent(auditEvent *auditEvent) *Event {
+	first := auditEvent.Records[0]
+	fields := first.Fields
+	syscallRecord := auditEvent.record("SYSCALL")
+	if syscallRecord != nil {
+		fields = syscallRecord.Fields
+	}
+
+	// Don't report the agent's own file and process activity
+	if fields["pid"] == strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+
+	key := fields["key"]
+	if len(c.keys) > 0 && !c.matchesKey(key) {
+		return nil
+	}
+
+	event := &Event{
+		AgentID:     c.agentID,
+		Computer:    c.hostname,
+		SourceType:  AuditdSourceType,
+		EventCode:   auditTypeNumber(first.Type),
+		EventTime:   auditEvent.Time,
+		RecordID:    auditEvent.Serial,
+		Channel:     AuditdChannel,
+		Provider:    AuditdProvider,
+		Severity:    1,
+		ProcessName: fields["comm"],
+		ProcessPath: fields["exe"],
+		EventData: map[string]string{
+			"audit_type": first.Type,
+		},
+		CollectedAt: time.Now(),
+	}
+	if key != "" {
+		event.EventData["key"] = strings.ReplaceAll(key, "\x01", ",")
+	}
+	for _, field := range []string{"ses", "tty", "success", "exit", "res", "terminal", "addr"} {
+		if value := fields[field]; value != "" {
+			event.EventData[field] = value
+		}
+	}
+	c.setSubject(event, fields)
+
+	if pid, err := strconv.Atoi(fields["pid"]); err == nil {
+		event.ProcessID = pid
+	}
+	if ppid, err := strconv.Atoi(fields["ppid"]); err == nil {
+		event.ParentProcessID = ppid
+		if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", ppid)); err == nil {
+			event.ParentProcessName = strings.TrimSpace(string(comm))
+		}
+	}
+
+	switch {
+	case syscallRecord != nil:
+		c.describeSyscall(event, auditEvent, fields)
+	case first.Type == "USER_CMD":
+		event.EventCode = AuditEventPrivilegeUse
+		event.Severity = 2
+		event.ProcessCommandLine = fields["cmd"]
+		event.Message = fmt.Sprintf("%s ran %q with sudo", event.SubjectUser, fields["cmd"])
+		if cwd := fields["cwd"]; cwd != "" {
+			event.EventData["cwd"] = cwd
+		}
+	default:
+		event.Message = auditTypeList(auditEvent)
+		if strings.HasPrefix(first.Type, "ANOM_") {
+			event.Severity = 4
+		} else if first.Type == "AVC" || fields["res"] == "failed" || fields["res"] == "0" {
+			event.Severity = 3
+		}
+	}
+
+	return event
+}
+
+// describeSyscall fills in a syscall event as a process, file or privilege
+// event depending on the syscall
+func (c *AuditdCollector) describeSyscall(event *Event, auditEvent *auditEvent, fields map[string]string) {
+	name := fields["syscall"]
+	if number, err := strconv.Atoi(name); err == nil {
+		if syscallName, ok := auditSyscalls[strings.ToLower(fields["arch"])][number]; ok {
+			name = syscallName
+		}
+	}
+	event.EventData["syscall"] = name
+	failed := fields["success"] == "no"
+
+	switch name {
+	case "execve", "execveat":
+		event.EventCode = AuditEventProcessCreate
+		event.ProcessCommandLine = auditCommandLine(auditEvent)
+		event.Message = fmt.Sprintf("Process created: %s", event.ProcessPath)
+		if event.TargetUser != "" {
+			event.Severity = 2 // setuid binary
+		}
+
+	case "open", "openat", "creat", "truncate", "ftruncate", "unlink", "unlinkat",
+		"rename", "renameat", "renameat2", "mkdir", "mkdirat", "rmdir",
+		"link", "linkat", "symlink", "symlinkat",
+		"chmod", "fchmod", "fchmodat", "chown", "fchown", "lchown", "fchownat":
+		event.EventCode = AuditEventFileAccess
+		event.ObjectType = "File"
+		event.AccessMask = auditFileAccess(name, fields)
+		event.FilePath, event.EventData["target_path"] = auditPaths(auditEvent)
+		if event.EventData["target_path"] == "" {
+			delete(event.EventData, "target_path")
+		}
+		event.Message = fmt.Sprintf("File %s: %s", event.AccessMask, event.FilePath)
+		if event.AccessMask == "delete" || event.AccessMask == "permissions" || event.AccessMask == "owner" {
+			event.Severity = 2
+		}
+
+	case "setuid", "setgid", "setreuid", "setregid", "setresuid", "setresgid":
+		event.EventCode = AuditEventPrivilegeUse
+		event.Message = fmt.Sprintf("%s called %s (uid=%s euid=%s)", event.ProcessName, name, fields["uid"], fields["euid"])
+		event.Severity = 2
+
+	default:
+		event.Message = auditTypeList(auditEvent)
+	}
+
+	if failed {
+		event.FailureReason = fields["exit"]
+		event.Message += " (failed)"
+		if event.Severity < 2 {
+			event.Severity = 2
+		}
+	}
+}
+
+// setSubject sets the acting user: the login user (auid) survives su and
+// sudo, so it is preferred over the real uid. A differing effective uid is
+// the target user.
+func (c *AuditdCollector) setSubject(event *Event, fields map[string]string) {
+	uid := fields["uid"]
+	if auid := fields["auid"]; auid != "" && auid != auditUnset {
+		event.SubjectUser = c.userNames.lookup(auid)
+	} else {
+		event.SubjectUser = c.userNames.lookup(uid)
+	}
+	if ses := fields["ses"]; ses != auditUnset {
+		event.SubjectLogonID = ses
+	}
+
+	if euid := fields["euid"]; euid != "" && euid != uid {
+		event.TargetUser = c.userNames.lookup(euid)
+	}
+}
+
+// matchesKey reports whether any of an event's rule keys is configured.
+// Events matching several rules carry the keys separated by \x01.
+func (c *AuditdCollector) matchesKey(key string) bool {
+	for _, k := range strings.Split(key, "\x01") {
+		if c.keys[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// auditCommandLine rebuilds the command line from the EXECVE record,
+// falling back to PROCTITLE. Long arguments are split into aN[i] chunks.
+func auditCommandLine(auditEvent *auditEvent) string {
+	if execve := auditEvent.record("EXECVE"); execve != nil {
+		argc, _ := strconv.Atoi(execve.Fields["argc"])
+		args := make([]string, 0, argc)
+		for i := 0; i < argc; i++ {
+			arg, ok := execve.Fields[fmt.Sprintf("a%d", i)]
+			if !ok {
+				var chunks strings.Builder
+				for j := 0; ; j++ {
+					chunk, ok := execve.Fields[fmt.Sprintf("a%d[%d]", i, j)]
+					if !ok {
+						break
+					}
+					chunks.WriteString(chunk)
+				}
+				arg = chunks.String()
+			}
+			args = append(args, arg)
+		}
+		if len(args) > 0 {
+			return strings.Join(args, " ")
+		}
+	}
+
+	if proctitle := auditEvent.record("PROCTITLE"); proctitle != nil {
+		return strings.ReplaceAll(proctitle.Fields["proctitle"], "\x00", " ")
+	}
+	return ""
+}
+
+// auditPaths returns the file a syscall acted on and, for renames and
+// links, the second path. Parent directory records are skipped and
+// relative names are resolved against the CWD record.
+func auditPaths(auditEvent *auditEvent) (string, string) {
+	var cwd string
+	if record := auditEvent.record("CWD"); record != nil {
+		cwd = record.Fields["cwd"]
+	}
+
+	var paths []string
+	for _, record := range auditEvent.Records {
+		if record.Type != "PATH" || record.Fields["nametype"] == "PARENT" {
+			continue
+		}
+		name := record.Fields["name"]
+		if name == "" {
+			continue
+		}
+		if !path.IsAbs(name) && cwd != "" {
+			name = path.Join(cwd, name)
+		}
+		paths = append(paths, name)
+	}
+
+	switch len(paths) {
+	case 0:
+		return "", ""
+	case 1:
+		return paths[0], ""
+	default:
+		return paths[0], paths[1]
+	}
+}
+
+// auditFileAccess describes what a file syscall did
+func auditFileAccess(name string, fields map[string]string) string {
+	switch name {
+	case "open", "openat":
+		// open(path, flags), openat(dirfd, path, flags); arguments are hex
+		flags := fields["a1"]
+		if name == "openat" {
+			flags = fields["a2"]
+		}
+		if value, err := strconv.ParseUint(flags, 16, 64); err == nil && value&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+			return "write"
+		}
+		return "read"
+	case "creat", "truncate", "ftruncate":
+		return "write"
+	case "unlink", "unlinkat", "rmdir":
+		return "delete"
+	case "rename", "renameat", "renameat2":
+		return "rename"
+	case "chmod", "fchmod", "fchmodat":
+		return "permissions"
+	case "chown", "fchown", "lchown", "fchownat":
+		return "owner"
+	default:
+		return "create"
+	}
+}
+
+// auditTypeList describes an event by its record types
+func auditTypeList(auditEvent *auditEvent) string {
+	types := make([]string, 0, len(auditEvent.Records))
+	for _, record := range auditEvent.Records {
+		types = append(types, record.Type)
+	}
+	return "Audit event: " + strings.Join(types, ", ")
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const AuditdSourceType = "auditd"
+
+// AuditdCollector collects Linux audit events (Linux only)
+type AuditdCollector struct{}
+
+// NewAuditdCollector fails outside Linux; there is no audit subsystem
+func NewAuditdCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*AuditdCollector, error) {
+	return nil, fmt.Errorf("auditd collection is only supported on Linux")
+}
+
+// Start does nothing
+func (c *AuditdCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *AuditdCollector) Stop() {}
@@ -0,0 +1,295 @@
+//go:build linux
+
+package collector
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditTypes names the audit record types the collector understands
+// (linux/audit.h). Other types are reported as UNKNOWN[n], like ausearch.
+var auditTypes = map[int]string{
+	1100: "USER_AUTH",
+	1101: "USER_ACCT",
+	1103: "CRED_ACQ",
+	1104: "CRED_DISP",
+	1105: "USER_START",
+	1106: "USER_END",
+	1110: "CRED_REFR",
+	1112: "USER_LOGIN",
+	1113: "USER_LOGOUT",
+	1123: "USER_CMD",
+	1130: "SERVICE_START",
+	1131: "SERVICE_STOP",
+	1300: "SYSCALL",
+	1302: "PATH",
+	1305: "CONFIG_CHANGE",
+	1306: "SOCKADDR",
+	1307: "CWD",
+	1309: "EXECVE",
+	1320: "EOE",
+	1326: "SECCOMP",
+	1327: "PROCTITLE",
+	1400: "AVC",
+	1700: "ANOM_PROMISCUOUS",
+	1701: "ANOM_ABEND",
+}
+
+// auditTypeNumbers is the reverse of auditTypes, for the audisp socket
+// which sends type names
+var auditTypeNumbers = func() map[string]int {
+	numbers := make(map[string]int, len(auditTypes))
+	for number, name := range auditTypes {
+		numbers[name] = number
+	}
+	return numbers
+}()
+
+// Audit architectures (AUDIT_ARCH_*) with syscall tables below
+const (
+	auditArchX86_64  = "c000003e"
+	auditArchAArch64 = "c00000b7"
+)
+
+// auditSyscalls names the syscalls the collector normalizes, per
+// architecture. Others are reported by number.
+var auditSyscalls = map[string]map[int]string{
+	auditArchX86_64: {
+		2: "open", 59: "execve", 76: "truncate", 77: "ftruncate", 82: "rename",
+		83: "mkdir", 84: "rmdir", 85: "creat", 86: "link", 87: "unlink",
+		88: "symlink", 90: "chmod", 91: "fchmod", 92: "chown", 93: "fchown",
+		94: "lchown", 105: "setuid", 106: "setgid", 113: "setreuid", 114: "setregid",
+		117: "setresuid", 119: "setresgid", 257: "openat", 260: "fchownat",
+		263: "unlinkat", 264: "renameat", 268: "fchmodat", 316: "renameat2",
+		322: "execveat",
+	},
+	auditArchAArch64: {
+		34: "mkdirat", 35: "unlinkat", 36: "symlinkat", 37: "linkat", 38: "renameat",
+		45: "truncate", 46: "ftruncate", 52: "fchmod", 53: "fchmodat", 54: "fchownat",
+		55: "fchown", 56: "openat", 143: "setregid", 144: "setgid", 145: "setreuid",
+		146: "setuid", 147: "setresuid", 149: "setresgid", 221: "execve",
+		276: "renameat2", 281: "execveat",
+	},
+}
+
+// Fields audit hex-encodes when the value contains spaces, quotes or
+// control characters; quoted values are never encoded
+var auditEncodedFields = map[string]bool{
+	"name": true, "exe": true, "comm": true, "cwd": true, "proctitle": true,
+	"cmd": true, "key": true, "acct": true, "data": true, "path": true,
+}
+
+// Unset audit user and session IDs ((uid_t)-1)
+const auditUnset = "4294967295"
+
+// auditRecord is one record of an audit event
+type auditRecord struct {
+	Type   string
+	Fields map[string]string
+}
+
+// auditEvent is the set of records the kernel emitted for one event,
+// identified by the serial number in audit(time:serial)
+type auditEvent struct {
+	Serial   int64
+	Time     time.Time
+	Records  []auditRecord
+	received time.Time
+}
+
+// record returns the first record of a type, or nil
+func (e *auditEvent) record(recordType string) *auditRecord {
+	for i := range e.Records {
+		if e.Records[i].Type == recordType {
+			return &e.Records[i]
+		}
+	}
+	return nil
+}
+
+// auditTypeName names a numeric record type
+func auditTypeName(recordType int) string {
+	if name, ok := auditTypes[recordType]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN[%d]", recordType)
+}
+
+// auditTypeNumber returns the number of a record type name
+func auditTypeNumber(recordType string) int {
+	if number, ok := auditTypeNumbers[recordType]; ok {
+		return number
+	}
+	var number int
+	fmt.Sscanf(recordType, "UNKNOWN[%d]", &number)
+	return number
+}
+
+// auditStandalone reports whether a record type is a complete event on its
+// own. User space messages (1100-1299, 2100-2999) never get an EOE record.
+func auditStandalone(recordType string) bool {
+	number := auditTypeNumber(recordType)
+	return (number >= 1100 && number < 1300) || (number >= 2100 && number < 3000)
+}
+
+// parseAuditMessage parses "audit(1700000000.123:456): key=value ..."
+func parseAuditMessage(recordType, text string) (time.Time, int64, map[string]string, error) {
+	text = strings.TrimRight(text, "\x00\n")
+
+	if !strings.HasPrefix(text, "audit(") {
+		return time.Time{}, 0, nil, fmt.Errorf("missing audit header")
+	}
+	end := strings.Index(text, "):")
+	if end < 0 {
+		return time.Time{}, 0, nil, fmt.Errorf("malformed audit header")
+	}
+
+	stamp, serialText, ok := strings.Cut(text[len("audit("):end], ":")
+	if !ok {
+		return time.Time{}, 0, nil, fmt.Errorf("malformed audit header")
+	}
+	serial, err := strconv.ParseInt(serialText, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("malformed audit serial: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(stamp, 64)
+	if err != nil {
+		return time.Time{}, 0, nil, fmt.Errorf("malformed audit timestamp: %w", err)
+	}
+	eventTime := time.UnixMilli(int64(seconds * 1000))
+
+	return eventTime, serial, parseAuditFields(recordType, text[end+2:]), nil
+}
+
+// parseAuditFields splits key=value pairs. User space records carry their
+// own fields in msg='...', which are merged in.
+func parseAuditFields(recordType, text string) map[string]string {
+	fields := make(map[string]string)
+
+	for {
+		text = strings.TrimLeft(text, " ")
+		eq := strings.IndexByte(text, '=')
+		if eq <= 0 {
+			break
+		}
+		key := text[:eq]
+		text = text[eq+1:]
+
+		var value string
+		quoted := len(text) > 0 && (text[0] == '"' || text[0] == '\'')
+		if quoted {
+			closing := strings.IndexByte(text[1:], text[0])
+			if closing < 0 {
+				value, text = text[1:], ""
+			} else {
+				value, text = text[1:closing+1], text[closing+2:]
+			}
+		} else if space := strings.IndexByte(text, ' '); space >= 0 {
+			value, text = text[:space], text[space:]
+		} else {
+			value, text = text, ""
+		}
+
+		switch {
+		case key == "msg" && quoted:
+			for k, v := range parseAuditFields(recordType, value) {
+				fields[k] = v
+			}
+			continue
+		case !quoted && value == "(null)":
+			value = ""
+		case !quoted && auditEncodedField(recordType, key):
+			value = auditDecode(value)
+		}
+		fields[key] = value
+	}
+
+	return fields
+}
+
+// auditEncodedField reports whether a field may be hex-encoded, including
+// the EXECVE arguments a0, a1, ... and their chunks a0[0], a0[1], ...
+// (SYSCALL a0-a3 are plain hex numbers)
+func auditEncodedField(recordType, key string) bool {
+	if auditEncodedFields[key] {
+		return true
+	}
+	if recordType != "EXECVE" || len(key) < 2 || key[0] != 'a' {
+		return false
+	}
+	index, _, _ := strings.Cut(key[1:], "[")
+	_, err := strconv.Atoi(index)
+	return err == nil
+}
+
+// auditDecode decodes a hex-encoded value; values that are not hex are
+// returned as they are
+func auditDecode(value string) string {
+	if len(value) == 0 || len(value)%2 != 0 {
+		return value
+	}
+	for _, r := range value {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'F') {
+			return value
+		}
+	}
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+// auditAssembler groups records by serial number into events. An event is
+// complete at its EOE record, or when no more records arrive for it.
+type auditAssembler struct {
+	pending map[int64]*auditEvent
+	emit    func(*auditEvent)
+}
+
+// newAuditAssembler creates an assembler that passes complete events to emit
+func newAuditAssembler(emit func(*auditEvent)) *auditAssembler {
+	return &auditAssembler{
+		pending: make(map[int64]*auditEvent),
+		emit:    emit,
+	}
+}
+
+// add adds a record to its event
+func (a *auditAssembler) add(recordType string, eventTime time.Time, serial int64, fields map[string]string) {
+	event, ok := a.pending[serial]
+
+	if recordType == "EOE" {
+		if ok {
+			delete(a.pending, serial)
+			a.emit(event)
+		}
+		return
+	}
+
+	if !ok {
+		event = &auditEvent{Serial: serial, Time: eventTime}
+	}
+	event.Records = append(event.Records, auditRecord{Type: recordType, Fields: fields})
+	event.received = time.Now()
+
+	if !ok && auditStandalone(recordType) {
+		a.emit(event)
+		return
+	}
+	a.pending[serial] = event
+}
+
+// flush emits events that have not received a record for maxAge
+func (a *auditAssembler) flush(maxAge time.Duration) {
+	for serial, event := range a.pending {
+		if time.Since(event.received) >= maxAge {
+			delete(a.pending, serial)
+			a.emit(event)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Agent health events are sent through the normal event pipeline. An
+// unexpected reboot or an agent that stopped without shutting down often
+// correlates with exploitation (crashes) or tampering (killed service), and
+// full disks are a leading cause of stopped logging. Dropped events mean the
+// queue is too small for the event rate and the SIEM has gaps, as does a
+// period of degraded collection. Broken time synchronization precedes
+// Kerberos failures and corrupts event timelines.
+const (
+	AgentHealthSourceType = "SIEM Agent"
+	AgentHealthChannel    = "SIEM-Agent/Health"
+	AgentHealthProvider   = "SIEM-Agent"
+
+	HealthEventUnexpectedReboot   = 9101 // Host rebooted while the agent was running (power loss, crash)
+	HealthEventAgentTerminated    = 9102 // Agent stopped without shutting down, host did not reboot
+	HealthEventLowDiskSpace       = 9103 // Free space on a fixed volume fell below the threshold
+	HealthEventDiskSpaceOK        = 9104 // Free space recovered
+	HealthEventEventsDropped      = 9105 // Events dropped because the event queue was full
+	HealthEventCollectionDegraded = 9106 // Collection was cut to high-severity events while the server was unreachable
+	HealthEventTimeSyncStopped    = 9107 // Time service stopped or not synchronized to an external source
+	HealthEventClockOffset        = 9108 // Clock offset from the time source exceeds the threshold
+	HealthEventTimeSyncOK         = 9109 // Time synchronization or clock offset recovered
+)
+
+// Boot times derived from the tick count drift with clock adjustments;
+// differences below this are the same boot
+const bootTimeTolerance = time.Minute
+
+// bootState is persisted across agent runs
+type bootState struct {
+	BootTime time.Time `json:"boot_time"`
+	LastSeen time.Time `json:"last_seen"`
+	Running  bool      `json:"running"` // cleared on a clean stop
+}
+
+// BootTracker detects unclean shutdowns by recording the boot time and
+// whether the agent is running. A clean stop (including the stop the
+// service manager sends at shutdown) clears the running flag.
+type BootTracker struct {
+	agentID   string
+	hostname  string
+	statePath string
+
+	mutex sync.Mutex
+	state bootState
+}
+
+// NewBootTracker creates a boot tracker
+func NewBootTracker(agentID, hostname string) *BootTracker {
+	statePath := filepath.Join(os.Getenv("ProgramData"), "SIEM", "boot_state.json")
+	if runtime.GOOS != "windows" {
+		statePath = "/var/lib/siem-agent/boot_state.json"
+	}
+
+	return &BootTracker{
+		agentID:   agentID,
+		hostname:  hostname,
+		statePath: statePath,
+	}
+}
+
+// Start compares the current boot with the previous run and returns health
+// events for an unexpected reboot or termination, then records this run
+func (t *BootTracker) Start(bootTime time.Time) []*Event {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var events []*Event
+
+	var previous bootState
+	if data, err := os.ReadFile(t.statePath); err == nil && json.Unmarshal(data, &previous) == nil && previous.Running {
+		rebooted := bootTime.Sub(previous.BootTime) > bootTimeTolerance
+		fields := map[string]string{
+			"previous_boot_time": previous.BootTime.Format(time.RFC3339),
+			"boot_time":          bootTime.Format(time.RFC3339),
+			"last_seen":          previous.LastSeen.Format(time.RFC3339),
+		}
+
+		if rebooted {
+			uptime := previous.LastSeen.Sub(previous.BootTime).Round(time.Second)
+			fields["previous_uptime"] = fmt.Sprint(int64(uptime.Seconds()))
+			events = append(events, newHealthEvent(t.agentID, t.hostname, HealthEventUnexpectedReboot, 4,
+				fmt.Sprintf("Unexpected reboot: the host restarted without a clean shutdown (last seen %s, previous uptime %s)",
+					previous.LastSeen.Format(time.RFC3339), uptime), fields))
+			log.Printf("Warning: unexpected reboot detected (last seen %s)", previous.LastSeen.Format(time.RFC3339))
+		} else {
+			events = append(events, newHealthEvent(t.agentID, t.hostname, HealthEventAgentTerminated, 4,
+				fmt.Sprintf("SIEM agent was terminated without stopping (last seen %s)", previous.LastSeen.Format(time.RFC3339)),
+				fields))
+			log.Printf("Warning: agent was terminated without stopping (last seen %s)", previous.LastSeen.Format(time.RFC3339))
+		}
+	}
+
+	t.state = bootState{BootTime: bootTime, LastSeen: time.Now(), Running: true}
+	if err := t.save(); err != nil {
+		log.Printf("Warning: Failed to save boot state: %v", err)
+	}
+
+	return events
+}
+
+// Touch records that the agent is alive
+func (t *BootTracker) Touch() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state.LastSeen = time.Now()
+	t.save()
+}
+
+// Stop records a clean stop
+func (t *BootTracker) Stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state.LastSeen = time.Now()
+	t.state.Running = false
+	if err := t.save(); err != nil {
+		log.Printf("Warning: Failed to save boot state: %v", err)
+	}
+}
+
+// save writes the boot state
+func (t *BootTracker) save() error {
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.statePath), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(t.statePath, data, 0600)
+}
+
+// newHealthEvent builds an agent health event
+func newHealthEvent(agentID, hostname string, code, severity int, message string, data map[string]string) *Event {
+	return &Event{
+		AgentID:     agentID,
+		Computer:    hostname,
+		SourceType:  AgentHealthSourceType,
+		EventCode:   code,
+		EventTime:   time.Now(),
+		Channel:     AgentHealthChannel,
+		Provider:    AgentHealthProvider,
+		Severity:    severity,
+		Message:     message,
+		EventData:   data,
+		CollectedAt: time.Now(),
+	}
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// Consecutive failed sends before collection may be degraded
+	breakerFailures = 3
+
+	// Share of the queue's capacity, the spool when there is one, held
+	// when collection is degraded: the rest is left for high-severity
+	// events until the server is back
+	breakerBacklog = 0.5
+
+	// While degraded only events at or above this severity (4 = error/high)
+	// are queued
+	degradedMinSeverity = 4
+)
+
+// CollectionBreaker cuts collection down to high-severity events when the
+// server is unreachable and unsent events have filled half the queue, spool
+// included: otherwise the queue ends up dropping whatever arrives, routine
+// and critical events alike. Full collection is restored once a send
+// succeeds, and the degraded period is then reported as a health event.
+type CollectionBreaker struct {
+	agentID  string
+	hostname string
+	queue    *EventQueue
+	failures int       // consecutive failed sends
+	since    time.Time // zero while collection is complete
+}
+
+// NewCollectionBreaker creates a collection breaker for the send queue
+func NewCollectionBreaker(agentID, hostname string, queue *EventQueue) *CollectionBreaker {
+	return &CollectionBreaker{
+		agentID:  agentID,
+		hostname: hostname,
+		queue:    queue,
+	}
+}
+
+// SendFailed records a failed send and degrades collection once the
+// failures continue while the backlog of the queue grows past
+// breakerBacklog, or it is full
+func (b *CollectionBreaker) SendFailed() {
+	b.failures++
+	if !b.since.IsZero() || b.failures < breakerFailures {
+		return
+	}
+	backlog := b.queue.Backlog()
+	if backlog < breakerBacklog && !b.queue.Exhausted() {
+		return
+	}
+
+	b.since = time.Now()
+	b.queue.Degrade(degradedMinSeverity)
+	log.Printf("Warning: SIEM server unreachable and event queue %.0f%% full, collecting only events of severity %d and above",
+		backlog*100, degradedMinSeverity)
+}
+
+// SendSucceeded restores full collection after a degraded period and
+// returns the event reporting it
+func (b *CollectionBreaker) SendSucceeded() []*Event {
+	b.failures = 0
+	if b.since.IsZero() {
+		return nil
+	}
+
+	shed := b.queue.Restore()
+	duration := time.Since(b.since).Round(time.Second)
+	since := b.since
+	b.since = time.Time{}
+
+	log.Printf("SIEM server reachable again, full collection restored after %s (%d events shed)", duration, shed)
+	return []*Event{newHealthEvent(b.agentID, b.hostname, HealthEventCollectionDegraded, 3,
+		fmt.Sprintf("Only events of severity %d and above were collected for %s while the SIEM server was unreachable (%d events shed)",
+			degradedMinSeverity, duration, shed),
+		map[string]string{
+			"degraded_at":  since.Format(time.RFC3339),
+			"restored_at":  time.Now().Format(time.RFC3339),
+			"duration":     strconv.FormatInt(int64(duration.Seconds()), 10),
+			"min_severity": strconv.Itoa(degradedMinSeverity),
+			"events_shed":  strconv.FormatUint(shed, 10),
+		})}
+}
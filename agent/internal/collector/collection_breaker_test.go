@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/siem/agent/internal/config"
+)
+
+func TestCollectionBreaker(t *testing.T) {
+	tests := []struct {
+		name         string
+		spool        bool
+		push         int // events of 110 KB with the spool, small otherwise
+		failures     int
+		wantDegraded bool
+	}{
+		{name: "memory backlog under half", push: 4, failures: 3},
+		{name: "memory backlog at half", push: 5, failures: 3, wantDegraded: true},
+		{name: "memory full before enough failures", push: 10, failures: 2},
+		{name: "no backlog", failures: 5},
+		{name: "spool backlog under half", spool: true, push: 5, failures: 3},
+		{name: "spool backlog over half", spool: true, push: 6, failures: 3, wantDegraded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A file where the spool directory should be leaves the queue
+			// memory only
+			cfg := &config.QueueConfig{MemoryLimitMB: 64, SpoolDir: filepath.Join(t.TempDir(), "spool"), SpoolFileMB: 1, SpoolMaxMB: 1}
+			maxEvents, message := 1, strings.Repeat("x", 110*1024)
+			if !tt.spool {
+				if err := os.WriteFile(cfg.SpoolDir, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+				maxEvents, message = 10, ""
+			}
+			q := NewEventQueue(maxEvents, cfg)
+			defer q.Close()
+			for i := 0; i < tt.push; i++ {
+				q.Push(&Event{Channel: "Security", Message: message})
+			}
+
+			b := NewCollectionBreaker("agent", "host", q)
+			for i := 0; i < tt.failures; i++ {
+				b.SendFailed()
+			}
+
+			if degraded := !b.since.IsZero(); degraded != tt.wantDegraded {
+				t.Errorf("degraded = %v at %.2f backlog, want %v", degraded, q.Backlog(), tt.wantDegraded)
+			}
+
+			restored := b.SendSucceeded()
+			if (len(restored) == 1) != tt.wantDegraded {
+				t.Errorf("SendSucceeded returned %d health events", len(restored))
+			}
+		})
+	}
+}
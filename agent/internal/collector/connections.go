@@ -0,0 +1,233 @@
+//go:build linux
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const (
+	ConnectionsSourceType = "connections"
+	ConnectionsChannel    = "proc/net"
+	ConnectionsProvider   = "procfs"
+
+	// Sysmon network connection event code, so the same server rules
+	// apply to Linux hosts
+	ConnectionEventNetworkConnect = 3
+)
+
+// connectionKey identifies a connection across polls. The inode tells
+// apart a connection that was closed and reopened on the same ports.
+type connectionKey struct {
+	protocol string
+	local    string
+	remote   string
+	inode    uint64
+}
+
+// ConnectionCollector reports new network connections by polling the
+// /proc/net socket tables
+type ConnectionCollector struct {
+	config     *config.ConnectionsConfig
+	agentID    string
+	hostname   string
+	eventQueue *EventQueue
+	wg         sync.WaitGroup
+	stopChan   chan struct{}
+	userNames  uidNames
+
+	seen     map[connectionKey]bool
+	recordID int64
+}
+
+// NewConnectionCollector creates a new connection collector
+func NewConnectionCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*ConnectionCollector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	return &ConnectionCollector{
+		config:     &cfg.Connections,
+		agentID:    agentID,
+		hostname:   hostname,
+		eventQueue: eventQueue,
+		stopChan:   make(chan struct{}),
+	}, nil
+}
+
+// Start takes a baseline of open connections and begins polling. Only
+// connections opened after the baseline are reported.
+func (c *ConnectionCollector) Start() error {
+	sockets, err := readSockets()
+	if err != nil {
+		return err
+	}
+	c.seen = make(map[connectionKey]bool)
+	for _, socket := range sockets {
+		if c.reportable(socket) {
+			c.seen[newConnectionKey(socket)] = true
+		}
+	}
+
+	log.Printf("Starting connection collector (%d open connections, polling every %ds)", len(c.seen), c.config.Interval)
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop stops the collector
+func (c *ConnectionCollector) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+	log.Println("Connection collector stopped")
+}
+
+// run polls the socket tables until stopped
+func (c *ConnectionCollector) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(c.config.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.poll()
+		}
+	}
+}
+
+// poll reports connections that were not open at the previous poll
+func (c *ConnectionCollector) poll() {
+	sockets, err := readSockets()
+	if err != nil {
+		log.Printf("Warning: Failed to read socket tables: %v", err)
+		return
+	}
+
+	// Connections to a local listening port are inbound
+	listeners := make(map[string]bool)
+	for _, socket := range sockets {
+		if socket.listening() {
+			listeners[socket.Protocol+"/"+strconv.Itoa(socket.LocalPort)] = true
+		}
+	}
+
+	current := make(map[connectionKey]bool)
+	var opened []*socketEntry
+	for _, socket := range sockets {
+		if !c.reportable(socket) {
+			continue
+		}
+		key := newConnectionKey(socket)
+		current[key] = true
+		if !c.seen[key] {
+			opened = append(opened, socket)
+		}
+	}
+	c.seen = current
+
+	if len(opened) == 0 {
+		return
+	}
+
+	// Resolving owners walks every process's descriptors, so only do it
+	// when there is something to report
+	owners := socketOwners()
+	for _, socket := range opened {
+		initiated := !listeners[socket.Protocol+"/"+strconv.Itoa(socket.LocalPort)]
+		event := c.newEvent(socket, owners[socket.Inode], initiated)
+		if event == nil {
+			continue
+		}
+
+		c.eventQueue.Push(event)
+	}
+}
+
+// reportable reports whether a socket is a connection worth reporting:
+// an established or connecting TCP socket, or a connected UDP socket
+func (c *ConnectionCollector) reportable(socket *socketEntry) bool {
+	if socket.State != "ESTABLISHED" && (socket.Protocol != "tcp" || socket.State != "SYN_SENT") {
+		return false
+	}
+	if socket.RemotePort == 0 {
+		return false
+	}
+	return c.config.IncludeLoopback || !socket.loopback()
+}
+
+// newEvent converts a connection to a Sysmon-style network connection
+// event, or returns nil for the agent's own connections. As in Sysmon,
+// the source is the side that initiated the connection.
+func (c *ConnectionCollector) newEvent(socket *socketEntry, process *socketProcess, initiated bool) *Event {
+	if process != nil && process.PID == os.Getpid() {
+		return nil
+	}
+
+	sourceIP, sourcePort := socket.LocalIP, socket.LocalPort
+	destinationIP, destinationPort := socket.RemoteIP, socket.RemotePort
+	if !initiated {
+		sourceIP, sourcePort, destinationIP, destinationPort = destinationIP, destinationPort, sourceIP, sourcePort
+	}
+
+	c.recordID++
+	event := &Event{
+		AgentID:    c.agentID,
+		Computer:   c.hostname,
+		SourceType: ConnectionsSourceType,
+		EventCode:  ConnectionEventNetworkConnect,
+		EventTime:  time.Now(),
+		RecordID:   c.recordID,
+		Channel:    ConnectionsChannel,
+		Provider:   ConnectionsProvider,
+		Severity:   1,
+		EventData: map[string]string{
+			"User":              c.userNames.lookup(socket.UID),
+			"Protocol":          socket.Protocol,
+			"Initiated":         strconv.FormatBool(initiated),
+			"SourceIsIpv6":      strconv.FormatBool(sourceIP.To4() == nil),
+			"SourceIp":          sourceIP.String(),
+			"SourcePort":        strconv.Itoa(sourcePort),
+			"DestinationIsIpv6": strconv.FormatBool(destinationIP.To4() == nil),
+			"DestinationIp":     destinationIP.String(),
+			"DestinationPort":   strconv.Itoa(destinationPort),
+		},
+		CollectedAt: time.Now(),
+	}
+	if process != nil {
+		event.EventData["Image"] = process.Image
+		event.EventData["ProcessId"] = strconv.Itoa(process.PID)
+	}
+
+	parseSysmonNetworkConnect(event)
+
+	// The executable link is unreadable for kernel threads and, without
+	// CAP_SYS_PTRACE, for other users' processes
+	if event.ProcessName == "" && process != nil {
+		event.ProcessName = process.Name
+	}
+
+	return event
+}
+
+// newConnectionKey returns the key of a socket
+func newConnectionKey(socket *socketEntry) connectionKey {
+	return connectionKey{
+		protocol: socket.Protocol,
+		local:    formatEndpoint(socket.LocalIP, socket.LocalPort),
+		remote:   formatEndpoint(socket.RemoteIP, socket.RemotePort),
+		inode:    socket.Inode,
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const ConnectionsSourceType = "connections"
+
+// ConnectionCollector reports new network connections (Linux only)
+type ConnectionCollector struct{}
+
+// NewConnectionCollector fails outside Linux; Windows connections come
+// from Sysmon
+func NewConnectionCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*ConnectionCollector, error) {
+	return nil, fmt.Errorf("connection monitoring is only supported on Linux")
+}
+
+// Start does nothing
+func (c *ConnectionCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *ConnectionCollector) Stop() {}
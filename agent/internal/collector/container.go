@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The kubelet's container log links are rescanned at most this often when
+// an event comes from an unknown container
+const containerRescanInterval = 10 * time.Second
+
+var (
+	// containerIDPattern matches a runtime's container ID in a cgroup path:
+	// docker-<id>.scope, cri-containerd-<id>.scope, crio-<id>.scope or
+	// /kubepods/burstable/pod<uid>/<id>
+	containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+	// kubeLogLinkPattern matches the kubelet's links in /var/log/containers:
+	// <pod>_<namespace>_<container>-<id>.log. Pod and namespace names cannot
+	// contain underscores.
+	kubeLogLinkPattern = regexp.MustCompile(`^([^_]+)_([^_]+)_(.+)-([0-9a-f]{64})\.log$`)
+)
+
+// hostRoot is where the host's root filesystem is mounted. It is "/"
+// unless the agent runs in a container (container mode).
+var hostRoot = "/"
+
+// SetHostRoot sets where the host's root filesystem is mounted; host
+// files such as the journal and package databases are read below it
+func SetHostRoot(root string) {
+	hostRoot = root
+}
+
+// hostPath returns the path of a host file
+func hostPath(path string) string {
+	return filepath.Join(hostRoot, path)
+}
+
+// ContainerResolver tags events with the Kubernetes node and, for events
+// from containerized processes, the pod, namespace and container. The
+// agent needs the host's PID namespace to see the processes' cgroups.
+type ContainerResolver struct {
+	node string
+
+	mu         sync.Mutex
+	containers map[string]*ContainerInfo // by container ID
+	scanned    time.Time
+}
+
+// NewContainerResolver creates a resolver for events collected on node
+func NewContainerResolver(node string) *ContainerResolver {
+	return &ContainerResolver{
+		node:       node,
+		containers: make(map[string]*ContainerInfo),
+	}
+}
+
+// Tag sets the event's container metadata
+func (r *ContainerResolver) Tag(event *Event) {
+	info := &ContainerInfo{Node: r.node}
+
+	if event.ProcessID > 0 {
+		if id := processContainerID(event.ProcessID); id != "" {
+			info.ContainerID = id
+			if container := r.lookup(id); container != nil {
+				info.Namespace = container.Namespace
+				info.Pod = container.Pod
+				info.ContainerName = container.ContainerName
+			}
+		}
+	}
+
+	event.Container = info
+}
+
+// lookup returns the pod metadata of a container, rescanning the kubelet's
+// log links when the container is new
+func (r *ContainerResolver) lookup(id string) *ContainerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if container, ok := r.containers[id]; ok {
+		return container
+	}
+	if time.Since(r.scanned) < containerRescanInterval {
+		return nil
+	}
+	r.scanned = time.Now()
+
+	entries, err := os.ReadDir(hostPath("/var/log/containers"))
+	if err != nil {
+		return nil
+	}
+	containers := make(map[string]*ContainerInfo, len(entries))
+	for _, entry := range entries {
+		match := kubeLogLinkPattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		containers[match[4]] = &ContainerInfo{
+			Pod:           match[1],
+			Namespace:     match[2],
+			ContainerName: match[3],
+			ContainerID:   match[4],
+		}
+	}
+	r.containers = containers
+
+	return r.containers[id]
+}
+
+// processContainerID returns the ID of the container a process runs in,
+// or "" for host processes and processes that have exited
+func processContainerID(pid int) string {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// hierarchy-ID:controllers:path, one line per hierarchy (one in cgroup v2)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if ids := containerIDPattern.FindAllString(fields[2], -1); len(ids) > 0 {
+			return ids[len(ids)-1]
+		}
+	}
+	return ""
+}
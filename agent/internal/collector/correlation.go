@@ -0,0 +1,357 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const (
+	// maxCorrelationGroups bounds the open windows across all rules; new
+	// groups are not tracked while the limit is reached
+	maxCorrelationGroups = 10000
+
+	// maxCorrelationSeen bounds the values remembered per new_value rule;
+	// the set starts over when it is full
+	maxCorrelationSeen = 50000
+
+	// correlationPruneInterval is how often expired windows are dropped
+	correlationPruneInterval = time.Minute
+)
+
+// CorrelationStats reports local correlation in heartbeats
+type CorrelationStats struct {
+	Rules  int    `json:"rules"`
+	Groups int    `json:"groups"` // open windows
+	Alerts uint64 `json:"alerts"` // since the agent started
+}
+
+// correlationRule is a compiled config.CorrelationRule
+type correlationRule struct {
+	name     string
+	kind     string
+	severity int
+	match    sigmaMatch
+	then     sigmaMatch
+	groupBy  string
+	join     string
+	newValue string
+	count    int
+	window   time.Duration
+}
+
+// correlationGroup is the open window of one rule for one group or join
+// value. Only what the alert reports is kept, not the events themselves.
+type correlationGroup struct {
+	times      []time.Time // threshold: matching events in the window
+	first      time.Time
+	firstCode  int
+	firstImage string
+	quietUntil time.Time // threshold: no new alert for the group before this
+}
+
+// CorrelationEngine evaluates local stateful rules against events as they
+// are queued and raises one synthesized alert per detection, so small sites
+// get brute-force and sequence detections without shipping and correlating
+// every raw event on the server. Threshold rules count matching events per
+// group within a window; sequence rules fire when an event follows another
+// with the same join value within a window, optionally only for values of a
+// field the agent has not seen before. State is kept in memory only.
+type CorrelationEngine struct {
+	agentID  string
+	hostname string
+	rules    []*correlationRule
+
+	mutex     sync.Mutex
+	groups    map[string]*correlationGroup
+	seen      map[string]map[string]struct{} // new_value rule name -> values
+	alerts    uint64
+	lastPrune time.Time
+}
+
+// NewCorrelationEngine compiles the configured rules. Rules that do not
+// compile are logged and skipped.
+func NewCorrelationEngine(cfg *config.CorrelationConfig, agentID, hostname string) *CorrelationEngine {
+	e := &CorrelationEngine{
+		agentID:   agentID,
+		hostname:  hostname,
+		groups:    make(map[string]*correlationGroup),
+		seen:      make(map[string]map[string]struct{}),
+		lastPrune: time.Now(),
+	}
+
+	for _, rule := range cfg.Rules {
+		compiled, err := compileCorrelationRule(rule)
+		if err != nil {
+			log.Printf("Warning: Correlation rule %q rejected: %v", rule.Name, err)
+			continue
+		}
+		e.rules = append(e.rules, compiled)
+	}
+
+	log.Printf("Loaded %d correlation rules", len(e.rules))
+	return e
+}
+
+// compileCorrelationRule compiles the Sigma-style selections of a rule
+func compileCorrelationRule(rule config.CorrelationRule) (*correlationRule, error) {
+	compiled := &correlationRule{
+		name:     rule.Name,
+		kind:     rule.Type,
+		severity: rule.Severity,
+		groupBy:  rule.GroupBy,
+		join:     rule.Join,
+		newValue: rule.NewValue,
+		count:    rule.Count,
+		window:   time.Duration(rule.Window) * time.Second,
+	}
+	if rule.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(rule.Match) == 0 {
+		return nil, fmt.Errorf("match is required")
+	}
+
+	var err error
+	if compiled.match, err = compileSigmaSearch(rule.Match); err != nil {
+		return nil, fmt.Errorf("match: %w", err)
+	}
+
+	switch rule.Type {
+	case "threshold":
+	case "sequence":
+		if len(rule.Then) == 0 || rule.Join == "" {
+			return nil, fmt.Errorf("sequence rules need then and join")
+		}
+		if compiled.then, err = compileSigmaSearch(rule.Then); err != nil {
+			return nil, fmt.Errorf("then: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+	return compiled, nil
+}
+
+// Inspect returns an alert for every rule the event completes. The agent's
+// own health and alert events are not evaluated.
+func (e *CorrelationEngine) Inspect(event *Event) []*Event {
+	if event.SourceType == AgentHealthSourceType || event.SourceType == DetectionSourceType {
+		return nil
+	}
+
+	now := event.EventTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if time.Since(e.lastPrune) >= correlationPruneInterval {
+		e.prune(now)
+	}
+
+	var alerts []*Event
+	for _, rule := range e.rules {
+		var alert *Event
+		switch rule.kind {
+		case "threshold":
+			alert = e.threshold(rule, event, now)
+		case "sequence":
+			alert = e.sequence(rule, event, now)
+		}
+		if alert != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	e.alerts += uint64(len(alerts))
+	return alerts
+}
+
+// threshold counts a matching event and alerts once the group reaches the
+// rule's count within the window. The group is then quiet for one window,
+// so a sustained attack raises one alert per window, not one per event.
+func (e *CorrelationEngine) threshold(rule *correlationRule, event *Event, now time.Time) *Event {
+	if !rule.match(event) {
+		return nil
+	}
+
+	value := ""
+	if rule.groupBy != "" {
+		var ok bool
+		if value, ok = correlationValue(event, rule.groupBy); !ok {
+			return nil
+		}
+	}
+
+	group := e.group(rule, value, event, now)
+	if group == nil || now.Before(group.quietUntil) {
+		return nil
+	}
+
+	cutoff := now.Add(-rule.window)
+	kept := group.times[:0]
+	for _, t := range group.times {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	group.times = append(kept, now)
+	if len(group.times) < rule.count {
+		return nil
+	}
+
+	first := group.times[0]
+	group.times = nil
+	group.quietUntil = now.Add(rule.window)
+	return e.alert(rule, event, fmt.Sprintf("Correlation rule matched: %s (%d events within %v)", rule.name, rule.count, rule.window),
+		map[string]string{
+			"group_by":    rule.groupBy,
+			"group_value": value,
+			"event_count": strconv.Itoa(rule.count),
+			"first_seen":  first.UTC().Format(time.RFC3339),
+		})
+}
+
+// sequence opens a window on a match event and alerts when a then event
+// with the same join value follows within it
+func (e *CorrelationEngine) sequence(rule *correlationRule, event *Event, now time.Time) *Event {
+	var alert *Event
+
+	if rule.then(event) {
+		// Every follow-up event is remembered, so "new" means new to this
+		// host, not just to the processes the rule watches
+		fresh := e.isNew(rule, event)
+		if value, ok := correlationValue(event, rule.join); ok && fresh {
+			key := rule.name + "\x00" + value
+			group, open := e.groups[key]
+			if open && now.Sub(group.first) <= rule.window {
+				delete(e.groups, key)
+				alert = e.alert(rule, event, fmt.Sprintf("Correlation rule matched: %s", rule.name),
+					map[string]string{
+						"join_field":   rule.join,
+						"join_value":   value,
+						"first_code":   strconv.Itoa(group.firstCode),
+						"first_image":  group.firstImage,
+						"first_seen":   group.first.UTC().Format(time.RFC3339),
+						"new_field":    rule.newValue,
+						"elapsed_secs": strconv.Itoa(int(now.Sub(group.first).Seconds())),
+					})
+			}
+		}
+	}
+
+	// An event can match both steps; it opens a new window after being
+	// checked as the follow-up
+	if alert == nil && rule.match(event) {
+		if value, ok := correlationValue(event, rule.join); ok {
+			if group := e.group(rule, value, event, now); group != nil && now.Sub(group.first) > rule.window {
+				e.groups[rule.name+"\x00"+value] = newCorrelationGroup(event, now)
+			}
+		}
+	}
+	return alert
+}
+
+// isNew reports whether the event's new_value field holds a value the rule
+// has not seen, and remembers it. Rules without new_value accept anything.
+func (e *CorrelationEngine) isNew(rule *correlationRule, event *Event) bool {
+	if rule.newValue == "" {
+		return true
+	}
+	value, ok := correlationValue(event, rule.newValue)
+	if !ok {
+		return false
+	}
+
+	seen := e.seen[rule.name]
+	if seen == nil || len(seen) >= maxCorrelationSeen {
+		seen = make(map[string]struct{})
+		e.seen[rule.name] = seen
+	}
+	if _, ok := seen[value]; ok {
+		return false
+	}
+	seen[value] = struct{}{}
+	return true
+}
+
+// group returns the rule's group for a value, creating it for the event.
+// It returns nil when too many groups are open.
+func (e *CorrelationEngine) group(rule *correlationRule, value string, event *Event, now time.Time) *correlationGroup {
+	key := rule.name + "\x00" + value
+	if group, ok := e.groups[key]; ok {
+		return group
+	}
+	if len(e.groups) >= maxCorrelationGroups {
+		return nil
+	}
+	group := newCorrelationGroup(event, now)
+	e.groups[key] = group
+	return group
+}
+
+// newCorrelationGroup opens a group with the event that started it
+func newCorrelationGroup(event *Event, now time.Time) *correlationGroup {
+	image := event.ProcessPath
+	if image == "" {
+		image = event.ProcessName
+	}
+	return &correlationGroup{first: now, firstCode: event.EventCode, firstImage: image}
+}
+
+// prune drops groups whose window has passed; the caller holds the lock
+func (e *CorrelationEngine) prune(now time.Time) {
+	e.lastPrune = time.Now()
+
+	windows := make(map[string]time.Duration, len(e.rules))
+	for _, rule := range e.rules {
+		windows[rule.name] = rule.window
+	}
+	for key, group := range e.groups {
+		name, _, _ := strings.Cut(key, "\x00")
+		window := windows[name]
+		last := group.first
+		if len(group.times) > 0 {
+			last = group.times[len(group.times)-1]
+		}
+		if now.Sub(last) > window && !now.Before(group.quietUntil) {
+			delete(e.groups, key)
+		}
+	}
+}
+
+// alert builds the synthesized alert from the event that completed the rule
+func (e *CorrelationEngine) alert(rule *correlationRule, event *Event, message string, data map[string]string) *Event {
+	data["rule_name"] = rule.name
+	data["rule_type"] = rule.kind
+	data["window_seconds"] = strconv.Itoa(int(rule.window.Seconds()))
+	return newDetectionAlert(e.agentID, e.hostname, event, DetectionEventCorrelation, rule.severity, message, data)
+}
+
+// Stats returns the rule and window counts for heartbeats
+func (e *CorrelationEngine) Stats() *CorrelationStats {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return &CorrelationStats{
+		Rules:  len(e.rules),
+		Groups: len(e.groups),
+		Alerts: e.alerts,
+	}
+}
+
+// correlationValue reads a grouping field, case-insensitively, so
+// "ADMIN" and "admin" count as the same source
+func correlationValue(event *Event, field string) (string, bool) {
+	value, ok := sigmaFieldValue(event, field)
+	if !ok || value == "" || value == "-" {
+		return "", false
+	}
+	return strings.ToLower(value), true
+}
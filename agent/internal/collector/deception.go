@@ -0,0 +1,378 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const (
+	// decoyQuietPeriod hides the agent's own accesses while it plants and
+	// checks decoys; the helpers it starts are not the agent process
+	decoyQuietPeriod = 30 * time.Second
+
+	// DecoyAuditKey tags the Linux audit watches on decoy files
+	DecoyAuditKey = "siem_honeyfile"
+)
+
+// DecoyStatus is one decoy in the inventory reported to the server
+type DecoyStatus struct {
+	Type    string `json:"type"` // "file" or "registry"
+	Path    string `json:"path"` // file path, or registry key\value name
+	Planted bool   `json:"planted"`
+	Audited bool   `json:"audited"` // access auditing is in place
+	Error   string `json:"error,omitempty"`
+}
+
+// DecoyInventory is the set of decoys planted on an agent
+type DecoyInventory struct {
+	AgentID    string        `json:"agent_id"`
+	Hostname   string        `json:"hostname"`
+	Decoys     []DecoyStatus `json:"decoys"`
+	ReportedAt time.Time     `json:"reported_at"`
+}
+
+// decoyState records what the agent planted, so a real file that happens
+// to sit at a decoy path is never overwritten or treated as a decoy
+type decoyState struct {
+	Planted []string `json:"planted"`
+}
+
+// DeceptionMonitor plants decoy files and registry credentials that no
+// legitimate user or process has a reason to touch, and raises a critical
+// alert when an event from the file or registry collectors shows access to
+// one. Access is audited through the Security log (Windows SACLs) or audit
+// watches (Linux); the monitor only inspects the events those produce.
+type DeceptionMonitor struct {
+	config   *config.DeceptionConfig
+	agentID  string
+	hostname string
+	selfExe  string
+	onReport func(*DecoyInventory) error
+
+	mutex      sync.Mutex
+	decoys     []DecoyStatus
+	files      map[string]string // normalized path -> decoy path
+	keys       map[string]string // normalized registry key -> decoy path
+	planted    map[string]bool
+	quietUntil time.Time
+}
+
+// NewDeceptionMonitor creates the monitor; decoys are planted by Start
+func NewDeceptionMonitor(cfg *config.DeceptionConfig, agentID, hostname string) *DeceptionMonitor {
+	m := &DeceptionMonitor{
+		config:   cfg,
+		agentID:  agentID,
+		hostname: hostname,
+		files:    make(map[string]string),
+		keys:     make(map[string]string),
+		planted:  make(map[string]bool),
+	}
+	if exe, err := os.Executable(); err == nil {
+		m.selfExe = exe
+	}
+
+	if data, err := os.ReadFile(cfg.StateFile); err == nil {
+		var state decoyState
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Printf("Warning: Failed to read decoy state: %v", err)
+		}
+		for _, path := range state.Planted {
+			m.planted[path] = true
+		}
+	}
+	return m
+}
+
+// SetReportCallback sets the callback that sends the decoy inventory
+func (m *DeceptionMonitor) SetReportCallback(onReport func(*DecoyInventory) error) {
+	m.onReport = onReport
+}
+
+// FilePaths returns the configured decoy file paths, for collectors that
+// need them in their path filters
+func (m *DeceptionMonitor) FilePaths() []string {
+	paths := make([]string, 0, len(m.config.Files))
+	for _, file := range m.config.Files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+// Start plants the decoys and reports the inventory, then replants decoys
+// that were removed and reports again whenever the inventory changes
+func (m *DeceptionMonitor) Start(ctx context.Context) {
+	m.plant()
+
+	ticker := time.NewTicker(time.Duration(m.config.CheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.plant()
+		}
+	}
+}
+
+// plant creates missing decoys, enables auditing on them and reports the
+// inventory if it changed
+func (m *DeceptionMonitor) plant() {
+	m.mutex.Lock()
+	m.quietUntil = time.Now().Add(decoyQuietPeriod)
+	m.mutex.Unlock()
+
+	var decoys []DecoyStatus
+	files := make(map[string]string)
+	keys := make(map[string]string)
+
+	for _, file := range m.config.Files {
+		status := DecoyStatus{Type: "file", Path: file.Path}
+		if err := m.plantFile(file); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Planted = true
+			status.Audited, err = auditDecoyFile(file.Path)
+			if err != nil {
+				status.Error = err.Error()
+			}
+			files[normalizeDecoyPath(file.Path)] = file.Path
+		}
+		decoys = append(decoys, status)
+	}
+
+	for _, credential := range m.config.Credentials {
+		path := credential.Key + `\` + credential.Name
+		status := DecoyStatus{Type: "registry", Path: path}
+		value := credential.Value
+		if value == "" {
+			value, _ = GeneratePassword(16, "")
+		}
+		planted, audited, err := plantDecoyCredential(credential.Key, credential.Name, value, m.planted[path])
+		status.Planted, status.Audited = planted, audited
+		if err != nil {
+			status.Error = err.Error()
+		}
+		if planted {
+			m.planted[path] = true
+			keys[normalizeRegistryPath(credential.Key)] = path
+		}
+		decoys = append(decoys, status)
+	}
+
+	m.saveState()
+
+	m.mutex.Lock()
+	changed := !decoysEqual(m.decoys, decoys)
+	m.decoys = decoys
+	m.files = files
+	m.keys = keys
+	m.quietUntil = time.Now().Add(decoyQuietPeriod)
+	m.mutex.Unlock()
+
+	if changed {
+		log.Printf("Deception: %d decoys in place", len(files)+len(keys))
+		m.report(decoys)
+	}
+}
+
+// plantFile writes a decoy file unless it exists. An existing file is only
+// accepted as a decoy if the agent planted it.
+func (m *DeceptionMonitor) plantFile(file config.DecoyFile) error {
+	if _, err := os.Stat(file.Path); err == nil {
+		if !m.planted[file.Path] {
+			return fmt.Errorf("a file the agent did not plant exists at this path")
+		}
+		return nil
+	}
+
+	content := file.Content
+	if content == "" {
+		password, err := GeneratePassword(16, "")
+		if err != nil {
+			return err
+		}
+		content = fmt.Sprintf("[default]\nusername = svc_backup\npassword = %s\n", password)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file.Path, []byte(content), 0644); err != nil {
+		return err
+	}
+	m.planted[file.Path] = true
+	return nil
+}
+
+// saveState stores which decoys the agent planted
+func (m *DeceptionMonitor) saveState() {
+	state := decoyState{}
+	for path := range m.planted {
+		state.Planted = append(state.Planted, path)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.StateFile), 0700); err != nil {
+		log.Printf("Warning: Failed to store decoy state: %v", err)
+		return
+	}
+	if err := os.WriteFile(m.config.StateFile, data, 0600); err != nil {
+		log.Printf("Warning: Failed to store decoy state: %v", err)
+	}
+}
+
+// report sends the decoy inventory to the server
+func (m *DeceptionMonitor) report(decoys []DecoyStatus) {
+	if m.onReport == nil {
+		return
+	}
+	inventory := &DecoyInventory{
+		AgentID:    m.agentID,
+		Hostname:   m.hostname,
+		Decoys:     decoys,
+		ReportedAt: time.Now(),
+	}
+	if err := m.onReport(inventory); err != nil {
+		log.Printf("Error reporting decoy inventory: %v", err)
+	}
+}
+
+// Inspect returns a critical alert when the event shows access to a decoy.
+// The agent's own accesses and those of ignored processes are skipped.
+func (m *DeceptionMonitor) Inspect(event *Event) []*Event {
+	if event.SourceType == AgentHealthSourceType || event.SourceType == DetectionSourceType {
+		return nil
+	}
+	if event.FilePath == "" && event.RegistryPath == "" {
+		return nil
+	}
+
+	m.mutex.Lock()
+	quiet := time.Now().Before(m.quietUntil)
+	decoyType, decoyPath := m.match(event)
+	m.mutex.Unlock()
+
+	if decoyPath == "" || quiet || m.ignored(event) {
+		return nil
+	}
+
+	process := event.ProcessPath
+	if process == "" {
+		process = event.ProcessName
+	}
+	message := fmt.Sprintf("Decoy %s accessed: %s", decoyType, decoyPath)
+	if process != "" {
+		message += fmt.Sprintf(" (Process: %s)", process)
+	}
+
+	return []*Event{newDetectionAlert(m.agentID, m.hostname, event, DetectionEventDecoyAccess, 5, message,
+		map[string]string{
+			"decoy_type": decoyType,
+			"decoy_path": decoyPath,
+			"access":     event.AccessMask,
+		})}
+}
+
+// match returns the decoy the event touches; the caller holds the lock
+func (m *DeceptionMonitor) match(event *Event) (string, string) {
+	for _, path := range []string{event.FilePath, event.EventData["target_path"]} {
+		if path == "" {
+			continue
+		}
+		if decoy, ok := m.files[normalizeDecoyPath(path)]; ok {
+			return "file", decoy
+		}
+	}
+
+	// Security 4657/4663 report registry keys as the object name; Sysmon
+	// reports the key and value as the registry path
+	for _, path := range []string{event.RegistryPath, event.FilePath} {
+		if path == "" {
+			continue
+		}
+		normalized := normalizeRegistryPath(path)
+		for key, decoy := range m.keys {
+			if normalized == key || strings.HasPrefix(normalized, key+`\`) {
+				return "registry", decoy
+			}
+		}
+	}
+	return "", ""
+}
+
+// ignored reports whether the event was caused by the agent itself or by a
+// process configured as expected to touch decoys (backup, antivirus)
+func (m *DeceptionMonitor) ignored(event *Event) bool {
+	if event.ProcessID == os.Getpid() {
+		return true
+	}
+	for _, process := range []string{event.ProcessPath, event.ProcessName} {
+		if process == "" {
+			continue
+		}
+		if m.selfExe != "" && normalizeDecoyPath(process) == normalizeDecoyPath(m.selfExe) {
+			return true
+		}
+		base := filepath.Base(strings.ReplaceAll(process, `\`, "/"))
+		for _, name := range m.config.IgnoreProcesses {
+			if strings.EqualFold(base, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeDecoyPath makes Windows paths comparable regardless of case and
+// separators; other platforms compare paths exactly
+func normalizeDecoyPath(path string) string {
+	if runtime.GOOS != "windows" {
+		return filepath.Clean(path)
+	}
+	return strings.ToLower(strings.ReplaceAll(path, "/", `\`))
+}
+
+// normalizeRegistryPath maps the kernel (\REGISTRY\MACHINE) and long
+// (HKEY_LOCAL_MACHINE) key names to the short form used in the config
+func normalizeRegistryPath(path string) string {
+	path = strings.ToLower(strings.TrimSuffix(path, `\`))
+	for long, short := range map[string]string{
+		`\registry\machine\`:  `hklm\`,
+		`hkey_local_machine\`: `hklm\`,
+		`\registry\user\`:     `hku\`,
+		`hkey_users\`:         `hku\`,
+		`hklm:\`:              `hklm\`,
+	} {
+		if strings.HasPrefix(path, long) {
+			return short + path[len(long):]
+		}
+	}
+	return path
+}
+
+// decoysEqual reports whether two inventories are the same
+func decoysEqual(a, b []DecoyStatus) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
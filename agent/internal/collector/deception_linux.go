@@ -0,0 +1,31 @@
+//go:build linux
+
+package collector
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// auditDecoyFile adds an audit watch on reads, writes and attribute changes
+// of the file; the auditd collector reports them as file access events.
+// A watch that already exists is left in place.
+func auditDecoyFile(path string) (bool, error) {
+	if output, err := exec.Command("auditctl", "-l").Output(); err == nil {
+		if strings.Contains(string(output), "-w "+path+" ") {
+			return true, nil
+		}
+	}
+
+	output, err := exec.Command("auditctl", "-w", path, "-p", "rwa", "-k", DecoyAuditKey).CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to add audit watch: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return true, nil
+}
+
+// plantDecoyCredential is not supported; registry decoys are Windows only
+func plantDecoyCredential(key, name, value string, ours bool) (planted, audited bool, err error) {
+	return false, false, fmt.Errorf("registry decoys are only supported on Windows")
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !linux
+
+package collector
+
+import "fmt"
+
+// auditDecoyFile has nothing to set up; on macOS the Endpoint Security
+// client reports decoy file events once their paths are in its filter
+func auditDecoyFile(path string) (bool, error) {
+	return false, nil
+}
+
+// plantDecoyCredential is not supported; registry decoys are Windows only
+func plantDecoyCredential(key, name, value string, ours bool) (planted, audited bool, err error) {
+	return false, false, fmt.Errorf("registry decoys are only supported on Windows")
+}
@@ -0,0 +1,116 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Audit policy subcategories by GUID; the names are localized
+const (
+	auditSubcategoryFileSystem = "{0CCE921D-69AE-11D9-BED3-505054503030}"
+	auditSubcategoryRegistry   = "{0CCE921E-69AE-11D9-BED3-505054503030}"
+)
+
+// auditDecoyFile adds a SACL auditing reads, writes and deletes by Everyone
+// and enables the File System audit subcategory, so every access produces a
+// Security 4663 event
+func auditDecoyFile(path string) (bool, error) {
+	psScript := fmt.Sprintf(`
+$ErrorActionPreference = "Stop"
+$everyone = New-Object System.Security.Principal.SecurityIdentifier('S-1-1-0')
+$acl = Get-Acl -Path %s -Audit
+$rule = New-Object System.Security.AccessControl.FileSystemAuditRule($everyone, 'ReadData,WriteData,AppendData,Delete,ChangePermissions', 'None', 'None', 'Success')
+$acl.AddAuditRule($rule)
+Set-Acl -Path %s -AclObject $acl
+auditpol.exe /set /subcategory:"%s" /success:enable | Out-Null
+`, psQuote(path), psQuote(path), auditSubcategoryFileSystem)
+
+	if output, err := runDecoyScript(psScript, nil); err != nil {
+		return false, fmt.Errorf("failed to enable auditing: %v: %s", err, output)
+	}
+	return true, nil
+}
+
+// plantDecoyCredential writes a fake credential value unless it exists,
+// and audits queries, changes and deletion of its key. An existing value is
+// only accepted if the agent planted it (ours).
+func plantDecoyCredential(key, name, value string, ours bool) (planted, audited bool, err error) {
+	root, subkey, err := splitRegistryKey(key)
+	if err != nil {
+		return false, false, err
+	}
+
+	k, _, err := registry.CreateKey(root, subkey, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to create key: %w", err)
+	}
+	_, _, err = k.GetValue(name, nil)
+	switch {
+	case err == nil && !ours:
+		k.Close()
+		return false, false, fmt.Errorf("a value the agent did not plant exists at this path")
+	case err != nil:
+		if err := k.SetStringValue(name, value); err != nil {
+			k.Close()
+			return false, false, fmt.Errorf("failed to write value: %w", err)
+		}
+	}
+	k.Close()
+
+	psScript := fmt.Sprintf(`
+$ErrorActionPreference = "Stop"
+$everyone = New-Object System.Security.Principal.SecurityIdentifier('S-1-1-0')
+$path = 'Registry::' + $env:SIEM_DECOY_KEY
+$acl = Get-Acl -Path $path -Audit
+$rule = New-Object System.Security.AccessControl.RegistryAuditRule($everyone, 'QueryValues,SetValue,Delete,ChangePermissions', 'None', 'None', 'Success')
+$acl.AddAuditRule($rule)
+Set-Acl -Path $path -AclObject $acl
+auditpol.exe /set /subcategory:"%s" /success:enable | Out-Null
+`, auditSubcategoryRegistry)
+
+	// The key goes through the environment; it may contain quotes
+	fullKey := registryLongNames[strings.ToUpper(strings.SplitN(key, `\`, 2)[0])] + `\` + subkey
+	if output, err := runDecoyScript(psScript, []string{"SIEM_DECOY_KEY=" + fullKey}); err != nil {
+		return true, false, fmt.Errorf("failed to enable auditing: %v: %s", err, output)
+	}
+	return true, true, nil
+}
+
+// registryLongNames maps the supported hive abbreviations to the names the
+// PowerShell registry provider accepts
+var registryLongNames = map[string]string{
+	"HKLM":               "HKEY_LOCAL_MACHINE",
+	"HKEY_LOCAL_MACHINE": "HKEY_LOCAL_MACHINE",
+	"HKU":                "HKEY_USERS",
+	"HKEY_USERS":         "HKEY_USERS",
+}
+
+// splitRegistryKey splits "HKLM\SOFTWARE\..." into its hive and subkey.
+// Per-user hives (HKCU) are not supported; the agent runs as SYSTEM.
+func splitRegistryKey(key string) (registry.Key, string, error) {
+	parts := strings.SplitN(key, `\`, 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", fmt.Errorf("invalid registry key %q", key)
+	}
+	switch registryLongNames[strings.ToUpper(parts[0])] {
+	case "HKEY_LOCAL_MACHINE":
+		return registry.LOCAL_MACHINE, parts[1], nil
+	case "HKEY_USERS":
+		return registry.USERS, parts[1], nil
+	}
+	return 0, "", fmt.Errorf("unsupported registry hive %q (use HKLM or HKU)", parts[0])
+}
+
+// runDecoyScript runs a PowerShell script with extra environment variables
+func runDecoyScript(psScript string, env []string) (string, error) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", psScript)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"strconv"
+	"time"
+)
+
+// Detection alerts are sent through the normal event pipeline next to the
+// event that matched, which keeps its own identity
+const (
+	DetectionSourceType = "SIEM Agent Detection"
+	DetectionChannel    = "SIEM-Agent/Detection"
+
+	DetectionEventSigmaMatch  = 9200 // A Sigma rule matched an event
+	DetectionEventIOCMatch    = 9201 // An event referenced a threat-intel indicator
+	DetectionEventCorrelation = 9202 // A local correlation rule completed
+	DetectionEventDecoyAccess = 9203 // A decoy file or credential was touched
+)
+
+// newDetectionAlert builds an alert for a matched event. It carries the
+// event's normalized fields, so the alert can be triaged without the
+// original; data is extended with where the event came from.
+func newDetectionAlert(agentID, hostname string, event *Event, code, severity int, message string, data map[string]string) *Event {
+	alert := *event
+	alert.pooled = false
+	alert.AgentID = agentID
+	alert.SourceType = DetectionSourceType
+	alert.EventCode = code
+	alert.Channel = DetectionChannel
+	alert.Provider = AgentHealthProvider
+	alert.Severity = severity
+	alert.Message = message
+	alert.RawXML = ""
+	alert.Keywords = nil
+	alert.CollectedAt = time.Now()
+	if alert.Computer == "" {
+		alert.Computer = hostname
+	}
+
+	data["matched_channel"] = event.Channel
+	data["matched_code"] = strconv.Itoa(event.EventCode)
+	data["matched_record"] = strconv.FormatInt(event.RecordID, 10)
+	data["matched_provider"] = event.Provider
+	alert.EventData = data
+
+	return &alert
+}
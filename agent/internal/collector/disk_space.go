@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/siem/agent/internal/sysinfo"
+)
+
+// A volume must recover this many points above the threshold before it is
+// reported as OK, so a disk hovering at the threshold does not flap
+const diskSpaceHysteresis = 2.0
+
+// DiskSpaceMonitor raises a health event when free space on a fixed volume
+// drops below a percentage, and again once it recovers
+type DiskSpaceMonitor struct {
+	agentID          string
+	hostname         string
+	thresholdPercent float64
+	low              map[string]bool // mount -> currently below threshold
+}
+
+// NewDiskSpaceMonitor creates a disk space monitor
+func NewDiskSpaceMonitor(agentID, hostname string, thresholdPercent int) *DiskSpaceMonitor {
+	return &DiskSpaceMonitor{
+		agentID:          agentID,
+		hostname:         hostname,
+		thresholdPercent: float64(thresholdPercent),
+		low:              make(map[string]bool),
+	}
+}
+
+// Check compares the volumes with the threshold and returns events for
+// volumes that crossed it since the last check
+func (m *DiskSpaceMonitor) Check(volumes []sysinfo.Volume) []*Event {
+	var events []*Event
+
+	for _, volume := range volumes {
+		data := map[string]string{
+			"mount":        volume.Mount,
+			"free_mb":      strconv.FormatUint(volume.FreeMB, 10),
+			"total_mb":     strconv.FormatUint(volume.TotalMB, 10),
+			"free_percent": fmt.Sprintf("%.1f", volume.FreePercent),
+		}
+
+		switch {
+		case volume.FreePercent < m.thresholdPercent && !m.low[volume.Mount]:
+			m.low[volume.Mount] = true
+			log.Printf("Warning: low disk space on %s (%.1f%% free)", volume.Mount, volume.FreePercent)
+			events = append(events, newHealthEvent(m.agentID, m.hostname, HealthEventLowDiskSpace, 3,
+				fmt.Sprintf("Low disk space on %s: %d MB free of %d MB (%.1f%%)",
+					volume.Mount, volume.FreeMB, volume.TotalMB, volume.FreePercent), data))
+
+		case volume.FreePercent >= m.thresholdPercent+diskSpaceHysteresis && m.low[volume.Mount]:
+			delete(m.low, volume.Mount)
+			events = append(events, newHealthEvent(m.agentID, m.hostname, HealthEventDiskSpaceOK, 1,
+				fmt.Sprintf("Disk space on %s recovered: %.1f%% free", volume.Mount, volume.FreePercent), data))
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,602 @@
+//go:build darwin && cgo
+
+package collector
+
+/*
+#cgo CFLAGS: -fblocks -mmacosx-version-min=11.0
+#cgo LDFLAGS: -lEndpointSecurity -lbsm -mmacosx-version-min=11.0
+
+#include <EndpointSecurity/EndpointSecurity.h>
+#include <bsm/libbsm.h>
+#include <errno.h>
+#include <mach/mach.h>
+#include <pthread.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/mount.h>
+#include <time.h>
+
+// siem_es_event is an ES message copied out of the handler block; messages
+// are only valid while the block runs
+typedef struct {
+	int event_type;
+	long long time_sec;
+	long time_nsec;
+	int pid;
+	int ppid;
+	unsigned int ruid;
+	unsigned int euid;
+	unsigned int auid;
+	int platform_binary;
+	char *process_path;
+	char *parent_path;  // exec: the image that called exec
+	char *signing_id;
+	char *team_id;
+	char *command_line; // exec
+	char *target_path;  // file events; mount point
+	char *target_path2; // rename destination; mounted device
+	char *fs_type;      // mount, unmount
+} siem_es_event;
+
+#define SIEM_ES_QUEUE_SIZE 4096
+
+static es_client_t *siem_es_client;
+static siem_es_event *siem_es_queue[SIEM_ES_QUEUE_SIZE];
+static int siem_es_head, siem_es_count;
+static unsigned long long siem_es_dropped;
+static pthread_mutex_t siem_es_mutex = PTHREAD_MUTEX_INITIALIZER;
+static pthread_cond_t siem_es_cond = PTHREAD_COND_INITIALIZER;
+
+// File events are only kept under these prefixes; set before the client
+// is created and read-only afterwards
+static char **siem_es_prefixes;
+static int siem_es_prefix_count;
+
+static void siem_es_set_file_prefixes(char **prefixes, int count) {
+	siem_es_prefixes = prefixes;
+	siem_es_prefix_count = count;
+}
+
+static char *siem_es_string(es_string_token_t token) {
+	if (token.data == NULL) {
+		return NULL;
+	}
+	return strndup(token.data, token.length);
+}
+
+static char *siem_es_join(const es_file_t *dir, es_string_token_t name) {
+	size_t size = dir->path.length + 1 + name.length + 1;
+	char *path = malloc(size);
+	if (path == NULL) {
+		return NULL;
+	}
+	memcpy(path, dir->path.data, dir->path.length);
+	path[dir->path.length] = '/';
+	memcpy(path + dir->path.length + 1, name.data, name.length);
+	path[size - 1] = '\0';
+	return path;
+}
+
+static int siem_es_path_wanted(const char *path) {
+	if (siem_es_prefix_count == 0) {
+		return 1;
+	}
+	if (path == NULL) {
+		return 0;
+	}
+	for (int i = 0; i < siem_es_prefix_count; i++) {
+		if (strncmp(path, siem_es_prefixes[i], strlen(siem_es_prefixes[i])) == 0) {
+			return 1;
+		}
+	}
+	return 0;
+}
+
+static char *siem_es_command_line(const es_event_exec_t *exec) {
+	uint32_t count = es_exec_arg_count(exec);
+	size_t size = 1;
+	for (uint32_t i = 0; i < count; i++) {
+		size += es_exec_arg(exec, i).length + 1;
+	}
+
+	char *line = malloc(size);
+	if (line == NULL) {
+		return NULL;
+	}
+	size_t offset = 0;
+	for (uint32_t i = 0; i < count; i++) {
+		es_string_token_t arg = es_exec_arg(exec, i);
+		if (i > 0) {
+			line[offset++] = ' ';
+		}
+		memcpy(line + offset, arg.data, arg.length);
+		offset += arg.length;
+	}
+	line[offset] = '\0';
+	return line;
+}
+
+static void siem_es_set_process(siem_es_event *event, const es_process_t *process) {
+	event->pid = audit_token_to_pid(process->audit_token);
+	event->ppid = process->ppid;
+	event->ruid = audit_token_to_ruid(process->audit_token);
+	event->euid = audit_token_to_euid(process->audit_token);
+	event->auid = audit_token_to_auid(process->audit_token);
+	event->platform_binary = process->is_platform_binary;
+	event->process_path = siem_es_string(process->executable->path);
+	event->signing_id = siem_es_string(process->signing_id);
+	event->team_id = siem_es_string(process->team_id);
+}
+
+static void siem_es_free(siem_es_event *event) {
+	free(event->process_path);
+	free(event->parent_path);
+	free(event->signing_id);
+	free(event->team_id);
+	free(event->command_line);
+	free(event->target_path);
+	free(event->target_path2);
+	free(event->fs_type);
+	free(event);
+}
+
+static void siem_es_handle(const es_message_t *msg) {
+	siem_es_event *event = calloc(1, sizeof(siem_es_event));
+	if (event == NULL) {
+		return;
+	}
+	event->event_type = msg->event_type;
+	event->time_sec = msg->time.tv_sec;
+	event->time_nsec = msg->time.tv_nsec;
+
+	const struct statfs *fs = NULL;
+	switch (msg->event_type) {
+	case ES_EVENT_TYPE_NOTIFY_EXEC:
+		siem_es_set_process(event, msg->event.exec.target);
+		event->parent_path = siem_es_string(msg->process->executable->path);
+		event->command_line = siem_es_command_line(&msg->event.exec);
+		break;
+	case ES_EVENT_TYPE_NOTIFY_CREATE:
+		if (msg->event.create.destination_type == ES_DESTINATION_TYPE_EXISTING_FILE) {
+			event->target_path = siem_es_string(msg->event.create.destination.existing_file->path);
+		} else {
+			event->target_path = siem_es_join(msg->event.create.destination.new_path.dir,
+				msg->event.create.destination.new_path.filename);
+		}
+		break;
+	case ES_EVENT_TYPE_NOTIFY_UNLINK:
+		event->target_path = siem_es_string(msg->event.unlink.target->path);
+		break;
+	case ES_EVENT_TYPE_NOTIFY_RENAME:
+		event->target_path = siem_es_string(msg->event.rename.source->path);
+		if (msg->event.rename.destination_type == ES_DESTINATION_TYPE_EXISTING_FILE) {
+			event->target_path2 = siem_es_string(msg->event.rename.destination.existing_file->path);
+		} else {
+			event->target_path2 = siem_es_join(msg->event.rename.destination.new_path.dir,
+				msg->event.rename.destination.new_path.filename);
+		}
+		break;
+	case ES_EVENT_TYPE_NOTIFY_MOUNT:
+		fs = msg->event.mount.statfs;
+		break;
+	case ES_EVENT_TYPE_NOTIFY_UNMOUNT:
+		fs = msg->event.unmount.statfs;
+		break;
+	default:
+		break;
+	}
+
+	switch (msg->event_type) {
+	case ES_EVENT_TYPE_NOTIFY_CREATE:
+	case ES_EVENT_TYPE_NOTIFY_UNLINK:
+	case ES_EVENT_TYPE_NOTIFY_RENAME:
+		if (!siem_es_path_wanted(event->target_path) && !siem_es_path_wanted(event->target_path2)) {
+			siem_es_free(event);
+			return;
+		}
+		break;
+	default:
+		break;
+	}
+
+	if (fs != NULL) {
+		event->target_path = strdup(fs->f_mntonname);
+		event->target_path2 = strdup(fs->f_mntfromname);
+		event->fs_type = strdup(fs->f_fstypename);
+	}
+	if (msg->event_type != ES_EVENT_TYPE_NOTIFY_EXEC) {
+		siem_es_set_process(event, msg->process);
+	}
+
+	pthread_mutex_lock(&siem_es_mutex);
+	if (siem_es_count == SIEM_ES_QUEUE_SIZE) {
+		siem_es_dropped++;
+		pthread_mutex_unlock(&siem_es_mutex);
+		siem_es_free(event);
+		return;
+	}
+	siem_es_queue[(siem_es_head + siem_es_count) % SIEM_ES_QUEUE_SIZE] = event;
+	siem_es_count++;
+	pthread_cond_signal(&siem_es_cond);
+	pthread_mutex_unlock(&siem_es_mutex);
+}
+
+// siem_es_start creates the client, mutes the agent itself and the given
+// executables, and subscribes. It returns an es_new_client_result_t, or
+// -1 if subscribing failed.
+static int siem_es_start(const es_event_type_t *events, uint32_t event_count, char **muted, int muted_count) {
+	es_new_client_result_t result = es_new_client(&siem_es_client, ^(es_client_t *client, const es_message_t *msg) {
+		siem_es_handle(msg);
+	});
+	if (result != ES_NEW_CLIENT_RESULT_SUCCESS) {
+		siem_es_client = NULL;
+		return result;
+	}
+
+	audit_token_t token;
+	mach_msg_type_number_t size = TASK_AUDIT_TOKEN_COUNT;
+	if (task_info(mach_task_self(), TASK_AUDIT_TOKEN, (task_info_t)&token, &size) == KERN_SUCCESS) {
+		es_mute_process(siem_es_client, &token);
+	}
+	for (int i = 0; i < muted_count; i++) {
+		es_mute_path_literal(siem_es_client, muted[i]);
+	}
+
+	if (es_subscribe(siem_es_client, events, event_count) != ES_RETURN_SUCCESS) {
+		es_delete_client(siem_es_client);
+		siem_es_client = NULL;
+		return -1;
+	}
+	return ES_NEW_CLIENT_RESULT_SUCCESS;
+}
+
+static void siem_es_stop(void) {
+	if (siem_es_client != NULL) {
+		es_unsubscribe_all(siem_es_client);
+		es_delete_client(siem_es_client);
+		siem_es_client = NULL;
+	}
+}
+
+// siem_es_next returns the next queued event, or NULL after timeout_ms
+static siem_es_event *siem_es_next(int timeout_ms) {
+	struct timespec deadline;
+	clock_gettime(CLOCK_REALTIME, &deadline);
+	deadline.tv_sec += timeout_ms / 1000;
+	deadline.tv_nsec += (long)(timeout_ms % 1000) * 1000000;
+	if (deadline.tv_nsec >= 1000000000) {
+		deadline.tv_sec++;
+		deadline.tv_nsec -= 1000000000;
+	}
+
+	siem_es_event *event = NULL;
+	pthread_mutex_lock(&siem_es_mutex);
+	while (siem_es_count == 0) {
+		if (pthread_cond_timedwait(&siem_es_cond, &siem_es_mutex, &deadline) == ETIMEDOUT) {
+			break;
+		}
+	}
+	if (siem_es_count > 0) {
+		event = siem_es_queue[siem_es_head];
+		siem_es_head = (siem_es_head + 1) % SIEM_ES_QUEUE_SIZE;
+		siem_es_count--;
+	}
+	pthread_mutex_unlock(&siem_es_mutex);
+	return event;
+}
+
+static unsigned long long siem_es_take_dropped(void) {
+	pthread_mutex_lock(&siem_es_mutex);
+	unsigned long long dropped = siem_es_dropped;
+	siem_es_dropped = 0;
+	pthread_mutex_unlock(&siem_es_mutex);
+	return dropped;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const (
+	EndpointSecuritySourceType = "endpoint_security"
+	EndpointSecurityChannel    = "endpoint_security"
+	EndpointSecurityProvider   = "EndpointSecurity"
+)
+
+const (
+	// The agent waits this long for queued messages before checking for Stop
+	endpointSecurityPollTimeout = 500 // milliseconds
+
+	// Login user ID of processes not started from a login session
+	endpointSecurityUnsetAuid = 0xffffffff
+)
+
+// The ES client is process-wide: the framework allows one per process
+// and the C queue is global
+var (
+	endpointSecurityMutex     sync.Mutex
+	endpointSecurityClientSet bool
+	endpointSecurityState     string
+)
+
+// EndpointSecurityCollector receives process, file and mount events from
+// the macOS Endpoint Security framework
+type EndpointSecurityCollector struct {
+	config     *config.EndpointSecurityConfig
+	agentID    string
+	hostname   string
+	eventQueue *EventQueue
+	wg         sync.WaitGroup
+	stopChan   chan struct{}
+	userNames  uidNames
+	recordID   int64
+}
+
+// NewEndpointSecurityCollector creates a new Endpoint Security collector
+func NewEndpointSecurityCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*EndpointSecurityCollector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	return &EndpointSecurityCollector{
+		config:     &cfg.EndpointSecurity,
+		agentID:    agentID,
+		hostname:   hostname,
+		eventQueue: eventQueue,
+		stopChan:   make(chan struct{}),
+	}, nil
+}
+
+// Start creates the ES client and subscribes to the configured events.
+// It fails when the binary lacks the Endpoint Security entitlement, the
+// agent has no Full Disk Access or does not run as root; the agent then
+// carries on with the unified log only.
+func (c *EndpointSecurityCollector) Start() error {
+	endpointSecurityMutex.Lock()
+	defer endpointSecurityMutex.Unlock()
+
+	if endpointSecurityClientSet {
+		return fmt.Errorf("an Endpoint Security client is already running")
+	}
+
+	var events []C.es_event_type_t
+	for _, name := range c.config.Events {
+		switch name {
+		case "exec":
+			events = append(events, C.ES_EVENT_TYPE_NOTIFY_EXEC)
+		case "file":
+			events = append(events, C.ES_EVENT_TYPE_NOTIFY_CREATE, C.ES_EVENT_TYPE_NOTIFY_UNLINK, C.ES_EVENT_TYPE_NOTIFY_RENAME)
+		case "mount":
+			events = append(events, C.ES_EVENT_TYPE_NOTIFY_MOUNT, C.ES_EVENT_TYPE_NOTIFY_UNMOUNT)
+		default:
+			log.Printf("Warning: Unknown Endpoint Security event type %q", name)
+		}
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no Endpoint Security events configured")
+	}
+
+	// Both lists are kept by the C side for the life of the process
+	prefixes, prefixCount := cStrings(c.config.FilePaths)
+	C.siem_es_set_file_prefixes(prefixes, prefixCount)
+	muted, mutedCount := cStrings(c.config.MutedProcesses)
+
+	result := C.siem_es_start(&events[0], C.uint32_t(len(events)), muted, mutedCount)
+	if err := endpointSecurityError(result); err != nil {
+		setEndpointSecurityStatus(endpointSecurityStatusName(result))
+		return err
+	}
+
+	endpointSecurityClientSet = true
+	setEndpointSecurityStatus("active")
+	log.Printf("Starting Endpoint Security collector for %v", c.config.Events)
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop deletes the ES client and stops the collector
+func (c *EndpointSecurityCollector) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+
+	endpointSecurityMutex.Lock()
+	C.siem_es_stop()
+	endpointSecurityClientSet = false
+	endpointSecurityMutex.Unlock()
+
+	log.Println("Endpoint Security collector stopped")
+}
+
+// run moves events from the C queue to the event queue
+func (c *EndpointSecurityCollector) run() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		default:
+		}
+
+		if dropped := C.siem_es_take_dropped(); dropped > 0 {
+			log.Printf("Warning: Endpoint Security queue full, dropped %d messages", uint64(dropped))
+			RecordDrop(EndpointSecurityChannel, uint64(dropped))
+		}
+
+		message := C.siem_es_next(endpointSecurityPollTimeout)
+		if message == nil {
+			continue
+		}
+		event := c.newEvent(message)
+		C.siem_es_free(message)
+
+		c.eventQueue.Push(event)
+	}
+}
+
+// newEvent converts a copied ES message to a normalized event, using the
+// same event codes as audit events on Linux
+func (c *EndpointSecurityCollector) newEvent(message *C.siem_es_event) *Event {
+	c.recordID++
+	event := &Event{
+		AgentID:         c.agentID,
+		Computer:        c.hostname,
+		SourceType:      EndpointSecuritySourceType,
+		EventCode:       int(message.event_type),
+		EventTime:       time.Unix(int64(message.time_sec), int64(message.time_nsec)),
+		RecordID:        c.recordID,
+		Channel:         EndpointSecurityChannel,
+		Provider:        EndpointSecurityProvider,
+		Severity:        1,
+		ProcessID:       int(message.pid),
+		ParentProcessID: int(message.ppid),
+		ProcessPath:     C.GoString(message.process_path),
+		EventData: map[string]string{
+			"platform_binary": strconv.FormatBool(message.platform_binary != 0),
+		},
+		CollectedAt: time.Now(),
+	}
+	event.ProcessName = filepath.Base(event.ProcessPath)
+	if signingID := C.GoString(message.signing_id); signingID != "" {
+		event.EventData["signing_id"] = signingID
+	}
+	if teamID := C.GoString(message.team_id); teamID != "" {
+		event.EventData["team_id"] = teamID
+	}
+
+	// The login user survives sudo and su, so it is preferred over the
+	// real user; a differing effective user is the target user
+	ruid := strconv.FormatUint(uint64(message.ruid), 10)
+	if message.auid != endpointSecurityUnsetAuid {
+		event.SubjectUser = c.userNames.lookup(strconv.FormatUint(uint64(message.auid), 10))
+	} else {
+		event.SubjectUser = c.userNames.lookup(ruid)
+	}
+	if euid := strconv.FormatUint(uint64(message.euid), 10); euid != ruid {
+		event.TargetUser = c.userNames.lookup(euid)
+	}
+
+	targetPath := C.GoString(message.target_path)
+	targetPath2 := C.GoString(message.target_path2)
+
+	switch message.event_type {
+	case C.ES_EVENT_TYPE_NOTIFY_EXEC:
+		event.EventCode = AuditEventProcessCreate
+		event.ProcessCommandLine = C.GoString(message.command_line)
+		if parentPath := C.GoString(message.parent_path); parentPath != "" {
+			event.ParentProcessName = filepath.Base(parentPath)
+			event.EventData["parent_image"] = parentPath
+		}
+		event.Message = fmt.Sprintf("Process created: %s", event.ProcessPath)
+		if event.TargetUser != "" {
+			event.Severity = 2 // setuid binary
+		}
+
+	case C.ES_EVENT_TYPE_NOTIFY_CREATE, C.ES_EVENT_TYPE_NOTIFY_UNLINK, C.ES_EVENT_TYPE_NOTIFY_RENAME:
+		event.EventCode = AuditEventFileAccess
+		event.ObjectType = "File"
+		event.FilePath = targetPath
+		switch message.event_type {
+		case C.ES_EVENT_TYPE_NOTIFY_CREATE:
+			event.AccessMask = "create"
+		case C.ES_EVENT_TYPE_NOTIFY_UNLINK:
+			event.AccessMask = "delete"
+			event.Severity = 2
+		default:
+			event.AccessMask = "rename"
+			event.EventData["target_path"] = targetPath2
+		}
+		event.Message = fmt.Sprintf("File %s: %s", event.AccessMask, event.FilePath)
+
+	case C.ES_EVENT_TYPE_NOTIFY_MOUNT, C.ES_EVENT_TYPE_NOTIFY_UNMOUNT:
+		event.ObjectType = "Volume"
+		event.FilePath = targetPath
+		event.EventData["device"] = targetPath2
+		event.EventData["fs_type"] = C.GoString(message.fs_type)
+		if message.event_type == C.ES_EVENT_TYPE_NOTIFY_MOUNT {
+			event.Message = fmt.Sprintf("Volume mounted: %s on %s (%s)", targetPath2, targetPath, event.EventData["fs_type"])
+			event.Severity = 2
+		} else {
+			event.Message = fmt.Sprintf("Volume unmounted: %s", targetPath)
+		}
+	}
+
+	return event
+}
+
+// cStrings copies strings to a C array. The memory is never freed.
+func cStrings(values []string) (**C.char, C.int) {
+	if len(values) == 0 {
+		return nil, 0
+	}
+	array := unsafe.Slice((**C.char)(C.malloc(C.size_t(len(values))*C.size_t(unsafe.Sizeof(uintptr(0))))), len(values))
+	for i, value := range values {
+		array[i] = C.CString(value)
+	}
+	return &array[0], C.int(len(values))
+}
+
+// endpointSecurityError explains why the ES client could not be created
+func endpointSecurityError(result C.int) error {
+	switch result {
+	case C.ES_NEW_CLIENT_RESULT_SUCCESS:
+		return nil
+	case C.ES_NEW_CLIENT_RESULT_ERR_NOT_ENTITLED:
+		return fmt.Errorf("the agent is not signed with the com.apple.developer.endpoint-security.client entitlement")
+	case C.ES_NEW_CLIENT_RESULT_ERR_NOT_PERMITTED:
+		return fmt.Errorf("the agent has not been granted Full Disk Access")
+	case C.ES_NEW_CLIENT_RESULT_ERR_NOT_PRIVILEGED:
+		return fmt.Errorf("Endpoint Security requires running as root")
+	case C.ES_NEW_CLIENT_RESULT_ERR_TOO_MANY_CLIENTS:
+		return fmt.Errorf("too many Endpoint Security clients on this system")
+	case -1:
+		return fmt.Errorf("failed to subscribe to Endpoint Security events")
+	default:
+		return fmt.Errorf("failed to create Endpoint Security client (result %d)", int(result))
+	}
+}
+
+// endpointSecurityStatusName is the platform access status for a failed
+// client creation
+func endpointSecurityStatusName(result C.int) string {
+	switch result {
+	case C.ES_NEW_CLIENT_RESULT_ERR_NOT_ENTITLED:
+		return "not_entitled"
+	case C.ES_NEW_CLIENT_RESULT_ERR_NOT_PERMITTED:
+		return "not_permitted"
+	case C.ES_NEW_CLIENT_RESULT_ERR_NOT_PRIVILEGED:
+		return "not_privileged"
+	default:
+		return "error"
+	}
+}
+
+// setEndpointSecurityStatus records the client status for platform access
+// reports, dropping the cached report so the change is sent
+func setEndpointSecurityStatus(status string) {
+	platformAccessMutex.Lock()
+	endpointSecurityState = status
+	platformAccessCached = nil
+	platformAccessMutex.Unlock()
+}
+
+// endpointSecurityStatus returns the client status: "" if no client was
+// started, "active", or why it failed. Called with platformAccessMutex held.
+func endpointSecurityStatus() string {
+	return endpointSecurityState
+}
@@ -0,0 +1,41 @@
+//go:build !darwin || !cgo
+
+package collector
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const EndpointSecuritySourceType = "endpoint_security"
+
+// EndpointSecurityCollector receives Endpoint Security events (macOS
+// builds with cgo only)
+type EndpointSecurityCollector struct{}
+
+// NewEndpointSecurityCollector fails outside macOS, and in macOS builds
+// without cgo, which cannot link the Endpoint Security framework
+func NewEndpointSecurityCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*EndpointSecurityCollector, error) {
+	if runtime.GOOS == "darwin" {
+		endpointSecurityState = "unsupported"
+		return nil, fmt.Errorf("this build has no Endpoint Security support (built with CGO_ENABLED=0)")
+	}
+	return nil, fmt.Errorf("Endpoint Security is only supported on macOS")
+}
+
+// Start does nothing
+func (c *EndpointSecurityCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *EndpointSecurityCollector) Stop() {}
+
+// endpointSecurityState is "unsupported" once the collector was requested
+// in a macOS build without cgo, so platform access reports it
+var endpointSecurityState string
+
+// endpointSecurityStatus returns "" or "unsupported"
+func endpointSecurityStatus() string {
+	return endpointSecurityState
+}
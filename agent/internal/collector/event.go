@@ -2,15 +2,22 @@ package collector
 
 import (
 	"time"
+
+	"github.com/siem/agent/internal/cache"
+	"github.com/siem/agent/internal/sysinfo"
 )
 
 // Event represents a normalized security event
 type Event struct {
 	// Agent identification
-	AgentID   string `json:"agent_id"`
-	Computer  string `json:"computer"`
-	FQDN      string `json:"fqdn,omitempty"`
-	IPAddress string `json:"ip_address,omitempty"`
+	AgentID     string `json:"agent_id"`
+	TenantID    string `json:"tenant_id,omitempty"` // customer the agent belongs to, for multi-tenant servers
+	Computer    string `json:"computer"`
+	FQDN        string `json:"fqdn,omitempty"`
+	IPAddress   string `json:"ip_address,omitempty"`
+	DeviceClass string `json:"device_class,omitempty"` // "laptop", "desktop", "server" or "vdi"
+	CollectedBy string `json:"collected_by,omitempty"` // agent host that read the event from a remote host's log
+	RemoteHost  string `json:"remote_host,omitempty"`  // configured remote host the event was read from
 
 	// Event metadata
 	SourceType      string    `json:"source_type"`       // "Windows Security", "Sysmon", "PowerShell"
@@ -66,18 +73,35 @@ type Event struct {
 	ServiceType    string `json:"service_type,omitempty"`
 	ServiceAccount string `json:"service_account,omitempty"`
 
+	// Kubernetes node, pod and container (container mode)
+	Container *ContainerInfo `json:"container,omitempty"`
+
 	// Additional fields
 	EventData      map[string]string `json:"event_data,omitempty"`       // Additional event-specific data
 	TaskCategory   string            `json:"task_category,omitempty"`    // Event task category
 	Keywords       []string          `json:"keywords,omitempty"`         // Event keywords
 	CollectedAt    time.Time         `json:"collected_at"`               // When agent collected event
+
+	pooled bool // taken from eventPool, returned by ReleaseEvent
+}
+
+// ContainerInfo identifies where an event was collected when the agent
+// runs as a Kubernetes DaemonSet. Namespace, pod and container are only
+// set for events from containerized processes.
+type ContainerInfo struct {
+	Node          string `json:"node"`
+	Namespace     string `json:"namespace,omitempty"`
+	Pod           string `json:"pod,omitempty"`
+	ContainerName string `json:"container_name,omitempty"`
+	ContainerID   string `json:"container_id,omitempty"`
 }
 
 // InventoryItem represents a software or service inventory item
 type InventoryItem struct {
 	AgentID     string    `json:"agent_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
 	Computer    string    `json:"computer"`
-	Type        string    `json:"type"`         // "software" or "service"
+	Type        string    `json:"type"`         // "software", "service", "os", "hotfix", "missing_patch", "profile", "extension", "connection", "user", "group", "sudo_rule" or "ssh_key"
 	Name        string    `json:"name"`
 	Version     string    `json:"version,omitempty"`
 	Vendor      string    `json:"vendor,omitempty"`
@@ -87,39 +111,105 @@ type InventoryItem struct {
 	StartType   string    `json:"start_type,omitempty"`   // For services: Automatic, Manual, Disabled
 	Description string    `json:"description,omitempty"`
 	CollectedAt time.Time `json:"collected_at"`
+
+	// Known vulnerabilities, from the server's advisory feed
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty"`
 }
 
 // HeartbeatData represents agent heartbeat information
 type HeartbeatData struct {
-	AgentID         string    `json:"agent_id"`
-	Hostname        string    `json:"hostname"`
-	IPAddress       string    `json:"ip_address"`
-	Status          string    `json:"status"` // "online"
-	Version         string    `json:"version"`
-	EventsCollected int64     `json:"events_collected"`
-	EventsSent      int64     `json:"events_sent"`
-	LastError       string    `json:"last_error,omitempty"`
-	Uptime          int64     `json:"uptime"` // seconds
-	Timestamp       time.Time `json:"timestamp"`
+	AgentID         string                  `json:"agent_id"`
+	TenantID        string                  `json:"tenant_id,omitempty"`
+	Hostname        string                  `json:"hostname"`
+	IPAddress       string                  `json:"ip_address"`
+	Virtualization  *sysinfo.Virtualization `json:"virtualization,omitempty"`
+	Status          string                  `json:"status"` // "online"
+	Version         string                  `json:"version"`
+	EventsCollected int64                   `json:"events_collected"`
+	EventsSent      int64                   `json:"events_sent"`
+	LastError       string                  `json:"last_error,omitempty"`
+	Uptime          int64                   `json:"uptime"` // seconds
+	BootTime        time.Time               `json:"boot_time"`
+	SystemUptime    int64                   `json:"system_uptime"` // seconds since boot
+	LoggedOnUsers   []LoggedOnUser          `json:"logged_on_users"`
+	Access          *PlatformAccess         `json:"access,omitempty"`
+	Queue           *QueueStats             `json:"queue,omitempty"`
+	Compression     *CompressionStats       `json:"compression,omitempty"`
+	Caches          []cache.Stats           `json:"caches,omitempty"` // lookup cache hit rates
+	Detection       *DetectionStats         `json:"detection,omitempty"`
+	ThreatIntel     *IOCStats               `json:"threat_intel,omitempty"`
+	Vulnerabilities *VulnerabilityStats     `json:"vulnerabilities,omitempty"`
+	Correlation     *CorrelationStats       `json:"correlation,omitempty"`
+	TimeSync        *TimeSyncStatus         `json:"time_sync,omitempty"`
+	Timestamp       time.Time               `json:"timestamp"`
+}
+
+// CompressionStats reports request body compression in heartbeats
+type CompressionStats struct {
+	Enabled   bool    `json:"enabled"`   // configured and accepted by the server
+	BytesRaw  uint64  `json:"bytes_raw"` // request bodies before compression
+	BytesSent uint64  `json:"bytes_sent"`
+	Ratio     float64 `json:"ratio"` // bytes_raw / bytes_sent
+}
+
+// LoggedOnUser is a user logged on to an interactive or RDP session
+type LoggedOnUser struct {
+	User        string    `json:"user"` // DOMAIN\user
+	SessionID   uint32    `json:"session_id"`
+	SessionType string    `json:"session_type"` // "console" or "rdp"
+	State       string    `json:"state"`        // "active", "disconnected", ...
+	LogonTime   time.Time `json:"logon_time"`
+	ClientName  string    `json:"client_name,omitempty"` // RDP client computer
+}
+
+// PlatformAccess reports whether the agent can read what it collects. On
+// macOS, TCC blocks protected data unless the agent has Full Disk Access.
+type PlatformAccess struct {
+	Root             bool     `json:"root"`
+	FullDiskAccess   string   `json:"full_disk_access"`            // "granted", "denied" or "unknown"
+	EndpointSecurity string   `json:"endpoint_security,omitempty"` // Client status, when enabled
+	Missing          []string `json:"missing,omitempty"`           // What the agent cannot read
 }
 
 // RegistrationData represents agent registration information
 type RegistrationData struct {
-	AgentID      string            `json:"agent_id"`
-	Hostname     string            `json:"hostname"`
-	FQDN         string            `json:"fqdn,omitempty"`
-	IPAddress    string            `json:"ip_address"`
-	MACAddress   string            `json:"mac_address,omitempty"`
-	OSVersion    string            `json:"os_version"`
-	OSBuild      string            `json:"os_build,omitempty"`
-	Architecture string            `json:"architecture"`
-	Domain       string            `json:"domain,omitempty"`
-	CPUModel     string            `json:"cpu_model,omitempty"`
-	CPUCores     int               `json:"cpu_cores,omitempty"`
-	TotalRAM_MB  int               `json:"total_ram_mb,omitempty"`
-	TotalDisk_GB int               `json:"total_disk_gb,omitempty"`
-	AgentVersion string            `json:"agent_version"`
-	Config       map[string]string `json:"config,omitempty"`
+	AgentID         string                   `json:"agent_id"`
+	TenantID        string                   `json:"tenant_id,omitempty"`
+	Hostname        string                   `json:"hostname"`
+	FQDN            string                   `json:"fqdn,omitempty"`
+	IPAddress       string                   `json:"ip_address"`
+	MACAddress      string                   `json:"mac_address,omitempty"`
+	NetworkAdapters []sysinfo.NetworkAdapter `json:"network_adapters,omitempty"`
+	OSVersion       string                   `json:"os_version"`
+	OSBuild         string                   `json:"os_build,omitempty"`
+	Architecture    string                   `json:"architecture"`
+	Domain          string                   `json:"domain,omitempty"`
+	CPUModel        string                   `json:"cpu_model,omitempty"`
+	CPUCores        int                      `json:"cpu_cores,omitempty"`
+	TotalRAM_MB     int                      `json:"total_ram_mb,omitempty"`
+	TotalDisk_GB    int                      `json:"total_disk_gb,omitempty"`
+	Volumes         []sysinfo.Volume         `json:"volumes,omitempty"`
+	DeviceClass     string                   `json:"device_class,omitempty"`
+	Manufacturer    string                   `json:"manufacturer,omitempty"`
+	Model           string                   `json:"model,omitempty"`
+	SerialNumber    string                   `json:"serial_number,omitempty"`
+	BIOSVersion     string                   `json:"bios_version,omitempty"`
+	ChassisType     string                   `json:"chassis_type,omitempty"`
+	Cloud           *sysinfo.CloudInstance   `json:"cloud,omitempty"`
+	Virtualization  *sysinfo.Virtualization  `json:"virtualization,omitempty"`
+	SecurityPosture *sysinfo.SecurityPosture `json:"security_posture,omitempty"`
+	Access          *PlatformAccess          `json:"access,omitempty"`
+	AgentVersion    string                   `json:"agent_version"`
+	Config          map[string]string        `json:"config,omitempty"`
+}
+
+// SecurityPostureData is sent after every full inventory scan so posture
+// changes reach the server without re-registration
+type SecurityPostureData struct {
+	AgentID     string                   `json:"agent_id"`
+	Hostname    string                   `json:"hostname"`
+	Posture     *sysinfo.SecurityPosture `json:"posture"`
+	CollectedAt time.Time                `json:"collected_at"`
 }
 
 // SeverityFromWindowsLevel converts Windows event level to our 1-5 severity scale
@@ -140,6 +230,23 @@ func SeverityFromWindowsLevel(level int) int {
 	}
 }
 
+// SeverityFromSyslogPriority converts a syslog priority (0=emerg .. 7=debug)
+// to our 1-5 severity scale
+func SeverityFromSyslogPriority(priority int) int {
+	switch {
+	case priority <= 2: // Emergency, Alert, Critical
+		return 5
+	case priority == 3: // Error
+		return 4
+	case priority == 4: // Warning
+		return 3
+	case priority == 5: // Notice
+		return 2
+	default: // Informational, Debug
+		return 1
+	}
+}
+
 // IsHighPriority checks if event should be sent immediately
 func (e *Event) IsHighPriority() bool {
 	// Critical severity
@@ -0,0 +1,65 @@
+package collector
+
+import "sync"
+
+// eventPool recycles events on high-volume paths (the Event Log render
+// path) so a busy host does not allocate an Event and its EventData map per
+// event
+var eventPool = sync.Pool{
+	New: func() any { return &Event{} },
+}
+
+// acquireEvent returns an empty event from the pool. It goes back with
+// ReleaseEvent once it has been sent.
+func acquireEvent() *Event {
+	event := eventPool.Get().(*Event)
+	event.pooled = true
+	return event
+}
+
+// ReleaseEvent returns a sent event to the pool; the event must not be used
+// afterwards. Events not taken from the pool are left to the garbage
+// collector.
+func ReleaseEvent(event *Event) {
+	if event == nil || !event.pooled {
+		return
+	}
+
+	// Keep the EventData map and its buckets for the next event
+	data := event.EventData
+	clear(data)
+	*event = Event{EventData: data}
+	eventPool.Put(event)
+}
+
+// maxInternedStrings bounds the intern table. Providers, channels and
+// computer names are a few hundred at most; anything beyond is not worth
+// keeping.
+const maxInternedStrings = 4096
+
+var (
+	internMu        sync.RWMutex
+	internedStrings = make(map[string]string)
+)
+
+// intern returns the shared copy of s, so the provider, channel and
+// computer name of every queued event point to one string instead of each
+// holding a copy from its parsed XML
+func intern(s string) string {
+	internMu.RLock()
+	shared, ok := internedStrings[s]
+	internMu.RUnlock()
+	if ok {
+		return shared
+	}
+
+	internMu.Lock()
+	defer internMu.Unlock()
+	if shared, ok := internedStrings[s]; ok {
+		return shared
+	}
+	if len(internedStrings) < maxInternedStrings {
+		internedStrings[s] = s
+	}
+	return s
+}
@@ -0,0 +1,351 @@
+package collector
+
+import (
+	"log"
+	"sync"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Bytes counted for an event on top of its strings (struct, map buckets)
+const eventOverhead = 512
+
+// Events read back from the spool per refill of the memory queue
+const spoolRefillEvents = 1000
+
+// queuedEvent is an event in the memory queue with its estimated size
+type queuedEvent struct {
+	event *Event
+	size  int64
+}
+
+// EventQueue is the agent's send queue. Events are kept in memory up to a
+// count and byte budget; once that is exhausted they spill to the disk
+// spool, and later events follow them there so order is kept until the
+// sender has caught up. Events are only dropped when the spool is full too.
+// Push never blocks, so collectors can call it from their read loops.
+type EventQueue struct {
+	mutex       sync.Mutex
+	memory      []queuedEvent
+	memoryBytes int64
+	maxEvents   int
+	maxBytes    int64
+	spool       *eventSpool // nil if the spool directory is unusable
+	closed      bool
+	ready       chan struct{}
+	dropping    bool   // the last event pushed did not fit anywhere
+	minSeverity int    // events below this are shed while degraded
+	shed        uint64 // events shed since Degrade
+	collected   uint64 // events pushed and kept, by every collector
+	projection  fieldProjection
+
+	inspectorMutex sync.RWMutex
+	inspectors     []EventInspector
+}
+
+// EventInspector examines every queued event before it is trimmed and
+// returns events to queue after it, such as detection alerts
+type EventInspector interface {
+	Inspect(event *Event) []*Event
+}
+
+// NewEventQueue creates the send queue. Without a usable spool directory
+// the queue is memory only and drops what does not fit.
+func NewEventQueue(maxEvents int, cfg *config.QueueConfig) *EventQueue {
+	q := &EventQueue{
+		maxEvents:  maxEvents,
+		maxBytes:   int64(cfg.MemoryLimitMB) * 1024 * 1024,
+		ready:      make(chan struct{}, 1),
+		projection: newFieldProjection(cfg.Projection),
+	}
+
+	spool, err := openEventSpool(cfg.SpoolDir, int64(cfg.SpoolFileMB)*1024*1024, int64(cfg.SpoolMaxMB)*1024*1024)
+	if err != nil {
+		log.Printf("Warning: Event spool unavailable, events that do not fit in memory will be dropped: %v", err)
+		return q
+	}
+	q.spool = spool
+	if !spool.empty() {
+		log.Printf("Event spool holds %d KB from the previous run", spool.size/1024)
+		q.signal()
+	}
+	return q
+}
+
+// AddInspector has every event pushed from now on inspected
+func (q *EventQueue) AddInspector(inspector EventInspector) {
+	q.inspectorMutex.Lock()
+	q.inspectors = append(q.inspectors, inspector)
+	q.inspectorMutex.Unlock()
+}
+
+// Push inspects an event, trims it to its projection profile, queues it
+// and reports whether it was kept. Events raised by inspectors are queued
+// after it. Dropped events are counted per channel.
+func (q *EventQueue) Push(event *Event) bool {
+	q.inspectorMutex.RLock()
+	inspectors := q.inspectors
+	q.inspectorMutex.RUnlock()
+
+	var raised []*Event
+	for _, inspector := range inspectors {
+		raised = append(raised, inspector.Inspect(event)...)
+	}
+
+	// Profiles are read only; trim outside the lock
+	q.projection.apply(event)
+
+	kept := q.push(event)
+	for _, extra := range raised {
+		q.push(extra)
+	}
+	return kept
+}
+
+// push queues an event, spilling to the spool or dropping it when full
+func (q *EventQueue) push(event *Event) bool {
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return false
+	}
+	if event.Severity < q.minSeverity {
+		q.shed++
+		ReleaseEvent(event)
+		return false
+	}
+
+	size := eventSize(event)
+	fits := len(q.memory) < q.maxEvents && q.memoryBytes+size <= q.maxBytes
+	if fits && (q.spool == nil || q.spool.empty()) {
+		q.memory = append(q.memory, queuedEvent{event: event, size: size})
+		q.memoryBytes += size
+		q.dropping = false
+		q.collected++
+		q.signal()
+		return true
+	}
+
+	if q.spool != nil {
+		err := q.spool.write(event)
+		if err == nil {
+			ReleaseEvent(event)
+			q.dropping = false
+			q.collected++
+			q.signal()
+			return true
+		}
+		if err != errSpoolFull {
+			log.Printf("Warning: Failed to write event spool: %v", err)
+		}
+	}
+
+	log.Printf("Warning: Event queue full, dropping event %d from %s", event.EventCode, event.Channel)
+	q.dropping = true
+	RecordDrop(event.Channel, 1)
+	ReleaseEvent(event)
+	return false
+}
+
+// Ready is signalled when events are waiting. Pop until it returns nil;
+// Ready is signalled again while events remain.
+func (q *EventQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Pop returns the oldest event, or nil if the queue is empty
+func (q *EventQueue) Pop() *Event {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.memory) == 0 && q.spool != nil {
+		q.refill()
+	}
+	if len(q.memory) == 0 {
+		return nil
+	}
+
+	item := q.memory[0]
+	q.memory[0] = queuedEvent{}
+	q.memory = q.memory[1:]
+	q.memoryBytes -= item.size
+
+	if len(q.memory) > 0 || (q.spool != nil && !q.spool.empty()) {
+		q.signal()
+	}
+	return item.event
+}
+
+// Requeue puts events the sender could not deliver back at the head of
+// the queue, in their order, to be sent again. They are older than every
+// queued event and were inspected when first pushed. Memory may go over
+// its budget by these events; what arrives meanwhile spills to the spool.
+// After Close they go ahead of the spool.
+func (q *EventQueue) Requeue(events []*Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		if q.spool != nil {
+			err := q.spool.prepend(events)
+			if err == nil {
+				for _, event := range events {
+					ReleaseEvent(event)
+				}
+				return
+			}
+			log.Printf("Warning: Failed to spool %d unsent events: %v", len(events), err)
+		}
+		for _, event := range events {
+			RecordDrop(event.Channel, 1)
+			ReleaseEvent(event)
+		}
+		return
+	}
+
+	requeued := make([]queuedEvent, len(events), len(events)+len(q.memory))
+	for i, event := range events {
+		requeued[i] = queuedEvent{event: event, size: eventSize(event)}
+		q.memoryBytes += requeued[i].size
+	}
+	q.memory = append(requeued, q.memory...)
+	q.signal()
+}
+
+// refill moves spooled events back into memory, up to half the budget so
+// new events still fit while the spool drains. Caller must hold the mutex.
+func (q *EventQueue) refill() {
+	for len(q.memory) < spoolRefillEvents && len(q.memory) < q.maxEvents && q.memoryBytes < q.maxBytes/2 {
+		event := q.spool.read()
+		if event == nil {
+			return
+		}
+		size := eventSize(event)
+		q.memory = append(q.memory, queuedEvent{event: event, size: size})
+		q.memoryBytes += size
+	}
+}
+
+// signal wakes the sender. Caller must hold the mutex.
+func (q *EventQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of events in memory
+func (q *EventQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.memory)
+}
+
+// SpoolBytes returns the size of the events waiting in the spool
+func (q *EventQueue) SpoolBytes() int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.spool == nil {
+		return 0
+	}
+	return q.spool.size
+}
+
+// Backlog returns the share of the queue's capacity that is in use, from
+// 0 to 1: the spool's when there is one, otherwise the larger of the memory
+// count and byte budgets
+func (q *EventQueue) Backlog() float64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.spool != nil && q.spool.maxBytes > 0 {
+		return min(float64(q.spool.size)/float64(q.spool.maxBytes), 1)
+	}
+	backlog := 0.0
+	if q.maxEvents > 0 {
+		backlog = float64(len(q.memory)) / float64(q.maxEvents)
+	}
+	if q.maxBytes > 0 {
+		backlog = max(backlog, float64(q.memoryBytes)/float64(q.maxBytes))
+	}
+	return min(backlog, 1)
+}
+
+// Collected returns the number of events pushed and kept, including
+// events raised by inspectors
+func (q *EventQueue) Collected() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.collected
+}
+
+// Exhausted reports whether memory and spool are full, so that events
+// are being dropped
+func (q *EventQueue) Exhausted() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.dropping
+}
+
+// Degrade sheds events below minSeverity until Restore
+func (q *EventQueue) Degrade(minSeverity int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.minSeverity = minSeverity
+	q.shed = 0
+}
+
+// Restore accepts all events again and returns the number shed
+func (q *EventQueue) Restore() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.minSeverity = 0
+	return q.shed
+}
+
+// Close stops accepting events and writes the events still in memory to
+// the spool so they are sent after a restart. They are older than every
+// spooled event, so they go ahead of them.
+func (q *EventQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+
+	if q.spool == nil {
+		return
+	}
+	events := make([]*Event, len(q.memory))
+	for i, item := range q.memory {
+		events[i] = item.event
+	}
+	if err := q.spool.prepend(events); err != nil {
+		log.Printf("Warning: Failed to spool %d events on shutdown: %v", len(events), err)
+	}
+	q.memory, q.memoryBytes = nil, 0
+	if err := q.spool.close(); err != nil {
+		log.Printf("Warning: Failed to close event spool: %v", err)
+	}
+}
+
+// eventSize estimates the memory an event holds
+func eventSize(event *Event) int64 {
+	size := len(event.Message) + len(event.RawXML) + len(event.ProcessCommandLine) +
+		len(event.ProcessPath) + len(event.FilePath) + len(event.RegistryPath) + len(event.RegistryValue)
+	for key, value := range event.EventData {
+		size += len(key) + len(value)
+	}
+	for _, keyword := range event.Keywords {
+		size += len(keyword)
+	}
+	return int64(size + eventOverhead)
+}
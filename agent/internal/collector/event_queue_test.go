@@ -0,0 +1,238 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// TestEventQueueSpoolOrder checks that events left in memory on Close come
+// back ahead of the spooled ones after a restart
+func TestEventQueueSpoolOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEvents  int
+		push       int // events 0..push-1
+		pop        int
+		pushAfter  int // further events pushed after popping
+		wantPopped []int64
+		wantAfter  []int64 // read back after the restart
+	}{
+		{
+			name:      "memory only",
+			maxEvents: 100,
+			push:      5,
+			wantAfter: []int64{0, 1, 2, 3, 4},
+		},
+		{
+			name:      "memory ahead of spool",
+			maxEvents: 3,
+			push:      10,
+			wantAfter: []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:       "refilled events ahead of unread spool",
+			maxEvents:  3,
+			push:       10,
+			pop:        4,
+			wantPopped: []int64{0, 1, 2, 3},
+			wantAfter:  []int64{4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:       "events spooled after a refill stay last",
+			maxEvents:  3,
+			push:       10,
+			pop:        4,
+			pushAfter:  2,
+			wantPopped: []int64{0, 1, 2, 3},
+			wantAfter:  []int64{4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		{
+			name:       "spool read to the end",
+			maxEvents:  3,
+			push:       6,
+			pop:        5,
+			wantPopped: []int64{0, 1, 2, 3, 4},
+			wantAfter:  []int64{5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.QueueConfig{MemoryLimitMB: 1, SpoolDir: t.TempDir(), SpoolFileMB: 1, SpoolMaxMB: 10}
+
+			q := NewEventQueue(tt.maxEvents, cfg)
+			for i := 0; i < tt.push; i++ {
+				q.Push(&Event{Channel: "Security", RecordID: int64(i)})
+			}
+			var popped []int64
+			for i := 0; i < tt.pop; i++ {
+				event := q.Pop()
+				if event == nil {
+					t.Fatalf("queue empty after %d events", i)
+				}
+				popped = append(popped, event.RecordID)
+			}
+			for i := tt.push; i < tt.push+tt.pushAfter; i++ {
+				q.Push(&Event{Channel: "Security", RecordID: int64(i)})
+			}
+			q.Close()
+
+			if !reflect.DeepEqual(popped, tt.wantPopped) {
+				t.Errorf("popped %v, want %v", popped, tt.wantPopped)
+			}
+
+			restarted := NewEventQueue(tt.maxEvents, cfg)
+			defer restarted.Close()
+			var after []int64
+			for event := restarted.Pop(); event != nil; event = restarted.Pop() {
+				after = append(after, event.RecordID)
+			}
+			if !reflect.DeepEqual(after, tt.wantAfter) {
+				t.Errorf("after restart %v, want %v", after, tt.wantAfter)
+			}
+		})
+	}
+}
+
+// TestEventQueueRequeue checks that events the sender could not deliver go
+// back ahead of everything queued, also once the queue is closed
+func TestEventQueueRequeue(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxEvents int
+		push      int // events 0..push-1
+		pop       int // popped, then requeued
+		pushAfter int // further events pushed after the requeue
+		close     bool
+		want      []int64 // popped after the requeue, or after a restart when closed
+	}{
+		{
+			name:      "ahead of memory",
+			maxEvents: 10,
+			push:      4,
+			pop:       2,
+			want:      []int64{0, 1, 2, 3},
+		},
+		{
+			name:      "ahead of spool",
+			maxEvents: 3,
+			push:      6,
+			pop:       3,
+			pushAfter: 2,
+			want:      []int64{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:      "over the memory budget",
+			maxEvents: 3,
+			push:      3,
+			pop:       3,
+			pushAfter: 3,
+			want:      []int64{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:      "after close",
+			maxEvents: 3,
+			push:      6,
+			pop:       3,
+			close:     true,
+			want:      []int64{0, 1, 2, 3, 4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.QueueConfig{MemoryLimitMB: 1, SpoolDir: t.TempDir(), SpoolFileMB: 1, SpoolMaxMB: 10}
+
+			q := NewEventQueue(tt.maxEvents, cfg)
+			for i := 0; i < tt.push; i++ {
+				q.Push(&Event{Channel: "Security", RecordID: int64(i)})
+			}
+			var unsent []*Event
+			for i := 0; i < tt.pop; i++ {
+				unsent = append(unsent, q.Pop())
+			}
+			if tt.close {
+				q.Close()
+			}
+			q.Requeue(unsent)
+			for i := tt.push; i < tt.push+tt.pushAfter; i++ {
+				q.Push(&Event{Channel: "Security", RecordID: int64(i)})
+			}
+
+			if tt.close {
+				q = NewEventQueue(tt.maxEvents, cfg)
+			}
+			defer q.Close()
+			var got []int64
+			for event := q.Pop(); event != nil; event = q.Pop() {
+				got = append(got, event.RecordID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("popped %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// raiseAlert is an inspector that raises one event per event inspected
+type raiseAlert struct{}
+
+func (raiseAlert) Inspect(event *Event) []*Event {
+	return []*Event{{Channel: "Alert", Severity: event.Severity}}
+}
+
+// TestEventQueueCollected checks that every event pushed and kept is
+// counted, whichever collector pushed it
+func TestEventQueueCollected(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxEvents int
+		noSpool   bool
+		degrade   bool
+		inspect   bool
+		close     bool
+		severity  []int // of the events pushed
+		want      uint64
+	}{
+		{name: "in memory", maxEvents: 10, severity: []int{1, 1, 1}, want: 3},
+		{name: "spilled to the spool", maxEvents: 2, severity: []int{1, 1, 1, 1, 1}, want: 5},
+		{name: "dropped when full", maxEvents: 2, noSpool: true, severity: []int{1, 1, 1, 1, 1}, want: 2},
+		{name: "shed while degraded", maxEvents: 10, degrade: true, severity: []int{1, 1, 5}, want: 1},
+		{name: "raised by inspectors", maxEvents: 10, inspect: true, severity: []int{1, 1}, want: 4},
+		{name: "after close", maxEvents: 10, close: true, severity: []int{1, 1}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.QueueConfig{MemoryLimitMB: 1, SpoolDir: t.TempDir(), SpoolFileMB: 1, SpoolMaxMB: 10}
+			if tt.noSpool {
+				cfg.SpoolDir = filepath.Join(cfg.SpoolDir, "file")
+				if err := os.WriteFile(cfg.SpoolDir, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			q := NewEventQueue(tt.maxEvents, cfg)
+			defer q.Close()
+			if tt.degrade {
+				q.Degrade(4)
+			}
+			if tt.inspect {
+				q.AddInspector(raiseAlert{})
+			}
+			if tt.close {
+				q.Close()
+			}
+
+			for _, severity := range tt.severity {
+				q.Push(&Event{Channel: "Security", Severity: severity})
+			}
+			if got := q.Collected(); got != tt.want {
+				t.Errorf("Collected() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
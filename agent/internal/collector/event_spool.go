@@ -0,0 +1,296 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const spoolFileExt = ".spool"
+
+var errSpoolFull = errors.New("event spool is full")
+
+// eventSpool keeps events that do not fit in memory as JSON lines in
+// numbered files, read back oldest first. A file is deleted once it has
+// been read. Files left by a previous run are read after a restart. On
+// shutdown the unread rest of the file being read is kept behind the
+// events prepended from memory; after a crash that file is read again from
+// the start, so a few events may be sent twice.
+type eventSpool struct {
+	dir       string
+	fileLimit int64    // a file is closed for writing at this size
+	maxBytes  int64    // total size of all files
+	files     []string // closed files waiting to be read, oldest first
+	size      int64    // bytes in all files
+	next      uint64   // sequence number of the next file
+
+	writer     *os.File
+	buffered   *bufio.Writer
+	writePath  string
+	written    int64
+	reader     *os.File
+	readBuffer *bufio.Reader
+	readSize   int64 // size of the file being read
+}
+
+// openEventSpool opens the spool directory and picks up the files a
+// previous run left behind
+func openEventSpool(dir string, fileLimit, maxBytes int64) (*eventSpool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	s := &eventSpool{dir: dir, fileLimit: fileLimit, maxBytes: maxBytes}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, spoolFileExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, spoolFileExt) || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+		s.size += info.Size()
+		if sequence >= s.next {
+			s.next = sequence + 1
+		}
+	}
+
+	// Zero-padded names sort in sequence order
+	sort.Strings(names)
+	for _, name := range names {
+		s.files = append(s.files, filepath.Join(dir, name))
+	}
+
+	return s, nil
+}
+
+// empty reports whether no events are waiting in the spool
+func (s *eventSpool) empty() bool {
+	return s.size == 0
+}
+
+// write appends an event to the spool, or returns errSpoolFull if it
+// would grow past its size limit
+func (s *eventSpool) write(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if s.size+int64(len(data)) > s.maxBytes {
+		return errSpoolFull
+	}
+
+	if s.writer == nil {
+		s.writePath = filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.next, spoolFileExt))
+		file, err := os.OpenFile(s.writePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		s.next++
+		s.writer = file
+		s.buffered = bufio.NewWriterSize(file, 64*1024)
+	}
+
+	if _, err := s.buffered.Write(data); err != nil {
+		return err
+	}
+	s.written += int64(len(data))
+	s.size += int64(len(data))
+
+	if s.written >= s.fileLimit {
+		return s.rotate()
+	}
+	return nil
+}
+
+// rotate closes the file being written so it can be read
+func (s *eventSpool) rotate() error {
+	if s.writer == nil {
+		return nil
+	}
+
+	err := s.buffered.Flush()
+	if closeErr := s.writer.Close(); err == nil {
+		err = closeErr
+	}
+	s.files = append(s.files, s.writePath)
+	s.writer, s.buffered, s.written = nil, nil, 0
+	return err
+}
+
+// read returns the oldest spooled event, or nil if the spool is empty.
+// Lines that do not parse (the last line of a file cut short by a crash)
+// are skipped.
+func (s *eventSpool) read() *Event {
+	for {
+		if s.reader == nil {
+			if len(s.files) == 0 {
+				if s.written == 0 {
+					return nil
+				}
+				// Only the file being written has events; close it for reading
+				if err := s.rotate(); err != nil {
+					log.Printf("Warning: Failed to write event spool: %v", err)
+				}
+			}
+			if err := s.openOldest(); err != nil {
+				log.Printf("Warning: Failed to read event spool file %s: %v", s.files[0], err)
+				s.removeOldest()
+				continue
+			}
+		}
+
+		line, err := s.readBuffer.ReadBytes('\n')
+		if err == nil {
+			event := &Event{}
+			if err := json.Unmarshal(line, event); err != nil {
+				continue
+			}
+			return event
+		}
+
+		// End of the file: it has been read completely
+		s.reader.Close()
+		s.reader, s.readBuffer = nil, nil
+		s.removeOldest()
+	}
+}
+
+// openOldest opens the oldest closed file for reading
+func (s *eventSpool) openOldest() error {
+	file, err := os.Open(s.files[0])
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.reader = file
+	s.readBuffer = bufio.NewReaderSize(file, 64*1024)
+	s.readSize = info.Size()
+	return nil
+}
+
+// removeOldest deletes the oldest file once it has been read
+func (s *eventSpool) removeOldest() {
+	path := s.files[0]
+	if s.readSize == 0 {
+		if info, err := os.Stat(path); err == nil {
+			s.readSize = info.Size()
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Failed to remove event spool file %s: %v", path, err)
+	}
+
+	s.size -= s.readSize
+	if s.size < 0 {
+		s.size = 0
+	}
+	s.files = s.files[1:]
+	s.readSize = 0
+}
+
+// prepend writes events ahead of everything in the spool, so events taken
+// out of it for sending keep their place across a restart. The events and
+// the unread rest of the oldest file replace that file, past the size
+// limit if need be.
+func (s *eventSpool) prepend(events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := s.rotate(); err != nil {
+		return err
+	}
+	if len(s.files) == 0 {
+		for _, event := range events {
+			if err := s.write(event); err != nil {
+				return err
+			}
+		}
+		return s.rotate()
+	}
+
+	head := s.files[0]
+	tempPath := head + ".tmp"
+	temp, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = s.writeHead(temp, events, head)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, head)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
+
+// writeHead writes events and then the unread rest of the head file
+func (s *eventSpool) writeHead(out *os.File, events []*Event, head string) error {
+	buffered := bufio.NewWriterSize(out, 64*1024)
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := buffered.Write(append(data, '\n')); err != nil {
+			return err
+		}
+		s.size += int64(len(data) + 1)
+	}
+
+	// The reader is on the head file; what it has buffered is unread too
+	rest := io.Reader(s.readBuffer)
+	if s.reader == nil {
+		file, err := os.Open(head)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		rest = file
+	}
+	if _, err := io.Copy(buffered, rest); err != nil {
+		return err
+	}
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader, s.readBuffer = nil, nil
+	}
+	return buffered.Flush()
+}
+
+// close flushes the file being written and closes the spool. Unread
+// events stay on disk for the next run.
+func (s *eventSpool) close() error {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader, s.readBuffer = nil, nil
+	}
+	return s.rotate()
+}
@@ -11,12 +11,14 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
 
-	"siem-agent/internal/config"
-	"siem-agent/internal/sysinfo"
+	"github.com/siem/agent/internal/config"
+	"github.com/siem/agent/internal/sysinfo"
 )
 
 var (
@@ -26,6 +28,7 @@ var (
 	procEvtClose               = wevtapi.NewProc("EvtClose")
 	procEvtNext                = wevtapi.NewProc("EvtNext")
 	procEvtCreateRenderContext = wevtapi.NewProc("EvtCreateRenderContext")
+	procEvtOpenSession         = wevtapi.NewProc("EvtOpenSession")
 )
 
 const (
@@ -34,16 +37,61 @@ const (
 	EvtRenderEventValues       = 0
 )
 
+// renderBufferSize fits all but the largest events (UTF-16 code units);
+// larger ones are rendered into a buffer of their own
+const renderBufferSize = 32768
+
+// Buffers reused across events: EvtRender output, its UTF-8 conversion and
+// the parsed XML with its Data slices
+var (
+	renderBufferPool = sync.Pool{
+		New: func() any { buffer := make([]uint16, renderBufferSize); return &buffer },
+	}
+	xmlBufferPool = sync.Pool{
+		New: func() any { buffer := make([]byte, 0, renderBufferSize); return &buffer },
+	}
+	xmlEventPool = sync.Pool{
+		New: func() any { return &XMLEvent{} },
+	}
+)
+
 // EventLogCollector collects events from Windows Event Log
 type EventLogCollector struct {
 	config     *config.Config
 	sysInfo    *sysinfo.SystemInfo
 	agentID    string
 	channels   []string
-	eventQueue chan *Event
+	eventQueue *EventQueue
 	wg         sync.WaitGroup
 	stopChan   chan struct{}
 	mu         sync.Mutex
+
+	// Set by Stop to wake the channel goroutines waiting for events
+	stopEvent windows.Handle
+
+	// Rendered events are parsed by a pool of Performance.WorkerThreads
+	// workers shared by all channels
+	parseJobs chan *parseJob
+	workers   sync.WaitGroup
+
+	// Render context for lean extraction, 0 unless EventLog.Lean is set
+	leanContext uintptr
+
+	// Position delivered in each channel, kept across restarts, and the
+	// keys of the channels read (see watermarkKey)
+	bookmarks    *eventLogBookmarks
+	bookmarkKeys map[string]bool
+}
+
+// parseJob is a rendered event waiting for a parsing worker. event is
+// set (nil if the event is dropped) before done is signalled. Events
+// extracted in lean mode arrive with event set and are not parsed.
+type parseJob struct {
+	xmlData string
+	channel string
+	remote  *config.RemoteEventLogHost // nil for the local log
+	event   *Event
+	done    *sync.WaitGroup
 }
 
 // XMLEvent represents parsed Windows Event XML
@@ -88,99 +136,245 @@ type XMLEvent struct {
 	} `xml:"UserData"`
 }
 
+// reset clears the event for reuse, keeping the Data slices' capacity
+func (x *XMLEvent) reset() {
+	data, userData := x.EventData.Data[:0], x.UserData.Data[:0]
+	*x = XMLEvent{}
+	x.EventData.Data, x.UserData.Data = data, userData
+}
+
 // NewEventLogCollector creates a new Event Log collector
-func NewEventLogCollector(cfg *config.Config, agentID string, eventQueue chan *Event) (*EventLogCollector, error) {
+func NewEventLogCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*EventLogCollector, error) {
 	sysInfo, err := sysinfo.Gather()
 	if err != nil {
 		return nil, fmt.Errorf("failed to gather system info: %w", err)
 	}
 
-	channels := cfg.EventLog.GetEnabledChannels()
-	if len(channels) == 0 {
+	var channels []string
+	for _, channel := range cfg.EventLog.GetEnabledChannels() {
+		channels = append(channels, channel.Name)
+	}
+	if len(channels) == 0 && len(cfg.EventLog.RemoteHosts) == 0 {
 		return nil, fmt.Errorf("no event log channels enabled")
 	}
 
-	return &EventLogCollector{
+	c := &EventLogCollector{
 		config:     cfg,
 		sysInfo:    sysInfo,
 		agentID:    agentID,
 		channels:   channels,
 		eventQueue: eventQueue,
 		stopChan:   make(chan struct{}),
-	}, nil
+		parseJobs:  make(chan *parseJob, cfg.Performance.WorkerThreads),
+		bookmarks:  loadEventLogBookmarks(cfg.EventLog.BookmarkFile),
+	}
+	c.bookmarkKeys = make(map[string]bool)
+	for _, channel := range channels {
+		c.bookmarkKeys[bookmarkKey(channel, nil)] = true
+	}
+	for i := range cfg.EventLog.RemoteHosts {
+		remote := &cfg.EventLog.RemoteHosts[i]
+		for _, channel := range remote.Channels {
+			c.bookmarkKeys[bookmarkKey(channel, remote)] = true
+		}
+	}
+
+	if c.stopEvent, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		return nil, fmt.Errorf("failed to create stop event: %w", err)
+	}
+
+	if cfg.EventLog.Lean {
+		if c.leanContext, err = createLeanContext(); err != nil {
+			log.Printf("Warning: Lean event extraction unavailable, rendering all events as XML: %v", err)
+		}
+	}
+
+	return c, nil
 }
 
 // Start begins collecting events from all enabled channels
 func (c *EventLogCollector) Start() error {
-	log.Printf("Starting Event Log collector for %d channels", len(c.channels))
+	workers := c.config.Performance.WorkerThreads
+	log.Printf("Starting Event Log collector for %d channels (%d parsing workers)", len(c.channels), workers)
+
+	for i := 0; i < workers; i++ {
+		c.workers.Add(1)
+		go c.parseWorker()
+	}
 
 	for _, channel := range c.channels {
 		c.wg.Add(1)
 		go c.collectFromChannel(channel)
 	}
 
+	for i := range c.config.EventLog.RemoteHosts {
+		c.wg.Add(1)
+		go c.collectFromRemoteHost(&c.config.EventLog.RemoteHosts[i])
+	}
+
 	return nil
 }
 
 // Stop stops the collector
 func (c *EventLogCollector) Stop() {
 	close(c.stopChan)
+	windows.SetEvent(c.stopEvent)
 	c.wg.Wait()
+	windows.CloseHandle(c.stopEvent)
+
+	// The channel goroutines have returned, nothing submits jobs any more
+	close(c.parseJobs)
+	c.workers.Wait()
+
+	if c.leanContext != 0 {
+		procEvtClose.Call(c.leanContext)
+	}
 	log.Println("Event Log collector stopped")
 }
 
+// parseWorker parses rendered events until the collector stops
+func (c *EventLogCollector) parseWorker() {
+	defer c.workers.Done()
+
+	for job := range c.parseJobs {
+		job.event = c.parseEvent(job.xmlData, job.channel, job.remote)
+		job.done.Done()
+	}
+}
+
 // collectFromChannel collects events from a specific channel
 func (c *EventLogCollector) collectFromChannel(channel string) {
 	defer c.wg.Done()
 
 	log.Printf("Starting collection from channel: %s", channel)
 
+	if err := c.subscribe(0, channel, nil); err != nil {
+		log.Printf("Error collecting from channel %s: %v", channel, err)
+	}
+}
+
+// CheckEventLogChannel subscribes to a local channel and closes the
+// subscription, to test that the agent's account can read it
+func CheckEventLogChannel(channel string) error {
+	channelPtr, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return fmt.Errorf("invalid channel name: %w", err)
+	}
+	signalEvent, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create signal event: %w", err)
+	}
+	defer windows.CloseHandle(signalEvent)
+
+	ret, _, callErr := procEvtSubscribe.Call(
+		0, // local
+		uintptr(signalEvent),
+		uintptr(unsafe.Pointer(channelPtr)),
+		0, 0, 0, 0,
+		EvtSubscribeToFutureEvents,
+	)
+	if ret == 0 {
+		return fmt.Errorf("failed to subscribe: %v", callErr)
+	}
+	procEvtClose.Call(ret)
+	return nil
+}
+
+// subscribe reads a channel of the local log (session 0) or a remote host
+// until the collector stops, resuming after the channel's saved bookmark.
+// Remote subscriptions also return when reading fails, so the caller can
+// reopen the session.
+func (c *EventLogCollector) subscribe(session uintptr, channel string, remote *config.RemoteEventLogHost) error {
 	// Subscribe to events
 	channelPtr, err := syscall.UTF16PtrFromString(channel)
 	if err != nil {
-		log.Printf("Error converting channel name %s: %v", channel, err)
-		return
+		return fmt.Errorf("invalid channel name: %w", err)
+	}
+
+	key := bookmarkKey(channel, remote)
+	bookmark, flags, query, err := c.openBookmark(key, remote)
+	if err != nil {
+		return err
+	}
+	defer procEvtClose.Call(bookmark)
+
+	var queryPtr *uint16
+	if query != "" {
+		if queryPtr, err = syscall.UTF16PtrFromString(query); err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+	}
+
+	// Signalled by the subscription when events are available
+	signalEvent, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create signal event: %w", err)
 	}
+	defer windows.CloseHandle(signalEvent)
 
 	var hSubscription uintptr
-	ret, _, _ := procEvtSubscribe.Call(
-		0,                            // Session
-		0,                            // SignalEvent
+	ret, _, callErr := procEvtSubscribe.Call(
+		session,              // Session (0 = local)
+		uintptr(signalEvent), // SignalEvent
 		uintptr(unsafe.Pointer(channelPtr)),
-		0,                            // Query (null = all events)
-		0,                            // Bookmark
-		0,                            // Context
-		0,                            // Callback
-		EvtSubscribeToFutureEvents,   // Flags
+		uintptr(unsafe.Pointer(queryPtr)), // Query (null = all events)
+		bookmark,                          // Bookmark (used with EvtSubscribeStartAfterBookmark)
+		0,                                 // Context
+		0,                                 // Callback
+		flags,                             // Flags
 	)
 
 	if ret == 0 {
-		log.Printf("Failed to subscribe to channel %s", channel)
-		return
+		return fmt.Errorf("failed to subscribe: %v", callErr)
 	}
 	defer procEvtClose.Call(ret)
 	hSubscription = ret
 
-	// Process events
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	// A remote host that goes away does not signal, so remote
+	// subscriptions are polled to notice the broken connection
+	timeout := uint32(windows.INFINITE)
+	if remote != nil {
+		timeout = uint32(remoteEventLogPoll / time.Millisecond)
+	}
 
+	// Sleep until events arrive or the collector stops. The signal is reset
+	// before draining, so events arriving during the drain set it again.
+	handles := []windows.Handle{signalEvent, c.stopEvent}
 	for {
-		select {
-		case <-c.stopChan:
-			return
-		case <-ticker.C:
-			c.processEvents(hSubscription, channel)
+		result, err := windows.WaitForMultipleObjects(handles, false, timeout)
+		if err != nil {
+			return fmt.Errorf("failed to wait for events: %w", err)
+		}
+		if result != windows.WAIT_OBJECT_0 && result != uint32(windows.WAIT_TIMEOUT) {
+			return nil // stopEvent
+		}
+
+		windows.ResetEvent(signalEvent)
+		for {
+			more, err := c.processEvents(hSubscription, channel, remote)
+			if err != nil && remote != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+			select {
+			case <-c.stopChan:
+				return nil
+			default:
+			}
 		}
 	}
 }
 
-// processEvents processes available events from subscription
-func (c *EventLogCollector) processEvents(hSubscription uintptr, channel string) {
+// processEvents queues the events available from a subscription and
+// reports whether more may be waiting. Reading errors other than running
+// out of events are returned. The bookmark moves once they are delivered.
+func (c *EventLogCollector) processEvents(hSubscription uintptr, channel string, remote *config.RemoteEventLogHost) (bool, error) {
 	var events [100]uintptr
 	var returned uint32
 
-	ret, _, _ := procEvtNext.Call(
+	ret, _, callErr := procEvtNext.Call(
 		hSubscription,
 		uintptr(len(events)),
 		uintptr(unsafe.Pointer(&events[0])),
@@ -189,92 +383,165 @@ func (c *EventLogCollector) processEvents(hSubscription uintptr, channel string)
 		uintptr(unsafe.Pointer(&returned)),
 	)
 
-	if ret == 0 || returned == 0 {
-		return
+	if ret == 0 {
+		if callErr == windows.ERROR_NO_MORE_ITEMS || callErr == windows.ERROR_TIMEOUT {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read events: %v", callErr)
+	}
+	if returned == 0 {
+		return false, nil
 	}
 
+	// Render on this goroutine; the handles are closed right away. Remote
+	// events are always rendered as XML, which names the source computer.
+	jobs := make([]parseJob, 0, returned)
 	for i := uint32(0); i < returned; i++ {
-		if events[i] != 0 {
-			c.processEvent(events[i], channel)
-			procEvtClose.Call(events[i])
+		if events[i] == 0 {
+			continue
+		}
+		event, handled := (*Event)(nil), false
+		if remote == nil {
+			event, handled = c.renderLean(events[i], channel)
+		}
+		if handled {
+			if event != nil {
+				jobs = append(jobs, parseJob{event: event})
+			}
+		} else if xmlData := c.renderEventAsXML(events[i]); xmlData != "" {
+			jobs = append(jobs, parseJob{xmlData: xmlData, channel: channel, remote: remote})
 		}
+		procEvtClose.Call(events[i])
 	}
-}
 
-// processEvent processes a single event
-func (c *EventLogCollector) processEvent(hEvent uintptr, channel string) {
-	// Render event as XML
-	xmlData := c.renderEventAsXML(hEvent)
-	if xmlData == "" {
-		return
+	// Parse the batch in parallel, then queue it in channel order
+	var done sync.WaitGroup
+	for i := range jobs {
+		if jobs[i].event != nil {
+			continue // extracted in lean mode
+		}
+		done.Add(1)
+		jobs[i].done = &done
+		c.parseJobs <- &jobs[i]
 	}
+	done.Wait()
+
+	for _, job := range jobs {
+		if job.event == nil {
+			continue
+		}
+		c.eventQueue.Push(job.event)
+	}
+	return true, nil
+}
 
-	// Parse XML
-	var xmlEvent XMLEvent
-	if err := xml.Unmarshal([]byte(xmlData), &xmlEvent); err != nil {
+// parseEvent parses and enriches a rendered event. It returns nil for
+// malformed and excluded events.
+func (c *EventLogCollector) parseEvent(xmlData, channel string, remote *config.RemoteEventLogHost) *Event {
+	// Parse XML, reading the string in place
+	xmlEvent := xmlEventPool.Get().(*XMLEvent)
+	defer func() {
+		xmlEvent.reset()
+		xmlEventPool.Put(xmlEvent)
+	}()
+	if err := xml.NewDecoder(strings.NewReader(xmlData)).Decode(xmlEvent); err != nil {
 		log.Printf("Failed to parse event XML: %v", err)
-		return
+		return nil
 	}
 
 	// Check if event should be excluded
 	if c.config.EventLog.IsEventIDExcluded(xmlEvent.System.EventID) {
-		return
+		return nil
 	}
 
 	// Parse event time
 	eventTime, _ := time.Parse(time.RFC3339Nano, xmlEvent.System.TimeCreated.SystemTime)
 
-	// Create normalized event
-	event := &Event{
-		AgentID:     c.agentID,
-		Computer:    c.sysInfo.Hostname,
-		FQDN:        c.sysInfo.FQDN,
-		IPAddress:   c.sysInfo.IPAddress,
-		SourceType:  c.getSourceType(channel, xmlEvent.System.Provider.Name),
-		EventCode:   xmlEvent.System.EventID,
-		EventTime:   eventTime,
-		RecordID:    xmlEvent.System.EventRecordID,
-		Channel:     channel,
-		Provider:    xmlEvent.System.Provider.Name,
-		Severity:    SeverityFromWindowsLevel(xmlEvent.System.Level),
-		RawXML:      xmlData,
-		CollectedAt: time.Now(),
+	// Create normalized event; the sender releases it back to the pool
+	event := acquireEvent()
+	event.AgentID = c.agentID
+	event.Computer = c.sysInfo.Hostname
+	event.FQDN = c.sysInfo.FQDN
+	event.IPAddress = c.sysInfo.IPAddress
+	event.SourceType = c.getSourceType(channel, xmlEvent.System.Provider.Name)
+	event.EventCode = xmlEvent.System.EventID
+	event.EventTime = eventTime
+	event.RecordID = xmlEvent.System.EventRecordID
+	event.Channel = channel
+	event.Provider = intern(xmlEvent.System.Provider.Name)
+	event.Severity = SeverityFromWindowsLevel(xmlEvent.System.Level)
+	event.RawXML = xmlData
+	event.CollectedAt = time.Now()
+	if remote != nil {
+		attributeRemoteEvent(event, remote.Host, xmlEvent.System.Computer, c.sysInfo.Hostname)
 	}
 
 	// Extract event data fields
-	c.extractEventData(event, &xmlEvent)
+	c.extractEventData(event, xmlEvent)
 
-	// Send to queue
-	select {
-	case c.eventQueue <- event:
-	case <-c.stopChan:
-		return
-	default:
-		log.Printf("Warning: Event queue full, dropping event %d", event.EventCode)
-	}
+	return event
 }
 
 // renderEventAsXML renders event handle as XML string
 func (c *EventLogCollector) renderEventAsXML(hEvent uintptr) string {
+	pooled := renderBufferPool.Get().(*[]uint16)
+	defer renderBufferPool.Put(pooled)
+
+	buffer := *pooled
+	bufferUsed, ok := renderXML(hEvent, buffer)
+	if !ok && bufferUsed > uint32(len(buffer)*2) {
+		// Too large for the pooled buffer; bufferUsed is the size needed
+		buffer = make([]uint16, bufferUsed/2)
+		bufferUsed, ok = renderXML(hEvent, buffer)
+	}
+	if !ok {
+		return ""
+	}
+
+	// Convert UTF-16 to string
+	return utf16ToString(buffer[:bufferUsed/2])
+}
+
+// renderXML renders an event into buffer, returning the bytes used (or
+// needed, if the buffer is too small)
+func renderXML(hEvent uintptr, buffer []uint16) (uint32, bool) {
 	var bufferUsed, propertyCount uint32
-	var buffer [65536]byte
 
 	ret, _, _ := procEvtRender.Call(
 		0, // Context
 		hEvent,
 		EvtRenderEventXml,
-		uintptr(len(buffer)),
+		uintptr(len(buffer)*2),
 		uintptr(unsafe.Pointer(&buffer[0])),
 		uintptr(unsafe.Pointer(&bufferUsed)),
 		uintptr(unsafe.Pointer(&propertyCount)),
 	)
 
-	if ret == 0 {
-		return ""
+	return bufferUsed, ret != 0
+}
+
+// utf16ToString converts NUL-terminated UTF-16 to a string through a pooled
+// UTF-8 buffer, allocating only the string itself
+func utf16ToString(s []uint16) string {
+	pooled := xmlBufferPool.Get().(*[]byte)
+	defer xmlBufferPool.Put(pooled)
+
+	buffer := (*pooled)[:0]
+	for i := 0; i < len(s) && s[i] != 0; i++ {
+		r := rune(s[i])
+		if utf16.IsSurrogate(r) && i+1 < len(s) {
+			if pair := utf16.DecodeRune(r, rune(s[i+1])); pair != utf8.RuneError {
+				r = pair
+				i++
+			}
+		}
+		buffer = utf8.AppendRune(buffer, r) // lone surrogates become U+FFFD
+	}
+	if cap(buffer) <= 4*renderBufferSize {
+		*pooled = buffer // an outsized event's buffer is not kept
 	}
 
-	// Convert UTF-16 to string
-	return windows.UTF16ToString((*[32768]uint16)(unsafe.Pointer(&buffer[0]))[:bufferUsed/2])
+	return string(buffer)
 }
 
 // getSourceType determines source type based on channel and provider
@@ -302,7 +569,11 @@ func (c *EventLogCollector) getSourceType(channel, provider string) string {
 
 // extractEventData extracts relevant fields from event data
 func (c *EventLogCollector) extractEventData(event *Event, xmlEvent *XMLEvent) {
-	eventData := make(map[string]string)
+	// Pooled events keep their (cleared) map
+	eventData := event.EventData
+	if eventData == nil {
+		eventData = make(map[string]string, len(xmlEvent.EventData.Data))
+	}
 
 	// Extract from EventData
 	for _, data := range xmlEvent.EventData.Data {
@@ -440,9 +711,9 @@ func (c *EventLogCollector) extractEventData(event *Event, xmlEvent *XMLEvent) {
 
 		case 3: // Network connection
 			event.SourceIP = eventData["SourceIp"]
-			event.TargetIP = eventData["DestinationIp"]
-			event.SourcePort = eventData["SourcePort"]
-			event.TargetPort = eventData["DestinationPort"]
+			event.DestinationIP = eventData["DestinationIp"]
+			event.SourcePort, _ = strconv.Atoi(eventData["SourcePort"])
+			event.DestinationPort, _ = strconv.Atoi(eventData["DestinationPort"])
 			event.ProcessName = eventData["Image"]
 			event.TargetUser = eventData["User"]
 			event.EventData["Protocol"] = eventData["Protocol"]
@@ -536,8 +807,8 @@ func (c *EventLogCollector) generateMessage(event *Event, eventData map[string]s
 			if protocol == "" {
 				protocol = "TCP"
 			}
-			return fmt.Sprintf("Sysmon: Network connection: %s -> %s:%s (%s, Process: %s)",
-				event.SourceIP, event.TargetIP, event.TargetPort, protocol, event.ProcessName)
+			return fmt.Sprintf("Sysmon: Network connection: %s -> %s:%d (%s, Process: %s)",
+				event.SourceIP, event.DestinationIP, event.DestinationPort, protocol, event.ProcessName)
 		case 11:
 			return fmt.Sprintf("Sysmon FIM: File created: %s (Process: %s)",
 				event.FilePath, event.ProcessName)
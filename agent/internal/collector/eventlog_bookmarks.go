@@ -0,0 +1,180 @@
+//go:build windows
+
+package collector
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/siem/agent/internal/config"
+)
+
+var procEvtCreateBookmark = wevtapi.NewProc("EvtCreateBookmark")
+
+const (
+	EvtSubscribeStartAtOldestRecord = 2
+	EvtSubscribeStartAfterBookmark  = 3
+)
+
+// Bookmarks are written at most this often while events are delivered,
+// and always when the agent stops
+const eventLogBookmarkSaveInterval = 5 * time.Second
+
+// eventLogBookmarks keeps the position reached in each Event Log channel
+// across restarts, so collection resumes after the last event delivered
+// instead of at the events logged after the agent started. The position
+// only moves once the server has accepted an event: events still queued
+// when the agent stops, or lost with the queue, are read again. Bookmarks
+// are kept as the XML EvtCreateBookmark takes, by channel and, for remote
+// hosts, by host\channel.
+type eventLogBookmarks struct {
+	path string
+
+	mu      sync.Mutex
+	marks   map[string]string
+	dirty   bool
+	savedAt time.Time
+}
+
+// loadEventLogBookmarks reads the saved bookmarks; a missing or unreadable
+// file means every channel starts fresh
+func loadEventLogBookmarks(path string) *eventLogBookmarks {
+	b := &eventLogBookmarks{
+		path:  path,
+		marks: make(map[string]string),
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &b.marks); err != nil {
+			log.Printf("Warning: Failed to read Event Log bookmarks: %v", err)
+			b.marks = make(map[string]string)
+		}
+	}
+	return b
+}
+
+// get returns the saved bookmark XML of a channel, or ""
+func (b *eventLogBookmarks) get(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.marks[key]
+}
+
+// advance moves a channel's bookmark to a delivered event. A cleared log
+// numbers its records from 1 again, so the last event delivered counts,
+// not the highest RecordID.
+func (b *eventLogBookmarks) advance(key, channel string, recordID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if bookmarkXML := eventLogBookmarkXML(channel, recordID); bookmarkXML != b.marks[key] {
+		b.marks[key] = bookmarkXML
+		b.dirty = true
+	}
+}
+
+// flush writes changed bookmarks. Unless force is set, bookmarks written
+// less than eventLogBookmarkSaveInterval ago are left for a later flush.
+func (b *eventLogBookmarks) flush(force bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.dirty || (!force && time.Since(b.savedAt) < eventLogBookmarkSaveInterval) {
+		return
+	}
+	b.savedAt = time.Now()
+
+	data, err := json.MarshalIndent(b.marks, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(b.path), 0700); err == nil {
+			err = os.WriteFile(b.path, data, 0600)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to save Event Log bookmarks: %v", err)
+		return
+	}
+	b.dirty = false
+}
+
+// eventLogBookmarkXML renders a bookmark as EvtRender does for a bookmark
+// handle positioned on the record
+func eventLogBookmarkXML(channel string, recordID int64) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(channel))
+	return fmt.Sprintf("<BookmarkList>\r\n  <Bookmark Channel='%s' RecordId='%d' IsCurrent='true'/>\r\n</BookmarkList>",
+		escaped.String(), recordID)
+}
+
+// Delivered moves the bookmarks of the collector's channels to the events
+// the server has accepted
+func (c *EventLogCollector) Delivered(events []*Event) {
+	for _, event := range events {
+		key := watermarkKey(event)
+		if event.RecordID > 0 && c.bookmarkKeys[key] {
+			c.bookmarks.advance(key, event.Channel, event.RecordID)
+		}
+	}
+	c.bookmarks.flush(false)
+}
+
+// SaveBookmarks writes the bookmarks; called once the last events have
+// been sent when the agent stops
+func (c *EventLogCollector) SaveBookmarks() {
+	c.bookmarks.flush(true)
+}
+
+// bookmarkKey identifies a channel's bookmark; remote hosts have their own
+func bookmarkKey(channel string, remote *config.RemoteEventLogHost) string {
+	if remote != nil {
+		return remote.Host + `\` + channel
+	}
+	return channel
+}
+
+// openBookmark creates the bookmark a subscription starts after and returns
+// the subscription flags and query to start with. A channel with a saved
+// bookmark resumes after it. Otherwise the subscription starts at future
+// events, or with EventLog.BackfillHours set reads the events of that
+// window first; a custom remote query cannot be combined with the window,
+// so those hosts start at future events.
+func (c *EventLogCollector) openBookmark(key string, remote *config.RemoteEventLogHost) (uintptr, uintptr, string, error) {
+	query := ""
+	if remote != nil {
+		query = remote.Query
+	}
+
+	if saved := c.bookmarks.get(key); saved != "" {
+		savedPtr, err := syscall.UTF16PtrFromString(saved)
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("invalid bookmark: %w", err)
+		}
+		bookmark, _, callErr := procEvtCreateBookmark.Call(uintptr(unsafe.Pointer(savedPtr)))
+		if bookmark != 0 {
+			return bookmark, EvtSubscribeStartAfterBookmark, query, nil
+		}
+		log.Printf("Warning: Discarding unreadable Event Log bookmark for %s: %v", key, callErr)
+	}
+
+	bookmark, _, callErr := procEvtCreateBookmark.Call(0)
+	if bookmark == 0 {
+		return 0, 0, "", fmt.Errorf("failed to create bookmark: %v", callErr)
+	}
+
+	hours := c.config.EventLog.BackfillHours
+	if hours <= 0 || query != "" {
+		return bookmark, EvtSubscribeToFutureEvents, query, nil
+	}
+	log.Printf("No bookmark for %s, collecting the last %d hours", key, hours)
+	window := time.Duration(hours) * time.Hour
+	query = fmt.Sprintf("*[System[TimeCreated[timediff(@SystemTime) <= %d]]]", window.Milliseconds())
+	return bookmark, EvtSubscribeStartAtOldestRecord, query, nil
+}
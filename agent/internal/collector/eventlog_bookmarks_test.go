@@ -0,0 +1,90 @@
+//go:build windows
+
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEventLogBookmarkXML(t *testing.T) {
+	tests := []struct {
+		channel  string
+		recordID int64
+		want     string
+	}{
+		{"Security", 42, "<BookmarkList>\r\n  <Bookmark Channel='Security' RecordId='42' IsCurrent='true'/>\r\n</BookmarkList>"},
+		{"Microsoft-Windows-Sysmon/Operational", 7, "<BookmarkList>\r\n  <Bookmark Channel='Microsoft-Windows-Sysmon/Operational' RecordId='7' IsCurrent='true'/>\r\n</BookmarkList>"},
+		{"It's<odd>", 1, "<BookmarkList>\r\n  <Bookmark Channel='It&#39;s&lt;odd&gt;' RecordId='1' IsCurrent='true'/>\r\n</BookmarkList>"},
+	}
+
+	for _, tt := range tests {
+		if got := eventLogBookmarkXML(tt.channel, tt.recordID); got != tt.want {
+			t.Errorf("eventLogBookmarkXML(%q, %d) = %q, want %q", tt.channel, tt.recordID, got, tt.want)
+		}
+	}
+}
+
+// TestEventLogBookmarksDelivered checks that only delivered events of the
+// collector's channels move the bookmarks
+func TestEventLogBookmarksDelivered(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*Event
+		want   map[string]int64 // RecordId by bookmark key
+	}{
+		{
+			name:   "last delivered event",
+			events: []*Event{{Channel: "Security", RecordID: 10}, {Channel: "Security", RecordID: 11}},
+			want:   map[string]int64{"Security": 11},
+		},
+		{
+			name:   "cleared log",
+			events: []*Event{{Channel: "Security", RecordID: 900}, {Channel: "Security", RecordID: 2}},
+			want:   map[string]int64{"Security": 2},
+		},
+		{
+			name:   "remote host kept apart",
+			events: []*Event{{Channel: "Security", RecordID: 5}, {Channel: "Security", RemoteHost: "dc01", RecordID: 70}},
+			want:   map[string]int64{"Security": 5, `dc01\Security`: 70},
+		},
+		{
+			name:   "other channels and hosts ignored",
+			events: []*Event{{Channel: "Application", RecordID: 5}, {Channel: "Security", RemoteHost: "dc02", RecordID: 5}, {Channel: "Security"}},
+			want:   map[string]int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "eventlog_bookmarks.json")
+			c := &EventLogCollector{
+				bookmarks:    loadEventLogBookmarks(path),
+				bookmarkKeys: map[string]bool{"Security": true, `dc01\Security`: true},
+			}
+			c.Delivered(tt.events)
+			c.SaveBookmarks()
+
+			want := make(map[string]string)
+			for key, recordID := range tt.want {
+				want[key] = eventLogBookmarkXML("Security", recordID)
+			}
+
+			saved := make(map[string]string)
+			if data, err := os.ReadFile(path); err == nil {
+				if err := json.Unmarshal(data, &saved); err != nil {
+					t.Fatalf("invalid bookmarks file: %v", err)
+				}
+			}
+			if !reflect.DeepEqual(saved, want) {
+				t.Errorf("saved %v, want %v", saved, want)
+			}
+			if reloaded := loadEventLogBookmarks(path); !reflect.DeepEqual(reloaded.marks, want) {
+				t.Errorf("reloaded %v, want %v", reloaded.marks, want)
+			}
+		})
+	}
+}
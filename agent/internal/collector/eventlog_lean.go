@@ -0,0 +1,407 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Lean mode renders the highest-volume events (logons and process
+// creation on domain controllers, Sysmon process and network events) as
+// values through one render context instead of XML. The fields are read
+// straight from the render buffer: no XML is parsed, no EventData map is
+// built and RawXML is not kept. Other events take the XML path.
+
+const EvtRenderContextValues = 0
+
+const (
+	securityAuditingProvider = "Microsoft-Windows-Security-Auditing"
+	sysmonProvider           = "Microsoft-Windows-Sysmon"
+)
+
+// EVT_VARIANT types (EVT_VARIANT_TYPE) read by lean extraction
+const (
+	evtVarTypeNull     = 0
+	evtVarTypeString   = 1
+	evtVarTypeSByte    = 3
+	evtVarTypeByte     = 4
+	evtVarTypeInt16    = 5
+	evtVarTypeUInt16   = 6
+	evtVarTypeInt32    = 7
+	evtVarTypeUInt32   = 8
+	evtVarTypeInt64    = 9
+	evtVarTypeUInt64   = 10
+	evtVarTypeBoolean  = 13
+	evtVarTypeGuid     = 15
+	evtVarTypeFileTime = 17
+	evtVarTypeSid      = 19
+	evtVarTypeHexInt32 = 20
+	evtVarTypeHexInt64 = 21
+
+	evtVarTypeMask = 0x7f
+)
+
+// evtVariant is EVT_VARIANT: an 8-byte value (or pointer into the render
+// buffer), an array count and the type
+type evtVariant struct {
+	value uint64
+	count uint32
+	kind  uint32
+}
+
+// Values of the lean render context, in XPath order
+const (
+	leanProvider = iota
+	leanEventID
+	leanLevel
+	leanTimeCreated
+	leanRecordID
+	leanExecutionProcessID
+
+	// EventData fields used by the extractors
+	leanSubjectUserName
+	leanSubjectDomainName
+	leanSubjectLogonID
+	leanTargetUserName
+	leanTargetDomainName
+	leanTargetLogonID
+	leanWorkstationName
+	leanIPAddress
+	leanAuthenticationPackageName
+	leanLogonType
+	leanFailureReason
+	leanNewProcessName
+	leanNewProcessID
+	leanCommandLine
+	leanProcessID
+	leanImage
+	leanUser
+	leanParentImage
+	leanParentProcessID
+	leanHashes
+	leanProtocol
+	leanInitiated
+	leanSourceIP
+	leanSourcePort
+	leanDestinationIP
+	leanDestinationPort
+
+	leanValueCount
+)
+
+var leanPaths = [leanValueCount]string{
+	leanProvider:           "Event/System/Provider/@Name",
+	leanEventID:            "Event/System/EventID",
+	leanLevel:              "Event/System/Level",
+	leanTimeCreated:        "Event/System/TimeCreated/@SystemTime",
+	leanRecordID:           "Event/System/EventRecordID",
+	leanExecutionProcessID: "Event/System/Execution/@ProcessID",
+
+	leanSubjectUserName:           leanData("SubjectUserName"),
+	leanSubjectDomainName:         leanData("SubjectDomainName"),
+	leanSubjectLogonID:            leanData("SubjectLogonId"),
+	leanTargetUserName:            leanData("TargetUserName"),
+	leanTargetDomainName:          leanData("TargetDomainName"),
+	leanTargetLogonID:             leanData("TargetLogonId"),
+	leanWorkstationName:           leanData("WorkstationName"),
+	leanIPAddress:                 leanData("IpAddress"),
+	leanAuthenticationPackageName: leanData("AuthenticationPackageName"),
+	leanLogonType:                 leanData("LogonType"),
+	leanFailureReason:             leanData("FailureReason"),
+	leanNewProcessName:            leanData("NewProcessName"),
+	leanNewProcessID:              leanData("NewProcessId"),
+	leanCommandLine:               leanData("CommandLine"),
+	leanProcessID:                 leanData("ProcessId"),
+	leanImage:                     leanData("Image"),
+	leanUser:                      leanData("User"),
+	leanParentImage:               leanData("ParentImage"),
+	leanParentProcessID:           leanData("ParentProcessId"),
+	leanHashes:                    leanData("Hashes"),
+	leanProtocol:                  leanData("Protocol"),
+	leanInitiated:                 leanData("Initiated"),
+	leanSourceIP:                  leanData("SourceIp"),
+	leanSourcePort:                leanData("SourcePort"),
+	leanDestinationIP:             leanData("DestinationIp"),
+	leanDestinationPort:           leanData("DestinationPort"),
+}
+
+// leanData returns the XPath of a named EventData field
+func leanData(name string) string {
+	return "Event/EventData/Data[@Name='" + name + "']"
+}
+
+// leanKey identifies an event with a lean extractor
+type leanKey struct {
+	provider string
+	eventID  int
+}
+
+// leanExtractors fill an event's fields from the rendered values. An
+// extractor may set the message; otherwise generateMessage builds it.
+var leanExtractors = map[leanKey]func(event *Event, values *leanValues){
+	{securityAuditingProvider, 4624}: extractLeanLogon,
+	{securityAuditingProvider, 4625}: extractLeanLogon,
+	{securityAuditingProvider, 4688}: extractLeanProcessCreation,
+	{sysmonProvider, 1}:              extractLeanSysmonProcess,
+	{sysmonProvider, 3}:              extractLeanSysmonNetwork,
+}
+
+// createLeanContext creates the render context for lean extraction
+func createLeanContext() (uintptr, error) {
+	paths := make([]*uint16, leanValueCount)
+	for i, path := range leanPaths {
+		pathPtr, err := syscall.UTF16PtrFromString(path)
+		if err != nil {
+			return 0, err
+		}
+		paths[i] = pathPtr
+	}
+
+	ret, _, err := procEvtCreateRenderContext.Call(
+		uintptr(len(paths)),
+		uintptr(unsafe.Pointer(&paths[0])),
+		EvtRenderContextValues,
+	)
+	if ret == 0 {
+		return 0, fmt.Errorf("EvtCreateRenderContext failed: %w", err)
+	}
+	return ret, nil
+}
+
+// renderLean renders an event through the lean context. handled is false
+// when lean mode is off or the event has no lean extractor, and the event
+// must be rendered as XML; event is nil for excluded events.
+func (c *EventLogCollector) renderLean(hEvent uintptr, channel string) (event *Event, handled bool) {
+	if c.leanContext == 0 {
+		return nil, false
+	}
+
+	pooled := renderBufferPool.Get().(*[]uint16)
+	defer renderBufferPool.Put(pooled)
+
+	buffer := *pooled
+	bufferUsed, propertyCount, ok := renderValues(c.leanContext, hEvent, buffer)
+	if !ok && bufferUsed > uint32(len(buffer)*2) {
+		// A long command line; bufferUsed is the size needed
+		buffer = make([]uint16, (bufferUsed+1)/2)
+		bufferUsed, propertyCount, ok = renderValues(c.leanContext, hEvent, buffer)
+	}
+	if !ok || propertyCount != leanValueCount {
+		return nil, false
+	}
+
+	values := &leanValues{
+		buffer:   buffer,
+		variants: unsafe.Slice((*evtVariant)(unsafe.Pointer(&buffer[0])), leanValueCount),
+	}
+
+	eventID := values.int(leanEventID)
+	extract, found := leanExtractors[leanKey{values.string(leanProvider), eventID}]
+	if !found {
+		return nil, false
+	}
+	if c.config.EventLog.IsEventIDExcluded(eventID) {
+		return nil, true
+	}
+
+	// Create normalized event; the sender releases it back to the pool
+	event = acquireEvent()
+	event.AgentID = c.agentID
+	event.Computer = c.sysInfo.Hostname
+	event.FQDN = c.sysInfo.FQDN
+	event.IPAddress = c.sysInfo.IPAddress
+	event.Provider = intern(values.string(leanProvider))
+	event.SourceType = c.getSourceType(channel, event.Provider)
+	event.EventCode = eventID
+	event.EventTime = values.time(leanTimeCreated)
+	event.RecordID = int64(values.uint(leanRecordID))
+	event.Channel = channel
+	event.Severity = SeverityFromWindowsLevel(values.int(leanLevel))
+	event.ProcessID = values.int(leanExecutionProcessID)
+	event.CollectedAt = time.Now()
+
+	extract(event, values)
+	if event.Message == "" {
+		event.Message = c.generateMessage(event, nil)
+	}
+
+	return event, true
+}
+
+// renderValues renders an event's values into buffer, returning the bytes
+// used (or needed, if the buffer is too small) and the value count
+func renderValues(context, hEvent uintptr, buffer []uint16) (uint32, uint32, bool) {
+	var bufferUsed, propertyCount uint32
+
+	ret, _, _ := procEvtRender.Call(
+		context,
+		hEvent,
+		EvtRenderEventValues,
+		uintptr(len(buffer)*2),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(unsafe.Pointer(&bufferUsed)),
+		uintptr(unsafe.Pointer(&propertyCount)),
+	)
+
+	return bufferUsed, propertyCount, ret != 0
+}
+
+// leanValues reads rendered values. Strings, GUIDs and SIDs point into the
+// render buffer and are copied out before it is reused.
+type leanValues struct {
+	buffer   []uint16
+	variants []evtVariant
+}
+
+// at returns the buffer from the address a pointer value holds
+func (v *leanValues) at(address uint64) []uint16 {
+	offset := address - uint64(uintptr(unsafe.Pointer(&v.buffer[0])))
+	if offset >= uint64(len(v.buffer)*2) {
+		return nil
+	}
+	return v.buffer[offset/2:]
+}
+
+// string formats a value the way the event XML shows it
+func (v *leanValues) string(index int) string {
+	variant := &v.variants[index]
+	switch variant.kind & evtVarTypeMask {
+	case evtVarTypeNull:
+		return ""
+	case evtVarTypeString:
+		return utf16ToString(v.at(variant.value))
+	case evtVarTypeSByte, evtVarTypeInt16, evtVarTypeInt32, evtVarTypeInt64:
+		return strconv.FormatInt(v.signed(variant), 10)
+	case evtVarTypeByte, evtVarTypeUInt16, evtVarTypeUInt32, evtVarTypeUInt64:
+		return strconv.FormatUint(v.uint(index), 10)
+	case evtVarTypeHexInt32, evtVarTypeHexInt64:
+		return "0x" + strconv.FormatUint(v.uint(index), 16)
+	case evtVarTypeBoolean:
+		return strconv.FormatBool(uint32(variant.value) != 0)
+	case evtVarTypeGuid:
+		if data := v.at(variant.value); len(data) >= 8 {
+			return (*windows.GUID)(unsafe.Pointer(&data[0])).String()
+		}
+	case evtVarTypeSid:
+		if data := v.at(variant.value); len(data) > 0 {
+			return (*windows.SID)(unsafe.Pointer(&data[0])).String()
+		}
+	}
+	return ""
+}
+
+// signed returns a signed integer value
+func (v *leanValues) signed(variant *evtVariant) int64 {
+	switch variant.kind & evtVarTypeMask {
+	case evtVarTypeSByte:
+		return int64(int8(variant.value))
+	case evtVarTypeInt16:
+		return int64(int16(variant.value))
+	case evtVarTypeInt32:
+		return int64(int32(variant.value))
+	}
+	return int64(variant.value)
+}
+
+// uint returns an integer value; strings holding a number are parsed
+func (v *leanValues) uint(index int) uint64 {
+	variant := &v.variants[index]
+	switch variant.kind & evtVarTypeMask {
+	case evtVarTypeByte:
+		return uint64(uint8(variant.value))
+	case evtVarTypeUInt16:
+		return uint64(uint16(variant.value))
+	case evtVarTypeUInt32, evtVarTypeHexInt32:
+		return uint64(uint32(variant.value))
+	case evtVarTypeUInt64, evtVarTypeHexInt64:
+		return variant.value
+	case evtVarTypeSByte, evtVarTypeInt16, evtVarTypeInt32, evtVarTypeInt64:
+		return uint64(v.signed(variant))
+	case evtVarTypeString:
+		n, _ := strconv.ParseUint(v.string(index), 0, 64)
+		return n
+	}
+	return 0
+}
+
+// int returns an integer value as an int
+func (v *leanValues) int(index int) int {
+	return int(v.uint(index))
+}
+
+// time returns a FILETIME value
+func (v *leanValues) time(index int) time.Time {
+	variant := &v.variants[index]
+	if variant.kind&evtVarTypeMask != evtVarTypeFileTime {
+		return time.Time{}
+	}
+	filetime := windows.Filetime{
+		LowDateTime:  uint32(variant.value),
+		HighDateTime: uint32(variant.value >> 32),
+	}
+	return time.Unix(0, filetime.Nanoseconds()).UTC()
+}
+
+// extractLeanLogon reads a Security 4624/4625 logon
+func extractLeanLogon(event *Event, values *leanValues) {
+	event.SubjectUser = values.string(leanSubjectUserName)
+	event.SubjectDomain = values.string(leanSubjectDomainName)
+	event.SubjectLogonID = values.string(leanSubjectLogonID)
+	event.TargetUser = values.string(leanTargetUserName)
+	event.TargetDomain = values.string(leanTargetDomainName)
+	event.TargetLogonID = values.string(leanTargetLogonID)
+	event.WorkstationName = values.string(leanWorkstationName)
+	event.SourceIP = values.string(leanIPAddress)
+	event.AuthPackage = intern(values.string(leanAuthenticationPackageName))
+	event.LogonType = values.int(leanLogonType)
+	if event.EventCode == 4625 {
+		event.FailureReason = values.string(leanFailureReason)
+	}
+}
+
+// extractLeanProcessCreation reads a Security 4688 process creation. The
+// process IDs are pointers (hex) in this event.
+func extractLeanProcessCreation(event *Event, values *leanValues) {
+	event.SubjectUser = values.string(leanSubjectUserName)
+	event.SubjectDomain = values.string(leanSubjectDomainName)
+	event.ProcessName = values.string(leanNewProcessName)
+	event.ProcessCommandLine = values.string(leanCommandLine)
+	event.ProcessID = values.int(leanNewProcessID)
+	event.ParentProcessID = values.int(leanProcessID)
+}
+
+// extractLeanSysmonProcess reads a Sysmon 1 process creation
+func extractLeanSysmonProcess(event *Event, values *leanValues) {
+	event.ProcessName = values.string(leanImage)
+	event.ProcessCommandLine = values.string(leanCommandLine)
+	event.TargetUser = values.string(leanUser)
+	event.ParentProcessName = values.string(leanParentImage)
+	event.ProcessID = values.int(leanProcessID)
+	event.ParentProcessID = values.int(leanParentProcessID)
+	event.FileHash = values.string(leanHashes)
+}
+
+// extractLeanSysmonNetwork reads a Sysmon 3 network connection
+func extractLeanSysmonNetwork(event *Event, values *leanValues) {
+	event.ProcessName = values.string(leanImage)
+	event.TargetUser = values.string(leanUser)
+	event.SourceIP = values.string(leanSourceIP)
+	event.SourcePort = values.int(leanSourcePort)
+	event.DestinationIP = values.string(leanDestinationIP)
+	event.DestinationPort = values.int(leanDestinationPort)
+	event.Protocol = intern(values.string(leanProtocol))
+
+	direction := "->"
+	if values.string(leanInitiated) == "false" {
+		direction = "<-"
+	}
+	event.Message = fmt.Sprintf("Sysmon: Network connection: %s:%d %s %s:%d (%s, Process: %s)",
+		event.SourceIP, event.SourcePort, direction, event.DestinationIP, event.DestinationPort,
+		event.Protocol, event.ProcessName)
+}
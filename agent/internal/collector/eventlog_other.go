@@ -0,0 +1,35 @@
+//go:build !windows
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// EventLogCollector collects Windows Event Log events (Windows only)
+type EventLogCollector struct{}
+
+// NewEventLogCollector fails outside Windows; use the journald, auditd or
+// unified log collectors instead
+func NewEventLogCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*EventLogCollector, error) {
+	return nil, fmt.Errorf("event log collection is only supported on Windows")
+}
+
+// Start does nothing
+func (c *EventLogCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *EventLogCollector) Stop() {}
+
+// Delivered does nothing
+func (c *EventLogCollector) Delivered(events []*Event) {}
+
+// SaveBookmarks does nothing
+func (c *EventLogCollector) SaveBookmarks() {}
+
+// CheckEventLogChannel fails outside Windows
+func CheckEventLogChannel(channel string) error {
+	return fmt.Errorf("event log collection is only supported on Windows")
+}
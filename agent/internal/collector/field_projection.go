@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Fields every event keeps whatever its profile, so it can still be
+// attributed, ordered and deduplicated
+var projectionIdentity = map[string]bool{
+	"agent_id":     true,
+	"computer":     true,
+	"source_type":  true,
+	"event_code":   true,
+	"event_time":   true,
+	"record_id":    true,
+	"channel":      true,
+	"provider":     true,
+	"severity":     true,
+	"collected_at": true,
+}
+
+// eventFields maps the JSON names of the Event fields to their index
+var eventFields = func() map[string]int {
+	fields := make(map[string]int)
+	eventType := reflect.TypeOf(Event{})
+	for i := 0; i < eventType.NumField(); i++ {
+		name, _, _ := strings.Cut(eventType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// projectionProfile is a compiled config.ProjectionProfile
+type projectionProfile struct {
+	sourceType string
+	channels   map[string]bool
+	eventIDs   map[int]bool
+	clear      []int // Event field indices removed; empty keeps the event whole
+}
+
+// fieldProjection trims events to the fields their source needs. Sites
+// short of bandwidth drop RawXML and EventData from routine events while
+// keeping events their detections depend on whole.
+type fieldProjection []projectionProfile
+
+// newFieldProjection compiles the projection profiles. Unknown field names
+// are logged and ignored.
+func newFieldProjection(profiles []config.ProjectionProfile) fieldProjection {
+	projection := make(fieldProjection, 0, len(profiles))
+	for _, profile := range profiles {
+		compiled := projectionProfile{
+			sourceType: profile.SourceType,
+			channels:   make(map[string]bool),
+			eventIDs:   make(map[int]bool),
+		}
+		for _, channel := range profile.Channels {
+			compiled.channels[channel] = true
+		}
+		for _, id := range profile.EventIDs {
+			compiled.eventIDs[id] = true
+		}
+
+		known := func(name string) bool {
+			if _, ok := eventFields[name]; !ok {
+				log.Printf("Warning: Unknown field %q in projection profile %q, ignored", name, profile.Name)
+				return false
+			}
+			return true
+		}
+
+		removed := make(map[string]bool)
+		if len(profile.Keep) > 0 {
+			keep := make(map[string]bool)
+			for _, name := range profile.Keep {
+				if known(name) {
+					keep[name] = true
+				}
+			}
+			for name := range eventFields {
+				if !keep[name] {
+					removed[name] = true
+				}
+			}
+		}
+		for _, name := range profile.Drop {
+			if known(name) {
+				removed[name] = true
+			}
+		}
+		for name := range removed {
+			if !projectionIdentity[name] {
+				compiled.clear = append(compiled.clear, eventFields[name])
+			}
+		}
+
+		projection = append(projection, compiled)
+	}
+	return projection
+}
+
+// apply removes the fields the first matching profile leaves out
+func (p fieldProjection) apply(event *Event) {
+	for i := range p {
+		profile := &p[i]
+		if profile.sourceType != "" && profile.sourceType != event.SourceType {
+			continue
+		}
+		if len(profile.channels) > 0 && !profile.channels[event.Channel] {
+			continue
+		}
+		if len(profile.eventIDs) > 0 && !profile.eventIDs[event.EventCode] {
+			continue
+		}
+
+		value := reflect.ValueOf(event).Elem()
+		for _, index := range profile.clear {
+			field := value.Field(index)
+			if field.Kind() == reflect.Map {
+				field.Clear() // keep pooled EventData maps for reuse
+			} else {
+				field.SetZero()
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,278 @@
+//go:build windows
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/siem/agent/internal/cache"
+)
+
+var (
+	crypt32              = windows.NewLazySystemDLL("crypt32.dll")
+	procCryptMsgGetParam = crypt32.NewProc("CryptMsgGetParam")
+	procCryptMsgClose    = crypt32.NewProc("CryptMsgClose")
+)
+
+const (
+	cmsgSignerInfoParam = 6 // CMSG_SIGNER_INFO_PARAM
+)
+
+// Signature status values
+const (
+	SignatureValid    = "valid"
+	SignatureInvalid  = "invalid"
+	SignatureUnsigned = "unsigned"
+)
+
+// FileInfo holds identifying information about an executable or package
+type FileInfo struct {
+	Path            string `json:"path"`
+	SHA256          string `json:"sha256"`
+	SignatureStatus string `json:"signature_status"`
+	Signer          string `json:"signer,omitempty"`
+	CompanyName     string `json:"company_name,omitempty"`
+	ProductName     string `json:"product_name,omitempty"`
+	ProductVersion  string `json:"product_version,omitempty"`
+	FileVersion     string `json:"file_version,omitempty"`
+}
+
+// Publisher returns the most trustworthy publisher name available: the
+// Authenticode signer when the signature is valid, else the version resource
+func (f *FileInfo) Publisher() string {
+	if f.SignatureStatus == SignatureValid && f.Signer != "" {
+		return f.Signer
+	}
+	return f.CompanyName
+}
+
+// cmsgSignerInfo mirrors the leading fields of CMSG_SIGNER_INFO
+type cmsgSignerInfo struct {
+	Version      uint32
+	Issuer       windows.CertNameBlob
+	SerialNumber windows.CryptIntegerBlob
+}
+
+// Inspected files by path, size and modification time: the same installer
+// is often started again and again, and hashing and signature checks are
+// slow for large files
+var fileInfoCache = cache.New[fileKey, *FileInfo]("file_info", 1024, 0)
+
+// fileKey identifies a version of a file
+type fileKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// InspectFile hashes a file and reads its Authenticode signature and version resource
+func InspectFile(path string) (*FileInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	key := fileKey{path: strings.ToLower(path), size: stat.Size(), modTime: stat.ModTime().UnixNano()}
+	cached, err := fileInfoCache.GetOrLoad(key, func(fileKey) (*FileInfo, error) {
+		return inspectFile(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := *cached
+	return &info, nil
+}
+
+// inspectFile reads the file information InspectFile caches
+func inspectFile(path string) (*FileInfo, error) {
+	hash, err := hashFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	info := &FileInfo{
+		Path:            path,
+		SHA256:          hash,
+		SignatureStatus: verifySignature(path),
+	}
+
+	if info.SignatureStatus != SignatureUnsigned {
+		info.Signer = signerName(path)
+	}
+
+	// MSI packages have no version resource; leave fields empty
+	if version := readVersionInfo(path); version != nil {
+		info.CompanyName = version["CompanyName"]
+		info.ProductName = version["ProductName"]
+		info.ProductVersion = version["ProductVersion"]
+		info.FileVersion = version["FileVersion"]
+	}
+
+	return info, nil
+}
+
+// hashFile calculates the SHA256 hash of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifySignature checks the Authenticode signature of a file
+func verifySignature(path string) string {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return SignatureInvalid
+	}
+
+	fileInfo := &windows.WinTrustFileInfo{
+		Size:     uint32(unsafe.Sizeof(windows.WinTrustFileInfo{})),
+		FilePath: pathPtr,
+	}
+
+	data := &windows.WinTrustData{
+		Size:                            uint32(unsafe.Sizeof(windows.WinTrustData{})),
+		UIChoice:                        windows.WTD_UI_NONE,
+		RevocationChecks:                windows.WTD_REVOKE_NONE,
+		UnionChoice:                     windows.WTD_CHOICE_FILE,
+		StateAction:                     windows.WTD_STATEACTION_VERIFY,
+		FileOrCatalogOrBlobOrSgnrOrCert: unsafe.Pointer(fileInfo),
+	}
+
+	verifyErr := windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+
+	data.StateAction = windows.WTD_STATEACTION_CLOSE
+	windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+
+	if verifyErr == nil {
+		return SignatureValid
+	}
+	switch verifyErr {
+	case windows.Errno(windows.TRUST_E_NOSIGNATURE),
+		windows.Errno(windows.TRUST_E_SUBJECT_FORM_UNKNOWN),
+		windows.Errno(windows.TRUST_E_PROVIDER_UNKNOWN):
+		return SignatureUnsigned
+	default:
+		return SignatureInvalid
+	}
+}
+
+// signerName returns the display name of the embedded signing certificate
+func signerName(path string) string {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return ""
+	}
+
+	var encoding, contentType, formatType uint32
+	var store, msg windows.Handle
+	err = windows.CryptQueryObject(
+		windows.CERT_QUERY_OBJECT_FILE,
+		unsafe.Pointer(pathPtr),
+		windows.CERT_QUERY_CONTENT_FLAG_PKCS7_SIGNED_EMBED,
+		windows.CERT_QUERY_FORMAT_FLAG_BINARY,
+		0,
+		&encoding,
+		&contentType,
+		&formatType,
+		&store,
+		&msg,
+		nil,
+	)
+	if err != nil {
+		return ""
+	}
+	defer windows.CertCloseStore(store, 0)
+	defer procCryptMsgClose.Call(uintptr(msg))
+
+	// Read signer info to locate the signing certificate
+	var size uint32
+	ret, _, _ := procCryptMsgGetParam.Call(uintptr(msg), cmsgSignerInfoParam, 0, 0, uintptr(unsafe.Pointer(&size)))
+	if ret == 0 || size < uint32(unsafe.Sizeof(cmsgSignerInfo{})) {
+		return ""
+	}
+
+	buf := make([]byte, size)
+	ret, _, _ = procCryptMsgGetParam.Call(uintptr(msg), cmsgSignerInfoParam, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return ""
+	}
+	signer := (*cmsgSignerInfo)(unsafe.Pointer(&buf[0]))
+
+	certInfo := windows.CertInfo{
+		Issuer:       signer.Issuer,
+		SerialNumber: signer.SerialNumber,
+	}
+	cert, err := windows.CertFindCertificateInStore(
+		store,
+		windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING,
+		0,
+		windows.CERT_FIND_SUBJECT_CERT,
+		unsafe.Pointer(&certInfo),
+		nil,
+	)
+	if err != nil {
+		return ""
+	}
+	defer windows.CertFreeCertificateContext(cert)
+
+	nameLen := windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, nil, 0)
+	if nameLen <= 1 {
+		return ""
+	}
+	name := make([]uint16, nameLen)
+	windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, &name[0], nameLen)
+
+	return windows.UTF16ToString(name)
+}
+
+// readVersionInfo reads string values from the file's version resource
+func readVersionInfo(path string) map[string]string {
+	size, err := windows.GetFileVersionInfoSize(path, nil)
+	if err != nil || size == 0 {
+		return nil
+	}
+
+	block := make([]byte, size)
+	if err := windows.GetFileVersionInfo(path, 0, size, unsafe.Pointer(&block[0])); err != nil {
+		return nil
+	}
+
+	// Use the first language/codepage pair
+	var translation *[2]uint16
+	var translationLen uint32
+	if err := windows.VerQueryValue(unsafe.Pointer(&block[0]), `\VarFileInfo\Translation`,
+		unsafe.Pointer(&translation), &translationLen); err != nil || translationLen < 4 {
+		return nil
+	}
+	prefix := fmt.Sprintf(`\StringFileInfo\%04x%04x\`, translation[0], translation[1])
+
+	values := make(map[string]string)
+	for _, key := range []string{"CompanyName", "ProductName", "ProductVersion", "FileVersion"} {
+		var value *uint16
+		var valueLen uint32
+		if err := windows.VerQueryValue(unsafe.Pointer(&block[0]), prefix+key,
+			unsafe.Pointer(&value), &valueLen); err != nil || valueLen == 0 {
+			continue
+		}
+		values[key] = windows.UTF16PtrToString(value)
+	}
+
+	return values
+}
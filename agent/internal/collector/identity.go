@@ -0,0 +1,328 @@
+//go:build linux
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const (
+	IdentitySourceType = "SIEM Agent"
+	IdentityChannel    = "SIEM-Agent/Identity"
+	IdentityProvider   = "SIEM-Agent"
+
+	// Windows-equivalent event codes for account and group changes, so
+	// the same server rules apply to Linux hosts
+	IdentityEventUserCreated        = 4720
+	IdentityEventUserDeleted        = 4726
+	IdentityEventUserChanged        = 4738
+	IdentityEventGroupCreated       = 4731
+	IdentityEventGroupDeleted       = 4734
+	IdentityEventGroupMemberAdded   = 4732
+	IdentityEventGroupMemberRemoved = 4733
+	IdentityEventSudoRuleAdded      = 4704 // user right assigned
+	IdentityEventSudoRuleRemoved    = 4705 // user right removed
+
+	// SSH keys have no Windows counterpart
+	IdentityEventSSHKeyAdded   = 9121
+	IdentityEventSSHKeyRemoved = 9122
+)
+
+// IdentityCollector reports changes to local users, group membership,
+// sudoers rules and SSH authorized keys by polling the files they are
+// kept in
+type IdentityCollector struct {
+	config     *config.IdentityConfig
+	agentID    string
+	hostname   string
+	eventQueue *EventQueue
+	wg         sync.WaitGroup
+	stopChan   chan struct{}
+
+	last     *identitySnapshot
+	recordID int64
+}
+
+// NewIdentityCollector creates a new identity collector
+func NewIdentityCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*IdentityCollector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	return &IdentityCollector{
+		config:     &cfg.Identity,
+		agentID:    agentID,
+		hostname:   hostname,
+		eventQueue: eventQueue,
+		stopChan:   make(chan struct{}),
+	}, nil
+}
+
+// Start takes a baseline and begins polling. Only changes made after the
+// baseline are reported.
+func (c *IdentityCollector) Start() error {
+	snapshot, err := readIdentity()
+	if err != nil {
+		return err
+	}
+	c.last = snapshot
+
+	log.Printf("Starting identity collector (%d users, %d sudo rules, %d SSH keys, polling every %ds)",
+		len(snapshot.users), len(snapshot.sudoRules), len(snapshot.sshKeys), c.config.Interval)
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop stops the collector
+func (c *IdentityCollector) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+	log.Println("Identity collector stopped")
+}
+
+// run polls until stopped
+func (c *IdentityCollector) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(c.config.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.poll()
+		}
+	}
+}
+
+// poll re-reads the identity files and reports what changed
+func (c *IdentityCollector) poll() {
+	snapshot, err := readIdentity()
+	if err != nil {
+		log.Printf("Warning: Failed to read identity files: %v", err)
+		return
+	}
+
+	var events []*Event
+	events = append(events, c.diffUsers(c.last, snapshot)...)
+	events = append(events, c.diffGroups(c.last, snapshot)...)
+	events = append(events, c.diffSudoRules(c.last, snapshot)...)
+	events = append(events, c.diffSSHKeys(c.last, snapshot)...)
+	c.last = snapshot
+
+	for _, event := range events {
+		c.eventQueue.Push(event)
+	}
+}
+
+// diffUsers reports created, deleted and changed /etc/passwd entries
+func (c *IdentityCollector) diffUsers(before, after *identitySnapshot) []*Event {
+	var events []*Event
+
+	for name, user := range after.users {
+		old, ok := before.users[name]
+		if ok && *old == *user {
+			continue
+		}
+
+		severity := 2
+		if user.UID == "0" {
+			severity = 5 // a second root account
+		}
+		data := map[string]string{
+			"TargetUserName": user.Name,
+			"Uid":            user.UID,
+			"Gid":            user.GID,
+			"HomeDirectory":  user.Home,
+			"Shell":          user.Shell,
+		}
+
+		if !ok {
+			events = append(events, c.newEvent(IdentityEventUserCreated, severity, "/etc/passwd", user.Name,
+				fmt.Sprintf("User account %s created (uid %s)", user.Name, user.UID), data))
+			continue
+		}
+
+		var changes []string
+		for _, field := range []struct{ name, before, after string }{
+			{"uid", old.UID, user.UID},
+			{"gid", old.GID, user.GID},
+			{"home", old.Home, user.Home},
+			{"shell", old.Shell, user.Shell},
+			{"gecos", old.Gecos, user.Gecos},
+		} {
+			if field.before != field.after {
+				changes = append(changes, fmt.Sprintf("%s %s -> %s", field.name, valueOrNone(field.before), valueOrNone(field.after)))
+			}
+		}
+		if old.UID == "0" && user.UID != "0" {
+			severity = 3
+		}
+		data["Changes"] = strings.Join(changes, "; ")
+		events = append(events, c.newEvent(IdentityEventUserChanged, severity, "/etc/passwd", user.Name,
+			fmt.Sprintf("User account %s changed: %s", user.Name, data["Changes"]), data))
+	}
+
+	for name, user := range before.users {
+		if _, ok := after.users[name]; !ok {
+			events = append(events, c.newEvent(IdentityEventUserDeleted, 2, "/etc/passwd", user.Name,
+				fmt.Sprintf("User account %s deleted", user.Name),
+				map[string]string{"TargetUserName": user.Name, "Uid": user.UID}))
+		}
+	}
+
+	return events
+}
+
+// diffGroups reports created and deleted groups and membership changes
+func (c *IdentityCollector) diffGroups(before, after *identitySnapshot) []*Event {
+	var events []*Event
+
+	for name, group := range after.groups {
+		old, ok := before.groups[name]
+		if !ok {
+			events = append(events, c.newEvent(IdentityEventGroupCreated, 2, "/etc/group", "",
+				fmt.Sprintf("Group %s created (gid %s)", group.Name, group.GID),
+				map[string]string{"TargetUserName": group.Name, "Gid": group.GID}))
+			old = &identityGroup{}
+		}
+
+		added, removed := diffMembers(old.Members, group.Members)
+		severity := 2
+		if privilegedGroups[group.Name] {
+			severity = 4
+		}
+		for _, member := range added {
+			events = append(events, c.newEvent(IdentityEventGroupMemberAdded, severity, "/etc/group", member,
+				fmt.Sprintf("%s added to group %s", member, group.Name),
+				map[string]string{"TargetUserName": group.Name, "MemberName": member, "Gid": group.GID}))
+		}
+		for _, member := range removed {
+			events = append(events, c.newEvent(IdentityEventGroupMemberRemoved, 2, "/etc/group", member,
+				fmt.Sprintf("%s removed from group %s", member, group.Name),
+				map[string]string{"TargetUserName": group.Name, "MemberName": member, "Gid": group.GID}))
+		}
+	}
+
+	for name, group := range before.groups {
+		if _, ok := after.groups[name]; !ok {
+			events = append(events, c.newEvent(IdentityEventGroupDeleted, 2, "/etc/group", "",
+				fmt.Sprintf("Group %s deleted", group.Name),
+				map[string]string{"TargetUserName": group.Name, "Gid": group.GID}))
+		}
+	}
+
+	return events
+}
+
+// diffMembers returns the names only in after and only in before. Both
+// lists are sorted.
+func diffMembers(before, after []string) (added, removed []string) {
+	in := make(map[string]bool, len(before))
+	for _, member := range before {
+		in[member] = true
+	}
+	for _, member := range after {
+		if !in[member] {
+			added = append(added, member)
+		}
+		delete(in, member)
+	}
+	for _, member := range before {
+		if in[member] {
+			removed = append(removed, member)
+		}
+	}
+	return added, removed
+}
+
+// diffSudoRules reports added and removed sudoers lines
+func (c *IdentityCollector) diffSudoRules(before, after *identitySnapshot) []*Event {
+	var events []*Event
+
+	for key, rule := range after.sudoRules {
+		if _, ok := before.sudoRules[key]; !ok {
+			events = append(events, c.newEvent(IdentityEventSudoRuleAdded, 4, rule.File, "",
+				fmt.Sprintf("sudo rule added in %s: %s", rule.File, rule.Rule),
+				map[string]string{"Rule": rule.Rule, "File": rule.File}))
+		}
+	}
+	for key, rule := range before.sudoRules {
+		if _, ok := after.sudoRules[key]; !ok {
+			events = append(events, c.newEvent(IdentityEventSudoRuleRemoved, 2, rule.File, "",
+				fmt.Sprintf("sudo rule removed from %s: %s", rule.File, rule.Rule),
+				map[string]string{"Rule": rule.Rule, "File": rule.File}))
+		}
+	}
+
+	return events
+}
+
+// diffSSHKeys reports added and removed authorized keys
+func (c *IdentityCollector) diffSSHKeys(before, after *identitySnapshot) []*Event {
+	var events []*Event
+
+	for id, key := range after.sshKeys {
+		if _, ok := before.sshKeys[id]; !ok {
+			severity := 3
+			if user := after.users[key.User]; user != nil && user.UID == "0" {
+				severity = 4
+			}
+			events = append(events, c.newEvent(IdentityEventSSHKeyAdded, severity, key.File, key.User,
+				fmt.Sprintf("SSH key %s %s authorized for %s", key.Type, key.Fingerprint, key.User), sshKeyData(key)))
+		}
+	}
+	for id, key := range before.sshKeys {
+		if _, ok := after.sshKeys[id]; !ok {
+			events = append(events, c.newEvent(IdentityEventSSHKeyRemoved, 2, key.File, key.User,
+				fmt.Sprintf("SSH key %s %s removed for %s", key.Type, key.Fingerprint, key.User), sshKeyData(key)))
+		}
+	}
+
+	return events
+}
+
+// sshKeyData returns the event data of an authorized key
+func sshKeyData(key *identitySSHKey) map[string]string {
+	return map[string]string{
+		"TargetUserName": key.User,
+		"KeyType":        key.Type,
+		"Fingerprint":    key.Fingerprint,
+		"Comment":        key.Comment,
+		"Options":        key.Options,
+		"File":           key.File,
+	}
+}
+
+// newEvent builds an identity change event
+func (c *IdentityCollector) newEvent(code, severity int, path, targetUser, message string, data map[string]string) *Event {
+	c.recordID++
+	return &Event{
+		AgentID:     c.agentID,
+		Computer:    c.hostname,
+		SourceType:  IdentitySourceType,
+		EventCode:   code,
+		EventTime:   time.Now(),
+		RecordID:    c.recordID,
+		Channel:     IdentityChannel,
+		Provider:    IdentityProvider,
+		Severity:    severity,
+		TargetUser:  targetUser,
+		FilePath:    path,
+		Message:     message,
+		EventData:   data,
+		CollectedAt: time.Now(),
+	}
+}
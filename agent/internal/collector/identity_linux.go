@@ -0,0 +1,460 @@
+//go:build linux
+
+package collector
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Groups whose members can become root (directly or through sudo, the
+// container runtime or the log files they can read)
+var privilegedGroups = map[string]bool{
+	"root":   true,
+	"sudo":   true,
+	"wheel":  true,
+	"admin":  true,
+	"adm":    true,
+	"docker": true,
+	"lxd":    true,
+}
+
+// sudo stops following #include directives this deep
+const sudoersMaxIncludeDepth = 8
+
+// identityUser is an /etc/passwd entry
+type identityUser struct {
+	Name  string
+	UID   string
+	GID   string
+	Gecos string
+	Home  string
+	Shell string
+}
+
+// canLogIn reports whether the user has a login shell
+func (u *identityUser) canLogIn() bool {
+	shell := filepath.Base(u.Shell)
+	return u.Shell != "" && shell != "nologin" && shell != "false"
+}
+
+// identityGroup is an /etc/group entry. Members include users whose
+// primary group it is.
+type identityGroup struct {
+	Name    string
+	GID     string
+	Members []string // sorted
+}
+
+// identitySudoRule is a sudoers line (a rule, alias or Defaults entry)
+type identitySudoRule struct {
+	Rule string
+	File string
+}
+
+// identitySSHKey is an authorized_keys entry
+type identitySSHKey struct {
+	User        string
+	Type        string
+	Fingerprint string // SHA256:..., as printed by ssh-keygen -l
+	Comment     string
+	Options     string // from="...", command="...", ...
+	File        string
+}
+
+// identitySnapshot is the local account, group, sudo and SSH key state
+type identitySnapshot struct {
+	users     map[string]*identityUser     // by name
+	groups    map[string]*identityGroup    // by name
+	sudoRules map[string]*identitySudoRule // by file and rule
+	sshKeys   map[string]*identitySSHKey   // by user and fingerprint
+}
+
+// readIdentity reads the host's accounts, groups, sudoers rules and SSH
+// authorized keys. Unreadable sudoers and key files are skipped.
+func readIdentity() (*identitySnapshot, error) {
+	users, order, err := readPasswd()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := readGroups(users)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &identitySnapshot{
+		users:     users,
+		groups:    groups,
+		sudoRules: make(map[string]*identitySudoRule),
+		sshKeys:   make(map[string]*identitySSHKey),
+	}
+	for _, rule := range readSudoers("/etc/sudoers", 0) {
+		snapshot.sudoRules[rule.File+"\x00"+rule.Rule] = rule
+	}
+
+	keyFiles := authorizedKeysFiles()
+	for _, name := range order {
+		for _, key := range readAuthorizedKeys(users[name], keyFiles) {
+			snapshot.sshKeys[key.User+"\x00"+key.Fingerprint] = key
+		}
+	}
+
+	return snapshot, nil
+}
+
+// readPasswd parses /etc/passwd, returning the users by name and their
+// names in file order
+func readPasswd() (map[string]*identityUser, []string, error) {
+	file, err := os.Open(hostPath("/etc/passwd"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	users := make(map[string]*identityUser)
+	var order []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) != 7 || fields[0] == "" || strings.HasPrefix(fields[0], "+") {
+			continue // NIS entries
+		}
+		if _, ok := users[fields[0]]; ok {
+			continue // the first entry wins
+		}
+		users[fields[0]] = &identityUser{
+			Name:  fields[0],
+			UID:   fields[2],
+			GID:   fields[3],
+			Gecos: fields[4],
+			Home:  fields[5],
+			Shell: fields[6],
+		}
+		order = append(order, fields[0])
+	}
+
+	return users, order, scanner.Err()
+}
+
+// readGroups parses /etc/group and adds the users whose primary group
+// each group is
+func readGroups(users map[string]*identityUser) (map[string]*identityGroup, error) {
+	file, err := os.Open(hostPath("/etc/group"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	primary := make(map[string][]string) // by GID
+	for _, user := range users {
+		primary[user.GID] = append(primary[user.GID], user.Name)
+	}
+
+	groups := make(map[string]*identityGroup)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// name:password:gid:member,member
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) != 4 || fields[0] == "" || strings.HasPrefix(fields[0], "+") {
+			continue
+		}
+		if _, ok := groups[fields[0]]; ok {
+			continue
+		}
+
+		members := make(map[string]bool)
+		for _, member := range strings.Split(fields[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				members[member] = true
+			}
+		}
+		for _, member := range primary[fields[2]] {
+			members[member] = true
+		}
+
+		group := &identityGroup{Name: fields[0], GID: fields[2]}
+		for member := range members {
+			group.Members = append(group.Members, member)
+		}
+		sort.Strings(group.Members)
+		groups[group.Name] = group
+	}
+
+	return groups, scanner.Err()
+}
+
+// readSudoers returns the rules of a sudoers file and the files it
+// includes. Comments and blank lines are dropped and continued lines
+// joined.
+func readSudoers(path string, depth int) []*identitySudoRule {
+	if depth > sudoersMaxIncludeDepth {
+		return nil
+	}
+	data, err := os.ReadFile(hostPath(path))
+	if err != nil {
+		return nil
+	}
+
+	var rules []*identitySudoRule
+	var line string
+	for _, part := range strings.Split(string(data), "\n") {
+		part = strings.TrimSpace(part)
+		if strings.HasSuffix(part, "\\") {
+			line += strings.TrimSuffix(part, "\\") + " "
+			continue
+		}
+		line = strings.TrimSpace(line + part)
+		current := line
+		line = ""
+
+		// #include and #includedir are directives, not comments
+		fields := strings.Fields(current)
+		if len(fields) == 2 {
+			switch fields[0] {
+			case "#include", "@include":
+				rules = append(rules, readSudoers(sudoersIncludePath(path, fields[1]), depth+1)...)
+				continue
+			case "#includedir", "@includedir":
+				rules = append(rules, readSudoersDir(sudoersIncludePath(path, fields[1]), depth+1)...)
+				continue
+			}
+		}
+
+		if i := strings.Index(current, "#"); i >= 0 {
+			current = strings.TrimSpace(current[:i])
+		}
+		if current == "" {
+			continue
+		}
+		rules = append(rules, &identitySudoRule{Rule: strings.Join(strings.Fields(current), " "), File: path})
+	}
+
+	return rules
+}
+
+// readSudoersDir reads the files of an #includedir directory. Like sudo,
+// it skips names containing a dot or ending in ~ (editor backups, package
+// manager leftovers).
+func readSudoersDir(dir string, depth int) []*identitySudoRule {
+	entries, err := os.ReadDir(hostPath(dir))
+	if err != nil {
+		return nil
+	}
+
+	var rules []*identitySudoRule
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.Contains(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		rules = append(rules, readSudoers(filepath.Join(dir, name), depth)...)
+	}
+	return rules
+}
+
+// sudoersIncludePath resolves an include path relative to the including
+// file's directory
+func sudoersIncludePath(from, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(from), path)
+}
+
+// authorizedKeysFiles returns the AuthorizedKeysFile patterns of sshd_config
+// (outside Match blocks)
+func authorizedKeysFiles() []string {
+	defaults := []string{".ssh/authorized_keys", ".ssh/authorized_keys2"}
+
+	file, err := os.Open(hostPath("/etc/ssh/sshd_config"))
+	if err != nil {
+		return defaults
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "match":
+			return defaults
+		case "authorizedkeysfile":
+			if len(fields) > 1 && fields[1] != "none" {
+				return fields[1:]
+			}
+			return nil
+		}
+	}
+	return defaults
+}
+
+// readAuthorizedKeys returns the keys that let user log in over SSH
+func readAuthorizedKeys(user *identityUser, patterns []string) []*identitySSHKey {
+	if user.Home == "" {
+		return nil
+	}
+
+	var keys []*identitySSHKey
+	for _, pattern := range patterns {
+		// %h home directory, %u user name, %% a literal %
+		path := strings.NewReplacer("%h", user.Home, "%u", user.Name, "%%", "%").Replace(pattern)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(user.Home, path)
+		}
+
+		data, err := os.ReadFile(hostPath(path))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if key := parseAuthorizedKey(line); key != nil {
+				key.User = user.Name
+				key.File = path
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// parseAuthorizedKey parses an authorized_keys line:
+// [options] keytype base64-key [comment]
+func parseAuthorizedKey(line string) *identitySSHKey {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	var options string
+	if !isSSHKeyType(firstField(line)) {
+		// Options end at the first space outside quotes
+		quoted := false
+		end := len(line)
+		for i, r := range line {
+			if r == '"' {
+				quoted = !quoted
+			} else if (r == ' ' || r == '\t') && !quoted {
+				end = i
+				break
+			}
+		}
+		options, line = line[:end], strings.TrimSpace(line[end:])
+	}
+
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || !isSSHKeyType(fields[0]) {
+		return nil
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(blob)
+	key := &identitySSHKey{
+		Type:        fields[0],
+		Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+		Options:     options,
+	}
+	if len(fields) == 3 {
+		key.Comment = strings.TrimSpace(fields[2])
+	}
+	return key
+}
+
+// isSSHKeyType reports whether s is an OpenSSH public key type
+func isSSHKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-sha2-") || strings.HasPrefix(s, "sk-")
+}
+
+// firstField returns the text up to the first space or tab
+func firstField(s string) string {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// CollectIdentity reports local users, groups with their members, sudoers
+// rules and SSH authorized keys
+func (c *InventoryCollector) CollectIdentity() ([]*InventoryItem, error) {
+	snapshot, err := readIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*InventoryItem
+	now := time.Now()
+
+	for _, user := range snapshot.users {
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "user",
+			Name:        user.Name,
+			InstallPath: user.Home,
+			Status:      "Disabled",
+			Description: fmt.Sprintf("uid %s, gid %s, shell %s", user.UID, user.GID, user.Shell),
+			CollectedAt: now,
+		}
+		if user.canLogIn() {
+			item.Status = "Enabled"
+		}
+		if user.Gecos != "" {
+			item.Description += ", " + user.Gecos
+		}
+		items = append(items, item)
+	}
+
+	for _, group := range snapshot.groups {
+		items = append(items, &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "group",
+			Name:        group.Name,
+			Description: fmt.Sprintf("gid %s, members: %s", group.GID, valueOrNone(strings.Join(group.Members, ", "))),
+			CollectedAt: now,
+		})
+	}
+
+	for _, rule := range snapshot.sudoRules {
+		items = append(items, &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "sudo_rule",
+			Name:        rule.Rule,
+			InstallPath: rule.File,
+			CollectedAt: now,
+		})
+	}
+
+	for _, key := range snapshot.sshKeys {
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "ssh_key",
+			Name:        key.User + " " + key.Fingerprint,
+			Version:     key.Type,
+			InstallPath: key.File,
+			Description: key.Comment,
+			CollectedAt: now,
+		}
+		if key.Options != "" {
+			item.Description = strings.TrimSpace(key.Comment + " (" + key.Options + ")")
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// IdentityCollector reports local account and sudo changes (Linux only)
+type IdentityCollector struct{}
+
+// NewIdentityCollector fails outside Linux; Windows account changes come
+// from the Security event log
+func NewIdentityCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*IdentityCollector, error) {
+	return nil, fmt.Errorf("identity monitoring is only supported on Linux")
+}
+
+// Start does nothing
+func (c *IdentityCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *IdentityCollector) Stop() {}
@@ -0,0 +1,346 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ntdll                = windows.NewLazySystemDLL("ntdll.dll")
+	procNtSuspendProcess = ntdll.NewProc("NtSuspendProcess")
+	procNtResumeProcess  = ntdll.NewProc("NtResumeProcess")
+)
+
+const (
+	// interceptPollInterval is how often the process table is scanned.
+	// Installers are suspended within this window of starting.
+	interceptPollInterval = 250 * time.Millisecond
+
+	// installerDeniedExitCode is the exit code given to blocked installers
+	installerDeniedExitCode = 1625 // ERROR_INSTALL_PACKAGE_REJECTED
+)
+
+// InstallerInterceptor watches for newly started processes and holds
+// unapproved installers suspended until the SIEM approves or denies them
+type InstallerInterceptor struct {
+	control  *SoftwareControlCollector
+	selfPID  uint32
+	seen     map[uint32]bool
+	held     map[uint32]bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+}
+
+// NewInstallerInterceptor creates a new installer interceptor
+func NewInstallerInterceptor(control *SoftwareControlCollector) *InstallerInterceptor {
+	return &InstallerInterceptor{
+		control:  control,
+		selfPID:  uint32(os.Getpid()),
+		seen:     make(map[uint32]bool),
+		held:     make(map[uint32]bool),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins watching for installer processes
+func (i *InstallerInterceptor) Start() error {
+	// Record processes that already exist so only new launches are intercepted
+	entries, err := snapshotProcesses()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot processes: %w", err)
+	}
+	for _, pe := range entries {
+		i.seen[pe.ProcessID] = true
+	}
+
+	log.Println("Starting installer interception...")
+
+	i.wg.Add(1)
+	go i.run()
+	return nil
+}
+
+// Stop stops the interceptor. Installers waiting on a submitted request stay
+// suspended and are re-attached on the next start; any other held process is
+// resumed so that stopping the agent never leaves an installer frozen.
+func (i *InstallerInterceptor) Stop() {
+	close(i.stopChan)
+	i.wg.Wait()
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for pid := range i.held {
+		if i.control.IsPendingProcess(pid) {
+			continue
+		}
+		if err := resumeProcess(pid); err != nil {
+			log.Printf("Error resuming held installer %d: %v", pid, err)
+		}
+	}
+	i.held = make(map[uint32]bool)
+}
+
+// Reattach resumes waiting on a request restored after a restart. If its
+// installer is still suspended, it is released or terminated once decided.
+func (i *InstallerInterceptor) Reattach(request *SoftwareInstallRequest) {
+	pid := request.ProcessID
+
+	imagePath, err := processImagePath(pid)
+	if pid == 0 || err != nil || !strings.EqualFold(imagePath, request.InstallerPath) {
+		// Installer is gone; the user is told the outcome and can retry
+		go i.control.ResumeRequest(request)
+		return
+	}
+
+	i.mutex.Lock()
+	i.held[pid] = true
+	i.mutex.Unlock()
+
+	log.Printf("Re-attached held installer: %s (PID %d)", imagePath, pid)
+
+	go i.decide(pid, imagePath, func() (bool, *SoftwareInstallRequest, error) {
+		return i.control.ResumeRequest(request)
+	})
+}
+
+func (i *InstallerInterceptor) run() {
+	defer i.wg.Done()
+
+	ticker := time.NewTicker(interceptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.stopChan:
+			return
+		case <-ticker.C:
+			i.scan()
+		}
+	}
+}
+
+// scan checks the process table for new installer processes
+func (i *InstallerInterceptor) scan() {
+	entries, err := snapshotProcesses()
+	if err != nil {
+		log.Printf("Error enumerating processes: %v", err)
+		return
+	}
+
+	alive := make(map[uint32]bool, len(entries))
+	for _, pe := range entries {
+		alive[pe.ProcessID] = true
+		if i.seen[pe.ProcessID] {
+			continue
+		}
+		i.seen[pe.ProcessID] = true
+
+		// Installers launched by the agent itself (app store) are already approved
+		if pe.ParentProcessID == i.selfPID {
+			continue
+		}
+
+		i.inspect(pe.ProcessID)
+	}
+
+	// Forget exited processes so PID reuse is detected
+	for pid := range i.seen {
+		if !alive[pid] {
+			delete(i.seen, pid)
+		}
+	}
+}
+
+// inspect suspends the process if it is an installer that needs approval
+func (i *InstallerInterceptor) inspect(pid uint32) {
+	// Session 0 hosts services (including the Windows Installer service);
+	// only interactive launches are intercepted
+	var sessionID uint32
+	if err := windows.ProcessIdToSessionId(pid, &sessionID); err != nil || sessionID == 0 {
+		return
+	}
+
+	imagePath, err := processImagePath(pid)
+	if err != nil {
+		return
+	}
+
+	if !i.control.IsInstaller(imagePath) || i.control.IsWhitelisted(imagePath) {
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// Already held via its process creation event
+	if i.held[pid] {
+		return
+	}
+
+	if err := suspendProcess(pid); err != nil {
+		log.Printf("Could not suspend installer %s (PID %d): %v", imagePath, pid, err)
+		return
+	}
+	i.held[pid] = true
+
+	log.Printf("Installer held pending approval: %s (PID %d)", imagePath, pid)
+
+	userName := processUserName(pid)
+	go i.decide(pid, imagePath, func() (bool, *SoftwareInstallRequest, error) {
+		return i.control.CheckHeldInstallation(pid, imagePath, "", userName)
+	})
+}
+
+// decide waits for the approval decision and releases or terminates the process
+func (i *InstallerInterceptor) decide(pid uint32, imagePath string, check func() (bool, *SoftwareInstallRequest, error)) {
+	allowed, request, err := check()
+	if err != nil {
+		log.Printf("Installer approval for %s failed: %v", imagePath, err)
+	}
+
+	i.mutex.Lock()
+	stillHeld := i.held[pid]
+	delete(i.held, pid)
+	i.mutex.Unlock()
+
+	// Stop() already resumed it or left it for re-attachment
+	if !stillHeld {
+		return
+	}
+
+	if allowed {
+		if err := resumeProcess(pid); err != nil {
+			log.Printf("Error resuming approved installer %d: %v", pid, err)
+		}
+		return
+	}
+
+	if err := terminateProcess(pid, installerDeniedExitCode); err != nil {
+		log.Printf("Error terminating denied installer %d: %v", pid, err)
+		return
+	}
+	if request != nil && request.Status == "winget_install" {
+		log.Printf("Installer replaced by winget install: %s (PID %d)", imagePath, pid)
+		return
+	}
+	log.Printf("Installer blocked: %s (PID %d)", imagePath, pid)
+}
+
+// snapshotProcesses returns the current process table
+func snapshotProcesses() ([]windows.ProcessEntry32, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var pe32 windows.ProcessEntry32
+	pe32.Size = uint32(unsafe.Sizeof(pe32))
+
+	if err := windows.Process32First(snapshot, &pe32); err != nil {
+		return nil, err
+	}
+
+	var entries []windows.ProcessEntry32
+	for {
+		entries = append(entries, pe32)
+		if err := windows.Process32Next(snapshot, &pe32); err != nil {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// processImagePath returns the full executable path of a process
+func processImagePath(pid uint32) (string, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(handle)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(handle, 0, &buf[0], &size); err != nil {
+		return "", err
+	}
+
+	return windows.UTF16ToString(buf[:size]), nil
+}
+
+// processUserName returns DOMAIN\user for the owner of a process
+func processUserName(pid uint32) string {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(handle)
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(handle, windows.TOKEN_QUERY, &token); err != nil {
+		return ""
+	}
+	defer token.Close()
+
+	tokenUser, err := token.GetTokenUser()
+	if err != nil {
+		return ""
+	}
+
+	account, domain, _, err := tokenUser.User.Sid.LookupAccount("")
+	if err != nil {
+		return ""
+	}
+
+	return domain + "\\" + account
+}
+
+// suspendProcess suspends all threads of a process
+func suspendProcess(pid uint32) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_SUSPEND_RESUME, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+
+	if status, _, _ := procNtSuspendProcess.Call(uintptr(handle)); status != 0 {
+		return fmt.Errorf("NtSuspendProcess failed: 0x%x", status)
+	}
+	return nil
+}
+
+// resumeProcess resumes a suspended process
+func resumeProcess(pid uint32) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_SUSPEND_RESUME, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+
+	if status, _, _ := procNtResumeProcess.Call(uintptr(handle)); status != 0 {
+		return fmt.Errorf("NtResumeProcess failed: 0x%x", status)
+	}
+	return nil
+}
+
+// terminateProcess terminates a process with the given exit code
+func terminateProcess(pid uint32, exitCode uint32) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+
+	return windows.TerminateProcess(handle, exitCode)
+}
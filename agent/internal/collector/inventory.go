@@ -3,8 +3,10 @@
 package collector
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"os/exec"
 	"strings"
 	"time"
 
@@ -52,6 +54,63 @@ func (c *InventoryCollector) CollectAll() ([]*InventoryItem, error) {
 	return items, nil
 }
 
+// CollectPlatform collects platform-specific items: installed hotfixes.
+// The OS version is already reported by system info on Windows.
+func (c *InventoryCollector) CollectPlatform() []*InventoryItem {
+	hotfixes, err := c.CollectHotfixes()
+	if err != nil {
+		log.Printf("Warning: Failed to collect hotfix inventory: %v", err)
+	}
+	return hotfixes
+}
+
+// CollectHotfixes collects installed updates from Win32_QuickFixEngineering
+func (c *InventoryCollector) CollectHotfixes() ([]*InventoryItem, error) {
+	psScript := `$h = @(Get-CimInstance -ClassName Win32_QuickFixEngineering -ErrorAction Stop | ` +
+		`Select-Object HotFixID, Description, ` +
+		`@{n='InstalledOn';e={ if ($_.InstalledOn) { $_.InstalledOn.ToString('yyyy-MM-dd') } }}); ` +
+		`ConvertTo-Json -InputObject $h -Compress`
+
+	output, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", psScript).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hotfixes: %w", err)
+	}
+
+	var hotfixes []struct {
+		HotFixID    string
+		Description string
+		InstalledOn string
+	}
+	if err := json.Unmarshal(output, &hotfixes); err != nil {
+		return nil, fmt.Errorf("failed to parse hotfixes: %w", err)
+	}
+
+	items := make([]*InventoryItem, 0, len(hotfixes))
+	now := time.Now()
+	for _, hotfix := range hotfixes {
+		if hotfix.HotFixID == "" || hotfix.HotFixID == "File 1" {
+			continue // placeholder entries of updates without an ID
+		}
+		items = append(items, &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "hotfix",
+			Name:        strings.ToUpper(hotfix.HotFixID),
+			Vendor:      "Microsoft",
+			InstallDate: hotfix.InstalledOn,
+			Description: hotfix.Description,
+			CollectedAt: now,
+		})
+	}
+	return items, nil
+}
+
+// CollectConnections is not implemented on Windows; Sysmon network
+// events cover connections there
+func (c *InventoryCollector) CollectConnections() ([]*InventoryItem, error) {
+	return nil, fmt.Errorf("network connection inventory is only supported on Linux")
+}
+
 // CollectSoftware collects installed software from registry
 func (c *InventoryCollector) CollectSoftware() ([]*InventoryItem, error) {
 	var items []*InventoryItem
@@ -200,7 +259,7 @@ func (c *InventoryCollector) readService(m *mgr.Mgr, serviceName string, collect
 		Name:        serviceName,
 		Description: cfg.DisplayName,
 		InstallPath: cfg.BinaryPathName,
-		Status:      getServiceStatus(status.State),
+		Status:      getServiceStatus(uint32(status.State)),
 		StartType:   getServiceStartType(cfg.StartType),
 		CollectedAt: collectedAt,
 	}
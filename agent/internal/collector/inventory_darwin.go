@@ -0,0 +1,443 @@
+//go:build darwin
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Application folders scanned for bundles; apps shipped with the OS live
+// in /System/Applications and are covered by the OS version
+var applicationDirs = []string{
+	"/Applications",
+	"/Applications/Utilities",
+}
+
+// Launch job folders. Apple's own jobs in /System/Library are covered by
+// the OS version.
+var launchJobDirs = []struct {
+	path    string
+	jobType string
+}{
+	{"/Library/LaunchDaemons", "daemon"},
+	{"/Library/LaunchAgents", "agent"},
+}
+
+var (
+	// "Authority=Developer ID Application: Google LLC (EQHXZ8M8AV)"
+	developerIDAuthority = regexp.MustCompile(`^Developer ID Application: (.+?)(?: \([A-Z0-9]+\))?$`)
+
+	// systemextensionsctl list: "*	*	TEAMID	com.vendor.ext (1.2/34)	Name	[activated enabled]"
+	systemExtensionLine = regexp.MustCompile(`^[*\s]*\t[*\s]*\t(\S+)\t(\S+) \(([^)]*)\)\t(.*?)\t\[(.*)\]$`)
+
+	// kmutil showloaded: "... com.vendor.kext (1.2.3) UUID <...>"
+	kextLine = regexp.MustCompile(`\s(\S+) \(([^)]+)\)`)
+)
+
+// InventoryCollector collects application, launch job, profile and
+// extension inventory
+type InventoryCollector struct {
+	agentID  string
+	hostname string
+}
+
+// NewInventoryCollector creates a new inventory collector
+func NewInventoryCollector(agentID, hostname string) *InventoryCollector {
+	return &InventoryCollector{
+		agentID:  agentID,
+		hostname: hostname,
+	}
+}
+
+// CollectAll collects applications, launch jobs, profiles, extensions and
+// OS information
+func (c *InventoryCollector) CollectAll() ([]*InventoryItem, error) {
+	var items []*InventoryItem
+
+	// Collect applications
+	software, err := c.CollectSoftware()
+	if err != nil {
+		log.Printf("Warning: Failed to collect application inventory: %v", err)
+	} else {
+		items = append(items, software...)
+	}
+
+	// Collect launch daemons and agents
+	services, err := c.CollectServices()
+	if err != nil {
+		log.Printf("Warning: Failed to collect launch job inventory: %v", err)
+	} else {
+		items = append(items, services...)
+	}
+
+	// Profiles, extensions and OS version
+	platform := c.CollectPlatform()
+	items = append(items, platform...)
+
+	log.Printf("Collected %d inventory items (%d applications, %d launch jobs, %d profiles/extensions/os)",
+		len(items), len(software), len(services), len(platform))
+
+	return items, nil
+}
+
+// CollectSoftware collects application bundles with their version and
+// code signature
+func (c *InventoryCollector) CollectSoftware() ([]*InventoryItem, error) {
+	var items []*InventoryItem
+	now := time.Now()
+
+	for _, dir := range applicationDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), ".app") {
+				continue
+			}
+			if item := c.readApplication(filepath.Join(dir, entry.Name()), now); item != nil {
+				items = append(items, item)
+			}
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no applications found")
+	}
+	return items, nil
+}
+
+// readApplication reads an application bundle's Info.plist and signature
+func (c *InventoryCollector) readApplication(path string, collectedAt time.Time) *InventoryItem {
+	info, err := readPlist(filepath.Join(path, "Contents", "Info.plist"))
+	if err != nil {
+		return nil
+	}
+
+	name := plistString(info, "CFBundleDisplayName")
+	if name == "" {
+		name = plistString(info, "CFBundleName")
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".app")
+	}
+
+	version := plistString(info, "CFBundleShortVersionString")
+	if version == "" {
+		version = plistString(info, "CFBundleVersion")
+	}
+
+	item := &InventoryItem{
+		AgentID:     c.agentID,
+		Computer:    c.hostname,
+		Type:        "software",
+		Name:        name,
+		Version:     version,
+		InstallPath: path,
+		Description: plistString(info, "CFBundleIdentifier"),
+		CollectedAt: collectedAt,
+	}
+
+	if stat, err := os.Stat(path); err == nil {
+		item.InstallDate = stat.ModTime().Format("2006-01-02")
+	}
+
+	signer, teamID, status := codeSignature(path)
+	item.Vendor = signer
+	item.Status = status
+	if teamID != "" {
+		item.Description += " (team " + teamID + ")"
+	}
+
+	return item
+}
+
+// codeSignature returns the signer, team ID and signature status
+// ("signed", "adhoc" or "unsigned") of a bundle or binary. The signature
+// is described, not verified; verifying hashes every file in the bundle.
+func codeSignature(path string) (signer, teamID, status string) {
+	// codesign -d writes its description to stderr
+	output, err := exec.Command("codesign", "-dv", "--verbose=2", path).CombinedOutput()
+	if err != nil {
+		return "", "", "unsigned"
+	}
+
+	status = "signed"
+	var authorities []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Authority":
+			authorities = append(authorities, value)
+		case "TeamIdentifier":
+			if value != "not set" {
+				teamID = value
+			}
+		case "Signature":
+			if value == "adhoc" {
+				status = "adhoc"
+			}
+		}
+	}
+
+	// The leaf certificate comes first
+	if len(authorities) > 0 {
+		signer = authorities[0]
+		if match := developerIDAuthority.FindStringSubmatch(signer); match != nil {
+			signer = match[1]
+		} else if signer == "Software Signing" || strings.HasPrefix(signer, "Apple Mac OS Application Signing") {
+			signer = "Apple" // Apple and App Store apps
+		}
+	}
+
+	return signer, teamID, status
+}
+
+// CollectServices collects launch daemons and agents installed outside
+// /System, with whether they are loaded
+func (c *InventoryCollector) CollectServices() ([]*InventoryItem, error) {
+	running := loadedLaunchJobs()
+	var items []*InventoryItem
+	now := time.Now()
+
+	for _, dir := range launchJobDirs {
+		paths, _ := filepath.Glob(filepath.Join(dir.path, "*.plist"))
+		for _, path := range paths {
+			job, err := readPlist(path)
+			if err != nil {
+				continue
+			}
+
+			label := plistString(job, "Label")
+			if label == "" {
+				continue
+			}
+
+			program := plistString(job, "Program")
+			if args, ok := job["ProgramArguments"].([]interface{}); ok && len(args) > 0 && program == "" {
+				program, _ = args[0].(string)
+			}
+
+			item := &InventoryItem{
+				AgentID:     c.agentID,
+				Computer:    c.hostname,
+				Type:        "service",
+				Name:        label,
+				InstallPath: program,
+				Description: fmt.Sprintf("launch %s (%s)", dir.jobType, path),
+				StartType:   "Manual",
+				CollectedAt: now,
+			}
+
+			// Reuse Vendor for the account, as on Windows
+			item.Vendor = plistString(job, "UserName")
+			if item.Vendor == "" && dir.jobType == "daemon" {
+				item.Vendor = "root"
+			}
+
+			switch {
+			case plistBool(job, "Disabled"):
+				item.StartType = "Disabled"
+			case plistBool(job, "RunAtLoad") || job["KeepAlive"] != nil:
+				item.StartType = "Automatic"
+			}
+
+			// Agents run in user sessions, so the system domain only knows
+			// about daemons
+			if pid, ok := running[label]; ok {
+				item.Status = "Stopped"
+				if pid != "-" {
+					item.Status = "Running"
+				}
+			} else if dir.jobType == "daemon" {
+				item.Status = "Not loaded"
+			}
+
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// loadedLaunchJobs maps the labels of jobs loaded in the system domain to
+// their PID, or "-" when not running
+func loadedLaunchJobs() map[string]string {
+	jobs := make(map[string]string)
+
+	output, err := exec.Command("launchctl", "list").Output()
+	if err != nil {
+		return jobs
+	}
+
+	// PID	Status	Label
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) == 3 && fields[0] != "PID" {
+			jobs[fields[2]] = fields[0]
+		}
+	}
+
+	return jobs
+}
+
+// CollectPlatform collects configuration profiles, kernel and system
+// extensions and the OS version
+func (c *InventoryCollector) CollectPlatform() []*InventoryItem {
+	var items []*InventoryItem
+	now := time.Now()
+
+	items = append(items, c.collectProfiles(now)...)
+	items = append(items, c.collectSystemExtensions(now)...)
+	items = append(items, c.collectKernelExtensions(now)...)
+
+	if version, err := exec.Command("sw_vers", "-productVersion").Output(); err == nil {
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "os",
+			Name:        "macOS",
+			Version:     strings.TrimSpace(string(version)),
+			Vendor:      "Apple",
+			CollectedAt: now,
+		}
+		if build, err := exec.Command("sw_vers", "-buildVersion").Output(); err == nil {
+			item.Description = "build " + strings.TrimSpace(string(build))
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// CollectConnections is not implemented on macOS yet
+func (c *InventoryCollector) CollectConnections() ([]*InventoryItem, error) {
+	return nil, fmt.Errorf("network connection inventory is only supported on Linux")
+}
+
+// collectProfiles lists device-level configuration profiles (MDM and
+// manually installed). Requires root.
+func (c *InventoryCollector) collectProfiles(collectedAt time.Time) []*InventoryItem {
+	output, err := exec.Command("profiles", "show", "-type", "configuration", "-output", "stdout-xml").Output()
+	if err != nil {
+		log.Printf("Warning: Failed to list configuration profiles: %v", err)
+		return nil
+	}
+
+	root, err := parsePlistDict(output)
+	if err != nil {
+		return nil
+	}
+
+	var items []*InventoryItem
+	for _, entry := range plistArray(root, "_computerlevel") {
+		profile, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "profile",
+			Name:        plistString(profile, "ProfileDisplayName"),
+			Vendor:      plistString(profile, "ProfileOrganization"),
+			Description: plistString(profile, "ProfileIdentifier"),
+			Status:      plistString(profile, "ProfileVerificationState"), // verified, unsigned, ...
+			CollectedAt: collectedAt,
+		}
+		if installDate := plistString(profile, "ProfileInstallDate"); len(installDate) >= 10 {
+			item.InstallDate = installDate[:10]
+		}
+		if item.Name == "" {
+			item.Name = item.Description
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// collectSystemExtensions lists system extensions (network filters,
+// endpoint security clients, drivers) and their activation state
+func (c *InventoryCollector) collectSystemExtensions(collectedAt time.Time) []*InventoryItem {
+	output, err := exec.Command("systemextensionsctl", "list").Output()
+	if err != nil {
+		return nil
+	}
+
+	var items []*InventoryItem
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		match := systemExtensionLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		teamID, bundleID, version, name, state := match[1], match[2], match[3], match[4], match[5]
+
+		items = append(items, &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "extension",
+			Name:        name,
+			Version:     version,
+			Vendor:      teamID,
+			Description: "system extension " + bundleID,
+			Status:      state, // "activated enabled", "terminated waiting to uninstall on reboot", ...
+			CollectedAt: collectedAt,
+		})
+	}
+
+	return items
+}
+
+// collectKernelExtensions lists loaded third-party kernel extensions
+func (c *InventoryCollector) collectKernelExtensions(collectedAt time.Time) []*InventoryItem {
+	output, err := exec.Command("kmutil", "showloaded", "--list-only").Output()
+	if err != nil {
+		return nil
+	}
+
+	var items []*InventoryItem
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		match := kextLine.FindStringSubmatch(scanner.Text())
+		if match == nil || strings.HasPrefix(match[1], "com.apple.") {
+			continue
+		}
+
+		items = append(items, &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "extension",
+			Name:        match[1],
+			Version:     match[2],
+			Description: "kernel extension",
+			Status:      "loaded",
+			CollectedAt: collectedAt,
+		})
+	}
+
+	return items
+}
+
+// plistArray returns an array value from a dictionary
+func plistArray(dict map[string]interface{}, key string) []interface{} {
+	array, _ := dict[key].([]interface{})
+	return array
+}
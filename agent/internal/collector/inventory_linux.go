@@ -0,0 +1,403 @@
+//go:build linux
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InventoryCollector collects package, service and OS inventory
+type InventoryCollector struct {
+	agentID  string
+	hostname string
+}
+
+// NewInventoryCollector creates a new inventory collector
+func NewInventoryCollector(agentID, hostname string) *InventoryCollector {
+	return &InventoryCollector{
+		agentID:  agentID,
+		hostname: hostname,
+	}
+}
+
+// CollectAll collects packages, services and OS information
+func (c *InventoryCollector) CollectAll() ([]*InventoryItem, error) {
+	var items []*InventoryItem
+
+	// Collect packages
+	software, err := c.CollectSoftware()
+	if err != nil {
+		log.Printf("Warning: Failed to collect package inventory: %v", err)
+	} else {
+		items = append(items, software...)
+	}
+
+	// Collect systemd services
+	services, err := c.CollectServices()
+	if err != nil {
+		log.Printf("Warning: Failed to collect services inventory: %v", err)
+	} else {
+		items = append(items, services...)
+	}
+
+	// OS release and kernel
+	items = append(items, c.CollectPlatform()...)
+
+	log.Printf("Collected %d inventory items (%d packages, %d services)",
+		len(items), len(software), len(services))
+
+	return items, nil
+}
+
+// CollectSoftware collects installed packages from dpkg or rpm
+func (c *InventoryCollector) CollectSoftware() ([]*InventoryItem, error) {
+	// In container mode the host's package database decides, not the
+	// tools in the agent's image
+	if hostRoot != "/" {
+		if _, err := os.Stat(hostPath("/var/lib/dpkg/status")); err == nil {
+			return c.collectDpkg()
+		}
+		return c.collectRPM()
+	}
+
+	if _, err := exec.LookPath("dpkg-query"); err == nil {
+		return c.collectDpkg()
+	}
+	if _, err := exec.LookPath("rpm"); err == nil {
+		return c.collectRPM()
+	}
+	return nil, fmt.Errorf("no supported package manager (dpkg, rpm)")
+}
+
+// collectDpkg lists installed Debian packages. dpkg does not record install
+// dates; the modification time of the package's file list is used instead.
+func (c *InventoryCollector) collectDpkg() ([]*InventoryItem, error) {
+	output, err := exec.Command("dpkg-query", "--admindir="+hostPath("/var/lib/dpkg"), "-W",
+		"-f=${Package}\t${Version}\t${Maintainer}\t${Architecture}\t${db:Status-Status}\t${binary:Summary}\n").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dpkg packages: %w", err)
+	}
+
+	var items []*InventoryItem
+	now := time.Now()
+
+	for _, fields := range splitTabLines(output, 6) {
+		name, version, maintainer, arch, status, summary := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+		if status != "installed" {
+			continue // removed packages with config files left behind
+		}
+
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "software",
+			Name:        name,
+			Version:     version,
+			Vendor:      maintainer,
+			Description: summary,
+			CollectedAt: now,
+		}
+
+		for _, list := range []string{name + ":" + arch + ".list", name + ".list"} {
+			if info, err := os.Stat(hostPath("/var/lib/dpkg/info/" + list)); err == nil {
+				item.InstallDate = info.ModTime().Format("2006-01-02")
+				break
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// collectRPM lists installed RPM packages
+func (c *InventoryCollector) collectRPM() ([]*InventoryItem, error) {
+	output, err := exec.Command("rpm", "--root", hostRoot, "-qa",
+		"--queryformat", `%{NAME}\t%{EPOCH}\t%{VERSION}-%{RELEASE}\t%{VENDOR}\t%{ARCH}\t%{INSTALLTIME}\t%{SUMMARY}\n`).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rpm packages: %w", err)
+	}
+
+	var items []*InventoryItem
+	now := time.Now()
+
+	for _, fields := range splitTabLines(output, 7) {
+		name, epoch, version, vendor, arch, installTime, summary := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+		if name == "gpg-pubkey" {
+			continue // imported signing keys, not packages
+		}
+		if epoch != "(none)" && epoch != "" {
+			version = epoch + ":" + version
+		}
+		if arch != "(none)" && arch != "noarch" {
+			name = name + "." + arch // multilib packages are installed once per arch
+		}
+		if vendor == "(none)" {
+			vendor = ""
+		}
+
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "software",
+			Name:        name,
+			Version:     version,
+			Vendor:      vendor,
+			Description: summary,
+			CollectedAt: now,
+		}
+		if seconds, err := strconv.ParseInt(installTime, 10, 64); err == nil {
+			item.InstallDate = time.Unix(seconds, 0).Format("2006-01-02")
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// CollectServices collects systemd service units with their state and
+// whether they are enabled
+func (c *InventoryCollector) CollectServices() ([]*InventoryItem, error) {
+	if hostRoot != "/" {
+		return nil, fmt.Errorf("service inventory is not available in container mode")
+	}
+
+	unitFiles, err := exec.Command("systemctl", "list-unit-files", "--type=service", "--no-legend", "--no-pager").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unit files: %w", err)
+	}
+
+	units, err := exec.Command("systemctl", "list-units", "--type=service", "--all", "--no-legend", "--no-pager", "--plain").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	var items []*InventoryItem
+	itemsByName := make(map[string]*InventoryItem)
+	now := time.Now()
+
+	newItem := func(name string) *InventoryItem {
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "service",
+			Name:        name,
+			Status:      "Stopped",
+			StartType:   "Manual",
+			CollectedAt: now,
+		}
+		items = append(items, item)
+		itemsByName[name] = item
+		return item
+	}
+
+	// UNIT FILE  STATE  [PRESET]
+	scanner := bufio.NewScanner(bytes.NewReader(unitFiles))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasSuffix(fields[0], "@.service") || fields[1] == "alias" {
+			continue // templates only run as instances; aliases repeat another unit
+		}
+		newItem(fields[0]).StartType = getUnitStartType(fields[1])
+	}
+
+	// UNIT  LOAD  ACTIVE  SUB  DESCRIPTION
+	scanner = bufio.NewScanner(bytes.NewReader(units))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] == "not-found" {
+			continue
+		}
+
+		item, ok := itemsByName[fields[0]]
+		if !ok {
+			item = newItem(fields[0]) // template instances, generated units
+		}
+		item.Status = getUnitStatus(fields[2], fields[3])
+		item.Description = strings.Join(fields[4:], " ")
+	}
+
+	return items, nil
+}
+
+// CollectPlatform reports the OS release, running kernel and local
+// identities (users, groups, sudo rules, SSH keys)
+func (c *InventoryCollector) CollectPlatform() []*InventoryItem {
+	var items []*InventoryItem
+	now := time.Now()
+
+	release := readOSRelease()
+	if release["NAME"] != "" {
+		name := release["PRETTY_NAME"]
+		if name == "" {
+			name = release["NAME"]
+		}
+		items = append(items, &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "os",
+			Name:        name,
+			Version:     release["VERSION_ID"],
+			Vendor:      release["ID"],
+			Description: release["VERSION"],
+			CollectedAt: now,
+		})
+	}
+
+	if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "os",
+			Name:        "Linux kernel",
+			Version:     strings.TrimSpace(string(kernel)),
+			CollectedAt: now,
+		}
+		if version, err := os.ReadFile("/proc/sys/kernel/version"); err == nil {
+			item.Description = strings.TrimSpace(string(version)) // build number and date
+		}
+		items = append(items, item)
+	}
+
+	identity, err := c.CollectIdentity()
+	if err != nil {
+		log.Printf("Warning: Failed to collect identity inventory: %v", err)
+	}
+	items = append(items, identity...)
+
+	return items
+}
+
+// CollectConnections reports listening sockets and established
+// connections with their owning processes
+func (c *InventoryCollector) CollectConnections() ([]*InventoryItem, error) {
+	sockets, err := readSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := socketOwners()
+	var userNames uidNames
+	var items []*InventoryItem
+	now := time.Now()
+
+	for _, socket := range sockets {
+		local := formatEndpoint(socket.LocalIP, socket.LocalPort)
+		item := &InventoryItem{
+			AgentID:     c.agentID,
+			Computer:    c.hostname,
+			Type:        "connection",
+			CollectedAt: now,
+		}
+		switch {
+		case socket.listening():
+			item.Name = socket.Protocol + " " + local
+			item.Status = "Listening"
+		case socket.State == "ESTABLISHED":
+			item.Name = fmt.Sprintf("%s %s -> %s", socket.Protocol, local, formatEndpoint(socket.RemoteIP, socket.RemotePort))
+			item.Status = "Established"
+		default:
+			continue
+		}
+
+		user := userNames.lookup(socket.UID)
+		if process := owners[socket.Inode]; process != nil {
+			item.InstallPath = process.Image
+			item.Description = fmt.Sprintf("%s (pid %d, %s)", process.Name, process.PID, user)
+		} else {
+			item.Description = user
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// readOSRelease parses the host's /etc/os-release (or /usr/lib/os-release)
+func readOSRelease() map[string]string {
+	release := make(map[string]string)
+
+	data, err := os.ReadFile(hostPath("/etc/os-release"))
+	if err != nil {
+		if data, err = os.ReadFile(hostPath("/usr/lib/os-release")); err != nil {
+			return release
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		release[key] = value
+	}
+
+	return release
+}
+
+// getUnitStatus converts systemd ACTIVE/SUB states to the service status
+// names used on Windows
+func getUnitStatus(active, sub string) string {
+	switch active {
+	case "active":
+		if sub == "exited" {
+			return "Stopped" // oneshot that ran successfully
+		}
+		return "Running"
+	case "activating", "reloading":
+		return "Starting"
+	case "deactivating":
+		return "Stopping"
+	case "failed":
+		return "Failed"
+	case "inactive":
+		return "Stopped"
+	default:
+		return "Unknown"
+	}
+}
+
+// getUnitStartType converts a unit file state to the start type names used
+// on Windows
+func getUnitStartType(state string) string {
+	switch state {
+	case "enabled", "enabled-runtime":
+		return "Automatic"
+	case "disabled", "masked", "masked-runtime":
+		return "Disabled"
+	default: // static, indirect, generated, transient
+		return "Manual"
+	}
+}
+
+// splitTabLines splits command output into lines of tab-separated fields,
+// skipping lines that do not have exactly n fields
+func splitTabLines(output []byte, n int) [][]string {
+	var lines [][]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) == n {
+			lines = append(lines, fields)
+		}
+	}
+
+	return lines
+}
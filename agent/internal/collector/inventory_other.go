@@ -0,0 +1,38 @@
+//go:build !windows && !linux && !darwin
+
+package collector
+
+import "fmt"
+
+// InventoryCollector collects inventory (Windows, Linux and macOS only)
+type InventoryCollector struct{}
+
+// NewInventoryCollector creates an inventory collector that finds nothing
+func NewInventoryCollector(agentID, hostname string) *InventoryCollector {
+	return &InventoryCollector{}
+}
+
+// CollectAll fails on unsupported platforms
+func (c *InventoryCollector) CollectAll() ([]*InventoryItem, error) {
+	return nil, fmt.Errorf("inventory is not supported on this platform")
+}
+
+// CollectSoftware fails on unsupported platforms
+func (c *InventoryCollector) CollectSoftware() ([]*InventoryItem, error) {
+	return nil, fmt.Errorf("software inventory is not supported on this platform")
+}
+
+// CollectServices fails on unsupported platforms
+func (c *InventoryCollector) CollectServices() ([]*InventoryItem, error) {
+	return nil, fmt.Errorf("service inventory is not supported on this platform")
+}
+
+// CollectPlatform returns nothing on unsupported platforms
+func (c *InventoryCollector) CollectPlatform() []*InventoryItem {
+	return nil
+}
+
+// CollectConnections fails on unsupported platforms
+func (c *InventoryCollector) CollectConnections() ([]*InventoryItem, error) {
+	return nil, fmt.Errorf("network connection inventory is only supported on Linux")
+}
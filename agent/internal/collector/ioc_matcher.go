@@ -0,0 +1,444 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Indicator types of an IOC list
+const (
+	IOCTypeHash   = "hash"   // file hashes of any algorithm, hex
+	IOCTypeIP     = "ip"     // IPv4 and IPv6 addresses
+	IOCTypeDomain = "domain" // domains; subdomains match too
+)
+
+// IOCSet is the threat-intel indicators pushed to an agent. Indicators are
+// not sent in the clear: each list holds either the sorted 8-byte SHA-256
+// prefixes of its normalized indicators (exact up to prefix collisions) or
+// a Bloom filter over them for feeds too large for that. A Bloom hit may be
+// a false positive, which the alert says.
+type IOCSet struct {
+	Version string    `json:"version"`
+	Lists   []IOCList `json:"lists"`
+}
+
+// IOCList is one feed's indicators of one type
+type IOCList struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`               // "hash", "ip" or "domain"
+	Severity    int    `json:"severity,omitempty"` // of the alert, default 5
+	Digests     string `json:"digests,omitempty"`  // base64, sorted big-endian 8-byte SHA-256 prefixes
+	Bloom       string `json:"bloom,omitempty"`    // base64 bit array, bit i at byte i/8, mask 1<<(i%8)
+	BloomHashes int    `json:"bloom_hashes,omitempty"`
+}
+
+// IOCStats reports threat-intel matching in heartbeats
+type IOCStats struct {
+	Version    string            `json:"version"`
+	Lists      int               `json:"lists"`
+	Indicators int               `json:"indicators"` // exact indicators; Bloom filters are not counted
+	Matches    uint64            `json:"matches"`    // since the agent started
+	LastSync   time.Time         `json:"last_sync"`
+	Feeds      []TAXIIFeedStatus `json:"feeds,omitempty"`
+}
+
+// iocList is a decoded IOCList
+type iocList struct {
+	name     string
+	kind     string
+	severity int
+	digests  []uint64
+	bloom    []byte
+	hashes   int
+}
+
+// contains reports whether the indicator digest is in the list, and
+// whether that is certain
+func (l *iocList) contains(sum [sha256.Size]byte) (found, exact bool) {
+	if l.bloom != nil {
+		bits := uint64(len(l.bloom)) * 8
+		h1 := binary.BigEndian.Uint64(sum[0:8])
+		h2 := binary.BigEndian.Uint64(sum[8:16])
+		for i := 0; i < l.hashes; i++ {
+			bit := (h1 + uint64(i)*h2) % bits
+			if l.bloom[bit/8]&(1<<(bit%8)) == 0 {
+				return false, false
+			}
+		}
+		return true, false
+	}
+
+	digest := binary.BigEndian.Uint64(sum[0:8])
+	i := sort.Search(len(l.digests), func(i int) bool { return l.digests[i] >= digest })
+	return i < len(l.digests) && l.digests[i] == digest, true
+}
+
+// decodeIOCList decodes a list pushed by the server
+func decodeIOCList(list IOCList) (*iocList, error) {
+	decoded := &iocList{name: list.Name, kind: list.Type, severity: list.Severity}
+	if decoded.severity < 1 || decoded.severity > 5 {
+		decoded.severity = 5
+	}
+
+	switch list.Type {
+	case IOCTypeHash, IOCTypeIP, IOCTypeDomain:
+	default:
+		return nil, fmt.Errorf("unknown indicator type %q", list.Type)
+	}
+
+	if list.Bloom != "" {
+		bloom, err := base64.StdEncoding.DecodeString(list.Bloom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Bloom filter: %w", err)
+		}
+		if len(bloom) == 0 || list.BloomHashes <= 0 {
+			return nil, fmt.Errorf("empty Bloom filter")
+		}
+		decoded.bloom, decoded.hashes = bloom, list.BloomHashes
+		return decoded, nil
+	}
+
+	digests, err := base64.StdEncoding.DecodeString(list.Digests)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digests: %w", err)
+	}
+	if len(digests)%8 != 0 {
+		return nil, fmt.Errorf("digests are not a multiple of 8 bytes")
+	}
+	decoded.digests = make([]uint64, len(digests)/8)
+	for i := range decoded.digests {
+		decoded.digests[i] = binary.BigEndian.Uint64(digests[i*8:])
+	}
+	// Servers are expected to sort, but a lookup miss would be silent
+	sort.Slice(decoded.digests, func(i, j int) bool { return decoded.digests[i] < decoded.digests[j] })
+
+	return decoded, nil
+}
+
+// IOCMatcher matches process, network and DNS events against the
+// threat-intel indicators pushed by the server, and those pulled from TAXII
+// feeds, as they are queued, and raises a high-severity alert for every
+// hit. Only the compact digests are kept on the agent, so the server's
+// indicators themselves are not disclosed to the endpoint.
+type IOCMatcher struct {
+	config   *config.ThreatIntelConfig
+	agentID  string
+	hostname string
+	fetch    func() (*IOCSet, error)
+
+	mutex    sync.RWMutex
+	version  string
+	server   []*iocList            // pushed by the server
+	feeds    map[string][]*iocList // pulled from TAXII feeds, by feed name
+	lists    []*iocList            // server and feed lists, matched against events
+	matches  uint64
+	lastSync time.Time
+}
+
+// NewIOCMatcher creates the matcher with the indicators kept from the last
+// sync
+func NewIOCMatcher(cfg *config.ThreatIntelConfig, agentID, hostname string) *IOCMatcher {
+	m := &IOCMatcher{
+		config:   cfg,
+		agentID:  agentID,
+		hostname: hostname,
+		feeds:    make(map[string][]*iocList),
+	}
+
+	if data, err := os.ReadFile(cfg.IOCFile); err == nil {
+		var set IOCSet
+		if err := json.Unmarshal(data, &set); err != nil {
+			log.Printf("Warning: Failed to read stored IOC sets: %v", err)
+		} else {
+			m.Load(&set)
+		}
+	}
+
+	return m
+}
+
+// SetIOCSource sets the callback that downloads the indicators for this
+// agent
+func (m *IOCMatcher) SetIOCSource(fetch func() (*IOCSet, error)) {
+	m.fetch = fetch
+}
+
+// StartIOCSync downloads the indicators immediately and then periodically
+func (m *IOCMatcher) StartIOCSync(ctx context.Context) {
+	if m.fetch == nil {
+		return
+	}
+
+	interval := time.Duration(m.config.SyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = time.Hour
+	}
+
+	if err := m.SyncIOCs(); err != nil {
+		log.Printf("Error syncing IOC sets: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.SyncIOCs(); err != nil {
+				log.Printf("Error syncing IOC sets: %v", err)
+			}
+		}
+	}
+}
+
+// SyncIOCs downloads, loads and stores the indicators
+func (m *IOCMatcher) SyncIOCs() error {
+	set, err := m.fetch()
+	if err != nil {
+		return fmt.Errorf("failed to fetch IOC sets: %w", err)
+	}
+
+	m.Load(set)
+
+	m.mutex.Lock()
+	m.lastSync = time.Now()
+	m.mutex.Unlock()
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to encode IOC sets: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.IOCFile), 0700); err != nil {
+		return fmt.Errorf("failed to store IOC sets: %w", err)
+	}
+	if err := os.WriteFile(m.config.IOCFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to store IOC sets: %w", err)
+	}
+	return nil
+}
+
+// Load replaces the server's indicators. Lists that do not decode are
+// logged and skipped.
+func (m *IOCMatcher) Load(set *IOCSet) {
+	lists, indicators := decodeIOCLists(set.Lists)
+
+	m.mutex.Lock()
+	m.version = set.Version
+	m.server = lists
+	m.combine()
+	m.mutex.Unlock()
+
+	log.Printf("Loaded %d IOC lists, version %s (%d exact indicators)", len(lists), set.Version, indicators)
+}
+
+// LoadFeed replaces the indicators of a TAXII feed
+func (m *IOCMatcher) LoadFeed(name string, lists []IOCList) {
+	decoded, _ := decodeIOCLists(lists)
+
+	m.mutex.Lock()
+	m.feeds[name] = decoded
+	m.combine()
+	m.mutex.Unlock()
+}
+
+// combine rebuilds the matched lists; the caller holds the lock. Inspect
+// keeps using the previous slice, so it is replaced, not modified.
+func (m *IOCMatcher) combine() {
+	lists := append([]*iocList(nil), m.server...)
+	for _, feed := range m.feeds {
+		lists = append(lists, feed...)
+	}
+	m.lists = lists
+}
+
+// decodeIOCLists decodes lists, logging and skipping the invalid ones, and
+// counts their exact indicators
+func decodeIOCLists(lists []IOCList) ([]*iocList, int) {
+	decoded := make([]*iocList, 0, len(lists))
+	indicators := 0
+	for _, list := range lists {
+		d, err := decodeIOCList(list)
+		if err != nil {
+			log.Printf("Warning: IOC list %q rejected: %v", list.Name, err)
+			continue
+		}
+		decoded = append(decoded, d)
+		indicators += len(d.digests)
+	}
+	return decoded, indicators
+}
+
+// NewIOCList builds an exact list from indicator values, normalized and
+// digested as the server does
+func NewIOCList(name, kind string, severity int, values []string) IOCList {
+	digests := make([]uint64, 0, len(values))
+	for _, value := range values {
+		value = normalizeIndicator(kind, value)
+		if value == "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(value))
+		digests = append(digests, binary.BigEndian.Uint64(sum[0:8]))
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i] < digests[j] })
+
+	encoded := make([]byte, 8*len(digests))
+	for i, digest := range digests {
+		binary.BigEndian.PutUint64(encoded[i*8:], digest)
+	}
+	return IOCList{
+		Name:     name,
+		Type:     kind,
+		Severity: severity,
+		Digests:  base64.StdEncoding.EncodeToString(encoded),
+	}
+}
+
+// normalizeIndicator lower-cases an indicator value; domains lose a
+// trailing dot
+func normalizeIndicator(kind, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if kind == IOCTypeDomain {
+		value = strings.TrimSuffix(value, ".")
+	}
+	return value
+}
+
+// Inspect returns an alert for every indicator the event references. The
+// agent's own health and alert events are not matched.
+func (m *IOCMatcher) Inspect(event *Event) []*Event {
+	if event.SourceType == AgentHealthSourceType || event.SourceType == DetectionSourceType {
+		return nil
+	}
+
+	m.mutex.RLock()
+	lists := m.lists
+	m.mutex.RUnlock()
+	if len(lists) == 0 {
+		return nil
+	}
+
+	var alerts []*Event
+	for _, observable := range eventObservables(event) {
+		sum := sha256.Sum256([]byte(observable.value))
+		for _, list := range lists {
+			if list.kind != observable.kind {
+				continue
+			}
+			if found, exact := list.contains(sum); found {
+				alerts = append(alerts, m.alert(list, observable, exact, event))
+			}
+		}
+	}
+
+	if len(alerts) > 0 {
+		m.mutex.Lock()
+		m.matches += uint64(len(alerts))
+		m.mutex.Unlock()
+	}
+	return alerts
+}
+
+// alert builds the alert for a hit
+func (m *IOCMatcher) alert(list *iocList, observable iocObservable, exact bool, event *Event) *Event {
+	confidence := "exact"
+	if !exact {
+		confidence = "probable" // Bloom filter
+	}
+	return newDetectionAlert(m.agentID, m.hostname, event, DetectionEventIOCMatch, list.severity,
+		fmt.Sprintf("Threat-intel indicator matched: %s %s (%s)", observable.kind, observable.value, list.name),
+		map[string]string{
+			"ioc_list":       list.name,
+			"ioc_type":       observable.kind,
+			"ioc_value":      observable.value,
+			"ioc_field":      observable.field,
+			"ioc_confidence": confidence,
+		})
+}
+
+// Stats returns the indicator counts for heartbeats
+func (m *IOCMatcher) Stats() *IOCStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	stats := &IOCStats{
+		Version:  m.version,
+		Lists:    len(m.lists),
+		Matches:  m.matches,
+		LastSync: m.lastSync,
+	}
+	for _, list := range m.lists {
+		stats.Indicators += len(list.digests)
+	}
+	return stats
+}
+
+// iocObservable is a normalized indicator candidate taken from an event
+type iocObservable struct {
+	kind  string
+	value string
+	field string // where it came from
+}
+
+// eventObservables returns the hashes, addresses and domains an event
+// references, normalized as the server digests them: lower case, domains
+// without a trailing dot. Parent domains of a domain are included so a
+// listed domain also matches its subdomains.
+func eventObservables(event *Event) []iocObservable {
+	var observables []iocObservable
+	add := func(kind, value, field string) {
+		value = normalizeIndicator(kind, value)
+		if value == "" || value == "-" {
+			return
+		}
+		for _, o := range observables {
+			if o.kind == kind && o.value == value {
+				return
+			}
+		}
+		observables = append(observables, iocObservable{kind: kind, value: value, field: field})
+	}
+
+	// Sysmon lists hashes as "SHA256=...,MD5=...,IMPHASH=..."
+	add(IOCTypeHash, event.FileHash, "file_hash")
+	for _, key := range [...]string{"Hashes", "FileHash", "Hash"} {
+		for _, hash := range strings.Split(event.EventData[key], ",") {
+			if _, value, ok := strings.Cut(hash, "="); ok {
+				hash = value
+			}
+			add(IOCTypeHash, hash, key)
+		}
+	}
+
+	add(IOCTypeIP, event.SourceIP, "source_ip")
+	add(IOCTypeIP, event.DestinationIP, "destination_ip")
+
+	for _, key := range [...]string{"QueryName", "DestinationHostname"} {
+		domain := strings.TrimSuffix(event.EventData[key], ".")
+		for domain != "" {
+			add(IOCTypeDomain, domain, key)
+			_, parent, ok := strings.Cut(domain, ".")
+			if !ok || !strings.Contains(parent, ".") {
+				break // stop at the registrable domain, not the TLD
+			}
+			domain = parent
+		}
+	}
+
+	return observables
+}
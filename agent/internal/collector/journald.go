@@ -0,0 +1,386 @@
+//go:build linux
+
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const JournaldSourceType = "journald"
+
+const (
+	// journalctl is restarted after this delay if it exits
+	journalRestartDelay = 10 * time.Second
+
+	// The cursor is written at most this often while entries stream in
+	journalCursorSaveInterval = 5 * time.Second
+
+	// Largest journal entry read; longer lines are skipped
+	journalMaxEntrySize = 1024 * 1024
+)
+
+// JournaldCollector tails the systemd journal
+type JournaldCollector struct {
+	config      *config.JournaldConfig
+	agentID     string
+	hostname    string
+	units       map[string]bool
+	identifiers map[string]bool
+	eventQueue  *EventQueue
+	wg          sync.WaitGroup
+	stopChan    chan struct{}
+
+	userNames uidNames
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	cursor  string
+	savedAt time.Time
+}
+
+// NewJournaldCollector creates a new journal collector
+func NewJournaldCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*JournaldCollector, error) {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, fmt.Errorf("journalctl not found: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	c := &JournaldCollector{
+		config:      &cfg.Journald,
+		agentID:     agentID,
+		hostname:    hostname,
+		units:       make(map[string]bool),
+		identifiers: make(map[string]bool),
+		eventQueue:  eventQueue,
+		stopChan:    make(chan struct{}),
+	}
+	for _, unit := range cfg.Journald.Units {
+		c.units[unit] = true
+	}
+	for _, identifier := range cfg.Journald.Identifiers {
+		c.identifiers[identifier] = true
+	}
+
+	return c, nil
+}
+
+// Start begins tailing the journal from the saved cursor
+func (c *JournaldCollector) Start() error {
+	if data, err := os.ReadFile(c.config.CursorFile); err == nil {
+		c.cursor = strings.TrimSpace(string(data))
+	}
+
+	if c.cursor != "" {
+		log.Println("Starting journald collector from saved cursor")
+	} else {
+		log.Println("Starting journald collector from the end of the journal")
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop stops the collector and saves the cursor
+func (c *JournaldCollector) Stop() {
+	close(c.stopChan)
+
+	c.mu.Lock()
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	c.mu.Lock()
+	if err := c.saveCursor(); err != nil {
+		log.Printf("Warning: Failed to save journal cursor: %v", err)
+	}
+	c.mu.Unlock()
+
+	log.Println("Journald collector stopped")
+}
+
+// run keeps journalctl running until the collector is stopped
+func (c *JournaldCollector) run() {
+	defer c.wg.Done()
+
+	for {
+		if err := c.follow(); err != nil {
+			log.Printf("Error reading journal: %v", err)
+		}
+
+		select {
+		case <-c.stopChan:
+			return
+		case <-time.After(journalRestartDelay):
+		}
+	}
+}
+
+// follow runs journalctl after the current cursor and processes entries
+// until it exits
+func (c *JournaldCollector) follow() error {
+	c.mu.Lock()
+	args := []string{"--output=json", "--follow", "--no-pager", "--quiet",
+		fmt.Sprintf("--priority=0..%d", c.config.MaxPriority)}
+	if hostRoot != "/" {
+		args = append(args, "--root="+hostRoot) // the host's journal in container mode
+	}
+	if c.cursor != "" {
+		args = append(args, "--after-cursor="+c.cursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	cmd := exec.Command("journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+	c.cmd = cmd
+	c.mu.Unlock()
+
+	// Stop may have run before cmd was set
+	select {
+	case <-c.stopChan:
+		cmd.Process.Kill()
+	default:
+	}
+
+	err = c.readEntries(stdout)
+	cmd.Wait()
+
+	c.mu.Lock()
+	c.cmd = nil
+	if saveErr := c.saveCursor(); saveErr != nil {
+		log.Printf("Warning: Failed to save journal cursor: %v", saveErr)
+	}
+	c.mu.Unlock()
+
+	return err
+}
+
+// readEntries processes journalctl JSON output, one entry per line
+func (c *JournaldCollector) readEntries(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), journalMaxEntrySize)
+
+	for scanner.Scan() {
+		var entry map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Failed to parse journal entry: %v", err)
+			continue
+		}
+
+		if !c.processEntry(entry) {
+			return nil
+		}
+	}
+
+	select {
+	case <-c.stopChan:
+		return nil
+	default:
+		return scanner.Err()
+	}
+}
+
+// processEntry queues an entry that passes the filters and advances the
+// cursor. It returns false when the collector is stopping.
+func (c *JournaldCollector) processEntry(entry map[string]json.RawMessage) bool {
+	cursor := journalField(entry, "__CURSOR")
+
+	if c.matches(entry) {
+		event := c.newEvent(entry)
+
+		select {
+		case <-c.stopChan:
+			return false
+		default:
+		}
+		c.eventQueue.Push(event)
+	}
+
+	if cursor != "" {
+		c.mu.Lock()
+		c.cursor = cursor
+		if time.Since(c.savedAt) >= journalCursorSaveInterval {
+			if err := c.saveCursor(); err != nil {
+				log.Printf("Warning: Failed to save journal cursor: %v", err)
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	return true
+}
+
+// matches reports whether an entry passes the unit and identifier filters.
+// With both lists set, an entry matching either one is collected.
+func (c *JournaldCollector) matches(entry map[string]json.RawMessage) bool {
+	if len(c.units) == 0 && len(c.identifiers) == 0 {
+		return true
+	}
+
+	if unit := journalUnit(entry); unit != "" && c.units[unit] {
+		return true
+	}
+	if identifier := journalField(entry, "SYSLOG_IDENTIFIER"); identifier != "" && c.identifiers[identifier] {
+		return true
+	}
+
+	return false
+}
+
+// newEvent converts a journal entry into a normalized event
+func (c *JournaldCollector) newEvent(entry map[string]json.RawMessage) *Event {
+	priority, err := strconv.Atoi(journalField(entry, "PRIORITY"))
+	if err != nil {
+		priority = 6 // journald's default for entries without a priority
+	}
+
+	unit := journalUnit(entry)
+	identifier := journalField(entry, "SYSLOG_IDENTIFIER")
+	comm := journalField(entry, "_COMM")
+
+	provider := identifier
+	if provider == "" {
+		provider = comm
+	}
+	channel := unit
+	if channel == "" {
+		channel = "journal"
+	}
+
+	eventTime := time.Now()
+	if usec, err := strconv.ParseInt(journalField(entry, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		eventTime = time.UnixMicro(usec)
+	}
+
+	computer := journalField(entry, "_HOSTNAME")
+	if computer == "" {
+		computer = c.hostname
+	}
+
+	data := map[string]string{
+		"priority": strconv.Itoa(priority),
+	}
+	if facility, err := strconv.Atoi(journalField(entry, "SYSLOG_FACILITY")); err == nil {
+		data["facility"] = syslogFacilityName(facility)
+	}
+	for key, field := range map[string]string{
+		"unit":       "_SYSTEMD_UNIT",
+		"user_unit":  "_SYSTEMD_USER_UNIT",
+		"identifier": "SYSLOG_IDENTIFIER",
+		"uid":        "_UID",
+		"gid":        "_GID",
+		"transport":  "_TRANSPORT",
+		"boot_id":    "_BOOT_ID",
+		"cursor":     "__CURSOR",
+	} {
+		if value := journalField(entry, field); value != "" {
+			data[key] = value
+		}
+	}
+
+	event := &Event{
+		AgentID:            c.agentID,
+		Computer:           computer,
+		SourceType:         JournaldSourceType,
+		EventCode:          priority,
+		EventTime:          eventTime,
+		Channel:            channel,
+		Provider:           provider,
+		Severity:           SeverityFromSyslogPriority(priority),
+		Message:            journalField(entry, "MESSAGE"),
+		SubjectUser:        c.userNames.lookup(journalField(entry, "_UID")),
+		ProcessName:        comm,
+		ProcessPath:        journalField(entry, "_EXE"),
+		ProcessCommandLine: journalField(entry, "_CMDLINE"),
+		ServiceName:        unit,
+		EventData:          data,
+		CollectedAt:        time.Now(),
+	}
+	if pid, err := strconv.Atoi(journalField(entry, "_PID")); err == nil {
+		event.ProcessID = pid
+	}
+
+	return event
+}
+
+// saveCursor writes the current cursor. Caller must hold c.mu.
+func (c *JournaldCollector) saveCursor() error {
+	if c.cursor == "" {
+		return nil
+	}
+	c.savedAt = time.Now()
+
+	if err := os.MkdirAll(filepath.Dir(c.config.CursorFile), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.config.CursorFile, []byte(c.cursor), 0600)
+}
+
+// journalUnit returns the system unit of an entry, or the user unit for
+// entries from a user session
+func journalUnit(entry map[string]json.RawMessage) string {
+	if unit := journalField(entry, "_SYSTEMD_UNIT"); unit != "" {
+		return unit
+	}
+	return journalField(entry, "_SYSTEMD_USER_UNIT")
+}
+
+// journalField returns a field of a journalctl JSON entry as a string.
+// Fields are normally strings; binary values are arrays of bytes and
+// repeated fields are arrays of values (the first is used).
+func journalField(entry map[string]json.RawMessage, name string) string {
+	raw, ok := entry[name]
+	if !ok {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var bytes []byte
+	var numbers []int
+	if err := json.Unmarshal(raw, &numbers); err == nil {
+		for _, n := range numbers {
+			bytes = append(bytes, byte(n))
+		}
+		return strings.TrimRight(string(bytes), "\n")
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err == nil && len(values) > 0 {
+		return journalField(map[string]json.RawMessage{name: values[0]}, name)
+	}
+
+	return ""
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const JournaldSourceType = "journald"
+
+// JournaldCollector tails the systemd journal (Linux only)
+type JournaldCollector struct{}
+
+// NewJournaldCollector fails outside Linux; there is no systemd journal
+func NewJournaldCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*JournaldCollector, error) {
+	return nil, fmt.Errorf("journald collection is only supported on Linux")
+}
+
+// Start does nothing
+func (c *JournaldCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *JournaldCollector) Stop() {}
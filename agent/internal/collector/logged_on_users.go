@@ -0,0 +1,100 @@
+//go:build windows
+
+package collector
+
+import (
+	"encoding/binary"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	wtsClientName         = 10 // WTS_INFO_CLASS WTSClientName
+	wtsClientProtocolType = 16 // WTS_INFO_CLASS WTSClientProtocolType
+	wtsSessionInfo        = 24 // WTS_INFO_CLASS WTSSessionInfo
+
+	// WTSINFOW.LogonTime: eight DWORDs, then WinStationName[32], Domain[17]
+	// and UserName[21] WCHARs, padded to 8 bytes for the LARGE_INTEGER
+	// times (ConnectTime, DisconnectTime, LastInputTime, LogonTime)
+	wtsInfoLogonTimeOffset = 200
+)
+
+// LoggedOnUsers lists the users logged on to interactive and RDP sessions,
+// including disconnected sessions that are still logged on
+func LoggedOnUsers() []LoggedOnUser {
+	var sessions *windows.WTS_SESSION_INFO
+	var count uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &sessions, &count); err != nil {
+		return nil
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(sessions)))
+
+	var users []LoggedOnUser
+	for _, session := range unsafe.Slice(sessions, count) {
+		account := sessionAccount(session.SessionID)
+		if account == "" {
+			continue // services session, listeners, logon screen
+		}
+
+		user := LoggedOnUser{
+			User:        account,
+			SessionID:   session.SessionID,
+			SessionType: "console",
+			State:       sessionStateName(session.State),
+		}
+
+		if protocol := querySessionInfo(session.SessionID, wtsClientProtocolType); len(protocol) >= 2 &&
+			binary.LittleEndian.Uint16(protocol) == 2 { // WTS_PROTOCOL_TYPE_RDP
+			user.SessionType = "rdp"
+			user.ClientName = querySessionString(session.SessionID, wtsClientName)
+		}
+
+		if info := querySessionInfo(session.SessionID, wtsSessionInfo); len(info) >= wtsInfoLogonTimeOffset+8 {
+			if logonTime := binary.LittleEndian.Uint64(info[wtsInfoLogonTimeOffset:]); logonTime > 0 {
+				ft := windows.Filetime{LowDateTime: uint32(logonTime), HighDateTime: uint32(logonTime >> 32)}
+				user.LogonTime = time.Unix(0, ft.Nanoseconds())
+			}
+		}
+
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// sessionStateName names a WTS_CONNECTSTATE_CLASS value
+func sessionStateName(state uint32) string {
+	switch state {
+	case windows.WTSActive:
+		return "active"
+	case windows.WTSConnected:
+		return "connected"
+	case windows.WTSDisconnected:
+		return "disconnected"
+	case windows.WTSIdle:
+		return "idle"
+	}
+	return "other"
+}
+
+// querySessionInfo queries a terminal session property as raw bytes
+func querySessionInfo(sessionID uint32, infoClass uint32) []byte {
+	var buffer *byte
+	var bytesReturned uint32
+
+	ret, _, _ := procWTSQuerySessionInformationW.Call(
+		0, // WTS_CURRENT_SERVER_HANDLE
+		uintptr(sessionID),
+		uintptr(infoClass),
+		uintptr(unsafe.Pointer(&buffer)),
+		uintptr(unsafe.Pointer(&bytesReturned)),
+	)
+	if ret == 0 || buffer == nil {
+		return nil
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buffer)))
+
+	return append([]byte(nil), unsafe.Slice(buffer, bytesReturned)...)
+}
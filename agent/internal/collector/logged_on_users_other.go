@@ -0,0 +1,8 @@
+//go:build !windows
+
+package collector
+
+// LoggedOnUsers is not collected outside Windows yet
+func LoggedOnUsers() []LoggedOnUser {
+	return nil
+}
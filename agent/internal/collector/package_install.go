@@ -0,0 +1,161 @@
+//go:build windows
+
+package collector
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Install methods reported for package-manager and script installs
+const (
+	InstallMethodPip              = "pip"
+	InstallMethodNpm              = "npm"
+	InstallMethodChocolatey       = "choco"
+	InstallMethodWinget           = "winget"
+	InstallMethodPowerShellModule = "powershell_module"
+	InstallMethodScript           = "script"
+)
+
+// packageInstallPattern detects one kind of install from a command line.
+// The first capture group, if any, holds the package arguments. If also is
+// set, the command line must match it too.
+type packageInstallPattern struct {
+	method string
+	re     *regexp.Regexp
+	also   *regexp.Regexp
+}
+
+var packageInstallPatterns = []packageInstallPattern{
+	{InstallMethodPip, regexp.MustCompile(`(?i)(?:\bpip[0-9.]*(?:\.exe)?"?|\bpython[0-9.]*(?:\.exe)?"?\s+-m\s+pip)\s+install\s+(.+)`), nil},
+	// Only global npm installs put software on the machine
+	{InstallMethodNpm, regexp.MustCompile(`(?i)\bnpm(?:\.cmd|-cli\.js)?"?\s+(?:.*?\s)?(?:install|i|add)\s+(.+)`), regexp.MustCompile(`\s(?:-g|--global)\b`)},
+	{InstallMethodChocolatey, regexp.MustCompile(`(?i)\bchoco(?:latey)?(?:\.exe)?"?\s+(?:install|upgrade)\s+(.+)`), nil},
+	{InstallMethodWinget, regexp.MustCompile(`(?i)\bwinget(?:\.exe)?"?\s+(?:install|upgrade)\s+(.+)`), nil},
+	{InstallMethodPowerShellModule, regexp.MustCompile(`(?i)\b(?:Install-Module|Install-Package|Install-Script)\s+(.+)`), nil},
+	// Downloaded script piped into Invoke-Expression, e.g. iwr https://x/install.ps1 | iex
+	{InstallMethodScript, regexp.MustCompile(`(?i)(?:\b(?:iwr|irm|Invoke-WebRequest|Invoke-RestMethod)\b|\.DownloadString\().*\|\s*(?:iex|Invoke-Expression)\b`), nil},
+	{InstallMethodScript, regexp.MustCompile(`(?i)\b(?:iex|Invoke-Expression)\b.*(?:\b(?:iwr|irm|Invoke-WebRequest|Invoke-RestMethod)\b|\.DownloadString\()`), nil},
+}
+
+// DetectPackageInstall checks whether a command line installs software through
+// a package manager or a downloaded script. It returns the install method and
+// a short description of what is being installed.
+func DetectPackageInstall(commandLine string) (method, target string, ok bool) {
+	if commandLine == "" {
+		return "", "", false
+	}
+
+	for _, pattern := range packageInstallPatterns {
+		match := pattern.re.FindStringSubmatch(commandLine)
+		if match == nil || (pattern.also != nil && !pattern.also.MatchString(commandLine)) {
+			continue
+		}
+
+		if pattern.method == InstallMethodScript {
+			return pattern.method, "downloaded script", true
+		}
+
+		target = packageNames(match[1])
+		if target == "" {
+			target = pattern.method + " package"
+		}
+		return pattern.method, target, true
+	}
+
+	return "", "", false
+}
+
+// packageNames extracts package names from install arguments, skipping options
+func packageNames(args string) string {
+	var names []string
+	skipValue := false
+
+	for _, field := range strings.Fields(args) {
+		field = strings.Trim(field, `"'`)
+		switch {
+		case field == "" || field == "|" || field == ";" || field == "&&":
+			if len(names) > 0 {
+				return strings.Join(names, ", ")
+			}
+		case skipValue:
+			skipValue = false
+		case strings.HasPrefix(field, "-"):
+			// Options that take a separate value
+			switch strings.ToLower(strings.TrimLeft(field, "-")) {
+			case "name", "id":
+				// The value is the package name itself
+			case "r", "requirement", "source", "s", "version", "v", "index-url", "i", "scope", "repository":
+				skipValue = true
+			}
+		default:
+			names = append(names, field)
+			if len(names) == 3 {
+				return strings.Join(names, ", ") + ", ..."
+			}
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Inspect checks a process creation event (Security 4688 or Sysmon 1) for
+// package-manager and script installs and sends them through approval
+func (i *InstallerInterceptor) Inspect(event *Event) []*Event {
+	isSysmon := strings.Contains(event.Provider, "Sysmon")
+	if !(event.EventCode == 4688 && !isSysmon) && !(event.EventCode == 1 && isSysmon) {
+		return nil
+	}
+
+	if _, _, ok := DetectPackageInstall(event.ProcessCommandLine); !ok {
+		return nil
+	}
+
+	// 4688 reports the process ID in hex
+	pid := uint32(event.ProcessID)
+	if pid == 0 {
+		if value, err := strconv.ParseUint(event.EventData["NewProcessId"], 0, 32); err == nil {
+			pid = uint32(value)
+		}
+	}
+	if pid == 0 || pid == i.selfPID {
+		return nil
+	}
+
+	userName := event.TargetUser
+	if userName == "" && event.SubjectUser != "" {
+		userName = event.SubjectUser
+		if event.SubjectDomain != "" {
+			userName = event.SubjectDomain + "\\" + userName
+		}
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// Already held by the process table scan
+	if i.held[pid] {
+		return nil
+	}
+
+	// The event may arrive after the process has finished, or its PID may
+	// have been reused; the attempt is still sent for approval so it is recorded
+	imagePath, err := processImagePath(pid)
+	if err != nil || !strings.EqualFold(imagePath, event.ProcessName) || suspendProcess(pid) != nil {
+		log.Printf("Package install already finished, reporting only: %s", event.ProcessCommandLine)
+		go i.control.CheckInstallationAttempt(event.ProcessName, event.ProcessCommandLine, userName, "")
+		return nil
+	}
+	i.held[pid] = true
+
+	log.Printf("Package install held pending approval: %s (PID %d)", event.ProcessCommandLine, pid)
+
+	// The event is reused once sent; the decision outlives it
+	processName, commandLine := event.ProcessName, event.ProcessCommandLine
+	go i.decide(pid, processName, func() (bool, *SoftwareInstallRequest, error) {
+		return i.control.CheckHeldInstallation(pid, processName, commandLine, userName)
+	})
+	return nil
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// DefaultPasswordCharset omits characters that are easy to confuse when a
+// password is read out over the phone (0/O, 1/l/I)
+const DefaultPasswordCharset = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// minPasswordLength is the shortest password GeneratePassword will produce
+const minPasswordLength = 8
+
+// GeneratePassword returns a password drawn uniformly from charset using
+// crypto/rand. An empty charset selects DefaultPasswordCharset. Callers must
+// never log the result.
+func GeneratePassword(length int, charset string) (string, error) {
+	if charset == "" {
+		charset = DefaultPasswordCharset
+	}
+	if length < minPasswordLength {
+		length = minPasswordLength
+	}
+
+	chars := []rune(charset)
+	if len(chars) < 2 {
+		return "", fmt.Errorf("password charset is too small")
+	}
+
+	size := big.NewInt(int64(len(chars)))
+	password := make([]rune, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+		password[i] = chars[n.Int64()]
+	}
+
+	return string(password), nil
+}
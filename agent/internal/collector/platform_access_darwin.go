@@ -0,0 +1,71 @@
+//go:build darwin
+
+package collector
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Full Disk Access can be granted or revoked (MDM profile, System
+// Settings) while the agent runs, so the check is repeated
+const platformAccessTTL = 10 * time.Minute
+
+// tccDatabase is only readable with Full Disk Access, even by root
+const tccDatabase = "/Library/Application Support/com.apple.TCC/TCC.db"
+
+var (
+	platformAccessMutex   sync.Mutex
+	platformAccessCached  *PlatformAccess
+	platformAccessChecked time.Time
+)
+
+// CheckPlatformAccess reports whether the agent runs as root and has Full
+// Disk Access. Without root the unified log hides other processes'
+// messages; without Full Disk Access TCC-protected logs and user data are
+// unreadable.
+func CheckPlatformAccess() *PlatformAccess {
+	platformAccessMutex.Lock()
+	defer platformAccessMutex.Unlock()
+
+	if platformAccessCached != nil && time.Since(platformAccessChecked) < platformAccessTTL {
+		return platformAccessCached
+	}
+
+	access := &PlatformAccess{
+		Root:           os.Geteuid() == 0,
+		FullDiskAccess: fullDiskAccessStatus(),
+	}
+	if !access.Root {
+		access.Missing = append(access.Missing, "not running as root: unified log and audit records of other users are not collected")
+	}
+	if access.FullDiskAccess == "denied" {
+		access.Missing = append(access.Missing, "Full Disk Access not granted: TCC-protected logs and files are not readable")
+	}
+	if status := endpointSecurityStatus(); status != "" {
+		access.EndpointSecurity = status
+		if status != "active" {
+			access.Missing = append(access.Missing, "Endpoint Security client not running ("+status+"): process and file activity is only seen through the unified log")
+		}
+	}
+
+	platformAccessCached = access
+	platformAccessChecked = time.Now()
+	return access
+}
+
+// fullDiskAccessStatus probes the TCC database
+func fullDiskAccessStatus() string {
+	f, err := os.Open(tccDatabase)
+	switch {
+	case err == nil:
+		f.Close()
+		return "granted"
+	case errors.Is(err, os.ErrPermission):
+		return "denied"
+	default:
+		return "unknown"
+	}
+}
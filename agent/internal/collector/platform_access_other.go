@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package collector
+
+// CheckPlatformAccess returns nil; only macOS restricts what the agent can
+// read beyond running it as a service
+func CheckPlatformAccess() *PlatformAccess {
+	return nil
+}
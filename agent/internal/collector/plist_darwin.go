@@ -0,0 +1,142 @@
+//go:build darwin
+
+package collector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// readPlist reads a property list file of any format (XML or binary) as
+// a dictionary
+func readPlist(path string) (map[string]interface{}, error) {
+	output, err := exec.Command("plutil", "-convert", "xml1", "-o", "-", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return parsePlistDict(output)
+}
+
+// parsePlistDict parses an XML property list whose root is a dictionary
+func parsePlistDict(data []byte) (map[string]interface{}, error) {
+	value, err := parsePlist(data)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("property list root is not a dictionary")
+	}
+	return dict, nil
+}
+
+// parsePlist parses an XML property list. Dictionaries become
+// map[string]interface{}, arrays []interface{}, integers int64, reals
+// float64, dates their string form and data []byte.
+func parsePlist(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("empty property list")
+			}
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return decodePlistValue(decoder, start)
+		}
+	}
+}
+
+// decodePlistValue decodes the element that starts with start
+func decodePlistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		var key string
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := decodePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+
+	case "array":
+		var array []interface{}
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				value, err := decodePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	default: // string, date
+		return text, nil
+	}
+}
+
+// plistString returns a string value from a dictionary
+func plistString(dict map[string]interface{}, key string) string {
+	s, _ := dict[key].(string)
+	return s
+}
+
+// plistBool returns a boolean value from a dictionary
+func plistBool(dict map[string]interface{}, key string) bool {
+	b, _ := dict[key].(bool)
+	return b
+}
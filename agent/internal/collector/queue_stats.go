@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Events dropped because a queue was full, by channel. Collectors and the
+// agent record every drop here so capacity problems show up in heartbeats
+// and health events instead of only in the local log.
+var dropCounts = struct {
+	sync.Mutex
+	total     uint64
+	byChannel map[string]uint64
+}{byChannel: make(map[string]uint64)}
+
+// RecordDrop counts events dropped from a channel because a queue was full
+func RecordDrop(channel string, count uint64) {
+	if count == 0 {
+		return
+	}
+	if channel == "" {
+		channel = "unknown"
+	}
+
+	dropCounts.Lock()
+	dropCounts.total += count
+	dropCounts.byChannel[channel] += count
+	dropCounts.Unlock()
+}
+
+// DroppedEvents returns the number of events dropped since the agent
+// started, in total and by channel
+func DroppedEvents() (uint64, map[string]uint64) {
+	dropCounts.Lock()
+	defer dropCounts.Unlock()
+
+	byChannel := make(map[string]uint64, len(dropCounts.byChannel))
+	for channel, count := range dropCounts.byChannel {
+		byChannel[channel] = count
+	}
+	return dropCounts.total, byChannel
+}
+
+// QueueStats is the state of the agent's event queue reported in heartbeats
+type QueueStats struct {
+	Depth            int               `json:"depth"`       // events waiting in memory
+	Capacity         int               `json:"capacity"`    // max_queue_size
+	SpoolBytes       int64             `json:"spool_bytes"` // events spilled to disk
+	Dropped          uint64            `json:"dropped"`     // since the agent started
+	DroppedByChannel map[string]uint64 `json:"dropped_by_channel,omitempty"`
+	SendFailures     uint64            `json:"send_failures"` // events the server did not accept
+	Duplicates       uint64            `json:"duplicates"`    // already sent records suppressed
+}
+
+// DropMonitor raises a health event when more events than the threshold
+// were dropped since the last check
+type DropMonitor struct {
+	agentID   string
+	hostname  string
+	threshold uint64
+	total     uint64            // dropped at the last check
+	byChannel map[string]uint64 // dropped per channel at the last check
+}
+
+// NewDropMonitor creates a dropped events monitor
+func NewDropMonitor(agentID, hostname string, threshold int) *DropMonitor {
+	return &DropMonitor{
+		agentID:   agentID,
+		hostname:  hostname,
+		threshold: uint64(threshold),
+		byChannel: make(map[string]uint64),
+	}
+}
+
+// Check compares the drops since the last check with the threshold and
+// returns a warning event naming the channels that lost events
+func (m *DropMonitor) Check() []*Event {
+	total, byChannel := DroppedEvents()
+	dropped := total - m.total
+
+	var channels []string
+	for channel, count := range byChannel {
+		if delta := count - m.byChannel[channel]; delta > 0 {
+			channels = append(channels, fmt.Sprintf("%s=%d", channel, delta))
+		}
+	}
+	sort.Strings(channels)
+
+	m.total, m.byChannel = total, byChannel
+	if dropped == 0 || dropped < m.threshold {
+		return nil
+	}
+
+	log.Printf("Warning: %d events dropped since the last check (%s)", dropped, strings.Join(channels, ", "))
+	return []*Event{newHealthEvent(m.agentID, m.hostname, HealthEventEventsDropped, 3,
+		fmt.Sprintf("%d events dropped because the event queue was full", dropped),
+		map[string]string{
+			"dropped":       strconv.FormatUint(dropped, 10),
+			"dropped_total": strconv.FormatUint(total, 10),
+			"channels":      strings.Join(channels, ", "),
+		})}
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// watermark is the newest event sent from an Event Log channel; channels
+// read from remote hosts have one per host
+type watermark struct {
+	RecordID  int64     `json:"record_id"`
+	EventTime time.Time `json:"event_time"`
+}
+
+// RecordWatermarks suppresses Event Log events that were already sent.
+// Spool replays after a restart and resubscriptions can deliver the same
+// records again; the highest RecordID sent per channel is persisted and
+// events at or below it are dropped before sending. Clearing a log restarts
+// its RecordIDs, so an event only counts as a duplicate if it is also not
+// newer than the watermark.
+type RecordWatermarks struct {
+	statePath string
+	channels  map[string]bool // Event Log channels by watermark key; other sources number records per run
+	enforce   bool            // false: only track, for intentional backfill
+
+	mutex      sync.Mutex
+	marks      map[string]watermark
+	suppressed uint64
+}
+
+// NewRecordWatermarks loads the watermarks of the enabled Event Log channels
+func NewRecordWatermarks(cfg *config.EventLogConfig) *RecordWatermarks {
+	statePath := filepath.Join(os.Getenv("ProgramData"), "SIEM", "watermarks.json")
+	if runtime.GOOS != "windows" {
+		statePath = "/var/lib/siem-agent/watermarks.json"
+	}
+
+	w := &RecordWatermarks{
+		statePath: statePath,
+		channels:  make(map[string]bool),
+		enforce:   !cfg.IgnoreWatermarks,
+		marks:     make(map[string]watermark),
+	}
+	for _, channel := range cfg.GetEnabledChannels() {
+		w.channels[channel.Name] = true
+	}
+	for _, host := range cfg.RemoteHosts {
+		for _, channel := range host.Channels {
+			w.channels[remoteWatermarkKey(host.Host, channel)] = true
+		}
+	}
+
+	if data, err := os.ReadFile(statePath); err == nil {
+		if err := json.Unmarshal(data, &w.marks); err != nil {
+			log.Printf("Warning: Failed to read event watermarks: %v", err)
+			w.marks = make(map[string]watermark)
+		}
+	}
+	if !w.enforce {
+		log.Println("Event watermarks ignored: already sent events will be sent again")
+	}
+
+	return w
+}
+
+// duplicate reports whether an event is at or below its channel's watermark
+func (w *RecordWatermarks) duplicate(event *Event) bool {
+	key := watermarkKey(event)
+	if !w.channels[key] || event.RecordID <= 0 {
+		return false
+	}
+	mark, ok := w.marks[key]
+	return ok && event.RecordID <= mark.RecordID && !event.EventTime.After(mark.EventTime)
+}
+
+// Filter removes and releases already sent events, returning the rest of
+// the batch
+func (w *RecordWatermarks) Filter(batch []*Event) []*Event {
+	if !w.enforce {
+		return batch
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	kept := batch[:0]
+	for _, event := range batch {
+		if w.duplicate(event) {
+			w.suppressed++
+			ReleaseEvent(event)
+			continue
+		}
+		kept = append(kept, event)
+	}
+	for i := len(kept); i < len(batch); i++ {
+		batch[i] = nil
+	}
+	return kept
+}
+
+// Advance records a sent batch and saves the watermarks if they moved
+func (w *RecordWatermarks) Advance(batch []*Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	changed := false
+	for _, event := range batch {
+		key := watermarkKey(event)
+		if !w.channels[key] || event.RecordID <= 0 || w.duplicate(event) {
+			continue
+		}
+		w.marks[key] = watermark{RecordID: event.RecordID, EventTime: event.EventTime}
+		changed = true
+	}
+
+	if changed {
+		if err := w.save(); err != nil {
+			log.Printf("Warning: Failed to save event watermarks: %v", err)
+		}
+	}
+}
+
+// watermarkKey identifies the log an event was read from, as the Event Log
+// bookmarks do: the channel, or host\channel for a remote host, since remote
+// hosts number their records independently of the local log
+func watermarkKey(event *Event) string {
+	if event.RemoteHost != "" {
+		return remoteWatermarkKey(event.RemoteHost, event.Channel)
+	}
+	return event.Channel
+}
+
+// remoteWatermarkKey identifies a channel read from a configured remote host
+func remoteWatermarkKey(host, channel string) string {
+	return host + `\` + channel
+}
+
+// Suppressed returns the number of duplicate events dropped
+func (w *RecordWatermarks) Suppressed() uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.suppressed
+}
+
+// save writes the watermarks
+func (w *RecordWatermarks) save() error {
+	data, err := json.MarshalIndent(w.marks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.statePath), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(w.statePath, data, 0600)
+}
@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var watermarkTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestWatermarks returns watermarks for the local Security channel and
+// the Security channel of dc01, saved in a temporary directory
+func newTestWatermarks(t *testing.T, enforce bool) *RecordWatermarks {
+	t.Helper()
+	return &RecordWatermarks{
+		statePath: filepath.Join(t.TempDir(), "watermarks.json"),
+		channels:  map[string]bool{"Security": true, remoteWatermarkKey("dc01", "Security"): true},
+		enforce:   enforce,
+		marks: map[string]watermark{
+			"Security":                             {RecordID: 100, EventTime: watermarkTime},
+			remoteWatermarkKey("dc01", "Security"): {RecordID: 50, EventTime: watermarkTime},
+		},
+	}
+}
+
+func TestRecordWatermarksFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   Event
+		enforce bool
+		want    bool // kept
+	}{
+		{"at watermark", Event{Channel: "Security", RecordID: 100, EventTime: watermarkTime}, true, false},
+		{"below watermark", Event{Channel: "Security", RecordID: 99, EventTime: watermarkTime.Add(-time.Minute)}, true, false},
+		{"above watermark", Event{Channel: "Security", RecordID: 101, EventTime: watermarkTime}, true, true},
+		{"newer after clearing the log", Event{Channel: "Security", RecordID: 5, EventTime: watermarkTime.Add(time.Hour)}, true, true},
+		{"no record id", Event{Channel: "Security", EventTime: watermarkTime}, true, true},
+		{"channel without watermarks", Event{Channel: "Application", RecordID: 1, EventTime: watermarkTime}, true, true},
+		{"remote below its watermark", Event{Channel: "Security", RemoteHost: "dc01", RecordID: 40, EventTime: watermarkTime}, true, false},
+		{"remote above its watermark", Event{Channel: "Security", RemoteHost: "dc01", RecordID: 60, EventTime: watermarkTime}, true, true},
+		{"remote host not configured", Event{Channel: "Security", RemoteHost: "dc02", RecordID: 10, EventTime: watermarkTime}, true, true},
+		{"not enforced", Event{Channel: "Security", RecordID: 99, EventTime: watermarkTime}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatermarks(t, tt.enforce)
+			event := tt.event
+			kept := w.Filter([]*Event{&event})
+
+			if got := len(kept) == 1; got != tt.want {
+				t.Errorf("kept = %v, want %v", got, tt.want)
+			}
+			wantSuppressed := uint64(1)
+			if tt.want {
+				wantSuppressed = 0
+			}
+			if suppressed := w.Suppressed(); suppressed != wantSuppressed {
+				t.Errorf("Suppressed() = %d, want %d", suppressed, wantSuppressed)
+			}
+		})
+	}
+}
+
+func TestRecordWatermarksAdvance(t *testing.T) {
+	dc01 := remoteWatermarkKey("dc01", "Security")
+
+	tests := []struct {
+		name      string
+		events    []Event
+		want      map[string]watermark
+		wantSaved bool
+	}{
+		{
+			name:   "moves forward",
+			events: []Event{{Channel: "Security", RecordID: 101, EventTime: watermarkTime}, {Channel: "Security", RecordID: 102, EventTime: watermarkTime}},
+			want: map[string]watermark{
+				"Security": {RecordID: 102, EventTime: watermarkTime},
+				dc01:       {RecordID: 50, EventTime: watermarkTime},
+			},
+			wantSaved: true,
+		},
+		{
+			name:   "does not move back",
+			events: []Event{{Channel: "Security", RecordID: 90, EventTime: watermarkTime}},
+			want: map[string]watermark{
+				"Security": {RecordID: 100, EventTime: watermarkTime},
+				dc01:       {RecordID: 50, EventTime: watermarkTime},
+			},
+		},
+		{
+			name:   "restarts after clearing the log",
+			events: []Event{{Channel: "Security", RecordID: 5, EventTime: watermarkTime.Add(time.Hour)}},
+			want: map[string]watermark{
+				"Security": {RecordID: 5, EventTime: watermarkTime.Add(time.Hour)},
+				dc01:       {RecordID: 50, EventTime: watermarkTime},
+			},
+			wantSaved: true,
+		},
+		{
+			name:   "remote host kept apart",
+			events: []Event{{Channel: "Security", RemoteHost: "dc01", RecordID: 70, EventTime: watermarkTime}},
+			want: map[string]watermark{
+				"Security": {RecordID: 100, EventTime: watermarkTime},
+				dc01:       {RecordID: 70, EventTime: watermarkTime},
+			},
+			wantSaved: true,
+		},
+		{
+			name:   "channels without watermarks ignored",
+			events: []Event{{Channel: "Application", RecordID: 500, EventTime: watermarkTime}, {Channel: "Security", RemoteHost: "dc02", RecordID: 500, EventTime: watermarkTime}},
+			want: map[string]watermark{
+				"Security": {RecordID: 100, EventTime: watermarkTime},
+				dc01:       {RecordID: 50, EventTime: watermarkTime},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatermarks(t, true)
+			batch := make([]*Event, len(tt.events))
+			for i := range tt.events {
+				batch[i] = &tt.events[i]
+			}
+			w.Advance(batch)
+
+			if !reflect.DeepEqual(w.marks, tt.want) {
+				t.Errorf("marks = %v, want %v", w.marks, tt.want)
+			}
+
+			data, err := os.ReadFile(w.statePath)
+			if !tt.wantSaved {
+				if err == nil {
+					t.Error("watermarks saved without a change")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("watermarks not saved: %v", err)
+			}
+			var saved map[string]watermark
+			if err := json.Unmarshal(data, &saved); err != nil {
+				t.Fatalf("invalid watermarks file: %v", err)
+			}
+			if !reflect.DeepEqual(saved, tt.want) {
+				t.Errorf("saved = %v, want %v", saved, tt.want)
+			}
+		})
+	}
+}
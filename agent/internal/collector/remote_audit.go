@@ -0,0 +1,119 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Remote session audit events are sent through the normal event pipeline
+// so SOC dashboards can show remote-access activity per host
+const (
+	RemoteSessionSourceType = "Remote Session"
+	RemoteSessionChannel    = "SIEM-Agent/RemoteSession"
+	RemoteSessionProvider   = "SIEM-Agent"
+
+	RemoteEventRequested       = 9001 // Admin requested a session
+	RemoteEventConsented       = 9002 // User (or policy) allowed the session
+	RemoteEventDeclined        = 9003 // User (or policy) declined the session
+	RemoteEventStarted         = 9004 // Session started
+	RemoteEventStartFailed     = 9005 // Session could not be started
+	RemoteEventEnded           = 9006 // Session ended, with duration and transfer count
+	RemoteEventFileTransferred = 9007 // File pushed or pulled within a session
+	RemoteEventControlHandoff  = 9008 // User answered a view-only operator's request for control
+)
+
+// SetEventCallback sets the callback that queues audit events for sending
+func (m *RemoteSessionManager) SetEventCallback(onEvent func(*Event)) {
+	m.onEvent = onEvent
+}
+
+// newAuditEvent builds a remote session audit event
+func (m *RemoteSessionManager) newAuditEvent(code, severity int, sessionGUID, userName, message string, data map[string]string) *Event {
+	if data == nil {
+		data = make(map[string]string)
+	}
+	data["session_guid"] = sessionGUID
+
+	event := &Event{
+		AgentID:     m.agentID,
+		Computer:    m.hostname,
+		SourceType:  RemoteSessionSourceType,
+		EventCode:   code,
+		EventTime:   time.Now(),
+		Channel:     RemoteSessionChannel,
+		Provider:    RemoteSessionProvider,
+		Severity:    severity,
+		Message:     message,
+		EventData:   data,
+		CollectedAt: time.Now(),
+	}
+
+	if userName != "" {
+		event.TargetUser = userName
+		if idx := strings.LastIndex(userName, "\\"); idx != -1 {
+			event.TargetDomain, event.TargetUser = userName[:idx], userName[idx+1:]
+		}
+	}
+
+	return event
+}
+
+// emitAudit queues an audit event for sending
+func (m *RemoteSessionManager) emitAudit(event *Event) {
+	if m.onEvent != nil {
+		m.onEvent(event)
+	}
+}
+
+// auditRequest records a lifecycle step of a session request
+func (m *RemoteSessionManager) auditRequest(code, severity int, request *RemoteSessionRequest, userName, message string) {
+	data := map[string]string{
+		"session_type": request.SessionType,
+		"initiated_by": request.InitiatedBy,
+		"reason":       request.Reason,
+	}
+	if request.ConsentMode != "" {
+		data["consent_mode"] = request.ConsentMode
+	}
+	m.emitAudit(m.newAuditEvent(code, severity, request.SessionGUID, userName, message, data))
+}
+
+// auditEnded records the end of a session with its duration
+func (m *RemoteSessionManager) auditEnded(session *ActiveSession, reason string) {
+	duration := time.Since(session.StartedAt)
+	m.emitAudit(m.newAuditEvent(RemoteEventEnded, 2, session.SessionGUID, session.UserName,
+		fmt.Sprintf("Remote %s session ended after %v: %s", session.SessionType, duration.Round(time.Second), reason),
+		map[string]string{
+			"session_type":      session.SessionType,
+			"end_reason":        reason,
+			"duration_seconds":  strconv.Itoa(int(duration.Seconds())),
+			"files_transferred": strconv.Itoa(len(session.Transfers)),
+		}))
+}
+
+// auditTransfer records a file transfer within a session
+func (m *RemoteSessionManager) auditTransfer(session *ActiveSession, record *FileTransferRecord) {
+	severity := 2
+	if record.Status != "completed" {
+		severity = 3
+	}
+
+	event := m.newAuditEvent(RemoteEventFileTransferred, severity, session.SessionGUID, session.UserName,
+		fmt.Sprintf("Remote session file %s %s: %s", record.Direction, record.Status, record.Path),
+		map[string]string{
+			"session_type": session.SessionType,
+			"transfer_id":  record.TransferID,
+			"direction":    record.Direction,
+			"file_size":    strconv.FormatInt(record.Size, 10),
+			"status":       record.Status,
+			"error":        record.Error,
+		})
+	event.FilePath = record.Path
+	event.FileHash = record.SHA256
+	event.ObjectType = "File"
+	m.emitAudit(event)
+}
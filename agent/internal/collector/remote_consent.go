@@ -0,0 +1,395 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consent modes, chosen per host class in the agent configuration or by
+// server policy in the session request
+const (
+	ConsentRequire    = "require_consent" // the user must allow the session (workstations)
+	ConsentNotify     = "notify"          // the user is told the session is starting
+	ConsentAutoAccept = "auto_accept"     // no user interaction (servers, headless machines)
+)
+
+// consentStartupGrace covers the time the dialog needs to appear, so the
+// user gets the full countdown
+const consentStartupGrace = 5 * time.Second
+
+// consentDialog is a consent prompt shown in one user session
+type consentDialog struct {
+	sessionID uint32
+	user      string
+	dir       string
+}
+
+// consentPrompt is a question put to the logged-on users with a countdown
+type consentPrompt struct {
+	key             string // unique name of the prompt's exchange directory
+	targetUser      string // preferred user; every active session if not logged on
+	title           string
+	message         string
+	timeout         time.Duration
+	acceptOnTimeout bool
+	adminsOnly      bool // only local administrators may answer
+}
+
+// consentMode returns the consent mode for a request: the server policy if
+// it names a known mode, the agent configuration otherwise
+func (m *RemoteSessionManager) consentMode(request *RemoteSessionRequest) string {
+	switch request.ConsentMode {
+	case ConsentRequire, ConsentNotify, ConsentAutoAccept:
+		return request.ConsentMode
+	case "":
+	default:
+		log.Printf("Remote session %s: unknown consent mode %q from server, using %q",
+			request.SessionGUID, request.ConsentMode, m.config.ConsentMode)
+	}
+	return m.config.ConsentMode
+}
+
+// obtainConsent applies the request's consent mode and returns whether the
+// session may start, who answered and a description of the decision
+func (m *RemoteSessionManager) obtainConsent(request *RemoteSessionRequest) (bool, string, string) {
+	switch request.ConsentMode {
+	case ConsentAutoAccept:
+		return true, "", "auto-accepted by policy"
+
+	case ConsentNotify:
+		if len(ActiveUserSessions()) == 0 {
+			return m.noUserDecision(request)
+		}
+
+		message := fmt.Sprintf("Администратор %s подключается к вашему компьютеру. Причина: %s",
+			request.InitiatedBy, request.Reason)
+		if err := ShowToast(request.TargetUser, "Удаленное подключение", message); err != nil {
+			log.Printf("Error notifying user about remote session %s: %v", request.SessionGUID, err)
+		}
+		return true, "", "user notified, accepted by policy"
+	}
+
+	return m.askConsent(request)
+}
+
+// noUserDecision applies the configured action when nobody is logged on to
+// answer or be notified
+func (m *RemoteSessionManager) noUserDecision(request *RemoteSessionRequest) (bool, string, string) {
+	log.Printf("No user available for remote session %s, applying no-user action %q",
+		request.SessionGUID, m.config.NoUserAction)
+	if m.config.NoUserAction == "accept" {
+		return true, "", "no user logged on, accepted by policy"
+	}
+	return false, "", "Нет пользователя, который мог бы подтвердить подключение"
+}
+
+// askConsent shows the connection request to the logged-on users with a
+// countdown and returns whether the session may start, who answered ("" if
+// the timeout action applied) and a description of the decision. The request goes to
+// the target user's session, or to every active session if the target is
+// not logged on; the first answer wins. When nobody answers in time the
+// configured timeout action applies, and when nobody is logged on the
+// no-user action.
+func (m *RemoteSessionManager) askConsent(request *RemoteSessionRequest) (bool, string, string) {
+	message := fmt.Sprintf(
+		"Администратор %s запрашивает удаленный доступ к вашему компьютеру.\n\n"+
+			"Причина: %s\n\n",
+		request.InitiatedBy,
+		request.Reason,
+	)
+	if request.SessionType == "screen_share" && request.ViewOnly {
+		message += "Администратор сможет только просматривать экран.\n\n"
+	}
+	message += "Разрешить подключение?"
+
+	prompt := consentPrompt{
+		key:             request.SessionGUID,
+		targetUser:      request.TargetUser,
+		title:           "Запрос на удаленное подключение",
+		message:         message,
+		timeout:         time.Duration(m.config.ConsentTimeout) * time.Second,
+		acceptOnTimeout: m.config.ConsentTimeoutAction == "accept",
+	}
+
+	answer, user, shown := promptUsers(m.ctx, prompt)
+	switch {
+	case !shown:
+		return m.noUserDecision(request)
+
+	case answer != "":
+		log.Printf("Remote session %s: user %s answered %s", request.SessionGUID, user, answer)
+		if answer == "accept" {
+			return true, user, "accepted by user"
+		}
+		return false, user, fmt.Sprintf("Пользователь %s отклонил запрос на подключение", user)
+
+	case m.ctx.Err() != nil:
+		return false, "", "Агент остановлен"
+	}
+
+	log.Printf("Remote session %s: no answer within %v, applying timeout action %q",
+		request.SessionGUID, prompt.timeout, m.config.ConsentTimeoutAction)
+	if prompt.acceptOnTimeout {
+		return true, "", "no answer, accepted by policy"
+	}
+	return false, "", "Пользователь не ответил на запрос на подключение"
+}
+
+// handleControlRequest asks the user to confirm a second time before a
+// view-only operator gets input control. Unlike the connection request,
+// an unanswered control request is always declined.
+func (m *RemoteSessionManager) handleControlRequest(session *ActiveSession) {
+	log.Printf("Remote session %s: operator %s requests input control", session.SessionGUID, session.InitiatedBy)
+
+	prompt := consentPrompt{
+		key:        session.SessionGUID + "-control",
+		targetUser: session.UserName,
+		title:      "Запрос на управление компьютером",
+		message: fmt.Sprintf(
+			"Администратор %s, который просматривает ваш экран, запрашивает управление мышью и клавиатурой.\n\n"+
+				"Разрешить управление?",
+			session.InitiatedBy,
+		),
+		timeout: time.Duration(m.config.ConsentTimeout) * time.Second,
+	}
+
+	answer, user, _ := promptUsers(m.ctx, prompt)
+	granted := answer == "accept"
+
+	m.mutex.RLock()
+	current := m.activeSession == session
+	m.mutex.RUnlock()
+	if !current {
+		return
+	}
+
+	var message string
+	switch {
+	case granted:
+		message = fmt.Sprintf("Пользователь %s разрешил управление", user)
+	case answer == "decline":
+		message = fmt.Sprintf("Пользователь %s отклонил запрос на управление", user)
+	default:
+		message = "Пользователь не ответил на запрос на управление"
+	}
+	log.Printf("Remote session %s: input control granted %v (%s)", session.SessionGUID, granted, user)
+
+	session.Stream.SetViewOnly(!granted)
+
+	severity := 2
+	if granted {
+		severity = 3
+	}
+	m.emitAudit(m.newAuditEvent(RemoteEventControlHandoff, severity, session.SessionGUID, user,
+		fmt.Sprintf("Input control for operator %s: granted %v", session.InitiatedBy, granted),
+		map[string]string{
+			"session_type": session.SessionType,
+			"initiated_by": session.InitiatedBy,
+			"granted":      strconv.FormatBool(granted),
+		}))
+
+	if m.onControlResult != nil {
+		if err := m.onControlResult(session.SessionGUID, granted, message); err != nil {
+			log.Printf("Error reporting control request answer to SIEM: %v", err)
+		}
+	}
+}
+
+// promptUsers shows the prompt and waits for the first answer. It returns
+// "accept" or "decline" and who answered, or an empty answer on timeout or
+// when ctx is cancelled; shown is false if no dialog could be displayed.
+func promptUsers(ctx context.Context, prompt consentPrompt) (answer, user string, shown bool) {
+	sessions := ActiveUserSessions()
+	if prompt.adminsOnly {
+		var admins []uint32
+		for _, id := range sessions {
+			if sessionIsAdmin(id) {
+				admins = append(admins, id)
+			}
+		}
+		sessions = admins
+	}
+	if prompt.targetUser != "" {
+		var target []uint32
+		for _, id := range sessions {
+			if sessionUserMatches(id, prompt.targetUser) {
+				target = append(target, id)
+			}
+		}
+		if len(target) > 0 {
+			sessions = target
+		}
+	}
+
+	var dialogs []*consentDialog
+	for _, id := range sessions {
+		dialog, err := showConsentDialog(prompt, id)
+		if err != nil {
+			log.Printf("Error showing consent dialog in session %d: %v", id, err)
+			continue
+		}
+		dialogs = append(dialogs, dialog)
+	}
+
+	if len(dialogs) == 0 {
+		return "", "", false
+	}
+
+	defer func() {
+		for _, dialog := range dialogs {
+			dialog.close()
+		}
+	}()
+
+	deadline := time.Now().Add(prompt.timeout + consentStartupGrace)
+	for time.Now().Before(deadline) {
+		for _, dialog := range dialogs {
+			if answer, ok := dialog.answer(); ok {
+				return answer, dialog.user, true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", "", true
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	return "", "", true
+}
+
+// showConsentDialog opens the countdown dialog in a user session
+func showConsentDialog(prompt consentPrompt, sessionID uint32) (*consentDialog, error) {
+	user := sessionAccount(sessionID)
+	if user == "" {
+		return nil, fmt.Errorf("no user logged on")
+	}
+
+	dialog := &consentDialog{
+		sessionID: sessionID,
+		user:      user,
+		dir:       filepath.Join(os.Getenv("ProgramData"), "SIEM", "consent", fmt.Sprintf("%s-%d", prompt.key, sessionID)),
+	}
+	if err := createPromptDir(dialog.dir, user); err != nil {
+		return nil, err
+	}
+
+	countdown := "Запрос будет автоматически отклонен через {0} с"
+	if prompt.acceptOnTimeout {
+		countdown = "Подключение будет автоматически разрешено через {0} с"
+	}
+
+	psScript := fmt.Sprintf(`
+Add-Type -AssemblyName System.Windows.Forms
+Add-Type -AssemblyName System.Drawing
+$answerPath = %s
+$closePath = %s
+$countdownText = %s
+$script:remaining = %d
+
+$form = New-Object System.Windows.Forms.Form
+$form.Text = %s
+$form.Size = New-Object System.Drawing.Size(470, 260)
+$form.StartPosition = "CenterScreen"
+$form.FormBorderStyle = "FixedDialog"
+$form.MaximizeBox = $false
+$form.MinimizeBox = $false
+$form.ControlBox = $false
+$form.TopMost = $true
+
+$message = New-Object System.Windows.Forms.Label
+$message.Location = New-Object System.Drawing.Point(12, 12)
+$message.Size = New-Object System.Drawing.Size(430, 110)
+$message.Text = %s
+$form.Controls.Add($message)
+
+$countdown = New-Object System.Windows.Forms.Label
+$countdown.Location = New-Object System.Drawing.Point(12, 130)
+$countdown.Size = New-Object System.Drawing.Size(430, 20)
+$countdown.Text = [string]::Format($countdownText, $script:remaining)
+$form.Controls.Add($countdown)
+
+$answer = {
+    param($value)
+    [System.IO.File]::WriteAllText($answerPath, $value)
+    $form.Close()
+}
+
+$accept = New-Object System.Windows.Forms.Button
+$accept.Location = New-Object System.Drawing.Point(12, 170)
+$accept.Size = New-Object System.Drawing.Size(200, 28)
+$accept.Text = "Разрешить"
+$accept.Add_Click({ & $answer "accept" })
+$form.Controls.Add($accept)
+
+$decline = New-Object System.Windows.Forms.Button
+$decline.Location = New-Object System.Drawing.Point(242, 170)
+$decline.Size = New-Object System.Drawing.Size(200, 28)
+$decline.Text = "Отклонить"
+$decline.Add_Click({ & $answer "decline" })
+$form.Controls.Add($decline)
+$form.CancelButton = $decline
+
+$timer = New-Object System.Windows.Forms.Timer
+$timer.Interval = 1000
+$timer.Add_Tick({
+    # Answered in another session or request withdrawn
+    if (Test-Path $closePath) { $form.Close(); return }
+    $script:remaining--
+    if ($script:remaining -le 0) { $form.Close(); return }
+    $countdown.Text = [string]::Format($countdownText, $script:remaining)
+})
+$timer.Start()
+
+[void]$form.ShowDialog()
+`, psQuote(dialog.answerPath()), psQuote(dialog.closePath()), psQuote(countdown), int(prompt.timeout.Seconds()),
+		psQuote(prompt.title), psQuote(prompt.message))
+
+	if _, err := RunInSession(sessionID, psScript, 0); err != nil {
+		os.RemoveAll(dialog.dir)
+		return nil, err
+	}
+
+	return dialog, nil
+}
+
+// answer returns "accept" or "decline" once the user has clicked a button
+func (d *consentDialog) answer() (string, bool) {
+	data, err := os.ReadFile(d.answerPath())
+	if err != nil {
+		return "", false
+	}
+
+	switch answer := strings.TrimSpace(string(data)); answer {
+	case "accept", "decline":
+		return answer, true
+	}
+	return "", false
+}
+
+// close dismisses the dialog if it is still open and removes its files shortly after
+func (d *consentDialog) close() {
+	os.WriteFile(d.closePath(), nil, 0600)
+
+	dir := d.dir
+	time.AfterFunc(promptCleanupDelay, func() {
+		os.RemoveAll(dir)
+	})
+}
+
+func (d *consentDialog) answerPath() string {
+	return filepath.Join(d.dir, "answer.txt")
+}
+
+func (d *consentDialog) closePath() string {
+	return filepath.Join(d.dir, "close")
+}
@@ -0,0 +1,137 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// sessionLimitCheckInterval is how often the active session is checked
+// against the duration and idle limits
+const sessionLimitCheckInterval = 30 * time.Second
+
+// SetSessionEndCallback sets the callback reporting sessions the agent ended itself
+func (m *RemoteSessionManager) SetSessionEndCallback(onEnd func(sessionGUID, reason string) error) {
+	m.onSessionEnded = onEnd
+}
+
+// enforceLimits terminates the active session once it exceeds the maximum
+// duration or has been idle for too long
+func (m *RemoteSessionManager) enforceLimits() {
+	maxDuration := time.Duration(m.config.MaxSessionDuration) * time.Minute
+	idleTimeout := time.Duration(m.config.IdleTimeout) * time.Minute
+
+	m.mutex.Lock()
+	session := m.activeSession
+	if session == nil {
+		m.mutex.Unlock()
+		return
+	}
+
+	// Operator input on the screen stream or terminal, traffic through the
+	// relay tunnel, or a running shadowing helper, counts as activity
+	if session.Stream != nil {
+		if last := session.Stream.LastInput(); last.After(session.LastActivity) {
+			session.LastActivity = last
+		}
+	}
+	if session.Terminal != nil {
+		if last := session.Terminal.LastInput(); last.After(session.LastActivity) {
+			session.LastActivity = last
+		}
+	}
+	if session.Tunnel != nil {
+		if last := session.Tunnel.LastActivity(); last.After(session.LastActivity) {
+			session.LastActivity = last
+		}
+	}
+	if session.Shadow != nil && len(processesByName("RdpSa.exe")) > 0 {
+		session.LastActivity = time.Now()
+	}
+
+	var reason, userMessage string
+	switch {
+	case session.Terminal != nil && terminalExited(session.Terminal):
+		reason = "terminal shell exited"
+		userMessage = "Удаленный сеанс терминала завершен."
+	case session.Stream != nil && screenHelperExited(session.Stream):
+		reason = "screen helper exited"
+		userMessage = "Трансляция экрана завершена."
+	case time.Since(session.StartedAt) >= maxDuration:
+		reason = fmt.Sprintf("maximum session duration of %v exceeded", maxDuration)
+		userMessage = "Удаленный сеанс завершен: превышена максимальная продолжительность сеанса."
+	case time.Since(session.LastActivity) >= idleTimeout:
+		reason = fmt.Sprintf("no activity for %v", idleTimeout)
+		userMessage = "Удаленный сеанс завершен из-за отсутствия активности."
+	}
+	m.mutex.Unlock()
+
+	if reason != "" {
+		m.terminateSession(session, reason, userMessage)
+	}
+}
+
+// terminateSession ends a session on the agent's initiative and notifies
+// both the user and SIEM
+func (m *RemoteSessionManager) terminateSession(session *ActiveSession, reason, userMessage string) {
+	log.Printf("Terminating remote session %s: %s", session.SessionGUID, reason)
+
+	m.mutex.RLock()
+	current := m.activeSession == session
+	m.mutex.RUnlock()
+	if !current {
+		return
+	}
+	m.endActiveSession(reason)
+
+	if err := ShowToast(session.UserName, "Удаленный сеанс завершен", userMessage); err != nil {
+		log.Printf("Error notifying user about session end: %v", err)
+	}
+
+	if m.onSessionEnded != nil {
+		if err := m.onSessionEnded(session.SessionGUID, reason); err != nil {
+			log.Printf("Error reporting session end to SIEM: %v", err)
+		}
+	}
+}
+
+// terminalExited reports whether the terminal's shell has exited
+func terminalExited(terminal *TerminalSession) bool {
+	select {
+	case <-terminal.Exited():
+		return true
+	default:
+		return false
+	}
+}
+
+// screenHelperExited reports whether the capture helper of a screen stream has exited
+func screenHelperExited(stream *ScreenStream) bool {
+	select {
+	case <-stream.Exited():
+		return true
+	default:
+		return false
+	}
+}
+
+// processesByName returns the PIDs of running processes with the given executable name
+func processesByName(name string) []uint32 {
+	entries, err := snapshotProcesses()
+	if err != nil {
+		return nil
+	}
+
+	var pids []uint32
+	for _, entry := range entries {
+		if strings.EqualFold(windows.UTF16ToString(entry.ExeFile[:]), name) {
+			pids = append(pids, entry.ProcessID)
+		}
+	}
+	return pids
+}
@@ -0,0 +1,290 @@
+//go:build windows
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// relayDialTimeout bounds connecting to the relay and to the local service
+	relayDialTimeout = 15 * time.Second
+
+	// relayReconnectDelay is the pause before the control connection is re-established
+	relayReconnectDelay = 5 * time.Second
+)
+
+// relayHello is the first line the agent writes on every relay connection.
+// The control connection has an empty ChannelID; data connections carry the
+// channel the relay asked for. A screen sharing session has a single
+// "screen" connection carrying screen messages.
+type relayHello struct {
+	Role        string `json:"role"` // "agent", "data" or "screen"
+	SessionGUID string `json:"session_guid"`
+	Token       string `json:"token"`
+	AgentID     string `json:"agent_id"`
+	ChannelID   string `json:"channel_id,omitempty"`
+}
+
+// relayCommand is a line the relay sends on the control connection
+type relayCommand struct {
+	Type      string `json:"type"` // "connect" or "close"
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+// RelayTunnel carries an operator's connection to a local service through
+// the SIEM relay for endpoints the operator cannot reach directly (VPN or
+// NAT clients). The agent keeps an outbound TLS control connection to the
+// relay; for every operator connection the relay asks for a data channel,
+// which the agent opens as a second outbound connection and splices to the
+// local service.
+type RelayTunnel struct {
+	sessionGUID string
+	agentID     string
+	relayAddr   string
+	token       string
+	target      string
+	tlsConfig   *tls.Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex        sync.Mutex
+	control      net.Conn
+	channels     map[net.Conn]struct{}
+	lastActivity time.Time
+}
+
+// StartRelayTunnel connects to the relay and starts forwarding its data
+// channels to target (host:port of the local service). The first control
+// connection must succeed; later disconnects are retried until Stop.
+func StartRelayTunnel(sessionGUID, agentID, relayAddr, token, target string, insecureSkipVerify bool) (*RelayTunnel, error) {
+	tlsConfig, err := relayTLSConfig(relayAddr, insecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tunnel := &RelayTunnel{
+		sessionGUID:  sessionGUID,
+		agentID:      agentID,
+		relayAddr:    relayAddr,
+		token:        token,
+		target:       target,
+		tlsConfig:    tlsConfig,
+		ctx:          ctx,
+		cancel:       cancel,
+		channels:     make(map[net.Conn]struct{}),
+		lastActivity: time.Now(),
+	}
+
+	control, err := tunnel.dial(relayHello{Role: "agent"})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to connect to relay %s: %w", relayAddr, err)
+	}
+
+	tunnel.wg.Add(1)
+	go tunnel.run(control)
+
+	log.Printf("✓ Relay tunnel for session %s connected to %s (target %s)", sessionGUID, relayAddr, target)
+	return tunnel, nil
+}
+
+// Stop closes the control connection and every open data channel
+func (t *RelayTunnel) Stop() {
+	t.cancel()
+
+	t.mutex.Lock()
+	if t.control != nil {
+		t.control.Close()
+	}
+	for conn := range t.channels {
+		conn.Close()
+	}
+	t.mutex.Unlock()
+
+	t.wg.Wait()
+	log.Printf("Relay tunnel for session %s closed", t.sessionGUID)
+}
+
+// LastActivity returns when data last passed through the tunnel
+func (t *RelayTunnel) LastActivity() time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.lastActivity
+}
+
+// dial opens a connection to the relay for this tunnel
+func (t *RelayTunnel) dial(hello relayHello) (net.Conn, error) {
+	hello.SessionGUID = t.sessionGUID
+	hello.Token = t.token
+	hello.AgentID = t.agentID
+	return dialRelay(t.ctx, t.relayAddr, t.tlsConfig, hello)
+}
+
+// run serves the control connection and re-establishes it when it drops
+func (t *RelayTunnel) run(control net.Conn) {
+	defer t.wg.Done()
+
+	for {
+		t.mutex.Lock()
+		t.control = control
+		t.mutex.Unlock()
+
+		closed := t.serveControl(control)
+		control.Close()
+		if closed {
+			t.cancel()
+			return
+		}
+
+		for {
+			select {
+			case <-t.ctx.Done():
+				return
+			case <-time.After(relayReconnectDelay):
+			}
+
+			var err error
+			control, err = t.dial(relayHello{Role: "agent"})
+			if err == nil {
+				break
+			}
+			log.Printf("Error reconnecting relay tunnel for session %s: %v", t.sessionGUID, err)
+		}
+	}
+}
+
+// serveControl reads relay commands until the connection ends. It reports
+// whether the relay closed the tunnel for good.
+func (t *RelayTunnel) serveControl(control net.Conn) bool {
+	scanner := bufio.NewScanner(control)
+	for scanner.Scan() {
+		var command relayCommand
+		if err := json.Unmarshal(scanner.Bytes(), &command); err != nil {
+			log.Printf("Invalid relay command for session %s: %v", t.sessionGUID, err)
+			continue
+		}
+
+		switch command.Type {
+		case "connect":
+			t.wg.Add(1)
+			go t.openChannel(command.ChannelID)
+		case "close":
+			return true
+		}
+	}
+	return false
+}
+
+// openChannel connects a relay data channel to the local service
+func (t *RelayTunnel) openChannel(channelID string) {
+	defer t.wg.Done()
+
+	local, err := net.DialTimeout("tcp", t.target, relayDialTimeout)
+	if err != nil {
+		log.Printf("Relay tunnel for session %s: cannot reach %s: %v", t.sessionGUID, t.target, err)
+		return
+	}
+	remote, err := t.dial(relayHello{Role: "data", ChannelID: channelID})
+	if err != nil {
+		local.Close()
+		log.Printf("Relay tunnel for session %s: cannot open channel %s: %v", t.sessionGUID, channelID, err)
+		return
+	}
+
+	t.mutex.Lock()
+	if t.ctx.Err() != nil {
+		t.mutex.Unlock()
+		local.Close()
+		remote.Close()
+		return
+	}
+	t.channels[local] = struct{}{}
+	t.channels[remote] = struct{}{}
+	t.mutex.Unlock()
+
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() {
+		defer copies.Done()
+		t.copy(remote, local)
+		remote.Close()
+	}()
+	go func() {
+		defer copies.Done()
+		t.copy(local, remote)
+		local.Close()
+	}()
+	copies.Wait()
+
+	t.mutex.Lock()
+	delete(t.channels, local)
+	delete(t.channels, remote)
+	t.mutex.Unlock()
+}
+
+// copy moves data from src to dst, recording activity for the idle timeout
+func (t *RelayTunnel) copy(dst io.Writer, src io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.mutex.Lock()
+			t.lastActivity = time.Now()
+			t.mutex.Unlock()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// relayTLSConfig returns the TLS settings for connections to a relay
+func relayTLSConfig(relayAddr string, insecureSkipVerify bool) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(relayAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay address %q: %w", relayAddr, err)
+	}
+	return &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecureSkipVerify,
+	}, nil
+}
+
+// dialRelay opens a TLS connection to the relay and introduces it
+func dialRelay(ctx context.Context, relayAddr string, tlsConfig *tls.Config, hello relayHello) (net.Conn, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: relayDialTimeout, KeepAlive: 30 * time.Second},
+		Config:    tlsConfig,
+	}
+	ctx, cancel := context.WithTimeout(ctx, relayDialTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", relayAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(hello)
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
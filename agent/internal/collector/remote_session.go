@@ -7,38 +7,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
-	"unsafe"
-)
-
-// RemoteSessionRequest represents a pending remote session from SIEM
-type RemoteSessionRequest struct {
-	HasPending  bool   `json:"has_pending"`
-	SessionGUID string `json:"session_guid"`
-	SessionType string `json:"session_type"`
-	InitiatedBy string `json:"initiated_by"`
-	Reason      string `json:"reason"`
-	RequestedAt string `json:"requested_at"`
-}
 
-// RemoteSessionResponse represents the user's response to a session request
-type RemoteSessionResponse struct {
-	Action           string `json:"action"`
-	ConnectionString string `json:"connection_string,omitempty"`
-	ConnectionPassword string `json:"connection_password,omitempty"`
-	Port             int    `json:"port,omitempty"`
-	Message          string `json:"message,omitempty"`
-}
+	"github.com/siem/agent/internal/config"
+)
 
 // RemoteSessionManager handles remote desktop sessions
 type RemoteSessionManager struct {
+	config      *config.RemoteSessionConfig
 	agentID     string
 	hostname    string
 	ctx         context.Context
@@ -51,49 +31,54 @@ type RemoteSessionManager struct {
 	// Callbacks
 	onCheckPending  func() (*RemoteSessionRequest, error)
 	onSendResponse  func(sessionGUID string, response *RemoteSessionResponse) error
+	onSessionEnded  func(sessionGUID, reason string) error
+	onEvent         func(*Event)
+
+	// Reports the user's answer to a screen sharing control request
+	onControlResult func(sessionGUID string, granted bool, message string) error
+
+	// Relay callbacks for terminal sessions
+	onSendTerminalOutput func(*TerminalOutput) error
+	onFetchTerminalInput func(sessionGUID string) ([]string, error)
+
+	// Relay callbacks for file transfers
+	onFetchTransfers func(sessionGUID string) ([]FileTransferRequest, error)
+	onDownloadFile   func(sessionGUID, transferID string) ([]byte, error)
+	onUploadFile     func(sessionGUID, transferID string, data []byte) error
+	onTransferResult func(*FileTransferRecord) error
 
 	// Configuration
 	pollInterval time.Duration
-	autoAccept   bool // For trusted environments
 }
 
 // ActiveSession represents an active remote session
 type ActiveSession struct {
-	SessionGUID    string
-	SessionType    string
-	StartedAt      time.Time
-	Process        *os.Process
-	InvitationFile string
-	Password       string
-	Port           int
+	SessionGUID  string
+	SessionType  string
+	InitiatedBy  string
+	UserName     string
+	StartedAt    time.Time
+	LastActivity time.Time
+	Process      *os.Process
+	Port         int
+	Stream       *ScreenStream
+	Terminal     *TerminalSession
+	Shadow       *shadowSetup
+	Tunnel       *RelayTunnel
+	Transfers    []FileTransferRecord
 }
 
-// Windows API for showing message boxes
-var (
-	user32          = syscall.NewLazyDLL("user32.dll")
-	messageBoxW     = user32.NewProc("MessageBoxW")
-)
-
-const (
-	MB_YESNO        = 0x00000004
-	MB_ICONQUESTION = 0x00000020
-	MB_TOPMOST      = 0x00040000
-	MB_SETFOREGROUND = 0x00010000
-	IDYES           = 6
-	IDNO            = 7
-)
-
 // NewRemoteSessionManager creates a new remote session manager
-func NewRemoteSessionManager(agentID, hostname string) *RemoteSessionManager {
+func NewRemoteSessionManager(cfg *config.RemoteSessionConfig, agentID, hostname string) *RemoteSessionManager {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &RemoteSessionManager{
+		config:       cfg,
 		agentID:      agentID,
 		hostname:     hostname,
 		ctx:          ctx,
 		cancel:       cancel,
 		pollInterval: 10 * time.Second,
-		autoAccept:   false,
 	}
 }
 
@@ -106,19 +91,44 @@ func (m *RemoteSessionManager) SetCallbacks(
 	m.onSendResponse = onSendResponse
 }
 
+// SetControlCallback sets the callback reporting the user's answer when a
+// view-only operator asks for input control
+func (m *RemoteSessionManager) SetControlCallback(onResult func(sessionGUID string, granted bool, message string) error) {
+	m.onControlResult = onResult
+}
+
+// SetTerminalCallbacks sets the SIEM relay callbacks used by terminal sessions
+func (m *RemoteSessionManager) SetTerminalCallbacks(
+	onSendOutput func(*TerminalOutput) error,
+	onFetchInput func(string) ([]string, error),
+) {
+	m.onSendTerminalOutput = onSendOutput
+	m.onFetchTerminalInput = onFetchInput
+}
+
 // Start begins polling for remote session requests
 func (m *RemoteSessionManager) Start() {
 	log.Println("Starting Remote Session Manager...")
 
+	// Settings from a shadow session interrupted by an agent restart
+	revertLeftoverShadow()
+
+	go m.runTransfers()
+
 	ticker := time.NewTicker(m.pollInterval)
 	defer ticker.Stop()
 
+	limitTicker := time.NewTicker(sessionLimitCheckInterval)
+	defer limitTicker.Stop()
+
 	for {
 		select {
 		case <-m.ctx.Done():
 			return
 		case <-ticker.C:
 			m.checkForPendingSession()
+		case <-limitTicker.C:
+			m.enforceLimits()
 		}
 	}
 }
@@ -126,7 +136,7 @@ func (m *RemoteSessionManager) Start() {
 // Stop stops the manager and any active session
 func (m *RemoteSessionManager) Stop() {
 	m.cancel()
-	m.EndActiveSession()
+	m.endActiveSession("agent stopped")
 }
 
 // checkForPendingSession checks SIEM for pending session requests
@@ -156,6 +166,8 @@ func (m *RemoteSessionManager) checkForPendingSession() {
 	}
 
 	log.Printf("Remote session request from %s: %s", request.InitiatedBy, request.Reason)
+	m.auditRequest(RemoteEventRequested, 2, request, request.TargetUser,
+		fmt.Sprintf("Remote %s session requested by %s", request.SessionType, request.InitiatedBy))
 
 	// Handle the request
 	m.handleSessionRequest(request)
@@ -165,18 +177,27 @@ func (m *RemoteSessionManager) checkForPendingSession() {
 func (m *RemoteSessionManager) handleSessionRequest(request *RemoteSessionRequest) {
 	var response *RemoteSessionResponse
 
-	// Show consent dialog to user
-	if m.autoAccept {
+	// Ask the logged-on user for consent, or just notify them, as the
+	// consent mode for this host requires. The applied mode is recorded
+	// in the audit events.
+	request.ConsentMode = m.consentMode(request)
+	accepted, answeredBy, message := m.obtainConsent(request)
+
+	if accepted {
+		m.auditRequest(RemoteEventConsented, 2, request, answeredBy, "Remote session allowed: "+message)
 		response = m.acceptSession(request)
-	} else {
-		accepted := m.showConsentDialog(request)
-		if accepted {
-			response = m.acceptSession(request)
+
+		if response.Action == "accept" {
+			m.auditRequest(RemoteEventStarted, 3, request, answeredBy,
+				fmt.Sprintf("Remote %s session started on %s", request.SessionType, m.hostname))
 		} else {
-			response = &RemoteSessionResponse{
-				Action:  "decline",
-				Message: "Пользователь отклонил запрос на подключение",
-			}
+			m.auditRequest(RemoteEventStartFailed, 3, request, answeredBy, "Remote session failed to start: "+response.Message)
+		}
+	} else {
+		m.auditRequest(RemoteEventDeclined, 2, request, answeredBy, "Remote session declined: "+message)
+		response = &RemoteSessionResponse{
+			Action:  "decline",
+			Message: message,
 		}
 	}
 
@@ -188,155 +209,156 @@ func (m *RemoteSessionManager) handleSessionRequest(request *RemoteSessionReques
 	}
 }
 
-// showConsentDialog shows a Windows message box asking user for consent
-func (m *RemoteSessionManager) showConsentDialog(request *RemoteSessionRequest) bool {
-	title := "Запрос на удаленное подключение"
-	message := fmt.Sprintf(
-		"Администратор %s запрашивает удаленный доступ к вашему компьютеру.\n\n"+
-		"Причина: %s\n\n"+
-		"Разрешить подключение?",
-		request.InitiatedBy,
-		request.Reason,
-	)
-
-	titlePtr, _ := syscall.UTF16PtrFromString(title)
-	messagePtr, _ := syscall.UTF16PtrFromString(message)
-
-	ret, _, _ := messageBoxW.Call(
-		0,
-		uintptr(unsafe.Pointer(messagePtr)),
-		uintptr(unsafe.Pointer(titlePtr)),
-		MB_YESNO|MB_ICONQUESTION|MB_TOPMOST|MB_SETFOREGROUND,
-	)
-
-	return ret == IDYES
-}
-
-// acceptSession starts the remote assistance and returns connection info
+// acceptSession starts the requested session and returns connection info
 func (m *RemoteSessionManager) acceptSession(request *RemoteSessionRequest) *RemoteSessionResponse {
 	response := &RemoteSessionResponse{
 		Action: "accept",
 	}
 
 	switch request.SessionType {
-	case "remote_assistance":
-		// Use Windows Remote Assistance (msra.exe)
-		invFile, password, err := m.startRemoteAssistance()
+	case "screen_share":
+		// Built-in screen streaming: DXGI capture in the user session,
+		// streamed over a persistent connection to the SIEM relay
+		stream, err := StartScreenStream(request.SessionGUID, m.agentID, request.RelayAddress, request.RelayToken,
+			request.TargetUser, request.Monitor, request.ViewOnly, m.config.RelayInsecureSkipVerify)
 		if err != nil {
-			log.Printf("Error starting Remote Assistance: %v", err)
+			log.Printf("Error starting screen streaming: %v", err)
 			response.Action = "decline"
-			response.Message = fmt.Sprintf("Ошибка запуска Remote Assistance: %v", err)
+			response.Message = fmt.Sprintf("Ошибка запуска трансляции экрана: %v", err)
 			return response
 		}
 
-		response.ConnectionString = invFile
-		response.ConnectionPassword = password
-		response.Message = "Remote Assistance запущен"
+		response.ConnectionString = fmt.Sprintf(`{"hostname": "%s", "method": "relay", "session_guid": "%s"}`,
+			m.hostname, request.SessionGUID)
+		response.Message = "Трансляция экрана запущена"
+		response.ViewOnly = request.ViewOnly
+		response.Monitor = request.Monitor
+		response.RelayTunnel = true
+
+		session := &ActiveSession{
+			SessionGUID:  request.SessionGUID,
+			SessionType:  request.SessionType,
+			InitiatedBy:  request.InitiatedBy,
+			UserName:     request.TargetUser,
+			StartedAt:    time.Now(),
+			LastActivity: time.Now(),
+			Stream:       stream,
+		}
+		if request.ViewOnly && request.AllowControlRequest {
+			stream.SetControlRequestHandler(func() {
+				m.handleControlRequest(session)
+			})
+		}
 
-		// Store active session
 		m.mutex.Lock()
-		m.activeSession = &ActiveSession{
-			SessionGUID:    request.SessionGUID,
-			SessionType:    request.SessionType,
-			StartedAt:      time.Now(),
-			InvitationFile: invFile,
-			Password:       password,
-		}
+		m.activeSession = session
 		m.mutex.Unlock()
 
-	case "screen_share":
-		// Simple screen share - just enable RDP shadowing
-		response.Message = "Screen share mode enabled"
-		response.Port = 3389
-
-	default:
-		response.Action = "decline"
-		response.Message = fmt.Sprintf("Неподдерживаемый тип сессии: %s", request.SessionType)
-	}
+	case "shadow":
+		// RDP shadowing of the user's session: mstsc /shadow:<id> /control
+		sessionID := FindUserSession(request.TargetUser)
+		if sessionID == noSession || sessionAccount(sessionID) == "" {
+			response.Action = "decline"
+			response.Message = "Нет активного сеанса пользователя для подключения"
+			return response
+		}
 
-	return response
-}
+		setup, err := prepareShadow(request.SessionGUID)
+		if err != nil {
+			log.Printf("Error preparing RDP shadowing: %v", err)
+			response.Action = "decline"
+			response.Message = fmt.Sprintf("Ошибка настройки теневого подключения RDP: %v", err)
+			return response
+		}
 
-// startRemoteAssistance starts Windows Remote Assistance
-func (m *RemoteSessionManager) startRemoteAssistance() (string, string, error) {
-	// Generate random password
-	password := generatePassword(8)
+		connection := map[string]interface{}{
+			"hostname":       m.hostname,
+			"method":         "rdp_shadow",
+			"rdp_session_id": sessionID,
+			"user":           sessionAccount(sessionID),
+			"command":        fmt.Sprintf("mstsc /v:%s /shadow:%d /control /noConsentPrompt", m.hostname, sessionID),
+		}
 
-	// Create invitation file path
-	tempDir := os.TempDir()
-	invFile := filepath.Join(tempDir, fmt.Sprintf("ra_invite_%s.msrcIncident", m.agentID[:8]))
+		// Shadowing connects to the RDP service, which the relay reaches
+		// through the tunnel; the operator's client points at the relay
+		var tunnel *RelayTunnel
+		if request.RelayAddress != "" {
+			tunnel, err = m.startRelayTunnel(request, 3389)
+			if err != nil {
+				log.Printf("Error starting relay tunnel: %v", err)
+				setup.revert()
+				response.Action = "decline"
+				response.Message = fmt.Sprintf("Ошибка подключения к ретранслятору: %v", err)
+				return response
+			}
+			connection["relay"] = request.RelayAddress
+			response.RelayTunnel = true
+		}
 
-	// Create Remote Assistance invitation using msra.exe
-	// Method 1: Use Windows Remote Assistance with unsolicited offer
-	// msra.exe /offerRA <computername>
+		info, _ := json.Marshal(connection)
+		response.ConnectionString = string(info)
+		response.Message = "Теневое подключение RDP подготовлено"
 
-	// Method 2: Create invitation file programmatically
-	// We'll use PowerShell to create the invitation
+		m.mutex.Lock()
+		m.activeSession = &ActiveSession{
+			SessionGUID:  request.SessionGUID,
+			SessionType:  request.SessionType,
+			UserName:     sessionAccount(sessionID),
+			StartedAt:    time.Now(),
+			LastActivity: time.Now(),
+			Shadow:       setup,
+			Tunnel:       tunnel,
+		}
+		m.mutex.Unlock()
 
-	psScript := fmt.Sprintf(`
-$ErrorActionPreference = "Stop"
+	case "terminal":
+		// Command-line access only; no desktop is shared
+		terminal, err := StartTerminalSession(request.SessionGUID, m.config.TerminalShell, m.config.TerminalConstrained,
+			m.onSendTerminalOutput, m.onFetchTerminalInput)
+		if err != nil {
+			log.Printf("Error starting terminal session: %v", err)
+			response.Action = "decline"
+			response.Message = fmt.Sprintf("Ошибка запуска терминала: %v", err)
+			return response
+		}
 
-# Enable Remote Assistance if not enabled
-$raKey = "HKLM:\SYSTEM\CurrentControlSet\Control\Remote Assistance"
-if (!(Test-Path $raKey)) {
-    New-Item -Path $raKey -Force | Out-Null
-}
-Set-ItemProperty -Path $raKey -Name "fAllowToGetHelp" -Value 1 -Type DWord -Force
-
-# Create invitation using Windows Remote Assistance COM object
-try {
-    $ra = New-Object -ComObject RaServer.RemoteAssistanceInvitation
-    $ra.SetPassword("%s")
-    $ra.SetMaxTicketExpiry(60)  # 60 minutes
-
-    # Export invitation file
-    $ra.CreateRATicket("%s")
-
-    # Return the invitation content
-    Get-Content -Path "%s" -Raw
-} catch {
-    # Fallback: use msra command line
-    Start-Process -FilePath "msra.exe" -ArgumentList "/saveasfile", "%s", "%s" -Wait -NoNewWindow
-    if (Test-Path "%s") {
-        Get-Content -Path "%s" -Raw
-    } else {
-        throw "Failed to create Remote Assistance invitation"
-    }
-}
-`, password, invFile, invFile, invFile, password, invFile, invFile)
+		response.ConnectionString = fmt.Sprintf(`{"hostname": "%s", "method": "relay_terminal", "shell": "%s", "session_guid": "%s"}`,
+			m.hostname, m.config.TerminalShell, request.SessionGUID)
+		response.Message = "Терминал запущен"
 
-	// Execute PowerShell script
-	cmd := exec.Command("powershell.exe", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command", psScript)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Fallback: just return info for manual connection
-		log.Printf("Remote Assistance script output: %s", string(output))
+		m.mutex.Lock()
+		m.activeSession = &ActiveSession{
+			SessionGUID:  request.SessionGUID,
+			SessionType:  request.SessionType,
+			UserName:     request.TargetUser,
+			StartedAt:    time.Now(),
+			LastActivity: time.Now(),
+			Terminal:     terminal,
+		}
+		m.mutex.Unlock()
 
-		// Try simple approach - just enable RA and return computer info
-		return m.enableRemoteAssistanceSimple(password)
+	default:
+		response.Action = "decline"
+		response.Message = fmt.Sprintf("Неподдерживаемый тип сессии: %s", request.SessionType)
 	}
 
-	invContent := strings.TrimSpace(string(output))
-	return invContent, password, nil
+	return response
 }
 
-// enableRemoteAssistanceSimple enables RA with simple settings
-func (m *RemoteSessionManager) enableRemoteAssistanceSimple(password string) (string, string, error) {
-	// Enable Remote Assistance in registry
-	cmd := exec.Command("reg", "add",
-		`HKLM\SYSTEM\CurrentControlSet\Control\Remote Assistance`,
-		"/v", "fAllowToGetHelp", "/t", "REG_DWORD", "/d", "1", "/f")
-	cmd.Run()
-
-	// Return connection info
-	connectionInfo := fmt.Sprintf(`{"hostname": "%s", "method": "msra", "password": "%s"}`,
-		m.hostname, password)
-
-	return connectionInfo, password, nil
+// startRelayTunnel opens the outbound tunnel through which the operator
+// reaches the given local port when the endpoint is behind VPN or NAT
+func (m *RemoteSessionManager) startRelayTunnel(request *RemoteSessionRequest, port int) (*RelayTunnel, error) {
+	return StartRelayTunnel(request.SessionGUID, m.agentID, request.RelayAddress, request.RelayToken,
+		fmt.Sprintf("127.0.0.1:%d", port), m.config.RelayInsecureSkipVerify)
 }
 
 // EndActiveSession ends the current active session
 func (m *RemoteSessionManager) EndActiveSession() {
+	m.endActiveSession("session ended")
+}
+
+// endActiveSession ends the current active session, recording the reason
+func (m *RemoteSessionManager) endActiveSession(reason string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -349,12 +371,31 @@ func (m *RemoteSessionManager) EndActiveSession() {
 		m.activeSession.Process.Kill()
 	}
 
-	// Clean up invitation file
-	if m.activeSession.InvitationFile != "" {
-		os.Remove(m.activeSession.InvitationFile)
+	// Stop screen streaming
+	if m.activeSession.Stream != nil {
+		m.activeSession.Stream.Stop()
 	}
 
-	log.Printf("Remote session %s ended", m.activeSession.SessionGUID)
+	// Stop the terminal shell
+	if m.activeSession.Terminal != nil {
+		m.activeSession.Terminal.Stop()
+	}
+
+	// Close the relay tunnel before the services behind it go away
+	if m.activeSession.Tunnel != nil {
+		m.activeSession.Tunnel.Stop()
+	}
+
+	// Disconnect the shadowing viewer and revert RDP shadowing settings
+	if m.activeSession.Shadow != nil {
+		for _, pid := range processesByName("RdpSa.exe") {
+			terminateProcess(pid, 1)
+		}
+		m.activeSession.Shadow.revert()
+	}
+
+	log.Printf("Remote session %s ended: %s", m.activeSession.SessionGUID, reason)
+	m.auditEnded(m.activeSession, reason)
 	m.activeSession = nil
 }
 
@@ -365,22 +406,9 @@ func (m *RemoteSessionManager) GetActiveSession() *ActiveSession {
 	return m.activeSession
 }
 
-// generatePassword generates a random password
-func generatePassword(length int) string {
-	const charset = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
-	rand.Seed(time.Now().UnixNano())
-
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(b)
-}
-
 // RemoteSessionStatus represents the status of remote session capability
 type RemoteSessionStatus struct {
 	Supported         bool   `json:"supported"`
-	RemoteAssistance  bool   `json:"remote_assistance"`
 	RDPEnabled        bool   `json:"rdp_enabled"`
 	CurrentUser       string `json:"current_user"`
 	ActiveSessionGUID string `json:"active_session_guid,omitempty"`
@@ -393,20 +421,11 @@ func (m *RemoteSessionManager) GetStatus() *RemoteSessionStatus {
 		CurrentUser:      os.Getenv("USERNAME"),
 	}
 
-	// Check if Remote Assistance is enabled
-	cmd := exec.Command("reg", "query",
-		`HKLM\SYSTEM\CurrentControlSet\Control\Remote Assistance`,
-		"/v", "fAllowToGetHelp")
-	output, err := cmd.CombinedOutput()
-	if err == nil && strings.Contains(string(output), "0x1") {
-		status.RemoteAssistance = true
-	}
-
 	// Check if RDP is enabled
-	cmd = exec.Command("reg", "query",
+	cmd := exec.Command("reg", "query",
 		`HKLM\SYSTEM\CurrentControlSet\Control\Terminal Server`,
 		"/v", "fDenyTSConnections")
-	output, err = cmd.CombinedOutput()
+	output, err := cmd.CombinedOutput()
 	if err == nil && strings.Contains(string(output), "0x0") {
 		status.RDPEnabled = true
 	}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package collector
+
+import (
+	"log"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// RemoteSessionManager handles remote support sessions (Windows only)
+type RemoteSessionManager struct{}
+
+// NewRemoteSessionManager creates a remote session stub
+func NewRemoteSessionManager(cfg *config.RemoteSessionConfig, agentID, hostname string) *RemoteSessionManager {
+	return &RemoteSessionManager{}
+}
+
+// SetCallbacks does nothing
+func (m *RemoteSessionManager) SetCallbacks(
+	onCheckPending func() (*RemoteSessionRequest, error),
+	onSendResponse func(string, *RemoteSessionResponse) error,
+) {
+}
+
+// SetSessionEndCallback does nothing
+func (m *RemoteSessionManager) SetSessionEndCallback(onEnd func(sessionGUID, reason string) error) {}
+
+// SetControlCallback does nothing
+func (m *RemoteSessionManager) SetControlCallback(onResult func(sessionGUID string, granted bool, message string) error) {
+}
+
+// SetTerminalCallbacks does nothing
+func (m *RemoteSessionManager) SetTerminalCallbacks(
+	onSendOutput func(*TerminalOutput) error,
+	onFetchInput func(string) ([]string, error),
+) {
+}
+
+// SetTransferCallbacks does nothing
+func (m *RemoteSessionManager) SetTransferCallbacks(
+	onFetch func(sessionGUID string) ([]FileTransferRequest, error),
+	onDownload func(sessionGUID, transferID string) ([]byte, error),
+	onUpload func(sessionGUID, transferID string, data []byte) error,
+	onResult func(*FileTransferRecord) error,
+) {
+}
+
+// SetEventCallback does nothing
+func (m *RemoteSessionManager) SetEventCallback(onEvent func(*Event)) {}
+
+// Start logs that remote sessions are unavailable
+func (m *RemoteSessionManager) Start() {
+	log.Println("Remote sessions: Not implemented on this platform")
+}
+
+// Stop does nothing
+func (m *RemoteSessionManager) Stop() {}
@@ -0,0 +1,155 @@
+//go:build windows
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// shadowPolicyKey holds the Group Policy value controlling RDP shadowing
+	shadowPolicyKey = `SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`
+
+	// shadowFullControlNoConsent allows full control without the built-in
+	// consent prompt; the user has already consented through the agent dialog
+	shadowFullControlNoConsent = 2
+
+	// shadowFirewallRule is the (non-localized) name of the built-in shadow rule
+	shadowFirewallRule = "RemoteDesktop-Shadow-In-TCP"
+)
+
+// shadowSetup records the settings changed for an RDP shadow session so
+// they can be reverted when the session ends, even after an agent restart
+type shadowSetup struct {
+	SessionGUID        string  `json:"session_guid"`
+	PreviousShadow     *uint32 `json:"previous_shadow,omitempty"` // nil if the value was not set
+	FirewallWasEnabled bool    `json:"firewall_was_enabled"`
+}
+
+// shadowStatePath is where the pending revert is persisted
+func shadowStatePath() string {
+	return filepath.Join(os.Getenv("ProgramData"), "SIEM", "shadow_state.json")
+}
+
+// prepareShadow enables RDP shadowing with control and opens the firewall
+// rule for the duration of the session
+func prepareShadow(sessionGUID string) (*shadowSetup, error) {
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, shadowPolicyKey, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shadow policy key: %w", err)
+	}
+	defer key.Close()
+
+	setup := &shadowSetup{SessionGUID: sessionGUID}
+	if value, _, err := key.GetIntegerValue("Shadow"); err == nil {
+		previous := uint32(value)
+		setup.PreviousShadow = &previous
+	}
+	setup.FirewallWasEnabled = firewallRuleEnabled(shadowFirewallRule)
+
+	// Persist before changing anything so a crash cannot leave shadowing enabled
+	if err := setup.save(); err != nil {
+		return nil, err
+	}
+
+	if err := key.SetDWordValue("Shadow", shadowFullControlNoConsent); err != nil {
+		setup.revert()
+		return nil, fmt.Errorf("failed to enable shadowing: %w", err)
+	}
+
+	if !setup.FirewallWasEnabled {
+		if err := setFirewallRule(shadowFirewallRule, true); err != nil {
+			setup.revert()
+			return nil, fmt.Errorf("failed to open firewall for shadowing: %w", err)
+		}
+	}
+
+	log.Printf("✓ RDP shadowing enabled for session %s", sessionGUID)
+	return setup, nil
+}
+
+// revert restores the shadow policy and firewall rule
+func (s *shadowSetup) revert() {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, shadowPolicyKey, registry.SET_VALUE)
+	if err == nil {
+		if s.PreviousShadow != nil {
+			err = key.SetDWordValue("Shadow", *s.PreviousShadow)
+		} else {
+			err = key.DeleteValue("Shadow")
+		}
+		key.Close()
+	}
+	if err != nil && err != registry.ErrNotExist {
+		log.Printf("Error restoring shadow policy: %v", err)
+	}
+
+	if !s.FirewallWasEnabled {
+		if err := setFirewallRule(shadowFirewallRule, false); err != nil {
+			log.Printf("Error closing shadow firewall rule: %v", err)
+		}
+	}
+
+	os.Remove(shadowStatePath())
+	log.Printf("RDP shadowing settings reverted for session %s", s.SessionGUID)
+}
+
+func (s *shadowSetup) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(shadowStatePath()), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(shadowStatePath(), data, 0600)
+}
+
+// revertLeftoverShadow reverts settings left behind by a session that was
+// active when the agent last stopped
+func revertLeftoverShadow() {
+	data, err := os.ReadFile(shadowStatePath())
+	if err != nil {
+		return
+	}
+
+	var setup shadowSetup
+	if err := json.Unmarshal(data, &setup); err != nil {
+		log.Printf("Error reading shadow state: %v", err)
+		os.Remove(shadowStatePath())
+		return
+	}
+
+	log.Printf("Reverting RDP shadowing left from session %s", setup.SessionGUID)
+	setup.revert()
+}
+
+// firewallRuleEnabled reports whether a Windows Firewall rule is enabled
+func firewallRuleEnabled(name string) bool {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+		fmt.Sprintf("(Get-NetFirewallRule -Name %s -ErrorAction Stop).Enabled", psQuote(name)))
+	output, err := cmd.Output()
+	return err == nil && strings.EqualFold(strings.TrimSpace(string(output)), "True")
+}
+
+// setFirewallRule enables or disables a Windows Firewall rule
+func setFirewallRule(name string, enabled bool) error {
+	verb := "Disable-NetFirewallRule"
+	if enabled {
+		verb = "Enable-NetFirewallRule"
+	}
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+		fmt.Sprintf("%s -Name %s -ErrorAction Stop", verb, psQuote(name)))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, truncateOutput(string(output), 500))
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// terminalInputInterval is how often queued operator input is fetched from the relay
+	terminalInputInterval = 200 * time.Millisecond
+
+	// terminalChunkSize bounds a single output chunk sent to the relay
+	terminalChunkSize = 4096
+)
+
+// TerminalSession bridges a shell's stdin/stdout to the SIEM relay. Every
+// line typed by the operator and every output chunk is written to an audit
+// log only SYSTEM and administrators can read.
+type TerminalSession struct {
+	sessionGUID string
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	audit       *os.File
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	exited      chan struct{}
+
+	mutex     sync.Mutex
+	lastInput time.Time
+	outputSeq uint64
+
+	onSendOutput func(*TerminalOutput) error
+	onFetchInput func(sessionGUID string) ([]string, error)
+}
+
+// StartTerminalSession starts a shell ("powershell" or "cmd") for the
+// session. With constrained set, PowerShell runs in ConstrainedLanguage mode.
+func StartTerminalSession(
+	sessionGUID, shell string,
+	constrained bool,
+	onSendOutput func(*TerminalOutput) error,
+	onFetchInput func(string) ([]string, error),
+) (*TerminalSession, error) {
+	if onSendOutput == nil || onFetchInput == nil {
+		return nil, fmt.Errorf("relay callbacks not configured")
+	}
+
+	var cmd *exec.Cmd
+	var init string
+	switch shell {
+	case "cmd":
+		// /Q: no command echo; switch the console to UTF-8 for the relay
+		cmd = exec.Command("cmd.exe", "/Q", "/K", "chcp 65001 >nul")
+	case "powershell", "":
+		// Reads commands from stdin; output is sent as UTF-8
+		cmd = exec.Command("powershell.exe", "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "-")
+		init = "[Console]::OutputEncoding = [System.Text.Encoding]::UTF8\r\n"
+		if constrained {
+			cmd.Env = append(os.Environ(), "__PSLockdownPolicy=4")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported terminal shell: %s", shell)
+	}
+
+	dir := filepath.Join(os.Getenv("ProgramData"), "SIEM", "sessions")
+	if err := createAgentDir(dir); err != nil {
+		return nil, err
+	}
+	audit, err := os.OpenFile(filepath.Join(dir, sessionGUID+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open terminal audit log: %w", err)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		audit.Close()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		audit.Close()
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		audit.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &TerminalSession{
+		sessionGUID:  sessionGUID,
+		cmd:          cmd,
+		stdin:        stdin,
+		audit:        audit,
+		ctx:          ctx,
+		cancel:       cancel,
+		exited:       make(chan struct{}),
+		onSendOutput: onSendOutput,
+		onFetchInput: onFetchInput,
+	}
+
+	t.writeAudit("start", fmt.Sprintf("%s (PID %d, constrained=%v)", strings.Join(cmd.Args, " "), cmd.Process.Pid, constrained))
+	if init != "" {
+		io.WriteString(stdin, init)
+	}
+
+	t.wg.Add(1)
+	go t.relayInput()
+
+	// Wait closes the pipes, so it may only be called once all output is read
+	go func() {
+		t.relayOutput(stdout)
+		err := cmd.Wait()
+		t.writeAudit("exit", fmt.Sprintf("%v", err))
+		close(t.exited)
+	}()
+
+	log.Printf("✓ Terminal session started for session %s (%s, PID %d)", sessionGUID, shell, cmd.Process.Pid)
+	return t, nil
+}
+
+// Stop kills the shell and closes the audit log
+func (t *TerminalSession) Stop() {
+	t.cancel()
+	t.stdin.Close()
+	t.cmd.Process.Kill()
+	t.wg.Wait()
+
+	// Child processes that inherited the pipe can keep it open after the shell is killed
+	select {
+	case <-t.exited:
+	case <-time.After(10 * time.Second):
+		log.Printf("Terminal output for session %s still open after shell exit", t.sessionGUID)
+	}
+	t.audit.Close()
+
+	log.Printf("Terminal session stopped for session %s", t.sessionGUID)
+}
+
+// Exited is closed when the shell process has exited
+func (t *TerminalSession) Exited() <-chan struct{} {
+	return t.exited
+}
+
+// LastInput returns when operator input was last received
+func (t *TerminalSession) LastInput() time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.lastInput
+}
+
+// relayOutput sends shell output to the relay as it is produced
+func (t *TerminalSession) relayOutput(stdout io.Reader) {
+	buf := make([]byte, terminalChunkSize)
+	for {
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			data := string(buf[:n])
+			t.writeAudit("output", data)
+
+			t.mutex.Lock()
+			chunk := &TerminalOutput{
+				SessionGUID: t.sessionGUID,
+				Sequence:    t.outputSeq,
+				Data:        data,
+				Timestamp:   time.Now(),
+			}
+			t.outputSeq++
+			t.mutex.Unlock()
+
+			if err := t.onSendOutput(chunk); err != nil {
+				log.Printf("Error sending terminal output for session %s: %v", t.sessionGUID, err)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// relayInput fetches queued operator input and writes it to the shell
+func (t *TerminalSession) relayInput() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(terminalInputInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-t.exited:
+			return
+		case <-ticker.C:
+		}
+
+		lines, err := t.onFetchInput(t.sessionGUID)
+		if err != nil {
+			log.Printf("Error fetching terminal input for session %s: %v", t.sessionGUID, err)
+			continue
+		}
+
+		for _, line := range lines {
+			t.mutex.Lock()
+			t.lastInput = time.Now()
+			t.mutex.Unlock()
+
+			t.writeAudit("input", line)
+			if _, err := io.WriteString(t.stdin, strings.TrimRight(line, "\r\n")+"\r\n"); err != nil {
+				log.Printf("Error writing terminal input for session %s: %v", t.sessionGUID, err)
+				return
+			}
+		}
+	}
+}
+
+// writeAudit appends a timestamped entry to the session audit log
+func (t *TerminalSession) writeAudit(direction, data string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	fmt.Fprintf(t.audit, "%s [%s] %q\n", time.Now().Format(time.RFC3339Nano), direction, data)
+}
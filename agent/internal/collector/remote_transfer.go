@@ -0,0 +1,236 @@
+//go:build windows
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// transferPollInterval is how often the relay is checked for file transfers
+const transferPollInterval = 2 * time.Second
+
+// Transfer directions, seen from the operator
+const (
+	TransferPush = "push" // operator -> this machine
+	TransferPull = "pull" // this machine -> operator
+)
+
+// SetTransferCallbacks sets the SIEM relay callbacks used for file transfers
+func (m *RemoteSessionManager) SetTransferCallbacks(
+	onFetch func(sessionGUID string) ([]FileTransferRequest, error),
+	onDownload func(sessionGUID, transferID string) ([]byte, error),
+	onUpload func(sessionGUID, transferID string, data []byte) error,
+	onResult func(*FileTransferRecord) error,
+) {
+	m.onFetchTransfers = onFetch
+	m.onDownloadFile = onDownload
+	m.onUploadFile = onUpload
+	m.onTransferResult = onResult
+}
+
+// runTransfers processes file transfers queued for the active session
+func (m *RemoteSessionManager) runTransfers() {
+	if m.onFetchTransfers == nil || (!m.config.FileTransferPush && !m.config.FileTransferPull) {
+		return
+	}
+
+	ticker := time.NewTicker(transferPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		session := m.GetActiveSession()
+		if session == nil {
+			continue
+		}
+
+		requests, err := m.onFetchTransfers(session.SessionGUID)
+		if err != nil {
+			log.Printf("Error fetching file transfers for session %s: %v", session.SessionGUID, err)
+			continue
+		}
+
+		for _, request := range requests {
+			record := m.transferFile(session, request)
+			m.recordTransfer(session, record)
+		}
+	}
+}
+
+// transferFile performs one transfer and returns its audit record
+func (m *RemoteSessionManager) transferFile(session *ActiveSession, request FileTransferRequest) *FileTransferRecord {
+	record := &FileTransferRecord{
+		SessionGUID: session.SessionGUID,
+		TransferID:  request.TransferID,
+		Direction:   request.Direction,
+		Timestamp:   time.Now(),
+	}
+	maxSize := int64(m.config.FileTransferMaxSize) * 1024 * 1024
+
+	var err error
+	switch request.Direction {
+	case TransferPush:
+		if !m.config.FileTransferPush {
+			record.Status, record.Error = "rejected", "push transfers are disabled by policy"
+			return record
+		}
+		err = m.receiveFile(session, request, record, maxSize)
+
+	case TransferPull:
+		if !m.config.FileTransferPull {
+			record.Status, record.Error = "rejected", "pull transfers are disabled by policy"
+			return record
+		}
+		err = m.sendFile(session, request, record, maxSize)
+
+	default:
+		record.Status, record.Error = "rejected", fmt.Sprintf("unknown direction %q", request.Direction)
+		return record
+	}
+
+	if err != nil {
+		if record.Status == "" {
+			record.Status = "failed"
+		}
+		record.Error = err.Error()
+	} else {
+		record.Status = "completed"
+	}
+	return record
+}
+
+// receiveFile downloads a pushed file into the session's transfer directory
+func (m *RemoteSessionManager) receiveFile(session *ActiveSession, request FileTransferRequest, record *FileTransferRecord, maxSize int64) error {
+	path, err := transferPath(m.config.FileTransferDir, session.SessionGUID, request.FileName)
+	if err != nil {
+		record.Status = "rejected"
+		return err
+	}
+	record.Path = path
+
+	if request.Size > maxSize {
+		record.Status, record.Size = "rejected", request.Size
+		return fmt.Errorf("file size %d exceeds limit of %d bytes", request.Size, maxSize)
+	}
+
+	if m.onDownloadFile == nil {
+		return fmt.Errorf("download callback not configured")
+	}
+	data, err := m.onDownloadFile(session.SessionGUID, request.TransferID)
+	if err != nil {
+		return err
+	}
+	record.Size = int64(len(data))
+	if record.Size > maxSize {
+		record.Status = "rejected"
+		return fmt.Errorf("file size %d exceeds limit of %d bytes", record.Size, maxSize)
+	}
+
+	sum := sha256.Sum256(data)
+	record.SHA256 = hex.EncodeToString(sum[:])
+	if request.SHA256 != "" && !strings.EqualFold(request.SHA256, record.SHA256) {
+		record.Status = "rejected"
+		return fmt.Errorf("hash mismatch: expected %s", request.SHA256)
+	}
+
+	if err := createAgentDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// transferPath returns where a pushed file is saved: under dir, in the
+// directory of the session, by the file's base name. The session GUID
+// comes from the server and must be a GUID, used in its canonical form
+// like execution GUIDs; the path must stay under dir.
+func transferPath(dir, sessionGUID, fileName string) (string, error) {
+	id, err := uuid.Parse(sessionGUID)
+	if err != nil {
+		return "", fmt.Errorf("invalid session GUID %q", sessionGUID)
+	}
+
+	name := filepath.Base(fileName)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `\/:`) {
+		return "", fmt.Errorf("invalid file name %q", fileName)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid transfer directory: %w", err)
+	}
+	path := filepath.Join(root, id.String(), name)
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file name %q leaves the transfer directory", fileName)
+	}
+	return path, nil
+}
+
+// sendFile uploads a local file requested by the operator
+func (m *RemoteSessionManager) sendFile(session *ActiveSession, request FileTransferRequest, record *FileTransferRecord, maxSize int64) error {
+	if m.onUploadFile == nil {
+		return fmt.Errorf("upload callback not configured")
+	}
+
+	record.Path = filepath.Clean(request.Path)
+	info, err := os.Stat(record.Path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		record.Status = "rejected"
+		return fmt.Errorf("not a regular file")
+	}
+
+	record.Size = info.Size()
+	if record.Size > maxSize {
+		record.Status = "rejected"
+		return fmt.Errorf("file size %d exceeds limit of %d bytes", record.Size, maxSize)
+	}
+
+	data, err := os.ReadFile(record.Path)
+	if err != nil {
+		return err
+	}
+	record.Size = int64(len(data))
+
+	sum := sha256.Sum256(data)
+	record.SHA256 = hex.EncodeToString(sum[:])
+
+	return m.onUploadFile(session.SessionGUID, request.TransferID, data)
+}
+
+// recordTransfer logs a transfer and reports its audit record to SIEM
+func (m *RemoteSessionManager) recordTransfer(session *ActiveSession, record *FileTransferRecord) {
+	if record.Status == "completed" {
+		log.Printf("✓ File %s for session %s: %s (%d bytes, SHA256 %s)",
+			record.Direction, record.SessionGUID, record.Path, record.Size, record.SHA256)
+	} else {
+		log.Printf("File %s for session %s %s: %s", record.Direction, record.SessionGUID, record.Status, record.Error)
+	}
+
+	m.mutex.Lock()
+	session.Transfers = append(session.Transfers, *record)
+	m.mutex.Unlock()
+
+	m.auditTransfer(session, record)
+
+	if m.onTransferResult != nil {
+		if err := m.onTransferResult(record); err != nil {
+			log.Printf("Error reporting file transfer to SIEM: %v", err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransferPath(t *testing.T) {
+	dir := `C:\ProgramData\SIEM\transfers`
+	const guid = "0b5b8c4e-3f2a-4c1d-9e6f-7a8b9c0d1e2f"
+
+	tests := []struct {
+		name        string
+		sessionGUID string
+		fileName    string
+		want        string
+		wantErr     string
+	}{
+		{name: "plain file", sessionGUID: guid, fileName: "report.pdf", want: dir + `\` + guid + `\report.pdf`},
+		{name: "canonical GUID", sessionGUID: "{0B5B8C4E-3F2A-4C1D-9E6F-7A8B9C0D1E2F}", fileName: "a.txt", want: dir + `\` + guid + `\a.txt`},
+		{name: "directories in the name dropped", sessionGUID: guid, fileName: `..\..\Windows\System32\evil.dll`, want: dir + `\` + guid + `\evil.dll`},
+		{name: "forward slashes dropped", sessionGUID: guid, fileName: "../../evil.dll", want: dir + `\` + guid + `\evil.dll`},
+		{name: "traversal in GUID", sessionGUID: `..\..\Windows\System32`, fileName: "evil.dll", wantErr: "invalid session GUID"},
+		{name: "absolute GUID", sessionGUID: `C:\Windows`, fileName: "evil.dll", wantErr: "invalid session GUID"},
+		{name: "empty GUID", sessionGUID: "", fileName: "a.txt", wantErr: "invalid session GUID"},
+		{name: "drive dropped", sessionGUID: guid, fileName: "C:evil.dll", want: dir + `\` + guid + `\evil.dll`},
+		{name: "stream name", sessionGUID: guid, fileName: "a.txt:hidden", wantErr: "invalid file name"},
+		{name: "parent name", sessionGUID: guid, fileName: "..", wantErr: "invalid file name"},
+		{name: "empty name", sessionGUID: guid, fileName: "", wantErr: "invalid file name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := transferPath(dir, tt.sessionGUID, tt.fileName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("transferPath = %q, %v; want error %q", path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.EqualFold(path, filepath.Clean(tt.want)) {
+				t.Errorf("transferPath = %q, want %q", path, tt.want)
+			}
+		})
+	}
+}
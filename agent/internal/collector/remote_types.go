@@ -0,0 +1,89 @@
+package collector
+
+import "time"
+
+// Remote session payloads exchanged with the SIEM relay. They are shared by
+// the API client on every platform; sessions themselves are Windows only.
+
+// RemoteSessionRequest represents a pending remote session from SIEM
+type RemoteSessionRequest struct {
+	HasPending  bool   `json:"has_pending"`
+	SessionGUID string `json:"session_guid"`
+	SessionType string `json:"session_type"`
+	TargetUser  string `json:"target_user,omitempty"`
+	InitiatedBy string `json:"initiated_by"`
+	Reason      string `json:"reason"`
+	RequestedAt string `json:"requested_at"`
+
+	// Screen sharing options set by help-desk policy
+	ViewOnly            bool `json:"view_only,omitempty"`             // operator may only watch
+	Monitor             int  `json:"monitor,omitempty"`               // 1-based display number, 0 for all displays
+	AllowControlRequest bool `json:"allow_control_request,omitempty"` // view-only operator may ask the user for control
+
+	// Consent mode for this host class; overrides the agent configuration
+	ConsentMode string `json:"consent_mode,omitempty"`
+
+	// Relay for endpoints the operator cannot reach directly (VPN/NAT).
+	// When set, shadow sessions are carried through an outbound TLS tunnel
+	// from the agent to this host:port. Screen sharing always streams
+	// through the relay.
+	RelayAddress string `json:"relay_address,omitempty"`
+	RelayToken   string `json:"relay_token,omitempty"`
+}
+
+// RemoteSessionResponse represents the user's response to a session request
+type RemoteSessionResponse struct {
+	Action             string `json:"action"`
+	ConnectionString   string `json:"connection_string,omitempty"`
+	ConnectionPassword string `json:"connection_password,omitempty"`
+	Port               int    `json:"port,omitempty"`
+	Message            string `json:"message,omitempty"`
+	ViewOnly           bool   `json:"view_only,omitempty"`
+	Monitor            int    `json:"monitor,omitempty"`
+	RelayTunnel        bool   `json:"relay_tunnel,omitempty"` // operator connects through the relay
+}
+
+// RemoteInputEvent is an operator's mouse or keyboard action. Coordinates
+// are relative to the top-left corner of the streamed frame. In view-only
+// mode the operator may only send request_control to ask the user for input
+// control.
+type RemoteInputEvent struct {
+	Type    string `json:"type"` // mouse_move, mouse_down, mouse_up, wheel, key_down, key_up, text, request_control
+	X       int    `json:"x,omitempty"`
+	Y       int    `json:"y,omitempty"`
+	Button  string `json:"button,omitempty"` // left, right, middle
+	Delta   int    `json:"delta,omitempty"`  // wheel
+	KeyCode int    `json:"key_code,omitempty"`
+	Text    string `json:"text,omitempty"`
+}
+
+// TerminalOutput is a chunk of shell output sent through the SIEM relay
+type TerminalOutput struct {
+	SessionGUID string    `json:"session_guid"`
+	Sequence    uint64    `json:"sequence"`
+	Data        string    `json:"data"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// FileTransferRequest is a file transfer queued by the operator
+type FileTransferRequest struct {
+	TransferID string `json:"transfer_id"`
+	Direction  string `json:"direction"`
+	FileName   string `json:"file_name,omitempty"` // push: name to save as
+	Path       string `json:"path,omitempty"`      // pull: file to send
+	Size       int64  `json:"size,omitempty"`      // push: announced size
+	SHA256     string `json:"sha256,omitempty"`    // push: expected hash
+}
+
+// FileTransferRecord is the audit record of one transfer
+type FileTransferRecord struct {
+	SessionGUID string    `json:"session_guid"`
+	TransferID  string    `json:"transfer_id"`
+	Direction   string    `json:"direction"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Status      string    `json:"status"` // "completed", "rejected" or "failed"
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
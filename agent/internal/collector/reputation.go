@@ -0,0 +1,46 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"log"
+)
+
+// SetReputationCallback sets the callback for querying a reputation source
+func (c *SoftwareControlCollector) SetReputationCallback(onCheck func(*ReputationQuery) (*ReputationVerdict, error)) {
+	c.onCheckReputation = onCheck
+}
+
+// trustedByReputation asks the reputation source about an installer and
+// returns the rationale if policy allows auto-approving it
+func (c *SoftwareControlCollector) trustedByReputation(request *SoftwareInstallRequest) (string, bool) {
+	if !c.config.ReputationAutoApprove || c.onCheckReputation == nil || request.InstallerHash == "" {
+		return "", false
+	}
+
+	// Policy may restrict auto-approval to validly signed installers
+	if c.config.ReputationRequireSignature && request.SignatureStatus != SignatureValid {
+		return "", false
+	}
+
+	verdict, err := c.onCheckReputation(&ReputationQuery{
+		AgentID:         c.agentID,
+		SoftwareName:    request.SoftwareName,
+		SoftwareVersion: request.SoftwareVersion,
+		InstallerHash:   request.InstallerHash,
+		Publisher:       request.Publisher,
+		Signer:          request.Signer,
+		SignatureStatus: request.SignatureStatus,
+	})
+	if err != nil {
+		log.Printf("Reputation check for %s failed: %v", request.SoftwareName, err)
+		return "", false
+	}
+
+	if !verdict.Known || verdict.Malicious || !verdict.Trusted || verdict.Score < c.config.ReputationMinScore {
+		return "", false
+	}
+
+	return fmt.Sprintf("trusted by %s reputation (score %d)", verdict.Source, verdict.Score), true
+}
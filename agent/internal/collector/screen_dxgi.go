@@ -0,0 +1,388 @@
+//go:build windows
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	dxgi                   = windows.NewLazySystemDLL("dxgi.dll")
+	procCreateDXGIFactory1 = dxgi.NewProc("CreateDXGIFactory1")
+
+	d3d11                 = windows.NewLazySystemDLL("d3d11.dll")
+	procD3D11CreateDevice = d3d11.NewProc("D3D11CreateDevice")
+)
+
+var (
+	iidIDXGIFactory1   = windows.GUID{Data1: 0x770aae78, Data2: 0xf26f, Data3: 0x4dba, Data4: [8]byte{0xa8, 0x29, 0x25, 0x3c, 0x83, 0xd1, 0xb3, 0x87}}
+	iidIDXGIOutput1    = windows.GUID{Data1: 0x00cddea8, Data2: 0x939b, Data3: 0x4b83, Data4: [8]byte{0xa3, 0x40, 0xa6, 0x85, 0x22, 0x66, 0x66, 0xcc}}
+	iidID3D11Texture2D = windows.GUID{Data1: 0x6f15aaf2, Data2: 0xd208, Data3: 0x4e89, Data4: [8]byte{0x9a, 0xb4, 0x48, 0x95, 0x35, 0xd3, 0x4f, 0x9c}}
+)
+
+// Vtable indices of the COM methods used, counted from IUnknown
+const (
+	comQueryInterface = 0
+	comAddRef         = 1
+	comRelease        = 2
+
+	dxgiFactory1EnumAdapters1  = 12
+	dxgiAdapterEnumOutputs     = 7
+	dxgiOutputGetDesc          = 7
+	dxgiOutput1DuplicateOutput = 22
+
+	dxgiDuplAcquireNextFrame = 8
+	dxgiDuplReleaseFrame     = 14
+
+	d3d11DeviceCreateTexture2D = 5
+	d3d11ContextMap            = 14
+	d3d11ContextUnmap          = 15
+	d3d11ContextCopyResource   = 47
+	d3d11Texture2DGetDesc      = 10
+)
+
+const (
+	dxgiErrorNotFound    = 0x887A0002
+	dxgiErrorAccessLost  = 0x887A0026
+	dxgiErrorWaitTimeout = 0x887A0027
+
+	d3d11SDKVersion    = 7
+	d3d11UsageStaging  = 3
+	d3d11CPUAccessRead = 0x20000
+	d3d11MapRead       = 1
+)
+
+// errDesktopLost means the duplication must be recreated: the desktop was
+// switched (UAC prompt, lock screen) or the display mode changed
+var errDesktopLost = errors.New("desktop duplication lost")
+
+// comObject is a COM interface pointer; methods are called by their index
+// in the interface's vtable
+type comObject struct {
+	vtbl *[64]uintptr
+}
+
+// call invokes a method and returns its HRESULT
+func (o *comObject) call(method int, args ...uintptr) uint32 {
+	r, _, _ := syscall.SyscallN(o.vtbl[method], append([]uintptr{uintptr(unsafe.Pointer(o))}, args...)...)
+	return uint32(r)
+}
+
+// queryInterface returns the object's implementation of another interface
+func (o *comObject) queryInterface(iid *windows.GUID) (*comObject, error) {
+	var out *comObject
+	if hr := o.call(comQueryInterface, uintptr(unsafe.Pointer(iid)), uintptr(unsafe.Pointer(&out))); failedHR(hr) {
+		return nil, hresultError("QueryInterface", hr)
+	}
+	return out, nil
+}
+
+// release drops a reference; nil objects are ignored
+func (o *comObject) release() {
+	if o != nil {
+		o.call(comRelease)
+	}
+}
+
+// failedHR reports whether an HRESULT is an error
+func failedHR(hr uint32) bool {
+	return int32(hr) < 0
+}
+
+// hresultError describes a failed COM call
+func hresultError(call string, hr uint32) error {
+	return fmt.Errorf("%s failed: HRESULT 0x%08X", call, hr)
+}
+
+// DXGI_OUTPUT_DESC
+type dxgiOutputDesc struct {
+	DeviceName         [32]uint16
+	DesktopCoordinates windows.Rect
+	AttachedToDesktop  int32
+	Rotation           uint32
+	Monitor            windows.Handle
+}
+
+// DXGI_OUTDUPL_FRAME_INFO
+type dxgiFrameInfo struct {
+	LastPresentTime           int64
+	LastMouseUpdateTime       int64
+	AccumulatedFrames         uint32
+	RectsCoalesced            int32
+	ProtectedContentMaskedOut int32
+	PointerX                  int32
+	PointerY                  int32
+	PointerVisible            int32
+	TotalMetadataBufferSize   uint32
+	PointerShapeBufferSize    uint32
+}
+
+// D3D11_TEXTURE2D_DESC
+type d3d11Texture2DDesc struct {
+	Width          uint32
+	Height         uint32
+	MipLevels      uint32
+	ArraySize      uint32
+	Format         uint32
+	SampleCount    uint32
+	SampleQuality  uint32
+	Usage          uint32
+	BindFlags      uint32
+	CPUAccessFlags uint32
+	MiscFlags      uint32
+}
+
+// D3D11_MAPPED_SUBRESOURCE
+type d3d11MappedSubresource struct {
+	Data       unsafe.Pointer
+	RowPitch   uint32
+	DepthPitch uint32
+}
+
+// duplicatedOutput is one display duplicated for capture
+type duplicatedOutput struct {
+	bounds      image.Rectangle // in image coordinates
+	rotation    uint32          // DXGI_MODE_ROTATION
+	device      *comObject      // ID3D11Device
+	context     *comObject      // ID3D11DeviceContext
+	duplication *comObject      // IDXGIOutputDuplication
+	staging     *comObject      // ID3D11Texture2D the CPU can read, created with the first frame
+}
+
+// desktopDuplicator captures displays with DXGI desktop duplication
+// (IDXGIOutputDuplication) into one image. The duplicated surfaces do not
+// include the mouse pointer; its position is tracked separately.
+type desktopDuplicator struct {
+	outputs []*duplicatedOutput
+	image   *image.RGBA // the displays, origin at the top-left of the captured area
+	origin  image.Point // virtual screen position of the image's top-left corner
+
+	pointer        image.Point // in image coordinates
+	pointerVisible bool
+	pointerOutput  *duplicatedOutput
+}
+
+// newDesktopDuplicator duplicates the display with the given 1-based
+// number, in DXGI enumeration order, or every display attached to the
+// desktop if the number is 0 or does not exist
+func newDesktopDuplicator(monitor int) (*desktopDuplicator, error) {
+	if err := procCreateDXGIFactory1.Find(); err != nil {
+		return nil, fmt.Errorf("DXGI not available: %w", err)
+	}
+
+	var factory *comObject
+	if hr, _, _ := procCreateDXGIFactory1.Call(uintptr(unsafe.Pointer(&iidIDXGIFactory1)), uintptr(unsafe.Pointer(&factory))); failedHR(uint32(hr)) {
+		return nil, hresultError("CreateDXGIFactory1", uint32(hr))
+	}
+	defer factory.release()
+
+	type attachedOutput struct {
+		adapter *comObject
+		output  *comObject
+		desc    dxgiOutputDesc
+	}
+	var attached []attachedOutput
+	defer func() {
+		for _, a := range attached {
+			a.output.release()
+			a.adapter.release()
+		}
+	}()
+
+	for i := 0; ; i++ {
+		var adapter *comObject
+		hr := factory.call(dxgiFactory1EnumAdapters1, uintptr(i), uintptr(unsafe.Pointer(&adapter)))
+		if hr == dxgiErrorNotFound {
+			break
+		}
+		if failedHR(hr) {
+			return nil, hresultError("EnumAdapters1", hr)
+		}
+
+		for j := 0; ; j++ {
+			var output *comObject
+			if hr := adapter.call(dxgiAdapterEnumOutputs, uintptr(j), uintptr(unsafe.Pointer(&output))); failedHR(hr) {
+				break
+			}
+			var desc dxgiOutputDesc
+			if hr := output.call(dxgiOutputGetDesc, uintptr(unsafe.Pointer(&desc))); failedHR(hr) || desc.AttachedToDesktop == 0 {
+				output.release()
+				continue
+			}
+			adapter.call(comAddRef) // released with the output
+			attached = append(attached, attachedOutput{adapter: adapter, output: output, desc: desc})
+		}
+		adapter.release()
+	}
+	if len(attached) == 0 {
+		return nil, fmt.Errorf("no display attached to the desktop")
+	}
+
+	selected := attached
+	if monitor >= 1 && monitor <= len(attached) {
+		selected = attached[monitor-1 : monitor]
+	}
+
+	d := &desktopDuplicator{}
+	var area image.Rectangle
+	for _, a := range selected {
+		rect := a.desc.DesktopCoordinates
+		o := &duplicatedOutput{
+			bounds:   image.Rect(int(rect.Left), int(rect.Top), int(rect.Right), int(rect.Bottom)),
+			rotation: a.desc.Rotation,
+		}
+		if err := o.duplicate(a.adapter, a.output); err != nil {
+			o.close()
+			d.close()
+			return nil, err
+		}
+		d.outputs = append(d.outputs, o)
+		area = area.Union(o.bounds)
+	}
+
+	// Image coordinates start at the top-left of the captured area
+	for _, o := range d.outputs {
+		o.bounds = o.bounds.Sub(area.Min)
+	}
+	d.image = image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	d.origin = area.Min
+	return d, nil
+}
+
+// duplicate creates a Direct3D device on the adapter and duplicates the output
+func (o *duplicatedOutput) duplicate(adapter, output *comObject) error {
+	if hr, _, _ := procD3D11CreateDevice.Call(
+		uintptr(unsafe.Pointer(adapter)),
+		0, // D3D_DRIVER_TYPE_UNKNOWN, required with an adapter
+		0,
+		0,
+		0,
+		0,
+		d3d11SDKVersion,
+		uintptr(unsafe.Pointer(&o.device)),
+		0,
+		uintptr(unsafe.Pointer(&o.context)),
+	); failedHR(uint32(hr)) {
+		return hresultError("D3D11CreateDevice", uint32(hr))
+	}
+
+	output1, err := output.queryInterface(&iidIDXGIOutput1)
+	if err != nil {
+		return err
+	}
+	defer output1.release()
+
+	// Fails with E_ACCESSDENIED while the secure desktop is shown
+	if hr := output1.call(dxgiOutput1DuplicateOutput, uintptr(unsafe.Pointer(o.device)), uintptr(unsafe.Pointer(&o.duplication))); failedHR(hr) {
+		return hresultError("DuplicateOutput", hr)
+	}
+	return nil
+}
+
+// close releases the duplication and its device
+func (o *duplicatedOutput) close() {
+	o.staging.release()
+	o.duplication.release()
+	o.context.release()
+	o.device.release()
+}
+
+// close releases every duplication
+func (d *desktopDuplicator) close() {
+	for _, o := range d.outputs {
+		o.close()
+	}
+	d.outputs = nil
+}
+
+// capture waits up to timeout for any display to change and copies the
+// changes into the image. It reports whether the image or the pointer
+// changed, and returns errDesktopLost when the duplicator must be recreated.
+func (d *desktopDuplicator) capture(timeout time.Duration) (bool, error) {
+	wait := uint32(timeout.Milliseconds()) / uint32(len(d.outputs))
+	changed := false
+	for _, o := range d.outputs {
+		updated, err := d.captureOutput(o, wait)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || updated
+	}
+	return changed, nil
+}
+
+// captureOutput acquires the next frame of one display
+func (d *desktopDuplicator) captureOutput(o *duplicatedOutput, wait uint32) (bool, error) {
+	var info dxgiFrameInfo
+	var resource *comObject
+	hr := o.duplication.call(dxgiDuplAcquireNextFrame, uintptr(wait), uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&resource)))
+	switch {
+	case hr == dxgiErrorWaitTimeout:
+		return false, nil
+	case hr == dxgiErrorAccessLost:
+		return false, errDesktopLost
+	case failedHR(hr):
+		return false, hresultError("AcquireNextFrame", hr)
+	}
+	defer o.duplication.call(dxgiDuplReleaseFrame)
+	defer resource.release()
+
+	changed := false
+	if info.LastMouseUpdateTime != 0 {
+		switch {
+		case info.PointerVisible != 0:
+			d.pointer = o.bounds.Min.Add(image.Pt(int(info.PointerX), int(info.PointerY)))
+			d.pointerVisible = true
+			d.pointerOutput = o
+		case d.pointerOutput == o:
+			d.pointerVisible = false
+		}
+		changed = true
+	}
+	if info.LastPresentTime == 0 {
+		// Only the pointer moved
+		return changed, nil
+	}
+
+	texture, err := resource.queryInterface(&iidID3D11Texture2D)
+	if err != nil {
+		return changed, err
+	}
+	defer texture.release()
+
+	var desc d3d11Texture2DDesc
+	texture.call(d3d11Texture2DGetDesc, uintptr(unsafe.Pointer(&desc)))
+	if o.staging == nil {
+		staging := desc
+		staging.MipLevels = 1
+		staging.ArraySize = 1
+		staging.SampleCount = 1
+		staging.SampleQuality = 0
+		staging.Usage = d3d11UsageStaging
+		staging.BindFlags = 0
+		staging.CPUAccessFlags = d3d11CPUAccessRead
+		staging.MiscFlags = 0
+		if hr := o.device.call(d3d11DeviceCreateTexture2D, uintptr(unsafe.Pointer(&staging)), 0, uintptr(unsafe.Pointer(&o.staging))); failedHR(hr) {
+			return changed, hresultError("CreateTexture2D", hr)
+		}
+	}
+
+	o.context.call(d3d11ContextCopyResource, uintptr(unsafe.Pointer(o.staging)), uintptr(unsafe.Pointer(texture)))
+
+	var mapped d3d11MappedSubresource
+	if hr := o.context.call(d3d11ContextMap, uintptr(unsafe.Pointer(o.staging)), 0, d3d11MapRead, 0, uintptr(unsafe.Pointer(&mapped))); failedHR(hr) {
+		return changed, hresultError("Map", hr)
+	}
+	pixels := unsafe.Slice((*byte)(mapped.Data), int(mapped.RowPitch)*int(desc.Height))
+	copyDesktopPixels(d.image, o.bounds, o.rotation, pixels, int(desc.Width), int(desc.Height), int(mapped.RowPitch))
+	o.context.call(d3d11ContextUnmap, uintptr(unsafe.Pointer(o.staging)), 0)
+
+	return true, nil
+}
@@ -0,0 +1,306 @@
+//go:build windows
+
+package collector
+
+import (
+	"image"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                            = windows.NewLazySystemDLL("user32.dll")
+	procSendInput                     = user32.NewProc("SendInput")
+	procSetCursorPos                  = user32.NewProc("SetCursorPos")
+	procSetProcessDPIAware            = user32.NewProc("SetProcessDPIAware")
+	procSetProcessDpiAwarenessContext = user32.NewProc("SetProcessDpiAwarenessContext")
+)
+
+const (
+	// screenFrameInterval is the shortest pause between frames
+	screenFrameInterval = 100 * time.Millisecond
+
+	// screenRefreshInterval is how often an unchanged desktop is sent
+	// again, so a viewer that reconnected gets a picture
+	screenRefreshInterval = 2 * time.Second
+
+	// screenRetryDelay is the pause before the desktop is duplicated again
+	// after it was lost, e.g. while the secure desktop is shown
+	screenRetryDelay = time.Second
+)
+
+const (
+	inputMouse    = 0
+	inputKeyboard = 1
+
+	mouseEventWheel = 0x0800
+
+	keyEventExtendedKey = 0x0001
+	keyEventKeyUp       = 0x0002
+	keyEventUnicode     = 0x0004
+
+	// DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2
+	dpiAwarenessPerMonitorV2 = ^uintptr(3)
+)
+
+// mouseButtonFlags are the MOUSEEVENTF down and up flags of each button
+var mouseButtonFlags = map[string][2]uint32{
+	"left":   {0x0002, 0x0004},
+	"right":  {0x0008, 0x0010},
+	"middle": {0x0020, 0x0040},
+}
+
+// extendedKeys are virtual keys sent with KEYEVENTF_EXTENDEDKEY, without
+// which navigation keys arrive as their numeric keypad twins
+var extendedKeys = map[int]bool{
+	0x21: true, 0x22: true, 0x23: true, 0x24: true, // Page Up, Page Down, End, Home
+	0x25: true, 0x26: true, 0x27: true, 0x28: true, // arrows
+	0x2D: true, 0x2E: true, // Insert, Delete
+	0x5B: true, 0x5C: true, 0x5D: true, // Windows keys, Menu
+	0x6F: true, 0x90: true, // numeric keypad Divide, Num Lock
+	0xA3: true, 0xA5: true, // right Ctrl, right Alt
+}
+
+// INPUT. The union is declared as MOUSEINPUT, its largest member; keyboard
+// input is written over it as a KEYBDINPUT.
+type sendInputRecord struct {
+	Type  uint32
+	Mouse mouseInput
+}
+
+// MOUSEINPUT
+type mouseInput struct {
+	Dx        int32
+	Dy        int32
+	MouseData uint32
+	Flags     uint32
+	Time      uint32
+	ExtraInfo uintptr
+}
+
+// KEYBDINPUT
+type keybdInput struct {
+	VK        uint16
+	Scan      uint16
+	Flags     uint32
+	Time      uint32
+	ExtraInfo uintptr
+}
+
+// RunScreenHelper is the screen sharing helper the agent starts in the
+// user's session with -screen-helper: the agent runs in session 0 and
+// cannot see the desktop. It captures the given display (0 for all) with
+// DXGI desktop duplication and writes frame messages to stdout, and injects
+// the operator input messages read from stdin. It returns when stdin is
+// closed.
+func RunScreenHelper(monitor int) error {
+	// Stdout carries messages; log lines go to the agent through stderr
+	log.SetOutput(os.Stderr)
+	log.SetFlags(0)
+
+	// Capture and input need physical pixels, not DPI-scaled ones
+	if procSetProcessDpiAwarenessContext.Find() == nil {
+		procSetProcessDpiAwarenessContext.Call(dpiAwarenessPerMonitorV2)
+	} else {
+		procSetProcessDPIAware.Call()
+	}
+
+	helper := &screenHelper{monitor: monitor, done: make(chan struct{})}
+	go helper.readInput(os.Stdin)
+	return helper.capture(os.Stdout)
+}
+
+// screenHelper runs inside the user session
+type screenHelper struct {
+	monitor int
+	done    chan struct{} // closed when the agent closes stdin
+
+	mutex  sync.Mutex
+	origin image.Point // virtual screen position of the frame's top-left corner
+}
+
+// capture sends a frame whenever the desktop changes, at most every
+// screenFrameInterval, until the agent goes away
+func (h *screenHelper) capture(out io.Writer) error {
+	// Direct3D objects are used from one thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var duplicator *desktopDuplicator
+	defer func() {
+		if duplicator != nil {
+			duplicator.close()
+		}
+	}()
+
+	var sequence uint64
+	var lastSent time.Time
+	var lastError string
+	for {
+		wait := screenFrameInterval - time.Since(lastSent)
+		if duplicator == nil {
+			wait = 0
+		}
+		select {
+		case <-h.done:
+			return nil
+		case <-time.After(wait):
+		}
+
+		fresh := false
+		if duplicator == nil {
+			var err error
+			duplicator, err = newDesktopDuplicator(h.monitor)
+			if err != nil {
+				// Logged once per distinct error, e.g. while the lock screen is shown
+				if err.Error() != lastError {
+					log.Printf("Desktop duplication unavailable: %v", err)
+					lastError = err.Error()
+				}
+				select {
+				case <-h.done:
+					return nil
+				case <-time.After(screenRetryDelay):
+				}
+				continue
+			}
+			lastError = ""
+			fresh = true
+
+			h.mutex.Lock()
+			h.origin = duplicator.origin
+			h.mutex.Unlock()
+		}
+
+		changed, err := duplicator.capture(screenFrameInterval)
+		if err != nil {
+			if err != errDesktopLost {
+				log.Printf("Desktop capture failed: %v", err)
+			}
+			duplicator.close()
+			duplicator = nil
+			continue
+		}
+		if !changed && !fresh && time.Since(lastSent) < screenRefreshInterval {
+			continue
+		}
+
+		data, err := encodeScreenImage(duplicator.image, duplicator.pointer, duplicator.pointerVisible)
+		if err != nil {
+			log.Printf("Failed to encode frame: %v", err)
+			continue
+		}
+		frame := &ScreenFrame{
+			Sequence:   sequence,
+			CapturedAt: time.Now(),
+			Width:      duplicator.image.Rect.Dx(),
+			Height:     duplicator.image.Rect.Dy(),
+			Data:       data,
+		}
+		if err := writeScreenMessage(out, screenMessageFrame, encodeScreenFrame(frame)); err != nil {
+			return err
+		}
+		sequence++
+		lastSent = time.Now()
+	}
+}
+
+// readInput injects the input messages the agent writes until it closes stdin
+func (h *screenHelper) readInput(in io.Reader) {
+	defer close(h.done)
+
+	for {
+		kind, payload, err := readScreenMessage(in)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Failed to read input from the agent: %v", err)
+			}
+			return
+		}
+		if kind != screenMessageInput {
+			continue
+		}
+		events, err := decodeScreenInput(payload)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+
+		h.mutex.Lock()
+		origin := h.origin
+		h.mutex.Unlock()
+		for _, event := range events {
+			injectInput(event, origin)
+		}
+	}
+}
+
+// injectInput performs an operator action; coordinates are relative to
+// the frame, whose top-left corner is at origin on the virtual screen
+func injectInput(event RemoteInputEvent, origin image.Point) {
+	x, y := origin.X+event.X, origin.Y+event.Y
+
+	switch event.Type {
+	case "mouse_move":
+		procSetCursorPos.Call(uintptr(x), uintptr(y))
+	case "mouse_down", "mouse_up":
+		flags, ok := mouseButtonFlags[event.Button]
+		if !ok {
+			return
+		}
+		procSetCursorPos.Call(uintptr(x), uintptr(y))
+		flag := flags[0]
+		if event.Type == "mouse_up" {
+			flag = flags[1]
+		}
+		sendInputs([]sendInputRecord{{Type: inputMouse, Mouse: mouseInput{Flags: flag}}})
+	case "wheel":
+		sendInputs([]sendInputRecord{{Type: inputMouse, Mouse: mouseInput{Flags: mouseEventWheel, MouseData: uint32(int32(event.Delta))}}})
+	case "key_down", "key_up":
+		if event.KeyCode <= 0 || event.KeyCode > 0xFE {
+			return
+		}
+		var flags uint32
+		if event.Type == "key_up" {
+			flags |= keyEventKeyUp
+		}
+		if extendedKeys[event.KeyCode] {
+			flags |= keyEventExtendedKey
+		}
+		sendInputs([]sendInputRecord{keyboardRecord(uint16(event.KeyCode), 0, flags)})
+	case "text":
+		var records []sendInputRecord
+		for _, unit := range windows.StringToUTF16(event.Text) {
+			if unit == 0 {
+				continue
+			}
+			records = append(records,
+				keyboardRecord(0, unit, keyEventUnicode),
+				keyboardRecord(0, unit, keyEventUnicode|keyEventKeyUp))
+		}
+		sendInputs(records)
+	}
+}
+
+// keyboardRecord builds an INPUT holding a KEYBDINPUT
+func keyboardRecord(vk, scan uint16, flags uint32) sendInputRecord {
+	record := sendInputRecord{Type: inputKeyboard}
+	*(*keybdInput)(unsafe.Pointer(&record.Mouse)) = keybdInput{VK: vk, Scan: scan, Flags: flags}
+	return record
+}
+
+// sendInputs queues input records; it fails silently while the secure
+// desktop is shown
+func sendInputs(records []sendInputRecord) {
+	if len(records) == 0 {
+		return
+	}
+	procSendInput.Call(uintptr(len(records)), uintptr(unsafe.Pointer(&records[0])), unsafe.Sizeof(records[0]))
+}
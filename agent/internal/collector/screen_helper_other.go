@@ -0,0 +1,10 @@
+//go:build !windows
+
+package collector
+
+import "fmt"
+
+// RunScreenHelper is only available on Windows
+func RunScreenHelper(monitor int) error {
+	return fmt.Errorf("screen sharing is only supported on Windows")
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+)
+
+// DXGI_MODE_ROTATION of a display
+const (
+	dxgiRotationRotate90  = 2
+	dxgiRotationRotate180 = 3
+	dxgiRotationRotate270 = 4
+)
+
+// screenJPEGQuality trades picture quality for relay bandwidth
+const screenJPEGQuality = 60
+
+// pointerShape is drawn where the mouse pointer is, since duplicated
+// desktop surfaces do not include it: X is black, . is white
+var pointerShape = []string{
+	"X",
+	"XX",
+	"X.X",
+	"X..X",
+	"X...X",
+	"X....X",
+	"X.....X",
+	"X......X",
+	"X.......X",
+	"X........X",
+	"X.....XXXXX",
+	"X..X..X",
+	"X.X X..X",
+	"XX  X..X",
+	"X    X..X",
+	"     X..X",
+	"      XX",
+}
+
+// copyDesktopPixels copies a BGRA surface of a display into its bounds in
+// img. Surfaces of rotated displays are in the display's native, unrotated
+// orientation and are turned upright here.
+func copyDesktopPixels(img *image.RGBA, bounds image.Rectangle, rotation uint32, src []byte, width, height, pitch int) {
+	// Source pixel for the pixel (x, y) within bounds
+	source := func(x, y int) (int, int) { return x, y }
+	switch rotation {
+	case dxgiRotationRotate90:
+		source = func(x, y int) (int, int) { return y, height - 1 - x }
+	case dxgiRotationRotate180:
+		source = func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }
+	case dxgiRotationRotate270:
+		source = func(x, y int) (int, int) { return width - 1 - y, x }
+	}
+
+	if !bounds.In(img.Rect) {
+		return
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		row := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		for x := 0; x < bounds.Dx(); x++ {
+			sx, sy := source(x, y)
+			if sx < 0 || sy < 0 || sx >= width || sy >= height {
+				continue
+			}
+			i := sy*pitch + sx*4
+			row[x*4] = src[i+2]
+			row[x*4+1] = src[i+1]
+			row[x*4+2] = src[i]
+			row[x*4+3] = 0xff
+		}
+	}
+}
+
+// encodeScreenImage encodes the desktop as JPEG with the pointer drawn at
+// pointer, if visible. The pointer is removed from img again afterwards.
+func encodeScreenImage(img *image.RGBA, pointer image.Point, pointerVisible bool) ([]byte, error) {
+	if pointerVisible {
+		restore := drawPointer(img, pointer)
+		defer restore()
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: screenJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawPointer draws pointerShape with its tip at p and returns a function
+// restoring the pixels it covered
+func drawPointer(img *image.RGBA, p image.Point) func() {
+	area := image.Rect(p.X, p.Y, p.X+len(pointerShape[10]), p.Y+len(pointerShape)).Intersect(img.Rect)
+	saved := image.NewRGBA(area)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		copy(saved.Pix[saved.PixOffset(area.Min.X, y):saved.PixOffset(area.Max.X, y)],
+			img.Pix[img.PixOffset(area.Min.X, y):img.PixOffset(area.Max.X, y)])
+	}
+
+	for dy, line := range pointerShape {
+		for dx, c := range line {
+			x, y := p.X+dx, p.Y+dy
+			if !(image.Point{x, y}).In(img.Rect) || c == ' ' {
+				continue
+			}
+			value := byte(0x00)
+			if c == '.' {
+				value = 0xff
+			}
+			i := img.PixOffset(x, y)
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = value, value, value, 0xff
+		}
+	}
+
+	return func() {
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			copy(img.Pix[img.PixOffset(area.Min.X, y):img.PixOffset(area.Max.X, y)],
+				saved.Pix[saved.PixOffset(area.Min.X, y):saved.PixOffset(area.Max.X, y)])
+		}
+	}
+}
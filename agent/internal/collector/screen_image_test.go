@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// TestCopyDesktopPixels checks that BGRA surfaces are converted and that
+// surfaces of rotated displays are turned upright. The surface is 3x2 in
+// the display's native orientation; each pixel's blue value is its index.
+func TestCopyDesktopPixels(t *testing.T) {
+	const width, height, pitch = 3, 2, 16 // rows padded as Direct3D does
+	src := make([]byte, pitch*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*pitch + x*4
+			src[i], src[i+1], src[i+2] = byte(y*width+x), 0x80, 0x40
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rotation uint32
+		bounds   image.Rectangle
+		want     [][]byte // blue values of the upright image, by row
+	}{
+		{name: "identity", rotation: 1, bounds: image.Rect(0, 0, 3, 2), want: [][]byte{{0, 1, 2}, {3, 4, 5}}},
+		{name: "rotate 90", rotation: dxgiRotationRotate90, bounds: image.Rect(0, 0, 2, 3), want: [][]byte{{3, 0}, {4, 1}, {5, 2}}},
+		{name: "rotate 180", rotation: dxgiRotationRotate180, bounds: image.Rect(0, 0, 3, 2), want: [][]byte{{5, 4, 3}, {2, 1, 0}}},
+		{name: "rotate 270", rotation: dxgiRotationRotate270, bounds: image.Rect(0, 0, 2, 3), want: [][]byte{{2, 5}, {1, 4}, {0, 3}}},
+		{name: "second display", rotation: 1, bounds: image.Rect(1, 1, 4, 3), want: [][]byte{{0, 1, 2}, {3, 4, 5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+			copyDesktopPixels(img, tt.bounds, tt.rotation, src, width, height, pitch)
+
+			for y, row := range tt.want {
+				for x, blue := range row {
+					c := img.RGBAAt(tt.bounds.Min.X+x, tt.bounds.Min.Y+y)
+					if c.B != blue || c.G != 0x80 || c.R != 0x40 || c.A != 0xff {
+						t.Errorf("pixel (%d,%d) = %v, want blue %d from the surface", x, y, c, blue)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestEncodeScreenImage checks that the pointer is drawn into the frame
+// only, not into the desktop image kept for the next frame
+func TestEncodeScreenImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	original := append([]byte(nil), img.Pix...)
+
+	for _, pointer := range []image.Point{{10, 10}, {60, 40}, {-5, -5}} {
+		if _, err := encodeScreenImage(img, pointer, true); err != nil {
+			t.Fatalf("encodeScreenImage() error = %v", err)
+		}
+		if !bytes.Equal(img.Pix, original) {
+			t.Fatalf("pointer at %v left in the desktop image", pointer)
+		}
+	}
+
+	restore := drawPointer(img, image.Pt(10, 10))
+	if c := img.RGBAAt(10, 10); c.R != 0 || c.A != 0xff {
+		t.Errorf("pointer tip = %v, want black", c)
+	}
+	if c := img.RGBAAt(10, 12); c.R != 0 {
+		t.Errorf("pointer edge = %v, want black", c)
+	}
+	if c := img.RGBAAt(11, 12); c.R != 0xff {
+		t.Errorf("pointer fill = %v, want white", c)
+	}
+	restore()
+	if !bytes.Equal(img.Pix, original) {
+		t.Error("restore did not bring back the desktop image")
+	}
+}
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Screen sharing messages. The same framing is used on the relay's screen
+// channel and on the pipes between the agent and the capture helper in the
+// user session: a type byte, the payload length as a big-endian uint32, and
+// the payload.
+const (
+	// screenMessageFrame carries a ScreenFrame, helper -> agent -> relay
+	screenMessageFrame byte = 1
+
+	// screenMessageInput carries a JSON array of RemoteInputEvent,
+	// relay -> agent -> helper
+	screenMessageInput byte = 2
+
+	// screenMaxMessage bounds a message; a JPEG of an 8K desktop fits
+	screenMaxMessage = 16 * 1024 * 1024
+
+	// screenFrameHeader is the size of a frame's header: sequence, capture
+	// time in Unix milliseconds, width and height
+	screenFrameHeader = 8 + 8 + 4 + 4
+)
+
+// ScreenFrame is one captured desktop image
+type ScreenFrame struct {
+	Sequence   uint64
+	CapturedAt time.Time
+	Width      int
+	Height     int
+	Data       []byte // JPEG
+}
+
+// writeScreenMessage writes one message in a single Write, so that
+// messages from several goroutines do not interleave
+func writeScreenMessage(w io.Writer, kind byte, payload []byte) error {
+	if len(payload) > screenMaxMessage {
+		return fmt.Errorf("screen message of %d bytes exceeds %d", len(payload), screenMaxMessage)
+	}
+	buf := make([]byte, 5+len(payload))
+	buf[0] = kind
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readScreenMessage reads one message. io.EOF is returned only when the
+// stream ends between messages.
+func readScreenMessage(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > screenMaxMessage {
+		return 0, nil, fmt.Errorf("screen message of %d bytes exceeds %d", size, screenMaxMessage)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// encodeScreenFrame builds the payload of a frame message
+func encodeScreenFrame(frame *ScreenFrame) []byte {
+	buf := make([]byte, screenFrameHeader+len(frame.Data))
+	binary.BigEndian.PutUint64(buf[0:], frame.Sequence)
+	binary.BigEndian.PutUint64(buf[8:], uint64(frame.CapturedAt.UnixMilli()))
+	binary.BigEndian.PutUint32(buf[16:], uint32(frame.Width))
+	binary.BigEndian.PutUint32(buf[20:], uint32(frame.Height))
+	copy(buf[screenFrameHeader:], frame.Data)
+	return buf
+}
+
+// decodeScreenFrame parses the payload of a frame message
+func decodeScreenFrame(payload []byte) (*ScreenFrame, error) {
+	if len(payload) <= screenFrameHeader {
+		return nil, fmt.Errorf("screen frame of %d bytes is too short", len(payload))
+	}
+	frame := &ScreenFrame{
+		Sequence:   binary.BigEndian.Uint64(payload[0:]),
+		CapturedAt: time.UnixMilli(int64(binary.BigEndian.Uint64(payload[8:]))),
+		Width:      int(binary.BigEndian.Uint32(payload[16:])),
+		Height:     int(binary.BigEndian.Uint32(payload[20:])),
+		Data:       payload[screenFrameHeader:],
+	}
+	if frame.Width <= 0 || frame.Height <= 0 || frame.Width > 1<<15 || frame.Height > 1<<15 {
+		return nil, fmt.Errorf("invalid screen frame size %dx%d", frame.Width, frame.Height)
+	}
+	return frame, nil
+}
+
+// decodeScreenInput parses the payload of an input message
+func decodeScreenInput(payload []byte) ([]RemoteInputEvent, error) {
+	var events []RemoteInputEvent
+	if err := json.Unmarshal(payload, &events); err != nil {
+		return nil, fmt.Errorf("invalid remote input: %w", err)
+	}
+	return events, nil
+}
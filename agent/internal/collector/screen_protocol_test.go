@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestScreenMessages checks that messages written back to back are read
+// back whole, and that broken streams are reported
+func TestScreenMessages(t *testing.T) {
+	frame := &ScreenFrame{
+		Sequence:   7,
+		CapturedAt: time.UnixMilli(1700000000123),
+		Width:      1920,
+		Height:     1080,
+		Data:       []byte("jpeg"),
+	}
+
+	tests := []struct {
+		name    string
+		stream  func() []byte
+		want    []byte // message types read before the error
+		wantErr error  // nil for any error other than io.EOF
+	}{
+		{
+			name: "frame and input",
+			stream: func() []byte {
+				var buf bytes.Buffer
+				writeScreenMessage(&buf, screenMessageFrame, encodeScreenFrame(frame))
+				writeScreenMessage(&buf, screenMessageInput, []byte(`[{"type":"key_down","key_code":65}]`))
+				return buf.Bytes()
+			},
+			want:    []byte{screenMessageFrame, screenMessageInput},
+			wantErr: io.EOF,
+		},
+		{
+			name: "empty payload",
+			stream: func() []byte {
+				var buf bytes.Buffer
+				writeScreenMessage(&buf, screenMessageInput, nil)
+				return buf.Bytes()
+			},
+			want:    []byte{screenMessageInput},
+			wantErr: io.EOF,
+		},
+		{
+			name: "truncated payload",
+			stream: func() []byte {
+				var buf bytes.Buffer
+				writeScreenMessage(&buf, screenMessageFrame, encodeScreenFrame(frame))
+				return buf.Bytes()[:buf.Len()-1]
+			},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "oversize length",
+			stream: func() []byte {
+				header := []byte{screenMessageFrame, 0, 0, 0, 0}
+				binary.BigEndian.PutUint32(header[1:], screenMaxMessage+1)
+				return header
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.stream())
+			var got []byte
+			var err error
+			for {
+				var kind byte
+				if kind, _, err = readScreenMessage(r); err != nil {
+					break
+				}
+				got = append(got, kind)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("read message types %v, want %v", got, tt.want)
+			}
+			if tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (err == nil || err == io.EOF) {
+				t.Errorf("error = %v, want a format error", err)
+			}
+		})
+	}
+}
+
+// TestScreenFrameEncoding checks that frames survive the trip through the
+// message payload and that malformed frames from the helper are refused
+func TestScreenFrameEncoding(t *testing.T) {
+	frame := &ScreenFrame{
+		Sequence:   42,
+		CapturedAt: time.UnixMilli(1700000000123),
+		Width:      2560,
+		Height:     1440,
+		Data:       []byte{0xff, 0xd8, 0xff, 0xd9},
+	}
+	decoded, err := decodeScreenFrame(encodeScreenFrame(frame))
+	if err != nil {
+		t.Fatalf("decodeScreenFrame() error = %v", err)
+	}
+	if !decoded.CapturedAt.Equal(frame.CapturedAt) {
+		t.Errorf("captured at %v, want %v", decoded.CapturedAt, frame.CapturedAt)
+	}
+	decoded.CapturedAt = frame.CapturedAt
+	if !reflect.DeepEqual(decoded, frame) {
+		t.Errorf("decoded %+v, want %+v", decoded, frame)
+	}
+
+	invalid := []struct {
+		name  string
+		frame *ScreenFrame
+	}{
+		{name: "no image", frame: &ScreenFrame{Width: 10, Height: 10}},
+		{name: "zero width", frame: &ScreenFrame{Height: 10, Data: []byte{1}}},
+		{name: "too high", frame: &ScreenFrame{Width: 10, Height: 1 << 16, Data: []byte{1}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeScreenFrame(encodeScreenFrame(tt.frame)); err == nil {
+				t.Error("decodeScreenFrame() accepted an invalid frame")
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+//go:build windows
+
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// screenHelperStopTimeout is how long the helper has to exit once its input is closed
+	screenHelperStopTimeout = 5 * time.Second
+
+	// screenRelayWriteTimeout bounds sending one frame; a relay connection
+	// that stalls longer is re-established
+	screenRelayWriteTimeout = 30 * time.Second
+)
+
+// ScreenStream streams the user's desktop to the operator and injects the
+// operator's input. The agent runs in session 0 and cannot see the desktop,
+// so capture and input run in the agent's own screen helper (-screen-helper)
+// started in the user session, whose standard streams are pipes to the
+// agent. The agent keeps a persistent TLS connection to the SIEM relay for
+// the session, forwards the helper's frames on it and passes the operator's
+// input back to the helper.
+type ScreenStream struct {
+	sessionGUID string
+	agentID     string
+	relayAddr   string
+	token       string
+	tlsConfig   *tls.Config
+	helper      *sessionProcess
+	exited      chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex          sync.Mutex
+	relay          net.Conn // nil while reconnecting
+	lastInput      time.Time
+	viewOnly       bool
+	controlPending bool
+
+	onControlRequest func()
+}
+
+// StartScreenStream starts capturing the desktop of the given user (or of
+// the console session if userName is empty) and streams it through the
+// relay at relayAddr. monitor selects a single display by its 1-based
+// number; 0 or a number that does not exist streams every display. In
+// view-only mode operator input is discarded.
+func StartScreenStream(sessionGUID, agentID, relayAddr, token, userName string, monitor int, viewOnly, insecureSkipVerify bool) (*ScreenStream, error) {
+	if relayAddr == "" {
+		return nil, fmt.Errorf("no relay address in the session request")
+	}
+	tlsConfig, err := relayTLSConfig(relayAddr, insecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID := FindUserSession(userName)
+	if sessionID == noSession {
+		return nil, fmt.Errorf("no interactive user session")
+	}
+	owner := sessionAccount(sessionID)
+	if owner == "" {
+		return nil, fmt.Errorf("no user logged on to session %d", sessionID)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the agent executable: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &ScreenStream{
+		sessionGUID: sessionGUID,
+		agentID:     agentID,
+		relayAddr:   relayAddr,
+		token:       token,
+		tlsConfig:   tlsConfig,
+		exited:      make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		viewOnly:    viewOnly,
+	}
+
+	relay, err := stream.dial()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to connect to relay %s: %w", relayAddr, err)
+	}
+	stream.relay = relay
+
+	stream.helper, err = startInSession(sessionID, fmt.Sprintf(`"%s" -screen-helper -monitor %d`, exe, monitor))
+	if err != nil {
+		cancel()
+		relay.Close()
+		return nil, err
+	}
+
+	stream.wg.Add(3)
+	go stream.sendFrames()
+	go stream.relayInput(relay)
+	go stream.logHelper()
+
+	log.Printf("✓ Screen streaming started for session %s through %s (user %s, monitor %d, view-only %v)",
+		sessionGUID, relayAddr, owner, monitor, viewOnly)
+	return stream, nil
+}
+
+// Stop closes the relay connection and ends the helper in the user session
+func (s *ScreenStream) Stop() {
+	s.cancel()
+
+	s.mutex.Lock()
+	if s.relay != nil {
+		s.relay.Close()
+	}
+	s.mutex.Unlock()
+
+	s.helper.stop(screenHelperStopTimeout)
+	s.wg.Wait()
+
+	log.Printf("Screen streaming stopped for session %s", s.sessionGUID)
+}
+
+// Exited is closed when the helper in the user session has exited, e.g.
+// because the user logged off
+func (s *ScreenStream) Exited() <-chan struct{} {
+	return s.exited
+}
+
+// LastInput returns when operator input was last received
+func (s *ScreenStream) LastInput() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastInput
+}
+
+// ViewOnly reports whether operator input is currently discarded
+func (s *ScreenStream) ViewOnly() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.viewOnly
+}
+
+// SetViewOnly hands input control to the operator or takes it back, and
+// allows the operator to ask for control again
+func (s *ScreenStream) SetViewOnly(viewOnly bool) {
+	s.mutex.Lock()
+	s.viewOnly = viewOnly
+	s.controlPending = false
+	s.mutex.Unlock()
+
+	log.Printf("Screen streaming for session %s: view-only %v", s.sessionGUID, viewOnly)
+}
+
+// SetControlRequestHandler sets the function called when the operator of a
+// view-only stream asks for input control. It runs in its own goroutine and
+// is called again only after SetViewOnly has settled the previous request.
+func (s *ScreenStream) SetControlRequestHandler(onControlRequest func()) {
+	s.mutex.Lock()
+	s.onControlRequest = onControlRequest
+	s.mutex.Unlock()
+}
+
+// filterInput drops input the operator is not allowed to send and
+// dispatches control requests
+func (s *ScreenStream) filterInput(events []RemoteInputEvent) []RemoteInputEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var allowed []RemoteInputEvent
+	for _, event := range events {
+		if event.Type == "request_control" {
+			if s.viewOnly && !s.controlPending && s.onControlRequest != nil {
+				s.controlPending = true
+				go s.onControlRequest()
+			}
+			continue
+		}
+		if !s.viewOnly {
+			allowed = append(allowed, event)
+		}
+	}
+	return allowed
+}
+
+// dial opens the session's screen connection to the relay
+func (s *ScreenStream) dial() (net.Conn, error) {
+	return dialRelay(s.ctx, s.relayAddr, s.tlsConfig, relayHello{
+		Role:        "screen",
+		SessionGUID: s.sessionGUID,
+		Token:       s.token,
+		AgentID:     s.agentID,
+	})
+}
+
+// sendFrames forwards the helper's frames to the relay. Frames are dropped
+// while the relay is reconnecting; while it is slow the helper waits, so
+// the frame rate adapts to the relay's bandwidth.
+func (s *ScreenStream) sendFrames() {
+	defer s.wg.Done()
+	defer close(s.exited)
+
+	for {
+		kind, payload, err := readScreenMessage(s.helper.stdout)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				log.Printf("Screen helper for session %s exited: %v", s.sessionGUID, err)
+			}
+			return
+		}
+		if kind != screenMessageFrame {
+			continue
+		}
+		// The helper runs as the user; pass on only well-formed frames
+		if _, err := decodeScreenFrame(payload); err != nil {
+			log.Printf("Invalid frame from screen helper for session %s: %v", s.sessionGUID, err)
+			continue
+		}
+
+		s.mutex.Lock()
+		relay := s.relay
+		s.mutex.Unlock()
+		if relay == nil {
+			continue
+		}
+
+		relay.SetWriteDeadline(time.Now().Add(screenRelayWriteTimeout))
+		if err := writeScreenMessage(relay, screenMessageFrame, payload); err != nil {
+			// relayInput notices the closed connection and reconnects
+			relay.Close()
+		}
+	}
+}
+
+// relayInput passes operator input from the relay to the helper and
+// re-establishes the relay connection when it drops, until Stop
+func (s *ScreenStream) relayInput(relay net.Conn) {
+	defer s.wg.Done()
+
+	for {
+		err := s.readInput(relay)
+		relay.Close()
+
+		s.mutex.Lock()
+		s.relay = nil
+		s.mutex.Unlock()
+
+		if s.ctx.Err() != nil {
+			return
+		}
+		log.Printf("Screen relay connection for session %s lost: %v", s.sessionGUID, err)
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(relayReconnectDelay):
+			}
+
+			relay, err = s.dial()
+			if err == nil {
+				break
+			}
+			log.Printf("Error reconnecting screen relay for session %s: %v", s.sessionGUID, err)
+		}
+
+		s.mutex.Lock()
+		if s.ctx.Err() != nil {
+			s.mutex.Unlock()
+			relay.Close()
+			return
+		}
+		s.relay = relay
+		s.mutex.Unlock()
+	}
+}
+
+// readInput reads input messages from one relay connection until it ends
+func (s *ScreenStream) readInput(relay net.Conn) error {
+	for {
+		kind, payload, err := readScreenMessage(relay)
+		if err != nil {
+			return err
+		}
+		if kind != screenMessageInput {
+			continue
+		}
+		events, err := decodeScreenInput(payload)
+		if err != nil {
+			log.Printf("Screen relay for session %s: %v", s.sessionGUID, err)
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+
+		s.mutex.Lock()
+		s.lastInput = time.Now()
+		s.mutex.Unlock()
+
+		events = s.filterInput(events)
+		if len(events) == 0 {
+			continue
+		}
+		data, err := json.Marshal(events)
+		if err != nil {
+			continue
+		}
+		if err := writeScreenMessage(s.helper.stdin, screenMessageInput, data); err != nil && s.ctx.Err() == nil {
+			log.Printf("Error passing remote input to the screen helper: %v", err)
+		}
+	}
+}
+
+// logHelper writes the helper's diagnostics to the agent log
+func (s *ScreenStream) logHelper() {
+	defer s.wg.Done()
+
+	scanner := bufio.NewScanner(s.helper.stderr)
+	for scanner.Scan() {
+		log.Printf("Screen helper for session %s: %s", s.sessionGUID, scanner.Text())
+	}
+	io.Copy(io.Discard, s.helper.stderr)
+}
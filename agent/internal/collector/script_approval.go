@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Exit code reported for executions that were not approved
+const scriptApprovalExitCode = -5
+
+// Approval modes for scripts at or above the configured risk level
+const (
+	ScriptApprovalLocal  = "local"           // a logged-on local administrator confirms
+	ScriptApprovalServer = "second_approver" // a second operator approved on the server
+	ScriptApprovalAny    = "any"             // either of the above
+)
+
+// scriptRiskLevel returns the risk level the approval gate uses: the
+// server's rating, raised to approval_risk_level for scripts that run as
+// SYSTEM, as a service account or as a named user. The risk level and
+// approver are part of the signed envelope; the floor keeps a compromised
+// signing workflow from rating privileged scripts below the gate.
+func scriptRiskLevel(script *PendingScript, cfg *config.ScriptExecutionConfig) int {
+	risk := script.RiskLevel
+	privileged := script.RunAs == "" || script.RunAs == ScriptRunAsSystem ||
+		script.RunAs == ScriptRunAsAccount || script.TargetUser != "" || script.RequiresAdmin
+	if privileged && risk < cfg.ApprovalRiskLevel {
+		risk = cfg.ApprovalRiskLevel
+	}
+	return risk
+}
+
+// checkApproval enforces the approval gate for high-risk scripts. A server
+// approval only counts if it was given by someone other than the requester.
+func (e *ScriptExecutor) checkApproval(ctx context.Context, script *PendingScript) error {
+	cfg := &e.config.ScriptExecution
+	risk := scriptRiskLevel(script, cfg)
+	if cfg.ApprovalRiskLevel <= 0 || risk < cfg.ApprovalRiskLevel {
+		return nil
+	}
+
+	if cfg.ApprovalMode != ScriptApprovalLocal && script.ApprovedBy != "" &&
+		!strings.EqualFold(script.ApprovedBy, script.RequestedBy) {
+		log.Printf("Script execution %s (risk %d) approved on the server by %s",
+			script.ExecutionGUID, risk, script.ApprovedBy)
+		return nil
+	}
+
+	if cfg.ApprovalMode == ScriptApprovalServer {
+		return fmt.Errorf("risk level %d requires approval by a second operator", risk)
+	}
+
+	log.Printf("Script execution %s (risk %d) waiting for local confirmation", script.ExecutionGUID, risk)
+	user, err := confirmScriptLocally(ctx, script, risk, time.Duration(cfg.ApprovalTimeout)*time.Second)
+	if err != nil {
+		return fmt.Errorf("risk level %d requires local confirmation: %w", risk, err)
+	}
+
+	log.Printf("✓ Script execution %s confirmed locally by %s", script.ExecutionGUID, user)
+	return nil
+}
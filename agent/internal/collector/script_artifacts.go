@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// scriptOutputEnv names the directory a script can drop files into; its
+// contents are uploaded with the execution result
+const scriptOutputEnv = "SIEM_OUTPUT_DIR"
+
+// ScriptArtifacts is the compressed content of a script's output directory
+type ScriptArtifacts struct {
+	FileName  string `json:"file_name"`
+	FileCount int    `json:"file_count"`
+	Size      int64  `json:"size"` // compressed
+	SHA256    string `json:"sha256"`
+	Data      []byte `json:"data"` // zip archive
+}
+
+// collectArtifacts zips the regular files in dir. Symlinks and other
+// special files are skipped so a script cannot point the agent at files
+// outside the directory. It returns nil if the directory is empty.
+func collectArtifacts(dir, executionGUID string, maxBytes int64) (*ScriptArtifacts, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	count := 0
+	var total int64
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		if total > maxBytes {
+			return fmt.Errorf("output exceeds %d bytes", maxBytes)
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		header.Method = zip.Deflate
+
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect script output: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress script output: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return &ScriptArtifacts{
+		FileName:  fmt.Sprintf("script_output_%s.zip", executionGUID),
+		FileCount: count,
+		Size:      int64(buf.Len()),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Data:      buf.Bytes(),
+	}, nil
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// confirmScriptLocally asks a logged-on local administrator to allow a
+// script execution at the given risk level and returns who allowed it
+func confirmScriptLocally(ctx context.Context, script *PendingScript, risk int, timeout time.Duration) (string, error) {
+	name := script.ScriptName
+	if name == "" {
+		name = script.ScriptType
+	}
+
+	prompt := consentPrompt{
+		key:   script.ExecutionGUID,
+		title: "Запрос на выполнение скрипта",
+		message: fmt.Sprintf(
+			"Администратор %s запрашивает выполнение скрипта на этом компьютере.\n\n"+
+				"Скрипт: %s\nУровень риска: %d\n\n"+
+				"Разрешить выполнение?",
+			script.RequestedBy, name, risk,
+		),
+		timeout:    timeout,
+		adminsOnly: true,
+	}
+
+	answer, user, shown := promptUsers(ctx, prompt)
+	switch {
+	case !shown:
+		return "", fmt.Errorf("no local administrator logged on to confirm")
+	case answer == "accept":
+		return user, nil
+	case answer == "decline":
+		return "", fmt.Errorf("declined by %s", user)
+	}
+	return "", fmt.Errorf("not confirmed within %v", timeout)
+}
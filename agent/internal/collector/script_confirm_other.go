@@ -0,0 +1,14 @@
+//go:build !windows
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// confirmScriptLocally is not available without the Windows session helper
+func confirmScriptLocally(ctx context.Context, script *PendingScript, risk int, timeout time.Duration) (string, error) {
+	return "", fmt.Errorf("local confirmation is only supported on Windows")
+}
@@ -6,53 +6,113 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"sync"
 	"time"
 
-	"siem-agent/internal/config"
+	"github.com/google/uuid"
+
+	"github.com/siem/agent/internal/config"
 )
 
 // ScriptExecutor handles remote script execution from SIEM server
 type ScriptExecutor struct {
 	config     *config.Config
+	agentID    string
 	httpClient *http.Client
+
+	mutex   sync.Mutex
+	queue   []*PendingScript              // highest priority first
+	running map[string]context.CancelFunc // by execution GUID
+	wg      sync.WaitGroup
+}
+
+// Script user contexts
+const (
+	ScriptRunAsSystem  = "system"  // the agent service account (default)
+	ScriptRunAsUser    = "user"    // the interactive user, for HKCU and profile changes
+	ScriptRunAsAccount = "account" // a service account from the agent configuration
+)
+
+// PendingScripts is the server's list of queued executions and of
+// executions to cancel. Older servers return a single PendingScript.
+type PendingScripts struct {
+	PendingScript
+	Scripts []PendingScript `json:"scripts,omitempty"`
+	Cancel  []string        `json:"cancel,omitempty"` // execution GUIDs
 }
 
 // PendingScript represents a script waiting to be executed
 type PendingScript struct {
 	HasPending    bool              `json:"has_pending"`
 	ExecutionGUID string            `json:"execution_guid"`
-	ScriptType    string            `json:"script_type"`
-	ScriptContent string            `json:"script_content"`
+	Priority      int               `json:"priority,omitempty"` // higher runs first
+	ScriptName    string            `json:"script_name,omitempty"`
+	RequestedBy   string            `json:"requested_by,omitempty"`
+	RiskLevel     int               `json:"risk_level,omitempty"`  // compared with script_execution.approval_risk_level
+	ApprovedBy    string            `json:"approved_by,omitempty"` // second operator who approved on the server
+	ScriptType    string            `json:"script_type"`           // powershell, batch, python, bash or sh
+	ScriptContent string            `json:"script_content"`        // empty for library scripts
+	ScriptID      string            `json:"script_id,omitempty"`   // library script, cached by the agent
+	ScriptHash    string            `json:"script_hash,omitempty"` // SHA256 of the library script body
 	Parameters    map[string]string `json:"parameters"`
 	RequiresAdmin bool              `json:"requires_admin"`
 	Timeout       int               `json:"timeout"`
+	Signature     string            `json:"signature"`                // base64 Ed25519 signature of the execution envelope
+	TargetAgentID string            `json:"target_agent_id"`          // signed; must be this agent
+	ExpiresAt     time.Time         `json:"expires_at"`               // signed; the script does not start after it
+	RunAs         string            `json:"run_as,omitempty"`         // "system" (default), "user" or "account"
+	TargetUser    string            `json:"target_user,omitempty"`    // run_as=user: DOMAIN\user, empty for the console user
+	RunAsAccount  string            `json:"run_as_account,omitempty"` // run_as=account: name from script_execution.service_accounts
+	MaxMemoryMB   int               `json:"max_memory_mb,omitempty"`  // Job Object limits; 0 uses the agent default
+	MaxCPUPercent int               `json:"max_cpu_percent,omitempty"`
+	MaxProcesses  int               `json:"max_processes,omitempty"`
+
+	SuccessCriteria *ScriptSuccessCriteria `json:"success_criteria,omitempty"` // nil: only exit code 0 passes
 }
 
 // ExecutionResult represents the result of a script execution
 type ExecutionResult struct {
-	ExitCode    int    `json:"exit_code"`
-	Output      string `json:"output"`
-	ErrorOutput string `json:"error_output"`
-	DurationMs  int64  `json:"duration_ms"`
+	ExitCode    int              `json:"exit_code"`
+	Output      string           `json:"output"`
+	ErrorOutput string           `json:"error_output"`
+	DurationMs  int64            `json:"duration_ms"`
+	Artifacts   *ScriptArtifacts `json:"artifacts,omitempty"` // files the script left in SIEM_OUTPUT_DIR
+
+	Verdict       string `json:"verdict"`                  // "pass" or "fail", from the script's success criteria
+	VerdictReason string `json:"verdict_reason,omitempty"` // why the execution failed
 }
 
-// NewScriptExecutor creates a new script executor
-func NewScriptExecutor(cfg *config.Config) *ScriptExecutor {
+// parseExecutionGUID validates an execution GUID from the server and
+// returns its canonical form, the only form file names are derived from
+func parseExecutionGUID(executionGUID string) (string, error) {
+	id, err := uuid.Parse(executionGUID)
+	if err != nil {
+		return "", fmt.Errorf("invalid execution GUID %q", executionGUID)
+	}
+	return id.String(), nil
+}
+
+// NewScriptExecutor creates a new script executor; requests for the SIEM
+// server are authenticated through transport
+func NewScriptExecutor(cfg *config.Config, agentID string, transport ServerTransport) *ScriptExecutor {
 	return &ScriptExecutor{
-		config: cfg,
+		config:  cfg,
+		agentID: agentID,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport(nil),
 		},
+		running: make(map[string]context.CancelFunc),
 	}
 }
 
-// Start begins the script execution polling loop
+// Start begins the script execution polling loop. Running scripts are
+// killed when ctx is cancelled.
 func (e *ScriptExecutor) Start(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
@@ -60,16 +120,18 @@ func (e *ScriptExecutor) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			e.wg.Wait()
 			return
 		case <-ticker.C:
-			e.checkAndExecutePendingScripts()
+			e.checkAndExecutePendingScripts(ctx)
 		}
 	}
 }
 
-// checkAndExecutePendingScripts polls server for pending scripts and executes them
-func (e *ScriptExecutor) checkAndExecutePendingScripts() {
-	url := fmt.Sprintf("%s/ad/scripts/executions/pending/%s", e.config.ServerURL, e.config.AgentID)
+// checkAndExecutePendingScripts polls server for pending scripts, queues
+// them and starts as many as the concurrency limit allows
+func (e *ScriptExecutor) checkAndExecutePendingScripts(ctx context.Context) {
+	url := fmt.Sprintf("%s/ad/scripts/executions/pending/%s", e.config.SIEM.APIURL, e.agentID)
 
 	resp, err := e.httpClient.Get(url)
 	if err != nil {
@@ -82,88 +144,124 @@ func (e *ScriptExecutor) checkAndExecutePendingScripts() {
 		return
 	}
 
-	var pending PendingScript
+	var pending PendingScripts
 	if err := json.Unmarshal(body, &pending); err != nil {
 		return
 	}
 
-	if !pending.HasPending {
-		return
+	for _, executionGUID := range pending.Cancel {
+		e.Cancel(executionGUID)
 	}
 
-	// Execute the script
-	result := e.executeScript(&pending)
+	scripts := pending.Scripts
+	if len(scripts) == 0 && pending.HasPending {
+		scripts = []PendingScript{pending.PendingScript}
+	}
+	for i := range scripts {
+		e.enqueueScript(&scripts[i])
+	}
 
-	// Report result back to server
-	e.reportResult(pending.ExecutionGUID, result)
+	e.dispatch(ctx)
 }
 
-// executeScript executes a script and returns the result
-func (e *ScriptExecutor) executeScript(script *PendingScript) *ExecutionResult {
+// executeScript executes a script and returns the result. Cancelling ctx
+// kills the script.
+func (e *ScriptExecutor) executeScript(parent context.Context, script *PendingScript) *ExecutionResult {
 	startTime := time.Now()
 	result := &ExecutionResult{}
 
-	// Create temporary script file
-	tempDir := os.TempDir()
-	var scriptPath string
-	var cmd *exec.Cmd
-
-	switch script.ScriptType {
-	case "powershell":
-		scriptPath = filepath.Join(tempDir, fmt.Sprintf("siem_script_%s.ps1", script.ExecutionGUID[:8]))
-		if err := ioutil.WriteFile(scriptPath, []byte(script.ScriptContent), 0600); err != nil {
-			result.ErrorOutput = fmt.Sprintf("Failed to write script: %v", err)
-			result.ExitCode = -1
-			return result
-		}
+	// File names are derived from the validated GUID
+	guid, err := parseExecutionGUID(script.ExecutionGUID)
+	if err != nil {
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
 
-		// Build PowerShell command
-		args := []string{
-			"-NoProfile",
-			"-NonInteractive",
-			"-ExecutionPolicy", "Bypass",
-			"-File", scriptPath,
-		}
+	// Resolve the user context first: the script file must be readable by it
+	runAs, err := newScriptContext(script, &e.config.ScriptExecution)
+	if err != nil {
+		result.ErrorOutput = fmt.Sprintf("Failed to prepare user context: %v", err)
+		result.ExitCode = -1
+		return result
+	}
+	defer runAs.Close()
 
-		// Add parameters
-		for key, value := range script.Parameters {
-			args = append(args, fmt.Sprintf("-%s", key), value)
-		}
+	interpreter, err := findInterpreter(script.ScriptType)
+	if err != nil {
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
 
-		if script.RequiresAdmin && runtime.GOOS == "windows" {
-			cmd = exec.Command("powershell", args...)
-		} else {
-			cmd = exec.Command("powershell", args...)
-		}
+	if err := validateScriptParameters(script.Parameters); err != nil {
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
 
-	case "batch":
-		scriptPath = filepath.Join(tempDir, fmt.Sprintf("siem_script_%s.bat", script.ExecutionGUID[:8]))
-		if err := ioutil.WriteFile(scriptPath, []byte(script.ScriptContent), 0600); err != nil {
-			result.ErrorOutput = fmt.Sprintf("Failed to write script: %v", err)
-			result.ExitCode = -1
-			return result
-		}
+	// Create temporary script file, removed after execution
+	scriptPath := filepath.Join(runAs.dir, fmt.Sprintf("siem_script_%s%s", guid[:8], interpreter.ext))
+	if err := ioutil.WriteFile(scriptPath, []byte(script.ScriptContent), 0600); err != nil {
+		result.ErrorOutput = fmt.Sprintf("Failed to write script: %v", err)
+		result.ExitCode = -1
+		return result
+	}
+	defer os.Remove(scriptPath)
 
-		cmd = exec.Command("cmd", "/C", scriptPath)
+	// Parameters go through a file and the environment, never the command line
+	paramsPath, paramsEnv, err := writeScriptParameters(scriptPath, script.Parameters)
+	if err != nil {
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
+	defer os.Remove(paramsPath)
 
-	case "python":
-		scriptPath = filepath.Join(tempDir, fmt.Sprintf("siem_script_%s.py", script.ExecutionGUID[:8]))
-		if err := ioutil.WriteFile(scriptPath, []byte(script.ScriptContent), 0600); err != nil {
-			result.ErrorOutput = fmt.Sprintf("Failed to write script: %v", err)
+	runPath := scriptPath
+	if script.ScriptType == "powershell" && len(script.Parameters) > 0 {
+		if runPath, err = writePowerShellWrapper(scriptPath); err != nil {
+			result.ErrorOutput = err.Error()
 			result.ExitCode = -1
 			return result
 		}
+		defer os.Remove(runPath)
+	}
 
-		cmd = exec.Command("python", scriptPath)
+	args := append(append([]string{}, interpreter.args...), runPath)
+	cmd := exec.Command(interpreter.path, args...)
 
-	default:
-		result.ErrorOutput = fmt.Sprintf("Unsupported script type: %s", script.ScriptType)
+	if err := runAs.apply(cmd); err != nil {
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
+	// Files the script drops here are uploaded with the result
+	outputDir := filepath.Join(runAs.dir, fmt.Sprintf("siem_output_%s", guid[:8]))
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		result.ErrorOutput = fmt.Sprintf("Failed to create output directory: %v", err)
 		result.ExitCode = -1
 		return result
 	}
+	defer os.RemoveAll(outputDir)
 
-	// Clean up script file after execution
-	defer os.Remove(scriptPath)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, paramsEnv...)
+	cmd.Env = append(cmd.Env, scriptOutputEnv+"="+outputDir)
+	log.Printf("Running script %s as %s", script.ExecutionGUID, runAs.account)
+
+	// Contain the script and its children in a Job Object so a runaway
+	// script cannot exhaust the endpoint
+	memoryMB, cpuPercent, maxProcesses := e.scriptLimits(script)
+	job, err := newScriptJob(memoryMB, cpuPercent, maxProcesses)
+	if err != nil {
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
+	defer job.Close()
 
 	// Set up output buffers
 	var stdout, stderr bytes.Buffer
@@ -172,27 +270,40 @@ func (e *ScriptExecutor) executeScript(script *PendingScript) *ExecutionResult {
 
 	// Create context with timeout
 	timeout := time.Duration(script.Timeout) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
-	// Start the command
+	// Start the command suspended and let it run once it is in the job, so
+	// every child it starts is limited and killed with it
+	job.prepare(cmd)
 	if err := cmd.Start(); err != nil {
 		result.ErrorOutput = fmt.Sprintf("Failed to start command: %v", err)
 		result.ExitCode = -1
 		return result
 	}
+	if err := job.assign(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		<-waitDone(cmd)
+		result.ErrorOutput = err.Error()
+		result.ExitCode = -1
+		return result
+	}
 
 	// Wait for completion or timeout
-	done := make(chan error)
-	go func() {
-		done <- cmd.Wait()
-	}()
+	done := waitDone(cmd)
 
 	select {
 	case <-ctx.Done():
-		cmd.Process.Kill()
-		result.ErrorOutput = "Script execution timed out"
-		result.ExitCode = -2
+		// Kill the whole process tree, then let Wait finish with the output
+		job.terminate()
+		<-done
+		if parent.Err() != nil {
+			result.ErrorOutput = "Script execution cancelled"
+			result.ExitCode = scriptCancelledExitCode
+		} else {
+			result.ErrorOutput = "Script execution timed out"
+			result.ExitCode = -2
+		}
 	case err := <-done:
 		if err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
@@ -206,33 +317,80 @@ func (e *ScriptExecutor) executeScript(script *PendingScript) *ExecutionResult {
 		}
 	}
 
+	if job.peakMemoryMB() >= memoryMB {
+		log.Printf("Script %s reached its memory limit of %d MB", script.ExecutionGUID, memoryMB)
+	}
+
 	result.Output = truncateOutput(stdout.String(), 50000)
 	if stderr.Len() > 0 {
 		result.ErrorOutput = truncateOutput(stderr.String(), 10000)
 	}
 	result.DurationMs = time.Since(startTime).Milliseconds()
 
+	maxArtifacts := int64(e.config.ScriptExecution.MaxArtifactSizeMB) * 1024 * 1024
+	artifacts, err := collectArtifacts(outputDir, guid, maxArtifacts)
+	if err != nil {
+		log.Printf("Script %s: %v", script.ExecutionGUID, err)
+		result.ErrorOutput += "\n" + err.Error()
+	} else if artifacts != nil {
+		log.Printf("Script %s produced %d output files (%d bytes, SHA256 %s)",
+			script.ExecutionGUID, artifacts.FileCount, artifacts.Size, artifacts.SHA256)
+		result.Artifacts = artifacts
+	}
+
 	return result
 }
 
+// scriptLimits returns the script's Job Object limits, with agent defaults
+// for limits the server did not set
+func (e *ScriptExecutor) scriptLimits(script *PendingScript) (memoryMB, cpuPercent, maxProcesses int) {
+	memoryMB, cpuPercent, maxProcesses = script.MaxMemoryMB, script.MaxCPUPercent, script.MaxProcesses
+	if memoryMB <= 0 {
+		memoryMB = e.config.ScriptExecution.MaxMemoryMB
+	}
+	if cpuPercent <= 0 {
+		cpuPercent = e.config.ScriptExecution.MaxCPUPercent
+	}
+	if maxProcesses <= 0 {
+		maxProcesses = e.config.ScriptExecution.MaxProcesses
+	}
+	return memoryMB, cpuPercent, maxProcesses
+}
+
+// waitDone waits for cmd in the background
+func waitDone(cmd *exec.Cmd) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	return done
+}
+
 // reportResult sends execution result back to SIEM server
 func (e *ScriptExecutor) reportResult(executionGUID string, result *ExecutionResult) {
-	url := fmt.Sprintf("%s/ad/scripts/executions/%s/result", e.config.ServerURL, executionGUID)
+	url := fmt.Sprintf("%s/ad/scripts/executions/%s/result", e.config.SIEM.APIURL, executionGUID)
 
-	// Build query parameters
-	params := fmt.Sprintf("?exit_code=%d&duration_ms=%d", result.ExitCode, result.DurationMs)
-	if result.Output != "" {
-		params += "&output=" + encodeURIComponent(result.Output)
+	// Executions refused before running still get an explicit verdict
+	if result.Verdict == "" {
+		evaluateSuccess(nil, result)
 	}
-	if result.ErrorOutput != "" {
-		params += "&error_output=" + encodeURIComponent(result.ErrorOutput)
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error encoding result of script execution %s: %v", executionGUID, err)
+		return
 	}
 
-	resp, err := e.httpClient.Post(url+params, "application/json", nil)
+	resp, err := e.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
+		log.Printf("Error reporting result of script execution %s: %v", executionGUID, err)
 		return
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Error reporting result of script execution %s: status %d", executionGUID, resp.StatusCode)
+	}
 }
 
 // truncateOutput limits output string to maxLen characters
@@ -242,16 +400,3 @@ func truncateOutput(s string, maxLen int) string {
 	}
 	return s[:maxLen] + "\n... (truncated)"
 }
-
-// encodeURIComponent encodes a string for URL query parameters
-func encodeURIComponent(s string) string {
-	// Simple URL encoding for common characters
-	s = strings.ReplaceAll(s, "%", "%25")
-	s = strings.ReplaceAll(s, " ", "%20")
-	s = strings.ReplaceAll(s, "\n", "%0A")
-	s = strings.ReplaceAll(s, "\r", "%0D")
-	s = strings.ReplaceAll(s, "&", "%26")
-	s = strings.ReplaceAll(s, "=", "%3D")
-	s = strings.ReplaceAll(s, "?", "%3F")
-	return s
-}
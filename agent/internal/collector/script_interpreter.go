@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// scriptInterpreter is the program a script type runs with
+type scriptInterpreter struct {
+	path string
+	args []string // arguments before the script path
+	ext  string   // script file extension
+}
+
+// findInterpreter looks up the interpreter for a script type on this
+// platform, trying the candidates in order of preference
+func findInterpreter(scriptType string) (*scriptInterpreter, error) {
+	var candidates, args []string
+	var ext string
+
+	switch scriptType {
+	case "powershell":
+		// Windows PowerShell, or PowerShell 7 where it is the only one installed
+		candidates = []string{"powershell", "pwsh"}
+		args = []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File"}
+		ext = ".ps1"
+
+	case "batch":
+		if runtime.GOOS != "windows" {
+			return nil, fmt.Errorf("batch scripts are only supported on Windows")
+		}
+		candidates = []string{"cmd"}
+		args = []string{"/C"}
+		ext = ".bat"
+
+	case "python":
+		// On Windows "python3" is often the Microsoft Store installer stub
+		candidates = []string{"python3", "python"}
+		if runtime.GOOS == "windows" {
+			candidates = []string{"python", "py"}
+		}
+		ext = ".py"
+
+	case "bash":
+		candidates = []string{"bash"}
+		ext = ".sh"
+
+	case "sh":
+		candidates = []string{"sh"}
+		ext = ".sh"
+
+	default:
+		return nil, fmt.Errorf("unsupported script type: %s", scriptType)
+	}
+
+	for _, name := range candidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return &scriptInterpreter{path: path, args: args, ext: ext}, nil
+		}
+	}
+	return nil, fmt.Errorf("no interpreter for %s scripts found (tried %s)", scriptType, strings.Join(candidates, ", "))
+}
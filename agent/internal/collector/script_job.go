@@ -0,0 +1,116 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
+)
+
+// jobObjectCPURateControlInformation is JOBOBJECT_CPU_RATE_CONTROL_INFORMATION
+// with the CpuRate member of its union
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	CpuRate      uint32 // 1/100 of a percent of all processors
+}
+
+// scriptJob is a Job Object holding a script process and its children.
+// Closing the job kills every process still in it, so a script cannot
+// leave processes behind.
+type scriptJob struct {
+	handle windows.Handle
+}
+
+// newScriptJob creates a job with the given limits; zero disables a limit
+func newScriptJob(memoryMB, cpuPercent, maxProcesses int) (*scriptJob, error) {
+	handle, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job object: %w", err)
+	}
+	job := &scriptJob{handle: handle}
+
+	limits := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	limits.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if memoryMB > 0 {
+		limits.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		limits.JobMemoryLimit = uintptr(memoryMB) * 1024 * 1024
+	}
+	if maxProcesses > 0 {
+		limits.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		limits.BasicLimitInformation.ActiveProcessLimit = uint32(maxProcesses)
+	}
+	if _, err := windows.SetInformationJobObject(handle, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&limits)), uint32(unsafe.Sizeof(limits))); err != nil {
+		job.Close()
+		return nil, fmt.Errorf("failed to set job limits: %w", err)
+	}
+
+	if cpuPercent > 0 && cpuPercent < 100 {
+		rate := jobObjectCPURateControlInformation{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CpuRate:      uint32(cpuPercent) * 100,
+		}
+		if _, err := windows.SetInformationJobObject(handle, windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&rate)), uint32(unsafe.Sizeof(rate))); err != nil {
+			job.Close()
+			return nil, fmt.Errorf("failed to set job CPU limit: %w", err)
+		}
+	}
+
+	return job, nil
+}
+
+// prepare makes cmd start suspended, keeping the attributes of its user
+// context, so the script cannot start children before it is in the job
+func (j *scriptJob) prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+}
+
+// assign adds a process started suspended to the job, then resumes it
+func (j *scriptJob) assign(pid int) error {
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return fmt.Errorf("failed to open script process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(j.handle, process); err != nil {
+		return fmt.Errorf("failed to assign script process to job: %w", err)
+	}
+	if err := resumeProcess(uint32(pid)); err != nil {
+		return fmt.Errorf("failed to resume script process: %w", err)
+	}
+	return nil
+}
+
+// terminate kills every process in the job
+func (j *scriptJob) terminate() {
+	windows.TerminateJobObject(j.handle, 1)
+}
+
+// peakMemoryMB returns the most memory the job's processes used at once
+func (j *scriptJob) peakMemoryMB() int {
+	var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	if err := windows.QueryInformationJobObject(j.handle, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil); err != nil {
+		return 0
+	}
+	return int(info.PeakJobMemoryUsed / (1024 * 1024))
+}
+
+// Close kills any remaining processes and releases the job
+func (j *scriptJob) Close() {
+	windows.CloseHandle(j.handle)
+}
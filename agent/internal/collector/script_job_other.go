@@ -0,0 +1,47 @@
+//go:build !windows
+
+package collector
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// scriptJob tracks a script's process group. Resource limits rely on Job
+// Objects and are only enforced on Windows; elsewhere the group is killed
+// when the script finishes, times out or is cancelled.
+type scriptJob struct {
+	pgid int
+}
+
+// newScriptJob creates a job; the limits are ignored outside Windows
+func newScriptJob(memoryMB, cpuPercent, maxProcesses int) (*scriptJob, error) {
+	return &scriptJob{}, nil
+}
+
+// prepare does nothing; the script leads its own process group from the
+// start, so its children are always in it
+func (j *scriptJob) prepare(cmd *exec.Cmd) {}
+
+// assign records the script's process group, which the script leads
+func (j *scriptJob) assign(pid int) error {
+	j.pgid = pid
+	return nil
+}
+
+// terminate kills every process in the group
+func (j *scriptJob) terminate() {
+	if j.pgid > 0 {
+		syscall.Kill(-j.pgid, syscall.SIGKILL)
+	}
+}
+
+// peakMemoryMB is not tracked outside Windows
+func (j *scriptJob) peakMemoryMB() int {
+	return 0
+}
+
+// Close kills any remaining processes
+func (j *scriptJob) Close() {
+	j.terminate()
+}
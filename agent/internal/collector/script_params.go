@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Script parameters never appear on a command line. They are written to a
+// JSON file whose path is in SIEM_SCRIPT_PARAMS and are also set as
+// SIEM_PARAM_<NAME> environment variables. PowerShell scripts additionally
+// receive them as named parameters through a wrapper that splats the file,
+// so values are never parsed as code or as further parameters.
+const (
+	scriptParamsEnv      = "SIEM_SCRIPT_PARAMS"
+	scriptParamEnvPrefix = "SIEM_PARAM_"
+)
+
+// scriptParamPattern restricts parameter names to identifiers valid in
+// every supported script language
+var scriptParamPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// validateScriptParameters rejects names outside the whitelist pattern and
+// values that cannot be passed in an environment block
+func validateScriptParameters(params map[string]string) error {
+	for name, value := range params {
+		if !scriptParamPattern.MatchString(name) {
+			return fmt.Errorf("invalid parameter name %q", name)
+		}
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("parameter %s contains a NUL character", name)
+		}
+	}
+	return nil
+}
+
+// writeScriptParameters writes the parameters file next to the script and
+// returns its path and the environment entries to add
+func writeScriptParameters(scriptPath string, params map[string]string) (string, []string, error) {
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	path := strings.TrimSuffix(scriptPath, filepath.Ext(scriptPath)) + "_params.json"
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", nil, fmt.Errorf("failed to write parameters: %w", err)
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := []string{scriptParamsEnv + "=" + path}
+	for _, name := range names {
+		env = append(env, scriptParamEnvPrefix+strings.ToUpper(name)+"="+params[name])
+	}
+	return path, env, nil
+}
+
+// writePowerShellWrapper writes a wrapper that calls the script with the
+// parameters file splatted as named parameters, and returns its path
+func writePowerShellWrapper(scriptPath string) (string, error) {
+	// Single-quoted PowerShell literal
+	quoted := "'" + strings.ReplaceAll(scriptPath, "'", "''") + "'"
+
+	wrapper := fmt.Sprintf(`$params = @{}
+(Get-Content -Raw -LiteralPath $env:%s | ConvertFrom-Json).PSObject.Properties | ForEach-Object { $params[$_.Name] = $_.Value }
+& %s @params
+exit $LASTEXITCODE
+`, scriptParamsEnv, quoted)
+
+	path := strings.TrimSuffix(scriptPath, filepath.Ext(scriptPath)) + "_run.ps1"
+	if err := os.WriteFile(path, []byte(wrapper), 0600); err != nil {
+		return "", fmt.Errorf("failed to write PowerShell wrapper: %w", err)
+	}
+	return path, nil
+}
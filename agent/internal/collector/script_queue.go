@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Exit code reported for executions cancelled by the server
+const scriptCancelledExitCode = -4
+
+// enqueueScript verifies a pending script and queues it by priority.
+// Scripts already queued or running are ignored, since the server keeps
+// returning an execution until its result has been reported.
+func (e *ScriptExecutor) enqueueScript(script *PendingScript) {
+	// The GUID names files and the result URL; a malformed one cannot be
+	// reported back either
+	if _, err := parseExecutionGUID(script.ExecutionGUID); err != nil {
+		log.Printf("Refusing script execution: %v", err)
+		return
+	}
+
+	e.mutex.Lock()
+	if e.known(script.ExecutionGUID) {
+		e.mutex.Unlock()
+		return
+	}
+	if len(e.queue) >= e.config.ScriptExecution.MaxQueued {
+		e.mutex.Unlock()
+		log.Printf("Script queue full, deferring execution %s", script.ExecutionGUID)
+		return
+	}
+	e.mutex.Unlock()
+
+	if err := e.resolveLibraryScript(script); err != nil {
+		log.Printf("Refusing script execution %s: %v", script.ExecutionGUID, err)
+		e.reportResult(script.ExecutionGUID, &ExecutionResult{
+			ExitCode:    -1,
+			ErrorOutput: fmt.Sprintf("Failed to load library script: %v", err),
+		})
+		return
+	}
+
+	// Refuse scripts not signed by an operator key
+	if err := verifyScriptSignature(script, e.config.ScriptExecution.SigningKeys, e.agentID); err != nil {
+		log.Printf("Refusing script execution %s: %v", script.ExecutionGUID, err)
+		e.reportResult(script.ExecutionGUID, &ExecutionResult{
+			ExitCode:    scriptSignatureExitCode,
+			ErrorOutput: fmt.Sprintf("Script signature verification failed: %v", err),
+		})
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.known(script.ExecutionGUID) {
+		return
+	}
+	e.queue = append(e.queue, script)
+	// Stable, so executions of equal priority keep the server's order
+	sort.SliceStable(e.queue, func(i, j int) bool {
+		return e.queue[i].Priority > e.queue[j].Priority
+	})
+	log.Printf("Script execution %s queued (priority %d, %d queued)", script.ExecutionGUID, script.Priority, len(e.queue))
+}
+
+// known reports whether an execution is queued or running. Callers hold e.mutex.
+func (e *ScriptExecutor) known(executionGUID string) bool {
+	if _, ok := e.running[executionGUID]; ok {
+		return true
+	}
+	for _, queued := range e.queue {
+		if queued.ExecutionGUID == executionGUID {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch starts queued executions while below the concurrency limit
+func (e *ScriptExecutor) dispatch(ctx context.Context) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for len(e.queue) > 0 && len(e.running) < e.config.ScriptExecution.MaxConcurrent {
+		if ctx.Err() != nil {
+			return
+		}
+
+		script := e.queue[0]
+		e.queue = e.queue[1:]
+
+		execCtx, cancel := context.WithCancel(ctx)
+		e.running[script.ExecutionGUID] = cancel
+
+		e.wg.Add(1)
+		go e.run(ctx, execCtx, script)
+	}
+}
+
+// run executes one script, reports the result and starts the next one
+func (e *ScriptExecutor) run(ctx, execCtx context.Context, script *PendingScript) {
+	defer e.wg.Done()
+
+	var result *ExecutionResult
+	if err := e.checkApproval(execCtx, script); err != nil {
+		log.Printf("Refusing script execution %s: %v", script.ExecutionGUID, err)
+		result = &ExecutionResult{
+			ExitCode:    scriptApprovalExitCode,
+			ErrorOutput: fmt.Sprintf("Script execution not approved: %v", err),
+		}
+	} else if err := checkScriptExpiry(script); err != nil {
+		// The script waited in the queue or for approval past its expiry
+		log.Printf("Refusing script execution %s: %v", script.ExecutionGUID, err)
+		result = &ExecutionResult{
+			ExitCode:    scriptSignatureExitCode,
+			ErrorOutput: fmt.Sprintf("Script signature verification failed: %v", err),
+		}
+	} else {
+		log.Printf("Executing script %s (%s)", script.ExecutionGUID, script.ScriptType)
+		result = e.executeScript(execCtx, script)
+	}
+	evaluateSuccess(script.SuccessCriteria, result)
+	e.reportResult(script.ExecutionGUID, result)
+
+	e.mutex.Lock()
+	if cancel, ok := e.running[script.ExecutionGUID]; ok {
+		cancel()
+		delete(e.running, script.ExecutionGUID)
+	}
+	e.mutex.Unlock()
+
+	e.dispatch(ctx)
+}
+
+// Cancel removes a queued execution or kills a running one. It returns
+// false if the execution is unknown or has already finished.
+func (e *ScriptExecutor) Cancel(executionGUID string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if cancel, ok := e.running[executionGUID]; ok {
+		log.Printf("Cancelling running script execution %s", executionGUID)
+		cancel()
+		return true
+	}
+
+	for i, queued := range e.queue {
+		if queued.ExecutionGUID != executionGUID {
+			continue
+		}
+		e.queue = append(e.queue[:i], e.queue[i+1:]...)
+		log.Printf("Cancelled queued script execution %s", executionGUID)
+
+		// Report outside the lock; the server only needs the final state
+		go e.reportResult(executionGUID, &ExecutionResult{
+			ExitCode:    scriptCancelledExitCode,
+			ErrorOutput: "Script execution cancelled before it started",
+		})
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/siem/agent/internal/config"
+)
+
+var procLogonUserW = windows.NewLazySystemDLL("advapi32.dll").NewProc("LogonUserW")
+
+const (
+	logon32LogonService    = 5
+	logon32ProviderDefault = 0
+)
+
+// scriptContext is the user context a script runs in. Scripts run as
+// another user are written to a directory only that user, SYSTEM and
+// administrators can access, since the agent's temp directory is not
+// readable by them.
+type scriptContext struct {
+	account string
+	token   windows.Token
+	dir     string
+}
+
+// newScriptContext resolves the user context requested by a script
+func newScriptContext(script *PendingScript, cfg *config.ScriptExecutionConfig) (*scriptContext, error) {
+	switch script.RunAs {
+	case "", ScriptRunAsSystem:
+		return &scriptContext{account: "SYSTEM", dir: os.TempDir()}, nil
+
+	case ScriptRunAsUser:
+		sessionID := FindUserSession(script.TargetUser)
+		account := sessionAccount(sessionID)
+		if sessionID == noSession || account == "" {
+			return nil, fmt.Errorf("no interactive user session")
+		}
+		if script.TargetUser != "" && !sessionUserMatches(sessionID, script.TargetUser) {
+			return nil, fmt.Errorf("user %s is not logged on", script.TargetUser)
+		}
+
+		var token windows.Token
+		if err := windows.WTSQueryUserToken(sessionID, &token); err != nil {
+			return nil, fmt.Errorf("failed to get user token for session %d: %w", sessionID, err)
+		}
+		return newUserScriptContext(script, account, token)
+
+	case ScriptRunAsAccount:
+		for _, sa := range cfg.ServiceAccounts {
+			if !strings.EqualFold(sa.Name, script.RunAsAccount) {
+				continue
+			}
+			token, err := logonServiceAccount(sa.UserName, sa.Password)
+			if err != nil {
+				return nil, err
+			}
+			return newUserScriptContext(script, sa.UserName, token)
+		}
+		return nil, fmt.Errorf("service account %q is not configured", script.RunAsAccount)
+	}
+
+	return nil, fmt.Errorf("unsupported run_as %q", script.RunAs)
+}
+
+// newUserScriptContext creates the script directory of another user under
+// %ProgramData%\SIEM\scripts. Close removes it as SYSTEM, so it is named
+// after the validated execution GUID and must stay below that root.
+func newUserScriptContext(script *PendingScript, account string, token windows.Token) (*scriptContext, error) {
+	guid, err := parseExecutionGUID(script.ExecutionGUID)
+	if err != nil {
+		token.Close()
+		return nil, err
+	}
+	programData := os.Getenv("ProgramData")
+	if !filepath.IsAbs(programData) {
+		token.Close()
+		return nil, fmt.Errorf("ProgramData is not an absolute path")
+	}
+	root := filepath.Join(programData, "SIEM", "scripts")
+	dir := filepath.Join(root, guid)
+	if filepath.Dir(dir) != root {
+		token.Close()
+		return nil, fmt.Errorf("script directory %s is outside %s", dir, root)
+	}
+
+	if err := createPromptDir(dir, account); err != nil {
+		token.Close()
+		return nil, err
+	}
+	return &scriptContext{account: account, token: token, dir: dir}, nil
+}
+
+// apply makes cmd start with the context's token and environment
+func (c *scriptContext) apply(cmd *exec.Cmd) error {
+	if c.token == 0 {
+		return nil
+	}
+
+	env, err := tokenEnvironment(c.token)
+	if err != nil {
+		return fmt.Errorf("failed to create environment for %s: %w", c.account, err)
+	}
+	cmd.Env = env
+	cmd.Dir = c.dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Token:      syscall.Token(c.token),
+		HideWindow: true,
+	}
+	return nil
+}
+
+// Close releases the token and removes the script directory of another user
+func (c *scriptContext) Close() {
+	if c.token == 0 {
+		return
+	}
+	c.token.Close()
+	os.RemoveAll(c.dir)
+}
+
+// tokenEnvironment returns the default environment of the token's user
+func tokenEnvironment(token windows.Token) ([]string, error) {
+	var block *uint16
+	if err := windows.CreateEnvironmentBlock(&block, token, false); err != nil {
+		return nil, err
+	}
+	defer windows.DestroyEnvironmentBlock(block)
+
+	// The block is a sequence of NUL-terminated strings ending with an empty one
+	var env []string
+	for ptr := unsafe.Pointer(block); ; {
+		entry := windows.UTF16PtrToString((*uint16)(ptr))
+		if entry == "" {
+			break
+		}
+		env = append(env, entry)
+		ptr = unsafe.Add(ptr, (len(utf16.Encode([]rune(entry)))+1)*2)
+	}
+	return env, nil
+}
+
+// logonServiceAccount logs on a service account (DOMAIN\user or user)
+func logonServiceAccount(userName, password string) (windows.Token, error) {
+	domain, user := ".", userName
+	if idx := strings.LastIndex(userName, "\\"); idx != -1 {
+		domain, user = userName[:idx], userName[idx+1:]
+	}
+
+	userPtr, err := windows.UTF16PtrFromString(user)
+	if err != nil {
+		return 0, err
+	}
+	domainPtr, err := windows.UTF16PtrFromString(domain)
+	if err != nil {
+		return 0, err
+	}
+	passwordPtr, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return 0, err
+	}
+
+	var token windows.Token
+	ret, _, callErr := procLogonUserW.Call(
+		uintptr(unsafe.Pointer(userPtr)),
+		uintptr(unsafe.Pointer(domainPtr)),
+		uintptr(unsafe.Pointer(passwordPtr)),
+		logon32LogonService,
+		logon32ProviderDefault,
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if ret == 0 {
+		return 0, fmt.Errorf("failed to log on %s: %w", userName, callErr)
+	}
+	return token, nil
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// scriptContext is the user context a script runs in. Only the agent's own
+// account is supported outside Windows.
+type scriptContext struct {
+	account string
+	dir     string
+}
+
+// newScriptContext resolves the user context requested by a script
+func newScriptContext(script *PendingScript, cfg *config.ScriptExecutionConfig) (*scriptContext, error) {
+	switch script.RunAs {
+	case "", ScriptRunAsSystem:
+		return &scriptContext{account: "agent", dir: os.TempDir()}, nil
+	}
+	return nil, fmt.Errorf("run_as %q is only supported on Windows", script.RunAs)
+}
+
+// apply starts the script in its own process group so it can be killed
+// together with its children
+func (c *scriptContext) apply(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return nil
+}
+
+// Close releases the context
+func (c *scriptContext) Close() {}
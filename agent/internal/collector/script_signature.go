@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exit code reported for scripts refused because of a missing or invalid signature
+const scriptSignatureExitCode = -3
+
+// scriptSigningEnvelope is what an operator signs for an execution: the
+// script and every field that decides how, where, as whom and until when
+// it runs. JSON field order is fixed by the struct and map keys are sorted,
+// so the encoding is canonical.
+type scriptSigningEnvelope struct {
+	ExecutionGUID   string                 `json:"execution_guid"`
+	TargetAgentID   string                 `json:"target_agent_id"`
+	ExpiresAt       string                 `json:"expires_at"` // RFC 3339, UTC
+	ScriptType      string                 `json:"script_type"`
+	ScriptContent   string                 `json:"script_content"`
+	ScriptID        string                 `json:"script_id"`
+	ScriptHash      string                 `json:"script_hash"`
+	Parameters      map[string]string      `json:"parameters"`
+	RequiresAdmin   bool                   `json:"requires_admin"`
+	Timeout         int                    `json:"timeout"`
+	RunAs           string                 `json:"run_as"`
+	RunAsAccount    string                 `json:"run_as_account"`
+	TargetUser      string                 `json:"target_user"`
+	RiskLevel       int                    `json:"risk_level"`
+	RequestedBy     string                 `json:"requested_by"`
+	ApprovedBy      string                 `json:"approved_by"`
+	MaxMemoryMB     int                    `json:"max_memory_mb"`
+	MaxCPUPercent   int                    `json:"max_cpu_percent"`
+	MaxProcesses    int                    `json:"max_processes"`
+	SuccessCriteria *ScriptSuccessCriteria `json:"success_criteria"`
+}
+
+// scriptSigningPayload returns the bytes an operator signs for a script:
+// the canonical JSON of its envelope. A signed script cannot be replayed
+// with other parameters, user context, limits or approval, on another
+// agent, or after it expired.
+func scriptSigningPayload(script *PendingScript) []byte {
+	parameters := script.Parameters
+	if parameters == nil {
+		parameters = map[string]string{}
+	}
+	payload, _ := json.Marshal(&scriptSigningEnvelope{
+		ExecutionGUID:   script.ExecutionGUID,
+		TargetAgentID:   script.TargetAgentID,
+		ExpiresAt:       script.ExpiresAt.UTC().Format(time.RFC3339),
+		ScriptType:      script.ScriptType,
+		ScriptContent:   script.ScriptContent,
+		ScriptID:        script.ScriptID,
+		ScriptHash:      script.ScriptHash,
+		Parameters:      parameters,
+		RequiresAdmin:   script.RequiresAdmin,
+		Timeout:         script.Timeout,
+		RunAs:           script.RunAs,
+		RunAsAccount:    script.RunAsAccount,
+		TargetUser:      script.TargetUser,
+		RiskLevel:       script.RiskLevel,
+		RequestedBy:     script.RequestedBy,
+		ApprovedBy:      script.ApprovedBy,
+		MaxMemoryMB:     script.MaxMemoryMB,
+		MaxCPUPercent:   script.MaxCPUPercent,
+		MaxProcesses:    script.MaxProcesses,
+		SuccessCriteria: script.SuccessCriteria,
+	})
+	return payload
+}
+
+// verifyScriptSignature checks the script's detached Ed25519 signature
+// against the operator signing keys from the agent configuration, and that
+// the signed execution targets this agent and has not expired. Without
+// configured keys every script is refused, so a compromised server cannot
+// run arbitrary code on agents.
+func verifyScriptSignature(script *PendingScript, signingKeys []string, agentID string) error {
+	if len(signingKeys) == 0 {
+		return fmt.Errorf("no script signing keys configured")
+	}
+	if script.Signature == "" {
+		return fmt.Errorf("script is not signed")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(script.Signature))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("malformed script signature")
+	}
+
+	payload := scriptSigningPayload(script)
+	verified := false
+	for i, encoded := range signingKeys {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("script signing key %d is not a base64 Ed25519 public key", i+1)
+		}
+		if ed25519.Verify(ed25519.PublicKey(key), payload, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return fmt.Errorf("script signature does not match any signing key (script tampered or signed with an unknown key)")
+	}
+
+	if script.TargetAgentID != agentID {
+		return fmt.Errorf("script was signed for agent %q", script.TargetAgentID)
+	}
+	return checkScriptExpiry(script)
+}
+
+// checkScriptExpiry refuses executions without a signed expiry or past it.
+// It is checked again before a queued or approved script starts.
+func checkScriptExpiry(script *PendingScript) error {
+	if script.ExpiresAt.IsZero() {
+		return fmt.Errorf("script has no expiry")
+	}
+	if time.Now().After(script.ExpiresAt) {
+		return fmt.Errorf("script expired at %s", script.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Script verdicts reported with the execution result
+const (
+	ScriptVerdictPass = "pass"
+	ScriptVerdictFail = "fail"
+)
+
+// ScriptSuccessCriteria defines when an execution counts as successful.
+// Without criteria only exit code 0 passes.
+type ScriptSuccessCriteria struct {
+	AllowedExitCodes   []int  `json:"allowed_exit_codes,omitempty"`    // empty means only 0
+	OutputMustMatch    string `json:"output_must_match,omitempty"`     // regex that must match stdout
+	OutputMustNotMatch string `json:"output_must_not_match,omitempty"` // regex that must not match stdout
+}
+
+// evaluateSuccess sets the verdict of a finished execution. Negative exit
+// codes are the agent's own failures (timeout, signature, cancel...) and
+// never pass, whatever codes the script allows.
+func evaluateSuccess(criteria *ScriptSuccessCriteria, result *ExecutionResult) {
+	result.Verdict = ScriptVerdictFail
+
+	if result.ExitCode < 0 {
+		result.VerdictReason = fmt.Sprintf("execution failed with agent code %d", result.ExitCode)
+		return
+	}
+	if criteria == nil {
+		criteria = &ScriptSuccessCriteria{}
+	}
+
+	if !exitCodeAllowed(criteria.AllowedExitCodes, result.ExitCode) {
+		result.VerdictReason = fmt.Sprintf("exit code %d is not allowed", result.ExitCode)
+		return
+	}
+
+	if criteria.OutputMustMatch != "" {
+		re, err := regexp.Compile(criteria.OutputMustMatch)
+		if err != nil {
+			result.VerdictReason = fmt.Sprintf("invalid output_must_match: %v", err)
+			return
+		}
+		if !re.MatchString(result.Output) {
+			result.VerdictReason = "output does not match output_must_match"
+			return
+		}
+	}
+
+	if criteria.OutputMustNotMatch != "" {
+		re, err := regexp.Compile(criteria.OutputMustNotMatch)
+		if err != nil {
+			result.VerdictReason = fmt.Sprintf("invalid output_must_not_match: %v", err)
+			return
+		}
+		if loc := re.FindStringIndex(result.Output); loc != nil {
+			match := result.Output[loc[0]:loc[1]]
+			result.VerdictReason = fmt.Sprintf("output matches output_must_not_match: %q", truncateOutput(match, 200))
+			return
+		}
+	}
+
+	result.Verdict = ScriptVerdictPass
+}
+
+// exitCodeAllowed reports whether code is in allowed, or is 0 if allowed is empty
+func exitCodeAllowed(allowed []int, code int) bool {
+	if len(allowed) == 0 {
+		return code == 0
+	}
+	for _, c := range allowed {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+package collector
+
+import "net/http"
+
+// ServerTransport wraps the transport of a collector's HTTP client so that
+// requests for the SIEM server carry the agent's credential; requests for
+// other hosts go through base unchanged. The agent passes the API client's
+// Transport method.
+type ServerTransport func(base http.RoundTripper) http.RoundTripper
@@ -0,0 +1,367 @@
+//go:build windows
+
+package collector
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	wtsapi32                        = windows.NewLazySystemDLL("wtsapi32.dll")
+	procWTSQuerySessionInformationW = wtsapi32.NewProc("WTSQuerySessionInformationW")
+)
+
+const (
+	wtsUserName   = 5 // WTS_INFO_CLASS WTSUserName
+	wtsDomainName = 7 // WTS_INFO_CLASS WTSDomainName
+
+	// noSession is returned when no interactive user session is available
+	noSession = 0xFFFFFFFF
+
+	// powerShellAppID is a registered AppUserModelID, required for toasts
+	// to be displayed on Windows 10+
+	powerShellAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+)
+
+// The agent runs as SYSTEM in session 0, which has no visible desktop.
+// The session helper runs short PowerShell scripts, or the agent's own
+// screen capture helper, inside the interactive session of the user who
+// needs to see them.
+
+// FindUserSession returns the session ID of an active session owned by
+// userName (DOMAIN\user or user). Falls back to the console session.
+func FindUserSession(userName string) uint32 {
+	if userName != "" {
+		var sessions *windows.WTS_SESSION_INFO
+		var count uint32
+		if err := windows.WTSEnumerateSessions(0, 0, 1, &sessions, &count); err == nil {
+			defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(sessions)))
+
+			list := unsafe.Slice(sessions, count)
+			for _, session := range list {
+				if session.State != windows.WTSActive {
+					continue
+				}
+				if sessionUserMatches(session.SessionID, userName) {
+					return session.SessionID
+				}
+			}
+		}
+	}
+
+	return windows.WTSGetActiveConsoleSessionId()
+}
+
+// ActiveUserSessions returns the IDs of all active sessions with a logged-on user
+func ActiveUserSessions() []uint32 {
+	var sessions *windows.WTS_SESSION_INFO
+	var count uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &sessions, &count); err != nil {
+		return nil
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(sessions)))
+
+	var ids []uint32
+	for _, session := range unsafe.Slice(sessions, count) {
+		if session.State == windows.WTSActive && querySessionString(session.SessionID, wtsUserName) != "" {
+			ids = append(ids, session.SessionID)
+		}
+	}
+	return ids
+}
+
+// sessionAccount returns the DOMAIN\user logged on to a session, or "" if none
+func sessionAccount(sessionID uint32) string {
+	user := querySessionString(sessionID, wtsUserName)
+	if user == "" {
+		return ""
+	}
+	if domain := querySessionString(sessionID, wtsDomainName); domain != "" {
+		return domain + "\\" + user
+	}
+	return user
+}
+
+// sessionIsAdmin reports whether the user logged on to a session is a
+// local administrator. With UAC the session token is filtered, so the
+// linked elevated token is checked instead.
+func sessionIsAdmin(sessionID uint32) bool {
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(sessionID, &token); err != nil {
+		return false
+	}
+	defer token.Close()
+
+	admins, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if err != nil {
+		return false
+	}
+
+	if !token.IsElevated() {
+		linked, err := token.GetLinkedToken()
+		if err != nil {
+			return false
+		}
+		defer linked.Close()
+		token = linked
+	}
+
+	member, err := token.IsMember(admins)
+	return err == nil && member
+}
+
+// sessionUserMatches checks whether a session belongs to userName
+func sessionUserMatches(sessionID uint32, userName string) bool {
+	sessionUser := querySessionString(sessionID, wtsUserName)
+	if sessionUser == "" {
+		return false
+	}
+
+	domain, user := "", userName
+	if idx := strings.LastIndex(userName, "\\"); idx != -1 {
+		domain, user = userName[:idx], userName[idx+1:]
+	}
+
+	if !strings.EqualFold(sessionUser, user) {
+		return false
+	}
+	return domain == "" || strings.EqualFold(querySessionString(sessionID, wtsDomainName), domain)
+}
+
+// querySessionString queries a string property of a terminal session
+func querySessionString(sessionID uint32, infoClass uint32) string {
+	var buffer *uint16
+	var bytesReturned uint32
+
+	ret, _, _ := procWTSQuerySessionInformationW.Call(
+		0, // WTS_CURRENT_SERVER_HANDLE
+		uintptr(sessionID),
+		uintptr(infoClass),
+		uintptr(unsafe.Pointer(&buffer)),
+		uintptr(unsafe.Pointer(&bytesReturned)),
+	)
+	if ret == 0 || buffer == nil {
+		return ""
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buffer)))
+
+	return windows.UTF16PtrToString(buffer)
+}
+
+// RunInSession runs a PowerShell script hidden in the given user session.
+// If timeout is zero the script is started and not waited for; otherwise
+// the script's exit code is returned once it finishes.
+func RunInSession(sessionID uint32, psScript string, timeout time.Duration) (uint32, error) {
+	commandLine := "powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -WindowStyle Hidden -EncodedCommand " +
+		encodePowerShell(psScript)
+	procInfo, err := createSessionProcess(sessionID, commandLine, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(procInfo.Process)
+	defer windows.CloseHandle(procInfo.Thread)
+
+	if timeout == 0 {
+		return 0, nil
+	}
+
+	event, err := windows.WaitForSingleObject(procInfo.Process, uint32(timeout.Milliseconds()))
+	if err != nil {
+		return 0, err
+	}
+	if event == uint32(windows.WAIT_TIMEOUT) {
+		windows.TerminateProcess(procInfo.Process, 1)
+		return 0, fmt.Errorf("helper timed out after %v", timeout)
+	}
+
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(procInfo.Process, &exitCode); err != nil {
+		return 0, err
+	}
+	return exitCode, nil
+}
+
+// sessionProcess is a program started in a user session whose standard
+// input, output and error are pipes to the agent
+type sessionProcess struct {
+	process windows.Handle
+	stdin   *os.File
+	stdout  *os.File
+	stderr  *os.File
+}
+
+// startInSession starts a program hidden in the given user session with
+// its standard streams connected to the agent. Only the pipe ends are
+// inherited, none of the agent's other handles.
+func startInSession(sessionID uint32, commandLine string) (*sessionProcess, error) {
+	// The child's ends: stdin read, stdout write, stderr write
+	var child [3]windows.Handle
+	var parent [3]windows.Handle
+	closeAll := func(handles []windows.Handle) {
+		for _, h := range handles {
+			if h != 0 {
+				windows.CloseHandle(h)
+			}
+		}
+	}
+
+	sa := &windows.SecurityAttributes{Length: uint32(unsafe.Sizeof(windows.SecurityAttributes{})), InheritHandle: 1}
+	for i := range child {
+		var read, write windows.Handle
+		if err := windows.CreatePipe(&read, &write, sa, 0); err != nil {
+			closeAll(child[:])
+			closeAll(parent[:])
+			return nil, fmt.Errorf("failed to create helper pipe: %w", err)
+		}
+		if i == 0 {
+			child[i], parent[i] = read, write
+		} else {
+			child[i], parent[i] = write, read
+		}
+		windows.SetHandleInformation(parent[i], windows.HANDLE_FLAG_INHERIT, 0)
+	}
+
+	procInfo, err := createSessionProcess(sessionID, commandLine, child[:])
+	closeAll(child[:])
+	if err != nil {
+		closeAll(parent[:])
+		return nil, err
+	}
+	windows.CloseHandle(procInfo.Thread)
+
+	return &sessionProcess{
+		process: procInfo.Process,
+		stdin:   os.NewFile(uintptr(parent[0]), "helper stdin"),
+		stdout:  os.NewFile(uintptr(parent[1]), "helper stdout"),
+		stderr:  os.NewFile(uintptr(parent[2]), "helper stderr"),
+	}, nil
+}
+
+// stop closes the program's input, which tells it to exit, and terminates
+// it if it is still running after timeout
+func (p *sessionProcess) stop(timeout time.Duration) {
+	p.stdin.Close()
+	if event, err := windows.WaitForSingleObject(p.process, uint32(timeout.Milliseconds())); err != nil || event == uint32(windows.WAIT_TIMEOUT) {
+		windows.TerminateProcess(p.process, 1)
+		windows.WaitForSingleObject(p.process, windows.INFINITE)
+	}
+	windows.CloseHandle(p.process)
+	p.stdout.Close()
+	p.stderr.Close()
+}
+
+// createSessionProcess starts a hidden process as the user of a session.
+// With stdio (stdin, stdout, stderr handles) the process inherits those
+// handles as its standard streams.
+func createSessionProcess(sessionID uint32, commandLine string, stdio []windows.Handle) (*windows.ProcessInformation, error) {
+	if sessionID == noSession {
+		return nil, fmt.Errorf("no interactive user session")
+	}
+
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(sessionID, &token); err != nil {
+		return nil, fmt.Errorf("failed to get user token for session %d: %w", sessionID, err)
+	}
+	defer token.Close()
+
+	var env *uint16
+	if err := windows.CreateEnvironmentBlock(&env, token, false); err != nil {
+		return nil, fmt.Errorf("failed to create environment block: %w", err)
+	}
+	defer windows.DestroyEnvironmentBlock(env)
+
+	commandLinePtr, err := windows.UTF16PtrFromString(commandLine)
+	if err != nil {
+		return nil, err
+	}
+
+	desktop, _ := windows.UTF16PtrFromString(`winsta0\default`)
+	startupInfo := &windows.StartupInfoEx{
+		StartupInfo: windows.StartupInfo{
+			Cb:      uint32(unsafe.Sizeof(windows.StartupInfo{})),
+			Desktop: desktop,
+		},
+	}
+	flags := uint32(windows.CREATE_UNICODE_ENVIRONMENT | windows.CREATE_NO_WINDOW)
+	inherit := false
+
+	if stdio != nil {
+		attributes, err := windows.NewProcThreadAttributeList(1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create process attributes: %w", err)
+		}
+		defer attributes.Delete()
+		if err := attributes.Update(windows.PROC_THREAD_ATTRIBUTE_HANDLE_LIST,
+			unsafe.Pointer(&stdio[0]), uintptr(len(stdio))*unsafe.Sizeof(stdio[0])); err != nil {
+			return nil, fmt.Errorf("failed to set inherited handles: %w", err)
+		}
+
+		startupInfo.Cb = uint32(unsafe.Sizeof(*startupInfo))
+		startupInfo.ProcThreadAttributeList = attributes.List()
+		startupInfo.Flags = windows.STARTF_USESTDHANDLES
+		startupInfo.StdInput = stdio[0]
+		startupInfo.StdOutput = stdio[1]
+		startupInfo.StdErr = stdio[2]
+		flags |= windows.EXTENDED_STARTUPINFO_PRESENT
+		inherit = true
+	}
+
+	var procInfo windows.ProcessInformation
+	err = windows.CreateProcessAsUser(
+		token,
+		nil,
+		commandLinePtr,
+		nil,
+		nil,
+		inherit,
+		flags,
+		env,
+		nil,
+		&startupInfo.StartupInfo,
+		&procInfo,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start helper in session %d: %w", sessionID, err)
+	}
+	return &procInfo, nil
+}
+
+// ShowToast shows a Windows toast notification to the given user
+func ShowToast(userName, title, message string) error {
+	psScript := fmt.Sprintf(`
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName("text")
+$text.Item(0).AppendChild($template.CreateTextNode(%s)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode(%s)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(%s).Show($toast)
+`, psQuote(title), psQuote(message), psQuote(powerShellAppID))
+
+	_, err := RunInSession(FindUserSession(userName), psScript, 0)
+	return err
+}
+
+// psQuote quotes a string as a PowerShell single-quoted literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodePowerShell encodes a script for powershell.exe -EncodedCommand
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	buf := make([]byte, len(units)*2)
+	for i, u := range units {
+		buf[i*2] = byte(u)
+		buf[i*2+1] = byte(u >> 8)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
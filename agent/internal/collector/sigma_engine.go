@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// DetectionStats reports on-agent detection in heartbeats
+type DetectionStats struct {
+	Rules    int       `json:"rules"`    // rules loaded
+	Rejected int       `json:"rejected"` // rules the engine cannot evaluate
+	Alerts   uint64    `json:"alerts"`   // since the agent started
+	LastSync time.Time `json:"last_sync"`
+}
+
+// SigmaEngine evaluates server-distributed Sigma rules against events as
+// they are queued and raises an alert event for every match, so detections
+// fire while the server is unreachable and without waiting for the batch.
+// Rules are compiled once per sync; evaluation is read only and safe from
+// every collector.
+type SigmaEngine struct {
+	config   *config.DetectionConfig
+	agentID  string
+	hostname string
+	fetch    func() ([]string, error)
+
+	mutex    sync.RWMutex
+	rules    []*sigmaRule
+	rejected int
+	alerts   uint64
+	lastSync time.Time
+}
+
+// NewSigmaEngine creates the engine with the rules kept from the last sync
+func NewSigmaEngine(cfg *config.DetectionConfig, agentID, hostname string) *SigmaEngine {
+	e := &SigmaEngine{
+		config:   cfg,
+		agentID:  agentID,
+		hostname: hostname,
+	}
+
+	if data, err := os.ReadFile(cfg.RulesFile); err == nil {
+		var documents []string
+		if err := json.Unmarshal(data, &documents); err != nil {
+			log.Printf("Warning: Failed to read stored Sigma rules: %v", err)
+		} else {
+			e.Load(documents)
+		}
+	}
+
+	return e
+}
+
+// SetRuleSource sets the callback that downloads the rules for this agent
+func (e *SigmaEngine) SetRuleSource(fetch func() ([]string, error)) {
+	e.fetch = fetch
+}
+
+// StartRuleSync downloads the rules immediately and then periodically
+func (e *SigmaEngine) StartRuleSync(ctx context.Context) {
+	if e.fetch == nil {
+		return
+	}
+
+	interval := time.Duration(e.config.SyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = 15 * time.Minute
+	}
+
+	if err := e.SyncRules(); err != nil {
+		log.Printf("Error syncing Sigma rules: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.SyncRules(); err != nil {
+				log.Printf("Error syncing Sigma rules: %v", err)
+			}
+		}
+	}
+}
+
+// SyncRules downloads, loads and stores the rules
+func (e *SigmaEngine) SyncRules() error {
+	documents, err := e.fetch()
+	if err != nil {
+		return fmt.Errorf("failed to fetch Sigma rules: %w", err)
+	}
+
+	e.Load(documents)
+
+	e.mutex.Lock()
+	e.lastSync = time.Now()
+	e.mutex.Unlock()
+
+	data, err := json.Marshal(documents)
+	if err != nil {
+		return fmt.Errorf("failed to encode Sigma rules: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(e.config.RulesFile), 0700); err != nil {
+		return fmt.Errorf("failed to store Sigma rules: %w", err)
+	}
+	if err := os.WriteFile(e.config.RulesFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to store Sigma rules: %w", err)
+	}
+	return nil
+}
+
+// Load replaces the rules with the compiled documents. Rules for other
+// platforms are skipped silently; rules that do not compile are logged.
+func (e *SigmaEngine) Load(documents []string) {
+	rules := make([]*sigmaRule, 0, len(documents))
+	rejected := 0
+	for i, document := range documents {
+		rule, err := compileSigmaRule(document)
+		if err == errSigmaOtherPlatform {
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: Sigma rule %d rejected: %v", i, err)
+			rejected++
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	e.mutex.Lock()
+	e.rules = rules
+	e.rejected = rejected
+	e.mutex.Unlock()
+
+	log.Printf("Loaded %d Sigma rules (%d rejected)", len(rules), rejected)
+}
+
+// Inspect returns an alert event for every rule the event matches. The
+// agent's own health and alert events are not evaluated.
+func (e *SigmaEngine) Inspect(event *Event) []*Event {
+	if event.SourceType == AgentHealthSourceType || event.SourceType == DetectionSourceType {
+		return nil
+	}
+
+	e.mutex.RLock()
+	rules := e.rules
+	e.mutex.RUnlock()
+
+	var alerts []*Event
+	for _, rule := range rules {
+		if rule.logsource(event) && rule.condition(event) {
+			alerts = append(alerts, e.alert(rule, event))
+		}
+	}
+
+	if len(alerts) > 0 {
+		e.mutex.Lock()
+		e.alerts += uint64(len(alerts))
+		e.mutex.Unlock()
+	}
+	return alerts
+}
+
+// alert builds the alert for a match
+func (e *SigmaEngine) alert(rule *sigmaRule, event *Event) *Event {
+	return newDetectionAlert(e.agentID, e.hostname, event, DetectionEventSigmaMatch, rule.severity,
+		fmt.Sprintf("Sigma rule matched: %s", rule.title),
+		map[string]string{
+			"rule_id":    rule.id,
+			"rule_title": rule.title,
+			"rule_level": rule.level,
+			"rule_tags":  strings.Join(rule.tags, ","),
+		})
+}
+
+// Stats returns the rule counts for heartbeats
+func (e *SigmaEngine) Stats() *DetectionStats {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return &DetectionStats{
+		Rules:    len(e.rules),
+		Rejected: e.rejected,
+		Alerts:   e.alerts,
+		LastSync: e.lastSync,
+	}
+}
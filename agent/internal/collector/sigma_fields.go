@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sigmaFieldValue returns the value of a Sigma field. Fields with a
+// normalized counterpart read it, so rules also match lean events, which
+// carry no EventData; other fields are looked up in EventData.
+func sigmaFieldValue(event *Event, field string) (string, bool) {
+	switch strings.ToLower(field) {
+	case "eventid":
+		return strconv.Itoa(event.EventCode), true
+	case "channel":
+		return event.Channel, true
+	case "provider_name":
+		return event.Provider, true
+	case "computer", "computername":
+		return event.Computer, true
+	case "image", "newprocessname":
+		if event.ProcessPath != "" {
+			return event.ProcessPath, true
+		}
+		return event.ProcessName, event.ProcessName != ""
+	case "commandline":
+		return event.ProcessCommandLine, event.ProcessCommandLine != ""
+	case "processid":
+		return strconv.Itoa(event.ProcessID), event.ProcessID != 0
+	case "parentprocessid":
+		return strconv.Itoa(event.ParentProcessID), event.ParentProcessID != 0
+	case "subjectusername":
+		return event.SubjectUser, event.SubjectUser != ""
+	case "subjectdomainname":
+		return event.SubjectDomain, event.SubjectDomain != ""
+	case "targetusername":
+		return event.TargetUser, event.TargetUser != ""
+	case "targetdomainname":
+		return event.TargetDomain, event.TargetDomain != ""
+	case "logontype":
+		return strconv.Itoa(event.LogonType), event.LogonType != 0
+	case "authenticationpackagename":
+		return event.AuthPackage, event.AuthPackage != ""
+	case "workstationname":
+		return event.WorkstationName, event.WorkstationName != ""
+	case "ipaddress", "sourceip":
+		return event.SourceIP, event.SourceIP != ""
+	case "ipport", "sourceport":
+		return strconv.Itoa(event.SourcePort), event.SourcePort != 0
+	case "destinationip":
+		return event.DestinationIP, event.DestinationIP != ""
+	case "destinationport":
+		return strconv.Itoa(event.DestinationPort), event.DestinationPort != 0
+	case "protocol":
+		return event.Protocol, event.Protocol != ""
+	case "targetobject":
+		return event.RegistryPath, event.RegistryPath != ""
+	case "servicename":
+		return event.ServiceName, event.ServiceName != ""
+	}
+
+	if value, ok := event.EventData[field]; ok {
+		return value, true
+	}
+	for name, value := range event.EventData {
+		if strings.EqualFold(name, field) {
+			return value, true
+		}
+	}
+
+	// Fields only some sources put in EventData
+	switch strings.ToLower(field) {
+	case "user":
+		if event.SubjectUser == "" {
+			return "", false
+		}
+		if event.SubjectDomain != "" {
+			return event.SubjectDomain + `\` + event.SubjectUser, true
+		}
+		return event.SubjectUser, true
+	case "parentimage":
+		return event.ParentProcessName, event.ParentProcessName != ""
+	case "targetfilename":
+		return event.FilePath, event.FilePath != ""
+	case "details":
+		return event.RegistryValue, event.RegistryValue != ""
+	case "hashes":
+		if event.FileHash == "" {
+			return "", false
+		}
+		return "SHA256=" + event.FileHash, true
+	}
+	return "", false
+}
+
+// Event Log channels of the Sigma services
+var sigmaServiceChannels = map[string][]string{
+	"security":      {"Security"},
+	"system":        {"System"},
+	"application":   {"Application"},
+	"sysmon":        {"Microsoft-Windows-Sysmon/Operational"},
+	"powershell":    {"Microsoft-Windows-PowerShell/Operational", "Windows PowerShell"},
+	"taskscheduler": {"Microsoft-Windows-TaskScheduler/Operational"},
+	"windefend":     {"Microsoft-Windows-Windows Defender/Operational"},
+	"wmi":           {"Microsoft-Windows-WMI-Activity/Operational"},
+}
+
+// sigmaCategory selects the events of a Sigma category by source type and
+// event ID
+type sigmaCategory struct {
+	sourceType string
+	eventIDs   []int
+}
+
+// Windows Sigma categories; Sysmon supplies most of them
+var sigmaCategories = map[string][]sigmaCategory{
+	"process_creation":     {{"Sysmon", []int{1}}, {"Windows Security", []int{4688}}},
+	"process_termination":  {{"Sysmon", []int{5}}, {"Windows Security", []int{4689}}},
+	"network_connection":   {{"Sysmon", []int{3}}},
+	"driver_load":          {{"Sysmon", []int{6}}},
+	"image_load":           {{"Sysmon", []int{7}}},
+	"create_remote_thread": {{"Sysmon", []int{8}}},
+	"raw_access_thread":    {{"Sysmon", []int{9}}},
+	"process_access":       {{"Sysmon", []int{10}}},
+	"file_event":           {{"Sysmon", []int{11}}},
+	"registry_event":       {{"Sysmon", []int{12, 13, 14}}},
+	"registry_add":         {{"Sysmon", []int{12}}},
+	"registry_delete":      {{"Sysmon", []int{12}}},
+	"registry_set":         {{"Sysmon", []int{13}}},
+	"registry_rename":      {{"Sysmon", []int{14}}},
+	"create_stream_hash":   {{"Sysmon", []int{15}}},
+	"pipe_created":         {{"Sysmon", []int{17, 18}}},
+	"wmi_event":            {{"Sysmon", []int{19, 20, 21}}},
+	"dns_query":            {{"Sysmon", []int{22}}},
+	"file_delete":          {{"Sysmon", []int{23, 26}}},
+	"ps_module":            {{"PowerShell", []int{4103}}},
+	"ps_script":            {{"PowerShell", []int{4104}}},
+}
+
+// sigmaLogsourceMatch selects the events a rule's logsource covers. Unknown
+// categories and services select all events; the detection's fields still
+// have to match.
+func sigmaLogsourceMatch(category, service string) sigmaMatch {
+	var matches []sigmaMatch
+
+	if channels, ok := sigmaServiceChannels[service]; ok {
+		matches = append(matches, func(event *Event) bool {
+			for _, channel := range channels {
+				if strings.EqualFold(event.Channel, channel) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	if categories, ok := sigmaCategories[category]; ok {
+		matches = append(matches, func(event *Event) bool {
+			for _, c := range categories {
+				if event.SourceType != c.sourceType {
+					continue
+				}
+				for _, id := range c.eventIDs {
+					if event.EventCode == id {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+
+	return allOf(matches)
+}
@@ -0,0 +1,559 @@
+package collector
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sigmaDocument is a Sigma rule as distributed by the server
+type sigmaDocument struct {
+	Title     string   `yaml:"title"`
+	ID        string   `yaml:"id"`
+	Level     string   `yaml:"level"`
+	Tags      []string `yaml:"tags"`
+	Logsource struct {
+		Product  string `yaml:"product"`
+		Category string `yaml:"category"`
+		Service  string `yaml:"service"`
+	} `yaml:"logsource"`
+	Detection map[string]interface{} `yaml:"detection"`
+}
+
+// sigmaMatch is a compiled part of a rule's detection
+type sigmaMatch func(event *Event) bool
+
+// sigmaRule is a compiled Sigma rule
+type sigmaRule struct {
+	id        string
+	title     string
+	level     string
+	tags      []string
+	severity  int
+	logsource sigmaMatch
+	condition sigmaMatch
+}
+
+// errSigmaOtherPlatform marks rules written for another operating system
+var errSigmaOtherPlatform = fmt.Errorf("rule is for another platform")
+
+// Sigma levels as event severities
+var sigmaSeverities = map[string]int{
+	"informational": 1,
+	"low":           2,
+	"medium":        3,
+	"high":          4,
+	"critical":      5,
+}
+
+// compileSigmaRule parses and compiles a Sigma rule. Aggregations (count,
+// near) and unknown modifiers are rejected: a rule the engine cannot
+// evaluate exactly would fire wrongly.
+func compileSigmaRule(text string) (*sigmaRule, error) {
+	var doc sigmaDocument
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if doc.Title == "" {
+		return nil, fmt.Errorf("rule has no title")
+	}
+
+	if product := strings.ToLower(doc.Logsource.Product); product != "" {
+		platform := map[string]string{"windows": "windows", "linux": "linux", "macos": "darwin"}[product]
+		if platform != "" && platform != runtime.GOOS {
+			return nil, errSigmaOtherPlatform
+		}
+	}
+
+	rule := &sigmaRule{
+		id:        doc.ID,
+		title:     doc.Title,
+		level:     strings.ToLower(doc.Level),
+		tags:      doc.Tags,
+		logsource: sigmaLogsourceMatch(strings.ToLower(doc.Logsource.Category), strings.ToLower(doc.Logsource.Service)),
+	}
+	rule.severity = sigmaSeverities[rule.level]
+	if rule.severity == 0 {
+		rule.level, rule.severity = "medium", 3
+	}
+
+	searches := make(map[string]sigmaMatch)
+	var conditions []string
+	for name, value := range doc.Detection {
+		if name == "condition" {
+			switch condition := value.(type) {
+			case string:
+				conditions = append(conditions, condition)
+			case []interface{}:
+				for _, item := range condition {
+					conditions = append(conditions, fmt.Sprint(item))
+				}
+			}
+			continue
+		}
+		if name == "timeframe" {
+			return nil, fmt.Errorf("timeframe is not supported")
+		}
+
+		search, err := compileSigmaSearch(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		searches[name] = search
+	}
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("rule has no condition")
+	}
+
+	var alternatives []sigmaMatch
+	for _, condition := range conditions {
+		match, err := parseSigmaCondition(condition, searches)
+		if err != nil {
+			return nil, fmt.Errorf("condition %q: %w", condition, err)
+		}
+		alternatives = append(alternatives, match)
+	}
+	rule.condition = anyOf(alternatives)
+
+	return rule, nil
+}
+
+// compileSigmaSearch compiles a search identifier: a map of fields (all
+// must match), a list of maps (one must match) or a list of keywords
+func compileSigmaSearch(value interface{}) (sigmaMatch, error) {
+	switch search := value.(type) {
+	case map[string]interface{}:
+		var fields []sigmaMatch
+		for key, values := range search {
+			field, err := compileSigmaField(key, values)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+		return allOf(fields), nil
+
+	case []interface{}:
+		var alternatives []sigmaMatch
+		var keywords []interface{}
+		for _, item := range search {
+			if _, ok := item.(map[string]interface{}); ok {
+				alternative, err := compileSigmaSearch(item)
+				if err != nil {
+					return nil, err
+				}
+				alternatives = append(alternatives, alternative)
+			} else {
+				keywords = append(keywords, item)
+			}
+		}
+		if len(keywords) > 0 {
+			keyword, err := compileSigmaKeywords(keywords)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, keyword)
+		}
+		return anyOf(alternatives), nil
+
+	case string, int, float64:
+		return compileSigmaKeywords([]interface{}{search})
+	}
+	return nil, fmt.Errorf("unsupported search of type %T", value)
+}
+
+// compileSigmaKeywords matches keywords anywhere in the message, command
+// line or raw event
+func compileSigmaKeywords(keywords []interface{}) (sigmaMatch, error) {
+	var matchers []func(string) bool
+	for _, keyword := range keywords {
+		matcher, err := sigmaValueMatcher(fmt.Sprint(keyword), "contains")
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return func(event *Event) bool {
+		for _, text := range [...]string{event.Message, event.ProcessCommandLine, event.RawXML} {
+			for _, matcher := range matchers {
+				if text != "" && matcher(text) {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+// compileSigmaField compiles "Field|modifier|...: value or list of values"
+func compileSigmaField(key string, values interface{}) (sigmaMatch, error) {
+	parts := strings.Split(key, "|")
+	field, modifiers := parts[0], parts[1:]
+
+	mode, all := "", false
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "all":
+			all = true
+		case "contains", "startswith", "endswith", "re", "lt", "lte", "gt", "gte":
+			if mode != "" {
+				return nil, fmt.Errorf("modifiers %s and %s combined", mode, modifier)
+			}
+			mode = modifier
+		default:
+			return nil, fmt.Errorf("modifier %q is not supported", modifier)
+		}
+	}
+
+	list, ok := values.([]interface{})
+	if !ok {
+		list = []interface{}{values}
+	}
+
+	var matchers []func(string) bool
+	matchEmpty := false
+	for _, value := range list {
+		if value == nil {
+			matchEmpty = true
+			continue
+		}
+		matcher, err := sigmaValueMatcher(fmt.Sprint(value), mode)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return func(event *Event) bool {
+		value, ok := sigmaFieldValue(event, field)
+		if !ok || value == "" {
+			return matchEmpty
+		}
+		if all {
+			for _, matcher := range matchers {
+				if !matcher(value) {
+					return false
+				}
+			}
+			return len(matchers) > 0
+		}
+		for _, matcher := range matchers {
+			if matcher(value) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// sigmaValueMatcher compiles one value. Comparisons are case-insensitive;
+// * and ? are wildcards unless escaped with a backslash.
+func sigmaValueMatcher(value, mode string) (func(string) bool, error) {
+	switch mode {
+	case "re":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+
+	case "lt", "lte", "gt", "gte":
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a number: %q", mode, value)
+		}
+		return func(s string) bool {
+			number, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return false
+			}
+			switch mode {
+			case "lt":
+				return number < limit
+			case "lte":
+				return number <= limit
+			case "gt":
+				return number > limit
+			}
+			return number >= limit
+		}, nil
+
+	case "contains":
+		value = "*" + value + "*"
+	case "startswith":
+		value = value + "*"
+	case "endswith":
+		value = "*" + value
+	}
+	return sigmaGlob(value), nil
+}
+
+// sigmaGlob matches a Sigma wildcard pattern. The common shapes (exact,
+// prefix, suffix, substring) avoid regular expressions.
+func sigmaGlob(pattern string) func(string) bool {
+	var literal strings.Builder
+	var expr strings.Builder
+	leading, trailing := false, false
+	inner := false
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes) && (runes[i+1] == '*' || runes[i+1] == '?' || runes[i+1] == '\\'):
+			i++
+			literal.WriteRune(runes[i])
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '*' || r == '?':
+			switch {
+			case r == '*' && i == 0:
+				leading = true
+			case r == '*' && i == len(runes)-1:
+				trailing = true
+			default:
+				inner = true
+			}
+			if r == '*' {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString(".")
+			}
+		default:
+			literal.WriteRune(r)
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if inner {
+		re := regexp.MustCompile("(?is)^" + expr.String() + "$")
+		return re.MatchString
+	}
+
+	needle := strings.ToLower(literal.String())
+	switch {
+	case leading && trailing:
+		return func(s string) bool { return containsFold(s, needle) }
+	case leading:
+		return func(s string) bool { return len(s) >= len(needle) && strings.EqualFold(s[len(s)-len(needle):], needle) }
+	case trailing:
+		return func(s string) bool { return len(s) >= len(needle) && strings.EqualFold(s[:len(needle)], needle) }
+	}
+	return func(s string) bool { return strings.EqualFold(s, needle) }
+}
+
+// containsFold reports whether s contains the lower-case needle, ignoring case
+func containsFold(s, needle string) bool {
+	if needle == "" {
+		return true
+	}
+	for i := 0; i+len(needle) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(needle)], needle) {
+			return true
+		}
+	}
+	return false
+}
+
+func allOf(matches []sigmaMatch) sigmaMatch {
+	return func(event *Event) bool {
+		for _, match := range matches {
+			if !match(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func anyOf(matches []sigmaMatch) sigmaMatch {
+	return func(event *Event) bool {
+		for _, match := range matches {
+			if match(event) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sigmaConditionParser parses a condition such as
+// "selection and not 1 of filter_*" by recursive descent:
+// or > and > not > (group), "x of y" and search identifiers
+type sigmaConditionParser struct {
+	tokens   []string
+	position int
+	searches map[string]sigmaMatch
+}
+
+func parseSigmaCondition(condition string, searches map[string]sigmaMatch) (sigmaMatch, error) {
+	if strings.Contains(condition, "|") {
+		return nil, fmt.Errorf("aggregations are not supported")
+	}
+
+	p := &sigmaConditionParser{tokens: tokenizeSigmaCondition(condition), searches: searches}
+	match, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.position < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.position])
+	}
+	return match, nil
+}
+
+func tokenizeSigmaCondition(condition string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range condition {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *sigmaConditionParser) peek() string {
+	if p.position < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.position])
+	}
+	return ""
+}
+
+func (p *sigmaConditionParser) next() string {
+	token := p.tokens[p.position]
+	p.position++
+	return token
+}
+
+func (p *sigmaConditionParser) or() (sigmaMatch, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = anyOf([]sigmaMatch{left, right})
+	}
+	return left, nil
+}
+
+func (p *sigmaConditionParser) and() (sigmaMatch, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = allOf([]sigmaMatch{left, right})
+	}
+	return left, nil
+}
+
+func (p *sigmaConditionParser) not() (sigmaMatch, error) {
+	if p.peek() == "not" {
+		p.next()
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(event *Event) bool { return !operand(event) }, nil
+	}
+	return p.primary()
+}
+
+func (p *sigmaConditionParser) primary() (sigmaMatch, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case "(":
+		p.next()
+		match, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next()
+		return match, nil
+	case "1", "any", "all":
+		p.next()
+		if p.peek() != "of" {
+			return nil, fmt.Errorf("expected of after %s", token)
+		}
+		p.next()
+		if p.peek() == "" {
+			return nil, fmt.Errorf("expected search identifier after of")
+		}
+		matches, err := p.lookup(p.next(), true)
+		if err != nil {
+			return nil, err
+		}
+		if token == "all" {
+			return allOf(matches), nil
+		}
+		return anyOf(matches), nil
+	}
+
+	matches, err := p.lookup(p.next(), false)
+	if err != nil {
+		return nil, err
+	}
+	return matches[0], nil
+}
+
+// lookup resolves a search identifier; with pattern, "them" and wildcards
+// select several
+func (p *sigmaConditionParser) lookup(name string, pattern bool) ([]sigmaMatch, error) {
+	if !pattern {
+		if match, ok := p.searches[name]; ok {
+			return []sigmaMatch{match}, nil
+		}
+		return nil, fmt.Errorf("unknown search identifier %q", name)
+	}
+
+	var matches []sigmaMatch
+	for search, match := range p.searches {
+		selected := false
+		if strings.EqualFold(name, "them") {
+			selected = !strings.HasPrefix(search, "_")
+		} else {
+			selected, _ = path.Match(name, search)
+		}
+		if selected {
+			matches = append(matches, match)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no search identifier matches %q", name)
+	}
+	return matches, nil
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSigmaGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		// exact, ignoring case
+		{"cmd.exe", "CMD.EXE", true},
+		{"cmd.exe", "cmd.exe2", false},
+		{"", "", true},
+		{"", "x", false},
+		// suffix
+		{"*.exe", `C:\Tools\a.EXE`, true},
+		{"*.exe", "a.exe.txt", false},
+		{"*", "anything", true},
+		// prefix; \\ is one backslash, a backslash before other characters is literal
+		{`C:\Windows\\*`, `c:\windows\system32\cmd.exe`, true},
+		{`C:\Windows\\*`, `C:\Users\cmd.exe`, false},
+		// substring
+		{"*powershell*", `C:\PowerShell.exe -enc`, true},
+		{"*powershell*", "pwsh.exe", false},
+		// inner wildcards
+		{"a*c", "abbbc", true},
+		{"a*c", "abd", false},
+		{"a?c", "ABC", true},
+		{"a?c", "ac", false},
+		{"a?c", "a\nc", true},
+		{"a.b*c", "a.bzc", true},
+		{"a.b*c", "axbzc", false},
+		// escapes
+		{`50\*`, "50*", true},
+		{`50\*`, "500", false},
+		{`C:\Windows\*`, `C:\Windows*`, true},
+		{`C:\Windows\*`, `C:\Windows\cmd.exe`, false},
+		{`what\?`, "what?", true},
+		{`what\?`, "whatx", false},
+		{`\\\\server*`, `\\server\share`, true},
+		{`\\\\server*`, `\server\share`, false},
+		{`*\**`, "a*b", true},
+		{`*\**`, "ab", false},
+		{`a\?*c`, "a?xc", true},
+		{`a\?*c`, "abxc", false},
+	}
+
+	for _, tt := range tests {
+		if got := sigmaGlob(tt.pattern)(tt.value); got != tt.want {
+			t.Errorf("sigmaGlob(%q)(%q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseSigmaCondition(t *testing.T) {
+	results := map[string]bool{
+		"a":        true,
+		"b":        false,
+		"sel_x":    true,
+		"sel_y":    true,
+		"filter_1": false,
+		"filter_2": true,
+	}
+
+	tests := []struct {
+		condition string
+		searches  map[string]bool // results when not set
+		want      bool
+		wantErr   string
+	}{
+		{condition: "a", want: true},
+		{condition: "b", want: false},
+		{condition: "a and b", want: false},
+		{condition: "a or b", want: true},
+		{condition: "not b", want: true},
+		{condition: "not not a", want: true},
+		{condition: "a AND NOT b", want: true},
+		{condition: "b and a or a", want: true},
+		{condition: "a or a and b", want: true},
+		{condition: "b and (a or a)", want: false},
+		{condition: "not (a and b)", want: true},
+		{condition: "((a))", want: true},
+		{condition: "all of sel_*", want: true},
+		{condition: "all of filter_*", want: false},
+		{condition: "1 of filter_*", want: true},
+		{condition: "any of filter_*", want: true},
+		{condition: "sel_x and not 1 of filter_*", want: false},
+		{condition: "1 of them", want: true},
+		{condition: "all of them", want: false},
+		{condition: "all of them", searches: map[string]bool{"a": true, "_hidden": false}, want: true},
+		{condition: "1 of them", searches: map[string]bool{"b": false, "_hidden": true}, want: false},
+
+		{condition: "a | count() > 5", wantErr: "aggregations are not supported"},
+		{condition: "c", wantErr: `unknown search identifier "c"`},
+		{condition: "(a or b", wantErr: "missing )"},
+		{condition: "a b", wantErr: `unexpected "b"`},
+		{condition: "a )", wantErr: `unexpected ")"`},
+		{condition: "", wantErr: "unexpected end of condition"},
+		{condition: "a and", wantErr: "unexpected end of condition"},
+		{condition: "all a", wantErr: "expected of after all"},
+		{condition: "1 of", wantErr: "expected search identifier after of"},
+		{condition: "1 of other_*", wantErr: `no search identifier matches "other_*"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			results := results
+			if tt.searches != nil {
+				results = tt.searches
+			}
+			searches := make(map[string]sigmaMatch, len(results))
+			for name, result := range results {
+				result := result
+				searches[name] = func(*Event) bool { return result }
+			}
+
+			match, err := parseSigmaCondition(tt.condition, searches)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := match(&Event{}); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package collector
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// simulatedKind generates one kind of synthetic event
+type simulatedKind struct {
+	name     string
+	generate func(event *Event, rnd *rand.Rand)
+}
+
+// Synthetic event kinds with field sizes close to their real counterparts
+var simulatedKinds = []simulatedKind{
+	{"logon", simulateLogon},
+	{"logon_failed", simulateLogonFailed},
+	{"logoff", simulateLogoff},
+	{"process", simulateProcess},
+	{"network", simulateNetwork},
+	{"registry", simulateRegistry},
+	{"powershell", simulatePowerShell},
+	{"service", simulateService},
+}
+
+// DefaultSimulationMix resembles a busy member server
+const DefaultSimulationMix = "logon=30,logon_failed=2,logoff=20,process=20,network=20,registry=5,powershell=2,service=1"
+
+// Simulated events are generated in steps of this length
+const simulationTick = 10 * time.Millisecond
+
+// ParseSimulationMix parses an event mix such as "logon=30,process=20" into
+// weights by kind
+func ParseSimulationMix(spec string) (map[string]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultSimulationMix
+	}
+
+	mix := make(map[string]int)
+	for _, part := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in event mix: %q", part)
+		}
+		if findSimulatedKind(name) == nil {
+			names := make([]string, len(simulatedKinds))
+			for i, kind := range simulatedKinds {
+				names[i] = kind.name
+			}
+			return nil, fmt.Errorf("unknown event kind %q (known: %s)", name, strings.Join(names, ", "))
+		}
+		mix[name] += weight
+	}
+	return mix, nil
+}
+
+// findSimulatedKind returns the kind with the given name, or nil
+func findSimulatedKind(name string) *simulatedKind {
+	for i := range simulatedKinds {
+		if simulatedKinds[i].name == name {
+			return &simulatedKinds[i]
+		}
+	}
+	return nil
+}
+
+// EventSimulator pushes synthetic events into the send queue at a fixed
+// rate, so the queue, batching, serialization and sending can be measured
+// without a busy host
+type EventSimulator struct {
+	agentID    string
+	hostname   string
+	eps        int
+	kinds      []*simulatedKind
+	weights    []int // cumulative
+	eventQueue *EventQueue
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	generated  atomic.Uint64
+}
+
+// NewEventSimulator creates a simulator producing eps events per second
+// in the proportions of mix
+func NewEventSimulator(agentID, hostname string, eps int, mix map[string]int, eventQueue *EventQueue) (*EventSimulator, error) {
+	if eps <= 0 {
+		return nil, fmt.Errorf("events per second must be positive")
+	}
+
+	s := &EventSimulator{
+		agentID:    agentID,
+		hostname:   hostname,
+		eps:        eps,
+		eventQueue: eventQueue,
+		stopChan:   make(chan struct{}),
+	}
+
+	names := make([]string, 0, len(mix))
+	for name := range mix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	total := 0
+	for _, name := range names {
+		if mix[name] == 0 {
+			continue
+		}
+		total += mix[name]
+		s.kinds = append(s.kinds, findSimulatedKind(name))
+		s.weights = append(s.weights, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("event mix is empty")
+	}
+
+	return s, nil
+}
+
+// Start begins generating events
+func (s *EventSimulator) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop stops generating events
+func (s *EventSimulator) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Generated returns the number of events generated
+func (s *EventSimulator) Generated() uint64 {
+	return s.generated.Load()
+}
+
+// run generates the events due since the start on every tick, so the rate
+// holds even when a tick is late
+func (s *EventSimulator) run() {
+	defer s.wg.Done()
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ticker := time.NewTicker(simulationTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var recordID int64
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			due := uint64(now.Sub(start).Seconds() * float64(s.eps))
+			for s.generated.Load() < due {
+				recordID++
+				s.eventQueue.Push(s.generate(rnd, recordID))
+				s.generated.Add(1)
+			}
+		}
+	}
+}
+
+// generate builds one event of a kind picked by weight
+func (s *EventSimulator) generate(rnd *rand.Rand, recordID int64) *Event {
+	pick := rnd.Intn(s.weights[len(s.weights)-1])
+	kind := s.kinds[sort.SearchInts(s.weights, pick+1)]
+
+	event := acquireEvent()
+	event.AgentID = s.agentID
+	event.Computer = s.hostname
+	event.EventTime = time.Now()
+	event.CollectedAt = event.EventTime
+	event.Severity = 1
+	if event.EventData == nil {
+		event.EventData = make(map[string]string)
+	}
+	kind.generate(event, rnd)
+
+	// Simulated channels are not Event Log channels: the record watermarks
+	// must not move
+	event.Channel = "Simulated/" + event.Channel
+	event.RecordID = recordID
+	event.RawXML = simulatedXML(event)
+	return event
+}
+
+// simulatedXML renders an event the size of its real Event Log XML
+func simulatedXML(event *Event) string {
+	var b strings.Builder
+	b.Grow(1024 + 64*len(event.EventData))
+	fmt.Fprintf(&b, `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event"><System><Provider Name="%s"/>`+
+		`<EventID>%d</EventID><Version>2</Version><Level>0</Level><Task>12544</Task><Opcode>0</Opcode>`+
+		`<Keywords>0x8020000000000000</Keywords><TimeCreated SystemTime="%s"/><EventRecordID>%d</EventRecordID>`+
+		`<Correlation/><Execution ProcessID="780" ThreadID="6204"/><Channel>%s</Channel><Computer>%s</Computer>`+
+		`<Security/></System><EventData>`,
+		event.Provider, event.EventCode, event.EventTime.UTC().Format(time.RFC3339Nano), event.RecordID,
+		event.Channel, event.Computer)
+	for name, value := range event.EventData {
+		fmt.Fprintf(&b, `<Data Name="%s">%s</Data>`, name, value)
+	}
+	b.WriteString(`</EventData></Event>`)
+	return b.String()
+}
+
+var (
+	simulatedUsers     = []string{"jsmith", "aivanova", "svc_backup", "svc_sql", "pkuznetsov", "admin.m", "mlee", "WS0142$"}
+	simulatedProcesses = []string{
+		`C:\Windows\System32\svchost.exe`, `C:\Windows\System32\cmd.exe`, `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`,
+		`C:\Program Files\Google\Chrome\Application\chrome.exe`, `C:\Windows\System32\conhost.exe`, `C:\Windows\System32\wbem\WmiPrvSE.exe`,
+		`C:\Program Files\Microsoft Office\root\Office16\OUTLOOK.EXE`, `C:\Windows\System32\taskhostw.exe`,
+	}
+)
+
+func simulatedIP(rnd *rand.Rand) string {
+	return fmt.Sprintf("10.%d.%d.%d", rnd.Intn(32), rnd.Intn(256), 1+rnd.Intn(254))
+}
+
+func simulatedLogonID(rnd *rand.Rand) string {
+	return fmt.Sprintf("0x%x", 0x10000+rnd.Intn(0xffffff))
+}
+
+func simulatedSecurity(event *Event, eventCode int) {
+	event.SourceType = "Windows Security"
+	event.Channel = "Security"
+	event.Provider = "Microsoft-Windows-Security-Auditing"
+	event.EventCode = eventCode
+}
+
+func simulatedSysmon(event *Event, eventCode int) {
+	event.SourceType = "Sysmon"
+	event.Channel = "Microsoft-Windows-Sysmon/Operational"
+	event.Provider = "Microsoft-Windows-Sysmon"
+	event.EventCode = eventCode
+}
+
+func simulateLogon(event *Event, rnd *rand.Rand) {
+	simulatedSecurity(event, 4624)
+	event.TargetUser = simulatedUsers[rnd.Intn(len(simulatedUsers))]
+	event.TargetDomain = "CORP"
+	event.TargetLogonID = simulatedLogonID(rnd)
+	event.LogonType = []int{2, 3, 3, 3, 5, 10}[rnd.Intn(6)]
+	event.AuthPackage = []string{"Kerberos", "NTLM", "Negotiate"}[rnd.Intn(3)]
+	event.SourceIP = simulatedIP(rnd)
+	event.SourcePort = 49152 + rnd.Intn(16384)
+	event.WorkstationName = fmt.Sprintf("WS%04d", rnd.Intn(2000))
+	event.ProcessName = `C:\Windows\System32\lsass.exe`
+	event.Message = fmt.Sprintf("An account was successfully logged on: %s\\%s (logon type %d)",
+		event.TargetDomain, event.TargetUser, event.LogonType)
+	event.EventData["TargetUserName"] = event.TargetUser
+	event.EventData["TargetDomainName"] = event.TargetDomain
+	event.EventData["TargetLogonId"] = event.TargetLogonID
+	event.EventData["LogonType"] = strconv.Itoa(event.LogonType)
+	event.EventData["AuthenticationPackageName"] = event.AuthPackage
+	event.EventData["IpAddress"] = event.SourceIP
+	event.EventData["IpPort"] = strconv.Itoa(event.SourcePort)
+	event.EventData["LogonGuid"] = "{00000000-0000-0000-0000-000000000000}"
+}
+
+func simulateLogonFailed(event *Event, rnd *rand.Rand) {
+	simulateLogon(event, rnd)
+	event.EventCode = 4625
+	event.Severity = 3
+	event.FailureReason = "Unknown user name or bad password."
+	event.Message = fmt.Sprintf("An account failed to log on: %s\\%s", event.TargetDomain, event.TargetUser)
+	event.EventData["Status"] = "0xc000006d"
+	event.EventData["SubStatus"] = "0xc000006a"
+}
+
+func simulateLogoff(event *Event, rnd *rand.Rand) {
+	simulatedSecurity(event, 4634)
+	event.TargetUser = simulatedUsers[rnd.Intn(len(simulatedUsers))]
+	event.TargetDomain = "CORP"
+	event.TargetLogonID = simulatedLogonID(rnd)
+	event.LogonType = 3
+	event.Message = "An account was logged off: " + event.TargetDomain + `\` + event.TargetUser
+	event.EventData["TargetUserName"] = event.TargetUser
+	event.EventData["TargetLogonId"] = event.TargetLogonID
+}
+
+func simulateProcess(event *Event, rnd *rand.Rand) {
+	simulatedSysmon(event, 1)
+	event.ProcessID = 1000 + rnd.Intn(60000)
+	event.ProcessPath = simulatedProcesses[rnd.Intn(len(simulatedProcesses))]
+	event.ProcessName = event.ProcessPath[strings.LastIndex(event.ProcessPath, `\`)+1:]
+	event.ProcessCommandLine = fmt.Sprintf(`"%s" -k netsvcs -p -s Schedule --id %d`, event.ProcessPath, rnd.Int63())
+	event.ParentProcessID = 1000 + rnd.Intn(60000)
+	event.ParentProcessName = "services.exe"
+	event.SubjectUser = simulatedUsers[rnd.Intn(len(simulatedUsers))]
+	event.SubjectDomain = "CORP"
+	event.FileHash = fmt.Sprintf("%016x%016x%016x%016x", rnd.Uint64(), rnd.Uint64(), rnd.Uint64(), rnd.Uint64())
+	event.Message = "Process Create: " + event.ProcessPath
+	event.EventData["Image"] = event.ProcessPath
+	event.EventData["CommandLine"] = event.ProcessCommandLine
+	event.EventData["CurrentDirectory"] = `C:\Windows\system32\`
+	event.EventData["User"] = event.SubjectDomain + `\` + event.SubjectUser
+	event.EventData["Hashes"] = "SHA256=" + event.FileHash
+	event.EventData["ParentImage"] = `C:\Windows\System32\services.exe`
+	event.EventData["IntegrityLevel"] = "System"
+}
+
+func simulateNetwork(event *Event, rnd *rand.Rand) {
+	simulatedSysmon(event, 3)
+	event.ProcessID = 1000 + rnd.Intn(60000)
+	event.ProcessPath = simulatedProcesses[rnd.Intn(len(simulatedProcesses))]
+	event.ProcessName = event.ProcessPath[strings.LastIndex(event.ProcessPath, `\`)+1:]
+	event.Protocol = "tcp"
+	event.SourceIP = simulatedIP(rnd)
+	event.SourcePort = 49152 + rnd.Intn(16384)
+	event.DestinationIP = fmt.Sprintf("%d.%d.%d.%d", 1+rnd.Intn(223), rnd.Intn(256), rnd.Intn(256), 1+rnd.Intn(254))
+	event.DestinationPort = []int{443, 443, 443, 80, 53, 445, 3389}[rnd.Intn(7)]
+	event.Message = fmt.Sprintf("Network connection detected: %s %s:%d -> %s:%d", event.ProcessName,
+		event.SourceIP, event.SourcePort, event.DestinationIP, event.DestinationPort)
+	event.EventData["Image"] = event.ProcessPath
+	event.EventData["Protocol"] = event.Protocol
+	event.EventData["Initiated"] = "true"
+	event.EventData["SourceIp"] = event.SourceIP
+	event.EventData["DestinationIp"] = event.DestinationIP
+	event.EventData["DestinationPort"] = strconv.Itoa(event.DestinationPort)
+}
+
+func simulateRegistry(event *Event, rnd *rand.Rand) {
+	simulatedSysmon(event, 13)
+	event.ProcessPath = simulatedProcesses[rnd.Intn(len(simulatedProcesses))]
+	event.ProcessName = event.ProcessPath[strings.LastIndex(event.ProcessPath, `\`)+1:]
+	event.RegistryPath = fmt.Sprintf(`HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\Run\Updater%d`, rnd.Intn(100))
+	event.RegistryValue = `C:\ProgramData\Updater\update.exe /silent`
+	event.ObjectType = "Registry"
+	event.Message = "Registry value set: " + event.RegistryPath
+	event.EventData["EventType"] = "SetValue"
+	event.EventData["TargetObject"] = event.RegistryPath
+	event.EventData["Details"] = event.RegistryValue
+}
+
+func simulatePowerShell(event *Event, rnd *rand.Rand) {
+	event.SourceType = "PowerShell"
+	event.Channel = "Microsoft-Windows-PowerShell/Operational"
+	event.Provider = "Microsoft-Windows-PowerShell"
+	event.EventCode = 4104
+	event.Severity = 2
+	event.SubjectUser = simulatedUsers[rnd.Intn(len(simulatedUsers))]
+	script := strings.Repeat("Get-ChildItem -Path $env:ProgramData -Recurse | Where-Object { $_.Length -gt 1MB } | "+
+		"Select-Object FullName, Length\n", 4+rnd.Intn(40))
+	event.Message = "Creating Scriptblock text (1 of 1):\n" + script
+	event.EventData["ScriptBlockText"] = script
+	event.EventData["ScriptBlockId"] = fmt.Sprintf("%08x-0000-0000-0000-%012x", rnd.Uint32(), rnd.Int63n(1<<48))
+}
+
+func simulateService(event *Event, rnd *rand.Rand) {
+	event.SourceType = "Windows System"
+	event.Channel = "System"
+	event.Provider = "Service Control Manager"
+	event.EventCode = 7045
+	event.Severity = 4
+	event.ServiceName = fmt.Sprintf("UpdaterSvc%d", rnd.Intn(1000))
+	event.ServiceType = "user mode service"
+	event.ServiceAccount = "LocalSystem"
+	event.FilePath = `C:\ProgramData\Updater\svc.exe`
+	event.Message = "A service was installed in the system: " + event.ServiceName
+	event.EventData["ServiceName"] = event.ServiceName
+	event.EventData["ImagePath"] = event.FilePath
+	event.EventData["StartType"] = "auto start"
+}
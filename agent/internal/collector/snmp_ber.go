@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The subset of BER (X.690) that SNMP messages use: definite lengths,
+// single-byte tags, INTEGER, OCTET STRING, NULL, OBJECT IDENTIFIER,
+// SEQUENCE and the SNMP application types
+
+// BER and SNMP tags
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+
+	snmpIPAddress  = 0x40
+	snmpCounter32  = 0x41
+	snmpGauge32    = 0x42
+	snmpTimeTicks  = 0x43
+	snmpCounter64  = 0x46
+	snmpUInteger32 = 0x47
+
+	snmpNoSuchObject   = 0x80
+	snmpNoSuchInstance = 0x81
+	snmpEndOfMibView   = 0x82
+
+	snmpPDUResponse = 0xa2
+	snmpPDUTrapV1   = 0xa4
+	snmpPDUInform   = 0xa6
+	snmpPDUTrapV2   = 0xa7
+)
+
+var errBERTruncated = errors.New("truncated BER data")
+
+// berElement is one decoded TLV. value aliases the packet, so the offset
+// of a field in the packet can be recovered (see berOffset).
+type berElement struct {
+	tag   byte
+	value []byte
+}
+
+// berRead decodes the element at the start of data and returns it and the
+// bytes after it
+func berRead(data []byte) (berElement, []byte, error) {
+	if len(data) < 2 {
+		return berElement{}, nil, errBERTruncated
+	}
+	tag := data[0]
+	length := int(data[1])
+	pos := 2
+
+	if length&0x80 != 0 {
+		octets := length & 0x7f
+		if octets == 0 || octets > 4 || len(data) < pos+octets {
+			return berElement{}, nil, fmt.Errorf("invalid BER length")
+		}
+		length = 0
+		for _, b := range data[pos : pos+octets] {
+			length = length<<8 | int(b)
+		}
+		pos += octets
+	}
+	if length < 0 || len(data)-pos < length {
+		return berElement{}, nil, errBERTruncated
+	}
+	return berElement{tag: tag, value: data[pos : pos+length]}, data[pos+length:], nil
+}
+
+// berExpect decodes the next element and checks its tag
+func berExpect(data []byte, tag byte) (berElement, []byte, error) {
+	element, rest, err := berRead(data)
+	if err != nil {
+		return element, nil, err
+	}
+	if element.tag != tag {
+		return element, nil, fmt.Errorf("expected BER tag 0x%02x, got 0x%02x", tag, element.tag)
+	}
+	return element, rest, nil
+}
+
+// berElements decodes the contents of a constructed element
+func berElements(data []byte) ([]berElement, error) {
+	var elements []berElement
+	for len(data) > 0 {
+		element, rest, err := berRead(data)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		data = rest
+	}
+	return elements, nil
+}
+
+// berOffset returns where a slice taken from packet starts in it
+func berOffset(packet, part []byte) int {
+	return cap(packet) - cap(part)
+}
+
+// int decodes a signed INTEGER
+func (e berElement) int() (int64, error) {
+	if len(e.value) == 0 || len(e.value) > 8 {
+		return 0, fmt.Errorf("invalid BER integer length %d", len(e.value))
+	}
+	n := int64(int8(e.value[0]))
+	for _, b := range e.value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// uint decodes an unsigned application integer (Counter, Gauge, TimeTicks)
+func (e berElement) uint() uint64 {
+	var n uint64
+	for _, b := range e.value {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// oid decodes an OBJECT IDENTIFIER to dotted form
+func (e berElement) oid() (string, error) {
+	if len(e.value) == 0 {
+		return "", fmt.Errorf("empty OID")
+	}
+	var parts []string
+	var arc uint64
+	for i, b := range e.value {
+		arc = arc<<7 | uint64(b&0x7f)
+		if b&0x80 != 0 {
+			if i == len(e.value)-1 {
+				return "", errBERTruncated
+			}
+			continue
+		}
+		if parts == nil {
+			// The first arc encodes the first two components
+			first := min(arc/40, 2)
+			parts = append(parts, strconv.FormatUint(first, 10), strconv.FormatUint(arc-first*40, 10))
+		} else {
+			parts = append(parts, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// snmpValue formats a varbind value as text
+func snmpValue(e berElement) string {
+	switch e.tag {
+	case berInteger:
+		if n, err := e.int(); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+	case berOctetString:
+		return snmpOctetString(e.value)
+	case berNull:
+		return ""
+	case berOID:
+		oid, _ := e.oid()
+		return oid
+	case snmpIPAddress:
+		if len(e.value) == 4 {
+			return net.IP(e.value).String()
+		}
+		return hex.EncodeToString(e.value)
+	case snmpCounter32, snmpGauge32, snmpTimeTicks, snmpCounter64, snmpUInteger32:
+		return strconv.FormatUint(e.uint(), 10)
+	case snmpNoSuchObject:
+		return "noSuchObject"
+	case snmpNoSuchInstance:
+		return "noSuchInstance"
+	case snmpEndOfMibView:
+		return "endOfMibView"
+	}
+	return hex.EncodeToString(e.value)
+}
+
+// snmpOctetString returns printable strings as they are and binary values
+// (MAC addresses, bit strings) as colon-separated hex
+func snmpOctetString(value []byte) string {
+	if text := strings.TrimRight(string(value), "\x00"); utf8.ValidString(text) {
+		printable := true
+		for _, r := range text {
+			if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return text
+		}
+	}
+
+	parts := make([]string, len(value))
+	for i, b := range value {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
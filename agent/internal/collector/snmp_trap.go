@@ -0,0 +1,577 @@
+package collector
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const SNMPTrapSourceType = "snmp_trap"
+
+const (
+	// Largest trap accepted; SNMP over UDP is limited to one datagram
+	snmpMaxMessageSize = 65507
+
+	// Varbinds kept per trap
+	snmpMaxVarbinds = 64
+
+	// Reverse DNS results for sending devices are cached this long
+	snmpNameCacheTTL  = time.Hour
+	snmpNameCacheSize = 4096
+
+	// An authenticated v3 message older than this is a replay (RFC 3414 3.2)
+	snmpTimeWindow = 150
+)
+
+// Well-known OIDs
+const (
+	snmpOIDSysUpTime    = "1.3.6.1.2.1.1.3.0"
+	snmpOIDTrapOID      = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpOIDGenericTraps = "1.3.6.1.6.3.1.1.5"
+)
+
+// snmpOIDNames names the objects traps commonly carry; table columns get
+// the instance appended (ifOperStatus.3)
+var snmpOIDNames = map[string]string{
+	"1.3.6.1.2.1.1.1":         "sysDescr",
+	"1.3.6.1.2.1.1.3":         "sysUpTime",
+	"1.3.6.1.2.1.1.5":         "sysName",
+	"1.3.6.1.2.1.1.6":         "sysLocation",
+	"1.3.6.1.2.1.2.2.1.1":     "ifIndex",
+	"1.3.6.1.2.1.2.2.1.2":     "ifDescr",
+	"1.3.6.1.2.1.2.2.1.3":     "ifType",
+	"1.3.6.1.2.1.2.2.1.7":     "ifAdminStatus",
+	"1.3.6.1.2.1.2.2.1.8":     "ifOperStatus",
+	"1.3.6.1.2.1.31.1.1.1.1":  "ifName",
+	"1.3.6.1.2.1.31.1.1.1.18": "ifAlias",
+	"1.3.6.1.6.3.1.1.4.1":     "snmpTrapOID",
+	"1.3.6.1.6.3.1.1.4.3":     "snmpTrapEnterprise",
+	"1.3.6.1.6.3.18.1.3":      "snmpTrapAddress",
+	"1.3.6.1.6.3.1.1.5.1":     "coldStart",
+	"1.3.6.1.6.3.1.1.5.2":     "warmStart",
+	"1.3.6.1.6.3.1.1.5.3":     "linkDown",
+	"1.3.6.1.6.3.1.1.5.4":     "linkUp",
+	"1.3.6.1.6.3.1.1.5.5":     "authenticationFailure",
+	"1.3.6.1.6.3.1.1.5.6":     "egpNeighborLoss",
+}
+
+// snmpTrapSeverities are the severities of the generic traps
+var snmpTrapSeverities = map[string]int{
+	"1.3.6.1.6.3.1.1.5.1": 2, // coldStart
+	"1.3.6.1.6.3.1.1.5.2": 2, // warmStart
+	"1.3.6.1.6.3.1.1.5.3": 3, // linkDown
+	"1.3.6.1.6.3.1.1.5.4": 1, // linkUp
+	"1.3.6.1.6.3.1.1.5.5": 4, // authenticationFailure
+	"1.3.6.1.6.3.1.1.5.6": 3, // egpNeighborLoss
+}
+
+// snmpTrap is a decoded v1, v2c or v3 notification
+type snmpTrap struct {
+	version    string // "v1", "v2c" or "v3"
+	user       string // v3 security name
+	engineID   string // v3 sending engine, hex
+	trapOID    string
+	enterprise string // v1
+	agentAddr  string // v1 agent-addr, the device behind a relay
+	uptime     uint64 // hundredths of a second
+	varbinds   []snmpVarbind
+	inform     bool
+	pduOffset  int // where the PDU tag is, to acknowledge v2c informs
+}
+
+// snmpVarbind is one variable binding of a trap
+type snmpVarbind struct {
+	oid   string
+	value string
+}
+
+// snmpEngineClock is the last authenticated boots and time seen from an
+// engine, for replay protection
+type snmpEngineClock struct {
+	boots int64
+	time  int64
+}
+
+// snmpDeviceName is a cached reverse DNS result
+type snmpDeviceName struct {
+	name    string
+	expires time.Time
+}
+
+// SNMPTrapListener receives SNMP traps and informs from network devices on
+// the agent's segment and queues them as events attributed to the sending
+// device, so branch-office agents act as collectors for switches, routers,
+// UPSs and printers
+type SNMPTrapListener struct {
+	config     *config.SNMPTrapConfig
+	agentID    string
+	hostname   string
+	eventQueue *EventQueue
+
+	communities map[string]bool
+	users       map[string]*snmpUSMUser
+	allowed     []*net.IPNet
+
+	conn     *net.UDPConn
+	wg       sync.WaitGroup
+	stopChan chan struct{}
+
+	// Used only by the receive goroutine
+	clocks map[string]snmpEngineClock
+	names  map[string]snmpDeviceName
+}
+
+// NewSNMPTrapListener creates the trap listener; it binds when started
+func NewSNMPTrapListener(cfg *config.Config, agentID string, eventQueue *EventQueue) (*SNMPTrapListener, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	l := &SNMPTrapListener{
+		config:      &cfg.SNMPTrap,
+		agentID:     agentID,
+		hostname:    hostname,
+		eventQueue:  eventQueue,
+		communities: make(map[string]bool),
+		users:       make(map[string]*snmpUSMUser),
+		stopChan:    make(chan struct{}),
+		clocks:      make(map[string]snmpEngineClock),
+		names:       make(map[string]snmpDeviceName),
+	}
+
+	for _, community := range cfg.SNMPTrap.Communities {
+		l.communities[community] = true
+	}
+	for _, userCfg := range cfg.SNMPTrap.Users {
+		user, err := newSNMPUSMUser(userCfg)
+		if err != nil {
+			return nil, fmt.Errorf("SNMPv3 user %s: %w", userCfg.Name, err)
+		}
+		l.users[userCfg.Name] = user
+	}
+	if l.allowed, err = parseAllowedSources(cfg.SNMPTrap.AllowedSources); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Start binds the trap port and begins receiving
+func (l *SNMPTrapListener) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", l.config.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %w", err)
+	}
+	l.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", l.config.Listen, err)
+	}
+
+	log.Printf("Receiving SNMP traps on %s (%d communities, %d v3 users)", l.config.Listen, len(l.communities), len(l.users))
+
+	l.wg.Add(1)
+	go l.receive()
+	return nil
+}
+
+// Stop closes the socket and waits for the receiver
+func (l *SNMPTrapListener) Stop() {
+	close(l.stopChan)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.wg.Wait()
+	log.Println("SNMP trap listener stopped")
+}
+
+// receive reads traps until the listener stops
+func (l *SNMPTrapListener) receive() {
+	defer l.wg.Done()
+
+	buffer := make([]byte, snmpMaxMessageSize)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-l.stopChan:
+				return
+			default:
+			}
+			log.Printf("Error receiving SNMP trap: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if !sourceAllowed(l.allowed, from.IP) {
+			continue
+		}
+
+		packet := make([]byte, n)
+		copy(packet, buffer[:n])
+		trap, err := l.decode(packet)
+		if err != nil {
+			log.Printf("Dropped SNMP message from %s: %v", from.IP, err)
+			continue
+		}
+
+		// A v2c inform is acknowledged with the same message as a Response
+		if trap.inform && trap.version == "v2c" {
+			response := make([]byte, len(packet))
+			copy(response, packet)
+			response[trap.pduOffset] = snmpPDUResponse
+			l.conn.WriteToUDP(response, from)
+		}
+
+		l.eventQueue.Push(l.newEvent(trap, from.IP))
+	}
+}
+
+// decode parses and, for v3, authenticates and decrypts a message
+func (l *SNMPTrapListener) decode(packet []byte) (*snmpTrap, error) {
+	message, _, err := berExpect(packet, berSequence)
+	if err != nil {
+		return nil, err
+	}
+	versionElement, rest, err := berExpect(message.value, berInteger)
+	if err != nil {
+		return nil, err
+	}
+	version, err := versionElement.int()
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case 0, 1:
+		community, rest, err := berExpect(rest, berOctetString)
+		if err != nil {
+			return nil, err
+		}
+		if len(l.communities) > 0 && !l.communities[string(community.value)] {
+			return nil, fmt.Errorf("unknown community")
+		}
+		trap := &snmpTrap{version: "v1", pduOffset: berOffset(packet, rest)}
+		if version == 1 {
+			trap.version = "v2c"
+		}
+		return trap, decodeSNMPPDU(rest, trap)
+	case 3:
+		return l.decodeV3(packet, rest)
+	}
+	return nil, fmt.Errorf("unsupported SNMP version %d", version)
+}
+
+// decodeV3 processes the USM security parameters of a v3 message
+func (l *SNMPTrapListener) decodeV3(packet, data []byte) (*snmpTrap, error) {
+	globalData, rest, err := berExpect(data, berSequence)
+	if err != nil {
+		return nil, err
+	}
+	global, err := berElements(globalData.value)
+	if err != nil || len(global) != 4 || len(global[2].value) != 1 {
+		return nil, fmt.Errorf("invalid v3 header")
+	}
+	if model, _ := global[3].int(); model != 3 {
+		return nil, fmt.Errorf("unsupported security model %d", model)
+	}
+	flags := global[2].value[0]
+	authFlag, privFlag := flags&0x01 != 0, flags&0x02 != 0
+
+	securityParams, rest, err := berExpect(rest, berOctetString)
+	if err != nil {
+		return nil, err
+	}
+	usmData, _, err := berExpect(securityParams.value, berSequence)
+	if err != nil {
+		return nil, err
+	}
+	usm, err := berElements(usmData.value)
+	if err != nil || len(usm) != 6 {
+		return nil, fmt.Errorf("invalid USM parameters")
+	}
+	engineID, userName := usm[0].value, string(usm[3].value)
+	boots, _ := usm[1].int()
+	engineTime, _ := usm[2].int()
+
+	user, ok := l.users[userName]
+	if !ok {
+		return nil, fmt.Errorf("unknown user %q", userName)
+	}
+
+	// The message must use exactly the user's security level
+	if authFlag != (user.authKey != nil) || privFlag != (user.privKey != nil) {
+		return nil, fmt.Errorf("security level does not match user %q", userName)
+	}
+	if authFlag {
+		if !user.authenticate(packet, usm[4].value, engineID) {
+			return nil, fmt.Errorf("authentication failed for user %q", userName)
+		}
+		if !l.timely(engineID, boots, engineTime) {
+			return nil, fmt.Errorf("message outside the time window for user %q", userName)
+		}
+	}
+
+	scoped := rest
+	if privFlag {
+		encrypted, _, err := berExpect(rest, berOctetString)
+		if err != nil {
+			return nil, err
+		}
+		if scoped, err = user.decrypt(encrypted.value, usm[5].value, engineID, uint32(boots), uint32(engineTime)); err != nil {
+			return nil, fmt.Errorf("decryption failed for user %q: %w", userName, err)
+		}
+	}
+
+	// ScopedPDU: contextEngineID, contextName, PDU. Decrypted data may
+	// carry padding after the sequence.
+	scopedPDU, _, err := berExpect(scoped, berSequence)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scoped PDU: %w", err)
+	}
+	_, pdu, err := berExpect(scopedPDU.value, berOctetString)
+	if err == nil {
+		_, pdu, err = berExpect(pdu, berOctetString)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid scoped PDU: %w", err)
+	}
+
+	trap := &snmpTrap{version: "v3", user: userName, engineID: hex.EncodeToString(engineID)}
+	return trap, decodeSNMPPDU(pdu, trap)
+}
+
+// timely rejects replays of authenticated messages: the engine's boots
+// may not go back, and within a boot its time may not fall more than the
+// window behind the latest seen
+func (l *SNMPTrapListener) timely(engineID []byte, boots, engineTime int64) bool {
+	last, seen := l.clocks[string(engineID)]
+	switch {
+	case !seen || boots > last.boots:
+	case boots < last.boots || engineTime < last.time-snmpTimeWindow:
+		return false
+	}
+	if !seen || boots > last.boots || engineTime > last.time {
+		l.clocks[string(engineID)] = snmpEngineClock{boots: boots, time: engineTime}
+	}
+	return true
+}
+
+// decodeSNMPPDU decodes a v1 Trap-PDU, SNMPv2-Trap-PDU or InformRequest
+func decodeSNMPPDU(data []byte, trap *snmpTrap) error {
+	pdu, _, err := berRead(data)
+	if err != nil {
+		return err
+	}
+	fields, err := berElements(pdu.value)
+	if err != nil {
+		return err
+	}
+
+	var varbinds berElement
+	switch pdu.tag {
+	case snmpPDUTrapV1:
+		// enterprise, agent-addr, generic-trap, specific-trap, time-stamp
+		if len(fields) != 6 {
+			return fmt.Errorf("invalid v1 trap")
+		}
+		trap.enterprise, _ = fields[0].oid()
+		if len(fields[1].value) == 4 && !net.IP(fields[1].value).IsUnspecified() {
+			trap.agentAddr = net.IP(fields[1].value).String()
+		}
+		generic, _ := fields[2].int()
+		specific, _ := fields[3].int()
+		trap.uptime = fields[4].uint()
+
+		// RFC 3584 3.1: the v2 trap OID of a v1 trap
+		if generic >= 0 && generic < 6 {
+			trap.trapOID = fmt.Sprintf("%s.%d", snmpOIDGenericTraps, generic+1)
+		} else {
+			trap.trapOID = fmt.Sprintf("%s.0.%d", trap.enterprise, specific)
+		}
+		varbinds = fields[5]
+	case snmpPDUTrapV2, snmpPDUInform:
+		// request-id, error-status, error-index, variable-bindings
+		if len(fields) != 4 {
+			return fmt.Errorf("invalid notification")
+		}
+		trap.inform = pdu.tag == snmpPDUInform
+		varbinds = fields[3]
+	default:
+		return fmt.Errorf("not a notification (PDU 0x%02x)", pdu.tag)
+	}
+
+	list, err := berElements(varbinds.value)
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		pair, err := berElements(item.value)
+		if err != nil || len(pair) != 2 || pair[0].tag != berOID {
+			return fmt.Errorf("invalid variable binding")
+		}
+		oid, err := pair[0].oid()
+		if err != nil {
+			return err
+		}
+
+		switch oid {
+		case snmpOIDSysUpTime:
+			trap.uptime = pair[1].uint()
+			continue
+		case snmpOIDTrapOID:
+			trap.trapOID, _ = pair[1].oid()
+			continue
+		}
+		if len(trap.varbinds) < snmpMaxVarbinds {
+			trap.varbinds = append(trap.varbinds, snmpVarbind{oid: oid, value: snmpValue(pair[1])})
+		}
+	}
+
+	if trap.trapOID == "" {
+		return fmt.Errorf("notification without snmpTrapOID")
+	}
+	return nil
+}
+
+// newEvent converts a trap into a normalized event attributed to the
+// device that sent it
+func (l *SNMPTrapListener) newEvent(trap *snmpTrap, from net.IP) *Event {
+	deviceIP := from.String()
+	if trap.agentAddr != "" {
+		deviceIP = trap.agentAddr
+	}
+	device := l.deviceName(deviceIP)
+
+	trapName := snmpOIDName(trap.trapOID)
+	code := 0
+	if i := strings.LastIndex(trap.trapOID, "."); i >= 0 {
+		code, _ = strconv.Atoi(trap.trapOID[i+1:])
+	}
+
+	data := map[string]string{
+		"snmp_version": trap.version,
+		"trap_oid":     trap.trapOID,
+		"trap_name":    trapName,
+		"uptime":       strconv.FormatUint(trap.uptime, 10),
+		"source_ip":    from.String(),
+	}
+	if trap.user != "" {
+		data["user"] = trap.user
+		data["engine_id"] = trap.engineID
+	}
+	if trap.enterprise != "" {
+		data["enterprise"] = trap.enterprise
+	}
+	if trap.inform {
+		data["inform"] = "true"
+	}
+
+	var summary []string
+	for _, varbind := range trap.varbinds {
+		name := snmpOIDName(varbind.oid)
+		data[name] = varbind.value
+		if len(summary) < 5 {
+			summary = append(summary, name+"="+varbind.value)
+		}
+	}
+
+	message := fmt.Sprintf("SNMP trap %s from %s", trapName, device)
+	if len(summary) > 0 {
+		message += ": " + strings.Join(summary, ", ")
+	}
+
+	return &Event{
+		AgentID:     l.agentID,
+		Computer:    device,
+		IPAddress:   deviceIP,
+		CollectedBy: l.hostname,
+		SourceType:  SNMPTrapSourceType,
+		EventCode:   code,
+		EventTime:   time.Now(),
+		Channel:     "snmp",
+		Provider:    trapName,
+		Severity:    l.severity(trap.trapOID),
+		Message:     message,
+		EventData:   data,
+		CollectedAt: time.Now(),
+	}
+}
+
+// severity returns the configured severity of the longest matching trap
+// OID prefix, the generic trap severity, or the default
+func (l *SNMPTrapListener) severity(trapOID string) int {
+	best, severity := -1, l.config.Severity
+	for prefix, value := range l.config.Severities {
+		if (trapOID == prefix || strings.HasPrefix(trapOID, prefix+".")) && len(prefix) > best {
+			best, severity = len(prefix), value
+		}
+	}
+	if best < 0 {
+		if value, ok := snmpTrapSeverities[trapOID]; ok {
+			severity = value
+		}
+	}
+	return severity
+}
+
+// deviceName returns the short DNS name of a device, or its address when
+// it has none. Results are cached; traps from a device come in bursts.
+func (l *SNMPTrapListener) deviceName(ip string) string {
+	if cached, ok := l.names[ip]; ok && time.Now().Before(cached.expires) {
+		return cached.name
+	}
+
+	name := ip
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	cancel()
+	if err == nil && len(names) > 0 {
+		name, _, _ = strings.Cut(strings.TrimSuffix(names[0], "."), ".")
+	}
+
+	if len(l.names) >= snmpNameCacheSize {
+		for key, cached := range l.names {
+			if time.Now().After(cached.expires) {
+				delete(l.names, key)
+			}
+		}
+		if len(l.names) >= snmpNameCacheSize {
+			l.names = make(map[string]snmpDeviceName)
+		}
+	}
+	l.names[ip] = snmpDeviceName{name: name, expires: time.Now().Add(snmpNameCacheTTL)}
+	return name
+}
+
+// snmpOIDName names an OID by its longest known prefix, keeping the rest
+// as the instance (ifOperStatus.3); unknown OIDs are returned as they are
+func snmpOIDName(oid string) string {
+	prefixes := make([]string, 0, 4)
+	for prefix := oid; prefix != ""; {
+		prefixes = append(prefixes, prefix)
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, prefix := range prefixes {
+		if name, ok := snmpOIDNames[prefix]; ok {
+			return name + oid[len(prefix):]
+		}
+	}
+	return oid
+}
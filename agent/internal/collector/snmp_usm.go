@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"github.com/siem/agent/internal/cache"
+	"github.com/siem/agent/internal/config"
+)
+
+// SNMPv3 User-based Security Model (RFC 3414): HMAC-MD5-96, HMAC-SHA-96
+// and HMAC-SHA-256-192 (RFC 7860) authentication, DES-CBC and AES-128-CFB
+// (RFC 3826) privacy. Traps are sent by the authoritative engine, so keys
+// are localized to the engine ID in each message.
+
+// snmpUSMUser is a configured v3 user with its password-derived keys
+type snmpUSMUser struct {
+	config  config.SNMPUser
+	hash    func() hash.Hash
+	macLen  int    // truncated HMAC length in the message
+	authKey []byte // Ku, before localization
+	privKey []byte
+
+	// Engine ID -> localized auth and priv keys. Only engines that sent an
+	// authentic message are kept, so forged engine IDs cannot grow it.
+	localized *cache.LRU[string, [2][]byte]
+}
+
+// Engines whose localized keys are kept per user
+const snmpLocalizedKeyCapacity = 256
+
+// newSNMPUSMUser derives the user's keys from its passwords
+func newSNMPUSMUser(cfg config.SNMPUser) (*snmpUSMUser, error) {
+	u := &snmpUSMUser{
+		config:    cfg,
+		localized: cache.New[string, [2][]byte]("snmp_usm_keys_"+cfg.Name, snmpLocalizedKeyCapacity, 0),
+	}
+
+	switch cfg.AuthProtocol {
+	case "":
+		if cfg.PrivProtocol != "" {
+			return nil, fmt.Errorf("privacy needs an authentication protocol")
+		}
+		return u, nil
+	case "md5":
+		u.hash, u.macLen = md5.New, 12
+	case "sha":
+		u.hash, u.macLen = sha1.New, 12
+	case "sha256":
+		u.hash, u.macLen = sha256.New, 24
+	default:
+		return nil, fmt.Errorf("unsupported auth_protocol %q (use md5, sha or sha256)", cfg.AuthProtocol)
+	}
+	if len(cfg.AuthPassword) < 8 {
+		return nil, fmt.Errorf("auth_password must have at least 8 characters")
+	}
+	u.authKey = snmpPasswordToKey(u.hash, cfg.AuthPassword)
+
+	switch cfg.PrivProtocol {
+	case "":
+		return u, nil
+	case "des", "aes":
+	default:
+		return nil, fmt.Errorf("unsupported priv_protocol %q (use des or aes)", cfg.PrivProtocol)
+	}
+	if len(cfg.PrivPassword) < 8 {
+		return nil, fmt.Errorf("priv_password must have at least 8 characters")
+	}
+	u.privKey = snmpPasswordToKey(u.hash, cfg.PrivPassword)
+	return u, nil
+}
+
+// keys returns the user's keys localized to an engine. Keys of engines
+// not yet authenticated are derived again for every message.
+func (u *snmpUSMUser) keys(engineID []byte) [2][]byte {
+	if keys, ok := u.localized.Get(string(engineID)); ok {
+		return keys
+	}
+	var keys [2][]byte
+	keys[0] = snmpLocalizeKey(u.hash, u.authKey, engineID)
+	if u.privKey != nil {
+		keys[1] = snmpLocalizeKey(u.hash, u.privKey, engineID)
+	}
+	return keys
+}
+
+// authenticate checks the message's HMAC, computed over the whole message
+// with the authentication parameters zeroed. The engine's keys are kept
+// once a message from it is authentic.
+func (u *snmpUSMUser) authenticate(packet, authParams, engineID []byte) bool {
+	if len(authParams) != u.macLen {
+		return false
+	}
+	keys := u.keys(engineID)
+
+	message := make([]byte, len(packet))
+	copy(message, packet)
+	offset := berOffset(packet, authParams)
+	clear(message[offset : offset+len(authParams)])
+
+	mac := hmac.New(u.hash, keys[0])
+	mac.Write(message)
+	if !hmac.Equal(mac.Sum(nil)[:u.macLen], authParams) {
+		return false
+	}
+	u.localized.Put(string(engineID), keys)
+	return true
+}
+
+// decrypt decrypts an encrypted scoped PDU
+func (u *snmpUSMUser) decrypt(data, privParams, engineID []byte, boots, engineTime uint32) ([]byte, error) {
+	privKey := u.keys(engineID)[1]
+	if len(privParams) != 8 {
+		return nil, fmt.Errorf("invalid privacy parameters")
+	}
+	plain := make([]byte, len(data))
+
+	switch u.config.PrivProtocol {
+	case "des":
+		if len(data)%des.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid DES ciphertext length")
+		}
+		block, err := des.NewCipher(privKey[:8])
+		if err != nil {
+			return nil, err
+		}
+		// The IV is the pre-IV (second half of the key) XOR the salt
+		iv := make([]byte, 8)
+		for i := range iv {
+			iv[i] = privKey[8+i] ^ privParams[i]
+		}
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	case "aes":
+		block, err := aes.NewCipher(privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, 16)
+		binary.BigEndian.PutUint32(iv[0:4], boots)
+		binary.BigEndian.PutUint32(iv[4:8], engineTime)
+		copy(iv[8:], privParams)
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(plain, data)
+	}
+	return plain, nil
+}
+
+// snmpPasswordToKey stretches a password over 1 MB and hashes it (RFC 3414
+// A.2); done once per user at startup
+func snmpPasswordToKey(newHash func() hash.Hash, password string) []byte {
+	h := newHash()
+	buffer := make([]byte, 64)
+	index := 0
+	for count := 0; count < 1048576; count += len(buffer) {
+		for i := range buffer {
+			buffer[i] = password[index%len(password)]
+			index++
+		}
+		h.Write(buffer)
+	}
+	return h.Sum(nil)
+}
+
+// snmpLocalizeKey binds a key to an engine: H(Ku | engineID | Ku)
+func snmpLocalizeKey(newHash func() hash.Hash, key, engineID []byte) []byte {
+	h := newHash()
+	h.Write(key)
+	h.Write(engineID)
+	h.Write(key)
+	return h.Sum(nil)
+}
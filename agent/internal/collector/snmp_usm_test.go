@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"testing"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Engine ID of the key localization examples in RFC 3414 A.3
+var rfc3414EngineID, _ = hex.DecodeString("000000000000000000000002")
+
+func TestSNMPKeyLocalization(t *testing.T) {
+	tests := []struct {
+		protocol      string
+		hash          func() hash.Hash
+		wantKey       string
+		wantLocalized string
+	}{
+		{"md5", md5.New, "9faf3283884e92834ebc9847d8edd963", "526f5eed9fcce26f8964c2930787d82b"},
+		{"sha", sha1.New, "9fb5cc0381497b3793528939ff788d5d79145211", "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			key := snmpPasswordToKey(tt.hash, "maplesyrup")
+			if got := hex.EncodeToString(key); got != tt.wantKey {
+				t.Errorf("snmpPasswordToKey = %s, want %s", got, tt.wantKey)
+			}
+			if got := hex.EncodeToString(snmpLocalizeKey(tt.hash, key, rfc3414EngineID)); got != tt.wantLocalized {
+				t.Errorf("snmpLocalizeKey = %s, want %s", got, tt.wantLocalized)
+			}
+
+			u, err := newSNMPUSMUser(config.SNMPUser{
+				Name:         "rfc3414_" + tt.protocol,
+				AuthProtocol: tt.protocol,
+				AuthPassword: "maplesyrup",
+				PrivProtocol: "des",
+				PrivPassword: "maplesyrup",
+			})
+			if err != nil {
+				t.Fatalf("newSNMPUSMUser: %v", err)
+			}
+			keys := u.keys(rfc3414EngineID)
+			for i, key := range keys {
+				if got := hex.EncodeToString(key); got != tt.wantLocalized {
+					t.Errorf("keys()[%d] = %s, want %s", i, got, tt.wantLocalized)
+				}
+			}
+		})
+	}
+}
+
+// TestSNMPAuthenticateCachesKeys checks that localized keys are only kept
+// for engines whose messages authenticate
+func TestSNMPAuthenticateCachesKeys(t *testing.T) {
+	u, err := newSNMPUSMUser(config.SNMPUser{Name: "test_auth", AuthProtocol: "sha", AuthPassword: "maplesyrup"})
+	if err != nil {
+		t.Fatalf("newSNMPUSMUser: %v", err)
+	}
+
+	// A message with the 12 byte authentication parameters in the middle,
+	// signed with the key localized to engineID
+	message := func(engineID []byte, corrupt bool) ([]byte, []byte) {
+		packet := append(append([]byte("header"), make([]byte, 12)...), "scoped pdu"...)
+		authParams := packet[6:18]
+		mac := hmac.New(sha1.New, snmpLocalizeKey(sha1.New, u.authKey, engineID))
+		mac.Write(packet)
+		copy(authParams, mac.Sum(nil))
+		if corrupt {
+			authParams[0] ^= 0xff
+		}
+		return packet, authParams
+	}
+
+	tests := []struct {
+		name      string
+		engineID  string
+		corrupt   bool
+		short     bool
+		want      bool
+		wantCache int
+	}{
+		{name: "forged engine", engineID: "engine-a", corrupt: true, want: false, wantCache: 0},
+		{name: "short parameters", engineID: "engine-a", short: true, want: false, wantCache: 0},
+		{name: "authentic", engineID: "engine-a", want: true, wantCache: 1},
+		{name: "authentic again", engineID: "engine-a", want: true, wantCache: 1},
+		{name: "second forged engine", engineID: "engine-b", corrupt: true, want: false, wantCache: 1},
+		{name: "second engine", engineID: "engine-b", want: true, wantCache: 2},
+	}
+
+	for _, tt := range tests {
+		packet, authParams := message([]byte(tt.engineID), tt.corrupt)
+		if tt.short {
+			authParams = authParams[:8]
+		}
+		original := bytes.Clone(packet)
+
+		if got := u.authenticate(packet, authParams, []byte(tt.engineID)); got != tt.want {
+			t.Errorf("%s: authenticate = %v, want %v", tt.name, got, tt.want)
+		}
+		if size := u.localized.Stats().Size; size != tt.wantCache {
+			t.Errorf("%s: %d engines cached, want %d", tt.name, size, tt.wantCache)
+		}
+		if !bytes.Equal(packet, original) {
+			t.Errorf("%s: authenticate modified the packet", tt.name)
+		}
+	}
+}
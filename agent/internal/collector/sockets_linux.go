@@ -0,0 +1,240 @@
+//go:build linux
+
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TCP states as numbered in /proc/net/tcp (include/net/tcp_states.h)
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// socketTables are the /proc/net tables read, with the protocol name used
+// in events (Sysmon reports "tcp" and "udp" for both address families)
+var socketTables = []struct {
+	path     string
+	protocol string
+	ipv6     bool
+}{
+	{"/proc/net/tcp", "tcp", false},
+	{"/proc/net/tcp6", "tcp", true},
+	{"/proc/net/udp", "udp", false},
+	{"/proc/net/udp6", "udp", true},
+}
+
+// socketEntry is one socket from /proc/net
+type socketEntry struct {
+	Protocol   string
+	IPv6       bool
+	LocalIP    net.IP
+	LocalPort  int
+	RemoteIP   net.IP
+	RemotePort int
+	State      string // TCP state name; UDP sockets are "ESTABLISHED" when connected, "CLOSE" otherwise
+	UID        string
+	Inode      uint64
+}
+
+// listening reports whether the socket accepts connections: a TCP listener
+// or an unconnected bound UDP socket
+func (s *socketEntry) listening() bool {
+	if s.Protocol == "udp" {
+		return s.State == "CLOSE" && s.LocalPort != 0
+	}
+	return s.State == "LISTEN"
+}
+
+// loopback reports whether the socket only talks to the host itself
+func (s *socketEntry) loopback() bool {
+	return s.LocalIP.IsLoopback() && (s.RemoteIP.IsUnspecified() || s.RemoteIP.IsLoopback())
+}
+
+// socketProcess is the process owning a socket
+type socketProcess struct {
+	PID   int
+	Name  string
+	Image string
+}
+
+// readSockets reads every TCP and UDP socket of the host's network namespace
+func readSockets() ([]*socketEntry, error) {
+	var sockets []*socketEntry
+	read := 0
+
+	for _, table := range socketTables {
+		entries, err := readSocketTable(table.path, table.protocol, table.ipv6)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // IPv6 disabled
+			}
+			return nil, err
+		}
+		sockets = append(sockets, entries...)
+		read++
+	}
+
+	if read == 0 {
+		return nil, fmt.Errorf("no socket tables in /proc/net")
+	}
+	return sockets, nil
+}
+
+// readSocketTable parses one /proc/net/{tcp,udp}[6] table:
+//
+//	sl  local_address rem_address   st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+//	0: 0100007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000 101 0 17823 ...
+func readSocketTable(path, protocol string, ipv6 bool) ([]*socketEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*socketEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		localIP, localPort, err := parseSocketAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		remoteIP, remotePort, err := parseSocketAddress(fields[2])
+		if err != nil {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		state := tcpStates[fields[3]]
+		if state == "" {
+			state = fields[3]
+		}
+
+		entries = append(entries, &socketEntry{
+			Protocol:   protocol,
+			IPv6:       ipv6,
+			LocalIP:    localIP,
+			LocalPort:  localPort,
+			RemoteIP:   remoteIP,
+			RemotePort: remotePort,
+			State:      state,
+			UID:        fields[7],
+			Inode:      inode,
+		})
+	}
+
+	return entries, scanner.Err()
+}
+
+// parseSocketAddress parses "0100007F:0035". The address is printed as
+// 32-bit words in host byte order, the port as a number.
+func parseSocketAddress(s string) (net.IP, int, error) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok || (len(addrHex) != 8 && len(addrHex) != 32) {
+		return nil, 0, fmt.Errorf("invalid socket address %q", s)
+	}
+
+	raw, err := hex.DecodeString(addrHex)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Show IPv4-mapped IPv6 addresses (dual-stack sockets) as IPv4
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip, int(port), nil
+}
+
+// socketOwners maps socket inodes to the process holding them, by reading
+// the /proc/<pid>/fd links ("socket:[17823]"). Sockets shared by several
+// processes (a forking server) are attributed to the lowest PID.
+func socketOwners() map[uint64]*socketProcess {
+	owners := make(map[uint64]*socketProcess)
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // exited, or not permitted
+		}
+
+		var process *socketProcess
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if owner, ok := owners[inode]; ok && owner.PID < pid {
+				continue
+			}
+
+			if process == nil {
+				process = &socketProcess{PID: pid}
+				if comm, err := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm")); err == nil {
+					process.Name = strings.TrimSpace(string(comm))
+				}
+				process.Image, _ = os.Readlink(filepath.Join("/proc", proc.Name(), "exe"))
+			}
+			owners[inode] = process
+		}
+	}
+
+	return owners
+}
+
+// formatEndpoint formats an address and port, bracketing IPv6 addresses
+func formatEndpoint(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
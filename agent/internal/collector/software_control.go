@@ -8,35 +8,17 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
-	"siem-agent/internal/config"
+	"github.com/siem/agent/internal/cache"
+	"github.com/siem/agent/internal/config"
 )
 
-// SoftwareInstallRequest represents a software installation request
-type SoftwareInstallRequest struct {
-	RequestID       string    `json:"request_id,omitempty"`
-	AgentID         string    `json:"agent_id"`
-	UserName        string    `json:"user_name"`
-	ComputerName    string    `json:"computer_name"`
-	SoftwareName    string    `json:"software_name"`
-	SoftwareVersion string    `json:"software_version,omitempty"`
-	Publisher       string    `json:"publisher,omitempty"`
-	InstallerPath   string    `json:"installer_path"`
-	InstallerHash   string    `json:"installer_hash,omitempty"`
-	CommandLine     string    `json:"command_line,omitempty"`
-	UserComment     string    `json:"user_comment,omitempty"`
-	Status          string    `json:"status"`
-	RequestedAt     time.Time `json:"requested_at"`
-	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
-	ReviewedBy      string    `json:"reviewed_by,omitempty"`
-	AdminComment    string    `json:"admin_comment,omitempty"`
-}
-
 // SoftwareControlCollector monitors and controls software installations
 type SoftwareControlCollector struct {
 	config       *config.SoftwareControlConfig
@@ -47,15 +29,26 @@ type SoftwareControlCollector struct {
 	cancel       context.CancelFunc
 	mutex        sync.RWMutex
 
-	// Pending requests waiting for approval
+	// Pending requests waiting for approval, persisted so they survive restarts
 	pendingRequests map[string]*SoftwareInstallRequest
+	pendingPath     string
 
 	// Installer patterns compiled as regex
 	installerPatterns []*regexp.Regexp
 
+	// Records installers instead of requesting approval while active
+	learner *SoftwareLearner
+
+	// Per-user/group policies pushed by SIEM, and resolved group membership
+	serverPolicies []config.SoftwareGroupPolicy
+	groupCache     *cache.LRU[string, []string]
+
 	// Callback for sending requests to SIEM
 	onInstallRequest func(*SoftwareInstallRequest) error
 	onCheckStatus    func(string) (*SoftwareInstallRequest, error)
+	onFetchPolicies  func() ([]config.SoftwareGroupPolicy, error)
+	onUserComment    func(requestID, comment string) error
+	onCheckReputation func(*ReputationQuery) (*ReputationVerdict, error)
 }
 
 // NewSoftwareControlCollector creates a new software control collector
@@ -69,6 +62,8 @@ func NewSoftwareControlCollector(cfg *config.SoftwareControlConfig, agentID, hos
 		ctx:             ctx,
 		cancel:          cancel,
 		pendingRequests: make(map[string]*SoftwareInstallRequest),
+		pendingPath:     filepath.Join(os.Getenv("ProgramData"), "SIEM", "pending_requests.json"),
+		groupCache:      cache.New[string, []string]("user_groups", 256, groupCacheTTL),
 	}
 
 	// Get current user
@@ -117,6 +112,16 @@ func (c *SoftwareControlCollector) SetCallbacks(
 	c.onCheckStatus = onCheck
 }
 
+// SetCommentCallback sets the callback for attaching a user comment to a submitted request
+func (c *SoftwareControlCollector) SetCommentCallback(onComment func(requestID, comment string) error) {
+	c.onUserComment = onComment
+}
+
+// SetLearner enables learning mode using the given learner
+func (c *SoftwareControlCollector) SetLearner(learner *SoftwareLearner) {
+	c.learner = learner
+}
+
 // IsInstaller checks if a file path matches installer patterns
 func (c *SoftwareControlCollector) IsInstaller(filePath string) bool {
 	for _, pattern := range c.installerPatterns {
@@ -148,13 +153,36 @@ func (c *SoftwareControlCollector) CheckInstallationAttempt(
 	userName string,
 	userComment string,
 ) (bool, *SoftwareInstallRequest, error) {
+	return c.checkInstallation(0, processPath, commandLine, userName, userComment)
+}
+
+// CheckHeldInstallation is CheckInstallationAttempt for a suspended process.
+// The process ID is persisted with the pending request so the process can
+// be re-attached after an agent restart.
+func (c *SoftwareControlCollector) CheckHeldInstallation(
+	pid uint32,
+	processPath string,
+	commandLine string,
+	userName string,
+) (bool, *SoftwareInstallRequest, error) {
+	return c.checkInstallation(pid, processPath, commandLine, userName, "")
+}
+
+func (c *SoftwareControlCollector) checkInstallation(
+	pid uint32,
+	processPath string,
+	commandLine string,
+	userName string,
+	userComment string,
+) (bool, *SoftwareInstallRequest, error) {
 
 	if !c.config.Enabled {
 		return true, nil, nil
 	}
 
-	// Check if it's an installer
-	if !c.IsInstaller(processPath) {
+	// Check if it's an installer or a package-manager/script install
+	installMethod, packageTarget, isPackageInstall := DetectPackageInstall(commandLine)
+	if !isPackageInstall && !c.IsInstaller(processPath) {
 		return true, nil, nil
 	}
 
@@ -166,6 +194,9 @@ func (c *SoftwareControlCollector) CheckInstallationAttempt(
 
 	// Extract software info from path
 	softwareName := extractSoftwareName(processPath)
+	if isPackageInstall {
+		softwareName = packageTarget
+	}
 
 	// Create install request
 	request := &SoftwareInstallRequest{
@@ -174,23 +205,97 @@ func (c *SoftwareControlCollector) CheckInstallationAttempt(
 		ComputerName:  c.hostname,
 		SoftwareName:  softwareName,
 		InstallerPath: processPath,
+		ProcessID:     pid,
 		CommandLine:   commandLine,
+		InstallMethod: installMethod,
 		UserComment:   userComment,
 		Status:        "pending",
 		RequestedAt:   time.Now(),
 	}
 
+	// Identify the concrete artifact being approved. For package installs
+	// the process is the package manager, not the software being installed.
+	if isPackageInstall {
+		request.Publisher = installMethod
+	} else if info, err := InspectFile(processPath); err != nil {
+		log.Printf("Warning: Could not inspect installer %s: %v", processPath, err)
+	} else {
+		applyFileInfo(request, info)
+	}
+
 	// Log the attempt
 	if c.config.LogAllAttempts {
 		log.Printf("Software installation attempt detected: %s by %s", softwareName, userName)
 	}
 
+	// Learning mode: record and allow without prompting
+	if c.learner != nil && c.learner.Active() {
+		request.Status = "learned"
+		c.learner.Record(request)
+		return true, request, nil
+	}
+
+	// Blocked publishers are denied regardless of user or group
+	if publisher := c.blockedPublisher(request); publisher != "" {
+		return c.autoDeny(request, fmt.Sprintf("publisher %q is on the blocked publishers list", publisher),
+			fmt.Sprintf("Издатель %s запрещен политикой безопасности.", publisher))
+	}
+
+	// Per-user/group policy overrides the global approval setting
+	requireApproval := c.config.RequireApproval
+	request.DecisionReason = "approval required by global setting"
+	if !requireApproval {
+		request.DecisionReason = "approval not required by global setting"
+	}
+
+	if policy := c.matchPolicy(userName); policy != nil {
+		request.PolicyName = policy.Name
+
+		switch policy.Action {
+		case PolicyAllow:
+			requireApproval = false
+			request.DecisionReason = fmt.Sprintf("policy %q allows all installers", policy.Name)
+		case PolicyAllowSigned:
+			requireApproval = request.SignatureStatus != SignatureValid
+			if requireApproval {
+				request.DecisionReason = fmt.Sprintf("policy %q allows only signed installers; signature is %s", policy.Name, request.SignatureStatus)
+			} else {
+				request.DecisionReason = fmt.Sprintf("policy %q allows signed installers", policy.Name)
+			}
+		case PolicyDeny:
+			return c.autoDeny(request, fmt.Sprintf("policy %q denies all installers", policy.Name),
+				fmt.Sprintf("Политика %s не разрешает установку %s.", policy.Name, request.SoftwareName))
+		case PolicyRequireApproval:
+			requireApproval = true
+			request.DecisionReason = fmt.Sprintf("policy %q requires approval", policy.Name)
+		default:
+			log.Printf("Warning: Unknown action %q in software policy %q", policy.Action, policy.Name)
+		}
+	}
+
+	// Trusted publishers skip the admin
+	if requireApproval {
+		if publisher := c.allowedPublisher(request); publisher != "" {
+			requireApproval = false
+			request.DecisionReason = fmt.Sprintf("valid signature from allowed publisher %q", publisher)
+		}
+	}
+
+	// Widely trusted software per the reputation source skips the admin
+	if requireApproval {
+		if reason, trusted := c.trustedByReputation(request); trusted {
+			requireApproval = false
+			request.DecisionReason = reason
+		}
+	}
+
 	// If approval not required, allow but log
-	if !c.config.RequireApproval {
+	if !requireApproval {
 		request.Status = "auto_approved"
 		if c.onInstallRequest != nil {
 			c.onInstallRequest(request)
 		}
+		log.Printf("Installation auto-approved: %s (%s)", softwareName, request.DecisionReason)
 		return true, request, nil
 	}
 
@@ -198,29 +303,81 @@ func (c *SoftwareControlCollector) CheckInstallationAttempt(
 	if c.onInstallRequest != nil {
 		if err := c.onInstallRequest(request); err != nil {
 			log.Printf("Error sending install request to SIEM: %v", err)
+			c.notifyUser(request, "Установка ПО заблокирована",
+				fmt.Sprintf("Не удалось отправить запрос на установку %s администратору. Обратитесь в службу поддержки.", softwareName))
 			// On error, block by default for security
 			return false, request, err
 		}
 	}
 
+	// Let the user explain the request while it waits; fall back to a toast
+	var dialog *PromptDialog
+	if c.config.PromptForComment {
+		var err error
+		dialog, err = ShowUserPrompt(c.CreateUserPrompt(request), request.UserName)
+		if err != nil {
+			log.Printf("Could not show install request dialog to %s: %v", request.UserName, err)
+		}
+	}
+	if dialog == nil {
+		c.notifyUser(request, "Запрос на установку ПО отправлен",
+			fmt.Sprintf("Установка %s ожидает согласования администратором.", request.SoftwareName))
+	}
+
+	approved, err := c.awaitDecision(request, dialog)
+	return approved, request, err
+}
+
+// ResumeRequest waits for the decision on a request restored from disk
+func (c *SoftwareControlCollector) ResumeRequest(request *SoftwareInstallRequest) (bool, *SoftwareInstallRequest, error) {
+	log.Printf("Resuming pending install request: %s (ID: %s)", request.SoftwareName, request.RequestID)
+
+	approved, err := c.awaitDecision(request, nil)
+	return approved, request, err
+}
+
+// awaitDecision tracks a submitted request until it is decided
+func (c *SoftwareControlCollector) awaitDecision(request *SoftwareInstallRequest, dialog *PromptDialog) (bool, error) {
 	// Store pending request
 	c.mutex.Lock()
 	c.pendingRequests[request.RequestID] = request
+	c.savePendingRequests()
 	c.mutex.Unlock()
 
 	// Wait for approval (with timeout)
-	approved, err := c.waitForApproval(request)
+	approved, err := c.waitForApproval(request, dialog)
+
+	// Keep the request on disk when the agent is shutting down
+	if c.ctx.Err() != nil {
+		return false, err
+	}
+
+	// Install the approved package ourselves instead of running the user's installer
+	if approved && c.config.InstallViaWinget {
+		if wingetID := c.resolveWingetPackage(request); wingetID != "" {
+			request.WingetID = wingetID
+			request.Status = "winget_install"
+			go c.installWithWinget(request)
+			approved = false
+		}
+	}
+	if approved {
+		c.notifyUser(request, "Установка ПО одобрена",
+			fmt.Sprintf("Администратор одобрил установку %s. Если установка не продолжилась, запустите установщик повторно.", request.SoftwareName))
+	}
 
 	// Clean up pending request
 	c.mutex.Lock()
 	delete(c.pendingRequests, request.RequestID)
+	c.savePendingRequests()
 	c.mutex.Unlock()
 
-	return approved, request, err
+	return approved, err
 }
 
-// waitForApproval polls SIEM for approval status
-func (c *SoftwareControlCollector) waitForApproval(request *SoftwareInstallRequest) (bool, error) {
+// waitForApproval polls SIEM for approval status. If a dialog is open, its
+// status line is kept current and the user's comment is forwarded to SIEM.
+func (c *SoftwareControlCollector) waitForApproval(request *SoftwareInstallRequest, dialog *PromptDialog) (bool, error) {
 	if c.onCheckStatus == nil {
 		return false, fmt.Errorf("status check callback not configured")
 	}
@@ -241,14 +398,24 @@ func (c *SoftwareControlCollector) waitForApproval(request *SoftwareInstallReque
 
 	log.Printf("Waiting for approval of %s (timeout: %v)", request.SoftwareName, timeout)
 
+	started := time.Now()
+
 	for {
 		select {
 		case <-c.ctx.Done():
+			if dialog != nil {
+				dialog.Close("Агент остановлен. Запрос остается у администратора.")
+			}
 			return false, fmt.Errorf("collector stopped")
 
 		case <-ticker.C:
 			if time.Now().After(deadline) {
 				log.Printf("Approval timeout for %s", request.SoftwareName)
+				if dialog != nil {
+					dialog.Close("Истекло время ожидания. Запрос остается у администратора.")
+				}
+				c.notifyUser(request, "Установка ПО заблокирована",
+					fmt.Sprintf("Истекло время ожидания согласования установки %s. Запрос остается у администратора.", request.SoftwareName))
 				return false, fmt.Errorf("approval timeout")
 			}
 
@@ -262,12 +429,30 @@ func (c *SoftwareControlCollector) waitForApproval(request *SoftwareInstallReque
 			switch updatedRequest.Status {
 			case "approved":
 				log.Printf("Installation approved: %s", request.SoftwareName)
+				request.WingetID = updatedRequest.WingetID
+				request.ApprovedVersion = updatedRequest.ApprovedVersion
+				if dialog != nil {
+					dialog.Close("Установка одобрена.")
+				}
 				return true, nil
 			case "denied":
 				log.Printf("Installation denied: %s - %s", request.SoftwareName, updatedRequest.AdminComment)
+				message := fmt.Sprintf("Администратор отклонил установку %s.", request.SoftwareName)
+				if updatedRequest.AdminComment != "" {
+					message += " Комментарий: " + updatedRequest.AdminComment
+				}
+				if dialog != nil {
+					dialog.Close(message)
+				}
+				c.notifyUser(request, "Установка ПО отклонена", message)
 				return false, nil
 			case "pending":
 				// Continue waiting
+				if dialog != nil {
+					dialog.SetStatus(fmt.Sprintf("Ожидание решения администратора (%d мин.)...",
+						int(time.Since(started).Minutes())))
+					c.forwardUserComment(request, dialog)
+				}
 				continue
 			default:
 				log.Printf("Unknown status: %s", updatedRequest.Status)
@@ -291,7 +476,7 @@ func (c *SoftwareControlCollector) ProcessInstallEvent(event *Event) *SoftwareIn
 
 	var request *SoftwareInstallRequest
 
-	switch event.EventID {
+	switch event.EventCode {
 	case 1033: // MSI installation started
 		request = &SoftwareInstallRequest{
 			AgentID:       c.agentID,
@@ -301,7 +486,7 @@ func (c *SoftwareControlCollector) ProcessInstallEvent(event *Event) *SoftwareIn
 			Publisher:     extractFromEventMessage(event.Message, "Manufacturer"),
 			InstallerPath: event.FilePath,
 			Status:        "installing",
-			RequestedAt:   event.Timestamp,
+			RequestedAt:   event.EventTime,
 		}
 
 	case 11707: // Installation completed successfully
@@ -312,7 +497,7 @@ func (c *SoftwareControlCollector) ProcessInstallEvent(event *Event) *SoftwareIn
 			SoftwareName:  extractFromEventMessage(event.Message, "Product"),
 			InstallerPath: event.FilePath,
 			Status:        "installed",
-			RequestedAt:   event.Timestamp,
+			RequestedAt:   event.EventTime,
 		}
 
 	case 11708: // Installation failed
@@ -323,7 +508,7 @@ func (c *SoftwareControlCollector) ProcessInstallEvent(event *Event) *SoftwareIn
 			SoftwareName:  extractFromEventMessage(event.Message, "Product"),
 			InstallerPath: event.FilePath,
 			Status:        "failed",
-			RequestedAt:   event.Timestamp,
+			RequestedAt:   event.EventTime,
 		}
 	}
 
@@ -336,6 +521,132 @@ func (c *SoftwareControlCollector) ProcessInstallEvent(event *Event) *SoftwareIn
 	return request
 }
 
+// forwardUserComment attaches a comment entered in the dialog to the request
+func (c *SoftwareControlCollector) forwardUserComment(request *SoftwareInstallRequest, dialog *PromptDialog) {
+	comment, ok := dialog.Comment()
+	if !ok || comment == "" {
+		return
+	}
+
+	if request.UserComment != "" {
+		request.UserComment += "\n"
+	}
+	request.UserComment += comment
+
+	if c.onUserComment == nil {
+		return
+	}
+	if err := c.onUserComment(request.RequestID, request.UserComment); err != nil {
+		log.Printf("Error sending user comment to SIEM: %v", err)
+		dialog.SetStatus("Не удалось отправить комментарий. Ожидание решения администратора...")
+		return
+	}
+	dialog.SetStatus("Комментарий отправлен. Ожидание решения администратора...")
+}
+
+// autoDeny records a denial made without asking an admin
+func (c *SoftwareControlCollector) autoDeny(request *SoftwareInstallRequest, reason, userMessage string) (bool, *SoftwareInstallRequest, error) {
+	request.Status = "auto_denied"
+	request.DecisionReason = reason
+	if c.onInstallRequest != nil {
+		c.onInstallRequest(request)
+	}
+
+	log.Printf("Installation auto-denied: %s (%s)", request.SoftwareName, reason)
+	c.notifyUser(request, "Установка ПО запрещена", userMessage)
+	return false, request, nil
+}
+
+// blockedPublisher returns the blocked publisher entry matching the installer.
+// Both the signer and the claimed company name are checked, so an unsigned
+// copy of a blocked product is still denied.
+func (c *SoftwareControlCollector) blockedPublisher(request *SoftwareInstallRequest) string {
+	for _, name := range []string{request.Signer, request.Publisher} {
+		if pattern := matchPublisher(c.config.BlockedPublishers, name); pattern != "" {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// allowedPublisher returns the allowed publisher entry matching the installer.
+// Only a valid Authenticode signature is trusted.
+func (c *SoftwareControlCollector) allowedPublisher(request *SoftwareInstallRequest) string {
+	if request.SignatureStatus != SignatureValid {
+		return ""
+	}
+	return matchPublisher(c.config.AllowedPublishers, request.Signer)
+}
+
+// notifyUser shows a toast notification to the requesting user
+func (c *SoftwareControlCollector) notifyUser(request *SoftwareInstallRequest, title, message string) {
+	if !c.config.NotifyOnBlock {
+		return
+	}
+
+	if err := ShowToast(request.UserName, title, message); err != nil {
+		log.Printf("Could not notify user %s: %v", request.UserName, err)
+	}
+}
+
+// LoadPendingRequests returns requests that were still pending when the agent
+// last stopped. Call ResumeRequest on each to re-attach to them.
+func (c *SoftwareControlCollector) LoadPendingRequests() []*SoftwareInstallRequest {
+	data, err := os.ReadFile(c.pendingPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read pending install requests: %v", err)
+		}
+		return nil
+	}
+
+	var requests []*SoftwareInstallRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		log.Printf("Warning: Could not parse pending install requests: %v", err)
+		return nil
+	}
+
+	// Requests without an ID were never accepted by SIEM and cannot be polled
+	resumable := requests[:0]
+	for _, request := range requests {
+		if request.RequestID != "" {
+			resumable = append(resumable, request)
+		}
+	}
+	return resumable
+}
+
+// IsPendingProcess reports whether a held process belongs to a pending request
+func (c *SoftwareControlCollector) IsPendingProcess(pid uint32) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, request := range c.pendingRequests {
+		if request.ProcessID == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// savePendingRequests writes pending requests to disk. Caller must hold the mutex.
+func (c *SoftwareControlCollector) savePendingRequests() {
+	requests := make([]*SoftwareInstallRequest, 0, len(c.pendingRequests))
+	for _, request := range c.pendingRequests {
+		requests = append(requests, request)
+	}
+
+	data, err := json.MarshalIndent(requests, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(c.pendingPath), 0700); err == nil {
+			err = os.WriteFile(c.pendingPath, data, 0600)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Could not save pending install requests: %v", err)
+	}
+}
+
 // GetPendingRequests returns all pending approval requests
 func (c *SoftwareControlCollector) GetPendingRequests() []*SoftwareInstallRequest {
 	c.mutex.RLock()
@@ -355,6 +666,37 @@ func (c *SoftwareControlCollector) Stop() {
 
 // Helper functions
 
+// applyFileInfo copies installer hash, signature and version details into a request
+func applyFileInfo(request *SoftwareInstallRequest, info *FileInfo) {
+	request.InstallerHash = info.SHA256
+	request.SignatureStatus = info.SignatureStatus
+	request.Signer = info.Signer
+	request.Publisher = info.Publisher()
+	request.SoftwareVersion = info.ProductVersion
+	if request.SoftwareVersion == "" {
+		request.SoftwareVersion = info.FileVersion
+	}
+	if info.ProductName != "" {
+		request.SoftwareName = info.ProductName
+	}
+}
+
+// matchPublisher returns the first pattern matching a publisher name.
+// Patterns are case-insensitive and may contain * wildcards.
+func matchPublisher(patterns []string, publisher string) string {
+	if publisher == "" {
+		return ""
+	}
+	name := strings.ToLower(publisher)
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return pattern
+		}
+	}
+	return ""
+}
+
 func extractSoftwareName(filePath string) string {
 	// Extract software name from file path
 	base := filepath.Base(filePath)
@@ -0,0 +1,145 @@
+//go:build !windows
+
+package collector
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// SoftwareControlCollector controls software installation (Windows only).
+// Outside Windows the agent can be configured the same way, but nothing is
+// enforced.
+type SoftwareControlCollector struct{}
+
+// NewSoftwareControlCollector creates a software control stub
+func NewSoftwareControlCollector(cfg *config.SoftwareControlConfig, agentID, hostname string) *SoftwareControlCollector {
+	return &SoftwareControlCollector{}
+}
+
+// SetCallbacks does nothing
+func (c *SoftwareControlCollector) SetCallbacks(
+	onRequest func(*SoftwareInstallRequest) error,
+	onCheck func(string) (*SoftwareInstallRequest, error),
+) {
+}
+
+// SetCommentCallback does nothing
+func (c *SoftwareControlCollector) SetCommentCallback(onComment func(requestID, comment string) error) {
+}
+
+// SetReputationCallback does nothing
+func (c *SoftwareControlCollector) SetReputationCallback(onCheck func(*ReputationQuery) (*ReputationVerdict, error)) {
+}
+
+// SetPolicyCallbacks does nothing
+func (c *SoftwareControlCollector) SetPolicyCallbacks(onFetch func() ([]config.SoftwareGroupPolicy, error)) {
+}
+
+// StartPolicySync logs that software control is unavailable
+func (c *SoftwareControlCollector) StartPolicySync() {
+	log.Println("Software control: Not implemented on this platform")
+}
+
+// SetLearner does nothing
+func (c *SoftwareControlCollector) SetLearner(learner *SoftwareLearner) {}
+
+// LoadPendingRequests returns nothing; requests are never held
+func (c *SoftwareControlCollector) LoadPendingRequests() []*SoftwareInstallRequest {
+	return nil
+}
+
+// ResumeRequest fails; requests are never held
+func (c *SoftwareControlCollector) ResumeRequest(request *SoftwareInstallRequest) (bool, *SoftwareInstallRequest, error) {
+	return false, nil, fmt.Errorf("software control is only supported on Windows")
+}
+
+// Stop does nothing
+func (c *SoftwareControlCollector) Stop() {}
+
+// SoftwareLearner records installers for building an allowlist (Windows only)
+type SoftwareLearner struct{}
+
+// NewSoftwareLearner creates a learning mode stub
+func NewSoftwareLearner(cfg *config.SoftwareControlConfig, agentID, hostname string) *SoftwareLearner {
+	return &SoftwareLearner{}
+}
+
+// SetCallbacks does nothing
+func (l *SoftwareLearner) SetCallbacks(onReport func(*LearningReport) error) {}
+
+// Start does nothing
+func (l *SoftwareLearner) Start() {}
+
+// Stop does nothing
+func (l *SoftwareLearner) Stop() {}
+
+// AppLockerManager enforces the allowlist through AppLocker (Windows only)
+type AppLockerManager struct{}
+
+// NewAppLockerManager creates an AppLocker stub
+func NewAppLockerManager(cfg *config.SoftwareControlConfig, agentID string) *AppLockerManager {
+	return &AppLockerManager{}
+}
+
+// SetCallbacks does nothing
+func (m *AppLockerManager) SetCallbacks(onFetch func() ([]AllowlistEntry, error)) {}
+
+// Start logs that the allowlist is not enforced
+func (m *AppLockerManager) Start() {
+	log.Println("AppLocker: Not implemented on this platform, allowlist is not enforced")
+}
+
+// Stop does nothing
+func (m *AppLockerManager) Stop() {}
+
+// RemovalMonitor alerts on removal of required software (Windows only)
+type RemovalMonitor struct{}
+
+// NewRemovalMonitor creates a removal monitor stub
+func NewRemovalMonitor(cfg *config.SoftwareControlConfig, agentID, hostname string) *RemovalMonitor {
+	return &RemovalMonitor{}
+}
+
+// SetCallbacks does nothing
+func (m *RemovalMonitor) SetCallbacks(
+	onFetch func() ([]RequiredSoftware, error),
+	onAlert func(*SoftwareRemovalAlert) error,
+	onReinstall func(RequiredSoftware) error,
+) {
+}
+
+// Start logs that removals are not monitored
+func (m *RemovalMonitor) Start() {
+	log.Println("Removal monitor: Not implemented on this platform")
+}
+
+// Stop does nothing
+func (m *RemovalMonitor) Stop() {}
+
+// Inspect does nothing
+func (m *RemovalMonitor) Inspect(event *Event) []*Event { return nil }
+
+// InstallerInterceptor suspends installers pending approval (Windows only)
+type InstallerInterceptor struct{}
+
+// NewInstallerInterceptor creates an installer interception stub
+func NewInstallerInterceptor(control *SoftwareControlCollector) *InstallerInterceptor {
+	return &InstallerInterceptor{}
+}
+
+// Start fails outside Windows
+func (i *InstallerInterceptor) Start() error {
+	return fmt.Errorf("installer interception is only supported on Windows")
+}
+
+// Stop does nothing
+func (i *InstallerInterceptor) Stop() {}
+
+// Reattach does nothing
+func (i *InstallerInterceptor) Reattach(request *SoftwareInstallRequest) {}
+
+// Inspect does nothing
+func (i *InstallerInterceptor) Inspect(event *Event) []*Event { return nil }
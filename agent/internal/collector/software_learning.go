@@ -0,0 +1,272 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// learningState is persisted so the learning period survives restarts
+type learningState struct {
+	StartedAt    time.Time                       `json:"started_at"`
+	Completed    bool                            `json:"completed"`
+	Observations map[string]*LearningObservation `json:"observations"`
+}
+
+// SoftwareLearner records installer executions without prompting or
+// blocking, so admins can review real usage before enabling enforcement
+type SoftwareLearner struct {
+	config    *config.SoftwareControlConfig
+	agentID   string
+	hostname  string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mutex     sync.Mutex
+	statePath string
+	state     learningState
+	dirty     bool
+
+	// Callback for uploading the aggregate to SIEM
+	onReport func(*LearningReport) error
+}
+
+// NewSoftwareLearner creates a learner, resuming a previous learning period if one exists
+func NewSoftwareLearner(cfg *config.SoftwareControlConfig, agentID, hostname string) *SoftwareLearner {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l := &SoftwareLearner{
+		config:    cfg,
+		agentID:   agentID,
+		hostname:  hostname,
+		ctx:       ctx,
+		cancel:    cancel,
+		statePath: filepath.Join(os.Getenv("ProgramData"), "SIEM", "software_learning.json"),
+	}
+
+	if err := l.load(); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not load learning state, starting a new period: %v", err)
+		}
+		l.state = learningState{StartedAt: time.Now()}
+	}
+	if l.state.Observations == nil {
+		l.state.Observations = make(map[string]*LearningObservation)
+	}
+	l.dirty = len(l.state.Observations) > 0
+
+	return l
+}
+
+// SetCallbacks sets the callback for SIEM communication
+func (l *SoftwareLearner) SetCallbacks(onReport func(*LearningReport) error) {
+	l.onReport = onReport
+}
+
+// Active reports whether the learning period is still running
+func (l *SoftwareLearner) Active() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return !l.state.Completed && time.Now().Before(l.endsAt())
+}
+
+// endsAt returns the end of the learning period. Caller must hold the mutex.
+func (l *SoftwareLearner) endsAt() time.Time {
+	period := time.Duration(l.config.LearningPeriod) * time.Hour
+	if period <= 0 {
+		period = 7 * 24 * time.Hour
+	}
+	return l.state.StartedAt.Add(period)
+}
+
+// Record adds an installer execution to the aggregate
+func (l *SoftwareLearner) Record(request *SoftwareInstallRequest) {
+	key := strings.ToLower(request.InstallerHash)
+	if key == "" {
+		key = strings.ToLower(request.InstallerPath)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	obs, ok := l.state.Observations[key]
+	if !ok {
+		obs = &LearningObservation{
+			InstallerHash:   request.InstallerHash,
+			SoftwareName:    request.SoftwareName,
+			SoftwareVersion: request.SoftwareVersion,
+			Publisher:       request.Publisher,
+			SignatureStatus: request.SignatureStatus,
+			Signer:          request.Signer,
+			FirstSeen:       request.RequestedAt,
+		}
+		l.state.Observations[key] = obs
+	}
+
+	obs.Count++
+	obs.LastSeen = request.RequestedAt
+	obs.InstallerPaths = appendUnique(obs.InstallerPaths, request.InstallerPath)
+	obs.Users = appendUnique(obs.Users, request.UserName)
+	l.dirty = true
+
+	if err := l.save(); err != nil {
+		log.Printf("Warning: Could not save learning state: %v", err)
+	}
+
+	log.Printf("Learning mode: recorded %s (%s) run by %s", request.SoftwareName, request.Publisher, request.UserName)
+}
+
+// Start uploads the aggregate periodically until the learning period ends
+func (l *SoftwareLearner) Start() {
+	l.mutex.Lock()
+	endsAt := l.endsAt()
+	completed := l.state.Completed
+	l.mutex.Unlock()
+
+	if completed {
+		return
+	}
+
+	log.Printf("Software learning mode active until %s", endsAt.Format(time.RFC3339))
+
+	interval := time.Duration(l.config.LearningReportInterval) * time.Second
+	if interval < time.Minute {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	periodEnd := time.NewTimer(time.Until(endsAt))
+	defer periodEnd.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.upload(false); err != nil {
+				log.Printf("Error uploading learning report: %v", err)
+			}
+		case <-periodEnd.C:
+			log.Println("Software learning period finished, uploading final report")
+			// Keep retrying the final report so the aggregate is not lost
+			for {
+				err := l.upload(true)
+				if err == nil {
+					return
+				}
+				log.Printf("Error uploading final learning report: %v", err)
+
+				select {
+				case <-l.ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}
+	}
+}
+
+// Stop stops periodic uploads. Recorded data stays on disk.
+func (l *SoftwareLearner) Stop() {
+	l.cancel()
+}
+
+// upload sends the aggregate to SIEM if anything changed since the last upload
+func (l *SoftwareLearner) upload(final bool) error {
+	if l.onReport == nil {
+		return fmt.Errorf("report callback not configured")
+	}
+
+	l.mutex.Lock()
+	if !l.dirty && !final {
+		l.mutex.Unlock()
+		return nil
+	}
+
+	report := &LearningReport{
+		AgentID:      l.agentID,
+		ComputerName: l.hostname,
+		StartedAt:    l.state.StartedAt,
+		EndsAt:       l.endsAt(),
+		Completed:    final,
+		Observations: make([]*LearningObservation, 0, len(l.state.Observations)),
+	}
+	for _, obs := range l.state.Observations {
+		copied := *obs
+		report.Observations = append(report.Observations, &copied)
+	}
+	l.dirty = false
+	l.mutex.Unlock()
+
+	sort.Slice(report.Observations, func(i, j int) bool {
+		return report.Observations[i].Count > report.Observations[j].Count
+	})
+
+	if err := l.onReport(report); err != nil {
+		l.mutex.Lock()
+		l.dirty = true
+		l.mutex.Unlock()
+		return err
+	}
+
+	log.Printf("✓ Sent learning report (%d installers)", len(report.Observations))
+
+	if final {
+		l.mutex.Lock()
+		l.state.Completed = true
+		err := l.save()
+		l.mutex.Unlock()
+		if err != nil {
+			log.Printf("Warning: Could not save learning state: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// load reads the persisted learning state
+func (l *SoftwareLearner) load() error {
+	data, err := os.ReadFile(l.statePath)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &l.state)
+}
+
+// save persists the learning state. Caller must hold the mutex.
+func (l *SoftwareLearner) save() error {
+	data, err := json.MarshalIndent(l.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.statePath), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(l.statePath, data, 0600)
+}
+
+// appendUnique appends value to list unless it is empty or already present
+func appendUnique(list []string, value string) []string {
+	if value == "" {
+		return list
+	}
+	for _, existing := range list {
+		if strings.EqualFold(existing, value) {
+			return list
+		}
+	}
+	return append(list, value)
+}
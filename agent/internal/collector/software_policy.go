@@ -0,0 +1,184 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// Software policy actions
+const (
+	PolicyAllow           = "allow"            // Install anything
+	PolicyAllowSigned     = "allow_signed"     // Install anything with a valid signature, others need approval
+	PolicyDeny            = "deny"             // Install nothing
+	PolicyRequireApproval = "require_approval" // Every installer needs approval
+)
+
+// groupCacheTTL is how long resolved group membership is reused
+const groupCacheTTL = 5 * time.Minute
+
+// SetPolicyCallbacks sets the callback for fetching server-pushed group policies
+func (c *SoftwareControlCollector) SetPolicyCallbacks(onFetch func() ([]config.SoftwareGroupPolicy, error)) {
+	c.onFetchPolicies = onFetch
+}
+
+// StartPolicySync fetches server-pushed group policies immediately and then periodically
+func (c *SoftwareControlCollector) StartPolicySync() {
+	if c.onFetchPolicies == nil {
+		return
+	}
+
+	interval := time.Duration(c.config.PolicySyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = 15 * time.Minute
+	}
+
+	if err := c.SyncGroupPolicies(); err != nil {
+		log.Printf("Error syncing software group policies: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.SyncGroupPolicies(); err != nil {
+				log.Printf("Error syncing software group policies: %v", err)
+			}
+		}
+	}
+}
+
+// SyncGroupPolicies replaces the server-pushed group policies
+func (c *SoftwareControlCollector) SyncGroupPolicies() error {
+	policies, err := c.onFetchPolicies()
+	if err != nil {
+		return fmt.Errorf("failed to fetch group policies: %w", err)
+	}
+
+	c.mutex.Lock()
+	c.serverPolicies = policies
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// matchPolicy returns the first policy that applies to the user. Server-pushed
+// policies are checked before the local configuration.
+func (c *SoftwareControlCollector) matchPolicy(userName string) *config.SoftwareGroupPolicy {
+	c.mutex.RLock()
+	policies := make([]config.SoftwareGroupPolicy, 0, len(c.serverPolicies)+len(c.config.GroupPolicies))
+	policies = append(policies, c.serverPolicies...)
+	c.mutex.RUnlock()
+	policies = append(policies, c.config.GroupPolicies...)
+
+	if len(policies) == 0 || userName == "" {
+		return nil
+	}
+
+	var groups []string
+	groupsResolved := false
+
+	for i := range policies {
+		policy := &policies[i]
+
+		for _, user := range policy.Users {
+			if accountMatches(user, userName) {
+				return policy
+			}
+		}
+
+		if len(policy.Groups) == 0 {
+			continue
+		}
+		if !groupsResolved {
+			groups = c.userGroups(userName)
+			groupsResolved = true
+		}
+		for _, group := range policy.Groups {
+			for _, member := range groups {
+				if accountMatches(group, member) {
+					return policy
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// userGroups returns the groups of a user as DOMAIN\Name and SID strings,
+// resolved locally from the user's logon token
+func (c *SoftwareControlCollector) userGroups(userName string) []string {
+	groups, err := c.groupCache.GetOrLoad(strings.ToLower(userName), func(string) ([]string, error) {
+		return tokenGroups(FindUserSession(userName))
+	})
+	if err != nil {
+		log.Printf("Could not resolve groups for %s: %v", userName, err)
+		return nil
+	}
+	return groups
+}
+
+// tokenGroups lists the groups in the logon token of a session. The token
+// already contains domain groups, so no domain controller query is needed.
+func tokenGroups(sessionID uint32) ([]string, error) {
+	if sessionID == noSession {
+		return nil, fmt.Errorf("no interactive user session")
+	}
+
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(sessionID, &token); err != nil {
+		return nil, fmt.Errorf("failed to get user token for session %d: %w", sessionID, err)
+	}
+	defer token.Close()
+
+	tokenGroups, err := token.GetTokenGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token groups: %w", err)
+	}
+
+	var groups []string
+	for _, group := range tokenGroups.AllGroups() {
+		if group.Attributes&windows.SE_GROUP_LOGON_ID != 0 {
+			continue
+		}
+
+		groups = append(groups, group.Sid.String())
+		account, domain, _, err := group.Sid.LookupAccount("")
+		if err != nil {
+			continue
+		}
+		if domain != "" {
+			account = domain + "\\" + account
+		}
+		groups = append(groups, account)
+	}
+
+	return groups, nil
+}
+
+// accountMatches compares a configured account name with an actual one.
+// A pattern without a domain matches that name in any domain; SIDs match exactly.
+func accountMatches(pattern, name string) bool {
+	if strings.EqualFold(pattern, name) {
+		return true
+	}
+	if strings.Contains(pattern, "\\") {
+		return false
+	}
+	if idx := strings.LastIndex(name, "\\"); idx != -1 {
+		return strings.EqualFold(pattern, name[idx+1:])
+	}
+	return false
+}
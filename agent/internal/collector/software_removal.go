@@ -0,0 +1,346 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// uninstallKeyPaths are the machine-wide Uninstall keys that are watched
+var uninstallKeyPaths = []string{
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`,
+	`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
+}
+
+// removalDedupWindow suppresses a second alert when both the MSI event
+// and the registry change report the same removal
+const removalDedupWindow = 10 * time.Minute
+
+// uninstallEntry is a snapshot of one Uninstall subkey
+type uninstallEntry struct {
+	DisplayName    string
+	DisplayVersion string
+	Publisher      string
+}
+
+// RemovalMonitor raises alerts when required software is uninstalled
+type RemovalMonitor struct {
+	config   *config.SoftwareControlConfig
+	agentID  string
+	hostname string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+
+	required  []RequiredSoftware
+	installed map[string]uninstallEntry // keyed by Uninstall subkey path
+	alerted   map[string]time.Time      // keyed by lowercase required name
+
+	// Callbacks for SIEM communication and reinstall
+	onFetchRequired func() ([]RequiredSoftware, error)
+	onAlert         func(*SoftwareRemovalAlert) error
+	onReinstall     func(RequiredSoftware) error
+}
+
+// NewRemovalMonitor creates a new removal monitor
+func NewRemovalMonitor(cfg *config.SoftwareControlConfig, agentID, hostname string) *RemovalMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &RemovalMonitor{
+		config:    cfg,
+		agentID:   agentID,
+		hostname:  hostname,
+		ctx:       ctx,
+		cancel:    cancel,
+		installed: make(map[string]uninstallEntry),
+		alerted:   make(map[string]time.Time),
+	}
+}
+
+// SetCallbacks sets the callbacks for SIEM communication. onReinstall may
+// be nil, in which case removals are only reported.
+func (m *RemovalMonitor) SetCallbacks(
+	onFetch func() ([]RequiredSoftware, error),
+	onAlert func(*SoftwareRemovalAlert) error,
+	onReinstall func(RequiredSoftware) error,
+) {
+	m.onFetchRequired = onFetch
+	m.onAlert = onAlert
+	m.onReinstall = onReinstall
+}
+
+// Start loads the required list and begins watching the Uninstall keys
+func (m *RemovalMonitor) Start() {
+	log.Println("Starting required software removal monitor...")
+
+	if err := m.syncRequired(); err != nil {
+		log.Printf("Error fetching required software list: %v", err)
+	}
+
+	m.mutex.Lock()
+	m.installed = snapshotUninstallKeys()
+	m.mutex.Unlock()
+
+	for _, path := range uninstallKeyPaths {
+		m.wg.Add(1)
+		go m.watchKey(path)
+	}
+
+	m.wg.Add(1)
+	go m.refreshRequired()
+}
+
+// Stop stops the monitor
+func (m *RemovalMonitor) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// refreshRequired periodically refreshes the required software list
+func (m *RemovalMonitor) refreshRequired() {
+	defer m.wg.Done()
+
+	interval := time.Duration(m.config.PolicySyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = 15 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.syncRequired(); err != nil {
+				log.Printf("Error fetching required software list: %v", err)
+			}
+		}
+	}
+}
+
+// syncRequired fetches the required software list from SIEM
+func (m *RemovalMonitor) syncRequired() error {
+	if m.onFetchRequired == nil {
+		return fmt.Errorf("required software callback not configured")
+	}
+
+	required, err := m.onFetchRequired()
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.required = required
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// Inspect checks an Application log event for MSI product removal. The
+// alert is sent in the background so the event queue is not held up.
+func (m *RemovalMonitor) Inspect(event *Event) []*Event {
+	if !strings.EqualFold(event.Provider, "MsiInstaller") {
+		return nil
+	}
+
+	// 1034 = Windows Installer removed the product
+	// 11724 = Product: X -- Removal completed successfully
+	if event.EventCode != 1034 && event.EventCode != 11724 {
+		return nil
+	}
+
+	name := extractFromEventMessage(event.Message, "Product")
+	if idx := strings.Index(name, " -- "); idx != -1 {
+		name = name[:idx]
+	}
+	if name == "" {
+		name = event.EventData["param1"]
+	}
+	if name == "" {
+		return nil
+	}
+
+	userName := event.SubjectUser
+	if event.SubjectDomain != "" && userName != "" {
+		userName = event.SubjectDomain + "\\" + userName
+	}
+
+	go m.handleRemoval(uninstallEntry{DisplayName: name}, "msi_event", userName)
+	return nil
+}
+
+// watchKey waits for subkey changes under an Uninstall key
+func (m *RemovalMonitor) watchKey(path string) {
+	defer m.wg.Done()
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.NOTIFY|registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		// WOW6432Node does not exist on 32-bit Windows
+		return
+	}
+	defer key.Close()
+
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		log.Printf("Error creating registry watch event: %v", err)
+		return
+	}
+	defer windows.CloseHandle(event)
+
+	for {
+		if err := windows.RegNotifyChangeKeyValue(windows.Handle(key), true, windows.REG_NOTIFY_CHANGE_NAME, event, true); err != nil {
+			log.Printf("Error watching registry key %s: %v", path, err)
+			return
+		}
+
+		// Wake up periodically to notice shutdown
+		for {
+			result, err := windows.WaitForSingleObject(event, 1000)
+			if err != nil {
+				log.Printf("Error waiting for registry change: %v", err)
+				return
+			}
+			if m.ctx.Err() != nil {
+				return
+			}
+			if result == windows.WAIT_OBJECT_0 {
+				break
+			}
+		}
+
+		m.checkRegistry()
+	}
+}
+
+// checkRegistry compares the Uninstall keys with the last snapshot
+func (m *RemovalMonitor) checkRegistry() {
+	current := snapshotUninstallKeys()
+
+	m.mutex.Lock()
+	previous := m.installed
+	m.installed = current
+	m.mutex.Unlock()
+
+	for path, entry := range previous {
+		if _, ok := current[path]; !ok {
+			m.handleRemoval(entry, "registry", "")
+		}
+	}
+}
+
+// handleRemoval alerts and optionally reinstalls if the removed product is required
+func (m *RemovalMonitor) handleRemoval(entry uninstallEntry, source, userName string) {
+	required := m.matchRequired(entry.DisplayName)
+	if required == nil {
+		return
+	}
+
+	key := strings.ToLower(required.Name)
+	m.mutex.Lock()
+	if last, ok := m.alerted[key]; ok && time.Since(last) < removalDedupWindow {
+		m.mutex.Unlock()
+		return
+	}
+	m.alerted[key] = time.Now()
+	m.mutex.Unlock()
+
+	log.Printf("⚠ Required software removed: %s (detected via %s)", entry.DisplayName, source)
+
+	alert := &SoftwareRemovalAlert{
+		AgentID:         m.agentID,
+		ComputerName:    m.hostname,
+		SoftwareName:    entry.DisplayName,
+		SoftwareVersion: entry.DisplayVersion,
+		Publisher:       entry.Publisher,
+		RequiredName:    required.Name,
+		Source:          source,
+		UserName:        userName,
+		DetectedAt:      time.Now(),
+	}
+
+	if m.config.ReinstallRequired && required.AppID != 0 && m.onReinstall != nil {
+		alert.ReinstallStarted = true
+		go func(item RequiredSoftware) {
+			if err := m.onReinstall(item); err != nil {
+				log.Printf("Error reinstalling %s: %v", item.Name, err)
+				return
+			}
+			log.Printf("✓ Required software reinstalled: %s", item.Name)
+		}(*required)
+	}
+
+	if m.onAlert != nil {
+		if err := m.onAlert(alert); err != nil {
+			log.Printf("Error sending removal alert to SIEM: %v", err)
+		}
+	}
+}
+
+// matchRequired returns the required entry matching a product name
+func (m *RemovalMonitor) matchRequired(displayName string) *RequiredSoftware {
+	if displayName == "" {
+		return nil
+	}
+	name := strings.ToLower(displayName)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := range m.required {
+		if m.required[i].Name != "" && strings.Contains(name, strings.ToLower(m.required[i].Name)) {
+			required := m.required[i]
+			return &required
+		}
+	}
+	return nil
+}
+
+// snapshotUninstallKeys reads DisplayName, version and publisher of every Uninstall subkey
+func snapshotUninstallKeys() map[string]uninstallEntry {
+	entries := make(map[string]uninstallEntry)
+
+	for _, path := range uninstallKeyPaths {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+
+		subkeys, err := key.ReadSubKeyNames(-1)
+		key.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, subkey := range subkeys {
+			sub, err := registry.OpenKey(registry.LOCAL_MACHINE, path+`\`+subkey, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+
+			var entry uninstallEntry
+			entry.DisplayName, _, _ = sub.GetStringValue("DisplayName")
+			entry.DisplayVersion, _, _ = sub.GetStringValue("DisplayVersion")
+			entry.Publisher, _, _ = sub.GetStringValue("Publisher")
+			sub.Close()
+
+			if entry.DisplayName != "" {
+				entries[path+`\`+subkey] = entry
+			}
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,116 @@
+package collector
+
+import "time"
+
+// Software control payloads exchanged with the SIEM server. They are shared
+// by the API client on every platform; the controls themselves are Windows
+// only.
+
+// SoftwareInstallRequest represents a software installation request
+type SoftwareInstallRequest struct {
+	RequestID       string     `json:"request_id,omitempty"`
+	AgentID         string     `json:"agent_id"`
+	UserName        string     `json:"user_name"`
+	ComputerName    string     `json:"computer_name"`
+	SoftwareName    string     `json:"software_name"`
+	SoftwareVersion string     `json:"software_version,omitempty"`
+	Publisher       string     `json:"publisher,omitempty"`
+	InstallerPath   string     `json:"installer_path"`
+	ProcessID       uint32     `json:"process_id,omitempty"` // Held installer process, if intercepted
+	InstallerHash   string     `json:"installer_hash,omitempty"`
+	SignatureStatus string     `json:"signature_status,omitempty"` // valid, invalid, unsigned
+	Signer          string     `json:"signer,omitempty"`
+	PolicyName      string     `json:"policy_name,omitempty"`
+	DecisionReason  string     `json:"decision_reason,omitempty"` // Why the request was auto-approved, auto-denied or sent for approval
+	CommandLine     string     `json:"command_line,omitempty"`
+	InstallMethod   string     `json:"install_method,omitempty"` // pip, npm, choco, winget, powershell_module, script; empty for installers
+	UserComment     string     `json:"user_comment,omitempty"`
+	Status          string     `json:"status"`
+	RequestedAt     time.Time  `json:"requested_at"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	ReviewedBy      string     `json:"reviewed_by,omitempty"`
+	AdminComment    string     `json:"admin_comment,omitempty"`
+	WingetID        string     `json:"winget_id,omitempty"`        // winget package selected on approval
+	ApprovedVersion string     `json:"approved_version,omitempty"` // Exact version approved by the admin
+}
+
+// AllowlistEntry represents a server-approved software entry. Either
+// Publisher or FileHash must be set. FileHash is the Authenticode SHA256
+// as reported by Get-AppLockerFileInformation, not the flat file hash.
+type AllowlistEntry struct {
+	Name           string `json:"name"`
+	Publisher      string `json:"publisher,omitempty"`    // Certificate subject, e.g. "O=MICROSOFT CORPORATION, L=REDMOND, S=WASHINGTON, C=US"
+	ProductName    string `json:"product_name,omitempty"` // Empty = any product from publisher
+	FileHash       string `json:"file_hash,omitempty"`
+	SourceFileName string `json:"source_file_name,omitempty"`
+	SourceFileSize int64  `json:"source_file_size,omitempty"`
+}
+
+// LearningObservation aggregates every execution of one installer
+// seen during the learning period
+type LearningObservation struct {
+	InstallerHash   string    `json:"installer_hash"`
+	SoftwareName    string    `json:"software_name"`
+	SoftwareVersion string    `json:"software_version,omitempty"`
+	Publisher       string    `json:"publisher,omitempty"`
+	SignatureStatus string    `json:"signature_status,omitempty"`
+	Signer          string    `json:"signer,omitempty"`
+	InstallerPaths  []string  `json:"installer_paths"`
+	Users           []string  `json:"users"`
+	Count           int       `json:"count"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
+// LearningReport is the aggregate uploaded to SIEM for building an allowlist
+type LearningReport struct {
+	AgentID      string                 `json:"agent_id"`
+	ComputerName string                 `json:"computer_name"`
+	StartedAt    time.Time              `json:"started_at"`
+	EndsAt       time.Time              `json:"ends_at"`
+	Completed    bool                   `json:"completed"`
+	Observations []*LearningObservation `json:"observations"`
+}
+
+// ReputationQuery identifies an installer to a reputation source
+type ReputationQuery struct {
+	AgentID         string `json:"agent_id"`
+	SoftwareName    string `json:"software_name"`
+	SoftwareVersion string `json:"software_version,omitempty"`
+	InstallerHash   string `json:"installer_hash"`
+	Publisher       string `json:"publisher,omitempty"`
+	Signer          string `json:"signer,omitempty"`
+	SignatureStatus string `json:"signature_status,omitempty"`
+}
+
+// ReputationVerdict is the answer of a reputation source (server-side
+// VirusTotal proxy, internal allowlist service, ...)
+type ReputationVerdict struct {
+	Known     bool   `json:"known"`
+	Trusted   bool   `json:"trusted"`
+	Malicious bool   `json:"malicious"`
+	Score     int    `json:"score"`  // 0-100, higher is more trusted
+	Source    string `json:"source"` // e.g. "virustotal", "internal_allowlist"
+	Details   string `json:"details,omitempty"`
+}
+
+// RequiredSoftware is a server-defined product that must stay installed
+type RequiredSoftware struct {
+	Name     string `json:"name"`             // Matched case-insensitively against DisplayName
+	AppID    int    `json:"app_id,omitempty"` // App store app used for reinstall
+	Critical bool   `json:"critical,omitempty"`
+}
+
+// SoftwareRemovalAlert reports the removal of required software
+type SoftwareRemovalAlert struct {
+	AgentID          string    `json:"agent_id"`
+	ComputerName     string    `json:"computer_name"`
+	SoftwareName     string    `json:"software_name"`
+	SoftwareVersion  string    `json:"software_version,omitempty"`
+	Publisher        string    `json:"publisher,omitempty"`
+	RequiredName     string    `json:"required_name"`
+	Source           string    `json:"source"` // "msi_event" or "registry"
+	UserName         string    `json:"user_name,omitempty"`
+	ReinstallStarted bool      `json:"reinstall_started"`
+	DetectedAt       time.Time `json:"detected_at"`
+}
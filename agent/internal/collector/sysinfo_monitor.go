@@ -0,0 +1,277 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/sysinfo"
+)
+
+// System change events are sent through the normal event pipeline so an
+// IP move, domain change or hardware change shows up in the host timeline
+const (
+	SystemChangeSourceType = "SIEM Agent"
+	SystemChangeChannel    = "SIEM-Agent/SystemChange"
+	SystemChangeProvider   = "SIEM-Agent"
+
+	SystemChangeIPAddress = 9111 // Primary IP address changed
+	SystemChangeDomain    = 9112 // Joined, left or moved to another domain
+	SystemChangeHostname  = 9113 // Computer renamed
+	SystemChangeHardware  = 9114 // RAM, CPU cores or fixed volumes changed
+)
+
+// Address changes come in bursts (DHCP renew, VPN connect); wait for the
+// network to settle before gathering
+const networkChangeSettle = 10 * time.Second
+
+// SystemInfoMonitor re-gathers system information on an interval and after
+// IP address changes, reports changes to the server and raises events
+type SystemInfoMonitor struct {
+	agentID  string
+	hostname string
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	last *sysinfo.SystemInfo
+
+	// Callbacks for SIEM communication
+	onUpdate func(*RegistrationData) error
+	onEvent  func(*Event)
+}
+
+// NewSystemInfoMonitor creates a system info monitor. last is the info
+// sent at registration, or nil.
+func NewSystemInfoMonitor(agentID, hostname string, interval time.Duration, last *sysinfo.SystemInfo) *SystemInfoMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &SystemInfoMonitor{
+		agentID:  agentID,
+		hostname: hostname,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		last:     last,
+	}
+}
+
+// SetCallbacks sets the callbacks that send updates and queue events
+func (m *SystemInfoMonitor) SetCallbacks(onUpdate func(*RegistrationData) error, onEvent func(*Event)) {
+	m.onUpdate = onUpdate
+	m.onEvent = onEvent
+}
+
+// Start begins periodic and network-triggered refreshes
+func (m *SystemInfoMonitor) Start() {
+	log.Println("Starting system info monitor...")
+
+	changes := make(chan struct{}, 1)
+
+	m.wg.Add(2)
+	go m.watchAddresses(changes)
+	go m.run(changes)
+}
+
+// Stop stops the monitor
+func (m *SystemInfoMonitor) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// run refreshes on the interval and after address changes
+func (m *SystemInfoMonitor) run(changes <-chan struct{}) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.refresh("scheduled")
+		case <-changes:
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-time.After(networkChangeSettle):
+			}
+			// Drop notifications that arrived while settling
+			select {
+			case <-changes:
+			default:
+			}
+			m.refresh("network change")
+		}
+	}
+}
+
+// refresh gathers system info and reports what changed since the last run
+func (m *SystemInfoMonitor) refresh(trigger string) {
+	info, err := sysinfo.Gather()
+	if err != nil {
+		log.Printf("Error gathering system info: %v", err)
+		return
+	}
+
+	previous := m.last
+	m.last = info
+	if previous == nil {
+		return
+	}
+
+	events := m.diff(previous, info)
+	if len(events) == 0 {
+		return
+	}
+
+	log.Printf("System info changed (%s): %d change(s)", trigger, len(events))
+	for _, event := range events {
+		if m.onEvent != nil {
+			m.onEvent(event)
+		}
+	}
+
+	if m.onUpdate != nil {
+		if err := m.onUpdate(NewRegistrationData(m.agentID, info)); err != nil {
+			log.Printf("Error sending system info update: %v", err)
+		} else {
+			log.Println("✓ Sent system info update")
+		}
+	}
+}
+
+// diff returns an event for each meaningful change
+func (m *SystemInfoMonitor) diff(before, after *sysinfo.SystemInfo) []*Event {
+	var events []*Event
+
+	if before.IPAddress != after.IPAddress {
+		events = append(events, m.newChangeEvent(SystemChangeIPAddress, 1,
+			fmt.Sprintf("IP address changed from %s to %s", valueOrNone(before.IPAddress), valueOrNone(after.IPAddress)),
+			map[string]string{"old_ip": before.IPAddress, "new_ip": after.IPAddress}))
+	}
+
+	if !strings.EqualFold(before.Domain, after.Domain) {
+		var message string
+		switch {
+		case before.Domain == "":
+			message = fmt.Sprintf("Computer joined domain %s", after.Domain)
+		case after.Domain == "":
+			message = fmt.Sprintf("Computer left domain %s", before.Domain)
+		default:
+			message = fmt.Sprintf("Computer moved from domain %s to %s", before.Domain, after.Domain)
+		}
+		events = append(events, m.newChangeEvent(SystemChangeDomain, 3, message,
+			map[string]string{"old_domain": before.Domain, "new_domain": after.Domain}))
+	}
+
+	if !strings.EqualFold(before.Hostname, after.Hostname) {
+		events = append(events, m.newChangeEvent(SystemChangeHostname, 3,
+			fmt.Sprintf("Computer renamed from %s to %s", before.Hostname, after.Hostname),
+			map[string]string{"old_hostname": before.Hostname, "new_hostname": after.Hostname}))
+	}
+
+	var hardware []string
+	if before.TotalRAM_MB != after.TotalRAM_MB {
+		hardware = append(hardware, fmt.Sprintf("RAM %d MB -> %d MB", before.TotalRAM_MB, after.TotalRAM_MB))
+	}
+	if before.CPUCores != after.CPUCores {
+		hardware = append(hardware, fmt.Sprintf("CPU cores %d -> %d", before.CPUCores, after.CPUCores))
+	}
+	hardware = append(hardware, volumeChanges(before.Volumes, after.Volumes)...)
+	if len(hardware) > 0 {
+		events = append(events, m.newChangeEvent(SystemChangeHardware, 2,
+			"Hardware changed: "+strings.Join(hardware, "; "),
+			map[string]string{"changes": strings.Join(hardware, "; ")}))
+	}
+
+	return events
+}
+
+// volumeChanges describes fixed volumes that were added, removed or resized.
+// Free space is not compared; it changes all the time.
+func volumeChanges(before, after []sysinfo.Volume) []string {
+	sizes := make(map[string]uint64, len(before))
+	for _, volume := range before {
+		sizes[volume.Mount] = volume.TotalMB
+	}
+
+	var changes []string
+	for _, volume := range after {
+		size, ok := sizes[volume.Mount]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("volume %s added (%d MB)", volume.Mount, volume.TotalMB))
+		case size != volume.TotalMB:
+			changes = append(changes, fmt.Sprintf("volume %s resized %d MB -> %d MB", volume.Mount, size, volume.TotalMB))
+		}
+		delete(sizes, volume.Mount)
+	}
+	for mount := range sizes {
+		changes = append(changes, fmt.Sprintf("volume %s removed", mount))
+	}
+
+	return changes
+}
+
+// newChangeEvent builds a system change event
+func (m *SystemInfoMonitor) newChangeEvent(code, severity int, message string, data map[string]string) *Event {
+	return &Event{
+		AgentID:     m.agentID,
+		Computer:    m.hostname,
+		SourceType:  SystemChangeSourceType,
+		EventCode:   code,
+		EventTime:   time.Now(),
+		Channel:     SystemChangeChannel,
+		Provider:    SystemChangeProvider,
+		Severity:    severity,
+		Message:     message,
+		EventData:   data,
+		CollectedAt: time.Now(),
+	}
+}
+
+// valueOrNone returns s, or "(none)" when it is empty
+func valueOrNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// NewRegistrationData builds the registration payload from system info; it
+// is also sent to the system info endpoint when the info changes
+func NewRegistrationData(agentID string, info *sysinfo.SystemInfo) *RegistrationData {
+	return &RegistrationData{
+		AgentID:         agentID,
+		Hostname:        info.Hostname,
+		FQDN:            info.FQDN,
+		IPAddress:       info.IPAddress,
+		MACAddress:      info.MACAddress,
+		NetworkAdapters: info.NetworkAdapters,
+		OSVersion:       info.OSVersion,
+		OSBuild:         info.OSBuild,
+		Architecture:    info.Architecture,
+		Domain:          info.Domain,
+		CPUModel:        info.CPUModel,
+		CPUCores:        info.CPUCores,
+		TotalRAM_MB:     info.TotalRAM_MB,
+		TotalDisk_GB:    info.TotalDisk_GB,
+		Volumes:         info.Volumes,
+		DeviceClass:     info.DeviceClass,
+		Manufacturer:    info.Manufacturer,
+		Model:           info.Model,
+		SerialNumber:    info.SerialNumber,
+		BIOSVersion:     info.BIOSVersion,
+		ChassisType:     info.ChassisType,
+		Cloud:           info.Cloud,
+		Virtualization:  info.Virtualization,
+		SecurityPosture: info.SecurityPosture,
+	}
+}
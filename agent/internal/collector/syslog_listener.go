@@ -0,0 +1,446 @@
+package collector
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const SyslogSourceType = "syslog"
+
+// SyslogListener accepts syslog from firewalls, switches and appliances on
+// the agent's network over UDP, TCP and TLS (RFC 5426, 6587, 5425) and
+// queues each message as an event attributed to the device that sent it
+type SyslogListener struct {
+	config     *config.SyslogInputConfig
+	agentID    string
+	hostname   string
+	eventQueue *EventQueue
+	allowed    []*net.IPNet
+	tlsConfig  *tls.Config
+
+	udpConn   *net.UDPConn
+	listeners []net.Listener
+	slots     chan struct{} // one per open stream connection
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	wg       sync.WaitGroup
+	stopChan chan struct{}
+}
+
+// NewSyslogListener creates the listener; it binds when started
+func NewSyslogListener(cfg *config.Config, agentID string, eventQueue *EventQueue) (*SyslogListener, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	l := &SyslogListener{
+		config:     &cfg.SyslogInput,
+		agentID:    agentID,
+		hostname:   hostname,
+		eventQueue: eventQueue,
+		slots:      make(chan struct{}, cfg.SyslogInput.MaxConnections),
+		conns:      make(map[net.Conn]struct{}),
+		stopChan:   make(chan struct{}),
+	}
+
+	if l.allowed, err = parseAllowedSources(cfg.SyslogInput.AllowedSources); err != nil {
+		return nil, err
+	}
+	if cfg.SyslogInput.TLSListen != "" {
+		if l.tlsConfig, err = syslogTLSConfig(&cfg.SyslogInput); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// syslogTLSConfig loads the listener's certificate and, when configured,
+// the CA client certificates must be signed by
+func syslogTLSConfig(cfg *config.SyslogInputConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("tls_listen needs cert_file and key_file")
+	}
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// Start binds the configured listeners and begins receiving. Nothing is
+// left bound if any of them fails.
+func (l *SyslogListener) Start() error {
+	var bound, transports []string
+
+	if l.config.UDPListen != "" {
+		addr, err := net.ResolveUDPAddr("udp", l.config.UDPListen)
+		if err == nil {
+			l.udpConn, err = net.ListenUDP("udp", addr)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to listen on udp %s: %w", l.config.UDPListen, err)
+		}
+		bound = append(bound, "udp "+l.config.UDPListen)
+	}
+	if l.config.TCPListen != "" {
+		listener, err := net.Listen("tcp", l.config.TCPListen)
+		if err != nil {
+			l.closeListeners()
+			return fmt.Errorf("failed to listen on tcp %s: %w", l.config.TCPListen, err)
+		}
+		l.listeners = append(l.listeners, listener)
+		transports = append(transports, "tcp")
+		bound = append(bound, "tcp "+l.config.TCPListen)
+	}
+	if l.config.TLSListen != "" {
+		listener, err := tls.Listen("tcp", l.config.TLSListen, l.tlsConfig)
+		if err != nil {
+			l.closeListeners()
+			return fmt.Errorf("failed to listen on tls %s: %w", l.config.TLSListen, err)
+		}
+		l.listeners = append(l.listeners, listener)
+		transports = append(transports, "tls")
+		bound = append(bound, "tls "+l.config.TLSListen)
+	}
+
+	log.Printf("Receiving syslog on %s", strings.Join(bound, ", "))
+
+	if l.udpConn != nil {
+		l.wg.Add(1)
+		go l.receiveUDP()
+	}
+	for i, listener := range l.listeners {
+		l.wg.Add(1)
+		go l.accept(listener, transports[i])
+	}
+	return nil
+}
+
+// Stop closes the listeners and open connections and waits for the
+// receivers
+func (l *SyslogListener) Stop() {
+	close(l.stopChan)
+	l.closeListeners()
+
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	log.Println("Syslog listener stopped")
+}
+
+// closeListeners closes the bound sockets
+func (l *SyslogListener) closeListeners() {
+	if l.udpConn != nil {
+		l.udpConn.Close()
+	}
+	for _, listener := range l.listeners {
+		listener.Close()
+	}
+}
+
+// stopping reports whether Stop was called
+func (l *SyslogListener) stopping() bool {
+	select {
+	case <-l.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// receiveUDP reads one message per datagram until the listener stops
+func (l *SyslogListener) receiveUDP() {
+	defer l.wg.Done()
+
+	buffer := make([]byte, 65535)
+	for {
+		n, from, err := l.udpConn.ReadFromUDP(buffer)
+		if err != nil {
+			if l.stopping() {
+				return
+			}
+			log.Printf("Error receiving syslog: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if !sourceAllowed(l.allowed, from.IP) {
+			continue
+		}
+		l.handle(buffer[:min(n, l.config.MaxMessageSize)], from.IP, "udp")
+	}
+}
+
+// accept serves stream connections until the listener stops
+func (l *SyslogListener) accept(listener net.Listener, transport string) {
+	defer l.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if l.stopping() {
+				return
+			}
+			log.Printf("Error accepting syslog connection: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		from := conn.RemoteAddr().(*net.TCPAddr).IP
+		if !sourceAllowed(l.allowed, from) {
+			conn.Close()
+			continue
+		}
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			log.Printf("Refused syslog connection from %s: %d connections open", from, cap(l.slots))
+			conn.Close()
+			continue
+		}
+
+		// Stop closes the connections registered before it
+		l.mu.Lock()
+		if l.stopping() {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.serve(conn, from, transport)
+	}
+}
+
+// serve reads framed messages from a stream connection until it closes
+func (l *SyslogListener) serve(conn net.Conn, from net.IP, transport string) {
+	defer l.wg.Done()
+	defer func() {
+		conn.Close()
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		<-l.slots
+	}()
+
+	// The deadline also covers the TLS handshake and a frame sent slowly
+	idleTimeout := time.Duration(l.config.IdleTimeout) * time.Second
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		message, err := readSyslogFrame(reader, l.config.MaxMessageSize)
+		if err != nil {
+			if err != io.EOF && !l.stopping() {
+				log.Printf("Syslog connection from %s closed: %v", from, err)
+			}
+			return
+		}
+		l.handle(message, from, transport)
+	}
+}
+
+// readSyslogFrame reads one message from a stream. Senders use either
+// octet counting ("LEN MSG") or a newline after each message (RFC 6587);
+// a frame starting with a digit is octet-counted. Messages over maxSize
+// bytes are truncated.
+func readSyslogFrame(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		length := 0
+		for digits := 0; ; digits++ {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b == ' ' && digits > 0 {
+				break
+			}
+			if b < '0' || b > '9' || digits == 8 {
+				return nil, fmt.Errorf("invalid frame length")
+			}
+			length = length*10 + int(b-'0')
+		}
+		message := make([]byte, min(length, maxSize))
+		if _, err := io.ReadFull(reader, message); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(length - len(message)); err != nil {
+			return nil, err
+		}
+		return message, nil
+	}
+
+	var message []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if room := maxSize - len(message); room > 0 {
+			message = append(message, chunk[:min(len(chunk), room)]...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(message) == 0) {
+			return nil, err
+		}
+		return message, nil
+	}
+}
+
+// handle parses a message and queues it as an event
+func (l *SyslogListener) handle(data []byte, from net.IP, transport string) {
+	raw := strings.TrimRight(string(data), "\r\n\x00")
+	if raw == "" {
+		return
+	}
+	l.eventQueue.Push(l.newEvent(parseSyslog(raw, time.Now()), from, transport))
+}
+
+// newEvent converts a syslog message into a normalized event. The device
+// is the hostname in the message, so messages relayed by another syslog
+// server keep their origin; without one it is the sending address.
+func (l *SyslogListener) newEvent(msg *syslogMessage, from net.IP, transport string) *Event {
+	severity := msg.priority & 7
+	facility := msg.priority >> 3
+
+	eventTime := msg.timestamp
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+
+	data := map[string]string{
+		"priority":  strconv.Itoa(severity),
+		"facility":  syslogFacilityName(facility),
+		"format":    msg.format,
+		"transport": transport,
+		"source_ip": from.String(),
+	}
+	if msg.msgID != "" {
+		data["msgid"] = msg.msgID
+	}
+	for key, value := range msg.structured {
+		data[key] = value
+	}
+
+	event := &Event{
+		AgentID:     l.agentID,
+		Computer:    from.String(),
+		IPAddress:   from.String(),
+		CollectedBy: l.hostname,
+		SourceType:  SyslogSourceType,
+		EventCode:   severity,
+		EventTime:   eventTime,
+		Channel:     syslogFacilityName(facility),
+		Provider:    msg.appName,
+		Severity:    SeverityFromSyslogPriority(severity),
+		Message:     msg.message,
+		ProcessName: msg.appName,
+		EventData:   data,
+		CollectedAt: time.Now(),
+	}
+	if msg.hostname != "" {
+		if ip := net.ParseIP(msg.hostname); ip != nil {
+			event.Computer = msg.hostname
+			event.IPAddress = msg.hostname
+		} else if name, _, found := strings.Cut(msg.hostname, "."); found {
+			event.Computer = name
+			event.FQDN = msg.hostname
+		} else {
+			event.Computer = msg.hostname
+		}
+	}
+	if pid, err := strconv.Atoi(msg.procID); err == nil {
+		event.ProcessID = pid
+	}
+
+	if l.config.ParseCEF {
+		if record, ok := parseCEF(msg.message); ok {
+			applyCEF(event, record)
+		}
+	}
+	return event
+}
+
+// applyCEF fills an event from a CEF payload: the header names the device
+// and the signature, and the common extension keys map to event fields
+func applyCEF(event *Event, record *cefRecord) {
+	event.Provider = strings.TrimSpace(record.vendor + " " + record.product)
+	event.Message = record.name
+	event.Severity = cefSeverity(record.severity)
+	if code, err := strconv.Atoi(record.signatureID); err == nil {
+		event.EventCode = code
+	}
+
+	data := event.EventData
+	data["cef_vendor"] = record.vendor
+	data["cef_product"] = record.product
+	data["cef_version"] = record.deviceVersion
+	data["cef_signature_id"] = record.signatureID
+	data["cef_severity"] = record.severity
+	for key, value := range record.extension {
+		data[key] = value
+	}
+
+	ext := record.extension
+	event.SourceIP = ext["src"]
+	event.SourceHostname = ext["shost"]
+	event.DestinationIP = ext["dst"]
+	event.Protocol = ext["proto"]
+	event.SubjectUser = ext["suser"]
+	event.TargetUser = ext["duser"]
+	event.FilePath = ext["filePath"]
+	event.FileHash = ext["fileHash"]
+	if ext["sproc"] != "" {
+		event.ProcessName = ext["sproc"]
+	}
+	if port, err := strconv.Atoi(ext["spt"]); err == nil {
+		event.SourcePort = port
+	}
+	if port, err := strconv.Atoi(ext["dpt"]); err == nil {
+		event.DestinationPort = port
+	}
+	if pid, err := strconv.Atoi(ext["spid"]); err == nil {
+		event.ProcessID = pid
+	}
+}
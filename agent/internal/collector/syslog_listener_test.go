@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSyslogFrame(t *testing.T) {
+	long := strings.Repeat("a", 40)
+
+	tests := []struct {
+		name       string
+		input      string
+		maxSize    int
+		bufferSize int // reader buffer, 4096 when not set
+		want       []string
+		wantErr    error // after the frames
+	}{
+		{name: "empty stream", input: "", maxSize: 100, wantErr: io.EOF},
+		{name: "octet counting", input: "5 hello6 world!", maxSize: 100, want: []string{"hello", "world!"}, wantErr: io.EOF},
+		{name: "newline delimited", input: "<13>a\n<13>b\n", maxSize: 100, want: []string{"<13>a\n", "<13>b\n"}, wantErr: io.EOF},
+		{name: "mixed framing", input: "3 abc<1>x\n", maxSize: 100, want: []string{"abc", "<1>x\n"}, wantErr: io.EOF},
+		{name: "unterminated last line", input: "a\nb", maxSize: 100, want: []string{"a\n", "b"}, wantErr: io.EOF},
+		{name: "leading zero is not a length", input: "0 x\n", maxSize: 100, want: []string{"0 x\n"}, wantErr: io.EOF},
+		{name: "line truncated", input: "abcdefgh\nxy\n", maxSize: 4, want: []string{"abcd", "xy\n"}, wantErr: io.EOF},
+		{name: "octet frame truncated", input: "6 abcdef2 gh", maxSize: 3, want: []string{"abc", "gh"}, wantErr: io.EOF},
+		{name: "line longer than the buffer", input: long + "\nb\n", maxSize: 100, bufferSize: 16, want: []string{long + "\n", "b\n"}, wantErr: io.EOF},
+		{name: "long line truncated", input: long + "\nb\n", maxSize: 20, bufferSize: 16, want: []string{long[:20], "b\n"}, wantErr: io.EOF},
+		{name: "eight digit length cut short", input: "12345678 abc", maxSize: 100, wantErr: io.ErrUnexpectedEOF},
+		{name: "length without message", input: "12", maxSize: 100, wantErr: io.EOF},
+		{name: "invalid length", input: "12a hello", maxSize: 100, wantErr: errors.New("invalid frame length")},
+		{name: "length over eight digits", input: "123456789 x", maxSize: 100, wantErr: errors.New("invalid frame length")},
+		{name: "frame after invalid length", input: "5 hello1x", maxSize: 100, want: []string{"hello"}, wantErr: errors.New("invalid frame length")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bufferSize := tt.bufferSize
+			if bufferSize == 0 {
+				bufferSize = 4096
+			}
+			reader := bufio.NewReaderSize(strings.NewReader(tt.input), bufferSize)
+
+			var frames []string
+			var err error
+			for {
+				var frame []byte
+				if frame, err = readSyslogFrame(reader, tt.maxSize); err != nil {
+					break
+				}
+				frames = append(frames, string(frame))
+			}
+
+			if !reflect.DeepEqual(frames, tt.want) {
+				t.Errorf("frames = %q, want %q", frames, tt.want)
+			}
+			if err.Error() != tt.wantErr.Error() {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
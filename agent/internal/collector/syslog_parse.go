@@ -0,0 +1,306 @@
+package collector
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogFacilities names the SYSLOG_FACILITY values (RFC 5424)
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogFacilityName names a syslog facility number
+func syslogFacilityName(facility int) string {
+	if facility >= 0 && facility < len(syslogFacilities) {
+		return syslogFacilities[facility]
+	}
+	return strconv.Itoa(facility)
+}
+
+// syslogDefaultPriority is user.notice, assumed for messages without a PRI
+// part (RFC 3164 4.3.3)
+const syslogDefaultPriority = 13
+
+// syslogMessage is a parsed RFC 5424 or RFC 3164 message. Fields the
+// sender left out are empty.
+type syslogMessage struct {
+	format     string // "rfc5424" or "rfc3164"
+	priority   int    // facility*8 + severity
+	timestamp  time.Time
+	hostname   string
+	appName    string
+	procID     string
+	msgID      string
+	structured map[string]string // RFC 5424 structured data as "sd-id.param"
+	message    string
+}
+
+// parseSyslog parses a message in either format. Anything after a valid
+// PRI that is not RFC 5424 is read as RFC 3164, which in practice means
+// whatever the device sent; the parse never fails.
+func parseSyslog(raw string, now time.Time) *syslogMessage {
+	msg := &syslogMessage{format: "rfc3164", priority: syslogDefaultPriority}
+
+	rest := raw
+	if strings.HasPrefix(rest, "<") {
+		if end := strings.IndexByte(rest, '>'); end > 1 && end <= 4 {
+			if priority, err := strconv.Atoi(rest[1:end]); err == nil && priority <= 191 {
+				msg.priority = priority
+				rest = rest[end+1:]
+			}
+		}
+	}
+
+	if strings.HasPrefix(rest, "1 ") && parseSyslog5424(rest[2:], msg) {
+		msg.format = "rfc5424"
+		return msg
+	}
+	parseSyslog3164(rest, now, msg)
+	return msg
+}
+
+// parseSyslog5424 parses an RFC 5424 message after the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseSyslog5424(rest string, msg *syslogMessage) bool {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return false
+	}
+	nilValue := func(value string) string {
+		if value == "-" {
+			return ""
+		}
+		return value
+	}
+
+	if fields[0] != "-" {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return false
+		}
+		msg.timestamp = timestamp
+	}
+	msg.hostname = nilValue(fields[1])
+	msg.appName = nilValue(fields[2])
+	msg.procID = nilValue(fields[3])
+	msg.msgID = nilValue(fields[4])
+
+	structured, message, ok := parseStructuredData(fields[5])
+	if !ok {
+		return false
+	}
+	msg.structured = structured
+	msg.message = strings.TrimPrefix(message, "\ufeff")
+	return true
+}
+
+// parseStructuredData parses the STRUCTURED-DATA part and returns the rest
+// of the message: [id name="value" ...][id ...] or "-"
+func parseStructuredData(data string) (map[string]string, string, bool) {
+	if strings.HasPrefix(data, "-") {
+		return nil, strings.TrimPrefix(data[1:], " "), true
+	}
+
+	params := make(map[string]string)
+	i := 0
+	for i < len(data) && data[i] == '[' {
+		i++
+		start := i
+		for i < len(data) && data[i] != ' ' && data[i] != ']' {
+			i++
+		}
+		id := data[start:i]
+
+		for i < len(data) && data[i] == ' ' {
+			i++
+			start = i
+			for i < len(data) && data[i] != '=' {
+				i++
+			}
+			if i+1 >= len(data) || data[i+1] != '"' {
+				return nil, "", false
+			}
+			name := data[start:i]
+			i += 2
+
+			var value strings.Builder
+			for i < len(data) && data[i] != '"' {
+				// \" \\ and \] are escapes; any other backslash is literal
+				if data[i] == '\\' && i+1 < len(data) && strings.IndexByte(`"\]`, data[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(data[i])
+				i++
+			}
+			if i >= len(data) {
+				return nil, "", false
+			}
+			i++
+			params[id+"."+name] = value.String()
+		}
+
+		if i >= len(data) || data[i] != ']' {
+			return nil, "", false
+		}
+		i++
+	}
+	if i == 0 {
+		return nil, "", false
+	}
+	return params, strings.TrimPrefix(data[i:], " "), true
+}
+
+// syslogTagPattern matches an RFC 3164 TAG: "sshd[1234]:" or "kernel:"
+var syslogTagPattern = regexp.MustCompile(`^([\w./-]{1,48})(?:\[([^\]]{1,32})\])?: ?`)
+
+// parseSyslog3164 parses the BSD format: "Mmm dd hh:mm:ss HOST TAG: MSG".
+// Devices differ: some send an RFC 3339 timestamp, some no timestamp or no
+// hostname. The year is not sent, so it is inferred from the current date.
+func parseSyslog3164(rest string, now time.Time, msg *syslogMessage) {
+	if len(rest) >= len(time.Stamp) {
+		if timestamp, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], time.Local); err == nil {
+			timestamp = timestamp.AddDate(now.Year(), 0, 0)
+			if timestamp.After(now.Add(24 * time.Hour)) {
+				timestamp = timestamp.AddDate(-1, 0, 0)
+			}
+			msg.timestamp = timestamp
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+		}
+	}
+	if msg.timestamp.IsZero() {
+		if field, after, found := strings.Cut(rest, " "); found {
+			if timestamp, err := time.Parse(time.RFC3339Nano, field); err == nil {
+				msg.timestamp = timestamp
+				rest = after
+			}
+		}
+	}
+
+	// Without a timestamp there is no reliable hostname either
+	if !msg.timestamp.IsZero() {
+		if field, after, found := strings.Cut(rest, " "); found && !syslogTagPattern.MatchString(field+" ") {
+			msg.hostname = field
+			rest = after
+		}
+	}
+
+	// A CEF payload has no tag; "CEF:" is not one
+	if match := syslogTagPattern.FindStringSubmatch(rest); match != nil && !strings.HasPrefix(rest, "CEF:") {
+		msg.appName = match[1]
+		msg.procID = match[2]
+		rest = rest[len(match[0]):]
+	}
+	msg.message = rest
+}
+
+// cefRecord is a parsed ArcSight Common Event Format payload:
+// CEF:Version|Vendor|Product|Version|Signature ID|Name|Severity|Extension
+type cefRecord struct {
+	vendor        string
+	product       string
+	deviceVersion string
+	signatureID   string
+	name          string
+	severity      string
+	extension     map[string]string
+}
+
+// cefKeyPattern finds the keys of a CEF extension; values may contain
+// spaces, so a value runs until the next key
+var cefKeyPattern = regexp.MustCompile(`(?:^|\s)([\w.\[\]-]+)=`)
+
+// parseCEF parses a CEF payload. Devices put it at the start of the syslog
+// message, sometimes after a hostname or a timestamp.
+func parseCEF(message string) (*cefRecord, bool) {
+	start := strings.Index(message, "CEF:")
+	if start < 0 || (start > 0 && message[start-1] != ' ') {
+		return nil, false
+	}
+	rest := message[start+len("CEF:"):]
+
+	// Header fields are separated by unescaped pipes
+	var header []string
+	var field strings.Builder
+	i := 0
+	for ; i < len(rest) && len(header) < 7; i++ {
+		switch {
+		case rest[i] == '\\' && i+1 < len(rest) && (rest[i+1] == '|' || rest[i+1] == '\\'):
+			i++
+			field.WriteByte(rest[i])
+		case rest[i] == '|':
+			header = append(header, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(rest[i])
+		}
+	}
+	if len(header) < 7 {
+		return nil, false
+	}
+
+	record := &cefRecord{
+		vendor:        header[1],
+		product:       header[2],
+		deviceVersion: header[3],
+		signatureID:   header[4],
+		name:          header[5],
+		severity:      header[6],
+		extension:     make(map[string]string),
+	}
+
+	extension := rest[i:]
+	keys := cefKeyPattern.FindAllStringSubmatchIndex(extension, -1)
+	for k, match := range keys {
+		end := len(extension)
+		if k+1 < len(keys) {
+			end = keys[k+1][0]
+		}
+		key := extension[match[2]:match[3]]
+		record.extension[key] = cefUnescape(strings.TrimSpace(extension[match[1]:end]))
+	}
+	return record, true
+}
+
+// cefUnescape decodes the escapes of an extension value
+func cefUnescape(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\=`, `=`, `\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(value)
+}
+
+// cefSeverity converts a CEF severity (0-10, or Low, Medium, High,
+// Very-High) to our 1-5 scale
+func cefSeverity(severity string) int {
+	level, err := strconv.Atoi(severity)
+	if err != nil {
+		switch strings.ToLower(severity) {
+		case "low":
+			level = 3
+		case "medium":
+			level = 6
+		case "high":
+			level = 8
+		case "very-high":
+			level = 10
+		default:
+			return 2
+		}
+	}
+
+	switch {
+	case level >= 9:
+		return 5
+	case level >= 7:
+		return 4
+	case level >= 4:
+		return 3
+	default:
+		return 1
+	}
+}
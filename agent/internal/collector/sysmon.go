@@ -1,10 +1,8 @@
 package collector
 
 import (
-	"encoding/xml"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // SysmonEvent represents a Sysmon event with enhanced parsing
@@ -13,6 +11,18 @@ type SysmonEvent struct {
 	*Event
 }
 
+// SysmonService returns the name of the installed Sysmon service (Sysmon64
+// or Sysmon, after the binary that installed it), or "" when Sysmon is
+// not installed
+func SysmonService() string {
+	for _, name := range []string{"Sysmon64", "Sysmon"} {
+		if serviceExists(name) {
+			return name
+		}
+	}
+	return ""
+}
+
 // ParseSysmonEvent enhances event with Sysmon-specific parsing
 func ParseSysmonEvent(event *Event) *Event {
 	if event.SourceType != "Sysmon" {
@@ -0,0 +1,375 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// TAXII 2.1 media type
+const taxiiMediaType = "application/taxii+json;version=2.1"
+
+// Pages fetched per feed and sync; the rest follow on the next sync
+const taxiiMaxPages = 100
+
+// TAXIIFeedStatus is the sync state of a TAXII feed in heartbeats
+type TAXIIFeedStatus struct {
+	Name       string    `json:"name"`
+	Indicators int       `json:"indicators"` // active indicators matched locally
+	LastSync   time.Time `json:"last_sync"`  // last successful poll
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// taxiiObservable is a value a STIX pattern compares against
+type taxiiObservable struct {
+	Type  string `json:"type"` // IOC type
+	Value string `json:"value"`
+}
+
+// taxiiIndicator is a STIX indicator reduced to what the matcher uses
+type taxiiIndicator struct {
+	Observables []taxiiObservable `json:"observables"`
+	ValidUntil  time.Time         `json:"valid_until,omitempty"`
+}
+
+// taxiiFeedState is persisted per feed, so polls only ask for objects
+// added since the last one
+type taxiiFeedState struct {
+	AddedAfter string                    `json:"added_after,omitempty"` // X-TAXII-Date-Added-Last, verbatim
+	Indicators map[string]taxiiIndicator `json:"indicators"`            // by STIX ID
+	LastSync   time.Time                 `json:"last_sync"`
+	LastError  string                    `json:"-"`
+}
+
+// TAXIISync polls STIX 2.1 indicator collections from TAXII 2.1 servers and
+// loads their hash, IP and domain indicators into the IOC matcher. Feeds
+// can also be pulled through the SIEM server's TAXII proxy, for agents
+// without Internet access.
+type TAXIISync struct {
+	config     *config.ThreatIntelConfig
+	matcher    *IOCMatcher
+	statePath  string
+	httpClient *http.Client
+
+	proxyRoot string // SIEM server TAXII proxy, for via_server feeds
+
+	mutex sync.Mutex
+	feeds map[string]*taxiiFeedState
+}
+
+// NewTAXIISync creates the feed sync and loads the indicators kept from
+// the last polls into the matcher
+func NewTAXIISync(cfg *config.ThreatIntelConfig, matcher *IOCMatcher) *TAXIISync {
+	s := &TAXIISync{
+		config:    cfg,
+		matcher:   matcher,
+		statePath: filepath.Join(filepath.Dir(cfg.IOCFile), "taxii_state.json"),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+			},
+		},
+		feeds: make(map[string]*taxiiFeedState),
+	}
+
+	if data, err := os.ReadFile(s.statePath); err == nil {
+		if err := json.Unmarshal(data, &s.feeds); err != nil {
+			log.Printf("Warning: Failed to read TAXII feed state: %v", err)
+			s.feeds = make(map[string]*taxiiFeedState)
+		}
+	}
+
+	for _, feed := range cfg.TAXIIFeeds {
+		if state, ok := s.feeds[feed.Name]; ok {
+			s.matcher.LoadFeed(feed.Name, state.lists(feed))
+		}
+	}
+
+	return s
+}
+
+// SetServerProxy sets the SIEM server's TAXII API root, used for feeds with
+// via_server, and the transport that adds the agent's credential to
+// requests for the SIEM server
+func (s *TAXIISync) SetServerProxy(apiRoot string, transport ServerTransport) {
+	s.proxyRoot = apiRoot
+	s.httpClient.Transport = transport(s.httpClient.Transport)
+}
+
+// Start polls every feed immediately and then periodically
+func (s *TAXIISync) Start(ctx context.Context) {
+	interval := time.Duration(s.config.SyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = time.Hour
+	}
+
+	s.syncAll(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncAll(ctx)
+		}
+	}
+}
+
+// syncAll polls every feed and stores the state
+func (s *TAXIISync) syncAll(ctx context.Context) {
+	for _, feed := range s.config.TAXIIFeeds {
+		if err := s.SyncFeed(ctx, feed); err != nil {
+			log.Printf("Error syncing TAXII feed %s: %v", feed.Name, err)
+		}
+	}
+
+	s.mutex.Lock()
+	data, err := json.Marshal(s.feeds)
+	s.mutex.Unlock()
+	if err != nil {
+		log.Printf("Warning: Failed to encode TAXII feed state: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0700); err != nil {
+		log.Printf("Warning: Failed to store TAXII feed state: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.statePath, data, 0600); err != nil {
+		log.Printf("Warning: Failed to store TAXII feed state: %v", err)
+	}
+}
+
+// SyncFeed fetches the indicators added to a feed since its last poll and
+// reloads the feed's lists in the matcher
+func (s *TAXIISync) SyncFeed(ctx context.Context, feed config.TAXIIFeed) error {
+	s.mutex.Lock()
+	state, ok := s.feeds[feed.Name]
+	if !ok {
+		state = &taxiiFeedState{Indicators: make(map[string]taxiiIndicator)}
+		s.feeds[feed.Name] = state
+	}
+	s.mutex.Unlock()
+
+	err := s.poll(ctx, feed, state)
+
+	s.mutex.Lock()
+	if err != nil {
+		state.LastError = err.Error()
+	} else {
+		state.LastError = ""
+		state.LastSync = time.Now()
+	}
+	state.expire(time.Now())
+	lists := state.lists(feed)
+	count := len(state.Indicators)
+	s.mutex.Unlock()
+
+	// Indicators fetched before an error are kept
+	s.matcher.LoadFeed(feed.Name, lists)
+	if err == nil {
+		log.Printf("TAXII feed %s synced: %d indicators", feed.Name, count)
+	}
+	return err
+}
+
+// taxiiEnvelope is a TAXII 2.1 envelope of STIX objects
+type taxiiEnvelope struct {
+	More    bool              `json:"more"`
+	Next    string            `json:"next"`
+	Objects []json.RawMessage `json:"objects"`
+}
+
+// stixIndicator is the part of a STIX 2.1 indicator the agent reads
+type stixIndicator struct {
+	Type        string    `json:"type"`
+	ID          string    `json:"id"`
+	Pattern     string    `json:"pattern"`
+	PatternType string    `json:"pattern_type"`
+	ValidUntil  time.Time `json:"valid_until"`
+	Revoked     bool      `json:"revoked"`
+}
+
+// poll fetches the pages of indicators added since the last poll
+func (s *TAXIISync) poll(ctx context.Context, feed config.TAXIIFeed, state *taxiiFeedState) error {
+	apiRoot := feed.APIRoot
+	if feed.ViaServer {
+		apiRoot = s.proxyRoot
+	}
+	if apiRoot == "" || feed.Collection == "" {
+		return fmt.Errorf("api_root and collection are required")
+	}
+	endpoint := strings.TrimSuffix(apiRoot, "/") + "/collections/" + url.PathEscape(feed.Collection) + "/objects/"
+
+	next := ""
+	for page := 0; page < taxiiMaxPages; page++ {
+		query := url.Values{"match[type]": {"indicator"}}
+		if state.AddedAfter != "" {
+			query.Set("added_after", state.AddedAfter)
+		}
+		if next != "" {
+			query.Set("next", next)
+		}
+
+		envelope, addedLast, err := s.fetch(ctx, feed, endpoint+"?"+query.Encode())
+		if err != nil {
+			return err
+		}
+
+		s.mutex.Lock()
+		for _, object := range envelope.Objects {
+			var indicator stixIndicator
+			if err := json.Unmarshal(object, &indicator); err != nil || indicator.Type != "indicator" {
+				continue
+			}
+			observables := parseSTIXPattern(indicator)
+			if indicator.Revoked || len(observables) == 0 {
+				delete(state.Indicators, indicator.ID)
+				continue
+			}
+			state.Indicators[indicator.ID] = taxiiIndicator{Observables: observables, ValidUntil: indicator.ValidUntil}
+		}
+		if addedLast != "" && !envelope.More {
+			state.AddedAfter = addedLast
+		}
+		s.mutex.Unlock()
+
+		if !envelope.More || envelope.Next == "" {
+			return nil
+		}
+		next = envelope.Next
+	}
+	return nil
+}
+
+// fetch gets one page of a collection
+func (s *TAXIISync) fetch(ctx context.Context, feed config.TAXIIFeed, endpoint string) (*taxiiEnvelope, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", taxiiMediaType)
+	if !feed.ViaServer && feed.Username != "" {
+		req.SetBasicAuth(feed.Username, feed.Password)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var envelope taxiiEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, "", fmt.Errorf("failed to parse envelope: %w", err)
+	}
+	return &envelope, resp.Header.Get("X-TAXII-Date-Added-Last"), nil
+}
+
+// expire removes indicators past their valid_until
+func (s *taxiiFeedState) expire(now time.Time) {
+	for id, indicator := range s.Indicators {
+		if !indicator.ValidUntil.IsZero() && indicator.ValidUntil.Before(now) {
+			delete(s.Indicators, id)
+		}
+	}
+}
+
+// lists converts the feed's indicators into IOC lists, one per type
+func (s *taxiiFeedState) lists(feed config.TAXIIFeed) []IOCList {
+	values := make(map[string][]string)
+	for _, indicator := range s.Indicators {
+		for _, observable := range indicator.Observables {
+			values[observable.Type] = append(values[observable.Type], observable.Value)
+		}
+	}
+
+	lists := make([]IOCList, 0, len(values))
+	for kind, kindValues := range values {
+		lists = append(lists, NewIOCList(feed.Name, kind, feed.Severity, kindValues))
+	}
+	return lists
+}
+
+// Stats returns the sync state of every configured feed
+func (s *TAXIISync) Stats() []TAXIIFeedStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make([]TAXIIFeedStatus, 0, len(s.config.TAXIIFeeds))
+	for _, feed := range s.config.TAXIIFeeds {
+		status := TAXIIFeedStatus{Name: feed.Name}
+		if state, ok := s.feeds[feed.Name]; ok {
+			status.Indicators = len(state.Indicators)
+			status.LastSync = state.LastSync
+			status.LastError = state.LastError
+		}
+		stats = append(stats, status)
+	}
+	return stats
+}
+
+// stixComparison matches "object-type:path = 'value'" in a STIX pattern
+var stixComparison = regexp.MustCompile(`([a-z0-9-]+):([A-Za-z0-9_.'-]+)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// stixQuoted matches string literals, removed before looking for operators
+var stixQuoted = regexp.MustCompile(`'(?:[^'\\]|\\.)*'`)
+
+// parseSTIXPattern returns the values of a STIX pattern that are matched
+// exactly: equality comparisons on file hashes, IP addresses and domain
+// names, joined by OR. Patterns that combine observations (AND,
+// FOLLOWEDBY, qualifiers) or use other operators cannot be evaluated one
+// event at a time and yield nothing.
+func parseSTIXPattern(indicator stixIndicator) []taxiiObservable {
+	if indicator.PatternType != "" && indicator.PatternType != "stix" {
+		return nil
+	}
+
+	operators := stixQuoted.ReplaceAllString(indicator.Pattern, "''")
+	for _, keyword := range []string{" AND ", "FOLLOWEDBY", "WITHIN", "REPEATS", "START", "!=", "LIKE", "MATCHES", " IN ", "ISSUBSET", "ISSUPERSET", "<", ">"} {
+		if strings.Contains(operators, keyword) {
+			return nil
+		}
+	}
+
+	var observables []taxiiObservable
+	for _, match := range stixComparison.FindAllStringSubmatch(indicator.Pattern, -1) {
+		object, path := match[1], match[2]
+		value := strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(match[3])
+
+		switch {
+		case object == "file" && strings.HasPrefix(path, "hashes."):
+			observables = append(observables, taxiiObservable{Type: IOCTypeHash, Value: value})
+		case (object == "ipv4-addr" || object == "ipv6-addr") && path == "value":
+			if strings.Contains(value, "/") {
+				return nil // CIDR ranges are not exact
+			}
+			observables = append(observables, taxiiObservable{Type: IOCTypeIP, Value: value})
+		case object == "domain-name" && path == "value":
+			observables = append(observables, taxiiObservable{Type: IOCTypeDomain, Value: value})
+		default:
+			return nil // the whole pattern must be matchable, or an OR branch is lost
+		}
+	}
+	return observables
+}
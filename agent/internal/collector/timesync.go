@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// TimeSyncStatus is the state of the host's time synchronization, reported
+// in heartbeats
+type TimeSyncStatus struct {
+	Service     string    `json:"service"`          // W32Time, chronyd, systemd-timesyncd, ...
+	Running     bool      `json:"running"`          // the service is running
+	Synced      bool      `json:"synced"`           // synchronized to an external source
+	Source      string    `json:"source,omitempty"` // domain controller or NTP server in use
+	OffsetMs    float64   `json:"offset_ms"`        // source clock minus local clock (NTP convention), when known
+	OffsetKnown bool      `json:"offset_known"`     // the offset could be measured
+	Error       string    `json:"error,omitempty"`  // why the offset could not be measured
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// TimeSyncMonitor raises health events when the time service stops, the
+// host is not synchronized to an external source, or the clock drifts past
+// a threshold, and again once it recovers. Kerberos fails beyond a few
+// minutes of skew, and event timelines are wrong long before that.
+type TimeSyncMonitor struct {
+	config   *config.TimeSyncConfig
+	agentID  string
+	hostname string
+
+	mutex     sync.Mutex
+	status    *TimeSyncStatus
+	unsynced  bool // service stopped or no external source
+	drifted   bool // offset beyond the threshold
+	lastCheck time.Time
+}
+
+// NewTimeSyncMonitor creates a time synchronization monitor
+func NewTimeSyncMonitor(cfg *config.TimeSyncConfig, agentID, hostname string) *TimeSyncMonitor {
+	return &TimeSyncMonitor{
+		config:   cfg,
+		agentID:  agentID,
+		hostname: hostname,
+	}
+}
+
+// Check queries the time service once per check interval and returns
+// events for problems that appeared or cleared since the last check
+func (m *TimeSyncMonitor) Check() []*Event {
+	m.mutex.Lock()
+	due := time.Since(m.lastCheck) >= time.Duration(m.config.CheckInterval)*time.Second
+	if due {
+		m.lastCheck = time.Now()
+	}
+	m.mutex.Unlock()
+	if !due {
+		return nil
+	}
+
+	status := queryTimeSync(m.config.Reference)
+	if status == nil {
+		return nil // not supported on this platform
+	}
+	status.CheckedAt = time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.status = status
+
+	data := map[string]string{
+		"service":       status.Service,
+		"running":       strconv.FormatBool(status.Running),
+		"synced":        strconv.FormatBool(status.Synced),
+		"source":        status.Source,
+		"max_offset_ms": strconv.Itoa(m.config.MaxOffsetMs),
+	}
+	if status.OffsetKnown {
+		data["offset_ms"] = strconv.FormatFloat(status.OffsetMs, 'f', 1, 64)
+	}
+
+	var events []*Event
+	unsynced := !status.Running || !status.Synced
+	switch {
+	case unsynced && !m.unsynced:
+		reason := fmt.Sprintf("time service %s is not running", status.Service)
+		if status.Running {
+			reason = fmt.Sprintf("time service %s is not synchronized to an external source (%s)", status.Service, status.Source)
+		}
+		log.Printf("Warning: %s", reason)
+		events = append(events, newHealthEvent(m.agentID, m.hostname, HealthEventTimeSyncStopped, 4,
+			"Time synchronization problem: "+reason, data))
+	case !unsynced && m.unsynced:
+		events = append(events, newHealthEvent(m.agentID, m.hostname, HealthEventTimeSyncOK, 1,
+			fmt.Sprintf("Time synchronization restored: %s synchronized to %s", status.Service, status.Source), data))
+	}
+	m.unsynced = unsynced
+
+	// The offset must fall to half the threshold before it counts as
+	// recovered, so a clock hovering at the threshold does not flap
+	if status.OffsetKnown {
+		offset := math.Abs(status.OffsetMs)
+		limit := float64(m.config.MaxOffsetMs)
+		switch {
+		case offset > limit && !m.drifted:
+			m.drifted = true
+			log.Printf("Warning: clock offset %.1f ms from %s", status.OffsetMs, status.Source)
+			events = append(events, newHealthEvent(m.agentID, m.hostname, HealthEventClockOffset, 4,
+				fmt.Sprintf("Clock offset %.1f ms from %s exceeds %d ms", status.OffsetMs, status.Source, m.config.MaxOffsetMs), data))
+		case offset <= limit/2 && m.drifted:
+			m.drifted = false
+			events = append(events, newHealthEvent(m.agentID, m.hostname, HealthEventTimeSyncOK, 1,
+				fmt.Sprintf("Clock offset from %s back to %.1f ms", status.Source, status.OffsetMs), data))
+		}
+	}
+
+	return events
+}
+
+// Status returns the result of the last check, or nil before the first
+func (m *TimeSyncMonitor) Status() *TimeSyncStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.status
+}
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and
+// the Unix epoch
+const ntpEpochOffset = 2208988800
+
+// sntpOffset measures the local clock against an NTP server with a single
+// SNTP request: ((receive - originate) + (transmit - arrival)) / 2
+func sntpOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := make([]byte, 48)
+	request[0] = 0x23 // LI 0, version 4, mode 3 (client)
+	originate := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	arrival := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 || response[0]&0x07 != 4 || response[1] == 0 {
+		return 0, fmt.Errorf("invalid NTP response from %s", server)
+	}
+
+	receive := ntpTime(response[32:40])
+	transmit := ntpTime(response[40:48])
+	return (receive.Sub(originate) + transmit.Sub(arrival)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, fraction*1e9>>32)
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package collector
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// chronyc tracking: "System time     : 0.000012345 seconds fast of NTP time"
+	chronyOffsetPattern = regexp.MustCompile(`System time\s*:\s*([0-9.]+) seconds (fast|slow)`)
+
+	// chronyc tracking: "Reference ID    : C0A80001 (ntp.example.com)"
+	chronySourcePattern = regexp.MustCompile(`Reference ID\s*:\s*\S+ \(([^)]*)\)`)
+
+	// timedatectl timesync-status: "Offset: +1.234ms"
+	timesyncdOffsetPattern = regexp.MustCompile(`Offset:\s*([+-]?[0-9.]+)(us|ms|s)\b`)
+
+	// timedatectl timesync-status: "Server: 192.0.2.1 (ntp.example.com)"
+	timesyncdSourcePattern = regexp.MustCompile(`Server:\s*\S+ \(([^)]*)\)`)
+)
+
+// queryTimeSync reads the state of chronyd, or of systemd-timesyncd when
+// chrony is not installed. With a reference server the offset is measured
+// against it instead of taken from the service.
+func queryTimeSync(reference string) *TimeSyncStatus {
+	status := queryChrony()
+	if status == nil {
+		status = queryTimesyncd()
+	}
+	if status == nil {
+		status = &TimeSyncStatus{Service: "none", Error: "no chronyd or systemd-timesyncd"}
+	}
+
+	if reference != "" {
+		status.Source = reference
+		status.OffsetKnown = false
+		offset, err := sntpOffset(reference)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		status.OffsetMs = float64(offset.Microseconds()) / 1000
+		status.OffsetKnown = true
+		status.Error = ""
+	}
+	return status
+}
+
+// queryChrony parses chronyc tracking; nil when chrony is not installed
+func queryChrony() *TimeSyncStatus {
+	if _, err := exec.LookPath("chronyc"); err != nil {
+		return nil
+	}
+	status := &TimeSyncStatus{Service: "chronyd"}
+
+	output, err := exec.Command("chronyc", "tracking").Output()
+	if err != nil {
+		status.Error = "chronyd is not responding"
+		return status
+	}
+	text := string(output)
+	status.Running = true
+	status.Synced = !strings.Contains(text, "Not synchronised")
+
+	if match := chronySourcePattern.FindStringSubmatch(text); match != nil {
+		status.Source = match[1]
+	}
+	if match := chronyOffsetPattern.FindStringSubmatch(text); match != nil {
+		if seconds, err := strconv.ParseFloat(match[1], 64); err == nil {
+			// Fast means the local clock is ahead of the source
+			status.OffsetMs = seconds * 1000
+			if match[2] == "fast" {
+				status.OffsetMs = -status.OffsetMs
+			}
+			status.OffsetKnown = true
+		}
+	}
+	return status
+}
+
+// queryTimesyncd reads timedatectl; nil when systemd is not available
+func queryTimesyncd() *TimeSyncStatus {
+	output, err := exec.Command("timedatectl", "show", "-p", "NTP", "-p", "NTPSynchronized").Output()
+	if err != nil {
+		return nil
+	}
+	status := &TimeSyncStatus{Service: "systemd-timesyncd"}
+	properties := string(output)
+	status.Running = strings.Contains(properties, "NTP=yes")
+	status.Synced = strings.Contains(properties, "NTPSynchronized=yes")
+
+	output, err = exec.Command("timedatectl", "timesync-status").Output()
+	if err != nil {
+		return status
+	}
+	text := string(output)
+	if match := timesyncdSourcePattern.FindStringSubmatch(text); match != nil {
+		status.Source = match[1]
+	}
+	if match := timesyncdOffsetPattern.FindStringSubmatch(text); match != nil {
+		if value, err := strconv.ParseFloat(match[1], 64); err == nil {
+			switch match[2] {
+			case "us":
+				value /= 1000
+			case "s":
+				value *= 1000
+			}
+			status.OffsetMs = value
+			status.OffsetKnown = true
+		}
+	}
+	return status
+}
@@ -0,0 +1,44 @@
+//go:build !windows && !linux
+
+package collector
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// queryTimeSync checks that macOS network time is on and measures the
+// clock against the reference server, or against the configured server
+func queryTimeSync(reference string) *TimeSyncStatus {
+	status := &TimeSyncStatus{Service: "timed"}
+
+	// "Network Time: On"
+	if output, err := exec.Command("systemsetup", "-getusingnetworktime").Output(); err == nil {
+		status.Running = strings.Contains(string(output), "On")
+	}
+	// "Network Time Server: time.apple.com"
+	if output, err := exec.Command("systemsetup", "-getnetworktimeserver").Output(); err == nil {
+		_, server, _ := strings.Cut(string(output), ":")
+		status.Source = strings.TrimSpace(server)
+	}
+	status.Synced = status.Running && status.Source != ""
+
+	target := reference
+	if target == "" {
+		target = status.Source
+	}
+	if target == "" {
+		status.Error = "no time source to measure against"
+		return status
+	}
+	status.Source = target
+
+	offset, err := sntpOffset(target)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.OffsetMs = float64(offset.Microseconds()) / 1000
+	status.OffsetKnown = true
+	return status
+}
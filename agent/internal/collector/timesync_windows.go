@@ -0,0 +1,61 @@
+//go:build windows
+
+package collector
+
+import (
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// queryTimeSync reads the state of the Windows Time service and measures
+// the clock against the reference server, or against the service's own
+// source (a domain controller or the configured NTP server)
+func queryTimeSync(reference string) *TimeSyncStatus {
+	status := &TimeSyncStatus{Service: "W32Time"}
+
+	if m, err := mgr.Connect(); err == nil {
+		if s, err := m.OpenService("W32Time"); err == nil {
+			if state, err := s.Query(); err == nil {
+				status.Running = state.State == svc.Running
+			}
+			s.Close()
+		}
+		m.Disconnect()
+	}
+
+	if status.Running {
+		// e.g. "dc01.corp.local" or "time.windows.com,0x9"; a host
+		// without a source reports the local or free-running clock
+		if output, err := exec.Command("w32tm", "/query", "/source").Output(); err == nil {
+			source := strings.TrimSpace(string(output))
+			source, _, _ = strings.Cut(source, ",")
+			status.Source = strings.TrimSpace(source)
+			status.Synced = status.Source != "" &&
+				!strings.Contains(status.Source, "CMOS") && !strings.Contains(status.Source, "Free-running")
+		}
+	}
+
+	target := reference
+	if target == "" && status.Synced {
+		target = status.Source
+	}
+	if target == "" {
+		status.Error = "no time source to measure against"
+		return status
+	}
+	if reference != "" {
+		status.Source = reference
+	}
+
+	offset, err := sntpOffset(target)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.OffsetMs = float64(offset.Microseconds()) / 1000
+	status.OffsetKnown = true
+	return status
+}
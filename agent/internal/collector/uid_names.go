@@ -0,0 +1,33 @@
+//go:build linux || darwin
+
+package collector
+
+import (
+	"os/user"
+
+	"github.com/siem/agent/internal/cache"
+)
+
+// User names by uid, shared by the collectors. Failed lookups are cached
+// as the uid itself.
+var uidNameCache = cache.New[string, string]("uid_names", 4096, 0)
+
+// uidNames resolves numeric user IDs from log and audit records to
+// user names
+type uidNames struct{}
+
+// lookup returns the user name for uid, or uid itself when it has no
+// passwd entry
+func (uidNames) lookup(uid string) string {
+	if uid == "" {
+		return ""
+	}
+
+	name, _ := uidNameCache.GetOrLoad(uid, func(uid string) (string, error) {
+		if u, err := user.LookupId(uid); err == nil {
+			return u.Username, nil
+		}
+		return uid, nil
+	})
+	return name
+}
@@ -0,0 +1,269 @@
+//go:build darwin
+
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const UnifiedLogSourceType = "unified_log"
+
+const (
+	// log stream is restarted after this delay if it exits
+	unifiedLogRestartDelay = 10 * time.Second
+
+	// Largest log entry read; longer lines are skipped
+	unifiedLogMaxEntrySize = 1024 * 1024
+
+	// Timestamp format of log stream --style ndjson
+	unifiedLogTimeLayout = "2006-01-02 15:04:05.000000-0700"
+)
+
+// unifiedLogEntry is one line of log stream --style ndjson
+type unifiedLogEntry struct {
+	Timestamp          string `json:"timestamp"`
+	MessageType        string `json:"messageType"` // Default, Info, Debug, Error, Fault
+	EventType          string `json:"eventType"`   // logEvent, activityCreateEvent, ...
+	Subsystem          string `json:"subsystem"`
+	Category           string `json:"category"`
+	ProcessImagePath   string `json:"processImagePath"`
+	ProcessID          int    `json:"processID"`
+	SenderImagePath    string `json:"senderImagePath"`
+	UserID             *int   `json:"userID"`
+	EventMessage       string `json:"eventMessage"`
+	ActivityIdentifier uint64 `json:"activityIdentifier"`
+	ThreadID           uint64 `json:"threadID"`
+}
+
+// UnifiedLogCollector streams the macOS unified log
+type UnifiedLogCollector struct {
+	config     *config.UnifiedLogConfig
+	agentID    string
+	hostname   string
+	predicate  string
+	eventQueue *EventQueue
+	wg         sync.WaitGroup
+	stopChan   chan struct{}
+	userNames  uidNames
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+}
+
+// NewUnifiedLogCollector creates a new unified log collector
+func NewUnifiedLogCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*UnifiedLogCollector, error) {
+	if _, err := exec.LookPath("log"); err != nil {
+		return nil, fmt.Errorf("log command not found: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	predicates := make([]string, 0, len(cfg.UnifiedLog.Predicates))
+	for _, predicate := range cfg.UnifiedLog.Predicates {
+		predicates = append(predicates, "("+predicate+")")
+	}
+
+	return &UnifiedLogCollector{
+		config:     &cfg.UnifiedLog,
+		agentID:    agentID,
+		hostname:   hostname,
+		predicate:  strings.Join(predicates, " OR "),
+		eventQueue: eventQueue,
+		stopChan:   make(chan struct{}),
+	}, nil
+}
+
+// Start begins streaming the unified log
+func (c *UnifiedLogCollector) Start() error {
+	log.Printf("Starting unified log collector for %d predicates", len(c.config.Predicates))
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop stops the collector
+func (c *UnifiedLogCollector) Stop() {
+	close(c.stopChan)
+
+	c.mu.Lock()
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	log.Println("Unified log collector stopped")
+}
+
+// run keeps log stream running until the collector is stopped
+func (c *UnifiedLogCollector) run() {
+	defer c.wg.Done()
+
+	for {
+		if err := c.stream(); err != nil {
+			log.Printf("Error reading unified log: %v", err)
+		}
+
+		select {
+		case <-c.stopChan:
+			return
+		case <-time.After(unifiedLogRestartDelay):
+		}
+	}
+}
+
+// stream runs log stream and processes entries until it exits
+func (c *UnifiedLogCollector) stream() error {
+	args := []string{"stream", "--style", "ndjson", "--level", c.config.Level}
+	if c.predicate != "" {
+		args = append(args, "--predicate", c.predicate)
+	}
+
+	cmd := exec.Command("log", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start log stream: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+
+	// Stop may have run before cmd was set
+	select {
+	case <-c.stopChan:
+		cmd.Process.Kill()
+	default:
+	}
+
+	err = c.readEntries(stdout)
+	cmd.Wait()
+
+	c.mu.Lock()
+	c.cmd = nil
+	c.mu.Unlock()
+
+	return err
+}
+
+// readEntries processes log stream output, one JSON entry per line. The
+// first line ("Filtering the log data using ...") is not JSON.
+func (c *UnifiedLogCollector) readEntries(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), unifiedLogMaxEntrySize)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		var entry unifiedLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			log.Printf("Failed to parse unified log entry: %v", err)
+			continue
+		}
+
+		event := c.newEvent(&entry)
+
+		c.eventQueue.Push(event)
+	}
+
+	select {
+	case <-c.stopChan:
+		return nil
+	default:
+		return scanner.Err()
+	}
+}
+
+// newEvent converts a unified log entry into a normalized event
+func (c *UnifiedLogCollector) newEvent(entry *unifiedLogEntry) *Event {
+	eventTime, err := time.Parse(unifiedLogTimeLayout, entry.Timestamp)
+	if err != nil {
+		eventTime = time.Now()
+	}
+
+	channel := entry.Subsystem
+	if channel == "" {
+		channel = UnifiedLogSourceType
+	}
+
+	data := map[string]string{
+		"message_type": entry.MessageType,
+		"event_type":   entry.EventType,
+	}
+	if entry.Subsystem != "" {
+		data["subsystem"] = entry.Subsystem
+	}
+	if entry.Category != "" {
+		data["category"] = entry.Category
+	}
+	if entry.SenderImagePath != "" && entry.SenderImagePath != entry.ProcessImagePath {
+		data["sender"] = entry.SenderImagePath
+	}
+	if entry.ActivityIdentifier != 0 {
+		data["activity_id"] = strconv.FormatUint(entry.ActivityIdentifier, 10)
+	}
+	if entry.ThreadID != 0 {
+		data["thread_id"] = strconv.FormatUint(entry.ThreadID, 10)
+	}
+
+	event := &Event{
+		AgentID:      c.agentID,
+		Computer:     c.hostname,
+		SourceType:   UnifiedLogSourceType,
+		EventTime:    eventTime,
+		Channel:      channel,
+		Provider:     filepath.Base(entry.ProcessImagePath),
+		Severity:     severityFromUnifiedLogType(entry.MessageType),
+		Message:      entry.EventMessage,
+		ProcessID:    entry.ProcessID,
+		ProcessName:  filepath.Base(entry.ProcessImagePath),
+		ProcessPath:  entry.ProcessImagePath,
+		TaskCategory: entry.Category,
+		EventData:    data,
+		CollectedAt:  time.Now(),
+	}
+	if entry.UserID != nil {
+		event.SubjectUser = c.userNames.lookup(strconv.Itoa(*entry.UserID))
+	}
+
+	return event
+}
+
+// severityFromUnifiedLogType converts an OSLog message type to our 1-5
+// severity scale
+func severityFromUnifiedLogType(messageType string) int {
+	switch messageType {
+	case "Fault":
+		return 5
+	case "Error":
+		return 4
+	case "Default":
+		return 2
+	default: // Info, Debug
+		return 1
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !darwin
+
+package collector
+
+import (
+	"fmt"
+
+	"github.com/siem/agent/internal/config"
+)
+
+const UnifiedLogSourceType = "unified_log"
+
+// UnifiedLogCollector streams the macOS unified log (macOS only)
+type UnifiedLogCollector struct{}
+
+// NewUnifiedLogCollector fails outside macOS; there is no unified log
+func NewUnifiedLogCollector(cfg *config.Config, agentID string, eventQueue *EventQueue) (*UnifiedLogCollector, error) {
+	return nil, fmt.Errorf("unified log collection is only supported on macOS")
+}
+
+// Start does nothing
+func (c *UnifiedLogCollector) Start() error { return nil }
+
+// Stop does nothing
+func (c *UnifiedLogCollector) Stop() {}
@@ -0,0 +1,222 @@
+//go:build windows
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/google/uuid"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// promptDonePrefix marks the final status; the dialog then stops accepting comments
+	promptDonePrefix = "DONE:"
+
+	// promptCleanupDelay keeps the final status readable before the files are removed
+	promptCleanupDelay = 30 * time.Second
+)
+
+// PromptDialog is an install request dialog running in the user's session.
+// The agent and the dialog exchange the status and the user's comment
+// through files in a directory only SYSTEM, administrators and the user can access.
+type PromptDialog struct {
+	dir         string
+	commentRead bool
+}
+
+// ShowUserPrompt opens the install request dialog for the given user
+func ShowUserPrompt(prompt *UserPrompt, userName string) (*PromptDialog, error) {
+	sessionID := FindUserSession(userName)
+	if sessionID == noSession {
+		return nil, fmt.Errorf("no interactive user session")
+	}
+
+	name := prompt.RequestID
+	if name == "" {
+		name = uuid.NewString()
+	}
+
+	dialog := &PromptDialog{
+		dir: filepath.Join(os.Getenv("ProgramData"), "SIEM", "prompts", name),
+	}
+	if err := createPromptDir(dialog.dir, userName); err != nil {
+		return nil, err
+	}
+
+	dialog.SetStatus("Ожидание решения администратора...")
+
+	psScript := fmt.Sprintf(`
+Add-Type -AssemblyName System.Windows.Forms
+Add-Type -AssemblyName System.Drawing
+$statusPath = %s
+$commentPath = %s
+
+$form = New-Object System.Windows.Forms.Form
+$form.Text = %s
+$form.Size = New-Object System.Drawing.Size(470, 340)
+$form.StartPosition = "CenterScreen"
+$form.FormBorderStyle = "FixedDialog"
+$form.MaximizeBox = $false
+$form.TopMost = $true
+
+$message = New-Object System.Windows.Forms.Label
+$message.Location = New-Object System.Drawing.Point(12, 12)
+$message.Size = New-Object System.Drawing.Size(430, 60)
+$message.Text = %s
+$form.Controls.Add($message)
+
+$commentLabel = New-Object System.Windows.Forms.Label
+$commentLabel.Location = New-Object System.Drawing.Point(12, 78)
+$commentLabel.Size = New-Object System.Drawing.Size(430, 20)
+$commentLabel.Text = "Обоснование для администратора:"
+$form.Controls.Add($commentLabel)
+
+$comment = New-Object System.Windows.Forms.TextBox
+$comment.Location = New-Object System.Drawing.Point(12, 100)
+$comment.Size = New-Object System.Drawing.Size(430, 90)
+$comment.Multiline = $true
+$comment.MaxLength = 1000
+$form.Controls.Add($comment)
+
+$send = New-Object System.Windows.Forms.Button
+$send.Location = New-Object System.Drawing.Point(12, 200)
+$send.Size = New-Object System.Drawing.Size(200, 28)
+$send.Text = "Отправить комментарий"
+$send.Add_Click({
+    if ($comment.Text.Trim() -ne "") {
+        [System.IO.File]::WriteAllText($commentPath, $comment.Text, [System.Text.Encoding]::UTF8)
+        $send.Enabled = $false
+        $comment.ReadOnly = $true
+    }
+})
+$form.Controls.Add($send)
+
+$close = New-Object System.Windows.Forms.Button
+$close.Location = New-Object System.Drawing.Point(342, 200)
+$close.Size = New-Object System.Drawing.Size(100, 28)
+$close.Text = "Закрыть"
+$close.Add_Click({ $form.Close() })
+$form.Controls.Add($close)
+
+$status = New-Object System.Windows.Forms.Label
+$status.Location = New-Object System.Drawing.Point(12, 240)
+$status.Size = New-Object System.Drawing.Size(430, 50)
+$form.Controls.Add($status)
+
+$update = {
+    if (Test-Path $statusPath) {
+        $text = [System.IO.File]::ReadAllText($statusPath, [System.Text.Encoding]::UTF8)
+        if ($text.StartsWith(%s)) {
+            $text = $text.Substring(%d)
+            $send.Enabled = $false
+            $comment.ReadOnly = $true
+        }
+        $status.Text = $text
+    }
+}
+& $update
+
+$timer = New-Object System.Windows.Forms.Timer
+$timer.Interval = 2000
+$timer.Add_Tick($update)
+$timer.Start()
+
+[void]$form.ShowDialog()
+`, psQuote(dialog.statusPath()), psQuote(dialog.commentPath()), psQuote(prompt.Title), psQuote(prompt.Message),
+		psQuote(promptDonePrefix), len(promptDonePrefix))
+
+	if _, err := RunInSession(sessionID, psScript, 0); err != nil {
+		os.RemoveAll(dialog.dir)
+		return nil, err
+	}
+
+	return dialog, nil
+}
+
+// SetStatus updates the status line shown in the dialog
+func (d *PromptDialog) SetStatus(status string) error {
+	return os.WriteFile(d.statusPath(), []byte(status), 0600)
+}
+
+// Comment returns the user's comment once it has been submitted
+func (d *PromptDialog) Comment() (string, bool) {
+	if d.commentRead {
+		return "", false
+	}
+
+	data, err := os.ReadFile(d.commentPath())
+	if err != nil {
+		return "", false
+	}
+	d.commentRead = true
+
+	// Strip the UTF-8 BOM written by .NET
+	comment := strings.TrimPrefix(string(data), "\ufeff")
+	return strings.TrimSpace(comment), true
+}
+
+// Close shows the final status and removes the exchange files shortly after
+func (d *PromptDialog) Close(finalStatus string) {
+	d.SetStatus(promptDonePrefix + finalStatus)
+
+	dir := d.dir
+	time.AfterFunc(promptCleanupDelay, func() {
+		os.RemoveAll(dir)
+	})
+}
+
+func (d *PromptDialog) statusPath() string {
+	return filepath.Join(d.dir, "status.txt")
+}
+
+func (d *PromptDialog) commentPath() string {
+	return filepath.Join(d.dir, "comment.txt")
+}
+
+// createPromptDir creates a directory writable only by SYSTEM, administrators and the user
+func createPromptDir(dir, userName string) error {
+	sid, _, _, err := windows.LookupSID("", userName)
+	if err != nil {
+		return fmt.Errorf("failed to look up user %s: %w", userName, err)
+	}
+
+	return createDirWithACL(dir, fmt.Sprintf("D:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)(A;OICI;FA;;;%s)", sid.String()))
+}
+
+// createAgentDir creates a directory only SYSTEM and administrators can access
+func createAgentDir(dir string) error {
+	return createDirWithACL(dir, "D:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)")
+}
+
+// createDirWithACL creates a directory with the given SDDL security descriptor
+func createDirWithACL(dir, sddl string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return fmt.Errorf("failed to build directory ACL: %w", err)
+	}
+
+	dirPtr, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return err
+	}
+
+	sa := &windows.SecurityAttributes{
+		Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+		SecurityDescriptor: sd,
+	}
+	if err := windows.CreateDirectory(dirPtr, sa); err != nil && err != windows.ERROR_ALREADY_EXISTS {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	return nil
+}
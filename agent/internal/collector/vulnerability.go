@@ -0,0 +1,472 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/config"
+)
+
+// VulnerabilityFeed is the advisory subset the server distributes to an
+// agent: NVD and OVAL entries reduced to product names as the agent's
+// inventory reports them, affected version ranges and fixing patches
+type VulnerabilityFeed struct {
+	Version    string                  `json:"version"`
+	Advisories []VulnerabilityAdvisory `json:"advisories"`
+}
+
+// VulnerabilityAdvisory is one vulnerability of one product. An advisory
+// without a product applies to every host of its platform and is matched
+// by its patches alone (OS cumulative updates).
+type VulnerabilityAdvisory struct {
+	ID       string         `json:"id"` // CVE or vendor advisory ID
+	Title    string         `json:"title,omitempty"`
+	Severity string         `json:"severity"` // "low", "medium", "high" or "critical"
+	CVSS     float64        `json:"cvss,omitempty"`
+	Platform string         `json:"platform,omitempty"` // "windows", "linux" or "darwin" (empty = any)
+	Product  string         `json:"product,omitempty"`  // inventory item name, case-insensitive; a trailing * matches a prefix
+	Vendor   string         `json:"vendor,omitempty"`   // substring of the item's vendor (empty = any)
+	Ranges   []VersionRange `json:"ranges,omitempty"`   // affected versions (empty = all)
+	Patches  []string       `json:"patches,omitempty"`  // hotfixes that fix it, preferred first (KB5034441)
+}
+
+// VersionRange is a range of affected versions. Either bound may be empty.
+type VersionRange struct {
+	Introduced   string `json:"introduced,omitempty"`    // first affected version
+	Fixed        string `json:"fixed,omitempty"`         // first fixed version (exclusive)
+	LastAffected string `json:"last_affected,omitempty"` // last affected version (inclusive)
+}
+
+// Vulnerability is an advisory reported on an inventory item
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title,omitempty"`
+	Severity string   `json:"severity"`
+	CVSS     float64  `json:"cvss,omitempty"`
+	FixedIn  string   `json:"fixed_in,omitempty"`
+	Patches  []string `json:"patches,omitempty"`
+}
+
+// VulnerabilityStats reports vulnerability matching in heartbeats
+type VulnerabilityStats struct {
+	Version         string    `json:"version"`
+	Advisories      int       `json:"advisories"`
+	VulnerableItems int       `json:"vulnerable_items"` // at the last inventory scan
+	MissingPatches  int       `json:"missing_patches"`
+	LastSync        time.Time `json:"last_sync"`
+	LastMatch       time.Time `json:"last_match"`
+}
+
+// vulnerabilitySeverities orders advisory severities
+var vulnerabilitySeverities = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+// VulnerabilityMatcher matches the software, OS and hotfix inventory
+// against the server's advisory feed, so known-vulnerable software and
+// missing patches are reported with the inventory the agent already
+// sends. The last feed is kept on disk for scans while the server is
+// unreachable.
+type VulnerabilityMatcher struct {
+	config *config.VulnerabilityConfig
+	fetch  func() (*VulnerabilityFeed, error)
+
+	mutex      sync.RWMutex
+	feed       *VulnerabilityFeed
+	lastSync   time.Time
+	lastMatch  time.Time
+	vulnerable int
+	missing    int
+}
+
+// NewVulnerabilityMatcher creates the matcher with the feed kept from the
+// last sync
+func NewVulnerabilityMatcher(cfg *config.VulnerabilityConfig) *VulnerabilityMatcher {
+	m := &VulnerabilityMatcher{config: cfg, feed: &VulnerabilityFeed{}}
+
+	if data, err := os.ReadFile(cfg.FeedFile); err == nil {
+		var feed VulnerabilityFeed
+		if err := json.Unmarshal(data, &feed); err != nil {
+			log.Printf("Warning: Failed to read stored vulnerability feed: %v", err)
+		} else {
+			m.Load(&feed)
+		}
+	}
+
+	return m
+}
+
+// SetFeedSource sets the callback that downloads the feed for this agent
+func (m *VulnerabilityMatcher) SetFeedSource(fetch func() (*VulnerabilityFeed, error)) {
+	m.fetch = fetch
+}
+
+// StartFeedSync downloads the feed immediately and then periodically
+func (m *VulnerabilityMatcher) StartFeedSync(ctx context.Context) {
+	if m.fetch == nil {
+		return
+	}
+
+	interval := time.Duration(m.config.SyncInterval) * time.Second
+	if interval < time.Minute {
+		interval = 6 * time.Hour
+	}
+
+	if err := m.SyncFeed(); err != nil {
+		log.Printf("Error syncing vulnerability feed: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.SyncFeed(); err != nil {
+				log.Printf("Error syncing vulnerability feed: %v", err)
+			}
+		}
+	}
+}
+
+// SyncFeed downloads, loads and stores the feed
+func (m *VulnerabilityMatcher) SyncFeed() error {
+	feed, err := m.fetch()
+	if err != nil {
+		return fmt.Errorf("failed to fetch vulnerability feed: %w", err)
+	}
+
+	m.Load(feed)
+
+	m.mutex.Lock()
+	m.lastSync = time.Now()
+	m.mutex.Unlock()
+
+	data, err := json.Marshal(feed)
+	if err != nil {
+		return fmt.Errorf("failed to encode vulnerability feed: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.FeedFile), 0700); err != nil {
+		return fmt.Errorf("failed to store vulnerability feed: %w", err)
+	}
+	if err := os.WriteFile(m.config.FeedFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to store vulnerability feed: %w", err)
+	}
+	return nil
+}
+
+// Load replaces the feed. Advisories for other platforms are dropped.
+func (m *VulnerabilityMatcher) Load(feed *VulnerabilityFeed) {
+	loaded := &VulnerabilityFeed{Version: feed.Version}
+	for _, advisory := range feed.Advisories {
+		if advisory.Platform != "" && advisory.Platform != runtime.GOOS {
+			continue
+		}
+		if advisory.Product == "" && len(advisory.Patches) == 0 {
+			log.Printf("Warning: Vulnerability advisory %s has neither product nor patches", advisory.ID)
+			continue
+		}
+		loaded.Advisories = append(loaded.Advisories, advisory)
+	}
+
+	m.mutex.Lock()
+	m.feed = loaded
+	m.mutex.Unlock()
+
+	log.Printf("Loaded vulnerability feed version %s (%d advisories)", feed.Version, len(loaded.Advisories))
+}
+
+// Match reports the advisories that apply to the inventory: affected
+// software and OS items get them in Vulnerabilities, and a "missing_patch"
+// item is returned for every hotfix that would fix one. An advisory whose
+// patch is installed does not apply. Patches are only reported when the
+// inventory lists installed hotfixes.
+func (m *VulnerabilityMatcher) Match(items []*InventoryItem) []*InventoryItem {
+	m.mutex.RLock()
+	feed := m.feed
+	m.mutex.RUnlock()
+
+	installed := make(map[string]bool)
+	var template *InventoryItem
+	for _, item := range items {
+		if item.Type == "hotfix" {
+			installed[strings.ToUpper(item.Name)] = true
+		}
+		if template == nil {
+			template = item
+		}
+	}
+
+	// Without a hotfix inventory (not Windows, or the query failed) it is
+	// unknown which patches are missing
+	missing := make(map[string]*InventoryItem)
+	var missingOrder []string
+	report := func(advisory *VulnerabilityAdvisory) {
+		if len(installed) == 0 {
+			return
+		}
+		kb := strings.ToUpper(advisory.Patches[0])
+		item, ok := missing[kb]
+		if !ok {
+			item = &InventoryItem{Type: "missing_patch", Name: kb, Status: "missing", CollectedAt: time.Now()}
+			if template != nil {
+				item.AgentID, item.Computer = template.AgentID, template.Computer
+			}
+			missing[kb] = item
+			missingOrder = append(missingOrder, kb)
+		}
+		addVulnerability(item, advisory, "")
+	}
+
+	vulnerable := 0
+	for i := range feed.Advisories {
+		advisory := &feed.Advisories[i]
+		if patched(advisory, installed) {
+			continue
+		}
+
+		if advisory.Product == "" {
+			report(advisory)
+			continue
+		}
+
+		found := false
+		for _, item := range items {
+			if item.Type != "software" && item.Type != "os" {
+				continue
+			}
+			if !advisory.matchesProduct(item) {
+				continue
+			}
+			if affected, fixedIn := advisory.affects(item.Version); affected {
+				if len(item.Vulnerabilities) == 0 {
+					vulnerable++
+				}
+				addVulnerability(item, advisory, fixedIn)
+				found = true
+			}
+		}
+		if found && len(advisory.Patches) > 0 {
+			report(advisory)
+		}
+	}
+
+	patches := make([]*InventoryItem, 0, len(missingOrder))
+	for _, kb := range missingOrder {
+		item := missing[kb]
+		sortVulnerabilities(item.Vulnerabilities)
+		item.Description = item.Vulnerabilities[0].Title
+		patches = append(patches, item)
+	}
+
+	m.mutex.Lock()
+	m.vulnerable = vulnerable
+	m.missing = len(patches)
+	m.lastMatch = time.Now()
+	m.mutex.Unlock()
+
+	if vulnerable > 0 || len(patches) > 0 {
+		log.Printf("Vulnerability scan: %d vulnerable items, %d missing patches", vulnerable, len(patches))
+	}
+	return patches
+}
+
+// Stats returns vulnerability matching statistics
+func (m *VulnerabilityMatcher) Stats() *VulnerabilityStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return &VulnerabilityStats{
+		Version:         m.feed.Version,
+		Advisories:      len(m.feed.Advisories),
+		VulnerableItems: m.vulnerable,
+		MissingPatches:  m.missing,
+		LastSync:        m.lastSync,
+		LastMatch:       m.lastMatch,
+	}
+}
+
+// patched reports whether one of the advisory's patches is installed
+func patched(advisory *VulnerabilityAdvisory, installed map[string]bool) bool {
+	for _, patch := range advisory.Patches {
+		if installed[strings.ToUpper(patch)] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesProduct reports whether the advisory is about the item
+func (a *VulnerabilityAdvisory) matchesProduct(item *InventoryItem) bool {
+	name := strings.ToLower(item.Name)
+	product := strings.ToLower(a.Product)
+	if prefix, ok := strings.CutSuffix(product, "*"); ok {
+		if !strings.HasPrefix(name, prefix) {
+			return false
+		}
+	} else if name != product {
+		return false
+	}
+	return a.Vendor == "" || strings.Contains(strings.ToLower(item.Vendor), strings.ToLower(a.Vendor))
+}
+
+// affects reports whether a version is in one of the affected ranges, and
+// the version that fixes it. Without ranges every version is affected; an
+// item without a version cannot be placed in a range.
+func (a *VulnerabilityAdvisory) affects(version string) (bool, string) {
+	if len(a.Ranges) == 0 {
+		return true, ""
+	}
+	if version == "" {
+		return false, ""
+	}
+	for _, r := range a.Ranges {
+		if r.Introduced != "" && comparePackageVersions(version, r.Introduced) < 0 {
+			continue
+		}
+		if r.Fixed != "" && comparePackageVersions(version, r.Fixed) >= 0 {
+			continue
+		}
+		if r.LastAffected != "" && comparePackageVersions(version, r.LastAffected) > 0 {
+			continue
+		}
+		return true, r.Fixed
+	}
+	return false, ""
+}
+
+// addVulnerability reports an advisory on an item once
+func addVulnerability(item *InventoryItem, advisory *VulnerabilityAdvisory, fixedIn string) {
+	for _, v := range item.Vulnerabilities {
+		if v.ID == advisory.ID {
+			return
+		}
+	}
+	item.Vulnerabilities = append(item.Vulnerabilities, Vulnerability{
+		ID:       advisory.ID,
+		Title:    advisory.Title,
+		Severity: strings.ToLower(advisory.Severity),
+		CVSS:     advisory.CVSS,
+		FixedIn:  fixedIn,
+		Patches:  advisory.Patches,
+	})
+}
+
+// sortVulnerabilities puts the most severe first
+func sortVulnerabilities(vulnerabilities []Vulnerability) {
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		si, sj := vulnerabilitySeverities[vulnerabilities[i].Severity], vulnerabilitySeverities[vulnerabilities[j].Severity]
+		if si != sj {
+			return si > sj
+		}
+		return vulnerabilities[i].CVSS > vulnerabilities[j].CVSS
+	})
+}
+
+// comparePackageVersions compares package versions the way rpm and dpkg
+// broadly do, returning -1, 0 or 1: an "epoch:" prefix first, then runs of
+// digits numerically and runs of letters alphabetically, separators
+// ignored. A digit run is newer than a letter run, and a tilde sorts
+// before anything, even the end (1.0~rc1 < 1.0).
+func comparePackageVersions(a, b string) int {
+	epochA, a := versionEpoch(a)
+	epochB, b := versionEpoch(b)
+	if epochA != epochB {
+		if epochA < epochB {
+			return -1
+		}
+		return 1
+	}
+
+	separator := func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '~')
+	}
+	for {
+		a = strings.TrimLeftFunc(a, separator)
+		b = strings.TrimLeftFunc(b, separator)
+
+		tildeA, tildeB := strings.HasPrefix(a, "~"), strings.HasPrefix(b, "~")
+		if tildeA || tildeB {
+			if !tildeA {
+				return 1
+			}
+			if !tildeB {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			switch {
+			case a == b:
+				return 0
+			case a == "":
+				return -1
+			default:
+				return 1
+			}
+		}
+
+		numeric := a[0] >= '0' && a[0] <= '9'
+		segmentA, restA := versionSegment(a, numeric)
+		segmentB, restB := versionSegment(b, numeric)
+		if segmentB == "" {
+			// Different kinds: digits are newer
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			segmentA = strings.TrimLeft(segmentA, "0")
+			segmentB = strings.TrimLeft(segmentB, "0")
+			if len(segmentA) != len(segmentB) {
+				if len(segmentA) < len(segmentB) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(segmentA, segmentB); c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+}
+
+// versionEpoch splits a dpkg/rpm "epoch:version"; no epoch is 0
+func versionEpoch(version string) (int, string) {
+	if prefix, rest, found := strings.Cut(version, ":"); found {
+		if epoch, err := strconv.Atoi(prefix); err == nil {
+			return epoch, rest
+		}
+	}
+	return 0, version
+}
+
+// versionSegment splits off the leading run of digits or of letters
+func versionSegment(version string, numeric bool) (string, string) {
+	end := 0
+	for end < len(version) {
+		c := version[end]
+		isDigit := c >= '0' && c <= '9'
+		isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if numeric && !isDigit || !numeric && !isLetter {
+			break
+		}
+		end++
+	}
+	return version[:end], version[end:]
+}
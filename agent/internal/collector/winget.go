@@ -0,0 +1,208 @@
+//go:build windows
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// wingetInstallTimeout bounds a single winget install
+const wingetInstallTimeout = 30 * time.Minute
+
+// findWinget locates winget.exe. The App Installer alias in WindowsApps is
+// per-user and not available to SYSTEM, so the package directory is used.
+func findWinget() (string, error) {
+	pattern := filepath.Join(os.Getenv("ProgramFiles"), "WindowsApps", "Microsoft.DesktopAppInstaller_*_x64__8wekyb3d8bbwe", "winget.exe")
+	matches, _ := filepath.Glob(pattern)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("winget is not installed")
+	}
+
+	// Newest App Installer version last
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// runWinget runs winget with the given arguments and returns its output
+func runWinget(ctx context.Context, args ...string) (string, error) {
+	winget, err := findWinget()
+	if err != nil {
+		return "", err
+	}
+
+	args = append(args, "--accept-source-agreements", "--disable-interactivity")
+	cmd := exec.CommandContext(ctx, winget, args...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// resolveWingetPackage returns the winget package ID for an approved request,
+// or "" if the software is not available in winget
+func (c *SoftwareControlCollector) resolveWingetPackage(request *SoftwareInstallRequest) string {
+	ctx, cancel := context.WithTimeout(c.ctx, 2*time.Minute)
+	defer cancel()
+
+	// Package chosen by the admin when approving
+	if request.WingetID != "" {
+		args := []string{"show", "--id", request.WingetID, "--exact"}
+		if version := request.approvedVersion(); version != "" {
+			args = append(args, "--version", version)
+		}
+		if _, err := runWinget(ctx, args...); err != nil {
+			log.Printf("winget package %s not available: %v", request.WingetID, err)
+			return ""
+		}
+		return request.WingetID
+	}
+
+	output, err := runWinget(ctx, "search", "--name", request.SoftwareName, "--exact")
+	if err != nil {
+		return ""
+	}
+
+	for _, row := range parseWingetTable(output) {
+		if strings.EqualFold(row["Name"], request.SoftwareName) && row["Id"] != "" {
+			return row["Id"]
+		}
+	}
+	return ""
+}
+
+// installWithWinget installs the approved package and version itself and
+// verifies the result, instead of resuming the user's installer
+func (c *SoftwareControlCollector) installWithWinget(request *SoftwareInstallRequest) {
+	version := request.approvedVersion()
+	log.Printf("Installing %s via winget (package %s, version %s)", request.SoftwareName, request.WingetID, version)
+
+	c.notifyUser(request, "Установка ПО",
+		fmt.Sprintf("Установка %s одобрена и выполняется автоматически. Запускать установщик не нужно.", request.SoftwareName))
+
+	ctx, cancel := context.WithTimeout(c.ctx, wingetInstallTimeout)
+	defer cancel()
+
+	args := []string{"install", "--id", request.WingetID, "--exact", "--silent", "--scope", "machine", "--accept-package-agreements"}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+
+	output, err := runWinget(ctx, args...)
+	if err == nil && !wingetPackageInstalled(ctx, request.WingetID, version) {
+		err = fmt.Errorf("package not found after install")
+	}
+
+	if err != nil {
+		log.Printf("winget install of %s failed: %v: %s", request.WingetID, err, truncateOutput(output, 2000))
+		request.Status = "failed"
+		request.DecisionReason = fmt.Sprintf("winget install of %s failed: %v", request.WingetID, err)
+		c.notifyUser(request, "Установка ПО не удалась",
+			fmt.Sprintf("Не удалось установить %s. Обратитесь в службу поддержки.", request.SoftwareName))
+	} else {
+		log.Printf("✓ Installed %s via winget", request.WingetID)
+		request.Status = "installed"
+		c.notifyUser(request, "Установка ПО завершена",
+			fmt.Sprintf("%s установлен.", request.SoftwareName))
+	}
+
+	if c.onInstallRequest != nil {
+		if err := c.onInstallRequest(request); err != nil {
+			log.Printf("Error reporting winget install result to SIEM: %v", err)
+		}
+	}
+}
+
+// wingetPackageInstalled verifies that a package, and optionally a version, is installed
+func wingetPackageInstalled(ctx context.Context, id, version string) bool {
+	output, err := runWinget(ctx, "list", "--id", id, "--exact")
+	if err != nil {
+		return false
+	}
+
+	for _, row := range parseWingetTable(output) {
+		if !strings.EqualFold(row["Id"], id) {
+			continue
+		}
+		return version == "" || row["Version"] == version
+	}
+	return false
+}
+
+// parseWingetTable parses winget's column-aligned table output into rows keyed by header
+func parseWingetTable(output string) []map[string]string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		// Progress spinners are redrawn with carriage returns; keep the final text
+		line = strings.TrimRight(line, "\r")
+		if idx := strings.LastIndex(line, "\r"); idx != -1 {
+			line = line[idx+1:]
+		}
+		lines[i] = line
+	}
+
+	// The header is the line above the dashed separator; progress output may precede it
+	headerIdx := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "---") {
+			headerIdx = i - 1
+			break
+		}
+	}
+	if headerIdx < 0 {
+		return nil
+	}
+
+	header := []rune(lines[headerIdx])
+	type column struct {
+		name  string
+		start int
+	}
+	var columns []column
+	for i := 0; i < len(header); i++ {
+		if header[i] != ' ' && (i == 0 || header[i-1] == ' ') {
+			end := i
+			for end < len(header) && header[end] != ' ' {
+				end++
+			}
+			columns = append(columns, column{name: string(header[i:end]), start: i})
+		}
+	}
+
+	var rows []map[string]string
+	for _, line := range lines[headerIdx+2:] {
+		runes := []rune(line)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		row := make(map[string]string, len(columns))
+		for i, col := range columns {
+			if col.start >= len(runes) {
+				break
+			}
+			end := len(runes)
+			if i+1 < len(columns) && columns[i+1].start < end {
+				end = columns[i+1].start
+			}
+			row[col.name] = strings.TrimSpace(string(runes[col.start:end]))
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// approvedVersion returns the version the admin approved, falling back to
+// the version of the installer the user ran
+func (r *SoftwareInstallRequest) approvedVersion() string {
+	if r.ApprovedVersion != "" {
+		return r.ApprovedVersion
+	}
+	return r.SoftwareVersion
+}
@@ -1,40 +1,186 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"runtime"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/siem/agent/internal/secrets"
 )
 
 // Config represents the agent configuration
 type Config struct {
-	SIEM            SIEMConfig            `yaml:"siem"`
-	EventLog        EventLogConfig        `yaml:"eventlog"`
-	Sysmon          SysmonConfig          `yaml:"sysmon"`
-	Inventory       InventoryConfig       `yaml:"inventory"`
-	SoftwareControl SoftwareControlConfig `yaml:"software_control"`
-	Protection      ProtectionConfig      `yaml:"protection"`
-	Performance     PerformanceConfig     `yaml:"performance"`
-	Logging         LoggingConfig         `yaml:"logging"`
-	Agent           AgentConfig           `yaml:"agent"`
-	Advanced        AdvancedConfig        `yaml:"advanced"`
+	SIEM             SIEMConfig             `yaml:"siem"`
+	Queue            QueueConfig            `yaml:"queue"`
+	SyslogOutput     SyslogOutputConfig     `yaml:"syslog_output"`
+	EventLog         EventLogConfig         `yaml:"eventlog"`
+	Sysmon           SysmonConfig           `yaml:"sysmon"`
+	Journald         JournaldConfig         `yaml:"journald"`
+	Auditd           AuditdConfig           `yaml:"auditd"`
+	UnifiedLog       UnifiedLogConfig       `yaml:"unified_log"`
+	EndpointSecurity EndpointSecurityConfig `yaml:"endpoint_security"`
+	Connections      ConnectionsConfig      `yaml:"connections"`
+	Identity         IdentityConfig         `yaml:"identity"`
+	SNMPTrap         SNMPTrapConfig         `yaml:"snmp_trap"`
+	SyslogInput      SyslogInputConfig      `yaml:"syslog_input"`
+	Container        ContainerConfig        `yaml:"container"`
+	Detection        DetectionConfig        `yaml:"detection"`
+	ThreatIntel      ThreatIntelConfig      `yaml:"threat_intel"`
+	Correlation      CorrelationConfig      `yaml:"correlation"`
+	Deception        DeceptionConfig        `yaml:"deception"`
+	TimeSync         TimeSyncConfig         `yaml:"time_sync"`
+	Inventory        InventoryConfig        `yaml:"inventory"`
+	Vulnerabilities  VulnerabilityConfig    `yaml:"vulnerabilities"`
+	SoftwareControl  SoftwareControlConfig  `yaml:"software_control"`
+	RemoteSession    RemoteSessionConfig    `yaml:"remote_session"`
+	ScriptExecution  ScriptExecutionConfig  `yaml:"script_execution"`
+	AppStore         AppStoreConfig         `yaml:"app_store"`
+	Protection       ProtectionConfig       `yaml:"protection"`
+	Watchdog         WatchdogConfig         `yaml:"watchdog"`
+	Performance      PerformanceConfig      `yaml:"performance"`
+	Logging          LoggingConfig          `yaml:"logging"`
+	Agent            AgentConfig            `yaml:"agent"`
+	Advanced         AdvancedConfig         `yaml:"advanced"`
 }
 
 type SIEMConfig struct {
-	APIURL             string `yaml:"api_url"`
-	RegisterOnStartup  bool   `yaml:"register_on_startup"`
-	HeartbeatInterval  int    `yaml:"heartbeat_interval"`
-	BatchSize          int    `yaml:"batch_size"`
-	SendInterval       int    `yaml:"send_interval"`
-	MaxQueueSize       int    `yaml:"max_queue_size"`
+	APIURL               string `yaml:"api_url"`
+	APIKey               string `yaml:"api_key"`          // On macOS and Windows, empty = read from the secret store
+	EnrollmentToken      string `yaml:"enrollment_token"` // One-time token exchanged for a per-agent credential
+	CredentialType       string `yaml:"credential_type"`  // "certificate" (mutual TLS) or "jwt"
+	CredentialFile       string `yaml:"credential_file"`  // Where the credential is kept without a secret store
+	RegisterOnStartup    bool   `yaml:"register_on_startup"`
+	HeartbeatInterval    int    `yaml:"heartbeat_interval"`
+	BatchSize            int    `yaml:"batch_size"`
+	SendInterval         int    `yaml:"send_interval"`     // Initial interval between sends (seconds)
+	SendIntervalMin      int    `yaml:"send_interval_min"` // The interval adapts to the event rate within these bounds
+	SendIntervalMax      int    `yaml:"send_interval_max"`
+	MaxQueueSize         int    `yaml:"max_queue_size"`
+	DropWarningThreshold int    `yaml:"drop_warning_threshold"`  // Dropped events per heartbeat that raise a health event
+	MaxRequestBytes      int    `yaml:"max_request_bytes"`       // Event batches are split to stay under this size (before compression)
+	DropRawXMLOverLimit  bool   `yaml:"drop_raw_xml_over_limit"` // Drop RawXML from a batch over the limit before splitting it
+	EventFormat          string `yaml:"event_format"`            // "native" or "ecs" (Elastic Common Schema)
+	SendTimeout          int    `yaml:"send_timeout"`            // Timeout of one API request (seconds)
+	InsecureSkipVerify   bool   `yaml:"insecure_skip_verify"`    // Accept any server certificate (test servers only)
+}
+
+// QueueConfig bounds the in-memory send queue (siem.max_queue_size caps
+// the event count) and the disk spool that takes the overflow
+type QueueConfig struct {
+	MemoryLimitMB int                 `yaml:"memory_limit_mb"` // Event memory before spilling to disk
+	SpoolDir      string              `yaml:"spool_dir"`
+	SpoolFileMB   int                 `yaml:"spool_file_mb"` // Size of each spool file
+	SpoolMaxMB    int                 `yaml:"spool_max_mb"`  // Total spool size; events beyond it are dropped
+	Projection    []ProjectionProfile `yaml:"projection"`    // First match wins
+}
+
+// ProjectionProfile trims the fields of matching events before they are
+// queued. Fields are named as in the event JSON; a profile without keep or
+// drop sends matching events whole.
+type ProjectionProfile struct {
+	Name       string   `yaml:"name"`
+	SourceType string   `yaml:"source_type"` // empty = any
+	Channels   []string `yaml:"channels"`    // empty = any
+	EventIDs   []int    `yaml:"event_ids"`   // empty = any
+	Keep       []string `yaml:"keep"`        // send only these fields
+	Drop       []string `yaml:"drop"`        // remove these fields
+}
+
+// SetDefaults fills in unset queue options
+func (c *QueueConfig) SetDefaults() {
+	if c.MemoryLimitMB <= 0 {
+		c.MemoryLimitMB = 64
+	}
+	if c.SpoolDir == "" {
+		c.SpoolDir = filepath.Join(os.Getenv("ProgramData"), "SIEM", "spool")
+		if runtime.GOOS != "windows" {
+			c.SpoolDir = "/var/lib/siem-agent/spool"
+		}
+	}
+	if c.SpoolFileMB <= 0 {
+		c.SpoolFileMB = 16
+	}
+	if c.SpoolMaxMB <= 0 {
+		c.SpoolMaxMB = 1024
+	}
+}
+
+// SyslogOutputConfig configures forwarding events as CEF or LEEF over
+// syslog, in addition to sending them to the SIEM server
+type SyslogOutputConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	Address            string `yaml:"address"`              // host:port of the receiver
+	Protocol           string `yaml:"protocol"`             // "udp", "tcp" or "tls"
+	Format             string `yaml:"format"`               // "cef" or "leef"
+	Facility           int    `yaml:"facility"`             // syslog facility number
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // TLS without certificate verification
+}
+
+// SetDefaults fills in unset syslog output options
+func (c *SyslogOutputConfig) SetDefaults() {
+	switch c.Protocol {
+	case "udp", "tcp", "tls":
+	default:
+		c.Protocol = "udp"
+	}
+	switch c.Format {
+	case "cef", "leef":
+	default:
+		c.Format = "cef"
+	}
+	if c.Facility <= 0 || c.Facility > 23 {
+		c.Facility = 10 // authpriv
+	}
 }
 
 type EventLogConfig struct {
-	Enabled          bool                `yaml:"enabled"`
-	Channels         []EventLogChannel   `yaml:"channels"`
-	MinSeverity      int                 `yaml:"min_severity"`
-	ExcludeEventIDs  []int               `yaml:"exclude_event_ids"`
+	Enabled          bool                 `yaml:"enabled"`
+	Channels         []EventLogChannel    `yaml:"channels"`
+	MinSeverity      int                  `yaml:"min_severity"`
+	ExcludeEventIDs  []int                `yaml:"exclude_event_ids"`
+	Lean             bool                 `yaml:"lean"`              // Read high-volume events as values, without RawXML and EventData
+	IgnoreWatermarks bool                 `yaml:"ignore_watermarks"` // Send events at or below the sent watermarks again (intentional backfill)
+	RemoteHosts      []RemoteEventLogHost `yaml:"remote_hosts"`      // Hosts whose logs this agent reads remotely
+	BookmarkFile     string               `yaml:"bookmark_file"`     // Where the position in each channel is kept across restarts
+	BackfillHours    int                  `yaml:"backfill_hours"`    // Hours of existing events read from a channel without a bookmark (0 = new events only)
+}
+
+// RemoteEventLogHost is a Windows host whose Event Logs the agent
+// subscribes to over RPC (MS-EVEN6, as Event Log Forwarding does), for
+// appliances and servers where the agent may not be installed. The account
+// must be in the host's Event Log Readers group.
+type RemoteEventLogHost struct {
+	Host     string   `yaml:"host"`   // Name or IP address
+	Domain   string   `yaml:"domain"` // Empty with username empty: the agent's computer account
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	Auth     string   `yaml:"auth"`     // "negotiate", "kerberos" or "ntlm"
+	Channels []string `yaml:"channels"` // Default: Security, System, Application
+	Query    string   `yaml:"query"`    // XPath filter evaluated on the remote host (empty = all events)
+}
+
+// SetDefaults fills in the bookmark file and unset remote host options
+func (c *EventLogConfig) SetDefaults() {
+	if c.BookmarkFile == "" {
+		c.BookmarkFile = filepath.Join(os.Getenv("ProgramData"), "SIEM", "eventlog_bookmarks.json")
+	}
+	if c.BackfillHours < 0 {
+		c.BackfillHours = 0
+	}
+	for i := range c.RemoteHosts {
+		host := &c.RemoteHosts[i]
+		if host.Auth == "" {
+			host.Auth = "negotiate"
+		}
+		if len(host.Channels) == 0 {
+			host.Channels = []string{"Security", "System", "Application"}
+		}
+	}
 }
 
 type EventLogChannel struct {
@@ -50,6 +196,370 @@ type SysmonConfig struct {
 	PriorityEvents   []int `yaml:"priority_events"`
 }
 
+// JournaldConfig configures systemd journal collection on Linux
+type JournaldConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Units       []string `yaml:"units"`        // systemd units to collect (empty = all)
+	Identifiers []string `yaml:"identifiers"`  // SYSLOG_IDENTIFIER values to collect (empty = all)
+	MaxPriority int      `yaml:"max_priority"` // Least severe priority collected (0=emerg .. 7=debug)
+	CursorFile  string   `yaml:"cursor_file"`  // Where the journal position is kept across restarts
+}
+
+// SetDefaults fills in unset journald options
+func (c *JournaldConfig) SetDefaults() {
+	if c.MaxPriority <= 0 || c.MaxPriority > 7 {
+		c.MaxPriority = 6 // info
+	}
+	if c.CursorFile == "" {
+		c.CursorFile = "/var/lib/siem-agent/journald.cursor"
+	}
+}
+
+// AuditdConfig configures Linux audit event collection
+type AuditdConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Source     string   `yaml:"source"`      // "netlink" (kernel multicast) or "socket" (audisp af_unix plugin)
+	SocketPath string   `yaml:"socket_path"` // af_unix plugin socket for source "socket"
+	Keys       []string `yaml:"keys"`        // Only collect events tagged with these rule keys (empty = all)
+}
+
+// SetDefaults fills in unset auditd options
+func (c *AuditdConfig) SetDefaults() {
+	if c.Source != "socket" {
+		c.Source = "netlink"
+	}
+	if c.SocketPath == "" {
+		c.SocketPath = "/var/run/audispd_events"
+	}
+}
+
+// UnifiedLogConfig configures macOS unified log collection
+type UnifiedLogConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Predicates []string `yaml:"predicates"` // NSPredicate filters, combined with OR
+	Level      string   `yaml:"level"`      // "default", "info" or "debug"
+}
+
+// SetDefaults fills in unset unified log options. Without predicates the
+// whole system log would be streamed, so a security-relevant set is used.
+func (c *UnifiedLogConfig) SetDefaults() {
+	if len(c.Predicates) == 0 {
+		c.Predicates = []string{
+			`process == "sudo"`,
+			`process == "su"`,
+			`process == "sshd"`,
+			`process == "screensharingd"`,
+			`subsystem == "com.apple.TCC"`,
+			`subsystem == "com.apple.Authorization"`,
+		}
+	}
+	switch c.Level {
+	case "default", "info", "debug":
+	default:
+		c.Level = "default"
+	}
+}
+
+// EndpointSecurityConfig configures the macOS Endpoint Security client
+type EndpointSecurityConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Events         []string `yaml:"events"`          // "exec", "file" and/or "mount"
+	FilePaths      []string `yaml:"file_paths"`      // Only report file events under these path prefixes
+	MutedProcesses []string `yaml:"muted_processes"` // Executables whose events are ignored
+}
+
+// SetDefaults fills in unset Endpoint Security options. File events are
+// limited to persistence and configuration locations; every file created
+// on the system would flood the event queue.
+func (c *EndpointSecurityConfig) SetDefaults() {
+	if len(c.Events) == 0 {
+		c.Events = []string{"exec", "file", "mount"}
+	}
+	if len(c.FilePaths) == 0 {
+		c.FilePaths = []string{
+			"/Library/LaunchDaemons/",
+			"/Library/LaunchAgents/",
+			"/Library/StartupItems/",
+			"/Library/Security/",
+			"/Library/Extensions/",
+			"/private/etc/",
+			"/usr/local/bin/",
+			"/Applications/",
+		}
+	}
+}
+
+// ConnectionsConfig configures Linux network connection monitoring
+type ConnectionsConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	Interval        int  `yaml:"interval"`         // Seconds between socket table polls
+	IncludeLoopback bool `yaml:"include_loopback"` // Also report connections within the host
+}
+
+// SetDefaults fills in unset connection monitoring options
+func (c *ConnectionsConfig) SetDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = 5
+	}
+}
+
+// IdentityConfig configures Linux user, group, sudoers and SSH key
+// change monitoring
+type IdentityConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"` // Seconds between checks
+}
+
+// SetDefaults fills in unset identity monitoring options
+func (c *IdentityConfig) SetDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = 60
+	}
+}
+
+// SNMPTrapConfig configures the SNMP trap receiver, which turns traps from
+// network devices on the agent's segment into events
+type SNMPTrapConfig struct {
+	Enabled        bool           `yaml:"enabled"`
+	Listen         string         `yaml:"listen"`          // UDP address traps are received on
+	Communities    []string       `yaml:"communities"`     // v1/v2c communities accepted (empty = any)
+	Users          []SNMPUser     `yaml:"users"`           // v3 users; v3 traps from other users are dropped
+	AllowedSources []string       `yaml:"allowed_sources"` // Devices (IPs or CIDRs) traps are accepted from (empty = any)
+	Severity       int            `yaml:"severity"`        // Severity of traps without a mapping
+	Severities     map[string]int `yaml:"severities"`      // Trap OID prefix -> severity (longest prefix wins)
+}
+
+// SNMPUser is an SNMPv3 USM user
+type SNMPUser struct {
+	Name         string `yaml:"name"`
+	AuthProtocol string `yaml:"auth_protocol"` // "md5", "sha" or "sha256" (empty = noAuthNoPriv)
+	AuthPassword string `yaml:"auth_password"`
+	PrivProtocol string `yaml:"priv_protocol"` // "des" or "aes" (empty = no privacy)
+	PrivPassword string `yaml:"priv_password"`
+}
+
+// SetDefaults fills in unset SNMP trap options
+func (c *SNMPTrapConfig) SetDefaults() {
+	if c.Listen == "" {
+		c.Listen = ":162"
+	}
+	if c.Severity <= 0 {
+		c.Severity = 2
+	}
+}
+
+// SyslogInputConfig configures the syslog listener, which accepts logs
+// from firewalls, switches and appliances on the agent's network
+type SyslogInputConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	UDPListen      string   `yaml:"udp_listen"` // UDP address (empty = no UDP listener)
+	TCPListen      string   `yaml:"tcp_listen"` // TCP address (empty = no TCP listener)
+	TLSListen      string   `yaml:"tls_listen"` // TLS address (empty = no TLS listener)
+	CertFile       string   `yaml:"cert_file"`  // Certificate and key for the TLS listener
+	KeyFile        string   `yaml:"key_file"`
+	ClientCAFile   string   `yaml:"client_ca_file"`   // Require client certificates signed by this CA (empty = none)
+	AllowedSources []string `yaml:"allowed_sources"`  // Senders (IPs or CIDRs) accepted (empty = any)
+	ParseCEF       bool     `yaml:"parse_cef"`        // Map CEF payloads to event fields
+	MaxMessageSize int      `yaml:"max_message_size"` // Longer messages are truncated (bytes)
+	MaxConnections int      `yaml:"max_connections"`  // Open TCP and TLS connections
+	IdleTimeout    int      `yaml:"idle_timeout"`     // Seconds without data before a TCP or TLS connection is closed
+}
+
+// SetDefaults fills in unset syslog listener options. Without any listen
+// address the listener takes the standard UDP port.
+func (c *SyslogInputConfig) SetDefaults() {
+	if c.UDPListen == "" && c.TCPListen == "" && c.TLSListen == "" {
+		c.UDPListen = ":514"
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = 64 * 1024
+	}
+	if c.MaxConnections <= 0 {
+		c.MaxConnections = 256
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 300
+	}
+}
+
+// ContainerConfig configures container mode: running in a privileged
+// container (a Kubernetes DaemonSet) with the host's root filesystem
+// mounted, sharing the host's PID and network namespaces
+type ContainerConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	HostRoot string `yaml:"host_root"` // Where the host's / is mounted
+	NodeName string `yaml:"node_name"` // Name the agent registers as (empty = $NODE_NAME)
+}
+
+// SetDefaults fills in unset container mode options
+func (c *ContainerConfig) SetDefaults() {
+	if c.HostRoot == "" {
+		c.HostRoot = "/host"
+	}
+	if c.NodeName == "" {
+		c.NodeName = os.Getenv("NODE_NAME") // downward API: spec.nodeName
+	}
+}
+
+// DetectionConfig configures on-agent Sigma rule evaluation. Rules are
+// distributed by the server and kept on disk, so detection keeps working
+// while the server is unreachable.
+type DetectionConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	SyncInterval int    `yaml:"sync_interval"` // Seconds between rule downloads
+	RulesFile    string `yaml:"rules_file"`    // Where the last downloaded rules are kept
+}
+
+// SetDefaults fills in unset detection options
+func (c *DetectionConfig) SetDefaults() {
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = 900
+	}
+	if c.RulesFile == "" {
+		c.RulesFile = filepath.Join(os.Getenv("ProgramData"), "SIEM", "sigma_rules.json")
+		if runtime.GOOS != "windows" {
+			c.RulesFile = "/var/lib/siem-agent/sigma_rules.json"
+		}
+	}
+}
+
+// ThreatIntelConfig configures on-agent IOC matching. The server pushes
+// digests of its indicators; the last set is kept on disk.
+type ThreatIntelConfig struct {
+	Enabled      bool        `yaml:"enabled"`
+	SyncInterval int         `yaml:"sync_interval"` // Seconds between IOC downloads and TAXII polls
+	IOCFile      string      `yaml:"ioc_file"`      // Where the last downloaded IOC sets are kept
+	TAXIIFeeds   []TAXIIFeed `yaml:"taxii_feeds"`
+}
+
+// TAXIIFeed is a STIX 2.1 indicator collection pulled from a TAXII 2.1
+// server, directly or through the SIEM server's TAXII proxy
+type TAXIIFeed struct {
+	Name       string `yaml:"name"`
+	APIRoot    string `yaml:"api_root"`   // e.g. https://taxii.example.com/api1/; ignored with via_server
+	Collection string `yaml:"collection"` // collection ID
+	ViaServer  bool   `yaml:"via_server"` // pull through the SIEM server with the agent's API key
+	Username   string `yaml:"username"`   // HTTP basic authentication for direct pulls
+	Password   string `yaml:"password"`
+	Severity   int    `yaml:"severity"` // of alerts for this feed (default 5)
+}
+
+// SetDefaults fills in unset threat-intel options
+func (c *ThreatIntelConfig) SetDefaults() {
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = 3600
+	}
+	if c.IOCFile == "" {
+		c.IOCFile = filepath.Join(os.Getenv("ProgramData"), "SIEM", "ioc_sets.json")
+		if runtime.GOOS != "windows" {
+			c.IOCFile = "/var/lib/siem-agent/ioc_sets.json"
+		}
+	}
+	for i := range c.TAXIIFeeds {
+		feed := &c.TAXIIFeeds[i]
+		if feed.Name == "" {
+			feed.Name = feed.Collection
+		}
+		if feed.Severity < 1 || feed.Severity > 5 {
+			feed.Severity = 5
+		}
+	}
+}
+
+// CorrelationConfig configures local stateful correlation rules, such as
+// repeated failed logons from one source or a process followed by a
+// connection to a new domain
+type CorrelationConfig struct {
+	Enabled bool              `yaml:"enabled"`
+	Rules   []CorrelationRule `yaml:"rules"`
+}
+
+// CorrelationRule is a threshold or sequence rule. Match and Then are
+// Sigma selections: field names with optional modifiers mapped to values.
+type CorrelationRule struct {
+	Name     string                 `yaml:"name"`
+	Type     string                 `yaml:"type"`      // "threshold" or "sequence"
+	Match    map[string]interface{} `yaml:"match"`     // events counted, or the first event of a sequence
+	Then     map[string]interface{} `yaml:"then"`      // sequence: the event that must follow
+	GroupBy  string                 `yaml:"group_by"`  // threshold: count per value of this field (empty = all events)
+	Join     string                 `yaml:"join"`      // sequence: field both events share, e.g. ProcessId
+	NewValue string                 `yaml:"new_value"` // sequence: only values of this field not seen before
+	Count    int                    `yaml:"count"`     // threshold: events needed within the window
+	Window   int                    `yaml:"window"`    // seconds
+	Severity int                    `yaml:"severity"`  // of the alert
+}
+
+// SetDefaults fills in unset rule options
+func (c *CorrelationConfig) SetDefaults() {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.Count <= 0 {
+			rule.Count = 5
+		}
+		if rule.Window <= 0 {
+			rule.Window = 300
+		}
+		if rule.Severity < 1 || rule.Severity > 5 {
+			rule.Severity = 4
+		}
+	}
+}
+
+// DeceptionConfig configures decoy files and registry credentials. Any
+// access to a decoy raises a critical alert.
+type DeceptionConfig struct {
+	Enabled         bool              `yaml:"enabled"`
+	Files           []DecoyFile       `yaml:"files"`
+	Credentials     []DecoyCredential `yaml:"credentials"`      // Windows only
+	IgnoreProcesses []string          `yaml:"ignore_processes"` // Executable names expected to touch decoys (backup, antivirus)
+	CheckInterval   int               `yaml:"check_interval"`   // Seconds between checks that decoys are in place
+	StateFile       string            `yaml:"state_file"`       // Which decoys the agent planted
+}
+
+// DecoyFile is a decoy file; it is only created where no file exists
+type DecoyFile struct {
+	Path    string `yaml:"path"`
+	Content string `yaml:"content"` // empty = fake credentials with a random password
+}
+
+// DecoyCredential is a decoy registry value under HKLM or HKU
+type DecoyCredential struct {
+	Key   string `yaml:"key"`   // e.g. HKLM\SOFTWARE\BackupAdmin
+	Name  string `yaml:"name"`  // value name, e.g. Password
+	Value string `yaml:"value"` // empty = random password
+}
+
+// SetDefaults fills in unset deception options
+func (c *DeceptionConfig) SetDefaults() {
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = 3600
+	}
+	if c.StateFile == "" {
+		c.StateFile = filepath.Join(os.Getenv("ProgramData"), "SIEM", "decoys.json")
+		if runtime.GOOS != "windows" {
+			c.StateFile = "/var/lib/siem-agent/decoys.json"
+		}
+	}
+}
+
+// TimeSyncConfig configures time synchronization health monitoring
+type TimeSyncConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	CheckInterval int    `yaml:"check_interval"` // Seconds between checks
+	MaxOffsetMs   int    `yaml:"max_offset_ms"`  // Clock offset that raises a health event
+	Reference     string `yaml:"reference"`      // NTP server to measure against (empty = the time service's source)
+}
+
+// SetDefaults fills in unset time sync options
+func (c *TimeSyncConfig) SetDefaults() {
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = 900
+	}
+	if c.MaxOffsetMs <= 0 {
+		c.MaxOffsetMs = 2000
+	}
+}
+
 type InventoryConfig struct {
 	Enabled           bool `yaml:"enabled"`
 	FullScanInterval  int  `yaml:"full_scan_interval"`
@@ -58,6 +568,29 @@ type InventoryConfig struct {
 	CollectServices   bool `yaml:"collect_services"`
 	CollectStartup    bool `yaml:"collect_startup"`
 	CollectNetwork    bool `yaml:"collect_network"`
+	SysInfoInterval   int  `yaml:"sysinfo_interval"` // System info refresh interval (seconds)
+	LowDiskPercent    int  `yaml:"low_disk_percent"` // Free space alert threshold for fixed volumes
+}
+
+// VulnerabilityConfig configures matching the inventory against the
+// server's advisory feed. The last feed is kept on disk.
+type VulnerabilityConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	SyncInterval int    `yaml:"sync_interval"` // Seconds between feed downloads
+	FeedFile     string `yaml:"feed_file"`     // Where the last downloaded feed is kept
+}
+
+// SetDefaults fills in unset vulnerability matching options
+func (c *VulnerabilityConfig) SetDefaults() {
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = 21600
+	}
+	if c.FeedFile == "" {
+		c.FeedFile = filepath.Join(os.Getenv("ProgramData"), "SIEM", "vulnerability_feed.json")
+		if runtime.GOOS != "windows" {
+			c.FeedFile = "/var/lib/siem-agent/vulnerability_feed.json"
+		}
+	}
 }
 
 // SoftwareControlConfig configures software installation control
@@ -65,21 +598,198 @@ type SoftwareControlConfig struct {
 	Enabled              bool     `yaml:"enabled"`
 	RequireApproval      bool     `yaml:"require_approval"`
 	MonitorInstallers    bool     `yaml:"monitor_installers"`
+	InterceptInstallers  bool     `yaml:"intercept_installers"` // Suspend installers until approved
 	AllowedExtensions    []string `yaml:"allowed_extensions"`
 	BlockedPublishers    []string `yaml:"blocked_publishers"`
 	AllowedPublishers    []string `yaml:"allowed_publishers"`
 	PollInterval         int      `yaml:"poll_interval"`
 	ApprovalTimeout      int      `yaml:"approval_timeout"`
 	NotifyOnBlock        bool     `yaml:"notify_on_block"`
+	PromptForComment     bool     `yaml:"prompt_for_comment"` // Show a dialog collecting the user's justification
+	InstallViaWinget     bool     `yaml:"install_via_winget"` // Install approved software via winget instead of the user's installer
+	ReputationAutoApprove      bool `yaml:"reputation_auto_approve"`      // Auto-approve installers the reputation source trusts
+	ReputationMinScore         int  `yaml:"reputation_min_score"`         // 0-100
+	ReputationRequireSignature bool `yaml:"reputation_require_signature"` // Only auto-approve validly signed installers
 	LogAllAttempts       bool     `yaml:"log_all_attempts"`
 	WhitelistPaths       []string `yaml:"whitelist_paths"`
 	InstallerPatterns    []string `yaml:"installer_patterns"`
+	EnforcePolicy        bool     `yaml:"enforce_policy"`       // Deploy server allowlist as AppLocker policy
+	PolicyMode           string   `yaml:"policy_mode"`          // "audit" or "enforce"
+	PolicySyncInterval   int      `yaml:"policy_sync_interval"` // seconds
+	LearningMode         bool     `yaml:"learning_mode"`            // Record installers without prompting or blocking
+	LearningPeriod       int      `yaml:"learning_period"`          // hours
+	LearningReportInterval int    `yaml:"learning_report_interval"` // seconds
+	GroupPolicies        []SoftwareGroupPolicy `yaml:"group_policies"` // First match wins; server-pushed policies are checked first
+	MonitorRemovals      bool     `yaml:"monitor_removals"`   // Alert when server-required software is uninstalled
+	ReinstallRequired    bool     `yaml:"reinstall_required"` // Reinstall removed required software via the app store
+	ProcessUninstalls    bool     `yaml:"process_uninstalls"` // Remove app store apps when the server requests it
+}
+
+// SoftwareGroupPolicy overrides the approval rules for specific users or groups
+type SoftwareGroupPolicy struct {
+	Name   string   `yaml:"name" json:"name"`
+	Users  []string `yaml:"users" json:"users,omitempty"`   // DOMAIN\user or user
+	Groups []string `yaml:"groups" json:"groups,omitempty"` // DOMAIN\Group, local group name or SID
+	Action string   `yaml:"action" json:"action"`           // "allow", "allow_signed", "deny" or "require_approval"
+}
+
+// RemoteSessionConfig configures admin-initiated remote support sessions
+type RemoteSessionConfig struct {
+	Enabled              bool   `yaml:"enabled"`
+	ConsentTimeout       int    `yaml:"consent_timeout"`        // seconds the user has to answer
+	ConsentMode          string `yaml:"consent_mode"`           // "require_consent", "notify" or "auto_accept"
+	ConsentTimeoutAction string `yaml:"consent_timeout_action"` // "decline" or "accept" when nobody answers
+	NoUserAction         string `yaml:"no_user_action"`         // "decline" or "accept" when nobody is logged on
+	MaxSessionDuration   int    `yaml:"max_session_duration"`   // minutes
+	IdleTimeout          int    `yaml:"idle_timeout"`           // minutes without operator activity
+	TerminalShell        string `yaml:"terminal_shell"`         // "powershell" or "cmd"
+	TerminalConstrained  bool   `yaml:"terminal_constrained"`   // PowerShell ConstrainedLanguage mode
+	FileTransferPush     bool   `yaml:"file_transfer_push"`     // Operator may send files to this machine
+	FileTransferPull     bool   `yaml:"file_transfer_pull"`     // Operator may fetch files from this machine
+	FileTransferMaxSize  int    `yaml:"file_transfer_max_size"` // MB per file
+	FileTransferDir      string `yaml:"file_transfer_dir"`      // Pushed files are saved under <dir>\<session GUID>
+
+	RelayInsecureSkipVerify bool `yaml:"relay_insecure_skip_verify"` // Relay tunnel TLS without certificate verification
+}
+
+// SetDefaults fills in unset consent and time limit values
+func (c *RemoteSessionConfig) SetDefaults() {
+	if c.ConsentTimeout <= 0 {
+		c.ConsentTimeout = 60
+	}
+	switch c.ConsentMode {
+	case "notify", "auto_accept":
+	default:
+		c.ConsentMode = "require_consent"
+	}
+	if c.ConsentTimeoutAction != "accept" {
+		c.ConsentTimeoutAction = "decline"
+	}
+	// Older configurations used the timeout action for unattended machines too
+	if c.NoUserAction == "" {
+		c.NoUserAction = c.ConsentTimeoutAction
+	}
+	if c.NoUserAction != "accept" {
+		c.NoUserAction = "decline"
+	}
+	if c.MaxSessionDuration <= 0 {
+		c.MaxSessionDuration = 240
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 30
+	}
+	if c.TerminalShell != "cmd" {
+		c.TerminalShell = "powershell"
+	}
+	if c.FileTransferMaxSize <= 0 {
+		c.FileTransferMaxSize = 50
+	}
+	if c.FileTransferDir == "" {
+		c.FileTransferDir = filepath.Join(os.Getenv("ProgramData"), "SIEM", "transfers")
+	}
+}
+
+// ScriptExecutionConfig configures scripts run on behalf of the SIEM server
+type ScriptExecutionConfig struct {
+	SigningKeys       []string               `yaml:"signing_keys"`         // base64 Ed25519 public keys; scripts must be signed by one of them
+	ServiceAccounts   []ScriptServiceAccount `yaml:"service_accounts"`     // accounts scripts may select with run_as: account
+	MaxConcurrent     int                    `yaml:"max_concurrent"`       // scripts running at the same time
+	MaxQueued         int                    `yaml:"max_queued"`           // executions waiting for a free slot
+	MaxMemoryMB       int                    `yaml:"max_memory_mb"`        // per script, including child processes
+	MaxCPUPercent     int                    `yaml:"max_cpu_percent"`      // hard cap across all processors
+	MaxProcesses      int                    `yaml:"max_processes"`        // active processes per script
+	CacheDir          string                 `yaml:"cache_dir"`            // library scripts, validated by hash before each use
+	ApprovalRiskLevel int                    `yaml:"approval_risk_level"`  // scripts at or above this risk need approval; 0 = off
+	ApprovalMode      string                 `yaml:"approval_mode"`        // "local", "second_approver" or "any"
+	ApprovalTimeout   int                    `yaml:"approval_timeout"`     // seconds to wait for local confirmation
+	MaxArtifactSizeMB int                    `yaml:"max_artifact_size_mb"` // files a script leaves in SIEM_OUTPUT_DIR
+}
+
+// SetDefaults fills in unset queue and resource limits, the cache directory
+// and the approval policy
+func (c *ScriptExecutionConfig) SetDefaults() {
+	if c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = 2
+	}
+	if c.MaxQueued <= 0 {
+		c.MaxQueued = 50
+	}
+	if c.MaxMemoryMB <= 0 {
+		c.MaxMemoryMB = 1024
+	}
+	if c.MaxCPUPercent <= 0 || c.MaxCPUPercent > 100 {
+		c.MaxCPUPercent = 50
+	}
+	if c.MaxProcesses <= 0 {
+		c.MaxProcesses = 32
+	}
+	if c.CacheDir == "" {
+		c.CacheDir = filepath.Join(os.Getenv("ProgramData"), "SIEM", "script_cache")
+		if runtime.GOOS != "windows" {
+			c.CacheDir = "/var/lib/siem-agent/script_cache"
+		}
+	}
+	switch c.ApprovalMode {
+	case "local", "second_approver":
+	default:
+		c.ApprovalMode = "any"
+	}
+	if c.ApprovalTimeout <= 0 {
+		c.ApprovalTimeout = 300
+	}
+	if c.MaxArtifactSizeMB <= 0 {
+		c.MaxArtifactSizeMB = 50
+	}
+}
+
+// AppStoreConfig configures app store installs and managed updates
+type AppStoreConfig struct {
+	AutoUpdate          bool   `yaml:"auto_update"`           // Request and apply updates for installed store apps
+	UpdateCheckInterval int    `yaml:"update_check_interval"` // seconds
+	MaintenanceWindow   string `yaml:"maintenance_window"`    // "HH:MM-HH:MM" local time, may span midnight; empty = any time
+	DownloadRateLimit   int    `yaml:"download_rate_limit"`   // KB/s per installer download; 0 = unlimited
+	DownloadWindow      string `yaml:"download_window"`       // "HH:MM-HH:MM" when installers may download; empty = any time
+	PeerCache           bool   `yaml:"peer_cache"`            // Share verified installers with agents on the local subnet
+	PeerCachePort       int    `yaml:"peer_cache_port"`       // UDP discovery and TCP download port
+	PeerCacheDir        string `yaml:"peer_cache_dir"`
+	PeerCacheMaxSizeMB  int    `yaml:"peer_cache_max_size_mb"`
+	CatalogCacheDir     string `yaml:"catalog_cache_dir"`
+	CatalogCacheTTL     int    `yaml:"catalog_cache_ttl"` // seconds the cached catalog is shown while the server is unreachable
+}
+
+// SetDefaults fills in the update check interval and the cache settings
+func (c *AppStoreConfig) SetDefaults() {
+	if c.UpdateCheckInterval <= 0 {
+		c.UpdateCheckInterval = 3600
+	}
+	if c.PeerCachePort <= 0 {
+		c.PeerCachePort = 41740
+	}
+	if c.PeerCacheDir == "" {
+		c.PeerCacheDir = filepath.Join(os.Getenv("ProgramData"), "SIEM", "peer_cache")
+	}
+	if c.PeerCacheMaxSizeMB <= 0 {
+		c.PeerCacheMaxSizeMB = 10240
+	}
+	if c.CatalogCacheDir == "" {
+		c.CatalogCacheDir = filepath.Join(os.Getenv("ProgramData"), "SIEM", "appstore_cache")
+	}
+	if c.CatalogCacheTTL <= 0 {
+		c.CatalogCacheTTL = 86400
+	}
+}
+
+// ScriptServiceAccount is a named account scripts can run as
+type ScriptServiceAccount struct {
+	Name     string `yaml:"name"`
+	UserName string `yaml:"username"` // DOMAIN\user or user
+	Password string `yaml:"password"`
 }
 
 type PerformanceConfig struct {
 	MaxCPUPercent  int  `yaml:"max_cpu_percent"`
 	MaxMemoryMB    int  `yaml:"max_memory_mb"`
-	WorkerThreads  int  `yaml:"worker_threads"`
+	WorkerThreads  int  `yaml:"worker_threads"` // Event Log parsing workers shared by all channels
 	Compression    bool `yaml:"compression"`
 }
 
@@ -98,6 +808,7 @@ type AgentConfig struct {
 	Criticality string   `yaml:"criticality"`
 	Location    string   `yaml:"location"`
 	Owner       string   `yaml:"owner"`
+	TenantID    string   `yaml:"tenant_id"` // Customer the agent belongs to; the enrollment response takes precedence
 }
 
 type AdvancedConfig struct {
@@ -121,6 +832,37 @@ type ProtectionConfig struct {
 	IntegrityCheckInterval int `yaml:"integrity_check_interval"`
 }
 
+// WatchdogConfig configures the watchdog restart policy
+type WatchdogConfig struct {
+	RestartInitialDelay int `yaml:"restart_initial_delay"` // seconds, doubled after each failed restart
+	RestartMaxDelay     int `yaml:"restart_max_delay"`     // seconds, backoff cap
+	MaxFailures         int `yaml:"max_failures"`          // give up and alert after N failures...
+	FailureWindow       int `yaml:"failure_window"`        // ...within M minutes
+	HealthyResetPeriod  int `yaml:"healthy_reset_period"`  // seconds of healthy uptime that reset the backoff
+}
+
+// SetDefaults fills in unset restart policy values
+func (c *WatchdogConfig) SetDefaults() {
+	if c.RestartInitialDelay <= 0 {
+		c.RestartInitialDelay = 5
+	}
+	if c.RestartMaxDelay <= 0 {
+		c.RestartMaxDelay = 300
+	}
+	if c.RestartMaxDelay < c.RestartInitialDelay {
+		c.RestartMaxDelay = c.RestartInitialDelay
+	}
+	if c.MaxFailures <= 0 {
+		c.MaxFailures = 5
+	}
+	if c.FailureWindow <= 0 {
+		c.FailureWindow = 10
+	}
+	if c.HealthyResetPeriod <= 0 {
+		c.HealthyResetPeriod = 600
+	}
+}
+
 // Load reads and parses the configuration file
 func Load(path string) (*Config, error) {
 	// Check if file exists
@@ -140,6 +882,23 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// Keep the API key out of the file where the platform has a secret store
+	if config.SIEM.APIKey == "" {
+		if apiKey, err := secrets.Get(secrets.APIKey); err == nil {
+			config.SIEM.APIKey = apiKey
+		} else if !errors.Is(err, secrets.ErrUnsupported) && !errors.Is(err, secrets.ErrNotFound) {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// In a container the API key comes from a Kubernetes Secret
+	if config.SIEM.APIKey == "" && config.Container.Enabled {
+		config.SIEM.APIKey = os.Getenv("SIEM_API_KEY")
+	}
+	if config.SIEM.EnrollmentToken == "" && config.Container.Enabled {
+		config.SIEM.EnrollmentToken = os.Getenv("SIEM_ENROLLMENT_TOKEN")
+	}
+
 	// Validate configuration
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -165,16 +924,143 @@ func (c *Config) Validate() error {
 		c.SIEM.SendInterval = 30
 	}
 
+	// Adaptive send interval bounds, which include the initial interval
+	if c.SIEM.SendIntervalMin <= 0 {
+		c.SIEM.SendIntervalMin = 5
+	}
+	if c.SIEM.SendIntervalMax <= 0 {
+		c.SIEM.SendIntervalMax = 300
+	}
+	c.SIEM.SendIntervalMin = min(c.SIEM.SendIntervalMin, c.SIEM.SendInterval)
+	c.SIEM.SendIntervalMax = max(c.SIEM.SendIntervalMax, c.SIEM.SendInterval)
+
 	// Heartbeat interval must be positive
 	if c.SIEM.HeartbeatInterval <= 0 {
 		c.SIEM.HeartbeatInterval = 60
 	}
 
+	// Events held in memory before spilling to disk
+	if c.SIEM.MaxQueueSize <= 0 {
+		c.SIEM.MaxQueueSize = 10000
+	}
+	c.Queue.SetDefaults()
+	c.SyslogOutput.SetDefaults()
+	if c.SyslogOutput.Enabled && c.SyslogOutput.Address == "" {
+		return fmt.Errorf("syslog_output.address is required")
+	}
+
+	// API request timeout (seconds)
+	if c.SIEM.SendTimeout <= 0 {
+		c.SIEM.SendTimeout = 30
+	}
+
+	// Request size limit for event batches (bytes)
+	if c.SIEM.MaxRequestBytes <= 0 {
+		c.SIEM.MaxRequestBytes = 1024 * 1024
+	}
+
+	// Event schema sent to the server
+	switch c.SIEM.EventFormat {
+	case "native", "ecs":
+	case "":
+		c.SIEM.EventFormat = "native"
+	default:
+		log.Printf("Warning: Unknown siem.event_format %q, sending native events", c.SIEM.EventFormat)
+		c.SIEM.EventFormat = "native"
+	}
+
+	// Per-agent credential issued at enrollment
+	switch c.SIEM.CredentialType {
+	case "certificate", "jwt":
+	case "":
+		c.SIEM.CredentialType = "certificate"
+	default:
+		return fmt.Errorf("siem.credential_type must be certificate or jwt")
+	}
+	if c.SIEM.CredentialFile == "" {
+		c.SIEM.CredentialFile = "/var/lib/siem-agent/credential.json"
+	}
+
+	// Dropped events warning threshold
+	if c.SIEM.DropWarningThreshold <= 0 {
+		c.SIEM.DropWarningThreshold = 100
+	}
+
+	// System info refresh interval
+	if c.Inventory.SysInfoInterval <= 0 {
+		c.Inventory.SysInfoInterval = 900
+	}
+
+	// Low disk space threshold (percent free)
+	if c.Inventory.LowDiskPercent <= 0 || c.Inventory.LowDiskPercent >= 100 {
+		c.Inventory.LowDiskPercent = 10
+	}
+
 	// Worker threads must be positive
 	if c.Performance.WorkerThreads <= 0 {
 		c.Performance.WorkerThreads = 4
 	}
 
+	// Remote Event Log hosts
+	c.EventLog.SetDefaults()
+
+	// Journal priority filter and cursor location
+	c.Journald.SetDefaults()
+
+	// Audit record source
+	c.Auditd.SetDefaults()
+
+	// Unified log filters
+	c.UnifiedLog.SetDefaults()
+
+	// Endpoint Security event types and file paths
+	c.EndpointSecurity.SetDefaults()
+
+	// Connection poll interval
+	c.Connections.SetDefaults()
+
+	// Identity poll interval
+	c.Identity.SetDefaults()
+
+	// SNMP trap listen address and severity
+	c.SNMPTrap.SetDefaults()
+
+	// Syslog listen address and limits
+	c.SyslogInput.SetDefaults()
+
+	// Host mount point and node name
+	c.Container.SetDefaults()
+
+	// Sigma rule sync interval and storage
+	c.Detection.SetDefaults()
+
+	// IOC sync interval and storage
+	c.ThreatIntel.SetDefaults()
+
+	// Vulnerability feed sync interval and storage
+	c.Vulnerabilities.SetDefaults()
+
+	// Correlation rule windows and thresholds
+	c.Correlation.SetDefaults()
+
+	// Decoy check interval and planted decoy state
+	c.Deception.SetDefaults()
+
+	// Time sync check interval and offset threshold
+	c.TimeSync.SetDefaults()
+
+	// Watchdog restart policy
+	c.Watchdog.SetDefaults()
+
+	// Remote session consent and time limits
+	c.RemoteSession.SetDefaults()
+
+	// Script execution queue and resource limits
+	c.ScriptExecution.SetDefaults()
+
+	// App store update schedule
+	c.AppStore.SetDefaults()
+
 	// Log level validation
 	validLevels := map[string]bool{
 		"debug": true,
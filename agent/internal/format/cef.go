@@ -0,0 +1,159 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/siem/agent/internal/collector"
+)
+
+// Device vendor and product in CEF and LEEF headers
+const (
+	DeviceVendor  = "SIEM"
+	DeviceProduct = "SIEM Agent"
+)
+
+// extensionField maps an event field to a CEF or LEEF extension key. An
+// empty value is left out.
+type extensionField struct {
+	key   string
+	value func(event *collector.Event) string
+}
+
+// itoa formats a number, zero as empty
+func itoa(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// itoa64 formats a record ID, zero as empty
+func itoa64(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// CEF extension keys. Fields without a standard key use the custom string
+// and number slots with their labels.
+var cefFields = []extensionField{
+	{"rt", func(e *collector.Event) string {
+		if e.EventTime.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(e.EventTime.UnixMilli(), 10)
+	}},
+	{"cat", func(e *collector.Event) string { return e.SourceType }},
+	{"dvchost", func(e *collector.Event) string { return e.Computer }},
+	{"dvc", func(e *collector.Event) string { return e.IPAddress }},
+	{"deviceExternalId", func(e *collector.Event) string { return e.AgentID }},
+	{"deviceFacility", func(e *collector.Event) string { return e.Channel }},
+	{"externalId", func(e *collector.Event) string { return itoa64(e.RecordID) }},
+	{"msg", func(e *collector.Event) string { return e.Message }},
+	{"suser", func(e *collector.Event) string { return e.SubjectUser }},
+	{"sntdom", func(e *collector.Event) string { return e.SubjectDomain }},
+	{"duser", func(e *collector.Event) string { return e.TargetUser }},
+	{"dntdom", func(e *collector.Event) string { return e.TargetDomain }},
+	{"sproc", func(e *collector.Event) string { return e.ProcessName }},
+	{"spid", func(e *collector.Event) string { return itoa(e.ProcessID) }},
+	{"src", func(e *collector.Event) string { return e.SourceIP }},
+	{"spt", func(e *collector.Event) string { return itoa(e.SourcePort) }},
+	{"shost", func(e *collector.Event) string { return e.SourceHostname }},
+	{"dst", func(e *collector.Event) string { return e.DestinationIP }},
+	{"dpt", func(e *collector.Event) string { return itoa(e.DestinationPort) }},
+	{"proto", func(e *collector.Event) string { return strings.ToUpper(e.Protocol) }},
+	{"filePath", func(e *collector.Event) string { return e.FilePath }},
+	{"fileHash", func(e *collector.Event) string { return e.FileHash }},
+	{"reason", func(e *collector.Event) string { return e.FailureReason }},
+	{"cs1Label", func(e *collector.Event) string { return label(e.ProcessCommandLine, "CommandLine") }},
+	{"cs1", func(e *collector.Event) string { return e.ProcessCommandLine }},
+	{"cs2Label", func(e *collector.Event) string { return label(e.ParentProcessName, "ParentProcess") }},
+	{"cs2", func(e *collector.Event) string { return e.ParentProcessName }},
+	{"cs3Label", func(e *collector.Event) string { return label(e.RegistryPath, "RegistryPath") }},
+	{"cs3", func(e *collector.Event) string { return e.RegistryPath }},
+	{"cs4Label", func(e *collector.Event) string { return label(e.ServiceName, "ServiceName") }},
+	{"cs4", func(e *collector.Event) string { return e.ServiceName }},
+	{"cs5Label", func(e *collector.Event) string { return label(e.EventData["rule_id"], "RuleID") }},
+	{"cs5", func(e *collector.Event) string { return e.EventData["rule_id"] }},
+	{"cn1Label", func(e *collector.Event) string { return label(itoa(e.LogonType), "LogonType") }},
+	{"cn1", func(e *collector.Event) string { return itoa(e.LogonType) }},
+}
+
+// label returns name when the labelled value is set
+func label(value, name string) string {
+	if value == "" {
+		return ""
+	}
+	return name
+}
+
+// cefSeverity maps severity 1-5 to CEF's 0-10
+var cefSeverity = [...]string{"0", "1", "3", "5", "8", "10"}
+
+// CEF renders an event as an ArcSight Common Event Format string, for
+// syslog output and integrations that require CEF. version is the agent
+// version reported in the header.
+func CEF(event *collector.Event, version string) string {
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	b.WriteString(cefHeader(DeviceVendor))
+	b.WriteByte('|')
+	b.WriteString(cefHeader(DeviceProduct))
+	b.WriteByte('|')
+	b.WriteString(cefHeader(version))
+	b.WriteByte('|')
+	b.WriteString(strconv.Itoa(event.EventCode))
+	b.WriteByte('|')
+	b.WriteString(cefHeader(eventName(event)))
+	b.WriteByte('|')
+	b.WriteString(cefSeverity[max(0, min(event.Severity, 5))])
+	b.WriteByte('|')
+
+	first := true
+	for _, field := range cefFields {
+		value := field.value(event)
+		if value == "" {
+			continue
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(field.key)
+		b.WriteByte('=')
+		b.WriteString(cefExtension(value))
+	}
+
+	return b.String()
+}
+
+// eventName is the short description in the header: the message's first
+// line, or the event ID without a message
+func eventName(event *collector.Event) string {
+	name, _, _ := strings.Cut(event.Message, "\n")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return event.SourceType + " event " + strconv.Itoa(event.EventCode)
+	}
+	if len(name) > 512 {
+		name = strings.ToValidUTF8(name[:512], "")
+	}
+	return name
+}
+
+// Header values escape backslashes and pipes; line breaks are not allowed
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+
+func cefHeader(value string) string {
+	return cefHeaderEscaper.Replace(value)
+}
+
+// Extension values escape backslashes and equal signs, line breaks as \n
+// and \r
+var cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+
+func cefExtension(value string) string {
+	return cefExtensionEscaper.Replace(value)
+}
@@ -0,0 +1,222 @@
+// Package format renders normalized events in the schemas and wire formats
+// of other security tools, for customers who ship agent events into them
+// without a transform on the SIEM server.
+package format
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siem/agent/internal/collector"
+)
+
+// ECS version the mapping follows
+const ECSVersion = "8.11.0"
+
+// Windows logon types by number, as Winlogbeat names them
+var ecsLogonTypes = map[int]string{
+	2:  "Interactive",
+	3:  "Network",
+	4:  "Batch",
+	5:  "Service",
+	7:  "Unlock",
+	8:  "NetworkCleartext",
+	9:  "NewCredentials",
+	10: "RemoteInteractive",
+	11: "CachedInteractive",
+}
+
+// ecsCategorization is the event.category, event.type and event.action of
+// an event ID
+type ecsCategorization struct {
+	category string
+	kind     string
+	action   string
+}
+
+// Categorization of common events by source type and event ID; other
+// events carry only event.code
+var ecsCategories = map[string]map[int]ecsCategorization{
+	"Windows Security": {
+		4624: {"authentication", "start", "logged-in"},
+		4625: {"authentication", "start", "logon-failed"},
+		4634: {"authentication", "end", "logged-out"},
+		4648: {"authentication", "start", "logged-in-explicit"},
+		4688: {"process", "start", "created-process"},
+		4689: {"process", "end", "exited-process"},
+		4720: {"iam", "creation", "added-user-account"},
+		4726: {"iam", "deletion", "deleted-user-account"},
+		4728: {"iam", "group", "added-member-to-group"},
+		4732: {"iam", "group", "added-member-to-group"},
+		4740: {"iam", "change", "locked-out-user-account"},
+		1102: {"configuration", "deletion", "audit-log-cleared"},
+	},
+	"Sysmon": {
+		1:  {"process", "start", "Process Create"},
+		3:  {"network", "connection", "Network connection detected"},
+		5:  {"process", "end", "Process terminated"},
+		7:  {"process", "change", "Image loaded"},
+		11: {"file", "creation", "File created"},
+		12: {"registry", "change", "Registry object added or deleted"},
+		13: {"registry", "change", "Registry value set"},
+		14: {"registry", "change", "Registry object renamed"},
+		22: {"network", "protocol", "Dns query"},
+		23: {"file", "deletion", "File Delete archived"},
+		26: {"file", "deletion", "File Delete logged"},
+	},
+}
+
+// ecsDocument is an ECS event as nested objects
+type ecsDocument map[string]interface{}
+
+// set stores a value at a dotted path; empty strings and zero numbers are
+// left out, as ECS documents omit unknown fields
+func (d ecsDocument) set(path string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case int:
+		if v == 0 {
+			return
+		}
+	case int64:
+		if v == 0 {
+			return
+		}
+	case time.Time:
+		if v.IsZero() {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case map[string]string:
+		if len(v) == 0 {
+			return
+		}
+	}
+
+	object := d
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := object[key].(ecsDocument)
+		if !ok {
+			child = ecsDocument{}
+			object[key] = child
+		}
+		object = child
+	}
+	object[keys[len(keys)-1]] = value
+}
+
+// ECS maps an event to Elastic Common Schema fields. Windows specifics
+// follow Winlogbeat (winlog.*), so Elasticsearch and OpenSearch dashboards
+// and detection rules for it apply as they are.
+func ECS(event *collector.Event) map[string]interface{} {
+	doc := ecsDocument{}
+
+	doc.set("@timestamp", event.EventTime)
+	doc.set("message", event.Message)
+	doc.set("ecs.version", ECSVersion)
+
+	doc.set("agent.id", event.AgentID)
+	doc.set("agent.type", "siem-agent")
+	doc.set("organization.id", event.TenantID)
+	doc.set("host.name", event.Computer)
+	doc.set("host.hostname", event.Computer)
+	doc.set("host.fqdn", event.FQDN)
+	doc.set("host.ip", event.IPAddress)
+	doc.set("host.type", event.DeviceClass)
+
+	kind := "event"
+	if event.SourceType == collector.DetectionSourceType {
+		kind = "alert"
+	}
+	doc.set("event.kind", kind)
+	doc.set("event.code", strconv.Itoa(event.EventCode))
+	doc.set("event.provider", event.Provider)
+	doc.set("event.module", strings.ToLower(strings.ReplaceAll(event.SourceType, " ", "_")))
+	doc.set("event.severity", event.Severity)
+	doc.set("event.created", event.CollectedAt)
+	doc.set("event.original", event.RawXML)
+	if categorization, ok := ecsCategories[event.SourceType][event.EventCode]; ok {
+		doc.set("event.category", []string{categorization.category})
+		doc.set("event.type", []string{categorization.kind})
+		doc.set("event.action", categorization.action)
+	}
+	switch {
+	case event.FailureReason != "" || event.EventCode == 4625:
+		doc.set("event.outcome", "failure")
+		doc.set("event.reason", event.FailureReason)
+	case event.EventCode == 4624:
+		doc.set("event.outcome", "success")
+	}
+
+	doc.set("winlog.channel", event.Channel)
+	doc.set("winlog.provider_name", event.Provider)
+	doc.set("winlog.record_id", event.RecordID)
+	doc.set("winlog.computer_name", event.Computer)
+	doc.set("winlog.task", event.TaskCategory)
+	doc.set("winlog.keywords", event.Keywords)
+	doc.set("winlog.event_data", event.EventData)
+	doc.set("winlog.logon.id", event.SubjectLogonID)
+	doc.set("winlog.logon.type", ecsLogonTypes[event.LogonType])
+
+	doc.set("user.name", event.SubjectUser)
+	doc.set("user.domain", event.SubjectDomain)
+	doc.set("user.target.name", event.TargetUser)
+	doc.set("user.target.domain", event.TargetDomain)
+
+	doc.set("process.pid", event.ProcessID)
+	doc.set("process.name", event.ProcessName)
+	doc.set("process.executable", event.ProcessPath)
+	doc.set("process.command_line", event.ProcessCommandLine)
+	doc.set("process.parent.pid", event.ParentProcessID)
+	doc.set("process.parent.executable", event.ParentProcessName)
+
+	doc.set("source.ip", event.SourceIP)
+	doc.set("source.port", event.SourcePort)
+	doc.set("source.domain", event.SourceHostname)
+	doc.set("source.address", event.WorkstationName)
+	doc.set("destination.ip", event.DestinationIP)
+	doc.set("destination.port", event.DestinationPort)
+	doc.set("network.transport", strings.ToLower(event.Protocol))
+	doc.set("dns.question.name", event.EventData["QueryName"])
+
+	doc.set("file.path", event.FilePath)
+	doc.set("file.hash.sha256", strings.ToLower(event.FileHash))
+	doc.set("registry.path", event.RegistryPath)
+	if event.RegistryValue != "" {
+		doc.set("registry.data.strings", []string{event.RegistryValue})
+	}
+
+	doc.set("service.name", event.ServiceName)
+	doc.set("service.type", event.ServiceType)
+
+	if event.Container != nil {
+		doc.set("orchestrator.type", "kubernetes")
+		doc.set("kubernetes.node.name", event.Container.Node)
+		doc.set("kubernetes.namespace", event.Container.Namespace)
+		doc.set("kubernetes.pod.name", event.Container.Pod)
+		doc.set("container.name", event.Container.ContainerName)
+		doc.set("container.id", event.Container.ContainerID)
+	}
+
+	if event.SourceType == collector.DetectionSourceType {
+		doc.set("rule.id", event.EventData["rule_id"])
+		doc.set("rule.name", event.EventData["rule_title"])
+		doc.set("rule.ruleset", event.EventData["ioc_list"])
+	}
+
+	return doc
+}
+
+// MarshalECS serializes an event as an ECS JSON document
+func MarshalECS(event *collector.Event) ([]byte, error) {
+	return json.Marshal(ECS(event))
+}
@@ -0,0 +1,20 @@
+// Package secrets keeps agent credentials in the platform secret store
+// instead of config.yaml: the System keychain on macOS and files encrypted
+// with DPAPI on Windows. Elsewhere every call returns ErrUnsupported.
+package secrets
+
+import "errors"
+
+// Secret names
+const (
+	APIKey          = "api_key"
+	AgentCredential = "agent_credential" // per-agent credential issued at enrollment
+)
+
+var (
+	// ErrNotFound is returned when the secret has not been stored
+	ErrNotFound = errors.New("secret not found")
+
+	// ErrUnsupported is returned on platforms without a secret store
+	ErrUnsupported = errors.New("secret store not supported on this platform")
+)
@@ -0,0 +1,77 @@
+//go:build darwin
+
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	securityTool   = "/usr/bin/security"
+	systemKeychain = "/Library/Keychains/System.keychain"
+
+	// Generic password service the agent's secrets are stored under
+	keychainService = "com.siem.agent"
+
+	// security exits with this status when the item does not exist
+	errSecItemNotFound = 44
+)
+
+// Get reads a secret from the System keychain
+func Get(name string) (string, error) {
+	output, err := exec.Command(securityTool, "find-generic-password",
+		"-s", keychainService, "-a", name, "-w", systemKeychain).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read %s from keychain: %w", name, err)
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// Set stores a secret in the System keychain, replacing any existing
+// value. The command is passed to security on stdin so the secret never
+// appears in a process listing. Interactive mode does not report failures
+// in its exit status, so the value is read back.
+func Set(name, value string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s %s\n",
+		quote(keychainService), quote(name), quote(value), quote(systemKeychain))
+
+	cmd := exec.Command(securityTool, "-i")
+	cmd.Stdin = strings.NewReader(command)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to store %s in keychain: %w", name, err)
+	}
+
+	if stored, err := Get(name); err != nil || stored != value {
+		return fmt.Errorf("failed to store %s in keychain: %s", name, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Delete removes a secret from the System keychain
+func Delete(name string) error {
+	err := exec.Command(securityTool, "delete-generic-password",
+		"-s", keychainService, "-a", name, systemKeychain).Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s from keychain: %w", name, err)
+	}
+	return nil
+}
+
+// quote quotes an argument for security's interactive mode
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !windows
+
+package secrets
+
+// Get returns ErrUnsupported
+func Get(name string) (string, error) {
+	return "", ErrUnsupported
+}
+
+// Set returns ErrUnsupported
+func Set(name, value string) error {
+	return ErrUnsupported
+}
+
+// Delete returns ErrUnsupported
+func Delete(name string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,98 @@
+//go:build windows
+
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Secrets are encrypted with DPAPI under the account the service runs as
+// (LocalSystem), so a copied file cannot be decrypted on another machine or
+// by another account
+var dpapiEntropy = []byte("com.siem.agent")
+
+// secretPath returns the file a secret is stored in
+func secretPath(name string) string {
+	return filepath.Join(os.Getenv("ProgramData"), "SIEM", "secrets", name+".dat")
+}
+
+// Get reads and decrypts a secret
+func Get(name string) (string, error) {
+	data, err := os.ReadFile(secretPath(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	plain, err := dpapi(data, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+// Set encrypts a secret and stores it, replacing any existing value
+func Set(name, value string) error {
+	data, err := dpapi([]byte(value), true)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", name, err)
+	}
+
+	path := secretPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes a secret
+func Delete(name string) error {
+	if err := os.Remove(secretPath(name)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// dpapi encrypts or decrypts data with CryptProtectData/CryptUnprotectData
+func dpapi(data []byte, protect bool) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	entropy := windows.DataBlob{Size: uint32(len(dpapiEntropy)), Data: &dpapiEntropy[0]}
+	var out windows.DataBlob
+
+	var err error
+	if protect {
+		err = windows.CryptProtectData(&in, nil, &entropy, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	} else {
+		err = windows.CryptUnprotectData(&in, nil, &entropy, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	result := make([]byte, out.Size)
+	copy(result, unsafe.Slice(out.Data, out.Size))
+	return result, nil
+}
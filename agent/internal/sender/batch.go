@@ -0,0 +1,99 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+
+	"github.com/siem/agent/internal/collector"
+)
+
+// eventChunk is a JSON array of events that fits in one request
+type eventChunk struct {
+	body   json.RawMessage
+	events []*collector.Event
+}
+
+// splitEvents serializes events with encode into JSON arrays of at most
+// limit bytes (before compression), so proxies that cap the request size
+// accept them.
+// With dropRawXML, RawXML is removed from a batch over the limit before it
+// is split. An event over the limit on its own loses its RawXML in any
+// case, and is skipped if it still does not fit. Skipped events are
+// returned so the caller can release them.
+func splitEvents(events []*collector.Event, limit int, dropRawXML bool, encode func(*collector.Event) ([]byte, error)) (chunks []eventChunk, skipped []*collector.Event) {
+	encoded := make([][]byte, len(events))
+	total := 2 // []
+	for i, event := range events {
+		data, err := encode(event)
+		if err != nil {
+			log.Printf("Failed to serialize event %d from %s: %v", event.EventCode, event.Channel, err)
+			skipped = append(skipped, event)
+			continue
+		}
+		encoded[i] = data
+		total += len(data) + 1
+	}
+
+	if total > limit && dropRawXML {
+		for i, event := range events {
+			if encoded[i] == nil || event.RawXML == "" {
+				continue
+			}
+			event.RawXML = ""
+			data, err := encode(event)
+			if err != nil {
+				log.Printf("Failed to serialize event %d from %s: %v", event.EventCode, event.Channel, err)
+				skipped = append(skipped, event)
+			}
+			encoded[i] = data
+		}
+	}
+
+	var chunk *bytes.Buffer
+	var chunkEvents []*collector.Event
+	flush := func() {
+		if len(chunkEvents) > 0 {
+			chunk.WriteByte(']')
+			chunks = append(chunks, eventChunk{body: chunk.Bytes(), events: chunkEvents})
+		}
+		chunk, chunkEvents = nil, nil
+	}
+
+	for i, data := range encoded {
+		if data == nil {
+			continue
+		}
+
+		if len(data)+2 > limit && events[i].RawXML != "" {
+			events[i].RawXML = ""
+			var err error
+			if data, err = encode(events[i]); err != nil {
+				log.Printf("Failed to serialize event %d from %s: %v", events[i].EventCode, events[i].Channel, err)
+				skipped = append(skipped, events[i])
+				continue
+			}
+		}
+		if len(data)+2 > limit {
+			log.Printf("Warning: Event %d from %s is %d bytes, over max_request_bytes; skipping it",
+				events[i].EventCode, events[i].Channel, len(data))
+			skipped = append(skipped, events[i])
+			continue
+		}
+
+		if len(chunkEvents) > 0 && chunk.Len()+len(data)+2 > limit {
+			flush()
+		}
+		if len(chunkEvents) == 0 {
+			chunk = bytes.NewBuffer(make([]byte, 0, min(limit, total)))
+			chunk.WriteByte('[')
+		} else {
+			chunk.WriteByte(',')
+		}
+		chunk.Write(data)
+		chunkEvents = append(chunkEvents, events[i])
+	}
+	flush()
+
+	return chunks, skipped
+}
@@ -0,0 +1,162 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siem/agent/internal/collector"
+)
+
+// encodeTestEvent serializes an event as {"c":channel,"x":rawXML}, 16 bytes
+// plus the lengths of both. It fails for the channel "bad", and for
+// "xmlonly" once RawXML is dropped.
+func encodeTestEvent(event *collector.Event) ([]byte, error) {
+	if event.Channel == "bad" || (event.Channel == "xmlonly" && event.RawXML == "") {
+		return nil, errors.New("cannot encode")
+	}
+	return []byte(fmt.Sprintf(`{"c":%q,"x":%q}`, event.Channel, event.RawXML)), nil
+}
+
+func TestSplitEvents(t *testing.T) {
+	xml := strings.Repeat("x", 10)
+
+	tests := []struct {
+		name         string
+		events       []*collector.Event
+		limit        int
+		dropRawXML   bool
+		wantCounts   []int
+		wantSkipped  int
+		wantChannels []string
+		wantRawXML   int // events sent with RawXML
+	}{
+		{
+			name:         "one chunk",
+			events:       []*collector.Event{{Channel: "a"}, {Channel: "b"}, {Channel: "c"}},
+			limit:        1000,
+			wantCounts:   []int{3},
+			wantChannels: []string{"a", "b", "c"},
+		},
+		{
+			name:         "split at limit",
+			events:       []*collector.Event{{Channel: "a"}, {Channel: "b"}, {Channel: "c"}},
+			limit:        35, // [ + 2 events + , + ]
+			wantCounts:   []int{2, 1},
+			wantChannels: []string{"a", "b", "c"},
+		},
+		{
+			name:         "raw xml dropped from batch over limit",
+			events:       []*collector.Event{{Channel: "a", RawXML: xml}, {Channel: "b", RawXML: xml}},
+			limit:        40,
+			dropRawXML:   true,
+			wantCounts:   []int{2},
+			wantChannels: []string{"a", "b"},
+		},
+		{
+			name:         "raw xml kept without drop",
+			events:       []*collector.Event{{Channel: "a", RawXML: xml}, {Channel: "b", RawXML: xml}},
+			limit:        40,
+			wantCounts:   []int{1, 1},
+			wantChannels: []string{"a", "b"},
+			wantRawXML:   2,
+		},
+		{
+			name:         "oversize event loses raw xml",
+			events:       []*collector.Event{{Channel: "a", RawXML: strings.Repeat("x", 30)}, {Channel: "b"}},
+			limit:        40,
+			wantCounts:   []int{2},
+			wantChannels: []string{"a", "b"},
+		},
+		{
+			name:         "oversize event skipped",
+			events:       []*collector.Event{{Channel: strings.Repeat("a", 30)}, {Channel: "b"}},
+			limit:        40,
+			wantCounts:   []int{1},
+			wantSkipped:  1,
+			wantChannels: []string{"b"},
+		},
+		{
+			name:         "encode error skipped",
+			events:       []*collector.Event{{Channel: "a"}, {Channel: "bad"}, {Channel: "c"}},
+			limit:        1000,
+			wantCounts:   []int{2},
+			wantSkipped:  1,
+			wantChannels: []string{"a", "c"},
+		},
+		{
+			name:         "encode error after dropping raw xml from batch",
+			events:       []*collector.Event{{Channel: "a", RawXML: xml}, {Channel: "xmlonly", RawXML: xml}},
+			limit:        40,
+			dropRawXML:   true,
+			wantCounts:   []int{1},
+			wantSkipped:  1,
+			wantChannels: []string{"a"},
+		},
+		{
+			name:         "encode error after dropping raw xml from oversize event",
+			events:       []*collector.Event{{Channel: "xmlonly", RawXML: strings.Repeat("x", 30)}, {Channel: "b"}},
+			limit:        40,
+			wantCounts:   []int{1},
+			wantSkipped:  1,
+			wantChannels: []string{"b"},
+		},
+		{
+			name:        "nothing to send",
+			events:      []*collector.Event{{Channel: "bad"}},
+			limit:       1000,
+			wantSkipped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, skipped := splitEvents(tt.events, tt.limit, tt.dropRawXML, encodeTestEvent)
+			if len(skipped) != tt.wantSkipped {
+				t.Errorf("skipped = %d, want %d", len(skipped), tt.wantSkipped)
+			}
+
+			var counts []int
+			var channels []string
+			rawXML := 0
+			for _, chunk := range chunks {
+				if len(chunk.body) > tt.limit {
+					t.Errorf("chunk is %d bytes, over the limit of %d", len(chunk.body), tt.limit)
+				}
+				var decoded []struct {
+					C string `json:"c"`
+					X string `json:"x"`
+				}
+				if err := json.Unmarshal(chunk.body, &decoded); err != nil {
+					t.Fatalf("chunk %s is not a JSON array: %v", chunk.body, err)
+				}
+				if len(decoded) != len(chunk.events) {
+					t.Fatalf("chunk holds %d events, events has %d", len(decoded), len(chunk.events))
+				}
+				counts = append(counts, len(chunk.events))
+				for i, event := range decoded {
+					if event.C != chunk.events[i].Channel {
+						t.Errorf("chunk element %d is %q, events has %q", i, event.C, chunk.events[i].Channel)
+					}
+					channels = append(channels, event.C)
+					if event.X != "" {
+						rawXML++
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(counts, tt.wantCounts) {
+				t.Errorf("chunk counts = %v, want %v", counts, tt.wantCounts)
+			}
+			if !reflect.DeepEqual(channels, tt.wantChannels) {
+				t.Errorf("channels = %v, want %v", channels, tt.wantChannels)
+			}
+			if rawXML != tt.wantRawXML {
+				t.Errorf("%d events sent with RawXML, want %d", rawXML, tt.wantRawXML)
+			}
+		})
+	}
+}
@@ -8,10 +8,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"siem-agent/internal/collector"
-	"siem-agent/internal/config"
+	"github.com/siem/agent/internal/collector"
+	"github.com/siem/agent/internal/config"
+	"github.com/siem/agent/internal/format"
 )
 
 // APIClient handles communication with SIEM backend
@@ -20,6 +24,15 @@ type APIClient struct {
 	httpClient *http.Client
 	baseURL    string
 	apiKey     string
+
+	// Per-agent credential issued at enrollment, see enrollment.go; when
+	// set it replaces the API key
+	credential         atomic.Pointer[AgentCredential]
+	clientCert         atomic.Pointer[tls.Certificate]
+	credentialRejected atomic.Bool
+
+	// Request body compression, see compression.go
+	compression compressionState
 }
 
 // APIResponse represents a generic API response
@@ -32,34 +45,41 @@ type APIResponse struct {
 
 // NewAPIClient creates a new API client
 func NewAPIClient(cfg *config.Config) *APIClient {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.SIEM.InsecureSkipVerify,
+	}
+
 	// Create HTTP client with timeout
 	httpClient := &http.Client{
 		Timeout: time.Duration(cfg.SIEM.SendTimeout) * time.Second,
 		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: cfg.SIEM.InsecureSkipVerify,
-			},
+			TLSClientConfig:     tlsConfig,
 			MaxIdleConns:        100,
 			MaxIdleConnsPerHost: 10,
 			IdleConnTimeout:     90 * time.Second,
 		},
 	}
 
-	return &APIClient{
+	client := &APIClient{
 		config:     cfg,
 		httpClient: httpClient,
-		baseURL:    cfg.SIEM.ServerURL,
+		baseURL:    cfg.SIEM.APIURL,
 		apiKey:     cfg.SIEM.APIKey,
 	}
+	// The certificate from enrollment, presented when the server asks
+	tlsConfig.GetClientCertificate = client.clientCertificate
+	return client
 }
 
-// RegisterAgent registers the agent with SIEM server
-func (c *APIClient) RegisterAgent(data *collector.RegistrationData) error {
+// RegisterAgent registers the agent with SIEM server and returns the
+// agent ID the server assigned, or data.AgentID when it assigned none
+func (c *APIClient) RegisterAgent(data *collector.RegistrationData) (string, error) {
 	url := c.baseURL + "/api/v1/agents/register"
+	data.TenantID = c.TenantID()
 
 	respData, err := c.doRequest("POST", url, data)
 	if err != nil {
-		return fmt.Errorf("registration failed: %w", err)
+		return "", fmt.Errorf("registration failed: %w", err)
 	}
 
 	log.Printf("Agent registered successfully: %s", data.Hostname)
@@ -68,17 +88,19 @@ func (c *APIClient) RegisterAgent(data *collector.RegistrationData) error {
 	if respMap, ok := respData.(map[string]interface{}); ok {
 		if agentID, ok := respMap["agent_id"].(string); ok && agentID != "" {
 			log.Printf("Server assigned Agent ID: %s", agentID)
+			return agentID, nil
 		}
 	}
 
-	return nil
+	return data.AgentID, nil
 }
 
 // SendHeartbeat sends agent heartbeat
 func (c *APIClient) SendHeartbeat(data *collector.HeartbeatData) error {
 	url := c.baseURL + "/api/v1/agents/heartbeat"
+	data.TenantID = c.TenantID()
 
-	_, err := c.doRequest("POST", url, data)
+	_, err := c.doCompressedRequest("POST", url, data)
 	if err != nil {
 		return fmt.Errorf("heartbeat failed: %w", err)
 	}
@@ -86,24 +108,56 @@ func (c *APIClient) SendHeartbeat(data *collector.HeartbeatData) error {
 	return nil
 }
 
-// SendEvents sends a batch of events
-func (c *APIClient) SendEvents(events []*collector.Event) error {
+// SendResult tells what became of the events of a batch
+type SendResult struct {
+	Sent    []*collector.Event // accepted by the server
+	Unsent  []*collector.Event // in requests that failed; to be sent again
+	Skipped []*collector.Event // could not be serialized or are over max_request_bytes
+}
+
+// SendEvents sends a batch of events in requests under MaxRequestBytes.
+// Each request succeeds or fails on its own; the error reports the
+// failed ones, whose events are in the result's Unsent.
+func (c *APIClient) SendEvents(events []*collector.Event) (SendResult, error) {
+	var result SendResult
 	if len(events) == 0 {
-		return nil
+		return result, nil
 	}
 
 	url := c.baseURL + "/api/v1/events/batch"
 
+	// ECS documents are marked so the server stores them as they are
+	encode := func(event *collector.Event) ([]byte, error) { return json.Marshal(event) }
+	if c.config.SIEM.EventFormat == "ecs" {
+		url += "?format=ecs"
+		encode = format.MarshalECS
+	}
+
+	// Requests stay under the proxy size limit
 	startTime := time.Now()
-	_, err := c.doRequest("POST", url, events)
-	if err != nil {
-		return fmt.Errorf("failed to send %d events: %w", len(events), err)
+	chunks, skipped := splitEvents(events, c.config.SIEM.MaxRequestBytes, c.config.SIEM.DropRawXMLOverLimit, encode)
+	result.Skipped = skipped
+
+	failedRequests := 0
+	var lastErr error
+	for _, chunk := range chunks {
+		if _, err := c.doCompressedRequest("POST", url, chunk.body); err != nil {
+			result.Unsent = append(result.Unsent, chunk.events...)
+			failedRequests++
+			lastErr = err
+			continue
+		}
+		result.Sent = append(result.Sent, chunk.events...)
+	}
+	if lastErr != nil {
+		return result, fmt.Errorf("failed to send %d of %d events in %d of %d requests: %w",
+			len(result.Unsent), len(events), failedRequests, len(chunks), lastErr)
 	}
 
 	duration := time.Since(startTime)
-	log.Printf("Sent %d events in %v", len(events), duration)
+	log.Printf("Sent %d events in %d requests in %v", len(result.Sent), len(chunks), duration)
 
-	return nil
+	return result, nil
 }
 
 // SendInventory sends inventory data
@@ -113,9 +167,13 @@ func (c *APIClient) SendInventory(items []*collector.InventoryItem) error {
 	}
 
 	url := c.baseURL + "/api/v1/agents/inventory"
+	tenant := c.TenantID()
+	for _, item := range items {
+		item.TenantID = tenant
+	}
 
 	startTime := time.Now()
-	_, err := c.doRequest("POST", url, items)
+	_, err := c.doCompressedRequest("POST", url, items)
 	if err != nil {
 		return fmt.Errorf("failed to send %d inventory items: %w", len(items), err)
 	}
@@ -126,6 +184,29 @@ func (c *APIClient) SendInventory(items []*collector.InventoryItem) error {
 	return nil
 }
 
+// SendSecurityPosture sends the host security posture
+func (c *APIClient) SendSecurityPosture(data *collector.SecurityPostureData) error {
+	url := c.baseURL + "/api/v1/agents/posture"
+
+	_, err := c.doRequest("POST", url, data)
+	if err != nil {
+		return fmt.Errorf("failed to send security posture: %w", err)
+	}
+
+	return nil
+}
+
+// SendSystemInfo sends refreshed system information after it changed
+func (c *APIClient) SendSystemInfo(data *collector.RegistrationData) error {
+	url := c.baseURL + "/api/v1/agents/sysinfo"
+
+	if _, err := c.doRequest("POST", url, data); err != nil {
+		return fmt.Errorf("failed to send system info: %w", err)
+	}
+
+	return nil
+}
+
 // GetConfig retrieves agent configuration from server (future feature)
 func (c *APIClient) GetConfig(agentID string) (map[string]interface{}, error) {
 	url := c.baseURL + "/api/v1/agents/" + agentID + "/config"
@@ -144,7 +225,19 @@ func (c *APIClient) GetConfig(agentID string) (map[string]interface{}, error) {
 
 // doRequest performs an HTTP request with authentication and error handling
 func (c *APIClient) doRequest(method, url string, data interface{}) (interface{}, error) {
-	var reqBody io.Reader
+	return c.do(method, url, data, false)
+}
+
+// doCompressedRequest performs a request whose body is compressed when
+// Performance.Compression is on and the server accepts it
+func (c *APIClient) doCompressedRequest(method, url string, data interface{}) (interface{}, error) {
+	return c.do(method, url, data, c.config.Performance.Compression && !c.compression.refused.Load())
+}
+
+// do performs a request, optionally with a gzip-compressed body
+func (c *APIClient) do(method, url string, data interface{}, compress bool) (interface{}, error) {
+	var body []byte
+	rawSize, compressed := 0, false
 
 	// Prepare request body
 	if data != nil {
@@ -152,28 +245,22 @@ func (c *APIClient) doRequest(method, url string, data interface{}) (interface{}
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
-	}
-
-	// Create request
-	req, err := http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "SIEM-Agent/1.0")
-
-	// Authentication
-	if c.apiKey != "" {
-		req.Header.Set("X-API-Key", c.apiKey)
+		body, rawSize = jsonData, len(jsonData)
+
+		if compress && len(jsonData) >= minCompressSize {
+			gzipData, err := gzipBody(jsonData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compress request: %w", err)
+			}
+			body, compressed = gzipData, true
+		}
 	}
 
-	// Perform request with retry logic
+	// Perform request with retry logic; the request is rebuilt for each
+	// attempt because sending consumes the body
 	var resp *http.Response
-	maxRetries := c.config.SIEM.RetryAttempts
-	retryDelay := time.Duration(c.config.SIEM.RetryDelay) * time.Second
+	maxRetries := c.config.Advanced.RetryAttempts
+	retryDelay := time.Duration(c.config.Advanced.RetryDelaySeconds) * time.Second
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
@@ -182,6 +269,11 @@ func (c *APIClient) doRequest(method, url string, data interface{}) (interface{}
 			retryDelay *= 2 // Exponential backoff
 		}
 
+		req, err := c.newRequest(method, url, body, compressed)
+		if err != nil {
+			return nil, err
+		}
+
 		resp, err = c.httpClient.Do(req)
 		if err == nil {
 			break
@@ -193,12 +285,26 @@ func (c *APIClient) doRequest(method, url string, data interface{}) (interface{}
 	}
 	defer resp.Body.Close()
 
+	c.compression.negotiate(resp)
+	if compressed && resp.StatusCode == http.StatusUnsupportedMediaType {
+		// The server cannot decode gzip bodies: send this one again as is
+		c.compression.refuse()
+		return c.do(method, url, data, false)
+	}
+	c.compression.record(rawSize, len(body))
+
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	// A rejected credential has been revoked or has expired; only a new
+	// enrollment token brings the agent back
+	if resp.StatusCode == http.StatusUnauthorized && c.credential.Load() != nil && c.credentialRejected.CompareAndSwap(false, true) {
+		log.Printf("Error: Agent credential rejected by the server (revoked or expired); set a new siem.enrollment_token to enroll again")
+	}
+
 	// Check status code
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		// Try to parse error from response
@@ -227,6 +333,87 @@ func (c *APIClient) doRequest(method, url string, data interface{}) (interface{}
 	return apiResp.Data, nil
 }
 
+// newRequest creates a request with the JSON headers and authentication
+func (c *APIClient) newRequest(method, url string, body []byte, compressed bool) (*http.Request, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SIEM-Agent/1.0")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	// Authentication
+	c.authorize(req)
+
+	return req, nil
+}
+
+// authorize adds the agent's tenant and authentication to a request; a
+// certificate credential authenticates the TLS connection and needs no
+// header
+func (c *APIClient) authorize(req *http.Request) {
+	if tenant := c.TenantID(); tenant != "" {
+		req.Header.Set("X-Tenant-ID", tenant)
+	}
+
+	cred := c.credential.Load()
+	switch {
+	case cred != nil && cred.Type == "jwt":
+		req.Header.Set("Authorization", "Bearer "+cred.Token)
+	case cred == nil && c.apiKey != "":
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+}
+
+// Transport returns the transport of HTTP clients built elsewhere (the app
+// store, script execution, TAXII feeds, the watchdog). Requests for the
+// SIEM server get the agent's credential and go over the client's
+// connections; requests for other hosts, such as download mirrors, go
+// through base unchanged, or http.DefaultTransport when base is nil.
+func (c *APIClient) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &serverTransport{client: c, base: base}
+}
+
+// serverTransport authorizes the requests for the SIEM server
+type serverTransport struct {
+	client *APIClient
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.client.isServer(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	t.client.authorize(req)
+	return t.client.httpClient.Transport.RoundTrip(req)
+}
+
+// isServer reports whether a URL is on the SIEM server
+func (c *APIClient) isServer(target *url.URL) bool {
+	server, err := url.Parse(c.baseURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(target.Scheme, server.Scheme) && strings.EqualFold(target.Host, server.Host)
+}
+
 // Ping checks connectivity to SIEM server
 func (c *APIClient) Ping() error {
 	url := c.baseURL + "/api/v1/health"
@@ -294,6 +481,381 @@ func (c *APIClient) CheckSoftwareRequestStatus(requestID string) (*collector.Sof
 	return &request, nil
 }
 
+// UpdateSoftwareRequestComment attaches the user's justification to a pending request
+func (c *APIClient) UpdateSoftwareRequestComment(requestID, comment string) error {
+	url := c.baseURL + "/api/v1/ad/software-requests/" + requestID + "/comment"
+
+	body := map[string]string{"user_comment": comment}
+	if _, err := c.doRequest("POST", url, body); err != nil {
+		return fmt.Errorf("failed to update request comment: %w", err)
+	}
+
+	return nil
+}
+
+// CheckSoftwareReputation queries the SIEM reputation service for an installer
+func (c *APIClient) CheckSoftwareReputation(query *collector.ReputationQuery) (*collector.ReputationVerdict, error) {
+	url := c.baseURL + "/api/v1/ad/software-reputation"
+
+	respData, err := c.doRequest("POST", url, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check reputation: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var verdict collector.ReputationVerdict
+	if err := json.Unmarshal(jsonData, &verdict); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &verdict, nil
+}
+
+// GetSoftwareAllowlist retrieves the approved software list for this agent
+func (c *APIClient) GetSoftwareAllowlist(agentID string) ([]collector.AllowlistEntry, error) {
+	url := c.baseURL + "/api/v1/ad/software-allowlist?agent_id=" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get software allowlist: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var entries []collector.AllowlistEntry
+	if err := json.Unmarshal(jsonData, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetSoftwarePolicies retrieves the per-user/group software policies for this agent
+func (c *APIClient) GetSoftwarePolicies(agentID string) ([]config.SoftwareGroupPolicy, error) {
+	url := c.baseURL + "/api/v1/ad/software-policies?agent_id=" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get software policies: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var policies []config.SoftwareGroupPolicy
+	if err := json.Unmarshal(jsonData, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return policies, nil
+}
+
+// GetSigmaRules retrieves the Sigma rules this agent evaluates, as YAML documents
+func (c *APIClient) GetSigmaRules(agentID string) ([]string, error) {
+	url := c.baseURL + "/api/v1/detection/sigma-rules?agent_id=" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Sigma rules: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var rules []string
+	if err := json.Unmarshal(jsonData, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetIOCSets retrieves the threat-intel indicator digests for this agent
+func (c *APIClient) GetIOCSets(agentID string) (*collector.IOCSet, error) {
+	url := c.baseURL + "/api/v1/detection/iocs?agent_id=" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IOC sets: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var set collector.IOCSet
+	if err := json.Unmarshal(jsonData, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &set, nil
+}
+
+// GetVulnerabilityFeed downloads the advisory feed for this agent
+func (c *APIClient) GetVulnerabilityFeed(agentID string) (*collector.VulnerabilityFeed, error) {
+	url := c.baseURL + "/api/v1/vulnerabilities/feed?agent_id=" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vulnerability feed: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var feed collector.VulnerabilityFeed
+	if err := json.Unmarshal(jsonData, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &feed, nil
+}
+
+// SendDecoyInventory reports the decoy files and credentials planted on the agent
+func (c *APIClient) SendDecoyInventory(inventory *collector.DecoyInventory) error {
+	url := c.baseURL + "/api/v1/detection/decoys"
+
+	if _, err := c.doRequest("POST", url, inventory); err != nil {
+		return fmt.Errorf("failed to send decoy inventory: %w", err)
+	}
+
+	return nil
+}
+
+// GetRequiredSoftware retrieves the software that must stay installed on this agent
+func (c *APIClient) GetRequiredSoftware(agentID string) ([]collector.RequiredSoftware, error) {
+	url := c.baseURL + "/api/v1/ad/required-software?agent_id=" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get required software: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var required []collector.RequiredSoftware
+	if err := json.Unmarshal(jsonData, &required); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return required, nil
+}
+
+// SendSoftwareRemovalAlert reports that required software was uninstalled
+func (c *APIClient) SendSoftwareRemovalAlert(alert *collector.SoftwareRemovalAlert) error {
+	url := c.baseURL + "/api/v1/ad/software-removal-alerts"
+
+	if _, err := c.doRequest("POST", url, alert); err != nil {
+		return fmt.Errorf("failed to send removal alert: %w", err)
+	}
+
+	log.Printf("Software removal alert sent: %s", alert.SoftwareName)
+	return nil
+}
+
+// SendSoftwareLearningReport uploads the installers observed in learning mode
+func (c *APIClient) SendSoftwareLearningReport(report *collector.LearningReport) error {
+	url := c.baseURL + "/api/v1/ad/software-learning"
+
+	if _, err := c.doRequest("POST", url, report); err != nil {
+		return fmt.Errorf("failed to send learning report: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingRemoteSession checks whether an admin has requested a remote session
+func (c *APIClient) GetPendingRemoteSession(agentID string) (*collector.RemoteSessionRequest, error) {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/pending/" + agentID
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending remote session: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var request collector.RemoteSessionRequest
+	if err := json.Unmarshal(jsonData, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &request, nil
+}
+
+// SendRemoteSessionResponse reports the user's answer to a remote session request
+func (c *APIClient) SendRemoteSessionResponse(sessionGUID string, response *collector.RemoteSessionResponse) error {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/user-response"
+
+	if _, err := c.doRequest("POST", url, response); err != nil {
+		return fmt.Errorf("failed to send remote session response: %w", err)
+	}
+
+	log.Printf("Remote session response sent: %s (%s)", sessionGUID, response.Action)
+	return nil
+}
+
+// SendRemoteSessionEnded reports a session the agent terminated itself
+func (c *APIClient) SendRemoteSessionEnded(sessionGUID, reason string) error {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/agent-end"
+
+	body := map[string]string{"reason": reason}
+	if _, err := c.doRequest("POST", url, body); err != nil {
+		return fmt.Errorf("failed to report remote session end: %w", err)
+	}
+
+	return nil
+}
+
+// SendControlResult reports whether the user granted input control to a
+// view-only remote session operator
+func (c *APIClient) SendControlResult(sessionGUID string, granted bool, message string) error {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/control"
+
+	body := map[string]interface{}{
+		"granted": granted,
+		"message": message,
+	}
+	if _, err := c.doRequest("POST", url, body); err != nil {
+		return fmt.Errorf("failed to report control request answer: %w", err)
+	}
+
+	return nil
+}
+
+// SendTerminalOutput uploads a chunk of terminal output to the remote session relay
+func (c *APIClient) SendTerminalOutput(output *collector.TerminalOutput) error {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + output.SessionGUID + "/terminal/output"
+
+	if _, err := c.doRequest("POST", url, output); err != nil {
+		return fmt.Errorf("failed to send terminal output: %w", err)
+	}
+
+	return nil
+}
+
+// GetTerminalInput retrieves the command lines queued on the relay for a terminal session
+func (c *APIClient) GetTerminalInput(sessionGUID string) ([]string, error) {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/terminal/input"
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get terminal input: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var lines []string
+	if err := json.Unmarshal(jsonData, &lines); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return lines, nil
+}
+
+// GetFileTransfers retrieves the file transfers queued by the operator for a session
+func (c *APIClient) GetFileTransfers(sessionGUID string) ([]collector.FileTransferRequest, error) {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/transfers"
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file transfers: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var transfers []collector.FileTransferRequest
+	if err := json.Unmarshal(jsonData, &transfers); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return transfers, nil
+}
+
+// DownloadTransferFile retrieves the content of a file pushed by the operator
+func (c *APIClient) DownloadTransferFile(sessionGUID, transferID string) ([]byte, error) {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/transfers/" + transferID + "/content"
+
+	respData, err := c.doRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var content struct {
+		Data []byte `json:"data"` // base64
+	}
+	if err := json.Unmarshal(jsonData, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return content.Data, nil
+}
+
+// UploadTransferFile sends the content of a file requested by the operator
+func (c *APIClient) UploadTransferFile(sessionGUID, transferID string, data []byte) error {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + sessionGUID + "/transfers/" + transferID + "/content"
+
+	body := map[string][]byte{"data": data}
+	if _, err := c.doRequest("POST", url, body); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+// SendFileTransferResult reports the audit record of a file transfer
+func (c *APIClient) SendFileTransferResult(record *collector.FileTransferRecord) error {
+	url := c.baseURL + "/api/v1/ad/remote-sessions/" + record.SessionGUID + "/transfers/" + record.TransferID + "/result"
+
+	if _, err := c.doRequest("POST", url, record); err != nil {
+		return fmt.Errorf("failed to report file transfer: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the HTTP client
 func (c *APIClient) Close() {
 	c.httpClient.CloseIdleConnections()
@@ -0,0 +1,80 @@
+package sender
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siem/agent/internal/collector"
+	"github.com/siem/agent/internal/config"
+)
+
+// TestSendEventsPerRequest checks that only the events of failed requests
+// are reported unsent
+func TestSendEventsPerRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		channels   []string
+		reject     string // requests containing it fail
+		wantSent   []string
+		wantUnsent []string
+	}{
+		{name: "all accepted", channels: []string{"ok-1", "ok-2", "ok-3"}, wantSent: []string{"ok-1", "ok-2", "ok-3"}},
+		{name: "middle request fails", channels: []string{"ok-1", "bad1", "ok-3"}, reject: "bad", wantSent: []string{"ok-1", "ok-3"}, wantUnsent: []string{"bad1"}},
+		{name: "first requests fail", channels: []string{"bad1", "bad2", "ok-3"}, reject: "bad", wantSent: []string{"ok-3"}, wantUnsent: []string{"bad1", "bad2"}},
+		{name: "all fail", channels: []string{"ok-1", "ok-2"}, reject: "ok", wantUnsent: []string{"ok-1", "ok-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if tt.reject != "" && strings.Contains(string(body), tt.reject) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte(`{"success":true}`))
+			}))
+			defer server.Close()
+
+			events := make([]*collector.Event, len(tt.channels))
+			for i, channel := range tt.channels {
+				events[i] = &collector.Event{Channel: channel}
+			}
+			// One event per request
+			single, _ := json.Marshal(events[0])
+
+			cfg := &config.Config{}
+			cfg.SIEM.APIURL = server.URL
+			cfg.SIEM.SendTimeout = 5
+			cfg.SIEM.MaxRequestBytes = len(single) + 2
+			client := NewAPIClient(cfg)
+
+			result, err := client.SendEvents(events)
+			if (err != nil) != (len(tt.wantUnsent) > 0) {
+				t.Errorf("error = %v with %d events unsent", err, len(tt.wantUnsent))
+			}
+			if got := eventChannels(result.Sent); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent = %v, want %v", got, tt.wantSent)
+			}
+			if got := eventChannels(result.Unsent); !reflect.DeepEqual(got, tt.wantUnsent) {
+				t.Errorf("unsent = %v, want %v", got, tt.wantUnsent)
+			}
+			if len(result.Skipped) != 0 {
+				t.Errorf("%d events skipped", len(result.Skipped))
+			}
+		})
+	}
+}
+
+func eventChannels(events []*collector.Event) []string {
+	var channels []string
+	for _, event := range events {
+		channels = append(channels, event.Channel)
+	}
+	return channels
+}
@@ -0,0 +1,87 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/siem/agent/internal/collector"
+)
+
+// Event, inventory and heartbeat bodies are gzip-compressed when
+// Performance.Compression is set. The server lists the codings it accepts
+// for requests in an Accept-Encoding response header (RFC 7694). A server
+// that cannot decode the body answers 415; the request is then repeated
+// uncompressed and compression stays off until the agent restarts.
+
+// Bodies smaller than this are sent as is: gzip would barely shrink them
+const minCompressSize = 1024
+
+// compressionState tracks the negotiated compression and the bytes saved
+type compressionState struct {
+	refused   atomic.Bool   // the server does not accept gzip bodies
+	rawBytes  atomic.Uint64 // request bodies before compression
+	sentBytes atomic.Uint64 // request bodies as sent
+}
+
+// gzipBody compresses a request body
+func gzipBody(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Grow(len(data) / 4)
+
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// negotiate turns compression off when the server's Accept-Encoding
+// response header leaves out gzip
+func (s *compressionState) negotiate(resp *http.Response) {
+	accepted := resp.Header.Values("Accept-Encoding")
+	if len(accepted) == 0 {
+		return
+	}
+	for _, value := range accepted {
+		for _, coding := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(coding, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				return
+			}
+		}
+	}
+	s.refuse()
+}
+
+// refuse turns compression off for the rest of the run
+func (s *compressionState) refuse() {
+	if !s.refused.Swap(true) {
+		log.Println("Warning: SIEM server does not accept compressed requests, sending them uncompressed")
+	}
+}
+
+// record counts a request body before and after compression
+func (s *compressionState) record(raw, sent int) {
+	s.rawBytes.Add(uint64(raw))
+	s.sentBytes.Add(uint64(sent))
+}
+
+// CompressionStats returns the request compression state and ratio
+func (c *APIClient) CompressionStats() *collector.CompressionStats {
+	stats := &collector.CompressionStats{
+		Enabled:   c.config.Performance.Compression && !c.compression.refused.Load(),
+		BytesRaw:  c.compression.rawBytes.Load(),
+		BytesSent: c.compression.sentBytes.Load(),
+	}
+	if stats.BytesSent > 0 {
+		stats.Ratio = float64(stats.BytesRaw) / float64(stats.BytesSent)
+	}
+	return stats
+}
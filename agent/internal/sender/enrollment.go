@@ -0,0 +1,392 @@
+package sender
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/siem/agent/internal/secrets"
+)
+
+// AgentCredential is the per-agent identity the server issues in exchange
+// for a one-time enrollment token. It replaces the shared API key, so a
+// single agent can be revoked on the server without touching the others.
+type AgentCredential struct {
+	AgentID     string    `json:"agent_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`   // customer the server enrolled the agent for
+	Type        string    `json:"type"`                  // "certificate" or "jwt"
+	Certificate string    `json:"certificate,omitempty"` // PEM client certificate chain
+	PrivateKey  string    `json:"private_key,omitempty"` // PEM key generated on the agent
+	Token       string    `json:"token,omitempty"`       // signed JWT
+	IssuedAt    time.Time `json:"issued_at"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	TokenHash   string    `json:"token_hash"` // SHA-256 of the enrollment token used
+}
+
+// enrollmentRequest is sent to exchange an enrollment token or renew a
+// credential
+type enrollmentRequest struct {
+	EnrollmentToken string `json:"enrollment_token,omitempty"`
+	Hostname        string `json:"hostname"`
+	CredentialType  string `json:"credential_type"`
+	CSR             string `json:"csr,omitempty"` // PEM certificate request, certificate credentials only
+}
+
+// enrollmentResponse is the credential issued by the server
+type enrollmentResponse struct {
+	AgentID     string    `json:"agent_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	Certificate string    `json:"certificate,omitempty"`
+	Token       string    `json:"token,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+}
+
+// EnsureCredential makes sure the client authenticates with a per-agent
+// credential when enrollment is configured. It loads the stored credential,
+// enrolls when there is none or siem.enrollment_token changed, and renews
+// the credential once two thirds of its lifetime have passed. It is called
+// at startup and on every heartbeat, so a failed enrollment is retried.
+// Without an enrollment token or stored credential the API key is used.
+func (c *APIClient) EnsureCredential(hostname string) error {
+	cfg := &c.config.SIEM
+
+	if c.credential.Load() == nil {
+		cred, err := loadAgentCredential(cfg.CredentialFile)
+		if err != nil {
+			log.Printf("Warning: Failed to load agent credential: %v", err)
+		}
+		if cred != nil {
+			if err := c.useCredential(cred); err != nil {
+				log.Printf("Warning: Stored agent credential is unusable: %v", err)
+			}
+		}
+	}
+
+	current := c.credential.Load()
+	token := cfg.EnrollmentToken
+	if token != "" && (current == nil || current.TokenHash != tokenHash(token)) {
+		cred, err := c.enroll(hostname, token)
+		if err != nil {
+			return fmt.Errorf("enrollment failed: %w", err)
+		}
+		log.Printf("Agent enrolled (ID: %s, %s credential); siem.enrollment_token can be removed from config.yaml", cred.AgentID, cred.Type)
+		return nil
+	}
+
+	if current != nil && current.renewalDue() {
+		cred, err := c.renew(hostname, current)
+		if err != nil {
+			return fmt.Errorf("credential renewal failed: %w", err)
+		}
+		log.Printf("Agent credential renewed, valid until %s", cred.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// LoadCredential authenticates with the credential the agent stored, for
+// processes that share the agent's identity (the watchdog). It never
+// enrolls or renews; a credential the agent renewed since the last call is
+// picked up. Without a stored credential the API key is used.
+func (c *APIClient) LoadCredential() error {
+	cred, err := loadAgentCredential(c.config.SIEM.CredentialFile)
+	if err != nil {
+		return fmt.Errorf("failed to load agent credential: %w", err)
+	}
+	if cred == nil {
+		if c.credential.Load() != nil {
+			c.clearCredential()
+		}
+		return nil
+	}
+	if current := c.credential.Load(); current != nil && current.IssuedAt.Equal(cred.IssuedAt) {
+		return nil
+	}
+	return c.useCredential(cred)
+}
+
+// enroll exchanges the enrollment token for a credential. The request is
+// authenticated by the token alone; a previous credential may be revoked.
+func (c *APIClient) enroll(hostname, token string) (*AgentCredential, error) {
+	url := c.baseURL + "/api/v1/agents/enroll"
+
+	c.clearCredential()
+
+	request := &enrollmentRequest{
+		EnrollmentToken: token,
+		Hostname:        hostname,
+		CredentialType:  c.config.SIEM.CredentialType,
+	}
+	return c.requestCredential(url, request, tokenHash(token))
+}
+
+// renew replaces the current credential before it expires, authenticated
+// by the current credential
+func (c *APIClient) renew(hostname string, current *AgentCredential) (*AgentCredential, error) {
+	url := c.baseURL + "/api/v1/agents/credential/renew"
+
+	request := &enrollmentRequest{
+		Hostname:       hostname,
+		CredentialType: current.Type,
+	}
+	return c.requestCredential(url, request, current.TokenHash)
+}
+
+// requestCredential generates a key and certificate request if needed,
+// sends the request and stores and uses the issued credential
+func (c *APIClient) requestCredential(url string, request *enrollmentRequest, hash string) (*AgentCredential, error) {
+	var keyPEM string
+	if request.CredentialType == "certificate" {
+		key, csr, err := newCertificateRequest(request.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, request.CSR = key, csr
+	}
+
+	respData, err := c.doRequest("POST", url, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	jsonData, err := json.Marshal(respData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	var resp enrollmentResponse
+	if err := json.Unmarshal(jsonData, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	cred := &AgentCredential{
+		AgentID:   resp.AgentID,
+		TenantID:  resp.TenantID,
+		Type:      request.CredentialType,
+		IssuedAt:  time.Now(),
+		ExpiresAt: resp.ExpiresAt,
+		TokenHash: hash,
+	}
+	switch cred.Type {
+	case "certificate":
+		if resp.Certificate == "" {
+			return nil, fmt.Errorf("server issued no certificate")
+		}
+		cred.Certificate, cred.PrivateKey = resp.Certificate, keyPEM
+	case "jwt":
+		if resp.Token == "" {
+			return nil, fmt.Errorf("server issued no token")
+		}
+		cred.Token = resp.Token
+		if cred.ExpiresAt.IsZero() {
+			cred.ExpiresAt = jwtExpiry(resp.Token)
+		}
+	}
+
+	if configured := c.config.Agent.TenantID; cred.TenantID != "" && configured != "" && cred.TenantID != configured {
+		log.Printf("Warning: Enrolled for tenant %s, not agent.tenant_id %s; using %s", cred.TenantID, configured, cred.TenantID)
+	}
+
+	if err := c.useCredential(cred); err != nil {
+		return nil, err
+	}
+	if err := storeAgentCredential(cred, c.config.SIEM.CredentialFile); err != nil {
+		// Usable for this run; the agent enrolls again after a restart
+		log.Printf("Warning: Failed to store agent credential: %v", err)
+	}
+	return cred, nil
+}
+
+// useCredential authenticates all further requests with the credential:
+// a client certificate on the TLS connection, or a bearer token
+func (c *APIClient) useCredential(cred *AgentCredential) error {
+	var cert *tls.Certificate
+	if cred.Type == "certificate" {
+		pair, err := tls.X509KeyPair([]byte(cred.Certificate), []byte(cred.PrivateKey))
+		if err != nil {
+			return fmt.Errorf("invalid client certificate: %w", err)
+		}
+		if cred.ExpiresAt.IsZero() {
+			if leaf, err := x509.ParseCertificate(pair.Certificate[0]); err == nil {
+				cred.ExpiresAt = leaf.NotAfter
+			}
+		}
+		cert = &pair
+	}
+
+	c.clientCert.Store(cert)
+	c.credential.Store(cred)
+	c.credentialRejected.Store(false)
+	c.closeIdleConnections()
+	return nil
+}
+
+// clearCredential stops using the current credential
+func (c *APIClient) clearCredential() {
+	c.clientCert.Store(nil)
+	c.credential.Store(nil)
+	c.closeIdleConnections()
+}
+
+// clientCertificate presents the agent's certificate when the server asks
+// for one; without a certificate credential none is sent
+func (c *APIClient) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := c.clientCert.Load(); cert != nil {
+		return cert, nil
+	}
+	return &tls.Certificate{}, nil
+}
+
+// closeIdleConnections drops connections authenticated with a previous
+// certificate
+func (c *APIClient) closeIdleConnections() {
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// AgentID returns the agent ID the server issued at enrollment, or "" when
+// the agent authenticates with the API key
+func (c *APIClient) AgentID() string {
+	if cred := c.credential.Load(); cred != nil {
+		return cred.AgentID
+	}
+	return ""
+}
+
+// TenantID returns the customer the agent belongs to: the tenant the server
+// enrolled it for, or agent.tenant_id. Empty on single-tenant servers.
+func (c *APIClient) TenantID() string {
+	if cred := c.credential.Load(); cred != nil && cred.TenantID != "" {
+		return cred.TenantID
+	}
+	return c.config.Agent.TenantID
+}
+
+// renewalDue reports whether two thirds of the credential's lifetime have
+// passed
+func (cred *AgentCredential) renewalDue() bool {
+	if cred.ExpiresAt.IsZero() || cred.IssuedAt.IsZero() {
+		return false
+	}
+	lifetime := cred.ExpiresAt.Sub(cred.IssuedAt)
+	return time.Now().After(cred.IssuedAt.Add(lifetime * 2 / 3))
+}
+
+// newCertificateRequest generates a P-256 key and a certificate request
+// for it with the hostname as common name; the key never leaves the agent
+func newCertificateRequest(hostname string) (keyPEM, csrPEM string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: hostname},
+		DNSNames: []string{hostname},
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	csrPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	return keyPEM, csrPEM, nil
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it; the server
+// verifies the token, the agent only needs to know when to renew it
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// tokenHash identifies an enrollment token without storing it
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadAgentCredential reads the credential from the platform secret store,
+// or from the credential file where there is none. It returns nil when no
+// credential has been stored.
+func loadAgentCredential(path string) (*AgentCredential, error) {
+	data, err := secrets.Get(secrets.AgentCredential)
+	switch {
+	case errors.Is(err, secrets.ErrNotFound):
+		return nil, nil
+	case errors.Is(err, secrets.ErrUnsupported):
+		raw, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = string(raw)
+	case err != nil:
+		return nil, err
+	}
+
+	var cred AgentCredential
+	if err := json.Unmarshal([]byte(data), &cred); err != nil {
+		return nil, fmt.Errorf("failed to parse agent credential: %w", err)
+	}
+	return &cred, nil
+}
+
+// storeAgentCredential keeps the credential in the platform secret store
+// (DPAPI on Windows, the System keychain on macOS), or in a file only root
+// can read where there is none
+func storeAgentCredential(cred *AgentCredential, path string) error {
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+
+	err = secrets.Set(secrets.AgentCredential, string(data))
+	if !errors.Is(err, secrets.ErrUnsupported) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,151 @@
+package sender
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siem/agent/internal/collector"
+	"github.com/siem/agent/internal/config"
+	"github.com/siem/agent/internal/format"
+)
+
+// Syslog severities by event severity 1-5: informational, notice,
+// warning, error, critical
+var syslogSeverity = [...]int{6, 6, 5, 4, 3, 2}
+
+// SyslogForwarder sends events as CEF or LEEF over syslog (RFC 5424), for
+// sites whose SIEM or log broker ingests syslog. It is an additional
+// output: the SIEM server still receives every event.
+type SyslogForwarder struct {
+	config   *config.SyslogOutputConfig
+	hostname string
+	version  string
+	render   func(event *collector.Event, version string) string
+
+	mutex sync.Mutex
+	conn  net.Conn // nil until the first forward and after a write error
+}
+
+// NewSyslogForwarder creates the forwarder; it connects on first use
+func NewSyslogForwarder(cfg *config.SyslogOutputConfig, hostname, version string) *SyslogForwarder {
+	f := &SyslogForwarder{
+		config:   cfg,
+		hostname: hostname,
+		version:  version,
+		render:   format.CEF,
+	}
+	if cfg.Format == "leef" {
+		f.render = format.LEEF
+	}
+	return f
+}
+
+// Forward sends the events. A broken connection is reopened once; events
+// that still cannot be sent are reported in the error and not retried.
+func (f *SyslogForwarder) Forward(events []*collector.Event) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	failed := 0
+	var lastErr error
+	for _, event := range events {
+		message := f.message(event)
+		if err := f.write(message); err != nil {
+			f.close()
+			if err = f.write(message); err != nil {
+				f.close()
+				failed++
+				lastErr = err
+			}
+		}
+	}
+
+	if lastErr != nil {
+		return fmt.Errorf("failed to forward %d of %d events to syslog: %w", failed, len(events), lastErr)
+	}
+	return nil
+}
+
+// message formats an event as an RFC 5424 syslog message
+func (f *SyslogForwarder) message(event *collector.Event) []byte {
+	priority := f.config.Facility*8 + syslogSeverity[max(0, min(event.Severity, 5))]
+
+	host := event.Computer
+	if host == "" {
+		host = f.hostname
+	}
+	timestamp := event.EventTime
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	// The tenant goes in structured data, outside the CEF/LEEF payload
+	structured := "-"
+	if event.TenantID != "" {
+		structured = fmt.Sprintf(`[siem@32473 tenant="%s"]`, sdEscape(event.TenantID))
+	}
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s siem-agent - %s %s %s",
+		priority, timestamp.UTC().Format("2006-01-02T15:04:05.000Z"), host,
+		strconv.Itoa(event.EventCode), structured, f.render(event, f.version)))
+}
+
+// sdEscape escapes a structured data parameter value (RFC 5424 6.3.3)
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// write sends one message, connecting first if needed. Stream transports
+// use octet-counting framing (RFC 6587), so messages may contain newlines.
+func (f *SyslogForwarder) write(message []byte) error {
+	if f.conn == nil {
+		conn, err := f.dial()
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+
+	if f.config.Protocol != "udp" {
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+
+	f.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := f.conn.Write(message)
+	return err
+}
+
+// dial connects to the syslog receiver
+func (f *SyslogForwarder) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch f.config.Protocol {
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", f.config.Address, &tls.Config{
+			InsecureSkipVerify: f.config.InsecureSkipVerify,
+		})
+	case "tcp":
+		return dialer.Dial("tcp", f.config.Address)
+	default:
+		return dialer.Dial("udp", f.config.Address)
+	}
+}
+
+// close drops the connection so the next write reconnects
+func (f *SyslogForwarder) close() {
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+}
+
+// Close closes the connection to the receiver
+func (f *SyslogForwarder) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.close()
+}
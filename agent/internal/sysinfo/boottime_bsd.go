@@ -0,0 +1,24 @@
+//go:build !windows && !linux
+
+package sysinfo
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// GetBootTime returns when the host last booted, to the second, or the
+// zero time if it cannot be determined
+func GetBootTime() time.Time {
+	// "{ sec = <seconds>, usec = <microseconds> } <date>"
+	output, err := exec.Command("sysctl", "-n", "kern.boottime").Output()
+	if err != nil {
+		return time.Time{}
+	}
+	var seconds int64
+	if _, err := fmt.Sscanf(string(output), "{ sec = %d,", &seconds); err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
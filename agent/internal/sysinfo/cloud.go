@@ -0,0 +1,229 @@
+package sysinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata services answer within milliseconds on a cloud VM; on any other
+// host the link-local address is unreachable, so keep the probe short
+const cloudProbeTimeout = 1500 * time.Millisecond
+
+// CloudInstance describes the cloud VM the agent runs on
+type CloudInstance struct {
+	Provider   string            `json:"provider"` // "aws", "azure" or "gcp"
+	InstanceID string            `json:"instance_id"`
+	Region     string            `json:"region,omitempty"`
+	Zone       string            `json:"zone,omitempty"`
+	VMSize     string            `json:"vm_size,omitempty"`
+	AccountID  string            `json:"account_id,omitempty"` // AWS account, Azure subscription, GCP project
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+var (
+	cloudOnce     sync.Once
+	cloudInstance *CloudInstance
+)
+
+// DetectCloud returns the cloud instance the agent runs on, or nil outside
+// the cloud. The metadata services are probed once per process: Gather runs
+// on every heartbeat and an instance does not change clouds while running.
+func DetectCloud() *CloudInstance {
+	cloudOnce.Do(func() {
+		cloudInstance = probeCloud()
+	})
+	return cloudInstance
+}
+
+// probeCloud probes the AWS, Azure and GCP metadata services in parallel
+func probeCloud() *CloudInstance {
+	client := &http.Client{
+		Timeout: cloudProbeTimeout,
+		Transport: &http.Transport{
+			Proxy: nil, // metadata services must never be reached through a proxy
+		},
+	}
+
+	probes := []func(*http.Client) (*CloudInstance, error){detectAWS, detectAzure, detectGCP}
+	results := make(chan *CloudInstance, len(probes))
+	for _, probe := range probes {
+		go func(probe func(*http.Client) (*CloudInstance, error)) {
+			instance, _ := probe(client)
+			results <- instance
+		}(probe)
+	}
+
+	var found *CloudInstance
+	for range probes {
+		if instance := <-results; instance != nil && found == nil {
+			found = instance
+		}
+	}
+	return found
+}
+
+// detectAWS reads the EC2 instance identity document using an IMDSv2 token
+func detectAWS(client *http.Client) (*CloudInstance, error) {
+	req, _ := http.NewRequest(http.MethodPut, "http://169.254.169.254/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := metadataGet(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, _ := http.NewRequest(http.MethodGet, "http://169.254.169.254/latest/"+path, nil)
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return metadataGet(client, req)
+	}
+
+	body, err := get("dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		AccountID        string `json:"accountId"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || doc.InstanceID == "" {
+		return nil, fmt.Errorf("invalid EC2 identity document")
+	}
+
+	instance := &CloudInstance{
+		Provider:   "aws",
+		InstanceID: doc.InstanceID,
+		Region:     doc.Region,
+		Zone:       doc.AvailabilityZone,
+		VMSize:     doc.InstanceType,
+		AccountID:  doc.AccountID,
+	}
+
+	// Tags are only exposed when "instance metadata tags" is enabled
+	if keys, err := get("meta-data/tags/instance"); err == nil {
+		instance.Tags = make(map[string]string)
+		for _, key := range strings.Fields(string(keys)) {
+			if value, err := get("meta-data/tags/instance/" + key); err == nil {
+				instance.Tags[key] = string(value)
+			}
+		}
+	}
+
+	return instance, nil
+}
+
+// detectAzure reads the Azure Instance Metadata Service compute section
+func detectAzure(client *http.Client) (*CloudInstance, error) {
+	req, _ := http.NewRequest(http.MethodGet, "http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01", nil)
+	req.Header.Set("Metadata", "true")
+	body, err := metadataGet(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var compute struct {
+		VMID           string `json:"vmId"`
+		Location       string `json:"location"`
+		Zone           string `json:"zone"`
+		VMSize         string `json:"vmSize"`
+		SubscriptionID string `json:"subscriptionId"`
+		TagsList       []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"tagsList"`
+	}
+	if err := json.Unmarshal(body, &compute); err != nil || compute.VMID == "" {
+		return nil, fmt.Errorf("invalid Azure instance metadata")
+	}
+
+	instance := &CloudInstance{
+		Provider:   "azure",
+		InstanceID: compute.VMID,
+		Region:     compute.Location,
+		Zone:       compute.Zone,
+		VMSize:     compute.VMSize,
+		AccountID:  compute.SubscriptionID,
+	}
+	if len(compute.TagsList) > 0 {
+		instance.Tags = make(map[string]string, len(compute.TagsList))
+		for _, tag := range compute.TagsList {
+			instance.Tags[tag.Name] = tag.Value
+		}
+	}
+
+	return instance, nil
+}
+
+// detectGCP reads the Compute Engine instance metadata. GCE has no
+// metadata endpoint for labels, so network tags are reported as tags.
+func detectGCP(client *http.Client) (*CloudInstance, error) {
+	req, _ := http.NewRequest(http.MethodGet, "http://169.254.169.254/computeMetadata/v1/?recursive=true", nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, err := metadataGet(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata struct {
+		Instance struct {
+			ID          json.Number `json:"id"`
+			Zone        string      `json:"zone"`        // projects/<number>/zones/<zone>
+			MachineType string      `json:"machineType"` // projects/<number>/machineTypes/<type>
+			Tags        []string    `json:"tags"`
+		} `json:"instance"`
+		Project struct {
+			ProjectID string `json:"projectId"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &metadata); err != nil || metadata.Instance.ID == "" {
+		return nil, fmt.Errorf("invalid GCE instance metadata")
+	}
+
+	zone := lastPathElement(metadata.Instance.Zone)
+	instance := &CloudInstance{
+		Provider:   "gcp",
+		InstanceID: metadata.Instance.ID.String(),
+		Zone:       zone,
+		VMSize:     lastPathElement(metadata.Instance.MachineType),
+		AccountID:  metadata.Project.ProjectID,
+	}
+	// Region is the zone without its suffix: us-central1-a -> us-central1
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		instance.Region = zone[:i]
+	}
+	if len(metadata.Instance.Tags) > 0 {
+		instance.Tags = make(map[string]string, len(metadata.Instance.Tags))
+		for _, tag := range metadata.Instance.Tags {
+			instance.Tags[tag] = ""
+		}
+	}
+
+	return instance, nil
+}
+
+// metadataGet performs a metadata request and returns the body of a 200 response
+func metadataGet(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// lastPathElement returns the part of s after its last slash
+func lastPathElement(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
@@ -0,0 +1,49 @@
+package sysinfo
+
+// Device classes let the server apply policies (remote session consent,
+// inventory frequency) per kind of machine without manual tagging
+const (
+	DeviceClassLaptop  = "laptop"
+	DeviceClassDesktop = "desktop"
+	DeviceClassServer  = "server"
+	DeviceClassVDI     = "vdi"
+)
+
+// portableChassis and serverChassis group the SMBIOS chassis types
+var (
+	portableChassis = map[string]bool{
+		"Portable": true, "Laptop": true, "Notebook": true, "Sub Notebook": true,
+		"Hand Held": true, "Tablet": true, "Convertible": true, "Detachable": true,
+	}
+	serverChassis = map[string]bool{
+		"Main Server Chassis": true, "Rack Mount Chassis": true, "Multi-system Chassis": true,
+		"Blade": true, "Blade Enclosure": true,
+	}
+)
+
+// deviceClass classifies a machine. A server OS wins over the hardware, a
+// workstation OS on a hypervisor is a VDI desktop, and otherwise the
+// chassis type decides, with a system battery marking laptops whose
+// firmware reports a generic chassis.
+func deviceClass(chassisType string, hasBattery, serverOS, virtual bool) string {
+	switch {
+	case serverOS:
+		return DeviceClassServer
+	case virtual:
+		return DeviceClassVDI
+	case portableChassis[chassisType] || hasBattery:
+		return DeviceClassLaptop
+	case serverChassis[chassisType]:
+		return DeviceClassServer
+	}
+	return DeviceClassDesktop
+}
+
+// GetDeviceClass returns "laptop", "desktop", "server" or "vdi"
+func GetDeviceClass() string {
+	var chassisType string
+	if smbios := getSMBIOS(); smbios != nil {
+		chassisType = smbios.ChassisType
+	}
+	return deviceClass(chassisType, hasSystemBattery(), isServerOS(), getVirtualization().Hypervisor != "")
+}
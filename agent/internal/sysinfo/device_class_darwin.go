@@ -0,0 +1,19 @@
+//go:build darwin
+
+package sysinfo
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// hasSystemBattery reports whether the Mac has an internal battery
+func hasSystemBattery() bool {
+	output, err := exec.Command("pmset", "-g", "batt").Output()
+	return err == nil && strings.Contains(string(output), "InternalBattery")
+}
+
+// isServerOS returns false: macOS has no server edition
+func isServerOS() bool {
+	return false
+}
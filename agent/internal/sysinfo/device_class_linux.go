@@ -0,0 +1,35 @@
+//go:build linux
+
+package sysinfo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hasSystemBattery reports whether a power supply of type Battery powers
+// the system (peripheral batteries have scope Device)
+func hasSystemBattery() bool {
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	for _, supply := range supplies {
+		kind, _ := os.ReadFile(filepath.Join(supply, "type"))
+		scope, _ := os.ReadFile(filepath.Join(supply, "scope"))
+		if strings.TrimSpace(string(kind)) == "Battery" && strings.TrimSpace(string(scope)) != "Device" {
+			return true
+		}
+	}
+	return false
+}
+
+// isServerOS reports whether the host boots without a desktop: Linux has
+// no server editions, so a default systemd target other than
+// graphical.target counts as one
+func isServerOS() bool {
+	for _, path := range []string{"/etc/systemd/system/default.target", "/lib/systemd/system/default.target", "/usr/lib/systemd/system/default.target"} {
+		if target, err := os.Readlink(path); err == nil {
+			return filepath.Base(target) != "graphical.target"
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !linux && !darwin
+
+package sysinfo
+
+// hasSystemBattery returns false: batteries are not detected on this
+// platform
+func hasSystemBattery() bool {
+	return false
+}
+
+// isServerOS returns false: the edition is not detected on this platform
+func isServerOS() bool {
+	return false
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package sysinfo
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetSystemPowerStatus = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// systemPowerStatus is SYSTEM_POWER_STATUS
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte // 128 = no system battery, 255 = unknown
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// hasSystemBattery reports whether the machine has a system battery
+func hasSystemBattery() bool {
+	var status systemPowerStatus
+	ret, _, _ := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status)))
+	return ret != 0 && status.BatteryFlag != 128 && status.BatteryFlag != 255
+}
+
+// isServerOS reports whether Windows is a server or domain controller edition
+func isServerOS() bool {
+	return windows.RtlGetVersion().ProductType != 1 // VER_NT_WORKSTATION
+}
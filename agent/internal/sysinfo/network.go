@@ -0,0 +1,25 @@
+package sysinfo
+
+import "net"
+
+// NetworkAdapter describes one network interface that is up
+type NetworkAdapter struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	MACAddress  string   `json:"mac_address,omitempty"`
+	IPAddresses []string `json:"ip_addresses"` // IPv4 and IPv6
+	Gateways    []string `json:"gateways,omitempty"`
+	DNSServers  []string `json:"dns_servers,omitempty"`
+	DHCP        bool     `json:"dhcp"`
+	Primary     bool     `json:"primary"`
+}
+
+// primaryIPv4 returns the first IPv4 address of an adapter
+func primaryIPv4(adapter NetworkAdapter) string {
+	for _, addr := range adapter.IPAddresses {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil && !ip.IsLinkLocalUnicast() {
+			return addr
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package sysinfo
+
+import "net"
+
+// interfaceAdapters lists the interfaces that are up, excluding loopback,
+// and marks primary (the default route's interface) as the primary one.
+// Without a default route the first interface with an IPv4 address is
+// primary.
+func interfaceAdapters(primary string) []NetworkAdapter {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var adapters []NetworkAdapter
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+
+		adapter := NetworkAdapter{
+			Name:       iface.Name,
+			MACAddress: iface.HardwareAddr.String(),
+			Primary:    iface.Name == primary,
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				adapter.IPAddresses = append(adapter.IPAddresses, ipNet.IP.String())
+			}
+		}
+		adapters = append(adapters, adapter)
+	}
+
+	for _, adapter := range adapters {
+		if adapter.Primary {
+			return adapters
+		}
+	}
+	for i := range adapters {
+		if primaryIPv4(adapters[i]) != "" {
+			adapters[i].Primary = true
+			break
+		}
+	}
+	return adapters
+}
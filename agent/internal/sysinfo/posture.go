@@ -0,0 +1,14 @@
+package sysinfo
+
+// SecurityPosture holds the platform security features the server scores
+// hosts on. "configured" means enabled in the registry or by policy but not
+// confirmed running (for example pending a reboot).
+type SecurityPosture struct {
+	TPMPresent      bool   `json:"tpm_present"`
+	TPMVersion      string `json:"tpm_version,omitempty"` // "1.2" or "2.0"
+	SecureBoot      string `json:"secure_boot"`           // "on", "off" or "unsupported" (legacy BIOS)
+	LSAProtection   bool   `json:"lsa_protection"`        // LSASS runs as a protected process (RunAsPPL)
+	CredentialGuard string `json:"credential_guard"`      // "running", "configured" or "off"
+	VBS             string `json:"vbs"`                   // virtualization-based security: "running", "configured" or "off"
+	HVCI            bool   `json:"hvci"`                  // hypervisor-enforced code integrity (memory integrity) enabled
+}
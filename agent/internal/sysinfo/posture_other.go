@@ -0,0 +1,9 @@
+//go:build !windows
+
+package sysinfo
+
+// GetSecurityPosture returns nil: TPM, Secure Boot and VBS state are only
+// read on Windows
+func GetSecurityPosture() *SecurityPosture {
+	return nil
+}
@@ -0,0 +1,143 @@
+//go:build windows
+
+package sysinfo
+
+import (
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var procTbsiGetDeviceInfo = windows.NewLazySystemDLL("tbs.dll").NewProc("Tbsi_GetDeviceInfo")
+
+// tpmDeviceInfo is TPM_DEVICE_INFO from tbs.h
+type tpmDeviceInfo struct {
+	StructVersion    uint32
+	TPMVersion       uint32 // 1 = TPM 1.2, 2 = TPM 2.0
+	TPMInterfaceType uint32
+	TPMImpRevision   uint32
+}
+
+const (
+	deviceGuardKey       = `SYSTEM\CurrentControlSet\Control\DeviceGuard`
+	deviceGuardPolicyKey = `SOFTWARE\Policies\Microsoft\Windows\DeviceGuard`
+	lsaKey               = `SYSTEM\CurrentControlSet\Control\Lsa`
+)
+
+// GetSecurityPosture reads the TPM, Secure Boot, LSA protection, Credential
+// Guard and VBS state. Running state is taken from the processes VBS starts
+// ("Secure System" for the secure kernel, LsaIso.exe for Credential Guard),
+// configured state from the registry and Group Policy.
+func GetSecurityPosture() *SecurityPosture {
+	posture := &SecurityPosture{
+		SecureBoot:      getSecureBoot(),
+		CredentialGuard: "off",
+		VBS:             "off",
+	}
+
+	posture.TPMPresent, posture.TPMVersion = getTPM()
+
+	ppl := registryDWORD(lsaKey, "RunAsPPL")
+	posture.LSAProtection = ppl == 1 || ppl == 2
+
+	processes := runningProcessNames()
+
+	if registryDWORD(deviceGuardKey, "EnableVirtualizationBasedSecurity") == 1 ||
+		registryDWORD(deviceGuardPolicyKey, "EnableVirtualizationBasedSecurity") == 1 {
+		posture.VBS = "configured"
+	}
+	if processes["secure system"] {
+		posture.VBS = "running"
+	}
+
+	lsaCfg := registryDWORD(lsaKey, "LsaCfgFlags")
+	policyCfg := registryDWORD(deviceGuardPolicyKey, "LsaCfgFlags")
+	if lsaCfg == 1 || lsaCfg == 2 || policyCfg == 1 || policyCfg == 2 {
+		posture.CredentialGuard = "configured"
+	}
+	if processes["lsaiso.exe"] {
+		posture.CredentialGuard = "running"
+	}
+
+	hvciPolicy := registryDWORD(deviceGuardPolicyKey, "HypervisorEnforcedCodeIntegrity")
+	posture.HVCI = registryDWORD(deviceGuardKey+`\Scenarios\HypervisorEnforcedCodeIntegrity`, "Enabled") == 1 ||
+		hvciPolicy == 1 || hvciPolicy == 2
+
+	return posture
+}
+
+// getTPM asks TPM Base Services for the TPM version
+func getTPM() (bool, string) {
+	if procTbsiGetDeviceInfo.Find() != nil {
+		return false, ""
+	}
+
+	var info tpmDeviceInfo
+	ret, _, _ := procTbsiGetDeviceInfo.Call(unsafe.Sizeof(info), uintptr(unsafe.Pointer(&info)))
+	if ret != 0 { // TBS_E_TPM_NOT_FOUND and friends
+		return false, ""
+	}
+
+	switch info.TPMVersion {
+	case 1:
+		return true, "1.2"
+	case 2:
+		return true, "2.0"
+	}
+	return true, ""
+}
+
+// getSecureBoot reads the UEFI Secure Boot state. The State key only
+// exists on UEFI systems.
+func getSecureBoot() string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\SecureBoot\State`, registry.QUERY_VALUE)
+	if err != nil {
+		return "unsupported"
+	}
+	defer k.Close()
+
+	enabled, _, err := k.GetIntegerValue("UEFISecureBootEnabled")
+	if err != nil {
+		return "unsupported"
+	}
+	if enabled == 1 {
+		return "on"
+	}
+	return "off"
+}
+
+// registryDWORD reads a DWORD under HKLM, returning 0 when it is missing
+func registryDWORD(path, name string) uint64 {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return 0
+	}
+	defer k.Close()
+
+	value, _, err := k.GetIntegerValue(name)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// runningProcessNames returns the lowercased image names of all processes
+func runningProcessNames() map[string]bool {
+	names := make(map[string]bool)
+
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return names
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		names[strings.ToLower(windows.UTF16ToString(entry.ExeFile[:]))] = true
+	}
+
+	return names
+}
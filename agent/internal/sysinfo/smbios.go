@@ -0,0 +1,163 @@
+package sysinfo
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// smbiosInfo holds the asset fields read from the SMBIOS tables, the same
+// data WMI exposes through Win32_ComputerSystem, Win32_BIOS and
+// Win32_SystemEnclosure
+type smbiosInfo struct {
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	BIOSVersion  string
+	ChassisType  string
+}
+
+// SMBIOS structure types
+const (
+	smbiosTypeBIOS    = 0
+	smbiosTypeSystem  = 1
+	smbiosTypeChassis = 3
+	smbiosTypeEnd     = 127
+)
+
+// chassisTypes names the SMBIOS System Enclosure types (DSP0134 7.4.1)
+var chassisTypes = map[byte]string{
+	1:  "Other",
+	2:  "Unknown",
+	3:  "Desktop",
+	4:  "Low Profile Desktop",
+	5:  "Pizza Box",
+	6:  "Mini Tower",
+	7:  "Tower",
+	8:  "Portable",
+	9:  "Laptop",
+	10: "Notebook",
+	11: "Hand Held",
+	12: "Docking Station",
+	13: "All in One",
+	14: "Sub Notebook",
+	15: "Space-saving",
+	16: "Lunch Box",
+	17: "Main Server Chassis",
+	18: "Expansion Chassis",
+	19: "SubChassis",
+	20: "Bus Expansion Chassis",
+	21: "Peripheral Chassis",
+	22: "RAID Chassis",
+	23: "Rack Mount Chassis",
+	24: "Sealed-case PC",
+	25: "Multi-system Chassis",
+	26: "Compact PCI",
+	27: "Advanced TCA",
+	28: "Blade",
+	29: "Blade Enclosure",
+	30: "Tablet",
+	31: "Convertible",
+	32: "Detachable",
+	33: "IoT Gateway",
+	34: "Embedded PC",
+	35: "Mini PC",
+	36: "Stick PC",
+}
+
+// placeholderSerials are vendor defaults that identify nothing
+var placeholderSerials = []string{
+	"to be filled by o.e.m.",
+	"default string",
+	"system serial number",
+	"chassis serial number",
+	"not specified",
+	"none",
+	"0",
+	"0123456789",
+}
+
+// parseSMBIOS extracts asset fields from the raw SMBIOS structure table
+func parseSMBIOS(table []byte) *smbiosInfo {
+	info := &smbiosInfo{}
+	var chassisSerial string
+
+	for len(table) >= 4 {
+		structType, length := table[0], int(table[1])
+		if length < 4 || length > len(table) {
+			break
+		}
+		formatted := table[:length]
+
+		// The string set follows the formatted area and ends with two NULs
+		end := length
+		for end+1 < len(table) && !(table[end] == 0 && table[end+1] == 0) {
+			end++
+		}
+		strs := strings.Split(string(table[length:end]), "\x00")
+		str := func(offset int) string {
+			if offset >= len(formatted) {
+				return ""
+			}
+			index := int(formatted[offset])
+			if index == 0 || index > len(strs) {
+				return ""
+			}
+			return strings.TrimSpace(strs[index-1])
+		}
+
+		switch structType {
+		case smbiosTypeBIOS:
+			info.BIOSVersion = str(0x05)
+		case smbiosTypeSystem:
+			info.Manufacturer = str(0x04)
+			info.Model = str(0x05)
+			info.SerialNumber = cleanSerial(str(0x07))
+		case smbiosTypeChassis:
+			if length > 0x05 {
+				if name, ok := chassisTypes[formatted[0x05]&0x7f]; ok {
+					info.ChassisType = name
+				}
+			}
+			chassisSerial = cleanSerial(str(0x07))
+		case smbiosTypeEnd:
+			table = nil
+			continue
+		}
+
+		if end+2 > len(table) {
+			break
+		}
+		table = table[end+2:]
+	}
+
+	// Some white-box systems only fill in the enclosure serial
+	if info.SerialNumber == "" {
+		info.SerialNumber = chassisSerial
+	}
+
+	return info
+}
+
+// rawSMBIOSTable strips the RawSMBIOSData header returned by
+// GetSystemFirmwareTable('RSMB'): four version bytes and a DWORD length
+func rawSMBIOSTable(data []byte) []byte {
+	if len(data) < 8 {
+		return nil
+	}
+	length := int(binary.LittleEndian.Uint32(data[4:8]))
+	if length > len(data)-8 {
+		length = len(data) - 8
+	}
+	return data[8 : 8+length]
+}
+
+// cleanSerial drops vendor placeholder serial numbers
+func cleanSerial(serial string) string {
+	lower := strings.ToLower(serial)
+	for _, placeholder := range placeholderSerials {
+		if lower == placeholder {
+			return ""
+		}
+	}
+	return serial
+}
@@ -0,0 +1,177 @@
+package sysinfo
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SystemInfo contains system information
+type SystemInfo struct {
+	Hostname        string
+	FQDN            string
+	IPAddress       string // of the primary adapter
+	MACAddress      string
+	NetworkAdapters []NetworkAdapter
+	Cloud           *CloudInstance // nil outside AWS, Azure and GCP
+	Virtualization  *Virtualization
+	DeviceClass     string // "laptop", "desktop", "server" or "vdi"
+	SecurityPosture *SecurityPosture
+	OSVersion       string
+	OSBuild         string
+	Architecture    string
+	Domain          string
+	CPUModel        string
+	CPUCores        int
+	TotalRAM_MB     int
+	TotalDisk_GB    int // system volume: C: or /
+	Volumes         []Volume
+	BootTime        time.Time
+
+	// Asset identification from SMBIOS
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	BIOSVersion  string
+	ChassisType  string
+}
+
+// hardwareInfo is the CPU, memory and system volume size
+type hardwareInfo struct {
+	CPUModel     string
+	CPUCores     int // physical cores, or logical CPUs where unknown
+	TotalRAM_MB  int
+	TotalDisk_GB int
+}
+
+// Gather collects system information. Every platform provides the same
+// probes, so new fields are added here once and filled in per platform:
+//
+//	getNetworkAdapters  adapters that are up, the primary one marked
+//	getOSVersion        product name and version; build or kernel release
+//	getDomain           DNS or directory domain the host belongs to
+//	getHardware         CPU, memory and system volume size
+//	getSMBIOS           manufacturer, model, serial, firmware and chassis
+//	getVirtualization   hypervisor and container
+//	hasSystemBattery    for the device class
+//	isServerOS          for the device class
+//
+// GetBootTime, GetVolumes and GetSecurityPosture are exported for the
+// collectors and also platform specific.
+func Gather() (*SystemInfo, error) {
+	info := &SystemInfo{
+		Architecture: runtime.GOARCH,
+	}
+
+	// Hostname
+	hostname, err := GetHostname()
+	if err != nil {
+		return nil, err
+	}
+	info.Hostname = hostname
+
+	// FQDN
+	fqdn, err := getFQDN()
+	if err == nil {
+		info.FQDN = fqdn
+	}
+
+	// Network adapters; IP and MAC address of the primary one
+	info.NetworkAdapters = getNetworkAdapters()
+	for _, adapter := range info.NetworkAdapters {
+		if adapter.Primary {
+			info.IPAddress = primaryIPv4(adapter)
+			info.MACAddress = adapter.MACAddress
+		}
+	}
+
+	// OS version
+	info.OSVersion, info.OSBuild = getOSVersion()
+
+	// Domain
+	domain, err := getDomain()
+	if err == nil {
+		info.Domain = domain
+	}
+
+	// CPU, memory and system volume
+	hardware := getHardware()
+	info.CPUModel = hardware.CPUModel
+	info.CPUCores = hardware.CPUCores
+	info.TotalRAM_MB = hardware.TotalRAM_MB
+	info.TotalDisk_GB = hardware.TotalDisk_GB
+
+	// All fixed volumes
+	info.Volumes = GetVolumes()
+
+	// Last boot
+	info.BootTime = GetBootTime()
+
+	// Manufacturer, model, serial, BIOS and chassis
+	if smbios := getSMBIOS(); smbios != nil {
+		info.Manufacturer = smbios.Manufacturer
+		info.Model = smbios.Model
+		info.SerialNumber = smbios.SerialNumber
+		info.BIOSVersion = smbios.BIOSVersion
+		info.ChassisType = smbios.ChassisType
+	}
+
+	// Hypervisor and container
+	info.Virtualization = getVirtualization()
+
+	// Laptop, desktop, server or VDI
+	info.DeviceClass = deviceClass(info.ChassisType, hasSystemBattery(), isServerOS(), info.Virtualization.Hypervisor != "")
+
+	// TPM, Secure Boot, Credential Guard and VBS
+	info.SecurityPosture = GetSecurityPosture()
+
+	// Cloud instance metadata
+	info.Cloud = DetectCloud()
+
+	return info, nil
+}
+
+// hostnameOverride replaces the OS hostname when set (container mode,
+// where the pod's hostname is not the machine's)
+var hostnameOverride string
+
+// SetHostname makes GetHostname and Gather report name as the hostname
+func SetHostname(name string) {
+	hostnameOverride = name
+}
+
+// GetHostname returns the system hostname
+func GetHostname() (string, error) {
+	if hostnameOverride != "" {
+		return hostnameOverride, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname: %w", err)
+	}
+	return hostname, nil
+}
+
+// getFQDN returns the fully qualified domain name
+func getFQDN() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	addrs, err := net.LookupHost(hostname)
+	if err != nil {
+		return hostname, nil
+	}
+
+	for _, addr := range addrs {
+		if names, err := net.LookupAddr(addr); err == nil && len(names) > 0 {
+			return strings.TrimSuffix(names[0], "."), nil
+		}
+	}
+
+	return hostname, nil
+}
@@ -0,0 +1,166 @@
+//go:build darwin
+
+package sysinfo
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// getNetworkAdapters lists the interfaces that are up, excluding loopback.
+// The default route's interface is primary and gets its gateway.
+func getNetworkAdapters() []NetworkAdapter {
+	var iface, gateway string
+	if output, err := exec.Command("route", "-n", "get", "default").Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			switch strings.TrimSpace(key) {
+			case "interface":
+				iface = strings.TrimSpace(value)
+			case "gateway":
+				gateway = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	adapters := interfaceAdapters(iface)
+	for i := range adapters {
+		if adapters[i].Primary && adapters[i].Name == iface && gateway != "" {
+			adapters[i].Gateways = []string{gateway}
+		}
+	}
+	return adapters
+}
+
+// getOSVersion returns the macOS product name and version and the build
+func getOSVersion() (string, string) {
+	name := swVers("-productName")
+	if name == "" {
+		return "macOS", "Unknown"
+	}
+	return name + " " + swVers("-productVersion"), swVers("-buildVersion")
+}
+
+// swVers returns one sw_vers field
+func swVers(flag string) string {
+	output, err := exec.Command("sw_vers", flag).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// getDomain returns the Active Directory domain the Mac is bound to
+func getDomain() (string, error) {
+	output, err := exec.Command("dsconfigad", "-show").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == "Active Directory Domain" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("not bound to a directory")
+}
+
+// getHardware reads the CPU and memory from sysctl and the size of the
+// root volume
+func getHardware() hardwareInfo {
+	hardware := hardwareInfo{
+		CPUModel: sysctlString("machdep.cpu.brand_string"),
+		CPUCores: runtime.NumCPU(),
+	}
+	if cores, err := strconv.Atoi(sysctlString("hw.physicalcpu")); err == nil {
+		hardware.CPUCores = cores
+	}
+	if bytes, err := strconv.ParseUint(sysctlString("hw.memsize"), 10, 64); err == nil {
+		hardware.TotalRAM_MB = int(bytes / 1024 / 1024)
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs("/", &fs); err == nil {
+		hardware.TotalDisk_GB = int(fs.Blocks * uint64(fs.Bsize) / 1024 / 1024 / 1024)
+	}
+
+	return hardware
+}
+
+// sysctlString returns a sysctl value as text
+func sysctlString(name string) string {
+	output, err := exec.Command("sysctl", "-n", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// getSMBIOS reads the asset fields Macs expose through the I/O Registry
+// platform expert instead of SMBIOS
+func getSMBIOS() *smbiosInfo {
+	output, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return nil
+	}
+
+	info := &smbiosInfo{}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		// "model" = <"MacBookPro18,3">, "IOPlatformSerialNumber" = "C02..."
+		value = strings.Trim(strings.TrimSpace(value), `<>"`)
+		value = strings.TrimRight(value, "\x00")
+		switch strings.Trim(strings.TrimSpace(key), `"`) {
+		case "manufacturer":
+			info.Manufacturer = value
+		case "model":
+			info.Model = value
+		case "IOPlatformSerialNumber":
+			info.SerialNumber = cleanSerial(value)
+		}
+	}
+	info.ChassisType = macChassisType(info.Model)
+
+	return info
+}
+
+// macChassisType maps a Mac model identifier to an SMBIOS chassis type.
+// Apple silicon models ("Mac14,2") do not name the form factor; the
+// battery check tells laptops apart.
+func macChassisType(model string) string {
+	switch {
+	case strings.HasPrefix(model, "MacBook"):
+		return "Notebook"
+	case strings.HasPrefix(model, "iMac"):
+		return "All in One"
+	case strings.HasPrefix(model, "Macmini"):
+		return "Mini PC"
+	case strings.HasPrefix(model, "MacPro"):
+		return "Tower"
+	}
+	return ""
+}
+
+// getVirtualization detects a virtual machine from kern.hv_vmm_present and
+// identifies the hypervisor from the model
+func getVirtualization() *Virtualization {
+	virt := &Virtualization{}
+	if sysctlString("kern.hv_vmm_present") != "1" {
+		return virt
+	}
+
+	virt.Virtual = true
+	if smbios := getSMBIOS(); smbios != nil {
+		virt.Hypervisor = hypervisorFromSMBIOS(smbios.Manufacturer, smbios.Model)
+	}
+	return virt
+}
@@ -0,0 +1,303 @@
+//go:build linux
+
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// GetBootTime returns when the host last booted, to the second, or the
+// zero time if it cannot be determined
+func GetBootTime() time.Time {
+	// "btime <seconds>" in /proc/stat
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			if seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				return time.Unix(seconds, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// getNetworkAdapters lists the interfaces that are up, excluding loopback.
+// The interface of the default route with the lowest metric is primary and
+// gets the gateway and the resolv.conf name servers.
+func getNetworkAdapters() []NetworkAdapter {
+	iface, gateway := defaultRoute()
+	adapters := interfaceAdapters(iface)
+
+	for i := range adapters {
+		if !adapters[i].Primary {
+			continue
+		}
+		if adapters[i].Name == iface && gateway != "" {
+			adapters[i].Gateways = []string{gateway}
+		}
+		adapters[i].DNSServers = resolvConfNameservers()
+	}
+	return adapters
+}
+
+// defaultRoute returns the interface and gateway of the IPv4 default route
+// with the lowest metric, from /proc/net/route
+func defaultRoute() (string, string) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", ""
+	}
+	defer file.Close()
+
+	var iface, gateway string
+	bestMetric := -1
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil || (bestMetric >= 0 && metric >= bestMetric) {
+			continue
+		}
+		raw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+
+		// The address is in host byte order
+		ip := make(net.IP, 4)
+		binary.LittleEndian.PutUint32(ip, uint32(raw))
+		iface, gateway, bestMetric = fields[0], ip.String(), metric
+	}
+	return iface, gateway
+}
+
+// resolvConfNameservers returns the name servers of /etc/resolv.conf
+func resolvConfNameservers() []string {
+	var servers []string
+	for _, fields := range resolvConf() {
+		if fields[0] == "nameserver" && len(fields) > 1 {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// resolvConf returns the fields of the non-comment lines of /etc/resolv.conf
+func resolvConf() [][]string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	var lines [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") && !strings.HasPrefix(fields[0], ";") {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
+
+// getOSVersion returns the distribution name and version from os-release
+// and the kernel release
+func getOSVersion() (string, string) {
+	release := make(map[string]string)
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				release[key] = strings.Trim(value, `"'`)
+			}
+		}
+		break
+	}
+
+	version := release["PRETTY_NAME"]
+	if version == "" {
+		version = strings.TrimSpace(release["NAME"] + " " + release["VERSION"])
+	}
+	if version == "" {
+		version = "Linux"
+	}
+
+	build := "Unknown"
+	if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		build = strings.TrimSpace(string(kernel))
+	}
+
+	return version, build
+}
+
+// getDomain returns the directory domain the host is joined to (the first
+// SSSD domain, as set up by realm join), or else its DNS domain from
+// resolv.conf
+func getDomain() (string, error) {
+	if data, err := os.ReadFile("/etc/sssd/sssd.conf"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == "domains" {
+				if domain, _, _ := strings.Cut(value, ","); strings.TrimSpace(domain) != "" {
+					return strings.TrimSpace(domain), nil
+				}
+			}
+		}
+	}
+
+	for _, fields := range resolvConf() {
+		if (fields[0] == "domain" || fields[0] == "search") && len(fields) > 1 {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("no domain configured")
+}
+
+// getHardware reads the CPU from /proc/cpuinfo, memory from /proc/meminfo
+// and the size of the root filesystem
+func getHardware() hardwareInfo {
+	hardware := hardwareInfo{CPUCores: runtime.NumCPU()}
+
+	if data, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		cores := make(map[string]bool)
+		var physicalID string
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			switch key {
+			case "model name", "Model": // x86, ARM boards
+				if hardware.CPUModel == "" {
+					hardware.CPUModel = value
+				}
+			case "physical id":
+				physicalID = value
+			case "core id":
+				cores[physicalID+"/"+value] = true
+			}
+		}
+		if len(cores) > 0 {
+			hardware.CPUCores = len(cores)
+		}
+	}
+
+	if data, err := os.ReadFile("/proc/meminfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "MemTotal:"); ok {
+				kb, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB"))
+				hardware.TotalRAM_MB = kb / 1024
+				break
+			}
+		}
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs("/", &fs); err == nil {
+		hardware.TotalDisk_GB = int(fs.Blocks * uint64(fs.Bsize) / 1024 / 1024 / 1024)
+	}
+
+	return hardware
+}
+
+// getSMBIOS parses the raw SMBIOS table the kernel exports (root only), or
+// falls back to the world-readable DMI attributes, which lack the serial
+func getSMBIOS() *smbiosInfo {
+	if table, err := os.ReadFile("/sys/firmware/dmi/tables/DMI"); err == nil {
+		if info := parseSMBIOS(table); info.Manufacturer != "" {
+			return info
+		}
+	}
+
+	info := &smbiosInfo{
+		Manufacturer: dmiAttribute("sys_vendor"),
+		Model:        dmiAttribute("product_name"),
+		SerialNumber: cleanSerial(dmiAttribute("product_serial")),
+		BIOSVersion:  dmiAttribute("bios_version"),
+	}
+	if chassis, err := strconv.Atoi(dmiAttribute("chassis_type")); err == nil {
+		info.ChassisType = chassisTypes[byte(chassis)]
+	}
+	if info.Manufacturer == "" && info.Model == "" {
+		return nil // no DMI (ARM boards, some containers)
+	}
+	return info
+}
+
+// dmiAttribute reads a /sys/class/dmi/id attribute
+func dmiAttribute(name string) string {
+	data, err := os.ReadFile("/sys/class/dmi/id/" + name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// getVirtualization detects the hypervisor from the DMI strings (or the
+// Xen hypervisor interface) and the container runtime from the markers
+// systemd, Docker, Podman and Kubernetes leave
+func getVirtualization() *Virtualization {
+	virt := &Virtualization{
+		Hypervisor: hypervisorFromSMBIOS(dmiAttribute("sys_vendor"), dmiAttribute("product_name"), dmiAttribute("bios_vendor")),
+	}
+	if virt.Hypervisor == "" {
+		if data, err := os.ReadFile("/sys/hypervisor/type"); err == nil && strings.TrimSpace(string(data)) == "xen" {
+			virt.Hypervisor = "xen"
+		}
+	}
+
+	virt.Container = containerRuntime()
+	virt.Virtual = virt.Hypervisor != "" || virt.Container != ""
+	return virt
+}
+
+// containerRuntime returns the container runtime the agent runs in, or ""
+// on the host
+func containerRuntime() string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	// Written by systemd-based containers and container managers
+	if data, err := os.ReadFile("/run/systemd/container"); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	if data, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		switch {
+		case bytes.Contains(data, []byte("kubepods")):
+			return "kubernetes"
+		case bytes.Contains(data, []byte("/docker/")):
+			return "docker"
+		case bytes.Contains(data, []byte("/lxc/")):
+			return "lxc"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+//go:build !windows && !linux && !darwin
+
+package sysinfo
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// getNetworkAdapters lists the interfaces that are up, excluding loopback
+func getNetworkAdapters() []NetworkAdapter {
+	return interfaceAdapters("")
+}
+
+// getOSVersion returns the OS name and kernel release
+func getOSVersion() (string, string) {
+	build := "Unknown"
+	if release, err := exec.Command("uname", "-r").Output(); err == nil {
+		build = strings.TrimSpace(string(release))
+	}
+	return runtime.GOOS, build
+}
+
+// getDomain is not implemented on this platform
+func getDomain() (string, error) {
+	return "", fmt.Errorf("domain is not supported on this platform")
+}
+
+// getHardware returns the number of CPUs
+func getHardware() hardwareInfo {
+	return hardwareInfo{CPUCores: runtime.NumCPU()}
+}
+
+// getSMBIOS returns nil: the SMBIOS tables are not read on this platform
+func getSMBIOS() *smbiosInfo {
+	return nil
+}
+
+// getVirtualization reports a physical machine: virtualization is not
+// detected on this platform
+func getVirtualization() *Virtualization {
+	return &Virtualization{}
+}
@@ -6,156 +6,141 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"runtime"
-	"strings"
+	"sort"
+	"time"
+	"unsafe"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/mem"
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 )
 
-// SystemInfo contains system information
-type SystemInfo struct {
-	Hostname      string
-	FQDN          string
-	IPAddress     string
-	MACAddress    string
-	OSVersion     string
-	OSBuild       string
-	Architecture  string
-	Domain        string
-	CPUModel      string
-	CPUCores      int
-	TotalRAM_MB   int
-	TotalDisk_GB  int
+// GetBootTime returns when Windows last booted, to the second
+func GetBootTime() time.Time {
+	return time.Now().Add(-windows.DurationSinceBoot()).Truncate(time.Second)
 }
 
-// GetHostname returns the system hostname
-func GetHostname() (string, error) {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "", fmt.Errorf("failed to get hostname: %w", err)
-	}
-	return hostname, nil
-}
+// getHardware reads the CPU, installed memory and C: size
+func getHardware() hardwareInfo {
+	var hardware hardwareInfo
 
-// Gather collects system information
-func Gather() (*SystemInfo, error) {
-	info := &SystemInfo{
-		Architecture: runtime.GOARCH,
+	if cpuInfo, err := cpu.Info(); err == nil && len(cpuInfo) > 0 {
+		hardware.CPUModel = cpuInfo[0].ModelName
+		hardware.CPUCores = int(cpuInfo[0].Cores)
 	}
-
-	// Hostname
-	hostname, err := GetHostname()
-	if err != nil {
-		return nil, err
+	if memInfo, err := mem.VirtualMemory(); err == nil {
+		hardware.TotalRAM_MB = int(memInfo.Total / 1024 / 1024)
 	}
-	info.Hostname = hostname
-
-	// FQDN
-	fqdn, err := getFQDN()
-	if err == nil {
-		info.FQDN = fqdn
-	}
-
-	// IP and MAC address
-	ip, mac := getNetworkInfo()
-	info.IPAddress = ip
-	info.MACAddress = mac
-
-	// OS version
-	osVersion, osBuild := getOSVersion()
-	info.OSVersion = osVersion
-	info.OSBuild = osBuild
-
-	// Domain
-	domain, err := getDomain()
-	if err == nil {
-		info.Domain = domain
-	}
-
-	// CPU info
-	cpuInfo, err := cpu.Info()
-	if err == nil && len(cpuInfo) > 0 {
-		info.CPUModel = cpuInfo[0].ModelName
-		info.CPUCores = int(cpuInfo[0].Cores)
-	}
-
-	// Memory
-	memInfo, err := mem.VirtualMemory()
-	if err == nil {
-		info.TotalRAM_MB = int(memInfo.Total / 1024 / 1024)
+	if diskInfo, err := disk.Usage("C:\\"); err == nil {
+		hardware.TotalDisk_GB = int(diskInfo.Total / 1024 / 1024 / 1024)
 	}
 
-	// Disk
-	diskInfo, err := disk.Usage("C:\\")
-	if err == nil {
-		info.TotalDisk_GB = int(diskInfo.Total / 1024 / 1024 / 1024)
-	}
-
-	return info, nil
+	return hardware
 }
 
-// getFQDN returns the fully qualified domain name
-func getFQDN() (string, error) {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "", err
-	}
-
-	addrs, err := net.LookupHost(hostname)
-	if err != nil {
-		return hostname, nil
-	}
+// Adapter flags and GetAdaptersAddresses options missing from x/sys
+const (
+	ipAdapterDHCPEnabled   = 0x0004
+	gaaFlagIncludeGateways = 0x0080
+	gaaFlagSkipAnycast     = 0x0002
+	gaaFlagSkipMulticast   = 0x0004
+)
 
-	for _, addr := range addrs {
-		if names, err := net.LookupAddr(addr); err == nil && len(names) > 0 {
-			return strings.TrimSuffix(names[0], "."), nil
+// getNetworkAdapters lists the adapters that are up, excluding loopback,
+// and marks the primary one: the adapter with a default gateway and the
+// lowest IPv4 route metric, then the lowest interface index. Without a
+// gateway the first adapter with an IPv4 address is primary.
+func getNetworkAdapters() []NetworkAdapter {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for i := 0; i < 3; i++ {
+		buf = make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC,
+			gaaFlagIncludeGateways|gaaFlagSkipAnycast|gaaFlagSkipMulticast,
+			0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			break
 		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil
+		}
+		buf = nil
+	}
+	if buf == nil {
+		return nil
 	}
 
-	return hostname, nil
-}
-
-// getNetworkInfo returns primary IP and MAC address
-func getNetworkInfo() (string, string) {
-	interfaces, err := net.Interfaces()
-	if err != nil {
-		return "", ""
+	type candidate struct {
+		adapter NetworkAdapter
+		index   uint32
+		metric  uint32
+		gateway bool
 	}
+	var candidates []candidate
 
-	for _, iface := range interfaces {
-		// Skip loopback and down interfaces
-		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp || aa.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK {
 			continue
 		}
 
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
+		adapter := NetworkAdapter{
+			Name:        windows.UTF16PtrToString(aa.FriendlyName),
+			Description: windows.UTF16PtrToString(aa.Description),
+			DHCP:        aa.Flags&ipAdapterDHCPEnabled != 0,
 		}
-
-		for _, addr := range addrs {
-			var ip net.IP
-			switch v := addr.(type) {
-			case *net.IPNet:
-				ip = v.IP
-			case *net.IPAddr:
-				ip = v.IP
+		if aa.PhysicalAddressLength > 0 {
+			adapter.MACAddress = net.HardwareAddr(aa.PhysicalAddress[:aa.PhysicalAddressLength]).String()
+		}
+		for ua := aa.FirstUnicastAddress; ua != nil; ua = ua.Next {
+			if ip := ua.Address.IP(); ip != nil {
+				adapter.IPAddresses = append(adapter.IPAddresses, ip.String())
 			}
-
-			// Skip loopback and IPv6
-			if ip == nil || ip.IsLoopback() || ip.To4() == nil {
-				continue
+		}
+		for ga := aa.FirstGatewayAddress; ga != nil; ga = ga.Next {
+			if ip := ga.Address.IP(); ip != nil {
+				adapter.Gateways = append(adapter.Gateways, ip.String())
 			}
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			if ip := dns.Address.IP(); ip != nil {
+				adapter.DNSServers = append(adapter.DNSServers, ip.String())
+			}
+		}
+
+		candidates = append(candidates, candidate{
+			adapter: adapter,
+			index:   aa.IfIndex,
+			metric:  aa.Ipv4Metric,
+			gateway: len(adapter.Gateways) > 0,
+		})
+	}
 
-			return ip.String(), iface.HardwareAddr.String()
+	// Deterministic order: gateway first, then metric, then index
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.gateway != b.gateway {
+			return a.gateway
 		}
+		if a.metric != b.metric {
+			return a.metric < b.metric
+		}
+		return a.index < b.index
+	})
+
+	adapters := make([]NetworkAdapter, 0, len(candidates))
+	primaryFound := false
+	for _, c := range candidates {
+		if !primaryFound && primaryIPv4(c.adapter) != "" {
+			c.adapter.Primary = true
+			primaryFound = true
+		}
+		adapters = append(adapters, c.adapter)
 	}
 
-	return "", ""
+	return adapters
 }
 
 // getOSVersion returns Windows version and build number
@@ -200,3 +185,71 @@ func getDomain() (string, error) {
 
 	return domain, nil
 }
+
+var procGetSystemFirmwareTable = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetSystemFirmwareTable")
+
+// rsmbProvider is the 'RSMB' firmware table provider signature
+const rsmbProvider = 'R'<<24 | 'S'<<16 | 'M'<<8 | 'B'
+
+// getSMBIOS reads the raw SMBIOS table, the source WMI uses for the same fields
+func getSMBIOS() *smbiosInfo {
+	size, _, _ := procGetSystemFirmwareTable.Call(rsmbProvider, 0, 0, 0)
+	if size == 0 {
+		return nil
+	}
+
+	buf := make([]byte, size)
+	n, _, _ := procGetSystemFirmwareTable.Call(rsmbProvider, 0, uintptr(unsafe.Pointer(&buf[0])), size)
+	if n == 0 || n > size {
+		return nil
+	}
+
+	return parseSMBIOS(rawSMBIOSTable(buf[:n]))
+}
+
+// getVirtualization detects the hypervisor from the SMBIOS strings Windows
+// copies into the registry, and container execution from the markers that
+// Windows containers and Windows Sandbox leave
+func getVirtualization() *Virtualization {
+	virt := &Virtualization{}
+
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `HARDWARE\DESCRIPTION\System\BIOS`, registry.QUERY_VALUE)
+	if err == nil {
+		manufacturer, _, _ := k.GetStringValue("SystemManufacturer")
+		product, _, _ := k.GetStringValue("SystemProductName")
+		biosVendor, _, _ := k.GetStringValue("BIOSVendor")
+		k.Close()
+		virt.Hypervisor = hypervisorFromSMBIOS(manufacturer, product, biosVendor)
+	}
+
+	if isContainer() {
+		virt.Container = "container"
+		// Windows Sandbox runs its desktop as this built-in account
+		if _, err := os.Stat(`C:\Users\WDAGUtilityAccount`); err == nil {
+			virt.Container = "windows_sandbox"
+		}
+	}
+
+	virt.Virtual = virt.Hypervisor != "" || virt.Container != ""
+	return virt
+}
+
+// isContainer reports whether the agent runs inside a Windows container:
+// the ContainerType value is set and the Container Execution Agent
+// (CExecSvc) service exists only there
+func isContainer() bool {
+	if k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control`, registry.QUERY_VALUE); err == nil {
+		_, _, err := k.GetIntegerValue("ContainerType")
+		k.Close()
+		if err == nil {
+			return true
+		}
+	}
+
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\CExecSvc`, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	k.Close()
+	return true
+}
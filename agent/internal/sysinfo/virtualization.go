@@ -0,0 +1,43 @@
+package sysinfo
+
+import "strings"
+
+// Virtualization describes the hypervisor or container the agent runs in
+type Virtualization struct {
+	Virtual    bool   `json:"virtual"`
+	Hypervisor string `json:"hypervisor,omitempty"` // "hyper-v", "vmware", "kvm", "virtualbox", "xen", "parallels", "apple"
+	Container  string `json:"container,omitempty"`  // "windows_sandbox", "container", "docker", "podman", "kubernetes", "lxc", ...
+}
+
+// hypervisorSignatures maps SMBIOS manufacturer/product substrings to
+// hypervisors. Checked in order; Hyper-V is matched on the product name
+// because Microsoft is also the manufacturer of Surface hardware.
+var hypervisorSignatures = []struct {
+	signature  string
+	hypervisor string
+}{
+	{"virtual machine", "hyper-v"},
+	{"vmware", "vmware"},
+	{"virtualbox", "virtualbox"},
+	{"innotek", "virtualbox"},
+	{"qemu", "kvm"},
+	{"kvm", "kvm"},
+	{"bochs", "kvm"},
+	{"amazon ec2", "kvm"}, // Nitro
+	{"xen", "xen"},
+	{"parallels", "parallels"},
+	{"virtualmac", "apple"}, // Virtualization.framework guests
+}
+
+// hypervisorFromSMBIOS identifies a hypervisor from the SMBIOS system
+// manufacturer, product name and BIOS vendor. It returns "" for physical
+// hardware.
+func hypervisorFromSMBIOS(values ...string) string {
+	joined := strings.ToLower(strings.Join(values, " "))
+	for _, sig := range hypervisorSignatures {
+		if strings.Contains(joined, sig.signature) {
+			return sig.hypervisor
+		}
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+package sysinfo
+
+// Volume is a fixed disk volume
+type Volume struct {
+	Mount       string  `json:"mount"` // "C:\"
+	Label       string  `json:"label,omitempty"`
+	FileSystem  string  `json:"file_system,omitempty"`
+	TotalMB     uint64  `json:"total_mb"`
+	FreeMB      uint64  `json:"free_mb"`
+	FreePercent float64 `json:"free_percent"`
+	BitLocker   string  `json:"bitlocker,omitempty"` // "on", "suspended", "off", "encrypting", "decrypting"; empty if not encryptable
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package sysinfo
+
+// GetVolumes returns nil: volumes are only enumerated on Windows
+func GetVolumes() []Volume {
+	return nil
+}
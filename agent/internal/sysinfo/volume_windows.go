@@ -0,0 +1,138 @@
+//go:build windows
+
+package sysinfo
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// BitLocker status comes from WMI through PowerShell, which takes about a
+// second, while volumes are gathered on every heartbeat
+const bitLockerCacheTTL = time.Hour
+
+var bitLockerCache struct {
+	sync.Mutex
+	status    map[string]string // drive letter "C:" -> state
+	refreshed time.Time
+}
+
+// GetVolumes returns the fixed volumes with their size, free space,
+// filesystem and BitLocker state
+func GetVolumes() []Volume {
+	buf := make([]uint16, 254)
+	n, err := windows.GetLogicalDriveStrings(uint32(len(buf)), &buf[0])
+	if err != nil || n == 0 {
+		return nil
+	}
+
+	bitLocker := getBitLockerStatus()
+
+	var volumes []Volume
+	// The buffer holds NUL-terminated root paths: C:\<NUL>D:\<NUL>
+	for i := 0; i < int(n); {
+		root := windows.UTF16ToString(buf[i:n])
+		if root == "" {
+			break
+		}
+		i += len(root) + 1
+
+		rootPtr, _ := windows.UTF16PtrFromString(root)
+		if windows.GetDriveType(rootPtr) != windows.DRIVE_FIXED {
+			continue
+		}
+
+		var freeToCaller, total, free uint64
+		if err := windows.GetDiskFreeSpaceEx(rootPtr, &freeToCaller, &total, &free); err != nil || total == 0 {
+			continue
+		}
+
+		volume := Volume{
+			Mount:       root,
+			TotalMB:     total / 1024 / 1024,
+			FreeMB:      free / 1024 / 1024,
+			FreePercent: float64(free) * 100 / float64(total),
+			BitLocker:   bitLocker[strings.ToUpper(strings.TrimSuffix(root, `\`))],
+		}
+
+		label := make([]uint16, windows.MAX_PATH+1)
+		fileSystem := make([]uint16, windows.MAX_PATH+1)
+		if err := windows.GetVolumeInformation(rootPtr, &label[0], uint32(len(label)), nil, nil, nil,
+			&fileSystem[0], uint32(len(fileSystem))); err == nil {
+			volume.Label = windows.UTF16ToString(label)
+			volume.FileSystem = windows.UTF16ToString(fileSystem)
+		}
+
+		volumes = append(volumes, volume)
+	}
+
+	return volumes
+}
+
+// getBitLockerStatus returns the BitLocker state per drive letter, cached
+func getBitLockerStatus() map[string]string {
+	bitLockerCache.Lock()
+	defer bitLockerCache.Unlock()
+
+	if bitLockerCache.status != nil && time.Since(bitLockerCache.refreshed) < bitLockerCacheTTL {
+		return bitLockerCache.status
+	}
+
+	status := queryBitLocker()
+	if status == nil {
+		status = make(map[string]string)
+	}
+	bitLockerCache.status = status
+	bitLockerCache.refreshed = time.Now()
+	return status
+}
+
+// queryBitLocker reads Win32_EncryptableVolume. Volumes BitLocker cannot
+// encrypt are not listed.
+func queryBitLocker() map[string]string {
+	psScript := `$v = @(Get-CimInstance -Namespace root\cimv2\Security\MicrosoftVolumeEncryption ` +
+		`-ClassName Win32_EncryptableVolume -ErrorAction Stop | ` +
+		`Select-Object DriveLetter, ProtectionStatus, ConversionStatus); ` +
+		`ConvertTo-Json -InputObject $v -Compress`
+
+	output, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", psScript).Output()
+	if err != nil {
+		return nil
+	}
+
+	var volumes []struct {
+		DriveLetter      string
+		ProtectionStatus int // 0 off, 1 on, 2 unknown
+		ConversionStatus int // 0 decrypted, 1 encrypted, 2 encrypting, 3 decrypting, 4/5 paused
+	}
+	if err := json.Unmarshal(output, &volumes); err != nil {
+		return nil
+	}
+
+	status := make(map[string]string, len(volumes))
+	for _, v := range volumes {
+		if v.DriveLetter == "" {
+			continue
+		}
+		state := "off"
+		switch v.ConversionStatus {
+		case 1:
+			state = "suspended"
+			if v.ProtectionStatus == 1 {
+				state = "on"
+			}
+		case 2, 4:
+			state = "encrypting"
+		case 3, 5:
+			state = "decrypting"
+		}
+		status[strings.ToUpper(v.DriveLetter)] = state
+	}
+
+	return status
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/kardianos/service"
 	"github.com/siem/agent/internal/agent"
+	"github.com/siem/agent/internal/collector"
 	"github.com/siem/agent/internal/config"
+	"github.com/siem/agent/internal/secrets"
 )
 
 const (
@@ -81,9 +86,28 @@ func main() {
 		status    = flag.Bool("status", false, "Service status")
 		console   = flag.Bool("console", false, "Run in console (for debugging)")
 		ver       = flag.Bool("version", false, "Show version")
+		storeKey  = flag.Bool("store-api-key", false, "Store the API key read from stdin in the system secret store (macOS keychain, Windows DPAPI)")
+		simulate  = flag.Bool("simulate", false, "Send synthetic events through the send pipeline and report performance")
+		simEPS    = flag.Int("eps", 1000, "Events per second generated by -simulate")
+		simTime   = flag.Duration("duration", time.Minute, "How long -simulate generates events")
+		simMix    = flag.String("mix", collector.DefaultSimulationMix, "Event mix for -simulate (kind=weight,...)")
+		simServer = flag.Bool("simulate-server", false, "Send -simulate events to the configured SIEM server instead of a local sink")
+		selftest  = flag.Bool("selftest", false, "Check the configuration, server connectivity, collection sources and write access, and print a report")
+		diag      = flag.Bool("diag", false, "Package logs, the redacted configuration and status into a zip for a support ticket")
+		diagOut   = flag.String("diag-output", "", "File written by -diag (default siem-agent-diag-<host>-<time>.zip)")
+		screen    = flag.Bool("screen-helper", false, "Capture the desktop for a screen sharing session (started by the agent in the user session)")
+		monitor   = flag.Int("monitor", 0, "Display captured by -screen-helper, 0 for all displays")
 	)
 	flag.Parse()
 
+	// Screen sharing helper; its stdin and stdout are pipes to the agent
+	if *screen {
+		if err := collector.RunScreenHelper(*monitor); err != nil {
+			log.Fatalf("Screen helper failed: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	// Show version
 	if *ver {
 		fmt.Printf("SIEM Agent v%s\n", version)
@@ -91,19 +115,59 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Store the API key in the secret store; read from stdin so it stays out
+	// of the shell history and process list
+	if *storeKey {
+		apiKey, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		apiKey = strings.TrimSpace(apiKey)
+		if apiKey == "" {
+			log.Fatalf("No API key on stdin: %v", err)
+		}
+		if err := secrets.Set(secrets.APIKey, apiKey); err != nil {
+			log.Fatalf("Failed to store API key: %v", err)
+		}
+		fmt.Println("API key stored in the system secret store; remove siem.api_key from config.yaml")
+		os.Exit(0)
+	}
+
+	// Check that the agent can run here
+	if *selftest {
+		report := agent.SelfTest("config.yaml")
+		report.Print(os.Stdout)
+		if !report.Passed() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Benchmark the send pipeline with synthetic events
+	if *simulate {
+		cfg, err := config.Load("config.yaml")
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		report, err := agent.Simulate(cfg, version, agent.SimulationOptions{
+			EPS:      *simEPS,
+			Duration: *simTime,
+			Mix:      *simMix,
+			Server:   *simServer,
+		})
+		if err != nil {
+			log.Fatalf("Simulation failed: %v", err)
+		}
+		report.Print(os.Stdout)
+		os.Exit(0)
+	}
+
 	// Service configuration
 	svcConfig := &service.Config{
 		Name:        serviceName,
 		DisplayName: serviceDisplayName,
 		Description: serviceDescription,
 		Arguments:   []string{},
-		Option: service.KeyValue{
-			"StartType":         "automatic",
-			"OnFailure":         "restart",
-			"OnFailureDelay":    5,
-			"OnFailureResetPeriod": 60,
-		},
 	}
+	configureService(svcConfig)
 
 	prg := &Program{}
 	s, err := service.New(prg, svcConfig)
@@ -121,6 +185,10 @@ func main() {
 
 	// Handle service commands
 	if *install {
+		if err := prepareInstall(); err != nil {
+			logger.Errorf("Failed to create service directories: %v", err)
+			os.Exit(1)
+		}
 		err := s.Install()
 		if err != nil {
 			logger.Errorf("Failed to install service: %v", err)
@@ -188,6 +256,40 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Package diagnostics for a support ticket
+	if *diag {
+		path := *diagOut
+		if path == "" {
+			hostname, _ := os.Hostname()
+			path = fmt.Sprintf("siem-agent-diag-%s-%s.zip", hostname, time.Now().Format("20060102-150405"))
+		}
+
+		serviceStatus := "unknown"
+		if status, err := s.Status(); err == nil {
+			switch status {
+			case service.StatusRunning:
+				serviceStatus = "running"
+			case service.StatusStopped:
+				serviceStatus = "stopped"
+			}
+		} else {
+			serviceStatus = err.Error()
+		}
+
+		err := agent.WriteDiagnostics(path, agent.DiagnosticsOptions{
+			ConfigPath:    "config.yaml",
+			Version:       version,
+			ServiceStatus: serviceStatus,
+			LogFiles:      serviceLogFiles(),
+		})
+		if err != nil {
+			logger.Errorf("Failed to write diagnostics: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Diagnostics written to %s\n", path)
+		os.Exit(0)
+	}
+
 	// Run in console mode (for debugging)
 	if *console {
 		fmt.Printf("Starting SIEM Agent v%s in console mode...\n", version)
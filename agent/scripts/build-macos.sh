@@ -0,0 +1,71 @@
+#!/bin/bash
+# =====================================================================
+# SIEM Agent - macOS build and package script
+# =====================================================================
+#
+# Usage:
+#   scripts/build-macos.sh [version]
+#
+# Builds a universal (arm64 + x86_64) binary and an installer package:
+#   bin/siem-agent                  - universal binary
+#   bin/siem-agent-<version>.pkg    - installs /usr/local/bin/siem-agent,
+#                                     copies the example configuration and
+#                                     registers the LaunchDaemon
+#
+# Requirements: Go 1.21+, Xcode command line tools (clang, lipo, pkgbuild).
+# Set SIGN_IDENTITY to sign the binary and package (Developer ID), which
+# MDM profiles granting Full Disk Access need to match the agent.
+# Set ES_ENTITLEMENT=1 to also sign with the Endpoint Security client
+# entitlement. Only do this once Apple has granted it to the signing team
+# and its provisioning profile is installed: macOS kills a binary carrying
+# the entitlement without a matching profile at launch.
+# =====================================================================
+
+set -euo pipefail
+
+VERSION="${1:-1.0.0}"
+AGENT_DIR="$(cd "$(dirname "$0")/.." && pwd)"
+OUTPUT_DIR="$AGENT_DIR/bin"
+PKG_ROOT="$(mktemp -d)"
+trap 'rm -rf "$PKG_ROOT"' EXIT
+
+cd "$AGENT_DIR"
+mkdir -p "$OUTPUT_DIR"
+
+LDFLAGS="-s -w -X main.version=$VERSION -X main.commit=$(git rev-parse --short HEAD 2>/dev/null || echo dev) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+
+echo "Building SIEM Agent v$VERSION for macOS..."
+# cgo links the Endpoint Security framework
+for arch in arm64 amd64; do
+    clang_arch=$arch
+    [ "$arch" = "amd64" ] && clang_arch=x86_64
+    CGO_ENABLED=1 CC="clang -arch $clang_arch" GOOS=darwin GOARCH=$arch \
+        go build -ldflags "$LDFLAGS" -o "$OUTPUT_DIR/siem-agent-$arch" .
+done
+lipo -create -output "$OUTPUT_DIR/siem-agent" "$OUTPUT_DIR/siem-agent-arm64" "$OUTPUT_DIR/siem-agent-amd64"
+rm "$OUTPUT_DIR/siem-agent-arm64" "$OUTPUT_DIR/siem-agent-amd64"
+
+if [ -n "${SIGN_IDENTITY:-}" ]; then
+    SIGN_ARGS=(--force --options runtime --timestamp --identifier com.siem.agent)
+    if [ "${ES_ENTITLEMENT:-0}" = "1" ]; then
+        SIGN_ARGS+=(--entitlements scripts/macos/siem-agent.entitlements)
+    fi
+    codesign "${SIGN_ARGS[@]}" --sign "$SIGN_IDENTITY" "$OUTPUT_DIR/siem-agent"
+fi
+
+echo "Building installer package..."
+install -d "$PKG_ROOT/root/usr/local/bin" "$PKG_ROOT/root/Library/Application Support/SIEM Agent"
+install -m 0755 "$OUTPUT_DIR/siem-agent" "$PKG_ROOT/root/usr/local/bin/siem-agent"
+install -m 0640 config.yaml.example "$PKG_ROOT/root/Library/Application Support/SIEM Agent/config.yaml.example"
+
+install -d "$PKG_ROOT/scripts"
+install -m 0755 scripts/macos/preinstall scripts/macos/postinstall "$PKG_ROOT/scripts/"
+
+PKG_ARGS=(--root "$PKG_ROOT/root" --scripts "$PKG_ROOT/scripts"
+    --identifier com.siem.agent --version "$VERSION" --install-location /)
+if [ -n "${SIGN_IDENTITY:-}" ]; then
+    PKG_ARGS+=(--sign "${PKG_SIGN_IDENTITY:-$SIGN_IDENTITY}")
+fi
+pkgbuild "${PKG_ARGS[@]}" "$OUTPUT_DIR/siem-agent-$VERSION.pkg"
+
+echo "Done: $OUTPUT_DIR/siem-agent-$VERSION.pkg"
@@ -0,0 +1,76 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+
+	"github.com/kardianos/service"
+)
+
+// macOS install layout; the agent loads config.yaml from its working
+// directory
+const (
+	darwinServiceName = "com.siem.agent"
+	darwinConfigDir   = "/Library/Application Support/SIEM Agent"
+	darwinLogDir      = "/Library/Logs/SIEM Agent"
+	darwinLogFile     = darwinLogDir + "/siem-agent.log"
+)
+
+// launchdPlist is the LaunchDaemon installed by -install. launchd restarts
+// the agent if it exits, throttled to once every 10 seconds.
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{html .Name}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{html .Path}}</string>
+		{{- range .Config.Arguments}}
+		<string>{{html .}}</string>
+		{{- end}}
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{html .WorkingDirectory}}</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+	<key>ProcessType</key>
+	<string>Background</string>
+	<key>StandardOutPath</key>
+	<string>` + darwinLogFile + `</string>
+	<key>StandardErrorPath</key>
+	<string>` + darwinLogFile + `</string>
+</dict>
+</plist>
+`
+
+// configureService sets up the LaunchDaemon
+func configureService(svcConfig *service.Config) {
+	svcConfig.Name = darwinServiceName
+	svcConfig.WorkingDirectory = darwinConfigDir
+	svcConfig.Option = service.KeyValue{
+		"LaunchdConfig": launchdPlist,
+	}
+}
+
+// prepareInstall creates the configuration and log directories; launchd
+// does not create them
+func prepareInstall() error {
+	for _, dir := range []string{darwinConfigDir, darwinLogDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceLogFiles returns the log file launchd redirects output to
+func serviceLogFiles() []string {
+	return []string{darwinLogFile}
+}
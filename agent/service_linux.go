@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+
+	"github.com/kardianos/service"
+)
+
+// Linux install layout; the agent loads config.yaml from its working
+// directory
+const (
+	linuxServiceName = "siem-agent"
+	linuxConfigDir   = "/etc/siem-agent"
+	linuxStateDir    = "/var/lib/siem-agent"
+	linuxLogDir      = "/var/log/siem-agent"
+)
+
+// systemdUnit is the unit installed by -install. The agent only reads logs
+// and system state, so everything but its own state and log directories is
+// read-only. StateDirectory/LogsDirectory make those writable under
+// ProtectSystem=strict.
+const systemdUnit = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+After=network-online.target auditd.service
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+WorkingDirectory={{.WorkingDirectory|cmdEscape}}
+Restart=always
+RestartSec=5
+StateDirectory=siem-agent
+LogsDirectory=siem-agent
+StandardOutput=append:/var/log/siem-agent/siem-agent.log
+StandardError=append:/var/log/siem-agent/siem-agent.log
+
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=read-only
+PrivateTmp=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectControlGroups=yes
+RestrictSUIDSGID=yes
+RestrictRealtime=yes
+LockPersonality=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// configureService sets up the systemd unit
+func configureService(svcConfig *service.Config) {
+	svcConfig.Name = linuxServiceName
+	svcConfig.WorkingDirectory = linuxConfigDir
+	svcConfig.Option = service.KeyValue{
+		"SystemdScript": systemdUnit,
+	}
+}
+
+// prepareInstall creates the directories the unit expects. systemd
+// creates the state and log directories itself; they are created here too
+// so -console works before the first start.
+func prepareInstall() error {
+	for _, dir := range []string{linuxConfigDir, linuxStateDir, linuxLogDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceLogFiles returns the log file the unit appends output to
+func serviceLogFiles() []string {
+	return []string{linuxLogDir + "/siem-agent.log"}
+}
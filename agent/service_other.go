@@ -0,0 +1,19 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import "github.com/kardianos/service"
+
+// configureService keeps the defaults kardianos/service picks for the
+// platform
+func configureService(svcConfig *service.Config) {}
+
+// prepareInstall does nothing
+func prepareInstall() error {
+	return nil
+}
+
+// serviceLogFiles returns nothing; the service manager keeps the log
+func serviceLogFiles() []string {
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package main
+
+import "github.com/kardianos/service"
+
+// configureService sets up the Windows service: automatic start, restarted
+// by the SCM on failure
+func configureService(svcConfig *service.Config) {
+	svcConfig.Option = service.KeyValue{
+		"StartType":            "automatic",
+		"OnFailure":            "restart",
+		"OnFailureDelay":       5,
+		"OnFailureResetPeriod": 60,
+	}
+}
+
+// prepareInstall does nothing; the SCM needs no files
+func prepareInstall() error {
+	return nil
+}
+
+// serviceLogFiles returns nothing; the service logs to the Event Log
+func serviceLogFiles() []string {
+	return nil
+}